@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// auditLogEnv names the audit log file when --log-file isn't passed
+const auditLogEnv = "CURLY_LOG_FILE"
+
+// Values of --log-detail
+const (
+	auditDetailIteration = "iteration"
+	auditDetailRun       = "run"
+)
+
+// auditDetails are the values --log-detail accepts
+var auditDetails = []string{auditDetailIteration, auditDetailRun}
+
+// auditEntry is a line of the audit log, an execution of a file or, with
+// --log-detail run, a whole run of it
+type auditEntry struct {
+	Time        time.Time `json:"time"`
+	File        string    `json:"file"`
+	Environment string    `json:"environment,omitempty"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	Iteration   int       `json:"iteration,omitempty"`
+	// Requests, Failed and Statuses sum up a run
+	Requests   int         `json:"requests,omitempty"`
+	Failed     int         `json:"failed,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	Statuses   map[int]int `json:"statuses,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	Result     string      `json:"result"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// auditLog appends a JSON line per execution to a file, for a record of
+// what was sent to which environment. Writes from parallel executions are
+// serialized, and a file that can't be written is reported once and then
+// skipped so requests go on. A nil auditLog logs nothing
+type auditLog struct {
+	detail string
+
+	mu     sync.Mutex
+	file   *os.File
+	broken bool
+}
+
+// openAuditLog opens the audit log at path, or at $CURLY_LOG_FILE without
+// one, to append to. It returns nil when neither is set, and when the file
+// can't be opened, saying so
+func openAuditLog(path, detail string) *auditLog {
+	if path == "" {
+		path = os.Getenv(auditLogEnv)
+	}
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to open audit log, requests won't be logged: %v\n", err)
+		return nil
+	}
+	return &auditLog{detail: detail, file: file}
+}
+
+// checkAuditDetail validates a --log-detail value
+func checkAuditDetail(detail string) error {
+	for _, d := range auditDetails {
+		if detail == d {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --log-detail %q, expected one of %s", detail, strings.Join(auditDetails, ", "))
+}
+
+// Close closes the file of the log
+func (l *auditLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// write appends entry to the log, unless writing failed before
+func (l *auditLog) write(entry auditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.broken {
+		return
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		l.broken = true
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit log, further requests won't be logged: %v\n", err)
+	}
+}
+
+// auditRequest logs the executions of the command of a file
+type auditRequest struct {
+	log      *auditLog
+	base     auditEntry
+	redactor *redactor
+}
+
+// request returns what logs the executions of cmdText, prepared from file
+// for environment envName. The method and URL are the ones of its first curl
+// command, with secrets redacted
+func (l *auditLog) request(cmdText, file, envName string) *auditRequest {
+	if l == nil {
+		return nil
+	}
+	r := &auditRequest{log: l, redactor: newRedactor(cmdText)}
+	req := firstRequest(cmdText)
+	r.base = auditEntry{File: file, Environment: envName, Method: req.method, URL: r.redactor.redact(req.url)}
+	return r
+}
+
+// logExecution logs an execution that took took and got statuses, failing
+// with err
+func (r *auditRequest) logExecution(iteration int, took time.Duration, statuses []int, err error) {
+	if r == nil {
+		return
+	}
+	entry := r.base
+	entry.Time = time.Now().UTC()
+	entry.Iteration = iteration
+	if len(statuses) > 0 {
+		entry.Status = statuses[len(statuses)-1]
+	}
+	entry.DurationMs = milliseconds(took)
+	entry.Result, entry.Error = r.result(err)
+	r.log.write(entry)
+}
+
+// logIteration logs an execution of a run with --log-detail iteration
+func (r *auditRequest) logIteration(iteration int, took time.Duration, statuses []int, err error) {
+	if r != nil && r.log.detail == auditDetailIteration {
+		r.logExecution(iteration, took, statuses, err)
+	}
+}
+
+// logRun logs a whole run with --log-detail run, summed up by stats and
+// failing with err
+func (r *auditRequest) logRun(stats *run.ExecutionStats, err error) {
+	if r == nil || r.log.detail != auditDetailRun || stats == nil {
+		return
+	}
+	entry := r.base
+	entry.Time = time.Now().UTC()
+	entry.Requests = int(stats.Success + stats.Failed + stats.Throttled)
+	entry.Failed = int(stats.Failed)
+	entry.Statuses = stats.StatusCodes
+	entry.DurationMs = milliseconds(stats.EndTime.Sub(stats.StartTime))
+	entry.Result, entry.Error = r.result(err)
+	r.log.write(entry)
+}
+
+// result returns the result of an execution failing with err and the error,
+// with secrets redacted
+func (r *auditRequest) result(err error) (string, string) {
+	if err != nil {
+		return "failed", r.redactor.redact(err.Error())
+	}
+	return "ok", ""
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readAuditLog returns the entries of the audit log at path
+func readAuditLog(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("audit log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	server := echoServer(t)
+	cmdText := "API_KEY=\"k-9876\"\ncurl -s -X POST \"" + server.URL + "/users?api_key=${API_KEY}&status=201\" -d 'name=ada'"
+
+	tests := []struct {
+		name        string
+		detail      string
+		wantEntries int
+	}{
+		{name: "a line per iteration", detail: auditDetailIteration, wantEntries: 4},
+		{name: "a line per run", detail: auditDetailRun, wantEntries: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "curly.log")
+			log := openAuditLog(path, tt.detail)
+			audit := log.request(cmdText, "POST_users.curl", "staging")
+			stats, err := execCmd(cmdText, execOptions{times: 4, parallel: 4, quiet: true, audit: audit})
+			if err != nil {
+				t.Fatalf("execCmd() error = %v", err)
+			}
+			audit.logRun(stats, err)
+			log.Close()
+
+			entries := readAuditLog(t, path)
+			if len(entries) != tt.wantEntries {
+				t.Fatalf("audit log has %d entries, want %d", len(entries), tt.wantEntries)
+			}
+			iterations := map[int]bool{}
+			for _, entry := range entries {
+				if entry.File != "POST_users.curl" || entry.Environment != "staging" || entry.Method != "POST" || entry.Result != "ok" {
+					t.Errorf("audit entry = %+v", entry)
+				}
+				if !strings.HasSuffix(entry.URL, "/users?api_key=****&status=201") {
+					t.Errorf("audit entry URL = %q, want the api_key redacted", entry.URL)
+				}
+				iterations[entry.Iteration] = true
+			}
+			if tt.detail == auditDetailIteration && (len(iterations) != 4 || entries[0].Status != 201) {
+				t.Errorf("audit entries = %+v, want iterations 1 to 4 with status 201", entries)
+			}
+			if tt.detail == auditDetailRun && (entries[0].Requests != 4 || entries[0].Statuses[201] != 4) {
+				t.Errorf("audit entry = %+v, want 4 requests with status 201", entries[0])
+			}
+		})
+	}
+}
+
+func TestAuditLogFailure(t *testing.T) {
+	server := echoServer(t)
+	path := filepath.Join(t.TempDir(), "curly.log")
+	t.Setenv(auditLogEnv, path)
+	log := openAuditLog("", auditDetailIteration)
+	if log == nil {
+		t.Fatalf("openAuditLog() didn't open $%s", auditLogEnv)
+	}
+
+	cmdText := "TOKEN=\"s3cr3t\"\ncurl -s -H \"X-Token: ${TOKEN}\" \"" + server.URL + "/missing?status=404\""
+	eo := execOptions{times: 1, quiet: true, failOn: []statusPattern{"4xx"}, audit: log.request(cmdText, "GET_missing.curl", "")}
+	if _, err := execCmd(cmdText, eo); err == nil {
+		t.Fatal("execCmd() succeeded, want the 404 to fail it")
+	}
+	entries := readAuditLog(t, path)
+	if len(entries) != 1 || entries[0].Result != "failed" || entries[0].Status != 404 || entries[0].Error != "HTTP status 404" {
+		t.Errorf("audit entries = %+v, want a failed run with status 404", entries)
+	}
+
+	// A log that can't be written doesn't stop the requests
+	log.file.Close()
+	eo.failOn = nil
+	if _, err := execCmd(cmdText, eo); err != nil {
+		t.Errorf("execCmd() with a broken audit log error = %v", err)
+	}
+	if !log.broken {
+		t.Error("the failed write to the audit log wasn't noticed")
+	}
+}
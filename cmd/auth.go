@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// authTokenVar is the variable the token of an environment's auth block is
+// exposed as
+const authTokenVar = "AUTH_TOKEN"
+
+// authCacheDir is where fetched tokens are cached, in the collection
+// directory
+const authCacheDir = ".curly/auth"
+
+// authExpirySkew is how long before it expires a cached token is refreshed,
+// so it doesn't expire while the requests are in flight
+const authExpirySkew = 30 * time.Second
+
+// authTimeout bounds the request to the token endpoint
+const authTimeout = 30 * time.Second
+
+// cachedToken is a token as authCacheDir keeps it, along with what it was
+// fetched for so a changed auth block doesn't reuse it
+type cachedToken struct {
+	TokenURL    string    `json:"token_url"`
+	ClientID    string    `json:"client_id"`
+	Scopes      []string  `json:"scopes,omitempty"`
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// tokenResponse is what an OAuth2 token endpoint answers, a token or an error
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// withAuthToken adds the token of the auth block of the environment
+// opts.envName, if it has one, to envVars as AUTH_TOKEN and to the
+// environment of the commands curly runs. Of layered environments, the last
+// with an auth block is used. The token is escaped to stay literal in the
+// double-quoted assignments it replaces
+func withAuthToken(envVars run.Environment, dir string, opts runOptions) (run.Environment, error) {
+	if opts.envName == "" {
+		return envVars, nil
+	}
+	config, err := run.LoadEnvConfig(opts.envsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load envs.yml: %w", err)
+	}
+	var auth *run.AuthConfig
+	var authEnv string
+	for _, name := range run.EnvLayers(opts.envName) {
+		if config.Auth[name] != nil {
+			auth, authEnv = config.Auth[name], name
+		}
+	}
+	if auth == nil {
+		return envVars, nil
+	}
+
+	token, err := authToken(dir, authEnv, auth, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Setenv(authTokenVar, token); err != nil {
+		return nil, err
+	}
+	opts.sources.Set(authTokenVar, "auth ("+authEnv+")")
+	merged := run.Environment{authTokenVar: shellquote.EscapeDoubleQuoted(token)}
+	for k, v := range envVars {
+		if k != authTokenVar {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// authToken returns the token for auth, from the cache of the environment
+// envName while it is valid, unless opts.noAuthCache, and fetched from the
+// token endpoint otherwise. Neither the client secret nor the token are ever
+// printed
+func authToken(dir, envName string, auth *run.AuthConfig, opts runOptions) (string, error) {
+	resolved, err := resolveAuth(*auth)
+	if err != nil {
+		return "", fmt.Errorf("auth for environment %s: %w", envName, err)
+	}
+
+	cachePath := filepath.Join(dir, filepath.FromSlash(authCacheDir), envName+".json")
+	if !opts.noAuthCache {
+		if cached, ok := readCachedToken(cachePath, resolved); ok {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "Using the cached token for environment %s, expiring in %s\n", envName, time.Until(cached.ExpiresAt).Round(time.Second))
+			}
+			return cached.AccessToken, nil
+		}
+	}
+
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "Fetching a token for environment %s from %s (client %s)\n", envName, resolved.TokenURL, resolved.ClientID)
+	}
+	token, expiresIn, err := fetchToken(resolved, opts.insecure)
+	if err != nil {
+		return "", fmt.Errorf("auth for environment %s: %w", envName, err)
+	}
+	// A token without an expiry is fetched again next time
+	if expiresIn > 0 {
+		cached := cachedToken{
+			TokenURL:    resolved.TokenURL,
+			ClientID:    resolved.ClientID,
+			Scopes:      resolved.Scopes,
+			AccessToken: token,
+			ExpiresAt:   time.Now().Add(time.Duration(expiresIn) * time.Second),
+		}
+		if err := writeCachedToken(cachePath, cached); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return token, nil
+}
+
+// resolveAuth returns auth with its ${env:NAME} references replaced by their
+// values, checking the fields the grant needs are set
+func resolveAuth(auth run.AuthConfig) (run.AuthConfig, error) {
+	var err error
+	fields := []*string{&auth.TokenURL, &auth.ClientID, &auth.ClientSecret}
+	for _, field := range fields {
+		if *field, err = expandEnvRefs(*field); err != nil {
+			return auth, err
+		}
+	}
+	scopes := make([]string, len(auth.Scopes))
+	for i, scope := range auth.Scopes {
+		if scopes[i], err = expandEnvRefs(scope); err != nil {
+			return auth, err
+		}
+	}
+	auth.Scopes = scopes
+
+	switch {
+	case auth.TokenURL == "":
+		return auth, errors.New("token_url is required")
+	case auth.ClientID == "":
+		return auth, errors.New("client_id is required")
+	case auth.ClientSecret == "":
+		return auth, errors.New("client_secret is required")
+	}
+	return auth, nil
+}
+
+// expandEnvRefs replaces the ${env:NAME} references in s with the values of
+// the OS environment variables as they are, failing on an unset one without
+// a :-default
+func expandEnvRefs(s string) (string, error) {
+	var missing string
+	expanded := run.OSEnvRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, `\`) {
+			return ref[1:]
+		}
+		match := run.OSEnvRefPattern.FindStringSubmatch(ref)
+		value, ok := os.LookupEnv(match[1])
+		if strings.Contains(ref, ":-") && value == "" {
+			return match[2]
+		}
+		if !ok && missing == "" {
+			missing = match[1]
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
+
+// fetchToken requests a token for auth with the client credentials grant,
+// authenticating the client with HTTP Basic auth, and returns it with how
+// many seconds it is valid for, 0 when the endpoint didn't say
+func fetchToken(auth run.AuthConfig, insecure bool) (string, int, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, auth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid token_url: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(auth.ClientID), url.QueryEscape(auth.ClientSecret))
+
+	client := &http.Client{Timeout: authTimeout}
+	if insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var token tokenResponse
+	jsonErr := json.Unmarshal(body, &token)
+	if resp.StatusCode/100 != 2 {
+		if jsonErr == nil && token.Error != "" {
+			msg := token.Error
+			if token.ErrorDescription != "" {
+				msg += ": " + token.ErrorDescription
+			}
+			return "", 0, fmt.Errorf("token endpoint returned %s: %s", resp.Status, msg)
+		}
+		return "", 0, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if jsonErr != nil {
+		return "", 0, fmt.Errorf("token endpoint returned invalid JSON: %w", jsonErr)
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("token endpoint returned no access_token")
+	}
+	return token.AccessToken, token.ExpiresIn, nil
+}
+
+// readCachedToken returns the token cached at path when it was fetched for
+// auth and is still valid for a while
+func readCachedToken(path string, auth run.AuthConfig) (cachedToken, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cachedToken{}, false
+	}
+	var cached cachedToken
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return cachedToken{}, false
+	}
+	if cached.TokenURL != auth.TokenURL || cached.ClientID != auth.ClientID || strings.Join(cached.Scopes, " ") != strings.Join(auth.Scopes, " ") {
+		return cachedToken{}, false
+	}
+	if cached.AccessToken == "" || time.Now().Add(authExpirySkew).After(cached.ExpiresAt) {
+		return cachedToken{}, false
+	}
+	return cached, true
+}
+
+// writeCachedToken caches token at path, readable by the user only
+func writeCachedToken(path string, token cachedToken) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to cache token: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to cache token: %w", err)
+	}
+	return nil
+}
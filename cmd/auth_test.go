@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// fakeTokenEndpoint serves client credentials tokens token-1, token-2, ... to
+// the client app with secret s3cr3t, counting the tokens it handed out
+func fakeTokenEndpoint(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	t.Helper()
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"unsupported_grant_type"}`))
+			return
+		}
+		if id != "app" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"Client authentication failed"}`))
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "token-" + string(rune('0'+n)),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+			"scope":        r.Form.Get("scope"),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+// writeAuthCollection writes an envs.yml whose dev environment has an auth
+// block for tokenURL and a .curl file sending AUTH_TOKEN to dir
+func writeAuthCollection(t *testing.T, dir, tokenURL string) string {
+	t.Helper()
+	envs := `environments:
+  dev:
+    BASE_URL: "http://localhost:8080"
+    auth:
+      token_url: "` + tokenURL + `"
+      client_id: app
+      client_secret: "${env:CURLY_TEST_SECRET}"
+      scopes: [read, write]
+`
+	if err := os.WriteFile(filepath.Join(dir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "GET_me.curl")
+	content := "BASE_URL=\"VALUE\"\ncurl -s -H \"Authorization: Bearer ${AUTH_TOKEN}\" \"${BASE_URL}/me\"\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadEnvConfigAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeAuthCollection(t, dir, "https://auth.example.com/token")
+	config, err := run.LoadEnvConfig(filepath.Join(dir, "envs.yml"))
+	if err != nil {
+		t.Fatalf("loadEnvConfig() error = %v", err)
+	}
+	if _, ok := config.Environments["dev"]["auth"]; ok || config.Environments["dev"]["BASE_URL"] != "http://localhost:8080" {
+		t.Errorf("dev environment = %v, want BASE_URL without auth", config.Environments["dev"])
+	}
+	auth := config.Auth["dev"]
+	if auth == nil || auth.TokenURL != "https://auth.example.com/token" || auth.ClientID != "app" || strings.Join(auth.Scopes, " ") != "read write" {
+		t.Errorf("dev auth = %+v", auth)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	t.Setenv(authTokenVar, "")
+	t.Setenv("CURLY_TEST_SECRET", "s3cr3t")
+	server, issued := fakeTokenEndpoint(t, 3600)
+	dir := t.TempDir()
+	file := writeAuthCollection(t, dir, server.URL)
+
+	fetch := func(opts runOptions) string {
+		t.Helper()
+		opts.envName = "dev"
+		if _, err := runFile(file, dir, opts); err != nil {
+			t.Fatalf("runFile() error = %v", err)
+		}
+		return os.Getenv(authTokenVar)
+	}
+
+	if token := fetch(runOptions{}); token != "token-1" || *issued != 1 {
+		t.Errorf("first run got %q after %d requests, want token-1 after 1", token, *issued)
+	}
+	if token := fetch(runOptions{}); token != "token-1" || *issued != 1 {
+		t.Errorf("cached run got %q after %d requests, want token-1 from the cache", token, *issued)
+	}
+	if token := fetch(runOptions{noAuthCache: true}); token != "token-2" || *issued != 2 {
+		t.Errorf("--no-auth-cache run got %q after %d requests, want a new token-2", token, *issued)
+	}
+	info, err := os.Stat(filepath.Join(dir, ".curly", "auth", "dev.json"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token cache = %v, %v, want a file only the user can read", info, err)
+	}
+
+	// An expired token is refreshed
+	cachePath := filepath.Join(dir, ".curly", "auth", "dev.json")
+	cached, ok := readCachedToken(cachePath, run.AuthConfig{TokenURL: server.URL, ClientID: "app", Scopes: []string{"read", "write"}})
+	if !ok {
+		t.Fatal("readCachedToken() found no valid token")
+	}
+	cached.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := writeCachedToken(cachePath, cached); err != nil {
+		t.Fatal(err)
+	}
+	if token := fetch(runOptions{}); token != "token-3" || *issued != 3 {
+		t.Errorf("run with an expired token got %q after %d requests, want a new token-3", token, *issued)
+	}
+
+	// A token for other credentials isn't reused
+	if _, ok := readCachedToken(cachePath, run.AuthConfig{TokenURL: server.URL, ClientID: "other", Scopes: []string{"read", "write"}}); ok {
+		t.Error("readCachedToken() returned a token fetched for another client")
+	}
+}
+
+func TestAuthTokenSubstituted(t *testing.T) {
+	t.Setenv(authTokenVar, "")
+	t.Setenv("CURLY_TEST_SECRET", "s3cr3t")
+	server, _ := fakeTokenEndpoint(t, 0)
+	dir := t.TempDir()
+	file := writeAuthCollection(t, dir, server.URL)
+	if err := os.WriteFile(file, []byte("AUTH_TOKEN=\"VALUE\"\ncurl -s -H \"Authorization: Bearer ${AUTH_TOKEN}\" x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmdText, err := runFile(file, dir, runOptions{envName: "dev"})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if !strings.Contains(cmdText, `AUTH_TOKEN="token-1"`) {
+		t.Errorf("runFile() = %q, want the token assigned", cmdText)
+	}
+	// Without an expires_in nothing is cached
+	if _, err := os.Stat(filepath.Join(dir, ".curly", "auth", "dev.json")); !os.IsNotExist(err) {
+		t.Errorf("a token without an expiry was cached: %v", err)
+	}
+}
+
+func TestAuthTokenErrors(t *testing.T) {
+	t.Setenv(authTokenVar, "")
+	server, _ := fakeTokenEndpoint(t, 3600)
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html>bad gateway</html>"))
+	}))
+	defer plain.Close()
+
+	tests := []struct {
+		name    string
+		secret  string
+		url     string
+		wantErr string
+	}{
+		{name: "rejected client", secret: "wrong", url: server.URL, wantErr: "auth for environment dev: token endpoint returned 401 Unauthorized: invalid_client: Client authentication failed"},
+		{name: "non-JSON error", secret: "s3cr3t", url: plain.URL, wantErr: "token endpoint returned 502 Bad Gateway"},
+		{name: "unset secret", url: server.URL, wantErr: "environment variable CURLY_TEST_SECRET is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.secret != "" {
+				t.Setenv("CURLY_TEST_SECRET", tt.secret)
+			} else {
+				os.Unsetenv("CURLY_TEST_SECRET")
+			}
+			dir := t.TempDir()
+			file := writeAuthCollection(t, dir, tt.url)
+			_, err := runFile(file, dir, runOptions{envName: "dev"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runFile() error = %v, want %q", err, tt.wantErr)
+			}
+			if err != nil && tt.secret != "" && strings.Contains(err.Error(), tt.secret) {
+				t.Errorf("runFile() error %q shows the secret", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// runMetrics are the figures of a run --baseline compares
+type runMetrics struct {
+	p50, p95, p99 time.Duration
+	// throughput is in requests per second and errorRate the fraction of
+	// executions that failed
+	throughput float64
+	errorRate  float64
+}
+
+// metricsOf computes the metrics of report
+func metricsOf(report statsReport) runMetrics {
+	var m runMetrics
+	if len(report.Latencies) > 0 {
+		samples := make([]run.LatencySample, len(report.Latencies))
+		for i, l := range report.Latencies {
+			samples[i] = run.LatencySample{Iteration: l.Iteration, Duration: time.Duration(l.DurationMs * float64(time.Millisecond))}
+		}
+		l := run.SummarizeLatencies(samples)
+		m.p50, m.p95, m.p99 = l.P50, l.P95, l.P99
+	}
+	if report.DurationMs > 0 {
+		m.throughput = float64(report.Total) / (report.DurationMs / 1000)
+	}
+	if report.Total > 0 {
+		m.errorRate = float64(report.Failed) / float64(report.Total)
+	}
+	return m
+}
+
+// loadBaseline reads the statistics --stats-out wrote as JSON to path.
+// Reports of a newer schema than statsSchema are refused. Those without one
+// were written before it was added, in the first schema
+func loadBaseline(path string) (statsReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return statsReport{}, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var report statsReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return statsReport{}, fmt.Errorf("baseline %s isn't a JSON stats file written by --stats-out: %w", path, err)
+	}
+	if report.Schema > statsSchema {
+		return statsReport{}, fmt.Errorf("baseline %s has stats schema %d, this curly reads up to %d, upgrade it to compare against it", path, report.Schema, statsSchema)
+	}
+	if report.Schema < 0 {
+		return statsReport{}, fmt.Errorf("baseline %s has invalid stats schema %d", path, report.Schema)
+	}
+	return report, nil
+}
+
+// parseSlowerThreshold parses the --fail-if-slower threshold, a percentage
+// like 10%
+func parseSlowerThreshold(s string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%")), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid --fail-if-slower %q, expected a percentage like 10%%", s)
+	}
+	return value, nil
+}
+
+// printComparison prints the metrics of current next to those of baseline,
+// named name, with how much they changed
+func printComparison(out io.Writer, name string, baseline, current runMetrics) {
+	fmt.Fprintf(out, "\nCompared to %s:\n", name)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  METRIC\tBASELINE\tCURRENT\tCHANGE")
+	latency := func(label string, before, after time.Duration) {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", label, formatLatency(before), formatLatency(after), percentChange(float64(before), float64(after)))
+	}
+	latency("p50", baseline.p50, current.p50)
+	latency("p95", baseline.p95, current.p95)
+	latency("p99", baseline.p99, current.p99)
+	fmt.Fprintf(w, "  Throughput\t%.2f req/s\t%.2f req/s\t%s\n", baseline.throughput, current.throughput, percentChange(baseline.throughput, current.throughput))
+	fmt.Fprintf(w, "  Error rate\t%.2f%%\t%.2f%%\t%+.2f pp\n", baseline.errorRate*100, current.errorRate*100, (current.errorRate-baseline.errorRate)*100)
+	w.Flush()
+}
+
+// formatLatency formats a latency of the comparison, - without one
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// percentChange formats the change from before to after as a signed
+// percentage, - when before is 0
+func percentChange(before, after float64) string {
+	if before == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+}
+
+// checkSlower fails when the p95 of current is more than threshold percent
+// slower than that of baseline
+func checkSlower(baseline, current runMetrics, threshold float64) error {
+	if baseline.p95 == 0 {
+		return fmt.Errorf("the baseline has no latencies to compare the p95 against")
+	}
+	if current.p95 == 0 {
+		return nil
+	}
+	change := float64(current.p95-baseline.p95) / float64(baseline.p95) * 100
+	if change > threshold {
+		return fmt.Errorf("p95 regressed %.1f%% from %s to %s, over --fail-if-slower %g%%",
+			change, formatLatency(baseline.p95), formatLatency(current.p95), threshold)
+	}
+	return nil
+}
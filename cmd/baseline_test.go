@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// writeBaselineStats writes the stats of a run of 100 executions, failed of
+// them failing, taking latencies in turn, over 2s, as --stats-out does
+func writeBaselineStats(t *testing.T, name string, failed int, latencies ...time.Duration) string {
+	t.Helper()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	stats := &run.ExecutionStats{Total: 100, StartTime: start, EndTime: start.Add(2 * time.Second)}
+	for i := range 100 {
+		stats.RecordLatency(run.LatencySample{Iteration: i + 1, Duration: latencies[i%len(latencies)]})
+	}
+	stats.Failed = int32(failed)
+	stats.Success = int32(100 - failed)
+	path := filepath.Join(t.TempDir(), name)
+	if err := writeStatsFile(path, "json", stats); err != nil {
+		t.Fatalf("writeStatsFile() error = %v", err)
+	}
+	return path
+}
+
+func TestBaselineComparison(t *testing.T) {
+	before := writeBaselineStats(t, "before.json", 2, 100*time.Millisecond, 200*time.Millisecond)
+	after := writeBaselineStats(t, "after.json", 0, 90*time.Millisecond, 230*time.Millisecond)
+
+	baseReport, err := loadBaseline(before)
+	if err != nil {
+		t.Fatalf("loadBaseline() error = %v", err)
+	}
+	currentReport, err := loadBaseline(after)
+	if err != nil {
+		t.Fatalf("loadBaseline() error = %v", err)
+	}
+	base, current := metricsOf(baseReport), metricsOf(currentReport)
+
+	var out bytes.Buffer
+	printComparison(&out, "before.json", base, current)
+	for _, want := range []string{
+		"Compared to before.json:",
+		"p50         100ms        90ms         -10.0%",
+		"p95         200ms        230ms        +15.0%",
+		"Throughput  50.00 req/s  50.00 req/s  +0.0%",
+		"Error rate  2.00%        0.00%        -2.00 pp",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("comparison is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	tests := []struct {
+		threshold float64
+		wantErr   string
+	}{
+		{threshold: 20},
+		{threshold: 15},
+		{threshold: 10, wantErr: "p95 regressed 15.0% from 200ms to 230ms, over --fail-if-slower 10%"},
+	}
+	for _, tt := range tests {
+		err := checkSlower(base, current, tt.threshold)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("checkSlower(%g) error = %v", tt.threshold, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("checkSlower(%g) error = %v, want %q", tt.threshold, err, tt.wantErr)
+		}
+	}
+	if err := checkSlower(current, base, 0); err != nil {
+		t.Errorf("checkSlower() of a faster run error = %v", err)
+	}
+}
+
+func TestLoadBaselineSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "current schema", content: `{"schema": 1, "total": 1, "latencies": []}`},
+		{name: "before the schema field", content: `{"total": 1, "latencies": []}`},
+		{name: "newer schema", content: `{"schema": 2, "total": 1}`, wantErr: "has stats schema 2, this curly reads up to 1"},
+		{name: "not JSON", content: "section,key,value\n", wantErr: "isn't a JSON stats file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "baseline.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadBaseline(path)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("loadBaseline() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("loadBaseline() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSlowerThreshold(t *testing.T) {
+	for input, want := range map[string]float64{"10%": 10, "2.5%": 2.5, "5": 5, " 0% ": 0} {
+		if got, err := parseSlowerThreshold(input); err != nil || got != want {
+			t.Errorf("parseSlowerThreshold(%q) = %g, %v, want %g", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "fast", "-5%", "10%%"} {
+		if _, err := parseSlowerThreshold(input); err == nil {
+			t.Errorf("parseSlowerThreshold(%q) succeeded, want an error", input)
+		}
+	}
+}
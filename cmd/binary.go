@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"strings"
+)
+
+// binaryResponseName is the name binary responses are saved under in the
+// working directory, numbered when taken
+const binaryResponseName = "response"
+
+// textMediaTypes are the media types outside text/* that are safe to print
+var textMediaTypes = map[string]bool{
+	"application/json":                  true,
+	"application/xml":                   true,
+	"application/javascript":            true,
+	"application/yaml":                  true,
+	"application/x-yaml":                true,
+	"application/x-www-form-urlencoded": true,
+	"application/graphql":               true,
+}
+
+// isBinaryResponse reports whether body, which came back with contentType,
+// would garble a terminal: it holds NUL bytes, or its Content-Type says it
+// isn't text
+func isBinaryResponse(body, contentType string) bool {
+	if strings.IndexByte(body, 0) >= 0 {
+		return true
+	}
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), textMediaTypes[mediaType]:
+		return false
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return false
+	}
+	return true
+}
+
+// printBinaryResponse saves the binary body to a file in the working
+// directory and returns the line printed in its place
+func printBinaryResponse(body, contentType string) string {
+	description := formatSize(len(body))
+	if contentType != "" {
+		description += ", " + contentType
+	}
+	ext := ".bin"
+	if contentType != "" {
+		if e := outputExtension(contentType); e != ".out" {
+			ext = e
+		}
+	}
+
+	path, err := saveBinaryResponse(body, ext)
+	if err != nil {
+		return fmt.Sprintf("[binary response: %s] not printed, and saving it failed: %v", description, err)
+	}
+	return fmt.Sprintf("[binary response: %s] written to %s", description, path)
+}
+
+// saveBinaryResponse writes body to the first of response<ext>,
+// response-1<ext>, ... that doesn't exist yet, so neither the user's files
+// nor other responses of the run are overwritten
+func saveBinaryResponse(body, ext string) (string, error) {
+	for n := 0; ; n++ {
+		path := "./" + binaryResponseName + ext
+		if n > 0 {
+			path = fmt.Sprintf("./%s-%d%s", binaryResponseName, n, ext)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(body)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return path, err
+	}
+}
+
+// formatSize formats a number of bytes for people, like 1.4 MB
+func formatSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, units := float64(n)/unit, "KB"
+	for _, u := range []string{"MB", "GB"} {
+		if size < unit {
+			break
+		}
+		size, units = size/unit, u
+	}
+	return fmt.Sprintf("%.1f %s", size, units)
+}
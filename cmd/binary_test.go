@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsBinaryResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        bool
+	}{
+		{name: "NUL bytes", body: string([]byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00}), want: true},
+		{name: "NUL bytes despite a text type", body: "a\x00b", contentType: "text/plain", want: true},
+		{name: "plain text", body: "hello", want: false},
+		{name: "pdf", body: "%PDF-1.7", contentType: "application/pdf", want: true},
+		{name: "json with charset", body: "{}", contentType: "application/json; charset=utf-8", want: false},
+		{name: "problem+json", body: "{}", contentType: "application/problem+json", want: false},
+		{name: "html", body: "<p>", contentType: "text/html", want: false},
+		{name: "image", body: "GIF89a", contentType: "image/gif", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinaryResponse(tt.body, tt.contentType); got != tt.want {
+				t.Errorf("isBinaryResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 1468006: "1.4 MB", 3 << 30: "3.0 GB"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestFormatResponsesSavesBinary(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	// An existing file is never overwritten
+	if err := os.WriteFile("response.pdf", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := "%PDF-1.7\x00\x01\x02"
+	out := pdf + "\n__curly_status__=200 application/pdf\n"
+	got := formatResponses(out, execOptions{pretty: true})
+	if want := "[binary response: 11 B, application/pdf] written to ./response-1.pdf"; got != want {
+		t.Errorf("formatResponses() = %q, want %q", got, want)
+	}
+	saved, err := os.ReadFile("response-1.pdf")
+	if err != nil || string(saved) != pdf {
+		t.Errorf("saved response = %q, %v, want the body", saved, err)
+	}
+	if mine, _ := os.ReadFile("response.pdf"); string(mine) != "mine" {
+		t.Errorf("existing response.pdf was overwritten with %q", mine)
+	}
+
+	// Without formatting, as with --raw, the body is printed as is
+	if got := formatResponses(out, execOptions{}); got != pdf {
+		t.Errorf("formatResponses() without pretty = %q, want the body", got)
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// sessionFile is the file in the collection directory that values captured
+// by single runs are saved to, layered over envs.yml in later runs
+const sessionFile = ".curly-session"
+
+// capture is a "# capture: NAME = expression" comment of a .curl file,
+// setting the variable NAME to what jq's expression yields for the response
+type capture struct {
+	name string
+	expr string
+}
+
+// parseCaptures reads the capture comments of a .curl file, like
+//
+//	# capture: TOKEN = .access_token
+func parseCaptures(content string) ([]capture, error) {
+	var captures []capture
+	lines := strings.Split(content, "\n")
+	inBody := run.HeredocBodies(lines)
+	for n, line := range lines {
+		if inBody[n] {
+			continue
+		}
+		comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(comment), ":")
+		if !ok || key != "capture" {
+			continue
+		}
+		name, expr, ok := strings.Cut(value, "=")
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok || expr == "" {
+			return nil, fmt.Errorf("line %d: expected \"capture: NAME = expression\"", n+1)
+		}
+		if !run.VarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid capture name %q", n+1, name)
+		}
+		captures = append(captures, capture{name: name, expr: expr})
+	}
+	return captures, nil
+}
+
+// fileCaptures reads the captures of the .curl file at path, if there is one
+func fileCaptures(path string) ([]capture, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	captures, err := parseCaptures(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return captures, nil
+}
+
+// checkCaptures makes sure the expressions of captures can be evaluated
+func checkCaptures(captures []capture) error {
+	for _, c := range captures {
+		if err := checkJQ(c.expr); err != nil {
+			return fmt.Errorf("capture %s: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// evalCaptures evaluates captures against the response body, failing at the
+// first one whose value is missing
+func evalCaptures(body string, captures []capture) (run.Environment, error) {
+	values := run.Environment{}
+	for _, c := range captures {
+		value, err := captureValue(body, c.expr)
+		if err != nil {
+			return nil, fmt.Errorf("capture %s: %w", c.name, err)
+		}
+		values[c.name] = value
+	}
+	return values, nil
+}
+
+// captureValue returns the first result of jq's expr for the JSON document
+// body, a string as it is and anything else as JSON. No result or null means
+// the value is missing
+func captureValue(body, expr string) (string, error) {
+	trimmed := strings.TrimSpace(body)
+	if !json.Valid([]byte(trimmed)) {
+		return "", errors.New("response isn't JSON")
+	}
+	jq := exec.Command("jq", "-c", expr)
+	jq.Stdin = strings.NewReader(trimmed)
+	var stderr bytes.Buffer
+	jq.Stderr = &stderr
+	out, err := jq.Output()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return "", errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+	first, _, _ := strings.Cut(string(out), "\n")
+	if first == "" || first == "null" {
+		return "", fmt.Errorf("%s is missing from the response", expr)
+	}
+	var s string
+	if json.Unmarshal([]byte(first), &s) == nil {
+		return s, nil
+	}
+	return first, nil
+}
+
+// withCaptured layers the session file of dir, then the values captured
+// earlier in a chain, over envVars. Both come from responses, so they are
+// escaped to stay literal in the double-quoted assignments they replace
+func withCaptured(envVars run.Environment, dir string, opts runOptions) (run.Environment, error) {
+	session, err := loadSession(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(session) == 0 && len(opts.captured) == 0 {
+		return envVars, nil
+	}
+	merged := run.Environment{}
+	for k, v := range envVars {
+		merged[k] = v
+	}
+	for _, layer := range []run.Environment{session, opts.captured} {
+		for k, v := range layer {
+			merged[k] = shellquote.EscapeDoubleQuoted(v)
+		}
+	}
+	opts.sources.SetAll(session, "session")
+	opts.sources.SetAll(opts.captured, "capture")
+	return merged, nil
+}
+
+// loadSession reads the session file of dir, if there is one
+func loadSession(dir string) (run.Environment, error) {
+	path := filepath.Join(dir, sessionFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	return run.ParseDotEnv(path, string(data))
+}
+
+// saveSession adds values to the session file of dir and returns its path
+func saveSession(dir string, values run.Environment) (string, error) {
+	session, err := loadSession(dir)
+	if err != nil {
+		return "", err
+	}
+	merged := run.Environment{}
+	for _, layer := range []run.Environment{session, values} {
+		for k, v := range layer {
+			merged[k] = v
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Values captured by curly, used over envs.yml. Delete this file to forget them\n")
+	for _, key := range sortedKeys(merged) {
+		fmt.Fprintf(&b, "%s=%s\n", key, quoteDotEnvValue(merged[key]))
+	}
+	path := filepath.Join(dir, sessionFile)
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+	return path, nil
+}
+
+// quoteDotEnvValue double-quotes value the way parseDotEnvValue reads it back
+func quoteDotEnvValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\t", `\t`).Replace(value) + `"`
+}
+
+// offerSession prints the values a single run captured on out and, with ask,
+// offers to save them to the session file of dir, reading the answer from in
+func offerSession(in io.Reader, out io.Writer, dir string, values run.Environment, ask bool) error {
+	fmt.Fprintln(out, "Captured:")
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(out, "  %s=%s\n", key, values[key])
+	}
+	if !ask {
+		return nil
+	}
+
+	fmt.Fprintf(out, "Save to %s for later runs? [y/N] ", filepath.Join(dir, sessionFile))
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		path, err := saveSession(dir, values)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Saved to %s\n", path)
+	}
+	return nil
+}
+
+// sortedKeys returns the names of the variables of env in order
+func sortedKeys(env run.Environment) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestParseCaptures(t *testing.T) {
+	content := `# POST /login
+# capture: TOKEN = .access_token
+#   capture: ADMIN=.user.role == "admin"
+# Not a capture: TOKEN = nothing
+curl -s -X POST "${BASE_URL}/login"
+`
+	got, err := parseCaptures(content)
+	if err != nil {
+		t.Fatalf("parseCaptures() error = %v", err)
+	}
+	want := []capture{{name: "TOKEN", expr: ".access_token"}, {name: "ADMIN", expr: `.user.role == "admin"`}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCaptures() = %+v, want %+v", got, want)
+	}
+
+	for _, content := range []string{"# capture: TOKEN", "# capture: TOKEN =", "# capture: 1TOKEN = .a"} {
+		if _, err := parseCaptures(content); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("parseCaptures(%q) error = %v, want one naming line 1", content, err)
+		}
+	}
+}
+
+func TestEvalCaptures(t *testing.T) {
+	if _, err := exec.LookPath("jq"); err != nil {
+		t.Skip("jq not installed")
+	}
+
+	body := `{"access_token":"abc","user":{"id":42,"roles":["admin"]},"expires":null}`
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{name: "string unquoted", expr: ".access_token", want: "abc"},
+		{name: "number", expr: ".user.id", want: "42"},
+		{name: "array as JSON", expr: ".user.roles", want: `["admin"]`},
+		{name: "first result", expr: ".user.roles[], \"user\"", want: "admin"},
+		{name: "missing path", expr: ".refresh_token", wantErr: "capture VALUE: .refresh_token is missing from the response"},
+		{name: "null", expr: ".expires", wantErr: "is missing from the response"},
+		{name: "jq error", expr: ".access_token.id", wantErr: "capture VALUE: jq: error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := evalCaptures(body, []capture{{name: "VALUE", expr: tt.expr}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("evalCaptures() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evalCaptures() error = %v", err)
+			}
+			if values["VALUE"] != tt.want {
+				t.Errorf("evalCaptures() = %q, want %q", values["VALUE"], tt.want)
+			}
+		})
+	}
+
+	if _, err := evalCaptures("<html>", []capture{{name: "TOKEN", expr: ".a"}}); err == nil || !strings.Contains(err.Error(), "response isn't JSON") {
+		t.Errorf("evalCaptures() on HTML error = %v, want one saying it isn't JSON", err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	if session, err := loadSession(dir); err != nil || session != nil {
+		t.Fatalf("loadSession() without a session = %v, %v, want nothing", session, err)
+	}
+
+	tricky := "a \"quoted\" $(rm -rf) `x` \\ value\nwith\ttabs"
+	if _, err := saveSession(dir, run.Environment{"TOKEN": "old", "USER_ID": "42"}); err != nil {
+		t.Fatalf("saveSession() error = %v", err)
+	}
+	path, err := saveSession(dir, run.Environment{"TOKEN": tricky})
+	if err != nil {
+		t.Fatalf("saveSession() error = %v", err)
+	}
+	if path != filepath.Join(dir, sessionFile) {
+		t.Errorf("saveSession() path = %q", path)
+	}
+	session, err := loadSession(dir)
+	if err != nil {
+		t.Fatalf("loadSession() error = %v", err)
+	}
+	if want := (run.Environment{"TOKEN": tricky, "USER_ID": "42"}); !reflect.DeepEqual(session, want) {
+		t.Errorf("loadSession() = %q, want %q", session, want)
+	}
+
+	// Session values end up literal in the file, whatever they hold
+	file := filepath.Join(dir, "GET_me.curl")
+	if err := os.WriteFile(file, []byte("TOKEN=\"VALUE\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmdText, err := runFile(file, dir, runOptions{})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	out, err := exec.Command("sh", "-c", strings.Replace(cmdText, "curl -s", "printf '%s'", 1)).Output()
+	if err != nil {
+		t.Fatalf("running %q: %v", cmdText, err)
+	}
+	if want := "Authorization: Bearer " + tricky; !strings.Contains(string(out), want) {
+		t.Errorf("command printed %q, want it to contain %q", out, want)
+	}
+}
+
+func TestOfferSession(t *testing.T) {
+	dir := t.TempDir()
+	values := run.Environment{"TOKEN": "abc", "ID": "7"}
+
+	var out bytes.Buffer
+	if err := offerSession(strings.NewReader("n\n"), &out, dir, values, true); err != nil {
+		t.Fatalf("offerSession() error = %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Captured:\n  ID=7\n  TOKEN=abc\nSave to ") {
+		t.Errorf("offerSession() printed %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, sessionFile)); err == nil {
+		t.Error("offerSession() saved the session without a yes")
+	}
+
+	out.Reset()
+	if err := offerSession(strings.NewReader("y\n"), &out, dir, values, true); err != nil {
+		t.Fatalf("offerSession() error = %v", err)
+	}
+	if session, _ := loadSession(dir); !reflect.DeepEqual(session, values) {
+		t.Errorf("session after yes = %v, want %v", session, values)
+	}
+}
+
+func TestRunChain(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	if _, err := exec.LookPath("jq"); err != nil {
+		t.Skip("jq not installed")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Write([]byte(`{"access_token":"t0k3n","user":{"id":7}}`))
+		case "/users/7":
+			if r.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id":7}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"POST_login.curl": "# capture: TOKEN = .access_token\n# capture: USER_ID = .user.id\nBASE_URL=\"" + server.URL + "\"\ncurl -s -X POST \"${BASE_URL}/login\"\n",
+		"users/GET_user.curl": "# expect-status: 200\n# capture: NAME = .name\nBASE_URL=\"" + server.URL + "\"\nTOKEN=\"VALUE\"\nUSER_ID=\"VALUE\"\n" +
+			"curl -s -H \"Authorization: Bearer ${TOKEN}\" \"${BASE_URL}/users/${USER_ID}\"\n",
+		"chain.yml": "files:\n  - POST_login.curl\n  - users/GET_user.curl\n",
+	})
+
+	steps, err := loadChain(filepath.Join(dir, "chain.yml"))
+	if err != nil {
+		t.Fatalf("loadChain() error = %v", err)
+	}
+	var log bytes.Buffer
+	err = runChain(&log, dir, steps, runOptions{}, execOptions{quiet: true}, false)
+	// The user was fetched with the captured token, then NAME is missing
+	want := "chain stopped at users/GET_user.curl: command execution failed: capture NAME: .name is missing from the response"
+	if err == nil || err.Error() != want {
+		t.Errorf("runChain() error = %v, want %q", err, want)
+	}
+	if wantLog := "[1/2] POST_login.curl\nCaptured TOKEN, USER_ID\n[2/2] users/GET_user.curl\n"; log.String() != wantLog {
+		t.Errorf("runChain() logged %q, want %q", log.String(), wantLog)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "chain.yml"), []byte("files:\n  - missing.curl\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadChain(filepath.Join(dir, "chain.yml")); err == nil || !strings.Contains(err.Error(), "missing.curl") {
+		t.Errorf("loadChain() with a missing file error = %v, want one naming it", err)
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/internal/output"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// chainStep is a .curl file of a chain
+type chainStep struct {
+	// name is the path of the file as the suite.yml lists it
+	name     string
+	path     string
+	expect   expectations
+	captures []capture
+}
+
+func NewRunCmd() *cobra.Command {
+	var opts runOptions
+	var vars []string
+	var yes bool
+	var raw bool
+	var logFile string
+	var specFile string
+
+	cmd := &cobra.Command{
+		Use:          "run <suite.yml>",
+		Short:        "Run the .curl files a suite.yml lists in order, passing captured values on to the next ones",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			overrides, err := run.ParseVarOverrides(vars)
+			if err != nil {
+				return err
+			}
+			opts.overrides = overrides
+
+			steps, err := loadChain(args[0])
+			if err != nil {
+				return err
+			}
+			if specFile != "" {
+				if opts.spec, err = newSpecValidator(specFile); err != nil {
+					return err
+				}
+			}
+			opts.audit = openAuditLog(logFile, auditDetailIteration)
+			defer opts.audit.Close()
+			pretty := !raw && isTerminal(os.Stdout)
+			eo := execOptions{verbose: opts.verbose, pretty: pretty, color: pretty && output.Supported()}
+			return runChain(os.Stderr, filepath.Dir(args[0]), steps, opts, eo, !yes && isTerminal(os.Stdin))
+		},
+	}
+
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Environment name to use from envs.yml, repeatable to layer environments, later ones overriding earlier ones")
+	cmd.Flags().BoolVar(&opts.noAuthCache, "no-auth-cache", false, "Fetch a new token for the environment's auth block instead of using the cached one")
+	cmd.Flags().StringVar(&opts.envFile, "env-file", "", "Read variables from this .env file instead of the collection's .env")
+	cmd.Flags().StringVar(&opts.envsFile, "envs-file", "", "Read the environments from this file instead of the envs.yml nearest to each file run")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Override a variable assigned in the files, as KEY=VALUE; takes precedence over envs.yml and captures (repeatable)")
+	cmd.Flags().BoolVarP(&opts.insecure, "insecure", "k", false, "Skip SSL certificate verification (adds -k to ALL curls in the files)")
+	cmd.Flags().StringVar(&opts.session, "session", "", "Keep cookies across the files and runs in the cookie jar of this named session")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run DELETE requests without asking for confirmation")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print responses as they came back instead of pretty-printing JSON in a terminal")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Append a JSON line per request, with the file, environment, redacted URL, status and result, to this audit log (default: $CURLY_LOG_FILE)")
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Show progress and detailed output")
+	cmd.Flags().StringVar(&specFile, "validate-spec", "", "Stop the chain at a response with a status or JSON body the operation of this OpenAPI YAML/JSON doesn't declare")
+
+	cmd.ValidArgsFunction = completeSuiteFile
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(-1))
+
+	return cmd
+}
+
+// loadChain reads the suite.yml at path and the expectations and captures of
+// the files it lists, relative to its directory, so a broken file stops the
+// chain before any request is sent
+func loadChain(path string) ([]chainStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+	var suite suiteFile
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(suite.Files) == 0 {
+		return nil, fmt.Errorf("%s lists no files", path)
+	}
+
+	var steps []chainStep
+	for _, name := range suite.Files {
+		step := chainStep{name: name, path: filepath.Join(filepath.Dir(path), filepath.FromSlash(name))}
+		if step.expect, err = fileExpectations(step.path); err != nil {
+			return nil, err
+		}
+		if err := step.expect.checkJQ(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if step.captures, err = fileCaptures(step.path); err != nil {
+			return nil, err
+		}
+		if err := checkCaptures(step.captures); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// runChain runs steps one after the other, the values captured from the
+// responses of each substituted into the ones after it like environment
+// variables, and stops at the first step that fails or misses a capture.
+// Progress goes to log. With confirm, DELETE requests are confirmed as their
+// step comes up, once the captured values are in
+func runChain(log io.Writer, dir string, steps []chainStep, opts runOptions, eo execOptions, confirm bool) error {
+	captured := run.Environment{}
+	for i, step := range steps {
+		fmt.Fprintf(log, "[%d/%d] %s\n", i+1, len(steps), step.name)
+
+		opts.captured = captured
+		cmdText, err := runFile(step.path, dir, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+		if err := checkVariables(cmdText); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", step.name, err)
+		}
+		if confirm {
+			if err := confirmRun(os.Stdin, log, cmdText, opts.envName, 1, false); err != nil {
+				return err
+			}
+		}
+
+		stepOptions := eo
+		stepOptions.times, stepOptions.parallel = 1, 1
+		stepOptions.expect, stepOptions.captures = step.expect, step.captures
+		stepOptions.spec = opts.spec
+		stepOptions.audit = opts.audit.request(cmdText, step.path, opts.envName)
+		stats, err := execCmd(cmdText, stepOptions)
+		stepOptions.audit.logRun(stats, err)
+		if err != nil {
+			return fmt.Errorf("chain stopped at %s: %w", step.name, err)
+		}
+		if len(stats.Captured) > 0 {
+			for k, v := range stats.Captured {
+				captured[k] = v
+			}
+			fmt.Fprintf(log, "Captured %s\n", strings.Join(sortedKeys(stats.Captured), ", "))
+		}
+	}
+	return nil
+}
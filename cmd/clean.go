@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// strayTempSuffix ends the copies older versions of curly edited next to the
+// .curl files, left behind when curly crashed
+const strayTempSuffix = ".curl.tmp"
+
+func NewCleanCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "clean [collection-dir]",
+		Short:             "Remove the .curl.tmp copies interrupted edits left in a collection",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			return cleanCollection(cmd.OutOrStdout(), dir)
+		},
+	}
+}
+
+// cleanCollection removes the stray .curl.tmp files under dir, printing each
+func cleanCollection(out io.Writer, dir string) error {
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), strayTempSuffix) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		fmt.Fprintf(out, "Removed %s\n", path)
+		removed++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		fmt.Fprintln(out, "Nothing to clean")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanCollection(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"GET_users.curl":            "curl x",
+		"GET_users.curl.tmp":        "curl x",
+		"users/POST_users.curl.tmp": "curl x",
+		"notes.tmp":                 "keep",
+	})
+
+	var out bytes.Buffer
+	if err := cleanCollection(&out, dir); err != nil {
+		t.Fatalf("cleanCollection() error = %v", err)
+	}
+	for _, name := range []string{"GET_users.curl.tmp", "users/POST_users.curl.tmp"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed", name)
+		}
+		if !strings.Contains(out.String(), filepath.Join(dir, filepath.FromSlash(name))) {
+			t.Errorf("cleanCollection() printed %q, want %s", out.String(), name)
+		}
+	}
+	for _, name := range []string{"GET_users.curl", "notes.tmp"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+
+	out.Reset()
+	if err := cleanCollection(&out, dir); err != nil || out.String() != "Nothing to clean\n" {
+		t.Errorf("cleanCollection() on a clean collection = %q, %v", out.String(), err)
+	}
+}
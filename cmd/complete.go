@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// The completions below run on every Tab, so they only read what they list:
+// the names under the environments of envs.yml and the comments of the .curl
+// files, and list nothing rather than fail when those are missing
+
+// completionDir returns the collection directory of the command completed,
+// its argument at n, or else the global config's collection or the current
+// directory
+func completionDir(args []string, n int) string {
+	if n >= 0 && len(args) > n {
+		return args[n]
+	}
+	if global, err := loadConfig(globalConfigPath()); err == nil && global.collection() != "" {
+		return global.collection()
+	}
+	return "."
+}
+
+// completeDirAt completes directories for the argument at n, the collection
+// directory, and nothing for the others
+func completeDirAt(n int) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == n {
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeCurlFiles completes the .curl files of the collection whose
+// directory is the argument at dirArg
+func completeCurlFiles(dirArg int) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var files []string
+		run.WalkCurlFiles(completionDir(args, dirArg), func(path string) error {
+			if strings.HasPrefix(path, toComplete) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		return files, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeEnvironments completes the environments of the envs.yml the
+// command reads: that of --envs-file, or the one nearest to --file in the
+// collection whose directory is the argument at dirArg
+func completeEnvironments(dirArg int) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var pinned, file string
+		if f := cmd.Flag("envs-file"); f != nil {
+			pinned = f.Value.String()
+		}
+		if f := cmd.Flag("file"); f != nil {
+			file = f.Value.String()
+		}
+		path := run.FindEnvsFile(completionDir(args, dirArg), file, pinned)
+		var names []string
+		for _, name := range environmentNames(path) {
+			if strings.HasPrefix(name, toComplete) {
+				names = append(names, name)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// environmentNames returns the names of the environments of the envs.yml at
+// path, sorted, without decrypting or merging anything
+func environmentNames(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var doc struct {
+		Environments map[string]yaml.Node `yaml:"environments"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(doc.Environments))
+	for name := range doc.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeTags completes the tags of the "# tags:" comments of the .curl
+// files of the collection whose directory is the argument at dirArg
+func completeTags(dirArg int) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		seen := map[string]bool{}
+		var tags []string
+		run.WalkCurlFiles(completionDir(args, dirArg), func(path string) error {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			_, fileTags := suiteDirectives(string(content))
+			for _, tag := range fileTags {
+				if !seen[tag] && strings.HasPrefix(tag, toComplete) {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+			return nil
+		})
+		sort.Strings(tags)
+		return tags, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeSuiteFile completes the suite.yml files run takes
+func completeSuiteFile(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return []string{"yml", "yaml"}, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// completeEnvsArgs completes the environments named by the first envArgs
+// arguments of curly envs show and diff, then the collection directory
+func completeEnvsArgs(envArgs int) cobra.CompletionFunc {
+	envs := completeEnvironments(envArgs)
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) < envArgs {
+			return envs(cmd, args, toComplete)
+		}
+		return completeDirAt(envArgs)(cmd, args, toComplete)
+	}
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CURLY_CONFIG", "")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"envs.yml":               "defaults:\n  BASE_URL: \"http://localhost\"\nenvironments:\n  dev: {}\n  staging: {}\n  prod: {}\n",
+		"users/GET_users.curl":   "# tags: smoke, users\ncurl -s \"${BASE_URL}/users\"",
+		"users/POST_users.curl":  "# tags: users\ncurl -s -X POST \"${BASE_URL}/users\"",
+		"orders/GET_orders.curl": "curl -s \"${BASE_URL}/orders\"",
+	})
+	empty := t.TempDir()
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "files", args: []string{dir, "-f", ""}, want: []string{
+			filepath.Join(dir, "orders", "GET_orders.curl"),
+			filepath.Join(dir, "users", "GET_users.curl"),
+			filepath.Join(dir, "users", "POST_users.curl"),
+		}},
+		{name: "files by prefix", args: []string{dir, "-f", filepath.Join(dir, "users", "P")}, want: []string{filepath.Join(dir, "users", "POST_users.curl")}},
+		{name: "environments", args: []string{dir, "-e", ""}, want: []string{"dev", "prod", "staging"}},
+		{name: "environments by prefix", args: []string{dir, "-e", "st"}, want: []string{"staging"}},
+		{name: "no envs.yml", args: []string{empty, "-e", ""}, want: nil},
+		{name: "tags of test", args: []string{"test", dir, "--tag", ""}, want: []string{"smoke", "users"}},
+		{name: "environments of test", args: []string{"test", dir, "--env", "d"}, want: []string{"dev"}},
+		{name: "environments of envs show", args: []string{"envs", "show", "--envs-file", filepath.Join(dir, "envs.yml"), "p"}, want: []string{"prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.AddCommand(NewTestCmd(), NewEnvsCmd())
+			cmd.SetArgs(append([]string{"__complete"}, tt.args...))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if !strings.HasPrefix(line, ":") {
+					got = append(got, line)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// collectionConfigFile holds the defaults of a collection, in its directory
+const collectionConfigFile = ".curly.yml"
+
+// collectionKey is the key of the config naming the collection directory
+// curly runs from when none is passed
+const collectionKey = "collection"
+
+// configSetting is a key of a config file with its values, several for
+// flags that take a list, and the line it is on for warnings
+type configSetting struct {
+	key    string
+	values []string
+	line   int
+}
+
+// curlyConfig is a config file setting defaults for curly's flags, its keys
+// being the names of the flags, like env, editor or parallel
+type curlyConfig struct {
+	path     string
+	settings []configSetting
+}
+
+// globalConfigPath returns the path of the global config: $CURLY_CONFIG, or
+// curly/config.yml in $XDG_CONFIG_HOME, ~/.config by default
+func globalConfigPath() string {
+	if path := os.Getenv("CURLY_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "curly", "config.yml")
+}
+
+// loadConfig reads the config at path, nil when there is none
+func loadConfig(path string) (*curlyConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	config := &curlyConfig{path: path}
+	if len(doc.Content) == 0 {
+		return config, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: want a map of flag names to values", path, root.Line)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		setting := configSetting{key: key.Value, line: key.Line}
+		switch value.Kind {
+		case yaml.ScalarNode:
+			setting.values = []string{value.Value}
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%s:%d: %s: want a list of values", path, item.Line, key.Value)
+				}
+				setting.values = append(setting.values, item.Value)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: %s: want a value or a list of values", path, value.Line, key.Value)
+		}
+		config.settings = append(config.settings, setting)
+	}
+	return config, nil
+}
+
+// collection returns the collection directory the config names, if any, a
+// leading ~ standing for the home directory
+func (c *curlyConfig) collection() string {
+	if c == nil {
+		return ""
+	}
+	for _, s := range c.settings {
+		if s.key == collectionKey && len(s.values) > 0 {
+			dir := s.values[len(s.values)-1]
+			if home, err := os.UserHomeDir(); err == nil && (dir == "~" || strings.HasPrefix(dir, "~/")) {
+				dir = filepath.Join(home, dir[1:])
+			}
+			return dir
+		}
+	}
+	return ""
+}
+
+// apply sets the flags of cmd the config has values for and that weren't
+// set already, on the command line or by a config applied before. Keys no
+// command of curly has a flag for are warned about, with the file and line,
+// and values the flag rejects are an error
+func (c *curlyConfig) apply(cmd *cobra.Command) error {
+	if c == nil {
+		return nil
+	}
+	for _, s := range c.settings {
+		if s.key == collectionKey {
+			continue
+		}
+		flag := cmd.Flags().Lookup(s.key)
+		if flag == nil {
+			if !anyCommandHasFlag(cmd.Root(), s.key) {
+				fmt.Fprintf(os.Stderr, "Warning: %s:%d: unknown key %s\n", c.path, s.line, s.key)
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		for _, value := range s.values {
+			if err := cmd.Flags().Set(s.key, value); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", c.path, s.line, s.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// anyCommandHasFlag reports whether cmd or one of its subcommands has the
+// flag name
+func anyCommandHasFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if anyCommandHasFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConfigs sets the flags of cmd from the config of the collection in
+// dir, then from the global config, so flags passed win over the collection's
+// config, which wins over the global one
+func applyConfigs(cmd *cobra.Command, dir string, global *curlyConfig) error {
+	local, err := loadConfig(filepath.Join(dir, collectionConfigFile))
+	if err != nil {
+		return err
+	}
+	if err := local.apply(cmd); err != nil {
+		return err
+	}
+	return global.apply(cmd)
+}
+
+// configDir returns the directory whose .curly.yml applies to cmd run with
+// args: the collection directory or the directory of the file passed first,
+// or else the current directory
+func configDir(args []string) string {
+	if len(args) == 0 {
+		return "."
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return "."
+	}
+	if info.IsDir() {
+		return args[0]
+	}
+	return filepath.Dir(args[0])
+}
+
+// envKey is the key of the config, and of the comment of a .curl file, naming
+// the environment it runs against when -e isn't passed
+const envKey = "env"
+
+// env returns the environment the config names, if any, layered like -e
+func (c *curlyConfig) env() string {
+	if c == nil {
+		return ""
+	}
+	for _, s := range c.settings {
+		if s.key == envKey {
+			return strings.Join(s.values, ",")
+		}
+	}
+	return ""
+}
+
+// warnedConfigs holds the paths of the subdirectory configs whose keys were
+// warned about, once per run rather than once per file under them
+var warnedConfigs sync.Map
+
+// warnSubdirectoryKeys warns about the keys of the config of a subdirectory
+// of the collection other than env, the only one it sets, with the file and
+// line like apply does for the collection's config
+func (c *curlyConfig) warnSubdirectoryKeys() {
+	if c == nil {
+		return
+	}
+	if _, warned := warnedConfigs.LoadOrStore(c.path, true); warned {
+		return
+	}
+	for _, s := range c.settings {
+		if s.key != envKey {
+			fmt.Fprintf(os.Stderr, "Warning: %s:%d: unknown key %s, a subdirectory's %s only sets %s\n", c.path, s.line, s.key, collectionConfigFile, envKey)
+		}
+	}
+}
+
+// parseEnvComment returns the environment the "# env: name" comment of a
+// .curl file names, if it has one
+func parseEnvComment(content string) (string, error) {
+	lines := strings.Split(content, "\n")
+	inBody := run.HeredocBodies(lines)
+	for n, line := range lines {
+		if inBody[n] {
+			continue
+		}
+		comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(comment), ":")
+		if !ok || key != envKey {
+			continue
+		}
+		var env string
+		if err := newEnvFlag(&env).Set(strings.TrimSpace(value)); err != nil {
+			return "", fmt.Errorf("line %d: %w", n+1, err)
+		}
+		return env, nil
+	}
+	return "", nil
+}
+
+// fileEnvironment returns the environment the .curl file at path, in the
+// collection dir, runs against when -e isn't passed, and what names it: the
+// file's "# env:" comment, or else the env of the nearest .curly.yml from the
+// file's directory up to dir. It is "" when none of them names one. Other
+// keys of the .curly.yml files of subdirectories are warned about
+func fileEnvironment(dir, path string) (env, source string, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	env, err = parseEnvComment(string(content))
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", path, err)
+	}
+	if env != "" {
+		return env, "the # env: comment of " + path, nil
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	current, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		rel, err := filepath.Rel(root, current)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", "", nil
+		}
+		config, err := loadConfig(filepath.Join(current, collectionConfigFile))
+		if err != nil {
+			return "", "", err
+		}
+		if rel != "." {
+			config.warnSubdirectoryKeys()
+		}
+		if env := config.env(); env != "" {
+			return env, filepath.Join(dir, rel, collectionConfigFile), nil
+		}
+		if rel == "." {
+			return "", "", nil
+		}
+		current = filepath.Dir(current)
+	}
+}
+
+// withFileEnvironment returns opts with the environment the file at path, in
+// the collection dir, runs against: the one passed with -e when envPassed,
+// or else the one fileEnvironment finds, or else the one of the global config
+func withFileEnvironment(opts runOptions, envPassed bool, dir, path string) (runOptions, error) {
+	if envPassed {
+		opts.envSource = "-e"
+		return opts, nil
+	}
+	env, source, err := fileEnvironment(dir, path)
+	if err != nil {
+		return opts, err
+	}
+	switch {
+	case env != "":
+		opts.envName, opts.envSource = env, source
+	case opts.envName != "":
+		opts.envSource = globalConfigPath()
+	}
+	return opts, nil
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"envs.yml":       "environments:\n  dev:\n    BASE_URL: \"http://dev.local\"\n  staging:\n    BASE_URL: \"http://staging.local\"\n  prod:\n    BASE_URL: \"http://prod.local\"\n",
+		"GET_users.curl": "BASE_URL=\"http://localhost\"\ncurl -s \"${BASE_URL}/users\"",
+	})
+	configs := t.TempDir()
+	global := filepath.Join(configs, "config.yml")
+	writeFiles(t, configs, map[string]string{
+		"config.yml":     "env: dev\nno-history: true\n",
+		"collection.yml": "collection: " + root + "\nenv: dev\n",
+	})
+
+	tests := []struct {
+		name   string
+		global string
+		local  string
+		args   []string
+		want   string
+	}{
+		{name: "built-in defaults", args: []string{root}, want: "http://localhost/users"},
+		{name: "global config", global: global, args: []string{root}, want: "http://dev.local/users"},
+		{name: "collection config over global", global: global, local: "env: staging\n", args: []string{root}, want: "http://staging.local/users"},
+		{name: "flag over collection config", global: global, local: "env: staging\n", args: []string{root, "-e", "prod"}, want: "http://prod.local/users"},
+		{name: "collection directory of the global config", global: filepath.Join(configs, "collection.yml"), want: "http://dev.local/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CURLY_CONFIG", tt.global)
+			os.Remove(filepath.Join(root, collectionConfigFile))
+			if tt.local != "" {
+				writeFiles(t, root, map[string]string{collectionConfigFile: tt.local})
+			}
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.SetArgs(append(tt.args, "--select", "users", "--no-edit", "--dry-run"))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output:\n%s\nwant it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	writeFiles(t, dir, map[string]string{
+		"config.yml": "var:\n  - A=1\n  - B=2\ntimeout: 30s\nparallel: lots\n",
+	})
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	var vars []string
+	var parallel int
+	cmd := &cobra.Command{Use: "curly"}
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	applyErr := config.apply(cmd)
+	os.Stderr = stderr
+	w.Close()
+	warnings, _ := io.ReadAll(r)
+
+	if want := []string{"A=1", "B=2"}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("var = %v, want %v", vars, want)
+	}
+	if want := path + ":4: unknown key timeout"; !strings.Contains(string(warnings), want) {
+		t.Errorf("warnings:\n%s\nwant them to contain %q", warnings, want)
+	}
+	if applyErr == nil || !strings.HasPrefix(applyErr.Error(), path+":5: parallel:") {
+		t.Errorf("apply() error = %v, want one for parallel on line 5", applyErr)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	config, err := loadConfig(filepath.Join(t.TempDir(), "config.yml"))
+	if err != nil || config != nil {
+		t.Errorf("loadConfig() = %v, %v, want nil, nil", config, err)
+	}
+}
+
+func TestFileEnvironment(t *testing.T) {
+	t.Setenv("CURLY_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"GET_health.curl":                   "curl -s \"${BASE_URL}/health\"",
+		"billing/.curly.yml":                "env: billing-dev\n",
+		"billing/GET_invoices.curl":         "curl -s \"${BASE_URL}/invoices\"",
+		"billing/refunds/GET_refunds.curl":  "curl -s \"${BASE_URL}/refunds\"",
+		"identity/.curly.yml":               "env: [dev, identity-dev]\n",
+		"identity/GET_users.curl":           "# env: identity-dev\ncurl -s \"${BASE_URL}/users\"",
+		"identity/GET_groups.curl":          "curl -s \"${BASE_URL}/groups\"",
+		"identity/GET_invalid.curl":         "# env: dev,,identity-dev\ncurl -s \"${BASE_URL}/users\"",
+		"identity/POST_heredoc_users.curl":  "curl -s -d @- \"${BASE_URL}/users\" <<EOF\n# env: prod\nEOF",
+		"identity/legacy/GET_accounts.curl": "curl -s \"${BASE_URL}/accounts\"",
+	})
+
+	tests := []struct {
+		name       string
+		file       string
+		env        string
+		envPassed  bool
+		wantEnv    string
+		wantSource string
+		wantErr    string
+	}{
+		{name: "none", file: "GET_health.curl"},
+		{name: "global config", file: "GET_health.curl", env: "dev", wantEnv: "dev", wantSource: os.Getenv("CURLY_CONFIG")},
+		{name: "directory config", file: "billing/GET_invoices.curl", wantEnv: "billing-dev", wantSource: filepath.Join(root, "billing", collectionConfigFile)},
+		{name: "directory config over the global one", file: "billing/GET_invoices.curl", env: "dev", wantEnv: "billing-dev", wantSource: filepath.Join(root, "billing", collectionConfigFile)},
+		{name: "config of a parent directory", file: "billing/refunds/GET_refunds.curl", wantEnv: "billing-dev", wantSource: filepath.Join(root, "billing", collectionConfigFile)},
+		{name: "layered directory config", file: "identity/legacy/GET_accounts.curl", wantEnv: "dev,identity-dev", wantSource: filepath.Join(root, "identity", collectionConfigFile)},
+		{name: "file comment over directory config", file: "identity/GET_users.curl", wantEnv: "identity-dev", wantSource: "the # env: comment of " + filepath.Join(root, "identity", "GET_users.curl")},
+		{name: "not a comment in a heredoc", file: "identity/POST_heredoc_users.curl", wantEnv: "dev,identity-dev", wantSource: filepath.Join(root, "identity", collectionConfigFile)},
+		{name: "flag over file comment", file: "identity/GET_users.curl", env: "prod", envPassed: true, wantEnv: "prod", wantSource: "-e"},
+		{name: "invalid file comment", file: "identity/GET_invalid.curl", wantErr: `GET_invalid.curl: line 1: empty environment name in "dev,,identity-dev"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := withFileEnvironment(runOptions{envName: tt.env}, tt.envPassed, root, filepath.Join(root, filepath.FromSlash(tt.file)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("withFileEnvironment() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("withFileEnvironment() error = %v", err)
+			}
+			if opts.envName != tt.wantEnv || opts.envSource != tt.wantSource {
+				t.Errorf("withFileEnvironment() = %q set by %q, want %q set by %q", opts.envName, opts.envSource, tt.wantEnv, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestFileEnvironmentWarnsSubdirectoryKeys(t *testing.T) {
+	t.Setenv("CURLY_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		collectionConfigFile:        "env: dev\ncolor: never\n",
+		"billing/.curly.yml":        "env: billing-dev\ntimout: 5\nparallel: 2\n",
+		"billing/GET_invoices.curl": "curl -s \"${BASE_URL}/invoices\"",
+		"billing/GET_refunds.curl":  "curl -s \"${BASE_URL}/refunds\"",
+	})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	for _, file := range []string{"GET_invoices.curl", "GET_refunds.curl"} {
+		if _, err := withFileEnvironment(runOptions{}, false, root, filepath.Join(root, "billing", file)); err != nil {
+			t.Errorf("withFileEnvironment(%s) error = %v", file, err)
+		}
+	}
+	os.Stderr = stderr
+	w.Close()
+	warnings, _ := io.ReadAll(r)
+
+	path := filepath.Join(root, "billing", collectionConfigFile)
+	want := "Warning: " + path + ":2: unknown key timout, a subdirectory's .curly.yml only sets env\n" +
+		"Warning: " + path + ":3: unknown key parallel, a subdirectory's .curly.yml only sets env\n"
+	if string(warnings) != want {
+		t.Errorf("warnings:\n%s\nwant, once for both files and none for the collection's config:\n%s", warnings, want)
+	}
+}
+
+func TestFileEnvironmentRuns(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CURLY_CONFIG", "")
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"envs.yml":                  "environments:\n  dev:\n    BASE_URL: \"http://dev.local\"\n  billing-dev:\n    BASE_URL: \"http://billing.dev.local\"\n  identity-dev:\n    BASE_URL: \"http://identity.dev.local\"\n",
+		collectionConfigFile:        "env: dev\n",
+		"billing/.curly.yml":        "env: billing-dev\n",
+		"billing/GET_invoices.curl": "BASE_URL=\"http://localhost\"\ncurl -s \"${BASE_URL}/invoices\"",
+		"identity/GET_users.curl":   "# env: identity-dev\nBASE_URL=\"http://localhost\"\ncurl -s \"${BASE_URL}/users\"",
+		"GET_health.curl":           "BASE_URL=\"http://localhost\"\ncurl -s \"${BASE_URL}/health\"",
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "collection config", args: []string{"--select", "health"}, want: "http://dev.local/health"},
+		{name: "directory config over the collection's", args: []string{"--select", "invoices"}, want: "http://billing.dev.local/invoices"},
+		{name: "file comment", args: []string{"--select", "users"}, want: "http://identity.dev.local/users"},
+		{name: "flag", args: []string{"--select", "invoices", "-e", "dev"}, want: "http://dev.local/invoices"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.SetArgs(append([]string{root, "--no-edit", "--dry-run"}, tt.args...))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output:\n%s\nwant it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
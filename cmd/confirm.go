@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// curlRequest is the method and target URL of a curl command
+type curlRequest struct {
+	method string
+	url    string
+	// sendsData is set by the options making curl POST without -X, like -d
+	// and -F, and upload is set by -T, which makes it PUT
+	sendsData bool
+	upload    bool
+}
+
+// effectiveMethod returns the method curl sends for r: the one of -X, or the
+// one the data options imply, GET without any
+func (r curlRequest) effectiveMethod() string {
+	switch {
+	case r.method != "":
+		return strings.ToUpper(r.method)
+	case r.upload:
+		return "PUT"
+	case r.sendsData:
+		return "POST"
+	}
+	return "GET"
+}
+
+// destructiveRequests returns the curl commands in cmdText that send a
+// DELETE, or a PUT or PATCH with writes, reading the method from their -X
+// argument with the file's variables expanded
+func destructiveRequests(cmdText string, writes bool) []curlRequest {
+	confirm := map[string]bool{"DELETE": true}
+	if writes {
+		confirm["PUT"], confirm["PATCH"] = true, true
+	}
+
+	var requests []curlRequest
+	for _, req := range curlRequests(cmdText) {
+		if confirm[strings.ToUpper(req.method)] {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// curlRequests returns the requests of the curl commands in cmdText, with
+// the file's variables expanded
+func curlRequests(cmdText string) []curlRequest {
+	expanded, _ := expandCommandText(cmdText, resolveFileVariables(cmdText))
+	lines := strings.Split(expanded, "\n")
+
+	var requests []curlRequest
+	for _, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		requests = append(requests, parseCurlRequest(splitShellWords(text.String())))
+	}
+	return requests
+}
+
+// firstRequest returns the method and URL of the first curl command in
+// cmdText, with the file's variables expanded
+func firstRequest(cmdText string) curlRequest {
+	if req, err := parseNativeRequest(cmdText); err == nil {
+		return curlRequest{method: req.method, url: req.url}
+	}
+	var req curlRequest
+	expanded, _ := expandCommandText(cmdText, resolveFileVariables(cmdText))
+	lines := strings.Split(expanded, "\n")
+	if commands := run.FindCurlCommands(lines); len(commands) > 0 {
+		var text strings.Builder
+		for _, line := range lines[commands[0].Start : commands[0].End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		req = parseCurlRequest(splitShellWords(text.String()))
+		req.method = strings.ToUpper(req.method)
+	}
+	if req.method == "" {
+		req.method = "GET"
+	}
+	return req
+}
+
+// parseCurlRequest reads the method and URL from the words of a curl command
+func parseCurlRequest(words []string) curlRequest {
+	var req curlRequest
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case (word == "-X" || word == "--request" || word == "--url") && i+1 < len(words):
+			if word == "--url" {
+				req.url = words[i+1]
+			} else {
+				req.method = words[i+1]
+			}
+			i++
+		case strings.HasPrefix(word, "--request="):
+			req.method = strings.TrimPrefix(word, "--request=")
+		case strings.HasPrefix(word, "-X") && len(word) > 2:
+			req.method = word[2:]
+		case word == "-T" || word == "--upload-file" || strings.HasPrefix(word, "--upload-file="):
+			req.upload = true
+		case word == "-d" || word == "-F" || word == "--form" || word == "--json" ||
+			strings.HasPrefix(word, "--data") || strings.HasPrefix(word, "--form") || strings.HasPrefix(word, "--json=") ||
+			(len(word) > 2 && (strings.HasPrefix(word, "-d") || strings.HasPrefix(word, "-F"))):
+			req.sendsData = true
+		case req.url == "" && strings.Contains(word, "://"):
+			req.url = word
+		case word == "|" || word == ";" || word == "&&" || word == "||" || word == "<<":
+			return req
+		}
+	}
+	return req
+}
+
+// splitShellWords splits s into words the way the shell would, honouring
+// quotes and backslash escapes, without expanding anything
+func splitShellWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(s) && strings.IndexByte(`"\$`+"`", s[i+1]) >= 0 {
+				i++
+				word.WriteByte(s[i])
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// confirmRun lists the destructive requests in cmdText on out and reads a y
+// from in before letting them go out. times is how often the whole file will
+// run, confirmed once for the batch
+func confirmRun(in io.Reader, out io.Writer, cmdText, envName string, times int, writes bool) error {
+	requests := destructiveRequests(cmdText, writes)
+	if len(requests) == 0 {
+		return nil
+	}
+
+	if envName == "" {
+		envName = "none"
+	}
+	fmt.Fprintf(out, "About to send (environment: %s):\n", envName)
+	for _, req := range requests {
+		fmt.Fprintf(out, "  %s %s\n", strings.ToUpper(req.method), req.url)
+	}
+	if times > 1 {
+		fmt.Fprintf(out, "Run %d times? [y/N] ", times)
+	} else {
+		fmt.Fprint(out, "Continue? [y/N] ")
+	}
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted, nothing was sent")
+}
+
+// isTerminal reports whether f is a terminal, like stdin when someone could
+// answer a prompt on it. Character devices that aren't, like /dev/null under
+// cron, CI or nohup, are not
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDestructiveRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdText string
+		writes  bool
+		want    []curlRequest
+	}{
+		{
+			name: "DELETE with its URL expanded",
+			cmdText: `BASE_URL="https://prod.example.com"
+ID="42"
+
+curl -s -X DELETE "${BASE_URL}/users/${ID}" \
+  -H "Accept: application/json"`,
+			want: []curlRequest{{method: "DELETE", url: "https://prod.example.com/users/42"}},
+		},
+		{
+			name: "GET and POST need no confirmation",
+			cmdText: `curl -s -X GET "https://example.com/users"
+curl -s -X POST "https://example.com/users" --data '{"method": "-X DELETE"}'`,
+		},
+		{
+			name:    "PUT only with writes",
+			cmdText: `curl -s -X PUT "https://example.com/users/1"`,
+		},
+		{
+			name: "PUT and PATCH with writes, in any spelling",
+			cmdText: `curl -s --request put --url "https://example.com/users/1"
+curl -s -XPATCH https://example.com/users/2
+curl -s --request=DELETE https://example.com/users/3`,
+			writes: true,
+			want: []curlRequest{
+				{method: "put", url: "https://example.com/users/1"},
+				{method: "PATCH", url: "https://example.com/users/2"},
+				{method: "DELETE", url: "https://example.com/users/3"},
+			},
+		},
+		{
+			name: "comments and heredoc bodies are not commands",
+			cmdText: `# curl -X DELETE https://example.com/users
+curl -s -X POST https://example.com/notes --data-binary @- << 'EOF'
+curl -X DELETE https://example.com/users
+EOF`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := destructiveRequests(tt.cmdText, tt.writes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("destructiveRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmRun(t *testing.T) {
+	deleteCmd := `BASE_URL="https://prod.example.com"
+
+curl -s -X DELETE "${BASE_URL}/users/42"`
+
+	tests := []struct {
+		name    string
+		cmdText string
+		times   int
+		input   string
+		wantErr bool
+		wantOut string
+	}{
+		{
+			name:    "confirmed",
+			cmdText: deleteCmd,
+			times:   1,
+			input:   "y\n",
+			wantOut: "About to send (environment: prod):\n  DELETE https://prod.example.com/users/42\nContinue? [y/N] ",
+		},
+		{
+			name:    "batch is confirmed once",
+			cmdText: deleteCmd,
+			times:   10,
+			input:   "yes\n",
+			wantOut: "About to send (environment: prod):\n  DELETE https://prod.example.com/users/42\nRun 10 times? [y/N] ",
+		},
+		{
+			name:    "anything but y aborts",
+			cmdText: deleteCmd,
+			times:   1,
+			input:   "\n",
+			wantErr: true,
+		},
+		{
+			name:    "no answer aborts",
+			cmdText: deleteCmd,
+			times:   1,
+			wantErr: true,
+		},
+		{
+			name:    "safe requests are not prompted for",
+			cmdText: `curl -s "https://prod.example.com/users"`,
+			times:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := confirmRun(strings.NewReader(tt.input), &out, tt.cmdText, "prod", tt.times, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("confirmRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantOut != "" && out.String() != tt.wantOut {
+				t.Errorf("confirmRun() printed %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestYesRunsDeleteWithoutPrompt(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var gotMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	curlFile := filepath.Join(tmpDir, "DELETE_users_id.curl")
+	content := `BASE_URL="` + server.URL + `"
+
+curl -s -o /dev/null -X DELETE "${BASE_URL}/users/42"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+
+	// The run goes to the history in the home directory
+	t.Setenv("HOME", tmpDir)
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{tmpDir, "-f", curlFile, "--yes", "--confirm-writes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if gotMethod != http.MethodDelete {
+		t.Errorf("server got method %q, want DELETE", gotMethod)
+	}
+}
+
+func TestDeleteRunsWithStdinFromDevNull(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var mu sync.Mutex
+	var gotMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotMethod = r.Method
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	curlFile := filepath.Join(tmpDir, "DELETE_users_id.curl")
+	content := `BASE_URL="` + server.URL + `"
+
+curl -s -o /dev/null -X DELETE "${BASE_URL}/users/42"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+
+	// Like cron or CI: /dev/null is a character device but no terminal to
+	// answer a prompt on
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	if isTerminal(devNull) {
+		t.Fatalf("isTerminal(%s) = true, want false", os.DevNull)
+	}
+	stdin := os.Stdin
+	os.Stdin = devNull
+	defer func() { os.Stdin = stdin }()
+
+	t.Setenv("HOME", tmpDir)
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{tmpDir, "-f", curlFile, "--confirm-writes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gotMethod != http.MethodDelete {
+		t.Errorf("server got method %q, want DELETE", gotMethod)
+	}
+}
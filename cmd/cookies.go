@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// cookieJarsDir is where --session keeps its cookie jars, in the collection
+// directory
+const cookieJarsDir = ".curly/sessions"
+
+// cookieJarExt is the extension of the cookie jar files
+const cookieJarExt = ".cookies"
+
+// sessionNamePattern matches the names --session accepts, which name files
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// cookieJarPath returns the cookie jar of the session name in the collection
+// in dir
+func cookieJarPath(dir, name string) (string, error) {
+	if !sessionNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q, expected letters, digits, '.', '_' or '-'", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(cookieJarsDir), name+cookieJarExt), nil
+}
+
+// prepareCookieJar returns the absolute path of the cookie jar of the session
+// name, creating its directory so curl can write it
+func prepareCookieJar(dir, name string) (string, error) {
+	path, err := cookieJarPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return filepath.Abs(path)
+}
+
+// injectCookieJar makes every curl command in content read cookies from and
+// write them back to jar, leaving the -b or -c of commands that handle
+// cookies themselves alone
+func injectCookieJar(content, jar string) string {
+	lines := strings.Split(content, "\n")
+	quoted := shellquote.DoubleQuote(jar)
+	for _, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		var reads, writes bool
+		for _, word := range splitShellWords(text.String()) {
+			switch {
+			case word == "-b" || word == "--cookie" || strings.HasPrefix(word, "--cookie="):
+				reads = true
+			case word == "-c" || word == "--cookie-jar" || strings.HasPrefix(word, "--cookie-jar="):
+				writes = true
+			}
+		}
+		var args []string
+		if !reads {
+			args = append(args, "-b "+quoted)
+		}
+		if !writes {
+			args = append(args, "-c "+quoted)
+		}
+		if len(args) > 0 {
+			insertCurlArgs(lines, cmd, strings.Join(args, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func NewSessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage the cookie jars of --session",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "list [collection-dir]",
+		Short:             "List the sessions of a collection",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			return listSessions(cmd.OutOrStdout(), dir)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "clear <name> [collection-dir]",
+		Short:             "Delete the cookie jar of a session",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeDirAt(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			return clearSession(cmd.OutOrStdout(), dir, args[0])
+		},
+	})
+
+	return cmd
+}
+
+// listSessions prints the sessions of the collection in dir with how many
+// cookies each holds and when it was last written
+func listSessions(out io.Writer, dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(cookieJarsDir), "*"+cookieJarExt))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(out, "No sessions")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read session: %w", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read session: %w", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), cookieJarExt)
+		fmt.Fprintf(w, "%s\t%d cookies\tupdated %s\n", name, countCookies(string(data)), info.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+// countCookies counts the cookies of a Netscape cookie jar, where comments
+// start with # but HttpOnly cookies with #HttpOnly_
+func countCookies(jar string) int {
+	n := 0
+	for _, line := range strings.Split(jar, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#HttpOnly_")) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// clearSession deletes the cookie jar of the session name in dir
+func clearSession(out io.Writer, dir, name string) error {
+	path, err := cookieJarPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no session %q in %s", name, dir)
+		}
+		return fmt.Errorf("failed to clear session: %w", err)
+	}
+	fmt.Fprintf(out, "Cleared session %s\n", name)
+	return nil
+}
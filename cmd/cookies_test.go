@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInjectCookieJar(t *testing.T) {
+	jar := "/tmp/my jar/alice.cookies"
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "reads and writes the jar",
+			content: "curl -s \"${BASE_URL}/me\"",
+			want:    "curl -b \"/tmp/my jar/alice.cookies\" -c \"/tmp/my jar/alice.cookies\" -s \"${BASE_URL}/me\"",
+		},
+		{
+			name:    "every command of the file",
+			content: "# curl in a comment\ncurl -s a &&\ncurl -s \\\n  b",
+			want:    "# curl in a comment\ncurl -b \"/tmp/my jar/alice.cookies\" -c \"/tmp/my jar/alice.cookies\" -s a &&\ncurl -b \"/tmp/my jar/alice.cookies\" -c \"/tmp/my jar/alice.cookies\" -s \\\n  b",
+		},
+		{
+			name:    "own cookies are kept",
+			content: "curl -s \\\n  -b 'sid=1' a",
+			want:    "curl -c \"/tmp/my jar/alice.cookies\" -s \\\n  -b 'sid=1' a",
+		},
+		{
+			name:    "own jar is kept",
+			content: "curl --cookie-jar out.txt --cookie=in.txt a",
+			want:    "curl --cookie-jar out.txt --cookie=in.txt a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectCookieJar(tt.content, jar); got != tt.want {
+				t.Errorf("injectCookieJar() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieJarPath(t *testing.T) {
+	got, err := cookieJarPath("collection", "alice.dev")
+	if err != nil || got != filepath.Join("collection", ".curly", "sessions", "alice.dev.cookies") {
+		t.Errorf("cookieJarPath() = %q, %v", got, err)
+	}
+	for _, name := range []string{"", "../etc", "a/b", ".hidden"} {
+		if _, err := cookieJarPath("collection", name); err == nil {
+			t.Errorf("cookieJarPath(%q) should fail", name)
+		}
+	}
+}
+
+func TestListAndClearSessions(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	if err := listSessions(&out, dir); err != nil || out.String() != "No sessions\n" {
+		t.Errorf("listSessions() without sessions = %q, %v", out.String(), err)
+	}
+
+	jar, err := prepareCookieJar(dir, "alice")
+	if err != nil {
+		t.Fatalf("prepareCookieJar() error = %v", err)
+	}
+	cookies := "# Netscape HTTP Cookie File\n\n#HttpOnly_localhost\tFALSE\t/\tFALSE\t0\tsid\t1\nlocalhost\tFALSE\t/\tFALSE\t0\ttheme\tdark\n"
+	if err := os.WriteFile(jar, []byte(cookies), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := listSessions(&out, dir); err != nil {
+		t.Fatalf("listSessions() error = %v", err)
+	}
+	if !regexp.MustCompile(`^alice  2 cookies  updated \d{4}-\d\d-\d\d \d\d:\d\d:\d\d\n$`).MatchString(out.String()) {
+		t.Errorf("listSessions() = %q", out.String())
+	}
+
+	out.Reset()
+	if err := clearSession(&out, dir, "alice"); err != nil || out.String() != "Cleared session alice\n" {
+		t.Errorf("clearSession() = %q, %v", out.String(), err)
+	}
+	if _, err := os.Stat(jar); !os.IsNotExist(err) {
+		t.Errorf("clearSession() left the jar behind: %v", err)
+	}
+	if err := clearSession(&out, dir, "alice"); err == nil || !strings.Contains(err.Error(), `no session "alice"`) {
+		t.Errorf("clearSession() of a missing session error = %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// dataRow is a row of a --data-file, its columns by name
+type dataRow struct {
+	// number is the number of the row in the file, from 1, header left out
+	number int
+	values run.Environment
+}
+
+// rowCommand is the command run for a row of a --data-file, and the request
+// curly sends itself for it, if it does
+type rowCommand struct {
+	row     int
+	cmdText string
+	request *nativeRequest
+}
+
+// loadDataFile reads the rows of the CSV or JSON Lines file at path, told
+// apart by its extension. Malformed rows are warned about and left out, or
+// fail the load with strict
+func loadDataFile(path string, strict bool) ([]dataRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+	defer f.Close()
+
+	// malformed reports row number as malformed for err
+	malformed := func(number int, err error) error {
+		err = fmt.Errorf("%s: row %d: %w", filepath.Base(path), number, err)
+		if strict {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v, skipping it\n", err)
+		return nil
+	}
+
+	var rows []dataRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = readCSVRows(f, malformed)
+	case ".jsonl", ".ndjson":
+		rows, err = readJSONLRows(f, malformed)
+	default:
+		return nil, fmt.Errorf("data file %s: want a .csv or .jsonl file", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("data file %s has no rows", path)
+	}
+	return rows, nil
+}
+
+// readCSVRows reads the rows of a CSV file whose header names the variables
+// its columns set
+func readCSVRows(r io.Reader, malformed func(int, error) error) ([]dataRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header of the data file: %w", err)
+	}
+	for _, name := range header {
+		if !run.VarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("data file column %q isn't a valid variable name", name)
+		}
+	}
+
+	var rows []dataRow
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := malformed(number, parseErr.Err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data file: %w", err)
+		}
+		values := run.Environment{}
+		for i, name := range header {
+			values[name] = record[i]
+		}
+		rows = append(rows, dataRow{number: number, values: values})
+	}
+}
+
+// readJSONLRows reads the rows of a JSON Lines file, a JSON object per line
+// whose keys name the variables it sets. Blank lines are skipped
+func readJSONLRows(r io.Reader, malformed func(int, error) error) ([]dataRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var rows []dataRow
+	number := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		number++
+		values, err := parseJSONLRow(line)
+		if err != nil {
+			if err := malformed(number, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rows = append(rows, dataRow{number: number, values: values})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+	return rows, nil
+}
+
+// parseJSONLRow reads the variables of a line of a JSON Lines file: strings
+// as they are, null as empty, and other values as JSON
+func parseJSONLRow(line []byte) (run.Environment, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var record map[string]any
+	if err := decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("want a JSON object: %w", err)
+	}
+	values := run.Environment{}
+	for name, value := range record {
+		if !run.VarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("key %q isn't a valid variable name", name)
+		}
+		switch v := value.(type) {
+		case nil:
+			values[name] = ""
+		case string:
+			values[name] = v
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = string(encoded)
+		}
+	}
+	return values, nil
+}
+
+// rowCommands returns the command of each row: cmdText with the variables of
+// the row set in it, overriding its assignments, except those pinned by
+// --var. Variables it doesn't assign are assigned at its start
+func rowCommands(cmdText string, rows []dataRow, pinned run.Environment) []rowCommand {
+	commands := make([]rowCommand, len(rows))
+	for i, row := range rows {
+		overrides := run.Environment{}
+		for name, value := range row.values {
+			if _, ok := pinned[name]; !ok {
+				overrides[name] = value
+			}
+		}
+		text, unknown := run.ApplyVarOverrides(cmdText, overrides)
+		var assignments strings.Builder
+		for _, name := range unknown {
+			fmt.Fprintf(&assignments, "%s=%s\n", name, shellquote.DoubleQuote(overrides[name]))
+		}
+		commands[i] = rowCommand{row: row.number, cmdText: assignments.String() + text}
+	}
+	return commands
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestLoadDataFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"users.csv":     "USER_ID,NAME\n1,ada\n2,\"grace, hopper\"\n",
+		"ragged.csv":    "USER_ID,NAME\n1,ada\n2\n3,alan\n",
+		"bad.csv":       "USER ID\n1\n",
+		"rows.jsonl":    "{\"USER_ID\": 1, \"NAME\": \"ada\", \"TAGS\": [\"a\"], \"NOTE\": null}\n\n{\"USER_ID\": 2.5, \"ACTIVE\": true}\n",
+		"broken.jsonl":  "{\"USER_ID\": 1}\n{\"USER_ID\": \n[1]\n{\"USER-ID\": 4}\n{\"USER_ID\": 5}\n",
+		"users.txt":     "USER_ID\n1\n",
+		"empty.csv":     "USER_ID\n",
+		"malformed.csv": "USER_ID,NAME\n1,\"ada\n",
+	})
+
+	tests := []struct {
+		name    string
+		file    string
+		strict  bool
+		want    []dataRow
+		wantErr string
+	}{
+		{name: "CSV", file: "users.csv", want: []dataRow{
+			{number: 1, values: run.Environment{"USER_ID": "1", "NAME": "ada"}},
+			{number: 2, values: run.Environment{"USER_ID": "2", "NAME": "grace, hopper"}},
+		}},
+		{name: "CSV row with missing fields skipped", file: "ragged.csv", want: []dataRow{
+			{number: 1, values: run.Environment{"USER_ID": "1", "NAME": "ada"}},
+			{number: 3, values: run.Environment{"USER_ID": "3", "NAME": "alan"}},
+		}},
+		{name: "strict", file: "ragged.csv", strict: true, wantErr: "ragged.csv: row 2: wrong number of fields"},
+		{name: "invalid column", file: "bad.csv", wantErr: `column "USER ID" isn't a valid variable name`},
+		{name: "JSON Lines", file: "rows.jsonl", want: []dataRow{
+			{number: 1, values: run.Environment{"USER_ID": "1", "NAME": "ada", "TAGS": `["a"]`, "NOTE": ""}},
+			{number: 2, values: run.Environment{"USER_ID": "2.5", "ACTIVE": "true"}},
+		}},
+		{name: "malformed JSON Lines skipped", file: "broken.jsonl", want: []dataRow{
+			{number: 1, values: run.Environment{"USER_ID": "1"}},
+			{number: 5, values: run.Environment{"USER_ID": "5"}},
+		}},
+		{name: "malformed JSON Lines strict", file: "broken.jsonl", strict: true, wantErr: "broken.jsonl: row 2: want a JSON object"},
+		{name: "unknown format", file: "users.txt", wantErr: "want a .csv or .jsonl file"},
+		{name: "no rows", file: "empty.csv", wantErr: "has no rows"},
+		{name: "only malformed rows", file: "malformed.csv", wantErr: "has no rows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := loadDataFile(filepath.Join(dir, tt.file), tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadDataFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadDataFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("loadDataFile() = %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowCommands(t *testing.T) {
+	cmdText := "USER_ID=\"0\"\nTOKEN=\"secret\"\ncurl -s \"http://localhost/users/${USER_ID}?name=${NAME}\""
+	rows := []dataRow{{number: 1, values: run.Environment{"USER_ID": "7", "NAME": "ada $HOME", "TOKEN": "row-token"}}}
+
+	got := rowCommands(cmdText, rows, run.Environment{"TOKEN": "flag-token"})
+	want := "NAME=\"ada \\$HOME\"\nUSER_ID=\"7\"\nTOKEN=\"secret\"\ncurl -s \"http://localhost/users/${USER_ID}?name=${NAME}\""
+	if len(got) != 1 || got[0].row != 1 || got[0].cmdText != want {
+		t.Errorf("rowCommands() = %+v, want the command:\n%s", got, want)
+	}
+}
+
+func TestDataFileRun(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/users/2" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"users.csv": "USER_ID\n1\n2\n3\n"})
+	rows, err := loadDataFile(filepath.Join(dir, "users.csv"), false)
+	if err != nil {
+		t.Fatalf("loadDataFile() error = %v", err)
+	}
+
+	for _, native := range []bool{false, true} {
+		mu.Lock()
+		paths = nil
+		mu.Unlock()
+		cmdText := "USER_ID=\"0\"\ncurl -s \"" + server.URL + "/users/${USER_ID}\""
+		eo := execOptions{times: 6, rowTimes: 2, parallel: 3, quiet: true, native: native, rows: rowCommands(cmdText, rows, nil), failOn: []statusPattern{"4xx"}}
+		stats, err := execCmd(cmdText, eo)
+		if err == nil {
+			t.Fatal("execCmd() succeeded, want the 404s of row 2 to fail it")
+		}
+		mu.Lock()
+		got := append([]string(nil), paths...)
+		mu.Unlock()
+		sort.Strings(got)
+		if want := []string{"/users/1", "/users/1", "/users/2", "/users/2", "/users/3", "/users/3"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("native=%v: requests = %v, want %v", native, got, want)
+		}
+		if want := []int{2, 2}; !reflect.DeepEqual(stats.FailedRows, want) {
+			t.Errorf("native=%v: failed rows = %v, want %v", native, stats.FailedRows, want)
+		}
+		var summary bytes.Buffer
+		stats.Fprint(&summary)
+		if !strings.Contains(summary.String(), "Failed rows: 2\n") {
+			t.Errorf("native=%v: summary:\n%s\nwant it to list row 2", native, summary.String())
+		}
+	}
+}
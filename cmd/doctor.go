@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// doctorStatus is how a check of curly doctor went
+type doctorStatus string
+
+const (
+	doctorPass doctorStatus = "pass"
+	// doctorWarn is for what degrades curly without stopping it
+	doctorWarn doctorStatus = "warn"
+	// doctorFail is for what stops curly from running the collection, which
+	// makes curly doctor exit non-zero
+	doctorFail doctorStatus = "fail"
+)
+
+// doctorResult is the outcome of a check, with a hint on fixing it unless it
+// passed and the files it is about
+type doctorResult struct {
+	status  doctorStatus
+	message string
+	hint    string
+	details []string
+}
+
+// doctorCheck is one of the things curly doctor checks, run on the
+// collection dir
+type doctorCheck struct {
+	name string
+	run  func(dir string) doctorResult
+}
+
+// doctorChecks are the checks of curly doctor, in the order they are printed
+var doctorChecks = []doctorCheck{
+	{name: "sh", run: checkShell},
+	{name: "curl", run: checkCurl},
+	{name: "fzf", run: checkFzf},
+	{name: "jq", run: checkJQInstalled},
+	{name: "editor", run: checkEditor},
+	{name: "config", run: checkConfigs},
+	{name: "envs.yml", run: checkEnvsFiles},
+	{name: ".curl files", run: checkCurlFiles},
+	{name: "temp files", run: checkStrayTempFiles},
+	{name: "commands", run: checkCommands},
+	{name: "variables", run: checkFileVariables},
+}
+
+func NewDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "doctor [collection-dir]",
+		Short:             "Check the tools curly needs, its config and a collection for problems",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			return runDoctor(cmd.OutOrStdout(), dir, doctorChecks)
+		},
+	}
+}
+
+// runDoctor runs checks on the collection dir, printing a line for each, and
+// fails when one of them did
+func runDoctor(out io.Writer, dir string, checks []doctorCheck) error {
+	width := 0
+	for _, check := range checks {
+		width = max(width, len(check.name))
+	}
+	failed := 0
+	for _, check := range checks {
+		result := check.run(dir)
+		fmt.Fprintf(out, "%s  %-*s  %s\n", result.status, width, check.name, result.message)
+		for _, detail := range result.details {
+			fmt.Fprintf(out, "      %*s  %s\n", width, "", detail)
+		}
+		if result.hint != "" {
+			fmt.Fprintf(out, "      %*s  Hint: %s\n", width, "", result.hint)
+		}
+		if result.status == doctorFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkShell finds the sh curl commands run with
+func checkShell(string) doctorResult {
+	sh, err := findShell()
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error(), hint: "install a POSIX sh, or use --native for files of a single curl command"}
+	}
+	return doctorResult{status: doctorPass, message: sh}
+}
+
+// minCurlVersion is the oldest curl taking the socks5h:// proxies --proxy
+// and envs.yml can pass it
+var minCurlVersion = [3]int{7, 21, 7}
+
+// curlVersionPattern matches the version in the output of curl --version
+var curlVersionPattern = regexp.MustCompile(`^curl (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// checkCurl finds curl and makes sure it isn't older than minCurlVersion
+func checkCurl(string) doctorResult {
+	if _, err := exec.LookPath("curl"); err != nil {
+		return doctorResult{status: doctorFail, message: "not installed", hint: "install curl from your package manager or https://curl.se/download.html"}
+	}
+	out, err := exec.Command("curl", "--version").Output()
+	if err != nil {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("curl --version failed: %v", err)}
+	}
+	return curlVersionResult(string(out))
+}
+
+// curlVersionResult checks the version in out, the output of curl --version
+func curlVersionResult(out string) doctorResult {
+	line, _, _ := strings.Cut(out, "\n")
+	match := curlVersionPattern.FindStringSubmatch(line)
+	if match == nil {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("unknown version %q", line)}
+	}
+	var version [3]int
+	for i := range version {
+		version[i], _ = strconv.Atoi(match[i+1])
+	}
+	if slices.Compare(version[:], minCurlVersion[:]) < 0 {
+		return doctorResult{
+			status:  doctorWarn,
+			message: fmt.Sprintf("%s is older than %d.%d.%d", match[0], minCurlVersion[0], minCurlVersion[1], minCurlVersion[2]),
+			hint:    "upgrade curl, it may reject flags curly passes",
+		}
+	}
+	return doctorResult{status: doctorPass, message: match[0]}
+}
+
+// checkFzf finds fzf, which curly falls back to its own finder without
+func checkFzf(string) doctorResult {
+	return optionalTool("fzf", "install fzf for fuzzy finding, curly's own finder is used without it")
+}
+
+// checkJQInstalled finds jq, which --jq, --expect-json and captures need
+func checkJQInstalled(string) doctorResult {
+	return optionalTool("jq", "install jq to use --jq, --expect-json and captures")
+}
+
+// optionalTool finds the tool name, warning with hint when it is missing
+func optionalTool(name, hint string) doctorResult {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return doctorResult{status: doctorWarn, message: "not installed", hint: hint}
+	}
+	return doctorResult{status: doctorPass, message: path}
+}
+
+// checkEditor finds the editor files are opened in, see findEditor
+func checkEditor(string) doctorResult {
+	words, err := findEditor("")
+	if err != nil {
+		return doctorResult{status: doctorWarn, message: err.Error(), hint: "set $EDITOR, like export EDITOR=vim, or run files with --no-edit"}
+	}
+	return doctorResult{status: doctorPass, message: strings.Join(words, " ")}
+}
+
+// checkConfigs parses the global config and the .curly.yml files of the
+// collection dir
+func checkConfigs(dir string) doctorResult {
+	paths := []string{globalConfigPath()}
+	err := walkCollection(dir, func(path string, d fs.DirEntry) {
+		if d.Name() == collectionConfigFile {
+			paths = append(paths, path)
+		}
+	})
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error()}
+	}
+	var found, broken []string
+	for _, path := range paths {
+		config, err := loadConfig(path)
+		if err != nil {
+			broken = append(broken, err.Error())
+		} else if config != nil {
+			found = append(found, path)
+		}
+	}
+	switch {
+	case len(broken) > 0:
+		return doctorResult{status: doctorFail, message: "unparseable config", hint: "fix the YAML, a map of flag names to values", details: broken}
+	case len(found) == 0:
+		return doctorResult{status: doctorPass, message: "none, the built-in defaults are used"}
+	}
+	return doctorResult{status: doctorPass, message: strings.Join(found, ", ")}
+}
+
+// checkEnvsFiles parses the envs.yml files of the collection dir, or the
+// global one when it has none
+func checkEnvsFiles(dir string) doctorResult {
+	var paths []string
+	err := walkCollection(dir, func(path string, d fs.DirEntry) {
+		if d.Name() == "envs.yml" || d.Name() == run.EncryptedEnvsFile {
+			paths = append(paths, filepath.Join(filepath.Dir(path), "envs.yml"))
+		}
+	})
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error()}
+	}
+	if len(paths) == 0 {
+		if path := run.FindEnvsFile(dir, "", ""); path != filepath.Join(dir, "envs.yml") {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return doctorResult{status: doctorWarn, message: "none", hint: "run curly init, or add an envs.yml to run the collection against environments with -e"}
+	}
+
+	var broken []string
+	environments := 0
+	paths = slices.Compact(paths)
+	for _, path := range paths {
+		config, err := run.LoadEnvConfig(path)
+		if err != nil {
+			broken = append(broken, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if config != nil {
+			environments += len(config.Environments)
+		}
+	}
+	if len(broken) > 0 {
+		return doctorResult{status: doctorFail, message: "unparseable envs.yml", hint: "fix the YAML, curly envs list shows the environments once it parses", details: broken}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("%d environments in %s", environments, strings.Join(paths, ", "))}
+}
+
+// checkCurlFiles makes sure the collection dir has .curl files to run
+func checkCurlFiles(dir string) doctorResult {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return doctorResult{status: doctorFail, message: fmt.Sprintf("%s isn't a directory", dir), hint: "pass the directory of the collection, like curly doctor collection/"}
+	}
+	endpoints, err := findEndpoints(dir)
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error(), hint: "generate a collection with curly generate, or start one with curly init"}
+	}
+	return doctorResult{status: doctorPass, message: fmt.Sprintf("%d in %s", len(endpoints), dir)}
+}
+
+// checkStrayTempFiles finds the .curl.tmp copies interrupted edits left in
+// the collection dir
+func checkStrayTempFiles(dir string) doctorResult {
+	var stray []string
+	err := walkCollection(dir, func(path string, d fs.DirEntry) {
+		if strings.HasSuffix(d.Name(), strayTempSuffix) {
+			stray = append(stray, path)
+		}
+	})
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error()}
+	}
+	if len(stray) > 0 {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("%d stray %s files", len(stray), strayTempSuffix), hint: "remove them with curly clean", details: stray}
+	}
+	return doctorResult{status: doctorPass, message: "none"}
+}
+
+// checkCommands finds the .curl files of the collection dir that have
+// nothing to run
+func checkCommands(dir string) doctorResult {
+	var empty []string
+	err := run.WalkCurlFiles(dir, func(path string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if run.ExtractShellCommand(string(content)) == "" {
+			empty = append(empty, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error()}
+	}
+	if len(empty) > 0 {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("%d .curl files without a command", len(empty)), hint: "add a curl command after the comments, or delete the files", details: empty}
+	}
+	return doctorResult{status: doctorPass, message: "every .curl file has a command"}
+}
+
+// checkFileVariables finds the .curl files of the collection dir referencing
+// variables that neither they nor their environment set, see checkVariables.
+// Each file is checked against the environment it runs against without -e
+func checkFileVariables(dir string) doctorResult {
+	var problems []string
+	err := run.WalkCurlFiles(dir, func(path string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		opts, err := withFileEnvironment(runOptions{}, false, dir, path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			return nil
+		}
+		opts.envsFile = run.FindEnvsFile(dir, path, "")
+		vars, err := loadRunVariables(dir, opts)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		if err := checkVariables(run.ApplyEnvironmentVars(string(content), vars)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return doctorResult{status: doctorFail, message: err.Error()}
+	}
+	if len(problems) > 0 {
+		return doctorResult{status: doctorWarn, message: fmt.Sprintf("%d .curl files with unresolved variables", len(problems)), hint: "set them in the file, envs.yml or .env, or pass them with --var", details: problems}
+	}
+	return doctorResult{status: doctorPass, message: "every variable is set"}
+}
+
+// walkCollection calls fn with every file under dir, leaving out curly's own
+// directory
+func walkCollection(dir string, fn func(path string, d fs.DirEntry)) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == run.CurlyDir && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(path, d)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s doesn't exist", dir)
+	}
+	return err
+}
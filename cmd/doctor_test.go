@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctor(t *testing.T) {
+	checks := []doctorCheck{
+		{name: "sh", run: func(string) doctorResult { return doctorResult{status: doctorPass, message: "/bin/sh"} }},
+		{name: "fzf", run: func(string) doctorResult {
+			return doctorResult{status: doctorWarn, message: "not installed", hint: "install fzf"}
+		}},
+		{name: "temp files", run: func(dir string) doctorResult {
+			return doctorResult{status: doctorFail, message: "2 stray files in " + dir, details: []string{"a.curl.tmp", "b.curl.tmp"}}
+		}},
+	}
+	var out bytes.Buffer
+	err := runDoctor(&out, "collection", checks)
+	want := `pass  sh          /bin/sh
+warn  fzf         not installed
+                  Hint: install fzf
+fail  temp files  2 stray files in collection
+                  a.curl.tmp
+                  b.curl.tmp
+`
+	if out.String() != want {
+		t.Errorf("runDoctor() =\n%s\nwant\n%s", out.String(), want)
+	}
+	if err == nil || err.Error() != "1 of 3 checks failed" {
+		t.Errorf("runDoctor() error = %v, want 1 of 3 checks failed", err)
+	}
+
+	out.Reset()
+	if err := runDoctor(&out, "collection", checks[:2]); err != nil {
+		t.Errorf("runDoctor() error = %v with warnings only, want none", err)
+	}
+}
+
+func TestCurlVersionResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		out        string
+		wantStatus doctorStatus
+		wantMsg    string
+	}{
+		{name: "current", out: "curl 8.5.0 (x86_64-pc-linux-gnu) libcurl/8.5.0\nRelease-Date: 2023-12-06\n", wantStatus: doctorPass, wantMsg: "curl 8.5.0"},
+		{name: "the oldest supported", out: "curl 7.21.7 (i686-pc-linux-gnu)\n", wantStatus: doctorPass, wantMsg: "curl 7.21.7"},
+		{name: "ancient", out: "curl 7.19.7 (x86_64-redhat-linux-gnu) libcurl/7.19.7\n", wantStatus: doctorWarn, wantMsg: "curl 7.19.7 is older than 7.21.7"},
+		{name: "without a patch version", out: "curl 7.9 (i386-pc-win32)\n", wantStatus: doctorWarn, wantMsg: "curl 7.9 is older than 7.21.7"},
+		{name: "not curl", out: "wget 1.21\n", wantStatus: doctorWarn, wantMsg: `unknown version "wget 1.21"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := curlVersionResult(tt.out)
+			if got.status != tt.wantStatus || got.message != tt.wantMsg {
+				t.Errorf("curlVersionResult() = %s %q, want %s %q", got.status, got.message, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDoctorMissingTools(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+
+	for _, check := range []struct {
+		name string
+		run  func(string) doctorResult
+		want doctorStatus
+	}{
+		{name: "curl", run: checkCurl, want: doctorFail},
+		{name: "fzf", run: checkFzf, want: doctorWarn},
+		{name: "jq", run: checkJQInstalled, want: doctorWarn},
+		{name: "editor", run: checkEditor, want: doctorWarn},
+	} {
+		if got := check.run("."); got.status != check.want || got.hint == "" {
+			t.Errorf("%s check = %+v, want %s with a hint", check.name, got, check.want)
+		}
+	}
+}
+
+func TestDoctorCollectionChecks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CURLY_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"envs.yml":                  "environments:\n  dev:\n    BASE_URL: \"http://dev.local\"\n",
+		".curly.yml":                "env: dev\n",
+		"GET_users.curl":            "curl -s \"${BASE_URL}/users\"",
+		"GET_users.curl.tmp":        "curl -s \"${BASE_URL}/users\"",
+		"POST_notes.curl":           "# POST /notes\n\n# TODO\n",
+		"billing/GET_invoices.curl": "curl -s \"${BASE_URL}/invoices/${INVOICE_ID}\"",
+		"billing/envs.yml":          "environments: [dev\n",
+		"identity/.curly.yml":       "- env\n",
+	})
+	file := func(name string) string { return filepath.Join(root, filepath.FromSlash(name)) }
+
+	tests := []struct {
+		name        string
+		run         func(string) doctorResult
+		dir         string
+		wantStatus  doctorStatus
+		wantDetails []string
+	}{
+		{name: "config", run: checkConfigs, wantStatus: doctorFail, wantDetails: []string{file("identity/.curly.yml") + ":1: want a map of flag names to values"}},
+		{name: "envs.yml", run: checkEnvsFiles, wantStatus: doctorFail},
+		{name: ".curl files", run: checkCurlFiles, wantStatus: doctorPass},
+		{name: "no .curl files", run: checkCurlFiles, dir: t.TempDir(), wantStatus: doctorFail},
+		{name: "temp files", run: checkStrayTempFiles, wantStatus: doctorWarn, wantDetails: []string{file("GET_users.curl.tmp")}},
+		{name: "commands", run: checkCommands, wantStatus: doctorWarn, wantDetails: []string{file("POST_notes.curl")}},
+		{name: "variables", run: checkFileVariables, wantStatus: doctorWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := root
+			if tt.dir != "" {
+				dir = tt.dir
+			}
+			got := tt.run(dir)
+			if got.status != tt.wantStatus {
+				t.Errorf("%s check = %+v, want %s", tt.name, got, tt.wantStatus)
+			}
+			if tt.wantDetails != nil && !reflect.DeepEqual(got.details, tt.wantDetails) {
+				t.Errorf("%s check details = %q, want %q", tt.name, got.details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestDoctorFileVariables(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"envs.yml":                  "environments:\n  dev:\n    BASE_URL: \"http://dev.local\"\n",
+		"billing/.curly.yml":        "env: dev\n",
+		"billing/GET_invoices.curl": "BASE_URL=\"VALUE\"\nID=\"1\"\ncurl -s \"${BASE_URL}/invoices/${ID}\"",
+		"GET_users.curl":            "BASE_URL=\"VALUE\"\ncurl -s \"${BASE_URL}/users/${USER_ID}\"",
+	})
+
+	got := checkFileVariables(root)
+	if got.status != doctorWarn || len(got.details) != 1 {
+		t.Fatalf("checkFileVariables() = %+v, want a warning about one file", got)
+	}
+	if detail := got.details[0]; !strings.HasPrefix(detail, filepath.Join(root, "GET_users.curl")+": ") || !strings.Contains(detail, "never assigned: USER_ID; still set to the placeholder VALUE: BASE_URL") {
+		t.Errorf("checkFileVariables() detail = %q, want GET_users.curl missing USER_ID and BASE_URL", detail)
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestDotEnvPrecedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	envs := `environments:
+  dev:
+    FROM_ENV: "envs.yml"
+    FROM_VAR: "envs.yml"
+`
+	dotEnv := `FROM_DOTENV=.env
+FROM_ENV=.env
+FROM_VAR=.env
+`
+	curlContent := `# Variables
+FROM_FILE="file"
+FROM_DOTENV="file"
+FROM_ENV="file"
+FROM_VAR="file"
+
+curl -s "http://localhost/${FROM_FILE}"
+`
+	files := map[string]string{"envs.yml": envs, ".env": dotEnv, "GET_test.curl": curlContent}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	curlFile := filepath.Join(tmpDir, "GET_test.curl")
+
+	tests := []struct {
+		name      string
+		envName   string
+		overrides run.Environment
+		want      []string
+	}{
+		{
+			name: ".env over file",
+			want: []string{`FROM_FILE="file"`, `FROM_DOTENV=".env"`, `FROM_ENV=".env"`, `FROM_VAR=".env"`},
+		},
+		{
+			name:    "envs.yml over .env",
+			envName: "dev",
+			want:    []string{`FROM_FILE="file"`, `FROM_DOTENV=".env"`, `FROM_ENV="envs.yml"`, `FROM_VAR="envs.yml"`},
+		},
+		{
+			name:      "--var over everything",
+			envName:   "dev",
+			overrides: run.Environment{"FROM_VAR": "var"},
+			want:      []string{`FROM_FILE="file"`, `FROM_DOTENV=".env"`, `FROM_ENV="envs.yml"`, `FROM_VAR="var"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdText, err := runFile(curlFile, tmpDir, runOptions{envName: tt.envName, overrides: tt.overrides})
+			if err != nil {
+				t.Fatalf("runFile() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(cmdText, want) {
+					t.Errorf("runFile() missing %q, got:\n%s", want, cmdText)
+				}
+			}
+		})
+	}
+}
+
+func TestDotEnvValuesSurviveShell(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var mu sync.Mutex
+	got := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, name := range []string{"X-Pw", "X-Quoted", "X-Command", "X-Backslash"} {
+			got[name] = r.Header.Get(name)
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		".env": "PW='pa$$word'\nQUOTED=\"say \\\"hi\\\"\"\nCOMMAND='$(echo ran) `echo ran`'\nBACKSLASH='C:\\temp'\n",
+		"GET_test.curl": "PW=\"VALUE\"\nQUOTED=\"VALUE\"\nCOMMAND=\"VALUE\"\nBACKSLASH=\"VALUE\"\n" +
+			"curl -s -H \"X-Pw: ${PW}\" -H \"X-Quoted: ${QUOTED}\" -H \"X-Command: ${COMMAND}\" -H \"X-Backslash: ${BACKSLASH}\" \"" + server.URL + "\"\n",
+	})
+
+	cmdText, err := runFile(filepath.Join(tmpDir, "GET_test.curl"), tmpDir, runOptions{})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if out, err := exec.Command("sh", "-c", cmdText).CombinedOutput(); err != nil {
+		t.Fatalf("command failed: %v\n%s\n%s", err, out, cmdText)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]string{"X-Pw": "pa$$word", "X-Quoted": `say "hi"`, "X-Command": "$(echo ran) `echo ran`", "X-Backslash": `C:\temp`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("server got %q, want the .env values as written %q", got, want)
+	}
+}
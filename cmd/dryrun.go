@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// fileVariable is a variable assigned ahead of the curl command, as the
+// shell would see it when running the file
+type fileVariable struct {
+	name  string
+	value string
+	// dynamic marks a value computed by the shell at run time, like
+	// $(uuidgen), which is shown as written
+	dynamic bool
+}
+
+// shellVarRefPattern matches the name of a $NAME reference
+var shellVarRefPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// writeDryRun prints what running cmdText would do without running it: the
+// resolved variables with showVars and the commands with their variables
+// expanded with dryRun. The variables are listed with the sources that set
+// them, the one whose value won first, and their secrets redacted by r. The
+// commands only have the values resolved by commands of envs.yml redacted
+func writeDryRun(out io.Writer, cmdText string, dryRun, showVars bool, sources run.Sources, r *redactor) {
+	vars := resolveFileVariables(cmdText)
+
+	if showVars {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VARIABLE\tVALUE\tSOURCE")
+		now := time.Now()
+		for _, v := range vars {
+			source := strings.Join(sources.Precedence(v.name), " > ")
+			var note string
+			if v.dynamic {
+				note = "\t(evaluated at run time)"
+			} else if validity := jwtValidity(v.value, now); validity != "" {
+				note = "\t(" + validity + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s%s\n", v.name, r.redact(v.value), source, note)
+		}
+		w.Flush()
+		if dryRun {
+			fmt.Fprintln(out)
+		}
+	}
+
+	if dryRun {
+		expanded, _ := expandCommandText(cmdText, vars)
+		fmt.Fprintln(out, r.redactCommandValues(expanded))
+	}
+}
+
+// writeEnvironmentLayers prints the variables of the environments envName
+// layers in the envs.yml at envsFile, merged like run.LoadEnvironment
+// does, with the environment each value comes from
+func writeEnvironmentLayers(out io.Writer, envsFile, envName string) error {
+	config, err := run.LoadEnvConfig(envsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load envs.yml: %w", err)
+	}
+	layers := run.EnvLayers(envName)
+	merged, from := run.Environment{}, map[string]string{}
+	for _, name := range layers {
+		env, ok := config.Environments[name]
+		if !ok {
+			return fmt.Errorf("environment '%s' not found in envs.yml", name)
+		}
+		for k, v := range env {
+			merged[k], from[k] = v, name
+		}
+	}
+
+	fmt.Fprintf(out, "Environment %s:\n", strings.Join(layers, " + "))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, k := range sortedKeys(merged) {
+		fmt.Fprintf(w, "%s\t%s\t(%s)\n", k, merged[k], from[k])
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+	return nil
+}
+
+// recordOSEnvSources records in sources the OS environment variables the
+// ${env:NAME} references in the assignments of content take their values from
+func recordOSEnvSources(content string, sources run.Sources) {
+	if sources == nil {
+		return
+	}
+	lines := strings.Split(content, "\n")
+	end := len(lines)
+	if commands := run.FindCurlCommands(lines); len(commands) > 0 {
+		end = commands[0].Start
+	}
+	inBody := run.HeredocBodies(lines)
+	for i, line := range lines[:end] {
+		match := run.AssignmentPattern.FindStringSubmatch(line)
+		if inBody[i] || match == nil {
+			continue
+		}
+		for _, ref := range run.OSEnvRefPattern.FindAllStringSubmatch(line[len(match[0]):], -1) {
+			if !strings.HasPrefix(ref[0], `\`) {
+				sources.Set(match[1], "OS environment ("+ref[1]+")")
+			}
+		}
+	}
+}
+
+// resolveFileVariables evaluates the top-level assignments ahead of the
+// first curl command in order, expanding references to earlier variables and
+// falling back to the OS environment like the shell would
+func resolveFileVariables(content string) []fileVariable {
+	lines := strings.Split(content, "\n")
+	end := len(lines)
+	if commands := run.FindCurlCommands(lines); len(commands) > 0 {
+		end = commands[0].Start
+	}
+
+	inBody := run.HeredocBodies(lines)
+	var vars []fileVariable
+	for i, line := range lines[:end] {
+		if inBody[i] {
+			continue
+		}
+		match := run.AssignmentPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value, dynamic := evalAssignmentValue(line[len(match[0]):], vars)
+		v := fileVariable{name: match[1], value: value, dynamic: dynamic}
+
+		replaced := false
+		for i := range vars {
+			if vars[i].name == v.name {
+				vars[i], replaced = v, true
+			}
+		}
+		if !replaced {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// evalAssignmentValue evaluates the right-hand side of an assignment. A value
+// the shell would have to run a command for is returned as written
+func evalAssignmentValue(raw string, vars []fileVariable) (string, bool) {
+	if strings.Contains(raw, "$(") || strings.Contains(raw, "`") {
+		return strings.TrimSpace(raw), true
+	}
+
+	var value strings.Builder
+	dynamic := false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				return strings.TrimSpace(raw), true
+			}
+			value.WriteString(raw[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			end := i + 1
+			for ; end < len(raw) && raw[end] != '"'; end++ {
+				if raw[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(raw) {
+				return strings.TrimSpace(raw), true
+			}
+			inner, unresolved := expandVarRefs(raw[i+1:end], vars, false)
+			value.WriteString(unescapeDoubleQuoted(inner))
+			dynamic = dynamic || len(unresolved) > 0
+			i = end
+		case c == ' ' || c == '\t':
+			// The rest of the line is another command or a comment
+			return value.String(), dynamic
+		default:
+			word := raw[i:]
+			if n := strings.IndexAny(word, " \t'\""); n >= 0 {
+				word = word[:n]
+			}
+			expanded, unresolved := expandVarRefs(word, vars, false)
+			value.WriteString(expanded)
+			dynamic = dynamic || len(unresolved) > 0
+			i += len(word) - 1
+		}
+	}
+	return value.String(), dynamic
+}
+
+// unescapeDoubleQuoted removes the backslashes that escape characters inside
+// a double-quoted shell string
+func unescapeDoubleQuoted(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, "$", "\\`", "`").Replace(s)
+}
+
+// expandCommandText expands the variables in the curl commands of cmdText,
+// dropping the assignments ahead of them, and returns the names of the
+// references it couldn't resolve. Heredoc bodies with a quoted delimiter are
+// kept literal, like the shell does
+func expandCommandText(cmdText string, vars []fileVariable) (string, []string) {
+	lines := strings.Split(cmdText, "\n")
+	if commands := run.FindCurlCommands(lines); len(commands) > 0 {
+		lines = lines[commands[0].Start:]
+	}
+
+	var unresolved []string
+	heredoc, literal := "", false
+	for i, line := range lines {
+		if heredoc != "" {
+			if strings.TrimLeft(line, "\t") == heredoc {
+				heredoc = ""
+				continue
+			}
+			if !literal {
+				var names []string
+				lines[i], names = expandVarRefs(line, vars, true)
+				unresolved = append(unresolved, names...)
+			}
+			continue
+		}
+		if match := run.HeredocPattern.FindStringSubmatch(line); match != nil {
+			heredoc = match[2]
+			literal = strings.ContainsAny(match[0][strings.Index(match[0], "<<"):], `'"`)
+		}
+		var names []string
+		lines[i], names = expandVarRefs(line, vars, false)
+		unresolved = append(unresolved, names...)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n"), unresolved
+}
+
+// expandVarRefs expands $NAME, ${NAME}, ${NAME:-word} and ${NAME:+word} in s
+// with the given variables or the OS environment, outside single quotes
+// unless ignoreQuotes. References that can't be resolved without running the
+// shell, to unset or dynamic variables, are kept and their names returned
+func expandVarRefs(s string, vars []fileVariable, ignoreQuotes bool) (string, []string) {
+	var out strings.Builder
+	var unresolved []string
+	inSingle, inDouble := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inSingle:
+			if c == '\'' {
+				inSingle = false
+			}
+			out.WriteByte(c)
+			continue
+		case c == '\\' && i+1 < len(s):
+			out.WriteString(s[i : i+2])
+			i++
+			continue
+		case c == '\'' && !inDouble && !ignoreQuotes:
+			inSingle = true
+			out.WriteByte(c)
+			continue
+		case c == '"' && !ignoreQuotes:
+			inDouble = !inDouble
+			out.WriteByte(c)
+			continue
+		case c != '$' || i+1 >= len(s):
+			out.WriteByte(c)
+			continue
+		}
+
+		// c is a $ with something after it
+		if s[i+1] != '{' {
+			name := shellVarRefPattern.FindString(s[i+1:])
+			value, set, known := lookupVariable(vars, name)
+			switch {
+			case name == "":
+				out.WriteByte(c)
+			case set && known:
+				out.WriteString(value)
+				i += len(name)
+			default:
+				out.WriteString("$" + name)
+				unresolved = append(unresolved, name)
+				i += len(name)
+			}
+			continue
+		}
+
+		end, depth := -1, 0
+		for j := i + 1; j < len(s) && end < 0; j++ {
+			switch s[j] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = j
+				}
+			}
+		}
+		name := shellVarRefPattern.FindString(s[i+2:])
+		if end < 0 || name == "" {
+			out.WriteByte(c)
+			continue
+		}
+		ref, op := s[i:end+1], s[i+2+len(name):end]
+		value, set, known := lookupVariable(vars, name)
+
+		var expanded string
+		var names []string
+		switch {
+		case set && !known:
+			expanded, names = ref, []string{name}
+		case strings.HasPrefix(op, ":+"):
+			if value != "" {
+				expanded, names = expandVarRefs(op[2:], vars, ignoreQuotes)
+			}
+		case strings.HasPrefix(op, ":-"):
+			expanded = value
+			if value == "" {
+				expanded, names = expandVarRefs(op[2:], vars, ignoreQuotes)
+			}
+		case op == "" && set:
+			expanded = value
+		default:
+			expanded, names = ref, []string{name}
+		}
+		out.WriteString(expanded)
+		unresolved = append(unresolved, names...)
+		i = end
+	}
+	return out.String(), unresolved
+}
+
+// lookupVariable finds a variable assigned in the file or, failing that, in
+// the OS environment. known is false for a dynamic value the shell computes
+func lookupVariable(vars []fileVariable, name string) (value string, set, known bool) {
+	for _, v := range vars {
+		if v.name == name {
+			return v.value, true, !v.dynamic
+		}
+	}
+	value, set = os.LookupEnv(name)
+	return value, set, set
+}
+
+// placeholderValue is the value generate assigns to variables it has no
+// example for
+const placeholderValue = "VALUE"
+
+// checkVariables reports what would make cmdText's request go out broken:
+// references to variables that are neither assigned in the file nor set in
+// the OS environment, and assignments still holding the generator's VALUE
+// placeholder. It runs on the final command text, after environments and
+// --var overrides have been applied
+func checkVariables(cmdText string) error {
+	vars := resolveFileVariables(cmdText)
+	_, unresolved := expandCommandText(cmdText, vars)
+
+	var missing, placeholders []string
+	seen := map[string]bool{}
+	for _, name := range unresolved {
+		if _, set, _ := lookupVariable(vars, name); !set && !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+	}
+	for _, v := range vars {
+		if v.value == placeholderValue {
+			placeholders = append(placeholders, v.name)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "never assigned: "+strings.Join(missing, ", "))
+	}
+	if len(placeholders) > 0 {
+		problems = append(problems, "still set to the placeholder VALUE: "+strings.Join(placeholders, ", "))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("variables %s (set them in the file, envs.yml or with --var)", strings.Join(problems, "; "))
+}
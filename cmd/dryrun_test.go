@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestWriteDryRun(t *testing.T) {
+	t.Setenv("CURLY_TEST_HOST", "os.example.com")
+
+	tests := []struct {
+		name     string
+		cmdText  string
+		dryRun   bool
+		showVars bool
+		want     string
+	}{
+		{
+			name: "variables are expanded into the command",
+			cmdText: `BASE_URL="http://dev.local"
+ID="42"
+AUTHORIZATION="Bearer \$token"
+
+curl -s -X DELETE "${BASE_URL}/users/${ID}" \
+  -H "Authorization: ${AUTHORIZATION}"`,
+			dryRun: true,
+			want: `curl -s -X DELETE "http://dev.local/users/42" \
+  -H "Authorization: Bearer $token"
+`,
+		},
+		{
+			name: "optional parameters follow their variables",
+			cmdText: `OWNER="alice"
+# SORT="name"
+LIMIT="5"
+
+curl -s -G -X GET "${BASE_URL:-http://localhost}/items" \
+  --data-urlencode "owner=${OWNER}" \
+  ${SORT:+--data-urlencode "sort=${SORT}"} \
+  ${LIMIT:+--data-urlencode "limit=${LIMIT}"}`,
+			dryRun: true,
+			want: `curl -s -G -X GET "http://localhost/items" \
+  --data-urlencode "owner=alice" \
+   \
+  --data-urlencode "limit=5"
+`,
+		},
+		{
+			name: "quoted heredoc bodies are kept literal",
+			cmdText: `NAME="bob"
+
+curl -s --data-binary @- << 'EOF'
+{"name": "${NAME}"}
+EOF
+curl -s --data-binary @- << EOF
+{"name": "${NAME}"}
+EOF`,
+			dryRun: true,
+			want: `curl -s --data-binary @- << 'EOF'
+{"name": "${NAME}"}
+EOF
+curl -s --data-binary @- << EOF
+{"name": "bob"}
+EOF
+`,
+		},
+		{
+			name: "dynamic and unknown values are left for the shell",
+			cmdText: `REQUEST_ID=$(uuidgen)
+HOST="${CURLY_TEST_HOST}"
+URL="https://${HOST}/v1"
+
+curl -s "${URL}" -H "X-Request-Id: ${REQUEST_ID}" -H "X-Other: ${CURLY_TEST_UNSET}" -H 'X-Literal: ${HOST}'`,
+			dryRun:   true,
+			showVars: true,
+			want: `VARIABLE    VALUE                      SOURCE
+REQUEST_ID  $(uuidgen)                 file  (evaluated at run time)
+HOST        os.example.com             file
+URL         https://os.example.com/v1  file
+
+curl -s "https://os.example.com/v1" -H "X-Request-Id: ${REQUEST_ID}" -H "X-Other: ${CURLY_TEST_UNSET}" -H 'X-Literal: ${HOST}'
+`,
+		},
+		{
+			name: "show-vars alone prints only the table",
+			cmdText: `BASE_URL="http://dev.local"
+TOKEN='single $quoted'
+
+curl -s "${BASE_URL}"`,
+			showVars: true,
+			want: `VARIABLE  VALUE             SOURCE
+BASE_URL  http://dev.local  file
+TOKEN     single $quoted    file
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writeDryRun(&out, tt.cmdText, tt.dryRun, tt.showVars, nil, nil)
+			if out.String() != tt.want {
+				t.Errorf("writeDryRun() =\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDryRunComposesWithRunFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	curlFile := filepath.Join(tmpDir, "DELETE_users.curl")
+	content := `# DELETE /users/{id}
+
+#### Variables ####
+
+BASE_URL="http://localhost"
+
+#### Path Parameters ####
+ID="VALUE"
+
+curl -s -X DELETE "${BASE_URL}/users/${ID}"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{insecure: true, overrides: run.Environment{"ID": "42"}})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	var out bytes.Buffer
+	writeDryRun(&out, cmdText, true, false, nil, nil)
+	if got := strings.TrimSpace(out.String()); got != `curl -k -s -X DELETE "http://localhost/users/42"` {
+		t.Errorf("dry run printed %q", got)
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	t.Setenv("CURLY_TEST_TOKEN", "secret")
+
+	tests := []struct {
+		name    string
+		cmdText string
+		wantErr string
+	}{
+		{
+			name: "everything assigned",
+			cmdText: `BASE_URL="http://dev.local"
+ID="42"
+
+curl -s "${BASE_URL}/users/${ID}" -H "Authorization: Bearer ${CURLY_TEST_TOKEN}"`,
+		},
+		{
+			name: "unset references and placeholders are reported once each",
+			cmdText: `ID="VALUE"
+# SORT="VALUE"
+
+curl -s "${BASE_URL}/users/${ID}" \
+  -H "X-Tenant: $TENANT" \
+  ${SORT:+--data-urlencode "sort=${SORT}"} \
+  -H "X-Base: ${BASE_URL}"`,
+			wantErr: "variables never assigned: BASE_URL, TENANT; still set to the placeholder VALUE: ID",
+		},
+		{
+			name: "defaults, dynamic values and quoted heredocs are fine",
+			cmdText: `REQUEST_ID=$(uuidgen)
+
+curl -s "${BASE_URL:-http://localhost}/items" -H "X-Request-Id: ${REQUEST_ID}" -H 'X-Literal: ${UNSET}' \
+  --data-binary @- << 'EOF'
+{"name": "${NAME}"}
+EOF`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVariables(tt.cmdText)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkVariables() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkVariables() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckVariablesSeesEnvironments(t *testing.T) {
+	tmpDir := t.TempDir()
+	curlFile := filepath.Join(tmpDir, "GET_users.curl")
+	content := `BASE_URL="http://localhost"
+ID="VALUE"
+AUTHORIZATION="VALUE"
+
+curl -s "${BASE_URL}/users/${ID}" -H "Authorization: ${AUTHORIZATION}"
+`
+	envs := `environments:
+  dev:
+    ID: "42"
+    AUTHORIZATION: "Bearer dev"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatalf("failed to write envs.yml: %v", err)
+	}
+
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if err := checkVariables(cmdText); err == nil {
+		t.Errorf("checkVariables() without an environment should report ID and AUTHORIZATION")
+	}
+
+	cmdText, err = runFile(curlFile, tmpDir, runOptions{envName: "dev"})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if err := checkVariables(cmdText); err != nil {
+		t.Errorf("checkVariables() with the dev environment error = %v", err)
+	}
+}
+
+func TestShowVarsSources(t *testing.T) {
+	t.Setenv("CURLY_TEST_HOST", "os.example.com")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env": "TENANT=dotenv\nREGION=dotenv\n",
+		"envs.yml": `environments:
+  staging:
+    REGION: "us"
+    ROLE: "user"
+    TOKEN: "staging-secret"
+  as-admin:
+    ROLE: "admin"
+`,
+		"GET_users.curl": `BASE_URL="http://localhost"
+TENANT="VALUE"
+REGION="VALUE"
+ROLE="VALUE"
+ID="VALUE"
+TOKEN="VALUE"
+HOST="${env:CURLY_TEST_HOST}"
+curl -s "${BASE_URL}/users/${ID}?tenant=${TENANT}&region=${REGION}&role=${ROLE}" -H "Authorization: Bearer ${TOKEN}" -H "X-Host: ${HOST}"`,
+	})
+
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{dir, "-e", "staging,as-admin", "--var", "ID=42", "--var", "REGION=eu", "--show-vars", "-f", filepath.Join(dir, "GET_users.curl")})
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// name: value and sources, the one whose value won first
+	want := map[string][2]string{
+		"BASE_URL": {"http://localhost", "file"},
+		"TENANT":   {"dotenv", ".env > file"},
+		"REGION":   {"eu", "--var > envs.yml (staging) > .env > file"},
+		"ROLE":     {"admin", "envs.yml (as-admin) > envs.yml (staging) > file"},
+		"ID":       {"42", "--var > file"},
+		"TOKEN":    {"****", "envs.yml (staging) > file"},
+		"HOST":     {"os.example.com", "OS environment (CURLY_TEST_HOST) > file"},
+	}
+	table := out.String()[strings.Index(out.String(), "VARIABLE"):]
+	got := map[string][2]string{}
+	for _, line := range strings.Split(strings.TrimSpace(table), "\n")[1:] {
+		fields := strings.Fields(line)
+		got[fields[0]] = [2]string{fields[1], strings.Join(fields[2:], " ")}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("--show-vars printed:\n%s\nwant values and sources %v", table, want)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationFlag is a flag.Value for a time flag, taking Go durations like
+// 250ms or 1m30s, and bare numbers of seconds like 2 or 0.5 as --delay
+// always did. Negative durations are rejected
+type durationFlag struct {
+	d *time.Duration
+}
+
+func newDurationFlag(d *time.Duration) *durationFlag {
+	return &durationFlag{d: d}
+}
+
+func (f *durationFlag) String() string {
+	if f.d == nil || *f.d == 0 {
+		return "0s"
+	}
+	return f.d.String()
+}
+
+func (f *durationFlag) Set(value string) error {
+	d, err := parseDuration(value)
+	if err != nil {
+		return err
+	}
+	*f.d = d
+	return nil
+}
+
+func (f *durationFlag) Type() string {
+	return "duration"
+}
+
+// parseDuration parses a Go duration like 250ms, or a bare number of seconds,
+// which may not be negative
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	var d time.Duration
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		d = time.Duration(seconds * float64(time.Second))
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected one like 250ms, 2s or 1m30s, or a number of seconds", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration cannot be negative, got %s", value)
+	}
+	return d, nil
+}
+
+// jitterDelay returns delay moved by a random amount within ±jitter, spread
+// uniformly so workers don't wait in step, and never below 0
+func jitterDelay(delay, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return delay
+	}
+	return max(delay-jitter+time.Duration(rand.Int64N(int64(2*jitter)+1)), 0)
+}
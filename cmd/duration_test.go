@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "250ms", want: 250 * time.Millisecond},
+		{value: "2s", want: 2 * time.Second},
+		{value: "1m30s", want: 90 * time.Second},
+		// A bare number is seconds, as --delay always took
+		{value: "1", want: time.Second},
+		{value: "0", want: 0},
+		{value: "0.25", want: 250 * time.Millisecond},
+		{value: "-1", wantErr: true},
+		{value: "-250ms", wantErr: true},
+		{value: "soon", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDurationFlag(t *testing.T) {
+	var delay time.Duration
+	flags := (&cobra.Command{}).Flags()
+	flags.Var(newDurationFlag(&delay), "delay", "")
+
+	if err := flags.Parse([]string{"--delay=3"}); err != nil || delay != 3*time.Second {
+		t.Errorf("--delay=3 = %v, %v, want 3s", delay, err)
+	}
+	if err := flags.Parse([]string{"--delay", "1m30s"}); err != nil || delay != 90*time.Second {
+		t.Errorf("--delay 1m30s = %v, %v, want 1m30s", delay, err)
+	}
+	if err := flags.Parse([]string{"--delay=-2s"}); err == nil {
+		t.Error("--delay=-2s should fail")
+	}
+}
+
+func TestJitterDelay(t *testing.T) {
+	if got := jitterDelay(time.Second, 0); got != time.Second {
+		t.Errorf("jitterDelay() without jitter = %v, want 1s", got)
+	}
+
+	delay, jitter := 500*time.Millisecond, 100*time.Millisecond
+	var below, above bool
+	for range 1000 {
+		got := jitterDelay(delay, jitter)
+		if got < delay-jitter || got > delay+jitter {
+			t.Fatalf("jitterDelay(%v, %v) = %v, out of bounds", delay, jitter, got)
+		}
+		below, above = below || got < delay, above || got > delay
+	}
+	if !below || !above {
+		t.Errorf("jitterDelay() should spread both ways, below %v, above %v", below, above)
+	}
+
+	// Jitter larger than the delay doesn't make it negative
+	for range 1000 {
+		if got := jitterDelay(10*time.Millisecond, time.Second); got < 0 {
+			t.Fatalf("jitterDelay() = %v, want at least 0", got)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// lastEditFile keeps the content of the last file edited in interactive mode,
+// in the collection directory, so edits survive a failed run
+const lastEditFile = ".curly/last-edit.curl"
+
+// saveEditsFile marks a collection whose edits are saved back to its files
+// without asking, after answering "always"
+const saveEditsFile = ".curly/save-edits"
+
+// errNoEditor tells none of the editors curly looks for is installed
+var errNoEditor = errors.New("no editor found: set $VISUAL or $EDITOR, or pass --editor, like --editor \"code --wait\"")
+
+// fallbackEditors are the editors curly looks for on PATH when neither
+// --editor, $VISUAL nor $EDITOR names one
+var fallbackEditors = []string{"vim", "vi", "nano", "notepad"}
+
+// editOptions are how interactive mode edits the picked files
+type editOptions struct {
+	// editor is the --editor command, taking precedence over $VISUAL and
+	// $EDITOR
+	editor string
+	noEdit bool
+}
+
+// fileEdit is a .curl file edited in interactive mode, its content as saved
+// and as the editor left it
+type fileEdit struct {
+	path     string
+	dir      string
+	original string
+	edited   string
+	// secrets maps the values of the environment's secret variables to their
+	// names, values that must not end up in the file
+	secrets map[string]string
+}
+
+// editSecrets returns the values of the variables of envVars, and of the OS
+// environment variables content references, named like secrets, mapped to
+// their names
+func editSecrets(content string, envVars run.Environment) map[string]string {
+	secrets := map[string]string{}
+	add := func(name, value string) {
+		if secretNamePattern.MatchString(name) && value != "" && value != placeholderValue {
+			secrets[value] = name
+		}
+	}
+	for name, value := range envVars {
+		add(name, value)
+	}
+	for _, match := range run.OSEnvRefPattern.FindAllStringSubmatch(content, -1) {
+		add(match[1], os.Getenv(match[1]))
+	}
+	return secrets
+}
+
+// editedVariables returns the variables the edited content assigns a value
+// the original doesn't, edits that win over the environments
+func editedVariables(original, edited string) map[string]bool {
+	saved := map[string]string{}
+	for _, v := range resolveFileVariables(original) {
+		saved[v.name] = v.value
+	}
+	names := map[string]bool{}
+	for _, v := range resolveFileVariables(edited) {
+		if value, ok := saved[v.name]; !ok || value != v.value {
+			names[v.name] = true
+		}
+	}
+	return names
+}
+
+// checkSecrets fails when the edits write a secret of the environment into
+// the file, like a token pasted into it
+func (e *fileEdit) checkSecrets() error {
+	var leaked []string
+	for value, name := range e.secrets {
+		if strings.Contains(e.edited, value) && !strings.Contains(e.original, value) {
+			leaked = append(leaked, name)
+		}
+	}
+	if len(leaked) == 0 {
+		return nil
+	}
+	sort.Strings(leaked)
+	return fmt.Errorf("the edits write the value of %s from the environment into it", strings.Join(leaked, ", "))
+}
+
+// findEditor returns the words of the editor command: flag, $VISUAL or
+// $EDITOR, whichever is set first, split like the shell would so it can take
+// arguments, or else the first of fallbackEditors installed. It returns
+// errNoEditor when there is none
+func findEditor(flag string) ([]string, error) {
+	for _, source := range []struct{ name, command string }{
+		{"--editor", flag},
+		{"$VISUAL", os.Getenv("VISUAL")},
+		{"$EDITOR", os.Getenv("EDITOR")},
+	} {
+		words := splitShellWords(source.command)
+		if len(words) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(words[0]); err != nil {
+			return nil, fmt.Errorf("the editor %s names, %s, isn't installed: %w", source.name, words[0], errNoEditor)
+		}
+		return words, nil
+	}
+	for _, editor := range fallbackEditors {
+		if _, err := exec.LookPath(editor); err == nil {
+			return []string{editor}, nil
+		}
+	}
+	return nil, errNoEditor
+}
+
+// offerRunUnedited asks whether to run the file at path as saved when it
+// can't be edited for err, when ask, and otherwise fails with err
+func offerRunUnedited(in io.Reader, out io.Writer, path string, err error, ask bool) error {
+	if !ask {
+		return fmt.Errorf("%w; or pass --no-edit to run files as saved", err)
+	}
+	fmt.Fprintf(out, "Warning: %v\n", err)
+	fmt.Fprintf(out, "Run %s as saved? [y/N] ", path)
+	answer, readErr := bufio.NewReader(in).ReadString('\n')
+	if readErr != nil && readErr != io.EOF {
+		return fmt.Errorf("failed to read answer: %w", readErr)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return err
+}
+
+// editInEditor opens a copy of content, the file at path, in editor, the
+// words of the command findEditor found, and returns it as the editor left
+// it. The copy is named after the file, in the system temp directory so curly
+// instances editing the same file don't clash, and is removed even when curly
+// is interrupted
+func editInEditor(path string, content []byte, editor []string) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "curly-*-"+filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	// An interrupt stops the editor, so the copy is removed on the way out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	editCmd := exec.CommandContext(ctx, editor[0], append(editor[1:], tmp.Name())...)
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err := editCmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New("interrupted while editing, nothing was sent")
+		}
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file after editing: %w", err)
+	}
+	return edited, nil
+}
+
+// keepLastEdit writes content, as the editor left it, to .curly/last-edit.curl
+// in dir, readable by the user only
+func keepLastEdit(dir, content string) error {
+	path := filepath.Join(dir, filepath.FromSlash(lastEditFile))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to keep the edited file: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to keep the edited file: %w", err)
+	}
+	return nil
+}
+
+// offerSaveEdits writes the edits of e back to its file, with save or when
+// the collection always saves them, and otherwise asks first when ask. Edits
+// that would write a secret of the environment are never saved
+func offerSaveEdits(in io.Reader, out io.Writer, e *fileEdit, save, ask bool) error {
+	if e == nil {
+		return nil
+	}
+	if err := e.checkSecrets(); err != nil {
+		fmt.Fprintf(out, "Warning: not saving the edits to %s, %v; they are kept in %s\n", e.path, err, filepath.Join(e.dir, filepath.FromSlash(lastEditFile)))
+		return nil
+	}
+
+	always := filepath.Join(e.dir, filepath.FromSlash(saveEditsFile))
+	if _, err := os.Stat(always); err == nil {
+		save = true
+	}
+	if !save {
+		if !ask {
+			return nil
+		}
+		fmt.Fprintf(out, "Save changes back to %s? [y/N/always] ", e.path)
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "always", "a":
+			if err := os.WriteFile(always, nil, 0600); err != nil {
+				return fmt.Errorf("failed to save edits from now on: %w", err)
+			}
+		default:
+			return nil
+		}
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(e.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(e.path, []byte(e.edited), mode); err != nil {
+		return fmt.Errorf("failed to save edits: %w", err)
+	}
+	fmt.Fprintf(out, "Saved to %s\n", e.path)
+	return nil
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestEditEndpointEditsOriginal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor is a shell script")
+	}
+	dir := t.TempDir()
+	original := "BASE_URL=\"http://localhost:8080\"\nTOKEN=\"VALUE\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" \"${BASE_URL}/users\""
+	writeFiles(t, dir, map[string]string{
+		"GET_users.curl": original,
+		"envs.yml":       "environments:\n  staging:\n    BASE_URL: \"https://staging.example.com\"\n    TOKEN: \"s3cr3t\"\n",
+	})
+	// The editor keeps what it was shown and where, and edits the path
+	editor := filepath.Join(t.TempDir(), "editor")
+	script := "#!/bin/sh\ncp \"$1\" \"$SHOWN\"\necho \"$1\" > \"$SHOWN.path\"\nsed 's#/users#/users?page=2#' \"$1\" > \"$1.new\" && mv \"$1.new\" \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+	shownPath := filepath.Join(t.TempDir(), "shown")
+	t.Setenv("SHOWN", shownPath)
+
+	opts := runOptions{envName: "staging", insecure: true, overrides: run.Environment{"BASE_URL": "https://other.example.com"}}
+	path := filepath.Join(dir, "GET_users.curl")
+	cmdText, edit, err := editEndpoint(path, dir, opts, editOptions{})
+	if err != nil {
+		t.Fatalf("editEndpoint() error = %v", err)
+	}
+	shown, _ := os.ReadFile(shownPath)
+	if string(shown) != original {
+		t.Errorf("the editor was shown:\n%s\nwant the file as saved:\n%s", shown, original)
+	}
+	tmpPath, _ := os.ReadFile(shownPath + ".path")
+	tmpFile := strings.TrimSpace(string(tmpPath))
+	if filepath.Dir(tmpFile) == dir || !strings.HasSuffix(tmpFile, "-GET_users.curl") {
+		t.Errorf("the editor opened %s, want a copy named after the file outside the collection", tmpFile)
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Errorf("the copy %s is still there", tmpFile)
+	}
+	for _, want := range []string{`BASE_URL="https://other.example.com"`, `TOKEN="s3cr3t"`, "curl -k -s", "/users?page=2"} {
+		if !strings.Contains(cmdText, want) {
+			t.Errorf("editEndpoint() = %q, want it to contain %s", cmdText, want)
+		}
+	}
+	if edit == nil || edit.path != path || edit.edited != strings.Replace(original, "/users", "/users?page=2", 1) {
+		t.Errorf("editEndpoint() edit = %+v, want the edit of the file", edit)
+	}
+	if kept, _ := os.ReadFile(filepath.Join(dir, ".curly", "last-edit.curl")); string(kept) != edit.edited {
+		t.Errorf("last edit = %q, want %q", kept, edit.edited)
+	}
+
+	// --no-edit runs the file as saved
+	t.Setenv("EDITOR", "false")
+	cmdText, edit, err = editEndpoint(path, dir, opts, editOptions{noEdit: true})
+	if err != nil || edit != nil || !strings.Contains(cmdText, `"${BASE_URL}/users"`) {
+		t.Errorf("editEndpoint() with --no-edit = %q, %+v, %v", cmdText, edit, err)
+	}
+}
+
+func TestEditEndpointEditedVariablesWin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor is a shell script")
+	}
+	dir := t.TempDir()
+	original := "BASE_URL=\"http://localhost:8080\"\nID=\"VALUE\"\ncurl -s \"${BASE_URL}/items/${ID}\""
+	writeFiles(t, dir, map[string]string{
+		"GET_item.curl": original,
+		"envs.yml":      "environments:\n  dev:\n    BASE_URL: \"https://dev.example.com\"\n    ID: \"1\"\n",
+	})
+	editor := filepath.Join(t.TempDir(), "editor")
+	script := "#!/bin/sh\nsed 's#^ID=.*#ID=\"42\"#' \"$1\" > \"$1.new\" && mv \"$1.new\" \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	opts := runOptions{envName: "dev", sources: run.Sources{}}
+	cmdText, edit, err := editEndpoint(filepath.Join(dir, "GET_item.curl"), dir, opts, editOptions{})
+	if err != nil {
+		t.Fatalf("editEndpoint() error = %v", err)
+	}
+	for _, want := range []string{`ID="42"`, `BASE_URL="https://dev.example.com"`} {
+		if !strings.Contains(cmdText, want) {
+			t.Errorf("editEndpoint() = %q, want it to contain %s", cmdText, want)
+		}
+	}
+	if got := opts.sources.Precedence("ID"); !reflect.DeepEqual(got, []string{run.SourceFile}) {
+		t.Errorf("ID set by %v, want the edited file", got)
+	}
+	if edit == nil || !strings.Contains(edit.edited, `ID="42"`) {
+		t.Errorf("editEndpoint() edit = %+v, want the edit of ID", edit)
+	}
+}
+
+func TestFindEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editors are shell scripts")
+	}
+	bin := t.TempDir()
+	for _, name := range []string{"code", "nano", "my editor"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// PATH holds nano but none of the editors before it
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name    string
+		flag    string
+		visual  string
+		editor  string
+		want    []string
+		wantErr string
+	}{
+		{name: "flag first", flag: "code --wait", visual: "nano", editor: "nano", want: []string{"code", "--wait"}},
+		{name: "VISUAL before EDITOR", visual: "code -w", editor: "nano", want: []string{"code", "-w"}},
+		{name: "EDITOR", editor: "nano", want: []string{"nano"}},
+		{name: "quoted path", editor: `"` + filepath.Join(bin, "my editor") + `" -n`, want: []string{filepath.Join(bin, "my editor"), "-n"}},
+		{name: "fallback", want: []string{"nano"}},
+		{name: "missing editor", editor: "vim", wantErr: "the editor $EDITOR names, vim, isn't installed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VISUAL", tt.visual)
+			t.Setenv("EDITOR", tt.editor)
+			got, err := findEditor(tt.flag)
+			if tt.wantErr != "" {
+				if !errors.Is(err, errNoEditor) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("findEditor() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findEditor() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if _, err := findEditor(""); err != errNoEditor {
+		t.Errorf("findEditor() without editors error = %v, want %v", err, errNoEditor)
+	}
+}
+
+func TestOfferRunUnedited(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		ask     bool
+		wantRun bool
+		wantErr string
+	}{
+		{name: "run as saved", answer: "y\n", ask: true, wantRun: true},
+		{name: "declined", answer: "n\n", ask: true, wantErr: "no editor found"},
+		{name: "no answer", answer: "", ask: true, wantErr: "no editor found"},
+		{name: "outside a terminal", answer: "y\n", wantErr: "pass --no-edit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := offerRunUnedited(strings.NewReader(tt.answer), &out, "GET_users.curl", errNoEditor, tt.ask)
+			if tt.wantRun && err != nil {
+				t.Errorf("offerRunUnedited() error = %v, want the file run as saved", err)
+			}
+			if !tt.wantRun && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("offerRunUnedited() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.ask && !strings.Contains(out.String(), "Run GET_users.curl as saved? [y/N]") {
+				t.Errorf("offerRunUnedited() asked %q", out.String())
+			}
+		})
+	}
+}
+
+func TestFileEditSecrets(t *testing.T) {
+	t.Setenv("API_KEY", "k-9876")
+	original := "TOKEN=\"VALUE\"\nKEY=\"${env:API_KEY}\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" -H \"X-Key: ${KEY}\" x"
+	secrets := editSecrets(original, run.Environment{"TOKEN": "s3cr3t", "BASE_URL": "http://localhost"})
+
+	tests := []struct {
+		name    string
+		edited  string
+		wantErr string
+	}{
+		{name: "own edits", edited: strings.Replace(original, "-s", "-sS", 1)},
+		{name: "environment's token pasted", edited: strings.Replace(original, "${TOKEN}", "s3cr3t", 1), wantErr: "TOKEN"},
+		{name: "OS secret pasted", edited: strings.Replace(original, "${env:API_KEY}", "k-9876", 1), wantErr: "API_KEY"},
+		{name: "other values pasted", edited: strings.Replace(original, " x", " http://localhost", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := &fileEdit{original: original, edited: tt.edited, secrets: secrets}
+			err := edit.checkSecrets()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkSecrets() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkSecrets() error = %v, want %s refused", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOfferSaveEdits(t *testing.T) {
+	tests := []struct {
+		name       string
+		answer     string
+		save       bool
+		wantSaved  bool
+		wantAlways bool
+	}{
+		{name: "declined", answer: "n\n"},
+		{name: "no answer", answer: ""},
+		{name: "accepted", answer: "y\n", wantSaved: true},
+		{name: "always", answer: "always\n", wantSaved: true, wantAlways: true},
+		{name: "--save-edits", save: true, wantSaved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "GET_users.curl")
+			original := "ID=\"1\"\ncurl -s \"x/users/${ID}\""
+			if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+				t.Fatal(err)
+			}
+			edited := strings.Replace(original, "-s", "-sS", 1)
+			if err := keepLastEdit(dir, edited); err != nil {
+				t.Fatal(err)
+			}
+			edit := &fileEdit{path: path, dir: dir, original: original, edited: edited}
+
+			var out bytes.Buffer
+			if err := offerSaveEdits(strings.NewReader(tt.answer), &out, edit, tt.save, true); err != nil {
+				t.Fatalf("offerSaveEdits() error = %v", err)
+			}
+			content, _ := os.ReadFile(path)
+			want := original
+			if tt.wantSaved {
+				want = edited
+			}
+			if string(content) != want {
+				t.Errorf("file =\n%s\nwant:\n%s", content, want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, ".curly", "save-edits")); (err == nil) != tt.wantAlways {
+				t.Errorf("collection saves edits from now on = %v, want %v", err == nil, tt.wantAlways)
+			}
+		})
+	}
+}
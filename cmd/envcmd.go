@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// envCommandOutputs caches the output of each $(...) command in envs.yml
+// values, so a command runs at most once per invocation, and records the
+// values of the variables resolved by running one, which are secrets
+// whatever their name
+var envCommandOutputs = struct {
+	sync.Mutex
+	values   map[string]string
+	resolved map[string]string
+}{values: map[string]string{}, resolved: map[string]string{}}
+
+// isEnvCommandValue reports whether value is the value of the variable name
+// resolved by running a command of envs.yml
+func isEnvCommandValue(name, value string) bool {
+	envCommandOutputs.Lock()
+	defer envCommandOutputs.Unlock()
+	resolved, ok := envCommandOutputs.resolved[name]
+	return ok && resolved == value
+}
+
+// resolveEnvCommands runs the $(...) command substitutions in the values of
+// the variables the file content references and substitutes their output,
+// escaped for the double-quoted assignment it ends up in. Values of
+// unreferenced variables are left alone and their commands never run
+func resolveEnvCommands(vars run.Environment, content string, opts runOptions) (run.Environment, error) {
+	keys := make([]string, 0, len(vars))
+	for key, value := range vars {
+		if commandSubstitutionStart(value) >= 0 && referencesVariable(content, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return vars, nil
+	}
+	sort.Strings(keys)
+
+	if opts.noExecEnv {
+		return nil, fmt.Errorf("environment value for %s runs a command, which --no-exec-env disallows", keys[0])
+	}
+
+	resolved := run.Environment{}
+	for key, value := range vars {
+		resolved[key] = value
+	}
+	for _, key := range keys {
+		value, err := expandCommandSubstitutions(vars[key], func(command string) (string, error) {
+			output, err := runEnvCommand(command)
+			if err != nil {
+				return "", fmt.Errorf("command for environment value %s failed: %w", key, err)
+			}
+			return shellquote.EscapeDoubleQuoted(output), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The outputs are cached, so this runs no command again
+		raw, err := expandCommandSubstitutions(vars[key], runEnvCommand)
+		if err != nil {
+			return nil, err
+		}
+		if opts.verbose {
+			// Only the key is printed, the value is a secret
+			fmt.Fprintf(os.Stderr, "Resolved %s by running its command\n", key)
+		}
+		envCommandOutputs.Lock()
+		envCommandOutputs.resolved[key] = raw
+		envCommandOutputs.Unlock()
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// referencesVariable reports whether content assigns or expands key
+func referencesVariable(content, key string) bool {
+	for _, name := range run.FileVariables(content) {
+		if name == key {
+			return true
+		}
+	}
+	pattern := regexp.MustCompile(`\$(\{` + regexp.QuoteMeta(key) + `[}:]|` + regexp.QuoteMeta(key) + `\b)`)
+	return pattern.MatchString(content)
+}
+
+// commandSubstitutionStart returns the index of the first $( in value that
+// isn't escaped as \$(, like the literal values of .env files are, or -1
+func commandSubstitutionStart(value string) int {
+	offset := 0
+	for {
+		i := strings.Index(value[offset:], "$(")
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		backslashes := 0
+		for j := i - 1; j >= 0 && value[j] == '\\'; j-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return i
+		}
+		offset = i + 2
+	}
+}
+
+// expandCommandSubstitutions replaces every unescaped $(...) in value,
+// matching nested parentheses, with the result of run
+func expandCommandSubstitutions(value string, run func(command string) (string, error)) (string, error) {
+	var out strings.Builder
+	for {
+		start := commandSubstitutionStart(value)
+		if start < 0 {
+			out.WriteString(value)
+			return out.String(), nil
+		}
+
+		depth, end := 0, -1
+		for i := start + 1; i < len(value) && end < 0; i++ {
+			switch value[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("unterminated $( in %q", value)
+		}
+
+		output, err := run(value[start+2 : end])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value[:start])
+		out.WriteString(output)
+		value = value[end+1:]
+	}
+}
+
+// runEnvCommand runs a command with sh -c, returning its output without
+// trailing newlines like the shell's $(...) would. A failure carries the
+// command's stderr
+func runEnvCommand(command string) (string, error) {
+	envCommandOutputs.Lock()
+	defer envCommandOutputs.Unlock()
+	if output, ok := envCommandOutputs.values[command]; ok {
+		return output, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd, err := shellCommand(context.Background(), command)
+	if err != nil {
+		return "", err
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	output := strings.TrimRight(stdout.String(), "\n")
+	envCommandOutputs.values[command] = output
+	return output, nil
+}
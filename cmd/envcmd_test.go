@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestResolveEnvCommands(t *testing.T) {
+	content := `# Variables
+TOKEN="VALUE"
+AUTH="VALUE"
+
+curl -s -H "X-User: ${USER_NAME}" "http://localhost"
+`
+
+	tests := []struct {
+		name    string
+		vars    run.Environment
+		opts    runOptions
+		want    run.Environment
+		wantErr string
+	}{
+		{
+			name: "command output is substituted",
+			vars: run.Environment{"TOKEN": "$(printf 'abc\n\n')"},
+			want: run.Environment{"TOKEN": "abc"},
+		},
+		{
+			name: "embedded and nested commands",
+			vars: run.Environment{"AUTH": "Bearer $(echo $(printf inner)-outer)", "USER_NAME": "$(printf bob)"},
+			want: run.Environment{"AUTH": "Bearer inner-outer", "USER_NAME": "bob"},
+		},
+		{
+			name: "output is escaped for a double-quoted assignment",
+			vars: run.Environment{"TOKEN": `$(printf '%s' 'a"$b')`},
+			want: run.Environment{"TOKEN": `a\"\$b`},
+		},
+		{
+			name: "plain values are untouched",
+			vars: run.Environment{"TOKEN": "literal"},
+			want: run.Environment{"TOKEN": "literal"},
+		},
+		{
+			name: "escaped commands are literal",
+			vars: run.Environment{"TOKEN": `\$(printf abc) \\$(printf def)`, "AUTH": `\$(exit 1)`},
+			want: run.Environment{"TOKEN": `\$(printf abc) \\def`, "AUTH": `\$(exit 1)`},
+		},
+		{
+			name:    "failure carries stderr",
+			vars:    run.Environment{"TOKEN": "$(echo 'vault: permission denied' >&2; exit 3)"},
+			wantErr: "command for environment value TOKEN failed: exit status 3: vault: permission denied",
+		},
+		{
+			name:    "no-exec-env refuses commands",
+			vars:    run.Environment{"TOKEN": "$(printf abc)"},
+			opts:    runOptions{noExecEnv: true},
+			wantErr: "environment value for TOKEN runs a command, which --no-exec-env disallows",
+		},
+		{
+			name: "no-exec-env ignores unreferenced commands",
+			vars: run.Environment{"UNUSED": "$(printf abc)", "TOKEN": "literal"},
+			opts: runOptions{noExecEnv: true},
+			want: run.Environment{"UNUSED": "$(printf abc)", "TOKEN": "literal"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveEnvCommands(tt.vars, content, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveEnvCommands() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveEnvCommands() error = %v", err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("resolveEnvCommands()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveEnvCommandsRunsOnlyReferencedOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	counter := filepath.Join(tmpDir, "runs")
+	unused := filepath.Join(tmpDir, "unused")
+
+	command := "$(echo run >> " + counter + "; printf token)"
+	vars := run.Environment{
+		"TOKEN":  command,
+		"OTHER":  command,
+		"UNUSED": "$(touch " + unused + ")",
+	}
+	content := "TOKEN=\"VALUE\"\ncurl -H \"X: ${OTHER}\" http://localhost\n"
+
+	for range 2 {
+		got, err := resolveEnvCommands(vars, content, runOptions{})
+		if err != nil {
+			t.Fatalf("resolveEnvCommands() error = %v", err)
+		}
+		if got["TOKEN"] != "token" || got["OTHER"] != "token" {
+			t.Errorf("resolveEnvCommands() = %v, want TOKEN and OTHER resolved", got)
+		}
+	}
+
+	data, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatalf("command never ran: %v", err)
+	}
+	if runs := strings.Count(string(data), "run"); runs != 1 {
+		t.Errorf("command ran %d times, want once per invocation", runs)
+	}
+	if _, err := os.Stat(unused); !os.IsNotExist(err) {
+		t.Error("command for an unreferenced variable was run")
+	}
+}
+
+func TestResolveEnvCommandsVerboseHidesSecret(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	_, resolveErr := resolveEnvCommands(run.Environment{"TOKEN": "$(printf super-secret-value)"}, "TOKEN=\"\"\n", runOptions{verbose: true})
+	os.Stderr = stderr
+	w.Close()
+	if resolveErr != nil {
+		t.Fatalf("resolveEnvCommands() error = %v", resolveErr)
+	}
+
+	out, _ := io.ReadAll(r)
+	if !strings.Contains(string(out), "TOKEN") {
+		t.Errorf("verbose output should name the resolved key, got %q", out)
+	}
+	if strings.Contains(string(out), "super-secret-value") {
+		t.Errorf("verbose output leaked the secret: %q", out)
+	}
+}
+
+func TestRunFileExecutesEnvCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	envs := `environments:
+  dev:
+    AUTHORIZATION: "Bearer $(printf from-vault)"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatalf("failed to write envs.yml: %v", err)
+	}
+	curlFile := filepath.Join(tmpDir, "GET_me.curl")
+	content := `# Variables
+AUTHORIZATION="VALUE"
+
+curl -s -H "Authorization: ${AUTHORIZATION}" "http://localhost/me"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{envName: "dev"})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if !strings.Contains(cmdText, `AUTHORIZATION="Bearer from-vault"`) {
+		t.Errorf("runFile() did not substitute the command output, got:\n%s", cmdText)
+	}
+
+	if _, err := runFile(curlFile, tmpDir, runOptions{envName: "dev", noExecEnv: true}); err == nil || !strings.Contains(err.Error(), "--no-exec-env") {
+		t.Errorf("runFile() with noExecEnv error = %v, want a refusal", err)
+	}
+}
+
+func TestEnvCommandValuesAreRedacted(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	t.Setenv("HOME", t.TempDir())
+	server := echoServer(t)
+	dir := t.TempDir()
+	// CRED isn't named like a secret, running a command makes it one
+	writeFiles(t, dir, map[string]string{
+		"envs.yml":       "environments:\n  dev:\n    CRED: \"$(echo hidden-value)\"\n",
+		"GET_creds.curl": "CRED=\"VALUE\"\ncurl -s -H \"X-Cred: ${CRED}\" \"" + server.URL + "/creds\"\n",
+	})
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "verbose", args: []string{"-v"}},
+		{name: "show-vars", args: []string{"--show-vars"}},
+		{name: "dry-run", args: []string{"--dry-run"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderrFile, err := os.CreateTemp(t.TempDir(), "stderr")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.SetArgs(append([]string{dir, "-e", "dev", "-f", filepath.Join(dir, "GET_creds.curl")}, tt.args...))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			stderr := os.Stderr
+			os.Stderr = stderrFile
+			err = cmd.Execute()
+			os.Stderr = stderr
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			printed, _ := os.ReadFile(stderrFile.Name())
+			printed = append(printed, out.Bytes()...)
+			if strings.Contains(string(printed), "hidden-value") {
+				t.Errorf("output leaked the value of the command:\n%s", printed)
+			}
+			if !strings.Contains(string(printed), redactedValue) {
+				t.Errorf("output:\n%s\nwant the value redacted", printed)
+			}
+		})
+	}
+}
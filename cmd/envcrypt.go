@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// encryptAge encrypts plaintext for recipients, armored so it diffs as text
+func encryptAge(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	var out bytes.Buffer
+	armored := armor.NewWriter(&out)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ageRecipients parses the age public keys of keys or, without any, returns
+// those of the keys run.AgeIdentities finds
+func ageRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", key, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if len(recipients) > 0 {
+		return recipients, nil
+	}
+	identities, err := run.AgeIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("pass --recipient or %w", err)
+	}
+	for _, id := range identities {
+		if x, ok := id.(*age.X25519Identity); ok {
+			recipients = append(recipients, x.Recipient())
+		}
+	}
+	return recipients, nil
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// writeEncryptedEnvs writes content to envs.enc.yml in dir, encrypted for
+// identity
+func writeEncryptedEnvs(t *testing.T, dir, content string, identity *age.X25519Identity) {
+	t.Helper()
+	encrypted, err := encryptAge([]byte(content), []age.Recipient{identity.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, run.EncryptedEnvsFile), encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadEncryptedEnvConfig(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("# created: today\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	plain := "environments:\n  dev:\n    BASE_URL: \"http://localhost:8080\"\n    TOKEN: \"VALUE\"\n    auth:\n      token_url: \"https://auth.example.com/token\"\n      client_id: \"curly\"\n"
+	secrets := "environments:\n  dev:\n    TOKEN: \"s3cr3t\"\n    auth:\n      client_secret: \"hush\"\n  ci:\n    TOKEN: \"ci-token\"\n"
+
+	tests := []struct {
+		name      string
+		plain     string
+		encrypted string
+		corrupt   bool
+		key       string
+		keyFile   string
+		want      map[string]run.Environment
+		wantAuth  *run.AuthConfig
+		wantErr   string
+		wantNoKey bool
+	}{
+		{
+			name:      "encrypted values win",
+			plain:     plain,
+			encrypted: secrets,
+			key:       identity.String(),
+			want: map[string]run.Environment{
+				"dev": {"BASE_URL": "http://localhost:8080", "TOKEN": "s3cr3t"},
+				"ci":  {"TOKEN": "ci-token"},
+			},
+			wantAuth: &run.AuthConfig{TokenURL: "https://auth.example.com/token", ClientID: "curly", ClientSecret: "hush"},
+		},
+		{
+			name:      "key from SOPS_AGE_KEY_FILE",
+			plain:     plain,
+			encrypted: secrets,
+			keyFile:   keyFile,
+			want: map[string]run.Environment{
+				"dev": {"BASE_URL": "http://localhost:8080", "TOKEN": "s3cr3t"},
+				"ci":  {"TOKEN": "ci-token"},
+			},
+		},
+		{
+			name:      "encrypted file alone",
+			encrypted: secrets,
+			key:       identity.String(),
+			want:      map[string]run.Environment{"dev": {"TOKEN": "s3cr3t"}, "ci": {"TOKEN": "ci-token"}},
+		},
+		{
+			name:  "plaintext alone needs no key",
+			plain: "environments:\n  dev:\n    TOKEN: \"t\"\n",
+			want:  map[string]run.Environment{"dev": {"TOKEN": "t"}},
+		},
+		{
+			name:      "missing key",
+			plain:     plain,
+			encrypted: secrets,
+			wantErr:   "envs.enc.yml is encrypted: no age key",
+			wantNoKey: true,
+		},
+		{
+			name:      "key of someone else",
+			plain:     plain,
+			encrypted: secrets,
+			key:       other.String(),
+			wantErr:   "envs.enc.yml is encrypted for other keys",
+			wantNoKey: true,
+		},
+		{
+			name:      "corrupt file",
+			plain:     plain,
+			encrypted: secrets,
+			corrupt:   true,
+			key:       identity.String(),
+			wantErr:   "envs.enc.yml is corrupt",
+		},
+		{
+			name:    "sops without sops installed",
+			plain:   "environments:\n  dev:\n    TOKEN: ENC[AES256_GCM,data:abc,type:str]\nsops:\n  mac: ENC[AES256_GCM,data:def,type:str]\n  version: 3.8.1\n",
+			wantErr: "envs.yml is encrypted with sops, which isn't installed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CURLY_AGE_KEY", tt.key)
+			t.Setenv("SOPS_AGE_KEY_FILE", tt.keyFile)
+			t.Setenv("PATH", t.TempDir())
+			dir := t.TempDir()
+			if tt.plain != "" {
+				writeFiles(t, dir, map[string]string{"envs.yml": tt.plain})
+			}
+			if tt.encrypted != "" {
+				writeEncryptedEnvs(t, dir, tt.encrypted, identity)
+			}
+			if tt.corrupt {
+				path := filepath.Join(dir, run.EncryptedEnvsFile)
+				data, _ := os.ReadFile(path)
+				lines := strings.Split(string(data), "\n")
+				lines[len(lines)/2] = strings.Repeat("A", len(lines[len(lines)/2]))
+				os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+			}
+
+			config, err := run.LoadEnvConfig(filepath.Join(dir, "envs.yml"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadEnvConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				if errors.Is(err, run.ErrNoAgeKey) != tt.wantNoKey {
+					t.Errorf("loadEnvConfig() error = %v, missing key = %v, want %v", err, !tt.wantNoKey, tt.wantNoKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadEnvConfig() error = %v", err)
+			}
+			for name, want := range tt.want {
+				got := config.Environments[name]
+				if len(got) != len(want) {
+					t.Errorf("environment %s = %v, want %v", name, got, want)
+				}
+				for k, v := range want {
+					if got[k] != v {
+						t.Errorf("environment %s: %s = %q, want %q", name, k, got[k], v)
+					}
+				}
+			}
+			if tt.wantAuth != nil && !reflect.DeepEqual(config.Auth["dev"], tt.wantAuth) {
+				t.Errorf("auth = %+v, want %+v", config.Auth["dev"], tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestEnvsEncryptDecrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("CURLY_AGE_KEY", identity.String())
+	dir := t.TempDir()
+	plain := "environments:\n  dev:\n    TOKEN: \"s3cr3t\"\n"
+	writeFiles(t, dir, map[string]string{"envs.yml": plain})
+
+	envs := func(args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		cmd := NewEnvsCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(&out)
+		cmd.SetErr(&bytes.Buffer{})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("envs %v error = %v", args, err)
+		}
+		return out.String()
+	}
+
+	envs("encrypt", dir, "--recipient", identity.Recipient().String())
+	encrypted, err := os.ReadFile(filepath.Join(dir, run.EncryptedEnvsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encrypted), "s3cr3t") || !strings.HasPrefix(string(encrypted), "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Errorf("envs.enc.yml =\n%s\nwant it armored and encrypted", encrypted)
+	}
+	if got := envs("decrypt", dir); got != plain {
+		t.Errorf("envs decrypt = %q, want %q", got, plain)
+	}
+
+	// Without --recipient the file is encrypted for the key of CURLY_AGE_KEY
+	os.Remove(filepath.Join(dir, "envs.yml"))
+	writeFiles(t, dir, map[string]string{"envs.yml": "environments:\n  dev:\n    TOKEN: \"rotated\"\n"})
+	envs("encrypt", dir)
+	os.Remove(filepath.Join(dir, "envs.yml"))
+	if got := envs("show", "dev", dir, "--show-secrets"); !strings.Contains(got, "rotated") {
+		t.Errorf("envs show = %q, want the encrypted environment", got)
+	}
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// unsetValue stands for a variable an environment doesn't set in curly envs
+// diff
+const unsetValue = "(unset)"
+
+func NewEnvsCmd() *cobra.Command {
+	var envsFile string
+	var showSecrets bool
+
+	// load reads the envs.yml of the collection in the optional last of args,
+	// or --envs-file
+	load := func(args []string, n int) (*run.EnvConfig, error) {
+		dir := "."
+		if len(args) > n {
+			dir = args[n]
+		}
+		path := envsFile
+		if path == "" {
+			path = filepath.Join(dir, "envs.yml")
+		}
+		config, err := run.LoadEnvConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", filepath.Base(path), err)
+		}
+		return config, nil
+	}
+
+	cmd := &cobra.Command{
+		Use:               "envs [collection-dir]",
+		Short:             "List the environments of envs.yml with how many variables each sets",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := load(args, 0)
+			if err != nil {
+				return err
+			}
+			listEnvironments(cmd.OutOrStdout(), config)
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&envsFile, "envs-file", "", "Read the environments from this file instead of the collection's envs.yml")
+
+	show := &cobra.Command{
+		Use:               "show <env> [collection-dir]",
+		Short:             "Print the variables an environment sets, with its secrets masked",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeEnvsArgs(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := load(args, 1)
+			if err != nil {
+				return err
+			}
+			return showEnvironment(cmd.OutOrStdout(), config, args[0], showSecrets)
+		},
+	}
+	show.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print the values of secrets instead of masking them")
+
+	diff := &cobra.Command{
+		Use:               "diff <env> <other-env> [collection-dir]",
+		Short:             "Print the variables set by only one of two environments or to different values",
+		Args:              cobra.RangeArgs(2, 3),
+		ValidArgsFunction: completeEnvsArgs(2),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := load(args, 2)
+			if err != nil {
+				return err
+			}
+			return diffEnvironments(cmd.OutOrStdout(), config, args[0], args[1], showSecrets)
+		},
+	}
+	diff.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print the values of secrets instead of masking them")
+
+	var recipients []string
+	encrypt := &cobra.Command{
+		Use:               "encrypt [collection-dir]",
+		Short:             "Encrypt envs.yml with age to envs.enc.yml, which can be committed",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			path := envsFile
+			if path == "" {
+				path = filepath.Join(dir, "envs.yml")
+			}
+			return encryptEnvsFile(cmd.OutOrStdout(), path, recipients)
+		},
+	}
+	encrypt.Flags().StringArrayVar(&recipients, "recipient", nil, "Encrypt for this age public key, like age1... (repeatable; default: the keys of CURLY_AGE_KEY and SOPS_AGE_KEY_FILE)")
+
+	decrypt := &cobra.Command{
+		Use:               "decrypt [collection-dir]",
+		Short:             "Print envs.enc.yml decrypted, without writing it to disk",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			if envsFile != "" {
+				dir = filepath.Dir(envsFile)
+			}
+			path := filepath.Join(dir, run.EncryptedEnvsFile)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			plaintext, err := run.DecryptAge(path, data)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(plaintext)
+			return err
+		},
+	}
+
+	cmd.AddCommand(show, diff, encrypt, decrypt)
+	return cmd
+}
+
+// encryptEnvsFile encrypts the envs.yml at path with age for recipients to
+// the envs.enc.yml next to it
+func encryptEnvsFile(out io.Writer, path string, recipients []string) error {
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config run.EnvConfig
+	if err := yaml.Unmarshal(plaintext, &config); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	parsed, err := ageRecipients(recipients)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptAge(plaintext, parsed)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", filepath.Base(path), err)
+	}
+	encPath := filepath.Join(filepath.Dir(path), run.EncryptedEnvsFile)
+	if err := os.WriteFile(encPath, encrypted, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Encrypted %s to %s; keep %s itself out of version control\n", path, encPath, filepath.Base(path))
+	return nil
+}
+
+// listEnvironments prints the environments of config by name, with how many
+// variables each sets and whether it has auth and tls blocks
+func listEnvironments(out io.Writer, config *run.EnvConfig) {
+	if len(config.Environments) == 0 {
+		fmt.Fprintln(out, "No environments")
+		return
+	}
+	names := make([]string, 0, len(config.Environments))
+	for name := range config.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		count := len(config.Environments[name])
+		line := fmt.Sprintf("%s\t%d variable", name, count)
+		if count != 1 {
+			line += "s"
+		}
+		if config.Auth[name] != nil {
+			line += "\tauth"
+		}
+		if config.TLS[name] != nil {
+			line += "\ttls"
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
+
+// environmentVariables returns the variables environment name of config sets,
+// with the fields of its auth block as auth.token_url and the like
+func environmentVariables(config *run.EnvConfig, name string) (run.Environment, error) {
+	env, ok := config.Environments[name]
+	if !ok {
+		names := make([]string, 0, len(config.Environments))
+		for n := range config.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment '%s' not found in envs.yml, it has %s", name, strings.Join(names, ", "))
+	}
+	vars := run.Environment{}
+	for k, v := range env {
+		vars[k] = v
+	}
+	if auth := config.Auth[name]; auth != nil {
+		vars["auth.token_url"] = auth.TokenURL
+		vars["auth.client_id"] = auth.ClientID
+		vars["auth.client_secret"] = auth.ClientSecret
+		if len(auth.Scopes) > 0 {
+			vars["auth.scopes"] = strings.Join(auth.Scopes, " ")
+		}
+	}
+	return vars, nil
+}
+
+// maskEnvValue returns value, or **** for the value of a variable named like
+// a secret or of the client secret of the auth block, unless showSecrets
+func maskEnvValue(name, value string, showSecrets bool) string {
+	secret := secretNamePattern.MatchString(name)
+	if strings.HasPrefix(name, "auth.") {
+		secret = name == "auth.client_secret"
+	}
+	if showSecrets || !secret || value == "" || value == placeholderValue {
+		return value
+	}
+	return redactedValue
+}
+
+// showEnvironment prints the variables environment name of config sets, by
+// name, their secrets masked unless showSecrets
+func showEnvironment(out io.Writer, config *run.EnvConfig, name string, showSecrets bool) error {
+	vars, err := environmentVariables(config, name)
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		fmt.Fprintf(out, "%s sets no variables\n", name)
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, k := range sortedKeys(vars) {
+		fmt.Fprintf(w, "%s\t%s\n", k, maskEnvValue(k, vars[k], showSecrets))
+	}
+	return w.Flush()
+}
+
+// diffEnvironments prints a table of the variables environments a and b of
+// config don't both set to the same value, with their values in each, their
+// secrets masked unless showSecrets
+func diffEnvironments(out io.Writer, config *run.EnvConfig, a, b string, showSecrets bool) error {
+	varsA, err := environmentVariables(config, a)
+	if err != nil {
+		return err
+	}
+	varsB, err := environmentVariables(config, b)
+	if err != nil {
+		return err
+	}
+
+	both := run.Environment{}
+	for k, v := range varsA {
+		both[k] = v
+	}
+	for k, v := range varsB {
+		both[k] = v
+	}
+	var rows []string
+	for _, k := range sortedKeys(both) {
+		valueA, inA := varsA[k]
+		valueB, inB := varsB[k]
+		if inA && inB && valueA == valueB {
+			continue
+		}
+		valueA, valueB = maskEnvValue(k, valueA, showSecrets), maskEnvValue(k, valueB, showSecrets)
+		if !inA {
+			valueA = unsetValue
+		}
+		if !inB {
+			valueB = unsetValue
+		}
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%s", k, valueA, valueB))
+	}
+	if len(rows) == 0 {
+		fmt.Fprintf(out, "%s and %s set the same variables\n", a, b)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "VARIABLE\t%s\t%s\n", a, b)
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testEnvsYAML = `environments:
+  dev:
+    BASE_URL: "http://localhost:8080"
+    API_TOKEN: "dev-token"
+    USER_ID: "1"
+  staging:
+    BASE_URL: "https://staging.example.com"
+    API_TOKEN: "staging-token"
+    USER_ID: "1"
+    TENANT: "acme"
+    auth:
+      token_url: "https://auth.example.com/token"
+      client_id: "curly"
+      client_secret: "hush"
+  empty: {}
+`
+
+func TestEnvsCmd(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"envs.yml":       testEnvsYAML,
+		"other/envs.yml": "environments:\n  prod:\n    BASE_URL: \"https://api.example.com\"\n",
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+		wantErr string
+	}{
+		{
+			name: "list",
+			args: []string{dir},
+			want: []string{"dev      3 variables", "empty    0 variables", "staging  4 variables  auth"},
+		},
+		{
+			name: "--envs-file",
+			args: []string{dir, "--envs-file", filepath.Join(dir, "other", "envs.yml")},
+			want: []string{"prod  1 variable"},
+		},
+		{
+			name:    "show masks secrets",
+			args:    []string{"show", "staging", dir},
+			want:    []string{"API_TOKEN           ****", "BASE_URL            https://staging.example.com", "auth.client_secret  ****", "auth.token_url      https://auth.example.com/token"},
+			notWant: []string{"staging-token", "hush"},
+		},
+		{
+			name: "show --show-secrets",
+			args: []string{"show", "dev", dir, "--show-secrets"},
+			want: []string{"API_TOKEN  dev-token", "USER_ID    1"},
+		},
+		{
+			name: "diff",
+			args: []string{"diff", "dev", "staging", dir},
+			want: []string{
+				"VARIABLE            dev                    staging",
+				"API_TOKEN           ****                   ****",
+				"BASE_URL            http://localhost:8080  https://staging.example.com",
+				"TENANT              (unset)                acme",
+				"auth.client_id      (unset)                curly",
+			},
+			notWant: []string{"USER_ID", "dev-token"},
+		},
+		{
+			name: "diff of the same variables",
+			args: []string{"diff", "dev", "dev", dir},
+			want: []string{"dev and dev set the same variables"},
+		},
+		{
+			name:    "unknown environment",
+			args:    []string{"show", "prod", dir},
+			wantErr: "environment 'prod' not found in envs.yml, it has dev, empty, staging",
+		},
+		{
+			name:    "no envs.yml",
+			args:    []string{t.TempDir()},
+			wantErr: "failed to load envs.yml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := NewEnvsCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			err := cmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output:\n%s\nwant it to contain %q", out.String(), want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output:\n%s\nwant it not to contain %q", out.String(), notWant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// maxBodyExcerpt is how much of a response body failed expectations quote
+const maxBodyExcerpt = 200
+
+// expectations are what the last response of a run has to look like for the
+// run to pass, from --expect-* flags or expect-* comments in the .curl file
+type expectations struct {
+	// statuses are the statuses or classes the status has to match one of
+	statuses []statusPattern
+	// bodyContains are strings the body has to contain
+	bodyContains []string
+	// json are jq expressions that have to hold for the body
+	json []string
+}
+
+// empty reports whether nothing is expected
+func (e expectations) empty() bool {
+	return len(e.statuses) == 0 && !e.needsBody()
+}
+
+// needsBody reports whether checking e looks at the response body
+func (e expectations) needsBody() bool {
+	return len(e.bodyContains) > 0 || len(e.json) > 0
+}
+
+// merge adds the expectations of flags to e, the statuses of flags replacing
+// those of e when there are any
+func (e expectations) merge(flags expectations) expectations {
+	if len(flags.statuses) > 0 {
+		e.statuses = flags.statuses
+	}
+	e.bodyContains = append(e.bodyContains, flags.bodyContains...)
+	e.json = append(e.json, flags.json...)
+	return e
+}
+
+// parseExpectations reads the expect-* comments of a .curl file, like
+//
+//	# expect-status: 200
+//	# expect-body-contains: "status":"ok"
+//	# expect-json: .status == "ok"
+func parseExpectations(content string) (expectations, error) {
+	var e expectations
+	lines := strings.Split(content, "\n")
+	inBody := run.HeredocBodies(lines)
+	for n, line := range lines {
+		if inBody[n] {
+			continue
+		}
+		comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(comment), ":")
+		if !ok || !strings.HasPrefix(key, "expect-") || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "expect-status":
+			patterns, err := parseStatusPatterns(value)
+			if err != nil {
+				return e, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			e.statuses = append(e.statuses, patterns...)
+		case "expect-body-contains":
+			e.bodyContains = append(e.bodyContains, value)
+		case "expect-json":
+			e.json = append(e.json, value)
+		default:
+			return e, fmt.Errorf("line %d: unknown expectation %q, expected expect-status, expect-body-contains or expect-json", n+1, key)
+		}
+	}
+	return e, nil
+}
+
+// fileExpectations reads the expectations of the .curl file at path, if
+// there is one
+func fileExpectations(path string) (expectations, error) {
+	if path == "" {
+		return expectations{}, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return expectations{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	e, err := parseExpectations(string(content))
+	if err != nil {
+		return e, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// checkJQ makes sure the expect-json expressions can be evaluated
+func (e expectations) checkJQ() error {
+	for _, expr := range e.json {
+		if err := checkJQ(expr); err != nil {
+			return fmt.Errorf("expect-json: %w", err)
+		}
+	}
+	return nil
+}
+
+// check returns an error describing every expectation the response with the
+// given statuses, of which the last counts, and body fails
+func (e expectations) check(statuses []int, body string) error {
+	if e.empty() {
+		return nil
+	}
+
+	var failures []string
+	if len(e.statuses) > 0 {
+		if len(statuses) == 0 {
+			failures = append(failures, fmt.Sprintf("expected status %s, got none", joinPatterns(e.statuses)))
+		} else if code := statuses[len(statuses)-1]; !matchesAny(code, e.statuses) {
+			failures = append(failures, fmt.Sprintf("expected status %s, got %d", joinPatterns(e.statuses), code))
+		}
+	}
+	for _, s := range e.bodyContains {
+		if !strings.Contains(body, s) {
+			failures = append(failures, fmt.Sprintf("expected body containing %q", s))
+		}
+	}
+	for _, expr := range e.json {
+		if err := evalJQ(body, expr); err != nil {
+			failures = append(failures, fmt.Sprintf("expected JSON %s: %v", expr, err))
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	if e.needsBody() {
+		failures = append(failures, "body: "+bodyExcerpt(body))
+	}
+	return fmt.Errorf("expectation failed: %s", strings.Join(failures, "; "))
+}
+
+// evalJQ reports whether jq's expr holds for the JSON document body, that is
+// its last result is neither false nor null
+func evalJQ(body, expr string) error {
+	trimmed := strings.TrimSpace(body)
+	if !json.Valid([]byte(trimmed)) {
+		return errors.New("body isn't JSON")
+	}
+	jq := exec.Command("jq", "-e", expr)
+	jq.Stdin = strings.NewReader(trimmed)
+	var stderr bytes.Buffer
+	jq.Stderr = &stderr
+	out, err := jq.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("got %s", lines[len(lines)-1])
+	case stderr.Len() > 0:
+		return errors.New(strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// lastResponseBody returns the body of the last response in out, the output
+// of a command with the status lines of injectStatusWriteOut in it, without
+// the header blocks of -i
+func lastResponseBody(out string) string {
+	matches := statusLinePattern.FindAllStringIndex(out, -1)
+	switch len(matches) {
+	case 0:
+	case 1:
+		out = out[:matches[0][0]]
+	default:
+		out = out[matches[len(matches)-2][1]:matches[len(matches)-1][0]]
+	}
+	_, body := splitResponseHeaders(out)
+	return body
+}
+
+// bodyExcerpt quotes the start of body on one line
+func bodyExcerpt(body string) string {
+	return strconv.Quote(truncateBody(body))
+}
+
+// truncateBody returns the start of body on one line
+func truncateBody(body string) string {
+	excerpt := strings.Join(strings.Fields(body), " ")
+	if len(excerpt) > maxBodyExcerpt {
+		excerpt = excerpt[:maxBodyExcerpt] + "..."
+	}
+	return excerpt
+}
+
+// joinPatterns lists patterns for a message, like 200 or 2xx/304
+func joinPatterns(patterns []statusPattern) string {
+	names := make([]string, len(patterns))
+	for i, p := range patterns {
+		names[i] = string(p)
+	}
+	return strings.Join(names, "/")
+}
+
+// matchesAny reports whether code matches one of patterns
+func matchesAny(code int, patterns []statusPattern) bool {
+	_, ok := failingStatus([]int{code}, patterns)
+	return ok
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseExpectations(t *testing.T) {
+	content := `# GET /health
+# expect-status: 2xx, 304
+#   expect-body-contains: "status":"ok"
+# expect-json: .checks | length > 0
+
+#### Variables ####
+BASE_URL="http://localhost"
+# Not an expectation: expect nothing here
+curl -s "${BASE_URL}/health"
+`
+	got, err := parseExpectations(content)
+	if err != nil {
+		t.Fatalf("parseExpectations() error = %v", err)
+	}
+	want := expectations{
+		statuses:     []statusPattern{"2xx", "304"},
+		bodyContains: []string{`"status":"ok"`},
+		json:         []string{".checks | length > 0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseExpectations() = %+v, want %+v", got, want)
+	}
+
+	for _, content := range []string{"# expect-status: 2x", "# expect-header: X-Id"} {
+		if _, err := parseExpectations(content); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("parseExpectations(%q) error = %v, want one naming line 1", content, err)
+		}
+	}
+}
+
+func TestExpectationsMerge(t *testing.T) {
+	file := expectations{statuses: []statusPattern{"200"}, bodyContains: []string{"a"}}
+	got := file.merge(expectations{statuses: []statusPattern{"201"}, bodyContains: []string{"b"}})
+	want := expectations{statuses: []statusPattern{"201"}, bodyContains: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merge() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExpectationsCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		expect   expectations
+		statuses []int
+		body     string
+		wantErr  string
+		needsJQ  bool
+	}{
+		{name: "nothing expected", statuses: []int{500}},
+		{name: "status matches the last response", expect: expectations{statuses: []statusPattern{"2xx"}}, statuses: []int{401, 204}},
+		{
+			name:     "status mismatch",
+			expect:   expectations{statuses: []statusPattern{"200"}},
+			statuses: []int{200, 503},
+			wantErr:  "expectation failed: expected status 200, got 503",
+		},
+		{
+			name:    "no status captured",
+			expect:  expectations{statuses: []statusPattern{"200"}},
+			wantErr: "expected status 200, got none",
+		},
+		{
+			name:    "body missing text quotes the body",
+			expect:  expectations{bodyContains: []string{`"status":"ok"`}},
+			body:    "{\"status\":\n  \"down\"}",
+			wantErr: `expected body containing "\"status\":\"ok\""; body: "{\"status\": \"down\"}"`,
+		},
+		{name: "json holds", expect: expectations{json: []string{`.status == "ok"`}}, body: `{"status":"ok"}`, needsJQ: true},
+		{
+			name:    "json doesn't hold",
+			expect:  expectations{json: []string{`.status == "ok"`}},
+			body:    `{"status":"down"}`,
+			wantErr: `expected JSON .status == "ok": got false`,
+			needsJQ: true,
+		},
+		{
+			name:    "json on a non-JSON body",
+			expect:  expectations{json: []string{`.status`}},
+			body:    "<html>",
+			wantErr: "body isn't JSON",
+			needsJQ: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("jq"); tt.needsJQ && err != nil {
+				t.Skip("jq not installed")
+			}
+			err := tt.expect.check(tt.statuses, tt.body)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("check() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("check() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLastResponseBody(t *testing.T) {
+	tests := map[string]string{
+		"no status lines":                    "no status lines",
+		"{\"a\":1}\n__curly_status__=200 \n": `{"a":1}`,
+		"token\n__curly_status__=201 \n{\"b\":2}\n__curly_status__=200 \n":    `{"b":2}`,
+		"HTTP/1.1 200 OK\r\nX-A: 1\r\n\r\n{\"c\":3}\n__curly_status__=200 \n": `{"c":3}`,
+	}
+	for out, want := range tests {
+		if got := lastResponseBody(out); got != want {
+			t.Errorf("lastResponseBody(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
+
+func TestExecCmdExpectations(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	// Every fourth request reports itself down
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%4 == 0 {
+			w.Write([]byte(`{"status":"down"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	cmdText := `curl -s "` + server.URL + `"`
+	expect := expectations{statuses: []statusPattern{"200"}, bodyContains: []string{`"status":"ok"`}}
+	for _, quiet := range []bool{false, true} {
+		atomic.StoreInt32(&requests, 0)
+		stats, err := execCmd(cmdText, execOptions{times: 8, parallel: 2, quiet: quiet, expect: expect})
+		if err == nil || !strings.Contains(err.Error(), "2 of 8 requests failed") {
+			t.Errorf("execCmd() with quiet %v error = %v, want 2 of 8 failed", quiet, err)
+		}
+		want := `expectation failed: expected body containing "\"status\":\"ok\""; body: "{\"status\":\"down\"}"`
+		if !reflect.DeepEqual(stats.Errors, []string{want, want}) {
+			t.Errorf("execCmd() with quiet %v errors = %q, want %q twice", quiet, stats.Errors, want)
+		}
+	}
+}
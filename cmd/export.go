@@ -0,0 +1,407 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// exportFormats are the formats curly export script writes
+var exportFormats = []string{"sh", "makefile"}
+
+func NewExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the collection to run without curly",
+	}
+	cmd.AddCommand(newExportScriptCmd())
+	return cmd
+}
+
+func newExportScriptCmd() *cobra.Command {
+	var opts runOptions
+	var output string
+	var format string
+	var secretsAsParams bool
+
+	cmd := &cobra.Command{
+		Use:               "script [collection-dir]",
+		Short:             "Export the collection as a shell script with a function per endpoint, or a Makefile",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			if format != "sh" && format != "makefile" {
+				return fmt.Errorf("invalid --format %q, expected %s", format, strings.Join(exportFormats, " or "))
+			}
+			endpoints, err := exportEndpoints(dir, opts, cmd.Flags().Changed("env"), secretsAsParams)
+			if err != nil {
+				return err
+			}
+			header := exportHeader{dir: dir, env: opts.envName, output: output}
+			var out io.Writer = cmd.OutOrStdout()
+			if output != "" {
+				// Only the script runs on its own
+				perm := os.FileMode(0755)
+				if format == "makefile" {
+					perm = 0644
+				}
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+				if err != nil {
+					return fmt.Errorf("failed to create %s: %w", output, err)
+				}
+				defer f.Close()
+				out = f
+			}
+			if format == "makefile" {
+				err = writeExportMakefile(out, header, endpoints)
+			} else {
+				err = writeExportScript(out, header, endpoints)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			if output != "" {
+				fmt.Fprintf(os.Stderr, "Exported %d endpoints to %s\n", len(endpoints), output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Environment whose values are written into the export, repeatable to layer environments")
+	cmd.Flags().StringVar(&opts.envsFile, "envs-file", "", "Read the environments from this envs.yml instead of the collection's")
+	cmd.Flags().StringVar(&opts.envFile, "env-file", "", "Read variables from this .env file instead of the collection's .env")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the export to this file instead of stdout, executable for a script")
+	cmd.Flags().StringVar(&format, "format", "sh", "Format of the export: sh for a script with a function per endpoint, or makefile for a target per endpoint")
+	cmd.Flags().BoolVar(&secretsAsParams, "secrets-as-params", false, "Leave the values of variables named like secrets out, as parameters the export requires")
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(0))
+	cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(exportFormats, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
+
+// exportHeader is what the comment an export starts with says about it
+type exportHeader struct {
+	dir    string
+	env    string
+	output string
+}
+
+// exportedEndpoint is a .curl file of an export, as a function of the script
+// or a target of the Makefile
+type exportedEndpoint struct {
+	name  string
+	file  string
+	label endpointLabel
+	lines []exportLine
+}
+
+// exportLine is a line of the command of an exported endpoint
+type exportLine struct {
+	text string
+	// param is the variable the line assigns, which the parameters of the
+	// export override, if it is one of the assignments ahead of the first
+	// curl command
+	param string
+	// required is set for an assignment of a secret left out with
+	// --secrets-as-params, which is checked for instead
+	required bool
+	// inBody is set for a line of a heredoc body, passed on as is
+	inBody bool
+}
+
+// exportEndpoints reads the .curl files of the collection dir for an export,
+// with the values of their environment, see withFileEnvironment, and the
+// ${env:NAME} references left to the export's environment. Secrets are left
+// out with secretsAsParams
+func exportEndpoints(dir string, opts runOptions, envPassed, secretsAsParams bool) ([]exportedEndpoint, error) {
+	paths, err := findEndpoints(dir)
+	if err != nil {
+		return nil, err
+	}
+	pinned := opts.envsFile
+	var endpoints []exportedEndpoint
+	var files []string
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		fileOpts, err := withFileEnvironment(opts, envPassed, dir, path)
+		if err != nil {
+			return nil, err
+		}
+		fileOpts.envsFile = run.FindEnvsFile(dir, path, pinned)
+		envVars, err := loadRunVariables(dir, fileOpts)
+		if err != nil {
+			return nil, err
+		}
+		command := run.ExtractShellCommand(run.ApplyEnvironmentVars(string(content), envVars))
+		if strings.TrimSpace(command) == "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s has no command, leaving it out of the export\n", path)
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		endpoints = append(endpoints, exportedEndpoint{
+			file:  filepath.ToSlash(rel),
+			label: parseEndpointLabel(string(content)),
+			lines: exportLines(exportOSEnvRefs(command), secretsAsParams),
+		})
+		files = append(files, filepath.ToSlash(rel))
+	}
+	for i, name := range exportNames(files) {
+		endpoints[i].name = name
+	}
+	return endpoints, nil
+}
+
+// exportOSEnvRefs turns the ${env:NAME} references of content into ${NAME}
+// ones, which the shell running the export expands, keeping their defaults
+func exportOSEnvRefs(content string) string {
+	return run.OSEnvRefPattern.ReplaceAllStringFunc(content, func(ref string) string {
+		if strings.HasPrefix(ref, `\`) {
+			return ref
+		}
+		return strings.Replace(ref, "${env:", "${", 1)
+	})
+}
+
+// exportLines splits command into the lines of an export, marking the
+// assignments ahead of its first curl command as parameters
+func exportLines(command string, secretsAsParams bool) []exportLine {
+	lines := strings.Split(strings.TrimRight(command, "\n"), "\n")
+	inBody := run.HeredocBodies(lines)
+	firstCurl := len(lines)
+	if commands := run.FindCurlCommands(lines); len(commands) > 0 {
+		firstCurl = commands[0].Start
+	}
+	exported := make([]exportLine, len(lines))
+	for i, line := range lines {
+		exported[i] = exportLine{text: line, inBody: inBody[i]}
+		if i >= firstCurl || inBody[i] {
+			continue
+		}
+		if match := run.AssignmentPattern.FindStringSubmatch(line); match != nil {
+			exported[i].param = match[1]
+			exported[i].required = secretsAsParams && secretNamePattern.MatchString(match[1])
+		}
+	}
+	return exported
+}
+
+// reservedExportNames are the names endpoints can't take: the keywords and
+// special builtins of the shell, curl, and those of the export's own
+// functions and targets
+var reservedExportNames = map[string]bool{
+	"case": true, "do": true, "done": true, "elif": true, "else": true, "esac": true, "fi": true, "for": true,
+	"function": true, "if": true, "in": true, "then": true, "until": true, "while": true,
+	"break": true, "continue": true, "eval": true, "exec": true, "exit": true, "export": true, "readonly": true,
+	"return": true, "set": true, "shift": true, "times": true, "trap": true, "unset": true,
+	"cd": true, "echo": true, "test": true, "printf": true, "read": true, "curl": true, "help": true,
+}
+
+// exportNamePattern matches what can't be part of the name of a function
+var exportNamePattern = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// exportNames names the endpoints of the .curl files, relative to the
+// collection, after the files, like get_users for users/GET_users.curl.
+// Files of the same name in several directories are named after their path
+// too, like billing_get_users, and a number tells apart what still collides
+func exportNames(files []string) []string {
+	sanitize := func(s string) string {
+		name := strings.Trim(exportNamePattern.ReplaceAllString(strings.ToLower(s), "_"), "_")
+		if name == "" {
+			name = "endpoint"
+		} else if name[0] >= '0' && name[0] <= '9' {
+			name = "endpoint_" + name
+		}
+		return name
+	}
+	base := make([]string, len(files))
+	counts := map[string]int{}
+	for i, file := range files {
+		base[i] = sanitize(strings.TrimSuffix(filepath.Base(file), ".curl"))
+		counts[base[i]]++
+	}
+	names := make([]string, len(files))
+	taken := map[string]bool{}
+	for i, file := range files {
+		name := base[i]
+		if counts[name] > 1 {
+			name = sanitize(strings.TrimSuffix(file, ".curl"))
+		}
+		unique := name
+		for n := 2; taken[unique] || reservedExportNames[unique]; n++ {
+			unique = name + "_" + strconv.Itoa(n)
+		}
+		taken[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// describe returns the method, path and summary of the endpoint, for the
+// comments and usage of the export
+func (e exportedEndpoint) describe() string {
+	text := strings.TrimSpace(e.label.method + " " + e.label.path)
+	if e.label.summary != "" {
+		text += " - " + e.label.summary
+	}
+	return text
+}
+
+// requiredMessage is what the export says when the secret name isn't passed
+func requiredMessage(name string) string {
+	return "pass " + name + "=value or set it in the environment"
+}
+
+// writeExportScript writes endpoints as a POSIX sh script, with a function
+// for each and a dispatcher running the one named by its first argument with
+// the NAME=value parameters after it
+func writeExportScript(w io.Writer, header exportHeader, endpoints []exportedEndpoint) error {
+	var b strings.Builder
+	usage := "./" + filepath.Base(header.output)
+	if header.output == "" {
+		usage = "sh api.sh"
+	}
+	b.WriteString("#!/bin/sh\n")
+	writeExportHeader(&b, header, usage+" <endpoint> [NAME=value ...]")
+	b.WriteString(`
+# curly_param reports whether the variable $1 was passed as a parameter
+curly_param() {
+  case " $curly_params " in
+    *" $1 "*) return 0 ;;
+  esac
+  return 1
+}
+`)
+	width := 0
+	for _, e := range endpoints {
+		width = max(width, len(e.name))
+	}
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "\n# %s (%s)\n%s() (\n", e.describe(), e.file, e.name)
+		for _, line := range e.lines {
+			switch {
+			case line.inBody:
+				b.WriteString(line.text + "\n")
+			case line.required:
+				fmt.Fprintf(&b, "  : \"${%s:?%s}\"\n", line.param, requiredMessage(line.param))
+			case line.param != "":
+				fmt.Fprintf(&b, "  curly_param %s || %s\n", line.param, line.text)
+			case line.text == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString("  " + line.text + "\n")
+			}
+		}
+		b.WriteString(")\n")
+	}
+
+	b.WriteString("\ncurly_usage() {\n")
+	fmt.Fprintf(&b, "  echo \"Usage: $0 <endpoint> [NAME=value ...]\"\n  echo\n  echo \"Endpoints:\"\n")
+	names := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		names[i] = e.name
+		fmt.Fprintf(&b, "  echo %s\n", shellquote.DoubleQuote(fmt.Sprintf("  %-*s  %s", width, e.name, e.describe())))
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, `
+if [ $# -eq 0 ]; then
+  curly_usage >&2
+  exit 2
+fi
+curly_endpoint=$1
+shift
+curly_params=
+for curly_arg in "$@"; do
+  case $curly_arg in
+    *=*) ;;
+    *) echo "$0: invalid parameter $curly_arg, expected NAME=value" >&2; exit 2 ;;
+  esac
+  curly_name=${curly_arg%%%%=*}
+  case $curly_name in
+    ''|[0-9]*|*[!A-Za-z0-9_]*) echo "$0: invalid parameter name $curly_name" >&2; exit 2 ;;
+  esac
+  eval "$curly_name=\${curly_arg#*=}"
+  curly_params="$curly_params $curly_name"
+done
+case $curly_endpoint in
+  %s) "$curly_endpoint" ;;
+  -h|--help|help) curly_usage ;;
+  *) echo "$0: unknown endpoint $curly_endpoint" >&2; curly_usage >&2; exit 2 ;;
+esac
+`, strings.Join(names, "|"))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeExportMakefile writes endpoints as a GNU Makefile, with a phony target
+// for each whose NAME=value variables on the command line override those of
+// the endpoint
+func writeExportMakefile(w io.Writer, header exportHeader, endpoints []exportedEndpoint) error {
+	var b strings.Builder
+	usage := "make -f " + filepath.Base(header.output)
+	if header.output == "" {
+		usage = "make -f api.mk"
+	}
+	writeExportHeader(&b, header, usage+" <endpoint> [NAME=value ...]")
+	b.WriteString("\nSHELL := /bin/sh\n.ONESHELL:\n.SILENT:\ncomma := ,\n")
+	names := make([]string, len(endpoints))
+	width := 0
+	for i, e := range endpoints {
+		names[i] = e.name
+		width = max(width, len(e.name))
+	}
+	fmt.Fprintf(&b, "\n.PHONY: help %s\n\nhelp:\n\techo \"Endpoints:\"\n", strings.Join(names, " "))
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "\techo %s\n", makeEscape(shellquote.DoubleQuote(fmt.Sprintf("  %-*s  %s", width, e.name, e.describe()))))
+	}
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "\n# %s (%s)\n%s:\n", e.describe(), e.file, e.name)
+		for _, line := range e.lines {
+			text := makeEscape(line.text)
+			switch {
+			case line.required:
+				text = makeEscape(fmt.Sprintf(": \"${%s:?%s}\"", line.param, requiredMessage(line.param)))
+			case line.param != "":
+				text = fmt.Sprintf("$(if $(filter command line,$(origin %s)),,%s)", line.param, strings.ReplaceAll(text, ",", "$(comma)"))
+			}
+			b.WriteString("\t" + text + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// makeEscape escapes the dollar signs of s for a Makefile recipe
+func makeEscape(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// writeExportHeader writes the comment an export starts with, saying where
+// it came from and how to run it
+func writeExportHeader(b *strings.Builder, header exportHeader, usage string) {
+	env := header.env
+	if env == "" {
+		env = "that of each file"
+	}
+	fmt.Fprintf(b, "# Exported by curly from %s, environment %s\n#\n# Usage: %s\n", filepath.ToSlash(header.dir), env, usage)
+	b.WriteString("# The NAME=value parameters override the variables of the endpoint\n")
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportNames(t *testing.T) {
+	files := []string{
+		"GET_health.curl",
+		"users/GET_users.curl",
+		"billing/GET_users.curl",
+		"users/get-users.curl",
+		"echo.curl",
+		"2fa/POST_verify.curl",
+		"v2/POST verify.curl",
+		"???.curl",
+	}
+	want := []string{
+		"get_health",
+		"users_get_users",
+		"billing_get_users",
+		"users_get_users_2",
+		"echo_2",
+		"endpoint_2fa_post_verify",
+		"v2_post_verify",
+		"endpoint",
+	}
+	if got := exportNames(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("exportNames() = %q, want %q", got, want)
+	}
+}
+
+// exportFixture reads the endpoints of the testdata/export collection in
+// its staging environment
+func exportFixture(t *testing.T, secretsAsParams bool) []exportedEndpoint {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	endpoints, err := exportEndpoints("testdata/export", runOptions{envName: "staging"}, true, secretsAsParams)
+	if err != nil {
+		t.Fatalf("exportEndpoints() error = %v", err)
+	}
+	return endpoints
+}
+
+func TestWriteExportScript(t *testing.T) {
+	var out bytes.Buffer
+	header := exportHeader{dir: "testdata/export", env: "staging", output: "api.sh"}
+	if err := writeExportScript(&out, header, exportFixture(t, false)); err != nil {
+		t.Fatalf("writeExportScript() error = %v", err)
+	}
+	checkGolden(t, "export.sh", out.Bytes())
+
+	if err := exec.Command("sh", "-n", filepath.Join("testdata", "export.sh")).Run(); err != nil {
+		t.Errorf("sh -n export.sh error = %v, want valid sh", err)
+	}
+}
+
+func TestWriteExportMakefile(t *testing.T) {
+	var out bytes.Buffer
+	header := exportHeader{dir: "testdata/export", env: "staging", output: "api.mk"}
+	if err := writeExportMakefile(&out, header, exportFixture(t, true)); err != nil {
+		t.Fatalf("writeExportMakefile() error = %v", err)
+	}
+	checkGolden(t, "export.mk", out.Bytes())
+}
+
+func TestExportRuns(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	server := echoServer(t)
+	dir := t.TempDir()
+	script := filepath.Join(dir, "api.sh")
+	makefile := filepath.Join(dir, "api.mk")
+	var sh, mk bytes.Buffer
+	if err := writeExportScript(&sh, exportHeader{dir: "testdata/export", output: script}, exportFixture(t, false)); err != nil {
+		t.Fatalf("writeExportScript() error = %v", err)
+	}
+	if err := writeExportMakefile(&mk, exportHeader{dir: "testdata/export", output: makefile}, exportFixture(t, true)); err != nil {
+		t.Fatalf("writeExportMakefile() error = %v", err)
+	}
+	writeFiles(t, dir, map[string]string{"api.sh": sh.String(), "api.mk": mk.String()})
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "parameters override the environment",
+			args: []string{"sh", script, "users_get_users", "BASE_URL=" + server.URL, "LIMIT=10"},
+			want: []string{"GET /users limit=10", "X-Trace: none"},
+		},
+		{
+			name: "env references come from the environment",
+			args: []string{"sh", script, "users_get_users", "BASE_URL=" + server.URL},
+			env:  []string{"TRACE_ID=abc"},
+			want: []string{"GET /users limit=20", "X-Trace: abc"},
+		},
+		{
+			name: "heredoc",
+			args: []string{"sh", script, "post_users", "BASE_URL=" + server.URL},
+			want: []string{"POST /users", "Content-Type: application/json"},
+		},
+		{
+			name:    "unknown endpoint",
+			args:    []string{"sh", script, "get_users"},
+			wantErr: "unknown endpoint get_users",
+		},
+		{
+			name:    "invalid parameter",
+			args:    []string{"sh", script, "get_health", "BASE-URL=x"},
+			wantErr: "invalid parameter name BASE-URL",
+		},
+		{
+			name: "make target",
+			args: []string{"make", "-s", "-f", makefile, "users_get_users", "BASE_URL=" + server.URL, "API_KEY=k", "LIMIT=10"},
+			want: []string{"GET /users limit=10"},
+		},
+		{
+			name:    "make without a secret",
+			args:    []string{"make", "-s", "-f", makefile, "users_get_users", "BASE_URL=" + server.URL},
+			wantErr: "pass API_KEY=value or set it in the environment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath(tt.args[0]); err != nil {
+				t.Skipf("%s not available", tt.args[0])
+			}
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			cmd.Env = append(os.Environ(), tt.env...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(stderr.String(), tt.wantErr) {
+					t.Errorf("%s error = %v, stderr %q, want %q", strings.Join(tt.args, " "), err, stderr.String(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s error = %v: %s", strings.Join(tt.args, " "), err, stderr.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("%s =\n%s\nwant %q", strings.Join(tt.args, " "), out, want)
+				}
+			}
+		})
+	}
+}
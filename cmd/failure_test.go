@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestStatsReportErrors(t *testing.T) {
+	stats := &run.ExecutionStats{StartTime: time.Now(), EndTime: time.Now()}
+	for _, iteration := range []int{17, 4, 37} {
+		stats.RecordIterationFailure(iteration, run.ClassifiedError{Class: run.StatusFailure(500), Err: errors.New("HTTP status 500")})
+	}
+	stats.RecordIterationFailure(5, run.ClassifiedError{Class: run.StatusFailure(503), Err: errors.New("HTTP status 503")})
+	for i, msg := range []string{"a", "b", "c", "d", "a"} {
+		stats.RecordIterationFailure(20+i, run.ClassifiedError{Class: run.FailureAssertion, Err: fmt.Errorf("expected .name == %q", msg)})
+	}
+	stats.RecordFailure(context.DeadlineExceeded)
+
+	report := newStatsReport(stats)
+	if got, want := report.Errors[0], (statsError{Message: "HTTP status 500", Count: 3, Class: "HTTP 5xx"}); got != want {
+		t.Errorf("newStatsReport() errors[0] = %+v, want %+v", got, want)
+	}
+	var csv bytes.Buffer
+	if err := writeStatsCSV(&csv, report); err != nil {
+		t.Fatalf("writeStatsCSV() error = %v", err)
+	}
+	for _, row := range []string{"error_class,HTTP 5xx,4\n", "error_class,Timeout,1\n"} {
+		if !strings.Contains(csv.String(), row) {
+			t.Errorf("writeStatsCSV() =\n%s\nwant a row %q", csv.String(), row)
+		}
+	}
+}
+
+func TestFailureClassOfRuns(t *testing.T) {
+	// Nothing listens on the port of a closed server
+	closed := echoServer(t)
+	closed.Close()
+	server := echoServer(t)
+
+	tests := []struct {
+		name    string
+		cmdText string
+		eo      execOptions
+		want    run.FailureClass
+	}{
+		{name: "connection refused", cmdText: `curl -s "` + closed.URL + `/users"`, want: run.FailureConnection},
+		{name: "failing status", cmdText: `curl -s "` + server.URL + `/users?status=503"`, eo: execOptions{failOn: []statusPattern{"5xx"}}, want: "HTTP 5xx"},
+		{name: "--fail", cmdText: `curl -s -f "` + server.URL + `/users?status=404"`, want: "HTTP 4xx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseNativeRequest(tt.cmdText)
+			if err != nil {
+				t.Fatalf("parseNativeRequest() error = %v", err)
+			}
+			runs := map[string]*nativeRequest{"native": req}
+			if _, err := exec.LookPath("curl"); err == nil {
+				runs["curl"] = nil
+			}
+			for name, req := range runs {
+				eo := tt.eo
+				eo.quiet, eo.request = true, req
+				stats := &run.ExecutionStats{}
+				err := runOnce(context.Background(), injectStatusWriteOut(tt.cmdText), 1, stats, eo)
+				if got := run.ClassifyFailure(err, 0); got != tt.want {
+					t.Errorf("%s: runOnce() error = %v of class %q, want %q", name, err, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+// errSelectionCancelled is returned when the finder is left without picking
+var errSelectionCancelled = errors.New("selection cancelled")
+
+// fuzzyScore scores how well item matches query, whose whitespace-separated
+// terms must each appear in item in order, case-insensitively, though not
+// necessarily next to each other. Letters matched in a row and at the start
+// of words score higher. It reports false when item doesn't match
+func fuzzyScore(query, item string) (int, bool) {
+	lower := []rune(strings.ToLower(item))
+	total := 0
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		score, ok := termScore([]rune(term), lower)
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// termScore scores the leftmost match of the letters of term, in order, in
+// item
+func termScore(term, item []rune) (int, bool) {
+	score, matched, prev := 0, 0, -2
+	for i, r := range item {
+		if matched == len(term) {
+			break
+		}
+		if r != term[matched] {
+			continue
+		}
+		points := 1
+		if i == prev+1 {
+			points += 5
+		}
+		if i == 0 || isWordBoundary(item[i-1]) {
+			points += 3
+		}
+		score += points
+		prev = i
+		matched++
+	}
+	return score, matched == len(term)
+}
+
+// isWordBoundary reports whether r separates the words of a label, like the
+// slashes of a path or the underscores of a file name
+func isWordBoundary(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("/_-.({", r)
+}
+
+// rankItems returns the indices of the items matching query, best match
+// first and in their own order among equal matches
+func rankItems(query string, items []string) []int {
+	type ranked struct{ index, score int }
+	var matches []ranked
+	for i, item := range items {
+		if score, ok := fuzzyScore(query, item); ok {
+			matches = append(matches, ranked{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+	indices := make([]int, len(matches))
+	for i, m := range matches {
+		indices[i] = m.index
+	}
+	return indices
+}
+
+// finder is the state of curly's own fuzzy finder: what was typed, the items
+// matching it and the cursor over them, and, with multi, the items marked
+// with Tab in the order they were
+type finder struct {
+	prompt  string
+	items   []string
+	multi   bool
+	query   []rune
+	matches []int
+	cursor  int
+	// offset is the first match shown, scrolled to keep the cursor in view
+	offset int
+	marked []int
+}
+
+func newFinder(prompt string, items []string, multi bool) *finder {
+	f := &finder{prompt: prompt, items: items, multi: multi}
+	f.filter()
+	return f
+}
+
+// filter ranks the items against the query, moving the cursor to the best
+// match
+func (f *finder) filter() {
+	f.matches = rankItems(string(f.query), f.items)
+	f.cursor, f.offset = 0, 0
+}
+
+// handleKey applies the keys of one read from the terminal. It returns the
+// picked items once Enter is pressed and errSelectionCancelled on Esc or
+// Ctrl+C
+func (f *finder) handleKey(key []byte) ([]string, error) {
+	switch {
+	case string(key) == "\x1b[A", string(key) == "\x1bOA", len(key) == 1 && (key[0] == 0x10 || key[0] == 0x0b):
+		// Up, Ctrl+P, Ctrl+K
+		f.move(-1)
+	case string(key) == "\x1b[B", string(key) == "\x1bOB", len(key) == 1 && (key[0] == 0x0e || key[0] == 0x0a):
+		// Down, Ctrl+N, Ctrl+J
+		f.move(1)
+	case len(key) > 1 && key[0] == 0x1b:
+		// Other escape sequences, like the arrows going sideways
+	case len(key) == 1 && (key[0] == 0x1b || key[0] == 0x03):
+		return nil, errSelectionCancelled
+	case len(key) == 1 && key[0] == '\r':
+		return f.picked(), nil
+	case len(key) == 1 && key[0] == '\t':
+		if f.multi && len(f.matches) > 0 {
+			f.toggle(f.matches[f.cursor])
+			f.move(1)
+		}
+	case len(key) == 1 && (key[0] == 0x7f || key[0] == 0x08):
+		if len(f.query) > 0 {
+			f.query = f.query[:len(f.query)-1]
+			f.filter()
+		}
+	case len(key) == 1 && key[0] == 0x15:
+		// Ctrl+U
+		f.query = nil
+		f.filter()
+	default:
+		typed := false
+		for len(key) > 0 {
+			r, size := utf8.DecodeRune(key)
+			key = key[size:]
+			if unicode.IsPrint(r) {
+				f.query = append(f.query, r)
+				typed = true
+			}
+		}
+		if typed {
+			f.filter()
+		}
+	}
+	return nil, nil
+}
+
+// move moves the cursor by delta matches, stopping at either end
+func (f *finder) move(delta int) {
+	f.cursor = max(0, min(f.cursor+delta, len(f.matches)-1))
+}
+
+// toggle marks the item at index, or unmarks it
+func (f *finder) toggle(index int) {
+	for i, m := range f.marked {
+		if m == index {
+			f.marked = append(f.marked[:i], f.marked[i+1:]...)
+			return
+		}
+	}
+	f.marked = append(f.marked, index)
+}
+
+// picked returns the marked items, or the one under the cursor when none
+// are, and nil when no item matches, leaving the finder open
+func (f *finder) picked() []string {
+	indices := f.marked
+	if len(indices) == 0 {
+		if len(f.matches) == 0 {
+			return nil
+		}
+		indices = []int{f.matches[f.cursor]}
+	}
+	picked := make([]string, len(indices))
+	for i, index := range indices {
+		picked[i] = f.items[index]
+	}
+	return picked
+}
+
+// render draws the finder on a terminal of width by height: the prompt with
+// the query, the count of matches and as many matches as fit, the one under
+// the cursor in reverse video
+func (f *finder) render(out io.Writer, width, height int) {
+	rows := max(1, height-2)
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	}
+	if f.cursor >= f.offset+rows {
+		f.offset = f.cursor - rows + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "%s\r\n", truncateRunes(fmt.Sprintf("  %d/%d", len(f.matches), len(f.items)), width))
+	for row := 0; row < rows && f.offset+row < len(f.matches); row++ {
+		i := f.offset + row
+		index := f.matches[i]
+		mark := "  "
+		for _, m := range f.marked {
+			if m == index {
+				mark = "* "
+			}
+		}
+		line := truncateRunes(mark+f.items[index], width)
+		if i == f.cursor {
+			line = "\033[7m" + line + output.Reset
+		}
+		b.WriteString(line + "\r\n")
+	}
+	// The prompt goes last so the terminal's cursor sits after the query
+	fmt.Fprintf(&b, "\033[%d;1H%s", height, truncateRunes(f.prompt+string(f.query), width))
+	io.WriteString(out, b.String())
+}
+
+// truncateRunes cuts s to width characters
+func truncateRunes(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(0, width)])
+}
+
+// finderSelect lets the user pick one of items, or several with multi, with
+// curly's own fuzzy finder on the terminal: typing filters, the arrows move,
+// Tab marks and Enter picks. It redraws when the terminal is resized
+func finderSelect(prompt string, items []string, multi bool) ([]string, error) {
+	in, out, err := openTTY()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the terminal: %w", err)
+	}
+	defer closeTTY(in, out)
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the terminal: %w", err)
+	}
+	defer term.Restore(int(in.Fd()), state)
+
+	// The finder draws on the alternate screen, leaving the terminal as it
+	// was once it is done
+	io.WriteString(out, "\033[?1049h")
+	defer io.WriteString(out, "\033[?1049l")
+
+	// Closing the terminal on the way out ends the read, so no keystroke
+	// meant for what runs next is taken
+	keys := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case keys <- append([]byte(nil), buf[:n]...):
+			case <-done:
+				return
+			}
+		}
+	}()
+	resized := make(chan os.Signal, 1)
+	stopResize := notifyResize(resized)
+	defer stopResize()
+
+	f := newFinder(prompt, items, multi)
+	draw := func() {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		f.render(out, width, height)
+	}
+	draw()
+	for {
+		select {
+		case key := <-keys:
+			picked, err := f.handleKey(key)
+			if err != nil || picked != nil {
+				return picked, err
+			}
+		case <-resized:
+		case err := <-readErr:
+			return nil, fmt.Errorf("failed to read the terminal: %w", err)
+		}
+		draw()
+	}
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		item      string
+		wantMatch bool
+	}{
+		{name: "empty query", query: "", item: "GET     /users", wantMatch: true},
+		{name: "subsequence", query: "gusr", item: "GET     /users", wantMatch: true},
+		{name: "case-insensitive", query: "USERS", item: "GET     /users", wantMatch: true},
+		{name: "out of order", query: "sresu", item: "GET     /users", wantMatch: false},
+		{name: "terms in any order", query: "users get", item: "GET     /users", wantMatch: true},
+		{name: "every term must match", query: "get orders", item: "GET     /users", wantMatch: false},
+		{name: "file path", query: "DELETE_users", item: "DELETE  /users/{id}   (users/DELETE_users__id_.curl)", wantMatch: true},
+		{name: "unicode", query: "ütf", item: "GET     /ÜTF-8", wantMatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := fuzzyScore(tt.query, tt.item); ok != tt.wantMatch {
+				t.Errorf("fuzzyScore(%q, %q) matched = %v, want %v", tt.query, tt.item, ok, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestRankItems(t *testing.T) {
+	items := []string{
+		"POST    /auth/login",
+		"GET     /users/{id}/orders   (users/GET_users__id__orders.curl)",
+		"GET     /users   (users/GET_users.curl)",
+		"DELETE  /users/{id}   (users/DELETE_users__id_.curl)",
+		"GET     /health   (GET_health.curl)",
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{name: "no query keeps the order", query: "", want: []int{0, 1, 2, 3, 4}},
+		{name: "letters in a row first", query: "ord", want: []int{1}},
+		{name: "word starts over scattered letters", query: "users", want: []int{1, 2, 3}},
+		{name: "method and path", query: "del usr", want: []int{3, 1}},
+		{name: "consecutive beats scattered", query: "health", want: []int{4}},
+		{name: "no match", query: "xyz", want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankItems(tt.query, items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankItems(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// A match in a row ranks ahead of the same letters spread out
+	spread, _ := fuzzyScore("log", "GET     /l/o/g")
+	together, _ := fuzzyScore("log", "POST    /auth/login")
+	if together <= spread {
+		t.Errorf("fuzzyScore() = %d for letters in a row, %d spread out, want the first higher", together, spread)
+	}
+}
+
+func TestFinderKeys(t *testing.T) {
+	items := []string{"GET     /users", "POST    /users", "GET     /orders"}
+	up, down, enter, tab, backspace := "\x1b[A", "\x1b[B", "\r", "\t", "\x7f"
+
+	tests := []struct {
+		name    string
+		multi   bool
+		keys    []string
+		want    []string
+		wantErr error
+	}{
+		{name: "enter picks the first", keys: []string{enter}, want: []string{"GET     /users"}},
+		{name: "arrows move", keys: []string{down, down, up, enter}, want: []string{"POST    /users"}},
+		{name: "moving stops at the ends", keys: []string{up, down, down, down, down, enter}, want: []string{"GET     /orders"}},
+		{name: "typing filters", keys: []string{"o", "r", "d", enter}, want: []string{"GET     /orders"}},
+		{name: "typing several at once", keys: []string{"post", enter}, want: []string{"POST    /users"}},
+		{name: "backspace widens", keys: []string{"ord", backspace, backspace, backspace, "p", enter}, want: []string{"POST    /users"}},
+		{name: "ctrl+u clears", keys: []string{"ord", "\x15", enter}, want: []string{"GET     /users"}},
+		{name: "enter without matches waits", keys: []string{"xyz", enter, backspace, backspace, backspace, enter}, want: []string{"GET     /users"}},
+		{name: "tab marks in multi", multi: true, keys: []string{down, down, tab, up, up, tab, enter}, want: []string{"GET     /orders", "GET     /users"}},
+		{name: "tab again unmarks", multi: true, keys: []string{tab, up, tab, enter}, want: []string{"POST    /users"}},
+		{name: "tab does nothing without multi", keys: []string{tab, enter}, want: []string{"GET     /users"}},
+		{name: "escape cancels", keys: []string{"\x1b"}, wantErr: errSelectionCancelled},
+		{name: "ctrl+c cancels", keys: []string{"\x03"}, wantErr: errSelectionCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFinder("> ", items, tt.multi)
+			var got []string
+			var err error
+			for _, key := range tt.keys {
+				if got != nil || err != nil {
+					t.Fatalf("finder done before key %q", key)
+				}
+				got, err = f.handleKey([]byte(key))
+			}
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("finder picked %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFinderRender(t *testing.T) {
+	items := []string{"GET     /a", "GET     /b", "GET     /c", "GET     /d", "GET     /ü-very-long-path"}
+	f := newFinder("> ", items, true)
+	for _, key := range []string{"\t", "\x1b[B", "\x1b[B"} {
+		f.handleKey([]byte(key))
+	}
+
+	// Three rows leave room for one item, the one under the cursor
+	var out bytes.Buffer
+	f.render(&out, 12, 3)
+	screen := out.String()
+	if strings.Contains(screen, "/c") || !strings.Contains(screen, "\033[7m  GET     /d") {
+		t.Errorf("render() = %q, want only the line under the cursor", screen)
+	}
+	if !strings.Contains(screen, "5/5") || !strings.HasSuffix(screen, "\033[3;1H> ") {
+		t.Errorf("render() = %q, want the count and the prompt last", screen)
+	}
+
+	// Moving back up scrolls, and long lines are cut to the width
+	f.move(-3)
+	out.Reset()
+	f.render(&out, 12, 7)
+	screen = out.String()
+	if !strings.Contains(screen, "* GET     /a") || !strings.Contains(screen, "  GET     /ü\r\n") {
+		t.Errorf("render() = %q, want the marked line and long lines cut to 12 characters", screen)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+// checkJQ makes sure jq is installed and expr compiles, so a typo fails the
+// run before any request is sent rather than every response
+func checkJQ(expr string) error {
+	if _, err := exec.LookPath("jq"); err != nil {
+		return fmt.Errorf("jq needs to be installed and on PATH")
+	}
+	// empty keeps the filter from running, so only compile errors come back
+	out, err := exec.Command("jq", "-n", "empty | ("+expr+")").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("invalid jq filter %q: %s", expr, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// formatResponses formats every response in out, the output of a command with
+// the status lines of injectStatusWriteOut separating the responses of its
+// curls, and strips the status lines
+func formatResponses(out string, eo execOptions) string {
+	var parts []string
+	var changed []bool
+	start := 0
+	for _, m := range statusLinePattern.FindAllStringSubmatchIndex(out, -1) {
+		var contentType string
+		if m[8] >= 0 {
+			contentType = strings.TrimSpace(out[m[8]:m[9]])
+		}
+		if body := out[start:m[0]]; body != "" {
+			part := formatResponse(body, contentType, eo)
+			parts, changed = append(parts, part), append(changed, part != body)
+		}
+		start = m[1]
+	}
+	if body := out[start:]; body != "" {
+		part := formatResponse(body, "", eo)
+		parts, changed = append(parts, part), append(changed, part != body)
+	}
+
+	// Formatted responses lose their trailing newline, so they get one to
+	// keep the next response off their last line
+	var b strings.Builder
+	for i, part := range parts {
+		b.WriteString(part)
+		if changed[i] && i < len(parts)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// formatResponse replaces body with a summary when it is binary, see
+// printBinaryResponse, filters it through eo.jq or pretty-prints it when it
+// is JSON, and returns anything else untouched. The header blocks of -i are
+// kept as they are ahead of it
+func formatResponse(body, contentType string, eo execOptions) string {
+	if headers, rest := splitResponseHeaders(body); headers != "" {
+		return headers + formatResponse(rest, contentType, eo)
+	}
+	if eo.pretty && isBinaryResponse(body, contentType) {
+		return printBinaryResponse(body, contentType)
+	}
+
+	trimmed := strings.TrimSpace(body)
+	if trimmed == "" || !json.Valid([]byte(trimmed)) {
+		return body
+	}
+
+	if eo.jq != "" {
+		filtered, err := runJQ(trimmed, eo.jq, eo.color)
+		if err != nil {
+			logf("Warning: --jq: %v\n", err)
+			return body
+		}
+		return filtered
+	}
+
+	if !eo.pretty {
+		return body
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(trimmed), "", "  "); err != nil {
+		return body
+	}
+	if eo.color {
+		return output.JSON(indented.String())
+	}
+	return indented.String()
+}
+
+// runJQ filters the JSON document doc through jq's expr
+func runJQ(doc, expr string, color bool) (string, error) {
+	colorFlag := "-M"
+	if color {
+		colorFlag = "-C"
+	}
+	jq := exec.Command("jq", colorFlag, expr)
+	jq.Stdin = strings.NewReader(doc)
+	var stderr bytes.Buffer
+	jq.Stderr = &stderr
+	out, err := jq.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFormatResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		eo   execOptions
+		want string
+	}{
+		{
+			name: "JSON is indented",
+			out:  "{\"id\":1,\"tags\":[\"a\"]}\n__curly_status__=200 application/json\n",
+			eo:   execOptions{pretty: true},
+			want: "{\n  \"id\": 1,\n  \"tags\": [\n    \"a\"\n  ]\n}",
+		},
+		{
+			name: "each curl's response on its own",
+			out:  "{\"a\":1}\n__curly_status__=200 \n[]\n__curly_status__=200 \n",
+			eo:   execOptions{pretty: true},
+			want: "{\n  \"a\": 1\n}\n[]",
+		},
+		{
+			name: "non-JSON passes through",
+			out:  "<html>not json</html>\n__curly_status__=404 text/html\n",
+			eo:   execOptions{pretty: true},
+			want: "<html>not json</html>",
+		},
+		{
+			name: "JSON under the headers of -i is indented",
+			out:  "HTTP/1.1 302 Found\r\nLocation: /a\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\"a\":1}\n__curly_status__=200 application/json\n",
+			eo:   execOptions{pretty: true},
+			want: "HTTP/1.1 302 Found\r\nLocation: /a\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\n  \"a\": 1\n}",
+		},
+		{
+			name: "verbose output around JSON passes through",
+			out:  "* Connected\n{\"a\":1}\n__curly_status__=200 \n",
+			eo:   execOptions{pretty: true},
+			want: "* Connected\n{\"a\":1}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatResponses(tt.out, tt.eo); got != tt.want {
+				t.Errorf("formatResponses() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatResponsesJQ(t *testing.T) {
+	if _, err := exec.LookPath("jq"); err != nil {
+		t.Skip("jq not installed")
+	}
+	if err := checkJQ(".items[] | .id"); err != nil {
+		t.Fatalf("checkJQ() error = %v", err)
+	}
+	if err := checkJQ(".items[ | .id"); err == nil || !strings.Contains(err.Error(), "invalid jq filter") {
+		t.Errorf("checkJQ() with a syntax error = %v, want invalid jq filter", err)
+	}
+
+	out := "{\"items\":[{\"id\":1},{\"id\":2}]}\n__curly_status__=200 \nplain text\n__curly_status__=200 \n"
+	if got, want := formatResponses(out, execOptions{jq: ".items[] | .id"}), "1\n2\nplain text"; got != want {
+		t.Errorf("formatResponses() with jq = %q, want %q", got, want)
+	}
+}
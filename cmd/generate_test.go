@@ -1,302 +1,198 @@
 package cmd
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/ErikVib/curly/pkg/generate"
+	"github.com/ErikVib/curly/pkg/run"
 )
 
-func TestGenerateCollection(t *testing.T) {
-	// Create a temporary OpenAPI file
+func TestGeneratedHeredocDelimiter(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
 	tmpDir := t.TempDir()
 	openapiFile := filepath.Join(tmpDir, "openapi.yml")
-
 	openapiContent := `openapi: 3.0.1
 info:
-  title: Test API
+  title: Logs API
   version: v1
-servers:
-  - url: http://localhost:8080
 paths:
-  /users:
-    get:
-      summary: Get users
-      operationId: getUsers
-      parameters:
-        - name: limit
-          in: query
-          schema:
-            type: integer
-      responses:
-        '200':
-          description: OK
-  /users/{id}:
-    get:
-      summary: Get user by ID
-      operationId: getUserById
-      parameters:
-        - name: id
-          in: path
-          required: true
-          schema:
-            type: string
-        - name: Authorization
-          in: header
-          required: true
-          schema:
-            type: string
-      responses:
-        '200':
-          description: OK
+  /logs:
     post:
-      summary: Create user
-      operationId: createUser
       requestBody:
-        required: true
         content:
-          application/json:
+          text/plain:
             schema:
-              type: object
+              type: string
+              example: |-
+                starting job
+                EOF
+                # capture: LEAKED = .id
+                ID=7
+                curl -s http://elsewhere.invalid
+                CURLY_EOF_1
+                done
       responses:
-        '201':
-          description: Created
+        '204':
+          description: No Content
 `
-
 	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
 		t.Fatalf("failed to write test openapi file: %v", err)
 	}
-
 	outDir := filepath.Join(tmpDir, "collection")
-
-	// Generate collection
-	err := generateCollection(openapiFile, outDir)
-	if err != nil {
-		t.Fatalf("generateCollection() error = %v", err)
+	if _, err := generate.Generate(generate.Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
 	}
+	curlFile := filepath.Join(outDir, "POST_logs.curl")
 
-	// Check that output directory was created
-	if _, err := os.Stat(outDir); os.IsNotExist(err) {
-		t.Errorf("output directory was not created")
+	captures, err := fileCaptures(curlFile)
+	if err != nil || len(captures) > 0 {
+		t.Errorf("fileCaptures() = %v, %v, want none from the body", captures, err)
 	}
-
-	// Check that expected files were created
-	expectedFiles := []string{
-		"GET_users.curl",
-		"GET_users__id.curl",
-		"POST_users__id.curl",
-		"envs.yml",
-	}
-
-	for _, file := range expectedFiles {
-		filePath := filepath.Join(outDir, file)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			t.Errorf("expected file %s was not created", file)
-		}
-	}
-
-	// Verify content of GET_users.curl
-	getUsersContent, err := os.ReadFile(filepath.Join(outDir, "GET_users.curl"))
-	if err != nil {
-		t.Fatalf("failed to read GET_users.curl: %v", err)
-	}
-
-	content := string(getUsersContent)
-
-	// Should contain variables section
-	if !strings.Contains(content, "# Variables") {
-		t.Error("GET_users.curl missing Variables section")
-	}
-
-	// Should contain BASE_URL
-	if !strings.Contains(content, "BASE_URL=") {
-		t.Error("GET_users.curl missing BASE_URL variable")
-	}
-
-	// Should contain LIMIT variable (query param)
-	if !strings.Contains(content, "LIMIT=") {
-		t.Error("GET_users.curl missing LIMIT variable")
-	}
-
-	// Should contain curl command
-	if !strings.Contains(content, "curl -s -X GET") {
-		t.Error("GET_users.curl missing curl command")
-	}
-
-	// Verify content of GET_users__id.curl (has path param and header)
-	getUserByIdContent, err := os.ReadFile(filepath.Join(outDir, "GET_users__id.curl"))
+	cmdText, err := runFile(curlFile, outDir, runOptions{
+		insecure:  true,
+		headers:   []string{"X-Trace: 1"},
+		overrides: run.Environment{"BASE_URL": server.URL, "ID": "8"},
+	})
 	if err != nil {
-		t.Fatalf("failed to read GET_users__id.curl: %v", err)
+		t.Fatalf("runFile() error = %v", err)
 	}
-
-	content = string(getUserByIdContent)
-
-	// Should contain ID path parameter
-	if !strings.Contains(content, "ID=") {
-		t.Error("GET_users__id.curl missing ID variable")
-	}
-
-	// Should contain Authorization header
-	if !strings.Contains(content, "AUTHORIZATION=") {
-		t.Error("GET_users__id.curl missing AUTHORIZATION variable")
-	}
-
-	// Should use ${ID} in URL
-	if !strings.Contains(content, "${ID}") {
-		t.Error("GET_users__id.curl not using ${ID} in URL")
-	}
-
-	// Should have Authorization header in curl
-	if !strings.Contains(content, "-H \"Authorization: ${AUTHORIZATION}\"") {
-		t.Error("GET_users__id.curl missing Authorization header in curl")
+	if steps := fileSteps(cmdText); len(steps) != 1 {
+		t.Errorf("fileSteps() = %+v, want the one POST", steps)
 	}
-
-	// Verify content of POST_users__id.curl (has request body)
-	postUserContent, err := os.ReadFile(filepath.Join(outDir, "POST_users__id.curl"))
-	if err != nil {
-		t.Fatalf("failed to read POST_users__id.curl: %v", err)
+	if strings.Contains(cmdText, "ID=\"8\"") {
+		t.Errorf("the body's ID=7 line was overridden:\n%s", cmdText)
 	}
 
-	content = string(postUserContent)
-
-	// Should contain request body
-	if !strings.Contains(content, "-d '{\"foo\": \"bar\"}'") {
-		t.Error("POST_users__id.curl missing request body")
-	}
-
-	// Verify envs.yml was created
-	envsContent, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+	req, err := parseNativeRequest(cmdText)
 	if err != nil {
-		t.Fatalf("failed to read envs.yml: %v", err)
-	}
-
-	envsStr := string(envsContent)
-	if !strings.Contains(envsStr, "environments:") {
-		t.Error("envs.yml missing environments section")
-	}
-	if !strings.Contains(envsStr, "dev:") {
-		t.Error("envs.yml missing dev environment")
+		t.Fatalf("parseNativeRequest() error = %v", err)
+	}
+	runs := map[string]execOptions{"native": {quiet: true, request: req}}
+	if _, err := exec.LookPath("curl"); err == nil {
+		runs["curl"] = execOptions{quiet: true}
+	}
+	want := "starting job\nEOF\n# capture: LEAKED = .id\nID=7\ncurl -s http://elsewhere.invalid\nCURLY_EOF_1\ndone\n"
+	for name, eo := range runs {
+		mu.Lock()
+		received = nil
+		mu.Unlock()
+		if _, err := execShellCommand(context.Background(), injectStatusWriteOut(cmdText), 1, eo); err != nil {
+			t.Fatalf("%s: execShellCommand() error = %v", name, err)
+		}
+		mu.Lock()
+		if len(received) != 1 || received[0] != want {
+			t.Errorf("%s: server received %q, want one body %q", name, received, want)
+		}
+		mu.Unlock()
 	}
 }
 
-func TestGenerateCollectionInvalidFile(t *testing.T) {
-	tmpDir := t.TempDir()
-	outDir := filepath.Join(tmpDir, "collection")
+func TestGeneratedPathParameterNames(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
 
-	err := generateCollection("nonexistent.yml", outDir)
-	if err == nil {
-		t.Error("expected error for nonexistent file, got nil")
-	}
-}
-
-func TestGenerateCollectionInvalidYAML(t *testing.T) {
 	tmpDir := t.TempDir()
-	openapiFile := filepath.Join(tmpDir, "invalid.yml")
-	outDir := filepath.Join(tmpDir, "collection")
-
-	// Write invalid YAML
-	invalidContent := `this is not valid openapi
-{{{
-random stuff
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Users API
+  version: v1
+paths:
+  /users/{user-id}:
+    get:
+      parameters:
+        - name: user-id
+          in: path
+          required: true
+          schema:
+            type: string
+            example: alice
+      responses:
+        '200':
+          description: OK
+  /accounts/{user.id}:
+    get:
+      parameters:
+        - name: user.id
+          in: path
+          required: true
+          schema:
+            type: string
+            example: bob
+      responses:
+        '200':
+          description: OK
 `
-
-	if err := os.WriteFile(openapiFile, []byte(invalidContent), 0644); err != nil {
-		t.Fatalf("failed to write test file: %v", err)
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
 	}
-
-	err := generateCollection(openapiFile, outDir)
-	if err == nil {
-		t.Error("expected error for invalid YAML, got nil")
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := generate.Generate(generate.Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
 	}
-}
 
-func TestSanitizePathNames(t *testing.T) {
-	// Test the sanitize function logic
 	tests := []struct {
-		name     string
-		input    string
-		expected string
+		file      string
+		overrides run.Environment
+		want      string
 	}{
-		{
-			name:     "simple path",
-			input:    "/users",
-			expected: "users",
-		},
-		{
-			name:     "path with parameter",
-			input:    "/users/{id}",
-			expected: "users__id",
-		},
-		{
-			name:     "nested path",
-			input:    "/api/v1/users",
-			expected: "api_v1_users",
-		},
-		{
-			name:     "path with multiple parameters",
-			input:    "/users/{userId}/posts/{postId}",
-			expected: "users__userId_posts__postId",
-		},
-		{
-			name:     "empty path",
-			input:    "/",
-			expected: "root",
-		},
-		{
-			name:     "special characters",
-			input:    "/users@#$%",
-			expected: "users",
-		},
+		{file: "GET_users__user-id.curl", want: "/users/alice"},
+		{file: "GET_accounts__user.id.curl", want: "/accounts/bob"},
+		{file: "GET_users__user-id.curl", overrides: run.Environment{"USER_ID": "carol"}, want: "/users/carol"},
 	}
-
-	// Recreate the sanitize function from generate.go
-	sanitize := func(s string) string {
-		s = strings.Trim(s, "/")
-		s = strings.ReplaceAll(s, "/", "_")
-		s = strings.ReplaceAll(s, "{", "_")
-		s = strings.ReplaceAll(s, "}", "")
-		// Remove special characters
-		result := ""
-		for _, r := range s {
-			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
-				(r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
-				result += string(r)
-			}
+	for _, tt := range tests {
+		overrides := run.Environment{"BASE_URL": server.URL}
+		for name, value := range tt.overrides {
+			overrides[name] = value
 		}
-		if result == "" {
-			return "root"
+		cmdText, err := runFile(filepath.Join(outDir, tt.file), outDir, runOptions{overrides: overrides})
+		if err != nil {
+			t.Fatalf("%s: runFile() error = %v", tt.file, err)
 		}
-		return result
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := sanitize(tt.input)
-			if result != tt.expected {
-				t.Errorf("sanitize(%q) = %q, want %q", tt.input, result, tt.expected)
+		req, err := parseNativeRequest(cmdText)
+		if err != nil {
+			t.Fatalf("%s: parseNativeRequest() error = %v", tt.file, err)
+		}
+		runs := map[string]execOptions{"native": {quiet: true, request: req}}
+		if _, err := exec.LookPath("curl"); err == nil {
+			runs["curl"] = execOptions{quiet: true}
+		}
+		for name, eo := range runs {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+			if _, err := execShellCommand(context.Background(), injectStatusWriteOut(cmdText), 1, eo); err != nil {
+				t.Fatalf("%s %s: execShellCommand() error = %v", tt.file, name, err)
 			}
-		})
-	}
-}
-
-func TestExtractPathParamsFromGenerate(t *testing.T) {
-	// This tests the same function but in generate context
-	tests := []struct {
-		path     string
-		expected int
-	}{
-		{"/users", 0},
-		{"/users/{id}", 1},
-		{"/users/{userId}/posts/{postId}", 2},
-		{"/api/{version}/users/{id}", 2},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.path, func(t *testing.T) {
-			params := extractPathParams(tt.path)
-			if len(params) != tt.expected {
-				t.Errorf("extractPathParams(%q) returned %d params, want %d", tt.path, len(params), tt.expected)
+			mu.Lock()
+			if len(received) != 1 || received[0] != tt.want {
+				t.Errorf("%s %s: server received %q, want %s", tt.file, name, received, tt.want)
 			}
-		})
+			mu.Unlock()
+		}
 	}
 }
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// grepOptions are the options of curly grep
+type grepOptions struct {
+	ignoreCase bool
+	// context is the number of lines printed around each match
+	context int
+}
+
+// grepLine is a line of a file curly grep prints, a match or context
+type grepLine struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// grepResult is a file matching curly grep, with its matching lines and
+// those around them
+type grepResult struct {
+	File  string     `json:"file"`
+	Lines []grepLine `json:"lines"`
+}
+
+func NewGrepCmd() *cobra.Command {
+	var opts grepOptions
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:               "grep <pattern> [collection-dir]",
+		Short:             "Print the .curl files of a collection matching a regular expression, with the lines around each match",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeDirAt(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			if opts.context < 0 {
+				return fmt.Errorf("context cannot be negative, got %d", opts.context)
+			}
+			results, err := grepCollection(dir, args[0], opts)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return writeJSON(cmd.OutOrStdout(), results)
+			}
+			printGrepResults(cmd.OutOrStdout(), results)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.ignoreCase, "ignore-case", "i", false, "Match the pattern in any case")
+	cmd.Flags().IntVarP(&opts.context, "context", "C", 1, "Print this many lines before and after each match")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the matching files and lines as a JSON array")
+
+	return cmd
+}
+
+// grepCollection searches the .curl files of the collection in dir for the
+// regular expression pattern
+func grepCollection(dir, pattern string, opts grepOptions) ([]grepResult, error) {
+	if opts.ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	paths, err := findEndpoints(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []grepResult{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+		// shown marks the lines printed: the matches and their context
+		shown := make([]int, len(lines))
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			for j := max(0, i-opts.context); j <= min(len(lines)-1, i+opts.context); j++ {
+				shown[j] = max(shown[j], 1)
+			}
+			shown[i] = 2
+		}
+
+		var result grepResult
+		for i, s := range shown {
+			if s > 0 {
+				result.Lines = append(result.Lines, grepLine{Line: i + 1, Text: lines[i], Match: s == 2})
+			}
+		}
+		if len(result.Lines) == 0 {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		result.File = filepath.ToSlash(rel)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// printGrepResults prints each file of results followed by its lines,
+// numbered, with a colon after the numbers of matches and a dash after those
+// of context, and -- between lines that aren't next to each other
+func printGrepResults(out io.Writer, results []grepResult) {
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No matches")
+		return
+	}
+	for i, result := range results {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintln(out, result.File)
+		for j, line := range result.Lines {
+			if j > 0 && line.Line != result.Lines[j-1].Line+1 {
+				fmt.Fprintln(out, "--")
+			}
+			sep := "-"
+			if line.Match {
+				sep = ":"
+			}
+			fmt.Fprintf(out, "%d%s%s\n", line.Line, sep, line.Text)
+		}
+	}
+}
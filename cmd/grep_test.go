@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGrepCollection(t *testing.T) {
+	dir := generateFixtureCollection(t)
+
+	tests := []struct {
+		name    string
+		pattern string
+		opts    grepOptions
+		want    []string
+	}{
+		{name: "one file", pattern: "tenantId", want: []string{"users/GET_users.curl"}},
+		{name: "several files", pattern: "^curl", want: []string{"orders/DELETE_orders__id.curl", "users/GET_users.curl", "users/POST_users.curl"}},
+		{name: "case", pattern: "tenantid", want: []string{}},
+		{name: "ignoring case", pattern: "tenantid", opts: grepOptions{ignoreCase: true}, want: []string{"users/GET_users.curl"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := grepCollection(dir, tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("grepCollection() error = %v", err)
+			}
+			files := []string{}
+			for _, r := range results {
+				files = append(files, r.File)
+			}
+			if strings.Join(files, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+		})
+	}
+
+	if _, err := grepCollection(dir, "(", grepOptions{}); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("grepCollection() error = %v, want an invalid pattern", err)
+	}
+}
+
+func TestGrepContext(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"GET_users.curl": "# GET /users\nA=1\nB=2\nC=3\nD=4\nE=5\nF=6\ncurl -s \"http://localhost/users?b=$B&f=$F\"",
+	})
+
+	results, err := grepCollection(dir, "^[BF]=", grepOptions{context: 1})
+	if err != nil {
+		t.Fatalf("grepCollection() error = %v", err)
+	}
+	var out bytes.Buffer
+	printGrepResults(&out, results)
+	want := "GET_users.curl\n2-A=1\n3:B=2\n4-C=3\n--\n6-E=5\n7:F=6\n8-curl -s \"http://localhost/users?b=$B&f=$F\"\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	cmd := NewGrepCmd()
+	cmd.SetArgs([]string{"B=2", dir, "-C", "0", "--json"})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var got []grepResult
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, out.String())
+	}
+	if len(got) != 1 || len(got[0].Lines) != 1 || got[0].Lines[0] != (grepLine{Line: 3, Text: "B=2", Match: true}) {
+		t.Errorf("results = %+v, want line 3 of GET_users.curl", got)
+	}
+}
@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/internal/output"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// historyDir is where the commands curly ran are kept, in the home directory
+const historyDir = ".curly/history"
+
+// historyLimit is how many commands the history keeps, the oldest being
+// dropped first
+const historyLimit = 500
+
+// historyEntry is a command curly ran, as the history keeps it
+type historyEntry struct {
+	Time time.Time `json:"time"`
+	// File and Dir are the .curl file the command was prepared from and its
+	// collection directory, for the environments of a replay
+	File        string `json:"file"`
+	Dir         string `json:"dir"`
+	Environment string `json:"environment,omitempty"`
+	// Command is what ran, with the variables of the environment, --var and
+	// the injected flags applied
+	Command string `json:"command"`
+	// Redacted tells the secrets in Command were replaced by ****
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+func NewHistoryCmd() *cobra.Command {
+	var opts runOptions
+	var vars []string
+	var replay int
+	var yes bool
+	var raw bool
+	var noHistory bool
+
+	cmd := &cobra.Command{
+		Use:          "history",
+		Short:        "List the commands curly ran, newest first, and run one of them again",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := historyPath()
+			if err != nil {
+				return err
+			}
+			entries, err := loadHistory(dir)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No history yet")
+				return nil
+			}
+
+			if replay == 0 {
+				lines := make([]string, len(entries))
+				for i, entry := range entries {
+					lines[i] = formatHistoryEntry(i+1, entry)
+				}
+				if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+					fmt.Fprintln(cmd.OutOrStdout(), strings.Join(lines, "\n"))
+					return nil
+				}
+				selected, err := fzfSelect("Replay: ", lines)
+				if err != nil || selected == "" {
+					return err
+				}
+				replay, _ = strconv.Atoi(strings.Fields(selected)[0])
+			}
+			if replay < 1 || replay > len(entries) {
+				return fmt.Errorf("no run %d in the history, it holds %d", replay, len(entries))
+			}
+			entry := entries[replay-1]
+
+			overrides, err := run.ParseVarOverrides(vars)
+			if err != nil {
+				return err
+			}
+			opts.overrides = overrides
+			cmdText, err := replayCommand(entry, opts)
+			if err != nil {
+				return err
+			}
+			if opts.envName == "" {
+				opts.envName = entry.Environment
+			}
+			if !yes && isTerminal(os.Stdin) {
+				if err := confirmRun(os.Stdin, os.Stderr, cmdText, opts.envName, 1, false); err != nil {
+					return err
+				}
+			}
+			if !noHistory {
+				recordHistory(cmdText, entry.File, entry.Dir, opts.envName, !opts.showSecrets)
+			}
+			pretty := !raw && isTerminal(os.Stdout)
+			_, err = execCmd(cmdText, execOptions{times: 1, verbose: opts.verbose, pretty: pretty, color: pretty && output.Supported()})
+			return err
+		},
+	}
+
+	cmd.Flags().IntVar(&replay, "replay", 0, "Run the command with this number in the list again, 1 being the latest")
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Run the command against this environment from envs.yml instead of the one it ran against, repeatable to layer environments")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Override a variable assigned in the command, like one redacted in the history, as KEY=VALUE (repeatable)")
+	cmd.Flags().BoolVar(&opts.noAuthCache, "no-auth-cache", false, "Fetch a new token for the environment's auth block instead of using the cached one")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run DELETE requests without asking for confirmation")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print responses as they came back instead of pretty-printing JSON in a terminal")
+	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Don't add the replayed command to the history")
+	cmd.Flags().BoolVar(&opts.showSecrets, "show-secrets", false, "Keep the secrets of the replayed command in the history instead of redacting them")
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Show detailed output")
+
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(-1))
+
+	return cmd
+}
+
+// historyPath returns the history directory in the home directory
+func historyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the history: %w", err)
+	}
+	return filepath.Join(home, filepath.FromSlash(historyDir)), nil
+}
+
+// recordHistory adds cmdText, prepared from file in the collection dir for
+// environment envName, to the history, with its secrets redacted when redact.
+// A history that can't be written is only a warning
+func recordHistory(cmdText, file, dir, envName string, redact bool) {
+	entry := historyEntry{Time: time.Now(), File: file, Dir: dir, Environment: envName, Command: cmdText}
+	if abs, err := filepath.Abs(file); err == nil {
+		entry.File = abs
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		entry.Dir = abs
+	}
+	if redact {
+		entry.Command = newRedactor(cmdText).redact(cmdText)
+		entry.Redacted = entry.Command != cmdText
+	}
+
+	path, err := historyPath()
+	if err == nil {
+		err = saveHistory(path, entry, historyLimit)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save the command to the history: %v\n", err)
+	}
+}
+
+// saveHistory writes entry to the history in dir, readable by the user only,
+// and drops the oldest entries beyond limit
+func saveHistory(dir string, entry historyEntry, limit int) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Names sort in the order the commands ran
+	name := filepath.Join(dir, fmt.Sprintf("%d.json", entry.Time.UnixNano()))
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return err
+	}
+	return pruneHistory(dir, limit)
+}
+
+// historyFiles returns the entries of the history in dir, oldest first
+func historyFiles(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range dirEntries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// pruneHistory removes the oldest entries of the history in dir until it
+// holds at most limit
+func pruneHistory(dir string, limit int) error {
+	files, err := historyFiles(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > limit {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// loadHistory reads the history in dir, newest first, skipping entries that
+// can't be read
+func loadHistory(dir string) ([]historyEntry, error) {
+	files, err := historyFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history: %w", err)
+	}
+	entries := make([]historyEntry, 0, len(files))
+	for i := len(files) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+		var entry historyEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Command == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// formatHistoryEntry formats entry as line n of the history list
+func formatHistoryEntry(n int, entry historyEntry) string {
+	env := entry.Environment
+	if env == "" {
+		env = "-"
+	}
+	req := firstRequest(entry.Command)
+	return fmt.Sprintf("%3d  %s  %-8s  %s %s  (%s)", n, entry.Time.Local().Format(time.DateTime), env, req.method, req.url, filepath.Base(entry.File))
+}
+
+// replayCommand prepares the command of entry to run again, as it ran or
+// against environment opts.envName, whose variables are applied over it like
+// over a .curl file. Secrets redacted in the history must be provided again by
+// the environment or --var
+func replayCommand(entry historyEntry, opts runOptions) (string, error) {
+	if opts.envName == "" {
+		opts.envName = entry.Environment
+	}
+	cmdText, err := prepareCommand(entry.Command, entry.File, entry.Dir, opts)
+	if err != nil {
+		return "", err
+	}
+	if !entry.Redacted {
+		return cmdText, nil
+	}
+
+	var redacted []string
+	for _, v := range resolveFileVariables(cmdText) {
+		if strings.Contains(v.value, redactedValue) {
+			redacted = append(redacted, v.name)
+		}
+	}
+	if len(redacted) > 0 {
+		return "", fmt.Errorf("the history has %s redacted, pass it again with --var %s=...", strings.Join(redacted, ", "), redacted[0])
+	}
+	if strings.Contains(cmdText, redactedValue) {
+		fmt.Fprintf(os.Stderr, "Warning: the command has values redacted in the history that no variable provides, they are sent as %s\n", redactedValue)
+	}
+	return cmdText, nil
+}
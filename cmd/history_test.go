@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestPruneHistory(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		entry := historyEntry{Time: start.Add(time.Duration(i) * time.Minute), Command: fmt.Sprintf("curl x/%d", i)}
+		if err := saveHistory(dir, entry, 3); err != nil {
+			t.Fatalf("saveHistory() error = %v", err)
+		}
+	}
+
+	entries, err := loadHistory(dir)
+	if err != nil {
+		t.Fatalf("loadHistory() error = %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Command)
+	}
+	if want := "curl x/4,curl x/3,curl x/2"; strings.Join(got, ",") != want {
+		t.Errorf("loadHistory() = %v, want the 3 newest first: %s", got, want)
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cmdText := "BASE_URL=\"http://localhost:8080\"\nTOKEN=\"s3cr3t\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" \"${BASE_URL}/users\""
+
+	recordHistory(cmdText, "collection/GET_users.curl", "collection", "dev", true)
+	recordHistory(cmdText, "collection/GET_users.curl", "collection", "dev", false)
+
+	entries, err := loadHistory(filepath.Join(home, ".curly", "history"))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("loadHistory() = %d entries, %v, want 2", len(entries), err)
+	}
+	redacted, kept := entries[1], entries[0]
+	if !redacted.Redacted || strings.Contains(redacted.Command, "s3cr3t") || !strings.Contains(redacted.Command, `TOKEN="****"`) {
+		t.Errorf("redacted entry = %+v", redacted)
+	}
+	if kept.Redacted || kept.Command != cmdText {
+		t.Errorf("entry with --show-secrets = %+v, want the command as it ran", kept)
+	}
+	if !filepath.IsAbs(redacted.File) || !filepath.IsAbs(redacted.Dir) || redacted.Environment != "dev" {
+		t.Errorf("entry = %+v, want absolute paths and the environment", redacted)
+	}
+	if line := formatHistoryEntry(1, redacted); !strings.Contains(line, "dev") || !strings.Contains(line, "GET http://localhost:8080/users") || !strings.HasSuffix(line, "(GET_users.curl)") {
+		t.Errorf("formatHistoryEntry() = %q", line)
+	}
+}
+
+func TestHistoryReplaysRedactedSecret(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("Authorization"))
+		mu.Unlock()
+	}))
+	defer server.Close()
+	recordHistory("TOKEN=\"s3cr3t\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" \""+server.URL+"/users\"", "GET_users.curl", t.TempDir(), "", true)
+
+	entries, err := loadHistory(filepath.Join(home, ".curly", "history"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("loadHistory() = %d entries, %v, want 1", len(entries), err)
+	}
+	if command := entries[0].Command; strings.Contains(command, "s3cr3t") || !strings.Contains(command, `TOKEN="****"`) || !strings.Contains(command, "Bearer ${TOKEN}") {
+		t.Errorf("recorded command = %q, want the value redacted and the reference kept", command)
+	}
+
+	cmd := NewHistoryCmd()
+	cmd.SetArgs([]string{"--replay", "1", "--yes", "--var", "TOKEN=fresh"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != "Bearer fresh" {
+		t.Errorf("replay sent Authorization %q, want Bearer fresh", got)
+	}
+}
+
+func TestReplayCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"envs.yml": "environments:\n  dev:\n    BASE_URL: \"http://dev.local\"\n    TOKEN: \"dev-token\"\n  staging:\n    BASE_URL: \"http://staging.local\"\n    TOKEN: \"staging-token\"\n",
+	})
+	entry := historyEntry{
+		File:        filepath.Join(dir, "GET_users.curl"),
+		Dir:         dir,
+		Environment: "dev",
+		Command:     "BASE_URL=\"http://dev.local\"\nTOKEN=\"****\"\nID=\"42\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" \"${BASE_URL}/users/${ID}\"",
+		Redacted:    true,
+	}
+
+	tests := []struct {
+		name    string
+		entry   historyEntry
+		opts    runOptions
+		want    []string
+		wantErr string
+	}{
+		{name: "as it ran", entry: entry, want: []string{`BASE_URL="http://dev.local"`, `TOKEN="dev-token"`, `ID="42"`}},
+		{name: "other environment", entry: entry, opts: runOptions{envName: "staging"}, want: []string{`BASE_URL="http://staging.local"`, `TOKEN="staging-token"`}},
+		{name: "--var", entry: entry, opts: runOptions{overrides: run.Environment{"ID": "7"}}, want: []string{`ID="7"`}},
+		{name: "secret no environment provides", entry: func() historyEntry { e := entry; e.Environment = ""; return e }(), wantErr: "the history has TOKEN redacted, pass it again with --var TOKEN=..."},
+		{name: "secret from --var", entry: func() historyEntry { e := entry; e.Environment = ""; return e }(), opts: runOptions{overrides: run.Environment{"TOKEN": "t"}}, want: []string{`TOKEN="t"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdText, err := replayCommand(tt.entry, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("replayCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("replayCommand() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(cmdText, want) {
+					t.Errorf("replayCommand() = %q, want it to contain %s", cmdText, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryCmdReplay(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	server := echoServer(t)
+	recordHistory("curl -s \""+server.URL+"/replayed\"", "GET_replayed.curl", t.TempDir(), "", true)
+
+	out, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	cmd := NewHistoryCmd()
+	cmd.SetArgs([]string{"--replay", "1", "--yes"})
+	err = cmd.Execute()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	printed, _ := os.ReadFile(out.Name())
+	if !strings.Contains(string(printed), "GET /replayed") {
+		t.Errorf("replay printed %q, want the echoed request", printed)
+	}
+
+	// The replay went to the history too
+	entries, _ := loadHistory(filepath.Join(home, ".curly", "history"))
+	if len(entries) != 2 {
+		t.Errorf("history has %d entries after the replay, want 2", len(entries))
+	}
+
+	cmd = NewHistoryCmd()
+	cmd.SetArgs([]string{"--replay", "3"})
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "no run 3 in the history, it holds 2") {
+		t.Errorf("Execute() error = %v, want no run 3", err)
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// initEnvsFile is the starter envs.yml written by curly init
+const initEnvsFile = `# Environment configurations for the collection
+# Usage: curly -e dev
+environments:
+  dev:
+    BASE_URL: "` + generate.DefaultDevBaseURL + `"
+  staging:
+    BASE_URL: "https://staging.example.com"
+`
+
+// initExampleFile is the example .curl written by curly init, laid out the
+// same way as generated files so it can be copied for new endpoints
+const initExampleFile = `# POST /users/{id}/notes
+# Example request, copy this file to add an endpoint by hand
+
+#### Variables ####
+
+# Overridden by envs.yml when run with -e
+BASE_URL="` + generate.DefaultDevBaseURL + `"
+
+#### Path Parameters ####
+ID="42"
+
+#### Headers ####
+# Any variable can be overridden per environment in envs.yml
+AUTHORIZATION="Bearer TOKEN"
+
+#### Body ####
+TEXT="Hello from curly"
+
+# Everything from the first line that isn't a comment or a blank line is run
+# by the shell, so the variables above are expanded in the command below.
+# The heredoc delimiter is unquoted so ${TEXT} is expanded in the body too;
+# quote it ('EOF') to send the body literally
+curl -s -X POST "${BASE_URL}/users/${ID}/notes" \
+  -H "Content-Type: application/json" \
+  -H "Accept: application/json" \
+  -H "Authorization: ${AUTHORIZATION}" \
+  --data-binary @- << EOF
+{
+  "text": "${TEXT}"
+}
+EOF
+`
+
+// initEndpointMethods are the methods accepted by --endpoint
+var initEndpointMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE"}
+
+func NewInitCmd() *cobra.Command {
+	var endpoint string
+
+	cmd := &cobra.Command{
+		Use:               "init [dir]",
+		Short:             "Scaffold a collection by hand, for APIs without an OpenAPI spec",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "collection"
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			return initCollection(dir, endpoint)
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", `Also create a .curl file for this endpoint, e.g. "POST /users/{id}"`)
+
+	return cmd
+}
+
+// initCollection creates dir with a starter envs.yml, an example .curl file
+// and optionally a file for endpoint. Nothing is written if any of the files
+// already exists
+func initCollection(dir, endpoint string) error {
+	type scaffoldFile struct {
+		name    string
+		content string
+	}
+	files := []scaffoldFile{
+		{name: "envs.yml", content: initEnvsFile},
+		{name: "example.curl", content: initExampleFile},
+	}
+
+	if endpoint != "" {
+		method, path, err := parseEndpoint(endpoint)
+		if err != nil {
+			return err
+		}
+		files = append(files, scaffoldFile{
+			name:    fmt.Sprintf("%s_%s.curl", method, generate.SanitizePath(path)),
+			content: generate.RenderEndpoint(method, path),
+		})
+	}
+
+	for _, file := range files {
+		target := filepath.Join(dir, file.name)
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("refusing to overwrite existing %s", target)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to check %s: %w", target, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	for _, file := range files {
+		target := filepath.Join(dir, file.name)
+		if err := os.WriteFile(target, []byte(file.content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		fmt.Printf("Created %s\n", target)
+	}
+
+	fmt.Printf("Initialized collection in %s/\n", dir)
+	return nil
+}
+
+// parseEndpoint splits an --endpoint value like "POST /users/{id}" into its
+// upper-cased method and path
+func parseEndpoint(endpoint string) (string, string, error) {
+	fields := strings.Fields(endpoint)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid --endpoint %q, expected \"METHOD /path\"", endpoint)
+	}
+	method, path := strings.ToUpper(fields[0]), fields[1]
+
+	known := false
+	for _, m := range initEndpointMethods {
+		if m == method {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "", "", fmt.Errorf("invalid --endpoint %q, method must be one of %s", endpoint, strings.Join(initEndpointMethods, ", "))
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("invalid --endpoint %q, path must start with /", endpoint)
+	}
+	return method, path, nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestInitCollection(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		wantErr   string
+		wantFiles []string
+		want      map[string][]string
+	}{
+		{
+			name:      "scaffold without endpoint",
+			wantFiles: []string{"envs.yml", "example.curl"},
+			want: map[string][]string{
+				"envs.yml": {"  dev:\n    BASE_URL: \"http://localhost:8081\"", "  staging:\n    BASE_URL:"},
+			},
+		},
+		{
+			name:      "endpoint with path variables and body",
+			endpoint:  "post /users/{userId}/notes",
+			wantFiles: []string{"envs.yml", "example.curl", "POST_users__userId_notes.curl"},
+			want: map[string][]string{
+				"POST_users__userId_notes.curl": {
+					"# POST /users/{userId}/notes\n",
+					"#### Path Parameters ####\nUSERID=\"VALUE\"\n",
+					`curl -s -X POST "${BASE_URL}/users/${USERID}/notes"`,
+					"--data-binary @- << 'EOF'\n{}\nEOF\n",
+				},
+			},
+		},
+		{
+			name:      "endpoint without body",
+			endpoint:  "GET /health",
+			wantFiles: []string{"envs.yml", "example.curl", "GET_health.curl"},
+			want: map[string][]string{
+				"GET_health.curl": {`curl -s -X GET "${BASE_URL}/health"` + "\n"},
+			},
+		},
+		{
+			name:     "unknown method",
+			endpoint: "FETCH /users",
+			wantErr:  "method must be one of",
+		},
+		{
+			name:     "missing path",
+			endpoint: "POST",
+			wantErr:  `expected "METHOD /path"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "collection")
+			err := initCollection(dir, tt.endpoint)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("initCollection() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("initCollection() created %s despite the error", dir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("initCollection() error = %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", dir, err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			if strings.Join(got, ",") != strings.Join(sortedCopy(tt.wantFiles), ",") {
+				t.Errorf("created files = %v, want %v", got, tt.wantFiles)
+			}
+
+			for name, wants := range tt.want {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", name, err)
+				}
+				for _, want := range wants {
+					if !strings.Contains(string(data), want) {
+						t.Errorf("%s missing %q, got:\n%s", name, want, data)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInitCollectionRefusesToOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "POST_users.curl")
+	if err := os.WriteFile(existing, []byte("mine"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	err := initCollection(dir, "POST /users")
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite") {
+		t.Fatalf("initCollection() error = %v, want refusal", err)
+	}
+
+	// Nothing is written when any file would be overwritten
+	for _, name := range []string{"envs.yml", "example.curl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was written despite the refusal", name)
+		}
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "mine" {
+		t.Errorf("existing file was modified: %q", data)
+	}
+}
+
+func TestInitExampleFileRuns(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var gotPath, gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := initCollection(dir, ""); err != nil {
+		t.Fatalf("initCollection() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "example.curl"))
+	if err != nil {
+		t.Fatalf("failed to read example.curl: %v", err)
+	}
+
+	content := strings.Replace(string(data), `BASE_URL="http://localhost:8081"`, `BASE_URL="`+server.URL+`"`, 1)
+	if out, err := exec.Command("sh", "-c", run.ExtractShellCommand(content)).CombinedOutput(); err != nil {
+		t.Fatalf("example command failed: %v\n%s", err, out)
+	}
+
+	if gotPath != "/users/42/notes" {
+		t.Errorf("server got path %q, want /users/42/notes", gotPath)
+	}
+	if gotAuth != "Bearer TOKEN" {
+		t.Errorf("server got Authorization %q, want Bearer TOKEN", gotAuth)
+	}
+	if !strings.Contains(gotBody, `"text": "Hello from curly"`) {
+		t.Errorf("server got body %q, want the expanded TEXT variable", gotBody)
+	}
+}
+
+func sortedCopy(s []string) []string {
+	sorted := append([]string{}, s...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -3,12 +3,20 @@
 package cmd
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/ErikVib/curly/pkg/generate"
+	"github.com/ErikVib/curly/pkg/run"
 )
 
 // Integration tests require the binary to be built first
@@ -48,7 +56,7 @@ paths:
 	os.Chdir(tmpDir)
 
 	// Test generate command
-	err := generateCollection(openapiFile, "collection")
+	_, err := generate.Generate(generate.Options{Spec: openapiFile, OutDir: "collection"})
 	if err != nil {
 		t.Fatalf("generate failed: %v", err)
 	}
@@ -65,12 +73,108 @@ paths:
 	}
 }
 
+func TestEndToEndGenerateMultiFileSpec(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	specDir := filepath.Join(tmpDir, "spec")
+	files := map[string]string{
+		"openapi.yml": `openapi: 3.0.1
+info:
+  title: Multi-file API
+  version: v1
+paths:
+  /users:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/User'
+      responses:
+        '200':
+          description: OK
+  /orders:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: './schemas/missing.yml#/Order'
+      responses:
+        '200':
+          description: OK
+components:
+  schemas:
+    User:
+      $ref: './schemas/user.yml#/User'
+    Broken:
+      $ref: './schemas/missing.yml#/Broken'
+`,
+		"schemas/user.yml": `User:
+  type: object
+  properties:
+    name:
+      type: string
+      example: alice
+    address:
+      $ref: './address.yml#/Address'
+`,
+		"schemas/address.yml": `Address:
+  type: object
+  properties:
+    city:
+      type: string
+      example: Oslo
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(specDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create spec dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	// Generate from a sibling directory so refs can't accidentally resolve
+	// against the working directory
+	workDir := filepath.Join(tmpDir, "work")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		t.Fatalf("failed to create work dir: %v", err)
+	}
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(workDir)
+
+	if _, err := generate.Generate(generate.Options{Spec: filepath.Join("..", "spec", "openapi.yml"), OutDir: "collection"}); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workDir, "collection", "POST_users.curl"))
+	if err != nil {
+		t.Fatalf("failed to read POST_users.curl: %v", err)
+	}
+	for _, want := range []string{`NAME="alice"`, `"city": "Oslo"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("POST_users.curl missing %q, got:\n%s", want, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(workDir, "collection", "POST_orders.curl")); !os.IsNotExist(err) {
+		t.Errorf("POST_orders.curl should be skipped since its ref can't be resolved")
+	}
+}
+
 func TestExecutionStats(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
 	}
 
-	stats := &ExecutionStats{
+	stats := &run.ExecutionStats{
 		Total:     100,
 		StartTime: time.Now(),
 	}
@@ -105,7 +209,7 @@ func TestConcurrentStatsRecording(t *testing.T) {
 		t.Skip("skipping integration test in short mode")
 	}
 
-	stats := &ExecutionStats{
+	stats := &run.ExecutionStats{
 		Total:     1000,
 		StartTime: time.Now(),
 	}
@@ -148,6 +252,244 @@ func TestConcurrentStatsRecording(t *testing.T) {
 	}
 }
 
+func TestExecCmdFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmdText     string
+		times       int
+		parallel    int
+		maxFailures int
+		wantErr     string
+	}{
+		{
+			name:     "parallel failures exit non-zero",
+			cmdText:  "exit 3",
+			times:    6,
+			parallel: 3,
+			wantErr:  "6 of 6 requests failed",
+		},
+		{
+			name:     "sequential failure stops the run",
+			cmdText:  "exit 3",
+			times:    6,
+			parallel: 1,
+			wantErr:  "1 of 6 requests failed, stopping",
+		},
+		{
+			name:     "single failure keeps its message",
+			cmdText:  "exit 3",
+			times:    1,
+			parallel: 1,
+			wantErr:  "command execution failed",
+		},
+		{
+			name:        "failures up to max-failures are tolerated",
+			cmdText:     `if mkdir "$CURLY_TEST_MARKER" 2>/dev/null; then exit 3; fi`,
+			times:       4,
+			parallel:    2,
+			maxFailures: 1,
+		},
+		{
+			name:        "sequential failures up to max-failures are tolerated",
+			cmdText:     `if mkdir "$CURLY_TEST_MARKER" 2>/dev/null; then exit 3; fi`,
+			times:       4,
+			parallel:    1,
+			maxFailures: 1,
+		},
+		{
+			name:     "successes exit zero",
+			cmdText:  "true",
+			times:    4,
+			parallel: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CURLY_TEST_MARKER", filepath.Join(t.TempDir(), "failed-once"))
+			_, err := execCmd(tt.cmdText, execOptions{times: tt.times, parallel: tt.parallel, maxFailures: tt.maxFailures})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("execCmd() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("execCmd() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecCmdDuration(t *testing.T) {
+	for _, parallel := range []int{1, 3} {
+		start := time.Now()
+		stats, err := execCmd("sleep 0.05", execOptions{times: 1, duration: 300 * time.Millisecond, parallel: parallel})
+		if err != nil {
+			t.Fatalf("execCmd() with parallel %d error = %v", parallel, err)
+		}
+		if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+			t.Errorf("execCmd() with parallel %d returned after %s, before the duration passed", parallel, elapsed)
+		}
+		if stats.Total < 2 || stats.Total != int(stats.Success) {
+			t.Errorf("execCmd() with parallel %d counted Total %d, Success %d, want the completed requests", parallel, stats.Total, stats.Success)
+		}
+		if stats.Total%parallel != 0 || len(stats.Latencies) != stats.Total {
+			t.Errorf("execCmd() with parallel %d ran %d requests with %d samples, want whole batches", parallel, stats.Total, len(stats.Latencies))
+		}
+	}
+}
+
+func TestExecCmdCancelledCountsCompleted(t *testing.T) {
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	stats, err := execCmd("sleep 0.05", execOptions{times: 1000, parallel: 2})
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("execCmd() error = %v, want it cancelled", err)
+	}
+	if stats.Total == 0 || stats.Total >= 1000 || stats.Total != int(stats.Success) {
+		t.Errorf("execCmd() counted Total %d, Success %d, want the completed requests", stats.Total, stats.Success)
+	}
+}
+
+func TestExecCmdSlowRequestDoesNotStallOthers(t *testing.T) {
+	// The first request to claim the marker waits for the other 10 to finish,
+	// which only happens if the second worker keeps going without it
+	dir := t.TempDir()
+	t.Setenv("CURLY_TEST_DIR", dir)
+	if err := os.Mkdir(filepath.Join(dir, "done"), 0755); err != nil {
+		t.Fatalf("failed to create marker dir: %v", err)
+	}
+	cmdText := `if mkdir "$CURLY_TEST_DIR/slow" 2>/dev/null; then
+  i=0
+  while [ "$(ls "$CURLY_TEST_DIR/done" | wc -l)" -lt 10 ] && [ $i -lt 100 ]; do sleep 0.02; i=$((i+1)); done
+  [ "$(ls "$CURLY_TEST_DIR/done" | wc -l)" -ge 10 ]
+else
+  touch "$CURLY_TEST_DIR/done/$$"
+fi`
+
+	stats, err := execCmd(cmdText, execOptions{times: 11, parallel: 2})
+	if err != nil {
+		t.Fatalf("execCmd() error = %v, the slow request held up the other worker", err)
+	}
+	if stats.Success != 11 {
+		t.Errorf("execCmd() recorded %d successes, want 11", stats.Success)
+	}
+}
+
+func TestExecCmdDelayIsPerWorker(t *testing.T) {
+	start := time.Now()
+	stats, err := execCmd("true", execOptions{times: 4, parallel: 2, delay: time.Second})
+	if err != nil {
+		t.Fatalf("execCmd() error = %v", err)
+	}
+	// Each worker runs two requests with one delay between them
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 1900*time.Millisecond {
+		t.Errorf("execCmd() took %s, want about one delay", elapsed)
+	}
+	if stats.Success != 4 {
+		t.Errorf("execCmd() recorded %d successes, want 4", stats.Success)
+	}
+}
+
+func TestExecCmdRate(t *testing.T) {
+	start := time.Now()
+	stats, err := execCmd("true", execOptions{times: 10, rate: 20, parallel: 5})
+	if err != nil {
+		t.Fatalf("execCmd() error = %v", err)
+	}
+	// 10 starts at 20/s are 9 intervals of 50ms apart
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Errorf("execCmd() at 20 req/s ran 10 requests in %s, faster than paced", elapsed)
+	}
+	if stats.Success != 10 || stats.TargetRate != 20 {
+		t.Errorf("execCmd() recorded %d successes at target %g, want 10 at 20", stats.Success, stats.TargetRate)
+	}
+}
+
+func TestRunPacedCancelsMidInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// At 0.5 req/s the second request would start 2s in
+	stats := &run.ExecutionStats{Total: 3, StartTime: time.Now()}
+	start := time.Now()
+	if _, cancelled := runPaced(ctx, "true", execOptions{times: 3, rate: 0.5}, 1, time.Time{}, stats); !cancelled {
+		t.Errorf("runPaced() cancelled = false, want true")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runPaced() took %s to notice the cancellation", elapsed)
+	}
+	if stats.Success != 1 {
+		t.Errorf("runPaced() ran %d requests, want 1", stats.Success)
+	}
+}
+
+func TestRunPoolCancelsRunningCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	// The trailing true keeps sh from exec'ing sleep, so sleep is a child
+	// holding the output open that has to be terminated too
+	stats := &run.ExecutionStats{Total: 4, StartTime: time.Now()}
+	start := time.Now()
+	_, cancelled := runPool(ctx, "sleep 30; true", execOptions{times: 4}, 2, time.Time{}, stats)
+	if !cancelled {
+		t.Errorf("runPool() cancelled = false, want true")
+	}
+	if elapsed := time.Since(start); elapsed > 1200*time.Millisecond {
+		t.Errorf("runPool() returned %s after starting, want within a second of cancelling", elapsed)
+	}
+	if stats.Success != 0 || stats.Failed != 0 {
+		t.Errorf("runPool() recorded %d successes and %d failures, want the cancelled runs left out", stats.Success, stats.Failed)
+	}
+}
+
+func TestExecCmdAborts(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdText string
+		eo      execOptions
+		wantErr string
+	}{
+		{
+			name:    "fail-fast drains in-flight workers",
+			cmdText: "sleep 0.02; exit 1",
+			eo:      execOptions{times: 100, parallel: 4, failFast: true},
+			wantErr: "aborted: --fail-fast stops at the first failure",
+		},
+		{
+			name:    "fail-fast with a rate",
+			cmdText: "exit 1",
+			eo:      execOptions{times: 100, parallel: 4, rate: 100, failFast: true},
+			wantErr: "aborted: --fail-fast stops at the first failure",
+		},
+		{
+			name:    "failure rate over the threshold",
+			cmdText: "exit 1",
+			eo:      execOptions{times: 100, parallel: 1, maxFailures: 100, maxFailureRate: 0.05},
+			wantErr: "aborted: failure rate 100.0% exceeded --max-failure-rate 0.05",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := execCmd(tt.cmdText, tt.eo)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("execCmd() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if stats.Aborted == "" {
+				t.Errorf("execCmd() stats not marked aborted")
+			}
+			if ran := stats.Success + stats.Failed; ran >= 100 || len(stats.Latencies) != int(ran) {
+				t.Errorf("execCmd() ran %d requests with %d samples, want it to stop early and finish in-flight ones", ran, len(stats.Latencies))
+			}
+		})
+	}
+}
+
 func TestApplyEnvironmentVarsIntegration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
@@ -183,7 +525,7 @@ curl -s -X GET "${BASE_URL}/test" -H "Authorization: ${TOKEN}"
 	}
 
 	// Load environment
-	config, err := loadEnvConfig(envsFile)
+	config, err := run.LoadEnvConfig(envsFile)
 	if err != nil {
 		t.Fatalf("failed to load env config: %v", err)
 	}
@@ -199,7 +541,7 @@ curl -s -X GET "${BASE_URL}/test" -H "Authorization: ${TOKEN}"
 		t.Fatalf("failed to read curl file: %v", err)
 	}
 
-	result := applyEnvironmentVars(string(content), testEnv)
+	result := run.ApplyEnvironmentVars(string(content), testEnv)
 
 	// Verify replacements
 	if !strings.Contains(result, `BASE_URL="http://test-server:8080"`) {
@@ -237,7 +579,7 @@ curl -s -X GET "${BASE_URL}/test"
 	}
 
 	// Test without insecure flag
-	cmdText, err := runFile(curlFile, tmpDir, "", false)
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{})
 	if err != nil {
 		t.Fatalf("runFile failed: %v", err)
 	}
@@ -250,7 +592,7 @@ curl -s -X GET "${BASE_URL}/test"
 	}
 
 	// Test with insecure flag
-	cmdTextInsecure, err := runFile(curlFile, tmpDir, "", true)
+	cmdTextInsecure, err := runFile(curlFile, tmpDir, runOptions{insecure: true})
 	if err != nil {
 		t.Fatalf("runFile with insecure failed: %v", err)
 	}
@@ -295,7 +637,7 @@ curl -s -X GET "${BASE_URL}/test" -H "Authorization: ${TOKEN}"
 	}
 
 	// Test with both env and insecure flag
-	cmdText, err := runFile(curlFile, tmpDir, "dev", true)
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{envName: "dev", insecure: true})
 	if err != nil {
 		t.Fatalf("runFile failed: %v", err)
 	}
@@ -313,3 +655,67 @@ curl -s -X GET "${BASE_URL}/test" -H "Authorization: ${TOKEN}"
 		t.Error("TOKEN was not replaced with env value")
 	}
 }
+
+func TestSessionCookieJar(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s3cr3t", Path: "/", HttpOnly: true})
+		case "/me":
+			if c, err := r.Cookie("sid"); err != nil || c.Value != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	for name, path := range map[string]string{"POST_login.curl": "/login", "GET_me.curl": "/me"} {
+		content := "BASE_URL=\"" + server.URL + "\"\ncurl -s \"${BASE_URL}" + path + "\"\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each run is a separate curly invocation, sharing only the jar
+	run := func(name string, opts runOptions) error {
+		t.Helper()
+		cmdText, err := runFile(filepath.Join(tmpDir, name), tmpDir, opts)
+		if err != nil {
+			t.Fatalf("runFile(%s) error = %v", name, err)
+		}
+		_, err = execCmd(cmdText, execOptions{times: 1, parallel: 1, quiet: true, expect: expectations{statuses: []statusPattern{"200"}}})
+		return err
+	}
+
+	session := runOptions{session: "alice"}
+	if err := run("GET_me.curl", session); err == nil {
+		t.Error("GET /me before logging in should get a 401")
+	}
+	if err := run("POST_login.curl", session); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := run("GET_me.curl", session); err != nil {
+		t.Errorf("GET /me in the logged in session failed: %v", err)
+	}
+	if err := run("GET_me.curl", runOptions{session: "bob"}); err == nil {
+		t.Error("GET /me in another session should get a 401")
+	}
+	if err := run("GET_me.curl", runOptions{}); err == nil {
+		t.Error("GET /me without a session should get a 401")
+	}
+
+	if err := clearSession(io.Discard, tmpDir, "alice"); err != nil {
+		t.Fatalf("clearSession() error = %v", err)
+	}
+	if err := run("GET_me.curl", session); err == nil {
+		t.Error("GET /me after clearing the session should get a 401")
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jwtPattern matches a JWT, three base64url segments, capturing the payload
+var jwtPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.([A-Za-z0-9_-]+)\.[A-Za-z0-9_-]*$`)
+
+// bearerPattern matches an Authorization: Bearer header, capturing its token
+var bearerPattern = regexp.MustCompile(`(?i)authorization:\s*bearer\s+([A-Za-z0-9._~+/=-]+)`)
+
+// jwtExpiry decodes the payload of token, without verifying it, and returns
+// its exp claim. ok is false for anything but a JWT with an exp
+func jwtExpiry(token string) (exp time.Time, ok bool) {
+	match := jwtPattern.FindStringSubmatch(token)
+	if match == nil {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(match[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	sec := int64(*claims.Exp)
+	return time.Unix(sec, 0), true
+}
+
+// bearerTokens returns the tokens of the Authorization: Bearer headers the
+// curl commands of cmdText send, with the file's variables expanded
+func bearerTokens(cmdText string) []string {
+	expanded, _ := expandCommandText(cmdText, resolveFileVariables(cmdText))
+	var tokens []string
+	for _, match := range bearerPattern.FindAllStringSubmatch(expanded, -1) {
+		tokens = append(tokens, match[1])
+	}
+	return tokens
+}
+
+// checkBearerTokens reports the bearer tokens cmdText sends that are JWTs
+// expired by now
+func checkBearerTokens(cmdText string, now time.Time) error {
+	var expired []string
+	seen := map[string]bool{}
+	for _, token := range bearerTokens(cmdText) {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if exp, ok := jwtExpiry(token); ok && !exp.After(now) {
+			expired = append(expired, fmt.Sprintf("expired %s ago, at %s", formatValidity(now.Sub(exp)), exp.UTC().Format(time.DateTime+" UTC")))
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return fmt.Errorf("bearer token is an expired JWT: %s", strings.Join(expired, "; "))
+}
+
+// jwtValidity describes how long the JWT at the end of value, like a token or
+// "Bearer <token>", is still valid for at now, or "" when it isn't a JWT
+// with an exp
+func jwtValidity(value string, now time.Time) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	exp, ok := jwtExpiry(fields[len(fields)-1])
+	if !ok {
+		return ""
+	}
+	if !exp.After(now) {
+		return "JWT expired " + formatValidity(now.Sub(exp)) + " ago"
+	}
+	return "JWT valid for " + formatValidity(exp.Sub(now))
+}
+
+// formatValidity formats d to the minute, or to the hour once it's days
+func formatValidity(d time.Duration) string {
+	if d >= 48*time.Hour {
+		d = d.Round(time.Hour)
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listFilter picks the endpoints curly list prints
+type listFilter struct {
+	methods []string
+	tags    []string
+	// text must appear in the method, path, summary or file, in any case
+	text string
+}
+
+// listedEndpoint is an endpoint of curly list, as --json prints it
+type listedEndpoint struct {
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Summary string   `json:"summary,omitempty"`
+	File    string   `json:"file"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func NewListCmd() *cobra.Command {
+	var filter listFilter
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:               "list [collection-dir]",
+		Short:             "Print the endpoints of a collection with their method, path, summary and file",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			endpoints, err := listEndpoints(dir, filter)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return writeJSON(cmd.OutOrStdout(), endpoints)
+			}
+			return printEndpoints(cmd.OutOrStdout(), endpoints)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&filter.methods, "method", nil, "Only list endpoints with this method (repeatable)")
+	cmd.Flags().StringArrayVar(&filter.tags, "tag", nil, "Only list files with this tag in a \"# tags:\" comment (repeatable)")
+	cmd.Flags().StringVar(&filter.text, "filter", "", "Only list endpoints with this text in their method, path, summary or file, in any case")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the endpoints as a JSON array")
+	cmd.RegisterFlagCompletionFunc("tag", completeTags(0))
+
+	return cmd
+}
+
+// listEndpoints reads the labels and tags of the .curl files of the
+// collection in dir, keeping those filter picks
+func listEndpoints(dir string, filter listFilter) ([]listedEndpoint, error) {
+	paths, err := findEndpoints(dir)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []listedEndpoint{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		label := parseEndpointLabel(string(content))
+		_, tags := suiteDirectives(string(content))
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		endpoint := listedEndpoint{Method: label.method, Path: label.path, Summary: label.summary, File: filepath.ToSlash(rel), Tags: tags}
+		if filter.matches(endpoint) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints, nil
+}
+
+// matches reports whether filter picks endpoint
+func (f listFilter) matches(endpoint listedEndpoint) bool {
+	if len(f.methods) > 0 {
+		found := false
+		for _, method := range f.methods {
+			if strings.EqualFold(method, endpoint.Method) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.tags) > 0 && !hasAnyTag(endpoint.Tags, f.tags) {
+		return false
+	}
+	if f.text != "" {
+		text := strings.ToLower(f.text)
+		for _, field := range []string{endpoint.Method, endpoint.Path, endpoint.Summary, endpoint.File} {
+			if strings.Contains(strings.ToLower(field), text) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// printEndpoints prints endpoints as a table
+func printEndpoints(out io.Writer, endpoints []listedEndpoint) error {
+	if len(endpoints) == 0 {
+		fmt.Fprintln(out, "No endpoints")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tSUMMARY\tFILE")
+	for _, e := range endpoints {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Method, e.Path, e.Summary, e.File)
+	}
+	return w.Flush()
+}
+
+// writeJSON prints v as indented JSON, leaving <, > and & as they are
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
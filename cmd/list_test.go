@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// generateFixtureCollection generates a collection with a file per tag
+// subdirectory from a small spec, tagging GET /users smoke
+func generateFixtureCollection(t *testing.T) string {
+	t.Helper()
+	tmp := t.TempDir()
+	spec := filepath.Join(tmp, "openapi.yml")
+	writeFiles(t, tmp, map[string]string{"openapi.yml": `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+servers:
+  - url: http://localhost:8080
+paths:
+  /users:
+    get:
+      tags: [users]
+      summary: List users
+      parameters:
+        - name: tenantId
+          in: query
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+    post:
+      tags: [users]
+      summary: Create user
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+      responses:
+        '201':
+          description: Created
+  /orders/{id}:
+    delete:
+      tags: [orders]
+      summary: Delete order
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '204':
+          description: Deleted
+`})
+	dir := filepath.Join(tmp, "collection")
+	if _, err := generate.Generate(generate.Options{Spec: spec, OutDir: dir, NameTemplate: "{{.Tag}}/{{.Method}}_{{.SanitizedPath}}"}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	path := filepath.Join(dir, "users", "GET_users.curl")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, append(content, "\n# tags: smoke\n"...), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return dir
+}
+
+func TestListEndpoints(t *testing.T) {
+	dir := generateFixtureCollection(t)
+
+	tests := []struct {
+		name   string
+		filter listFilter
+		want   []string
+	}{
+		{name: "all", want: []string{"orders/DELETE_orders__id.curl", "users/GET_users.curl", "users/POST_users.curl"}},
+		{name: "method", filter: listFilter{methods: []string{"post", "delete"}}, want: []string{"orders/DELETE_orders__id.curl", "users/POST_users.curl"}},
+		{name: "tag", filter: listFilter{tags: []string{"smoke"}}, want: []string{"users/GET_users.curl"}},
+		{name: "text in the summary", filter: listFilter{text: "CREATE"}, want: []string{"users/POST_users.curl"}},
+		{name: "text in the path", filter: listFilter{text: "/orders"}, want: []string{"orders/DELETE_orders__id.curl"}},
+		{name: "nothing", filter: listFilter{text: "nothing"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := listEndpoints(dir, tt.filter)
+			if err != nil {
+				t.Fatalf("listEndpoints() error = %v", err)
+			}
+			files := []string{}
+			for _, e := range endpoints {
+				files = append(files, e.File)
+			}
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	dir := generateFixtureCollection(t)
+
+	var out bytes.Buffer
+	cmd := NewListCmd()
+	cmd.SetArgs([]string{dir, "--tag", "smoke"})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	for _, want := range []string{"METHOD", "GET", "/users", "List users", "users/GET_users.curl"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output:\n%s\nwant it to contain %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	cmd = NewListCmd()
+	cmd.SetArgs([]string{dir, "--method", "GET", "--json"})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var endpoints []listedEndpoint
+	if err := json.Unmarshal(out.Bytes(), &endpoints); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, out.String())
+	}
+	want := []listedEndpoint{{Method: "GET", Path: "/users", Summary: "List users", File: "users/GET_users.curl", Tags: []string{"smoke"}}}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("endpoints = %+v, want %+v", endpoints, want)
+	}
+}
@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// mockEnvironment is the environment of envs.yml curly mock points at itself
+const mockEnvironment = "mock"
+
+// mockOptions are the options of curly mock
+type mockOptions struct {
+	// latency delays every response
+	latency time.Duration
+	// chaos is the fraction of requests answered with a 503 instead
+	chaos float64
+}
+
+// mockServer answers the operations of an OpenAPI spec with their examples
+type mockServer struct {
+	spec *specValidator
+	opts mockOptions
+	log  *requestLog
+}
+
+// requestLog prints a line per request a local server of curly answers,
+// whole so the lines of concurrent requests don't mix
+type requestLog struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// print logs that r was answered with status, with a note on how if any
+func (l *requestLog) print(r *http.Request, status int, note string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if note != "" {
+		fmt.Fprintf(l.w, "%s %s -> %d (%s)\n", r.Method, r.URL.RequestURI(), status, note)
+	} else {
+		fmt.Fprintf(l.w, "%s %s -> %d\n", r.Method, r.URL.RequestURI(), status)
+	}
+}
+
+// listenLocal listens on host and port, 0 for any free one, returning the
+// listener with the URL it's reached at
+func listenLocal(host string, port int) (net.Listener, string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen: %w", err)
+	}
+	return listener, "http://" + net.JoinHostPort(host, strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)), nil
+}
+
+// serveUntilInterrupted serves handler on listener until Ctrl+C, letting
+// the requests in flight finish
+func serveUntilInterrupted(listener net.Listener, handler http.Handler) error {
+	server := &http.Server{Handler: handler}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func NewMockCmd() *cobra.Command {
+	var opts mockOptions
+	var host string
+	var port int
+	var envsFile string
+
+	cmd := &cobra.Command{
+		Use:          "mock <openapi-file-or-url>",
+		Short:        "Serve the operations of an OpenAPI YAML/JSON with their examples, for a backend that isn't deployed yet",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.latency < 0 {
+				return fmt.Errorf("latency cannot be negative, got %s", opts.latency)
+			}
+			if opts.chaos < 0 || opts.chaos > 1 {
+				return fmt.Errorf("chaos must be between 0 and 1, got %g", opts.chaos)
+			}
+			spec, err := newSpecValidator(args[0])
+			if err != nil {
+				return err
+			}
+			listener, baseURL, err := listenLocal(host, port)
+			if err != nil {
+				return err
+			}
+			if len(spec.basePaths) > 0 {
+				baseURL += spec.basePaths[0]
+			}
+			if envsFile != "" {
+				if err := writeMockEnvironment(envsFile, baseURL); err != nil {
+					listener.Close()
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Set BASE_URL of the %s environment of %s to %s\n", mockEnvironment, envsFile, baseURL)
+			}
+			fmt.Fprintf(os.Stderr, "Serving %d operations of %s at %s, Ctrl+C to stop\n", spec.operationCount(), args[0], baseURL)
+
+			return serveUntilInterrupted(listener, &mockServer{spec: spec, opts: opts, log: &requestLog{w: cmd.ErrOrStderr()}})
+		},
+	}
+
+	cmd.Flags().StringVar(&host, "host", "localhost", "Listen on this host")
+	cmd.Flags().IntVar(&port, "port", 8080, "Listen on this port, 0 for any free one")
+	cmd.Flags().DurationVar(&opts.latency, "latency", 0, "Delay every response by this long, like 50ms")
+	cmd.Flags().Float64Var(&opts.chaos, "chaos", 0, "Answer this fraction of requests, like 0.05, with a 503 instead")
+	cmd.Flags().StringVar(&envsFile, "envs-file", "", "Set BASE_URL of the mock environment of this envs.yml to the server, adding it if needed, for curly -e mock")
+
+	return cmd
+}
+
+// operationCount returns how many operations the spec declares
+func (v *specValidator) operationCount() int {
+	n := 0
+	for _, r := range v.routes {
+		n += len(r.item.Operations())
+	}
+	return n
+}
+
+func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, route := m.serve(w, r)
+	m.log.print(r, status, route)
+}
+
+// serve answers r, returning the status it answered with and the path of
+// the operation it matched
+func (m *mockServer) serve(w http.ResponseWriter, r *http.Request) (int, string) {
+	if m.opts.latency > 0 {
+		select {
+		case <-time.After(m.opts.latency):
+		case <-r.Context().Done():
+			return 0, ""
+		}
+	}
+	if m.opts.chaos > 0 && rand.Float64() < m.opts.chaos {
+		return writeMockError(w, http.StatusServiceUnavailable, "injected by --chaos"), ""
+	}
+
+	route, params, err := m.spec.route(r.Method, r.URL.String())
+	if err != nil {
+		return writeMockError(w, http.StatusNotFound, err.Error()), ""
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+		return writeMockError(w, http.StatusBadRequest, "request doesn't match the spec", specViolations(err)...), route.Path
+	}
+
+	status, contentType, body := mockResponse(route, params)
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+	return status, route.Path
+}
+
+// writeMockError answers with status and a JSON error, with details
+func writeMockError(w http.ResponseWriter, status int, message string, details ...string) int {
+	body := struct {
+		Error   string   `json:"error"`
+		Details []string `json:"details,omitempty"`
+	}{message, details}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+	return status
+}
+
+// mockResponse returns the response of the operation of route: the first
+// success status it declares, or else its default or first one, with the
+// example of its JSON content, or else of its first content type. Fields of
+// the example named like a path parameter get the value of the request
+func mockResponse(route *routers.Route, params map[string]string) (int, string, []byte) {
+	status, response := mockStatus(route.Operation)
+	if response == nil || len(response.Content) == 0 {
+		return status, "", nil
+	}
+	contentType := "application/json"
+	if response.Content.Get(contentType) == nil {
+		types := make([]string, 0, len(response.Content))
+		for ct := range response.Content {
+			types = append(types, ct)
+		}
+		sort.Strings(types)
+		contentType = types[0]
+	}
+	mediaType := response.Content[contentType]
+	example := mediaTypeExample(mediaType, route.Spec)
+	if example == nil {
+		return status, contentType, nil
+	}
+	if text, ok := example.(string); ok && !isJSONContentType(contentType) {
+		return status, contentType, []byte(text)
+	}
+	if object, ok := example.(map[string]any); ok {
+		example = withPathParams(object, params)
+	}
+	body, err := json.MarshalIndent(example, "", "  ")
+	if err != nil {
+		return http.StatusInternalServerError, "", nil
+	}
+	return status, contentType, append(body, '\n')
+}
+
+// mockStatus picks the response of op curly mock answers with
+func mockStatus(op *openapi3.Operation) (int, *openapi3.Response) {
+	if op.Responses == nil {
+		return http.StatusOK, nil
+	}
+	codes := make([]string, 0, op.Responses.Len())
+	for code := range op.Responses.Map() {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	pick := func(code string) (int, *openapi3.Response) {
+		status, err := strconv.Atoi(strings.ReplaceAll(strings.ToUpper(code), "XX", "00"))
+		if err != nil {
+			status = http.StatusOK
+		}
+		return status, op.Responses.Value(code).Value
+	}
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			return pick(code)
+		}
+	}
+	if op.Responses.Default() != nil {
+		return http.StatusOK, op.Responses.Default().Value
+	}
+	if len(codes) > 0 {
+		return pick(codes[0])
+	}
+	return http.StatusOK, nil
+}
+
+// mediaTypeExample returns the example of mediaType: its own, the first of
+// its named examples, or one generated from its schema
+func mediaTypeExample(mediaType *openapi3.MediaType, doc *openapi3.T) any {
+	if mediaType.Example != nil {
+		return mediaType.Example
+	}
+	names := make([]string, 0, len(mediaType.Examples))
+	for name := range mediaType.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ref := mediaType.Examples[name]; ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return ref.Value.Value
+		}
+	}
+	if mediaType.Schema != nil && mediaType.Schema.Value != nil {
+		if example := generate.SchemaExample(mediaType.Schema.Value); example != nil {
+			return example
+		}
+		return generate.ExampleFromSchema(mediaType.Schema.Value, doc)
+	}
+	return nil
+}
+
+// withPathParams returns a copy of example whose top-level fields named like
+// a path parameter hold its value, a number where the example has one
+func withPathParams(example map[string]any, params map[string]string) map[string]any {
+	copied := make(map[string]any, len(example))
+	for k, v := range example {
+		copied[k] = v
+	}
+	for name, value := range params {
+		current, ok := copied[name]
+		if !ok {
+			continue
+		}
+		switch current.(type) {
+		case float64, int, int64, json.Number:
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				copied[name] = n
+				continue
+			}
+		}
+		copied[name] = value
+	}
+	return copied
+}
+
+// isJSONContentType reports whether contentType is JSON, like
+// application/problem+json
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// writeMockEnvironment sets BASE_URL of the mock environment of the envs.yml
+// at path to baseURL, adding the environment, or the file, when missing.
+// The rest of the file, comments included, is kept
+func writeMockEnvironment(path, baseURL string) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s isn't a mapping of environments", path)
+	}
+	environments := mappingChild(root, "environments")
+	mock := mappingChild(environments, mockEnvironment)
+	setMappingValue(mock, "BASE_URL", baseURL)
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// mappingChild returns the mapping under key of mapping, adding it when
+// missing or empty
+func mappingChild(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			child := mapping.Content[i+1]
+			if child.Kind != yaml.MappingNode {
+				*child = yaml.Node{Kind: yaml.MappingNode}
+			}
+			return child
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+	return child
+}
+
+// setMappingValue sets key of mapping to the string value
+func setMappingValue(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			*mapping.Content[i+1] = yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle}
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle})
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+const mockSpecYAML = `openapi: 3.0.3
+info:
+  title: Users
+  version: "1"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+                age:
+                  type: integer
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              example: {"id": 1, "name": "Ada"}
+        "400":
+          description: Invalid
+  /users/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: A user
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  id:
+                    type: integer
+                  name:
+                    type: string
+                    example: Grace
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "204":
+          description: Deleted
+  /health:
+    get:
+      responses:
+        default:
+          description: Health
+          content:
+            text/plain:
+              example: ok
+`
+
+func newTestMockServer(t *testing.T, opts mockOptions) *httptest.Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openapi.yml")
+	if err := os.WriteFile(path, []byte(mockSpecYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := newSpecValidator(path)
+	if err != nil {
+		t.Fatalf("newSpecValidator() error = %v", err)
+	}
+	server := httptest.NewServer(&mockServer{spec: spec, opts: opts, log: &requestLog{w: io.Discard}})
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMockServer(t *testing.T) {
+	server := newTestMockServer(t, mockOptions{})
+	tests := []struct {
+		name            string
+		method, path    string
+		body            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "schema example with the path parameter", method: "GET", path: "/v1/users/42", wantStatus: 200, wantContentType: "application/json", wantBody: `{"id":42,"name":"Grace"}`},
+		{name: "declared example and status", method: "POST", path: "/v1/users", body: `{"name": "Ada", "age": 36}`, wantStatus: 201, wantContentType: "application/json", wantBody: `{"id":1,"name":"Ada"}`},
+		{name: "no content", method: "DELETE", path: "/v1/users/42", wantStatus: 204},
+		{name: "default response", method: "GET", path: "/v1/health", wantStatus: 200, wantContentType: "text/plain", wantBody: "ok"},
+		{name: "invalid body", method: "POST", path: "/v1/users", body: `{"age": "old"}`, wantStatus: 400, wantContentType: "application/json",
+			wantBody: `{"details":["body /age: value must be an integer","body /name: property \"name\" is missing"],"error":"request doesn't match the spec"}`},
+		{name: "invalid path parameter", method: "GET", path: "/v1/users/ada", wantStatus: 400, wantContentType: "application/json"},
+		{name: "unknown path", method: "GET", path: "/v1/posts", wantStatus: 404, wantContentType: "application/json", wantBody: `{"error":"the spec has no operation for GET /v1/posts"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || resp.Header.Get("Content-Type") != tt.wantContentType {
+				t.Fatalf("got %d %q, want %d %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), tt.wantStatus, tt.wantContentType, body)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			got := strings.TrimSpace(string(body))
+			if json.Valid(body) {
+				var v any
+				json.Unmarshal(body, &v)
+				compact, _ := json.Marshal(v)
+				got = string(compact)
+			}
+			if got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMockServerLatencyAndChaos(t *testing.T) {
+	slow := newTestMockServer(t, mockOptions{latency: 50 * time.Millisecond})
+	start := time.Now()
+	resp, err := http.Get(slow.URL + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if took := time.Since(start); took < 50*time.Millisecond || resp.StatusCode != 200 {
+		t.Errorf("got %d after %s, want 200 after 50ms", resp.StatusCode, took)
+	}
+
+	chaotic := newTestMockServer(t, mockOptions{chaos: 1})
+	resp, err = http.Get(chaotic.URL + "/v1/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got %d with --chaos 1, want 503", resp.StatusCode)
+	}
+}
+
+func TestWriteMockEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "envs.yml")
+	content := "# Environments\nenvironments:\n  dev:\n    BASE_URL: \"https://dev.example.com\" # the dev server\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"http://localhost:8080/v1", "http://localhost:9090/v1"} {
+		if err := writeMockEnvironment(path, url); err != nil {
+			t.Fatalf("writeMockEnvironment() error = %v", err)
+		}
+	}
+
+	config, err := run.LoadEnvConfig(path)
+	if err != nil {
+		t.Fatalf("loadEnvConfig() error = %v", err)
+	}
+	if got := config.Environments["mock"]["BASE_URL"]; got != "http://localhost:9090/v1" {
+		t.Errorf("mock BASE_URL = %q, want the last server's", got)
+	}
+	if got := config.Environments["dev"]["BASE_URL"]; got != "https://dev.example.com" {
+		t.Errorf("dev BASE_URL = %q, want it kept", got)
+	}
+	written, _ := os.ReadFile(path)
+	if !strings.Contains(string(written), "# the dev server") {
+		t.Errorf("comments were lost:\n%s", written)
+	}
+
+	missing := filepath.Join(t.TempDir(), "envs.yml")
+	if err := writeMockEnvironment(missing, "http://localhost:8080"); err != nil {
+		t.Fatalf("writeMockEnvironment() of a missing file error = %v", err)
+	}
+	if config, err := run.LoadEnvConfig(missing); err != nil || config.Environments["mock"]["BASE_URL"] != "http://localhost:8080" {
+		t.Errorf("new envs.yml = %+v, %v", config, err)
+	}
+}
@@ -0,0 +1,702 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// nativeTransports send the requests of --native, keeping connections alive
+// across iterations, one for each TLS and proxy setup the requests ask for
+var nativeTransports = struct {
+	sync.Mutex
+	bySetup map[nativeSetup]*http.Transport
+}{bySetup: map[nativeSetup]*http.Transport{}}
+
+// nativeSetup is what sets the transports of --native requests apart
+type nativeSetup struct {
+	tls nativeTLS
+	// proxy and noProxy are -x and --noproxy
+	proxy   string
+	noProxy string
+}
+
+// nativeTLS is how a --native request sets up TLS: skipping certificate
+// verification for -k, and the files of --cert, --key and --cacert
+type nativeTLS struct {
+	insecure bool
+	cert     string
+	key      string
+	cacert   string
+}
+
+// nativeUserAgent is the User-Agent of --native requests that don't set one
+const nativeUserAgent = "curly"
+
+// maxNativeRedirects is how many redirects --native follows with -L, as
+// many as net/http does
+const maxNativeRedirects = 10
+
+// nativeTransport returns the transport of nativeTransports for setup,
+// creating it on first use
+func nativeTransport(setup nativeSetup) (*http.Transport, error) {
+	nativeTransports.Lock()
+	defer nativeTransports.Unlock()
+	if t, ok := nativeTransports.bySetup[setup]; ok {
+		return t, nil
+	}
+	t, err := newNativeTransport(setup)
+	if err != nil {
+		return nil, err
+	}
+	nativeTransports.bySetup[setup] = t
+	return t, nil
+}
+
+func newNativeTransport(setup nativeSetup) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// Parallel runs all go to the same host
+	t.MaxIdleConnsPerHost = 1024
+	if setup.proxy != "" || setup.noProxy != "" {
+		proxy, err := nativeProxyFunc(setup.proxy, setup.noProxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = proxy
+	}
+	if setup.tls == (nativeTLS{}) {
+		return t, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: setup.tls.insecure}
+	if setup.tls.cert != "" {
+		// Like curl, the key may be in the certificate file
+		key := setup.tls.key
+		if key == "" {
+			key = setup.tls.cert
+		}
+		cert, err := tls.LoadX509KeyPair(setup.tls.cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if setup.tls.cacert != "" {
+		pem, err := os.ReadFile(setup.tls.cacert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", setup.tls.cacert)
+		}
+		config.RootCAs = pool
+	}
+	t.TLSClientConfig = config
+	return t, nil
+}
+
+// nativeRequest is the curl command of a file as curly sends it itself with
+// --native, see parseNativeRequest
+type nativeRequest struct {
+	method string
+	url    string
+	header http.Header
+	// host overrides the Host header, which net/http keeps out of header
+	host string
+	body []byte
+	// user and password are sent with Basic auth when user is set, from -u
+	user     string
+	password string
+	// tls is -k and the files of --cert, --key and --cacert
+	tls nativeTLS
+	// proxy and noProxy are -x and --noproxy
+	proxy   string
+	noProxy string
+	// follow follows redirects like -L
+	follow bool
+	// include prints the status line and headers ahead of the body like -i
+	include bool
+	// fail makes HTTP errors fail the run like -f
+	fail    bool
+	timeout time.Duration
+	// timing measures the phases of the request for --timing
+	timing bool
+}
+
+// nativeFlags are the curl options --native understands that take no value
+var nativeFlags = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-g": true, "--globoff": true, "-G": true, "--get": true,
+	"-k": true, "--insecure": true, "-L": true, "--location": true,
+	"-f": true, "--fail": true, "--compressed": true,
+	"-i": true, "--include": true,
+}
+
+// nativeValueFlags are the curl options --native understands that take a
+// value
+var nativeValueFlags = map[string]bool{
+	"-X": true, "--request": true, "-H": true, "--header": true,
+	"-d": true, "--data": true, "--data-ascii": true, "--data-raw": true,
+	"--data-binary": true, "--data-urlencode": true, "-F": true, "--form": true,
+	"-u": true, "--user": true, "-m": true, "--max-time": true,
+	"-E": true, "--cert": true, "--key": true, "--cacert": true,
+	"-x": true, "--proxy": true, "--noproxy": true,
+}
+
+// parseNativeRequest turns cmdText, the variable assignments of a file
+// followed by a single curl command, into the request it sends. The error
+// says what needs the shell and curl instead: dynamic values like $(...),
+// other commands, pipes and redirections, or curl options --native doesn't
+// know
+func parseNativeRequest(cmdText string) (*nativeRequest, error) {
+	lines := strings.Split(cmdText, "\n")
+	commands := run.FindCurlCommands(lines)
+	if len(commands) != 1 {
+		return nil, fmt.Errorf("it runs %d curl commands", len(commands))
+	}
+	cmd := commands[0]
+	for _, line := range lines[:cmd.Start] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && !run.AssignmentPattern.MatchString(line) {
+			return nil, fmt.Errorf("it runs %q ahead of curl", trimmed)
+		}
+	}
+
+	vars := resolveFileVariables(cmdText)
+	var text strings.Builder
+	for _, line := range lines[cmd.Start : cmd.End+1] {
+		text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+	}
+	command := text.String()
+
+	// A heredoc is the command's stdin, for -d @- and --data-binary @-
+	var stdin []byte
+	hasStdin := false
+	rest := lines[cmd.End+1:]
+	if loc := run.HeredocPattern.FindStringSubmatchIndex(command); loc != nil {
+		op := strings.Index(command[loc[0]:], "<<") + loc[0]
+		delimiter := command[loc[4]:loc[5]]
+		stripTabs := loc[2] < loc[3]
+		literal := strings.ContainsAny(command[op:loc[1]], `'"`)
+		command = command[:op] + command[loc[1]:]
+
+		end := -1
+		for i, line := range rest {
+			if stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delimiter {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("its heredoc isn't terminated by %s", delimiter)
+		}
+		body := rest[:end]
+		rest = rest[end+1:]
+		if stripTabs {
+			for i := range body {
+				body[i] = strings.TrimLeft(body[i], "\t")
+			}
+		}
+		content := strings.Join(body, "\n") + "\n"
+		if !literal {
+			expanded, unresolved := expandVarRefs(content, escapedVariables(vars, shellquote.HeredocEscape), true)
+			if len(unresolved) > 0 || strings.Contains(content, "$(") || strings.Contains(content, "`") {
+				return nil, dynamicError(unresolved)
+			}
+			content = strings.NewReplacer(`\\`, `\`, `\$`, "$", "\\`", "`").Replace(expanded)
+		}
+		stdin, hasStdin = []byte(content), true
+	}
+	for _, line := range rest {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return nil, fmt.Errorf("it runs %q after curl", trimmed)
+		}
+	}
+
+	if strings.Contains(command, "$(") || strings.Contains(command, "`") {
+		return nil, errors.New("the curl command runs a command substitution")
+	}
+	if op := shellOperator(command); op != "" {
+		return nil, fmt.Errorf("the curl command uses %s", op)
+	}
+	expanded, unresolved := expandVarRefs(command, escapedVariables(vars, shellquote.EscapeDoubleQuoted), false)
+	if len(unresolved) > 0 {
+		return nil, dynamicError(unresolved)
+	}
+	return parseCurlWords(splitShellWords(expanded)[1:], stdin, hasStdin)
+}
+
+// parseCurlWords builds the request of the words of a curl command after
+// curl. stdin is what it reads for @-, when hasStdin
+func parseCurlWords(words []string, stdin []byte, hasStdin bool) (*nativeRequest, error) {
+	req := &nativeRequest{header: http.Header{}}
+	var data, form []string
+	get := false
+	// dropped are the headers curl would send that the command turns off
+	dropped := map[string]bool{}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		flag, value, hasValue := word, "", false
+		switch {
+		case !strings.HasPrefix(word, "-") || word == "-":
+			if req.url != "" {
+				return nil, fmt.Errorf("curl gets more than one URL")
+			}
+			req.url = word
+			continue
+		case !strings.HasPrefix(word, "--") && len(word) > 2:
+			// Combined short options like -sS, ending in at most one taking
+			// a value, which is the rest of the word or the next one: -XPOST,
+			// -sX POST
+			for j := 1; j < len(word); j++ {
+				short := "-" + word[j:j+1]
+				if nativeValueFlags[short] {
+					flag = short
+					value, hasValue = word[j+1:], j+1 < len(word)
+					break
+				}
+				if !nativeFlags[short] {
+					return nil, fmt.Errorf("curl option %s isn't supported", short)
+				}
+				applyCurlFlag(req, short, &get)
+				flag = ""
+			}
+			if flag == "" {
+				continue
+			}
+		}
+
+		if nativeFlags[flag] {
+			applyCurlFlag(req, flag, &get)
+			continue
+		}
+		if !nativeValueFlags[flag] {
+			return nil, fmt.Errorf("curl option %s isn't supported", flag)
+		}
+		if !hasValue {
+			if i+1 >= len(words) {
+				return nil, fmt.Errorf("curl option %s is missing its value", flag)
+			}
+			i++
+			value = words[i]
+		}
+
+		switch flag {
+		case "-X", "--request":
+			req.method = value
+		case "-H", "--header":
+			name, v, ok := strings.Cut(value, ":")
+			if !ok {
+				// "Name;" sends an empty header
+				if name, ok = strings.CutSuffix(value, ";"); !ok {
+					return nil, fmt.Errorf("header %q isn't supported", value)
+				}
+			}
+			name, v = strings.TrimSpace(name), strings.TrimSpace(v)
+			switch {
+			case strings.EqualFold(name, "Host"):
+				req.host = v
+			case v == "" && ok:
+				// "Name:" drops a header curl would send
+				req.header.Del(name)
+				dropped[http.CanonicalHeaderKey(name)] = true
+			default:
+				req.header.Add(name, v)
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw":
+			d := []byte(value)
+			if flag != "--data-raw" && strings.HasPrefix(value, "@") {
+				content, err := readCurlFile(value[1:], stdin, hasStdin)
+				if err != nil {
+					return nil, err
+				}
+				d = content
+				if flag != "--data-binary" {
+					d = bytes.ReplaceAll(bytes.ReplaceAll(d, []byte("\r"), nil), []byte("\n"), nil)
+				}
+			}
+			data = append(data, string(d))
+		case "--data-urlencode":
+			encoded, err := urlencodeData(value, stdin, hasStdin)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, encoded)
+		case "-F", "--form":
+			form = append(form, value)
+		case "-u", "--user":
+			user, password, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, errors.New("-u without a password makes curl prompt for it")
+			}
+			req.user, req.password = user, password
+		case "-m", "--max-time":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("invalid %s %q", flag, value)
+			}
+			req.timeout = time.Duration(seconds * float64(time.Second))
+		case "-E", "--cert":
+			req.tls.cert = value
+		case "--key":
+			req.tls.key = value
+		case "--cacert":
+			req.tls.cacert = value
+		case "-x", "--proxy":
+			req.proxy = value
+		case "--noproxy":
+			req.noProxy = value
+		}
+	}
+
+	if req.url == "" {
+		return nil, errors.New("curl gets no URL")
+	}
+	if !strings.Contains(req.url, "://") {
+		req.url = "http://" + req.url
+	}
+	if _, err := url.Parse(req.url); err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	switch {
+	case len(form) > 0 && len(data) > 0:
+		return nil, errors.New("curl can't send -F and -d together")
+	case len(form) > 0:
+		body, contentType, err := multipartBody(form, req.header.Get("Content-Type"), stdin, hasStdin)
+		if err != nil {
+			return nil, err
+		}
+		req.body = body
+		req.header.Set("Content-Type", contentType)
+		req.defaultMethod(http.MethodPost)
+	case len(data) > 0 && get:
+		sep := "?"
+		if strings.Contains(req.url, "?") {
+			sep = "&"
+		}
+		req.url += sep + strings.Join(data, "&")
+		req.defaultMethod(http.MethodGet)
+	case len(data) > 0:
+		req.body = []byte(strings.Join(data, "&"))
+		if _, ok := req.header["Content-Type"]; !ok {
+			req.header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.defaultMethod(http.MethodPost)
+	default:
+		req.defaultMethod(http.MethodGet)
+	}
+
+	if _, ok := req.header["Accept"]; !ok && !dropped["Accept"] {
+		req.header.Set("Accept", "*/*")
+	}
+	switch _, ok := req.header["User-Agent"]; {
+	case dropped["User-Agent"]:
+		// An empty User-Agent keeps net/http from sending its own
+		req.header.Set("User-Agent", "")
+	case !ok:
+		req.header.Set("User-Agent", nativeUserAgent)
+	}
+	return req, nil
+}
+
+// applyCurlFlag applies one of nativeFlags to req, get being -G
+func applyCurlFlag(req *nativeRequest, flag string, get *bool) {
+	switch flag {
+	case "-G", "--get":
+		*get = true
+	case "-k", "--insecure":
+		req.tls.insecure = true
+	case "-L", "--location":
+		req.follow = true
+	case "-i", "--include":
+		req.include = true
+	case "-f", "--fail":
+		req.fail = true
+	}
+}
+
+// defaultMethod sets the method of req unless -X did
+func (req *nativeRequest) defaultMethod(method string) {
+	if req.method == "" {
+		req.method = method
+	}
+}
+
+// readCurlFile reads the file of a @file argument, - being stdin
+func readCurlFile(name string, stdin []byte, hasStdin bool) ([]byte, error) {
+	if name == "-" {
+		if !hasStdin {
+			return nil, errors.New("curl reads the terminal for @-")
+		}
+		return stdin, nil
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// urlencodeData encodes a --data-urlencode argument the way curl does:
+// content, =content, name=content, @file or name@file
+func urlencodeData(value string, stdin []byte, hasStdin bool) (string, error) {
+	eq := strings.Index(value, "=")
+	at := strings.Index(value, "@")
+	switch {
+	case eq == 0:
+		return url.QueryEscape(value[1:]), nil
+	case eq > 0 && (at < 0 || eq < at):
+		return value[:eq] + "=" + url.QueryEscape(value[eq+1:]), nil
+	case at >= 0:
+		content, err := readCurlFile(value[at+1:], stdin, hasStdin)
+		if err != nil {
+			return "", err
+		}
+		encoded := url.QueryEscape(string(content))
+		if at > 0 {
+			return value[:at] + "=" + encoded, nil
+		}
+		return encoded, nil
+	}
+	return url.QueryEscape(value), nil
+}
+
+// multipartBody builds the multipart/form-data body of -F arguments, like
+// name=value, name=@file, name=<file, with optional ;type= and ;filename=
+func multipartBody(fields []string, contentType string, stdin []byte, hasStdin bool) ([]byte, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid -F %q", field)
+		}
+		if !strings.HasPrefix(value, "@") && !strings.HasPrefix(value, "<") {
+			if err := w.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		parts := strings.Split(value[1:], ";")
+		file, partType, filename := parts[0], "", filepath.Base(parts[0])
+		for _, param := range parts[1:] {
+			key, v, _ := strings.Cut(param, "=")
+			switch strings.TrimSpace(key) {
+			case "type":
+				partType = v
+			case "filename":
+				filename = strings.Trim(v, `"`)
+			default:
+				return nil, "", fmt.Errorf("-F parameter %q isn't supported", param)
+			}
+		}
+		content, err := readCurlFile(file, stdin, hasStdin)
+		if err != nil {
+			return nil, "", err
+		}
+
+		h := textproto.MIMEHeader{}
+		disposition := fmt.Sprintf(`form-data; name=%q`, name)
+		if value[0] == '@' {
+			disposition += fmt.Sprintf(`; filename=%q`, filename)
+			if partType == "" {
+				partType = "application/octet-stream"
+			}
+		}
+		h.Set("Content-Disposition", disposition)
+		if partType != "" {
+			h.Set("Content-Type", partType)
+		}
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	// A multipart Content-Type of the command's own gets the boundary, like
+	// curl does
+	if strings.HasPrefix(strings.ToLower(contentType), "multipart/") && !strings.Contains(contentType, "boundary=") {
+		return body.Bytes(), contentType + "; boundary=" + w.Boundary(), nil
+	}
+	return body.Bytes(), w.FormDataContentType(), nil
+}
+
+// run sends the request, writing the response body to stdout followed by
+// the status line statusWriteOut, or timingWriteOut with req.timing, would
+// have curl print, and what went wrong to stderr
+func (req *nativeRequest) run(ctx context.Context, stdout, stderr io.Writer) error {
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	var trace *timingTrace
+	if req.timing {
+		trace = newTimingTrace()
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			DNSDone:              func(httptrace.DNSDoneInfo) { trace.done(&trace.timing.NameLookup) },
+			ConnectDone:          func(string, string, error) { trace.done(&trace.timing.Connect) },
+			TLSHandshakeDone:     func(tls.ConnectionState, error) { trace.done(&trace.timing.AppConnect) },
+			GotFirstResponseByte: func() { trace.done(&trace.timing.StartTransfer) },
+		})
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, req.url, body)
+	if err != nil {
+		fmt.Fprintf(stderr, "curly: %v\n", err)
+		return err
+	}
+	r.Header = req.header.Clone()
+	if req.host != "" {
+		r.Host = req.host
+	}
+	if req.user != "" {
+		r.SetBasicAuth(req.user, req.password)
+	}
+
+	transport, err := nativeTransport(nativeSetup{tls: req.tls, proxy: req.proxy, noProxy: req.noProxy})
+	if err != nil {
+		fmt.Fprintf(stderr, "curly: %v\n", err)
+		return err
+	}
+	client := &http.Client{Transport: transport, Timeout: req.timeout}
+	switch {
+	case !req.follow:
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	case req.include:
+		// Like curl -iL, the headers of each response redirecting are
+		// printed too
+		client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+			if len(via) >= maxNativeRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxNativeRedirects)
+			}
+			writeHeaderBlock(stdout, next.Response)
+			return nil
+		}
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		// Like curl, say what went wrong without the URL, which may carry
+		// secrets
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		fmt.Fprintf(stderr, "curly: %v\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// writeStatusLine ends the output with the status line, once size bytes
+	// of the body were read
+	writeStatusLine := func(size int64) error {
+		var timing *run.RequestTiming
+		if trace != nil {
+			t := trace.finish(size)
+			timing = &t
+		}
+		_, err := io.WriteString(stdout, statusLine(resp.StatusCode, resp.Header.Get("Content-Type"), resp.Header.Get("Retry-After"), timing))
+		return err
+	}
+	if req.fail && resp.StatusCode >= 400 {
+		io.Copy(io.Discard, resp.Body)
+		writeStatusLine(0)
+		fmt.Fprintf(stderr, "curly: the requested URL returned error: %d\n", resp.StatusCode)
+		return fmt.Errorf("HTTP status %d with --fail", resp.StatusCode)
+	}
+	if req.include {
+		writeHeaderBlock(stdout, resp)
+	}
+	size, err := io.Copy(stdout, resp.Body)
+	if err != nil {
+		fmt.Fprintf(stderr, "curly: %v\n", err)
+		return err
+	}
+	return writeStatusLine(size)
+}
+
+// writeHeaderBlock writes the status line and headers of resp to w, followed
+// by a blank line, as curl -i prints them
+func writeHeaderBlock(w io.Writer, resp *http.Response) {
+	fmt.Fprintf(w, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(w)
+	io.WriteString(w, "\r\n")
+}
+
+// escapedVariables returns vars, along with the OS environment they fall back
+// to, with their values escaped by escape for the text they expand into
+func escapedVariables(vars []fileVariable, escape func(string) string) []fileVariable {
+	escaped := make([]fileVariable, 0, len(vars))
+	known := map[string]bool{}
+	for _, v := range vars {
+		v.value = escape(v.value)
+		escaped = append(escaped, v)
+		known[v.name] = true
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !known[name] {
+			escaped = append(escaped, fileVariable{name: name, value: escape(value)})
+		}
+	}
+	return escaped
+}
+
+// shellOperator returns the first pipe, list or redirection operator in s
+// outside quotes, or ""
+func shellOperator(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.IndexByte("|&;<>", c) >= 0:
+			return string(c)
+		}
+	}
+	return ""
+}
+
+// dynamicError says which variables need the shell to be evaluated
+func dynamicError(names []string) error {
+	if len(names) == 0 {
+		return errors.New("its heredoc runs a command substitution")
+	}
+	return fmt.Errorf("%s is set at run time or not at all", names[0])
+}
@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNativeRequest(t *testing.T) {
+	t.Setenv("CURLY_TEST_HOST", "api.example.com")
+	tests := []struct {
+		name       string
+		cmdText    string
+		wantMethod string
+		wantURL    string
+		wantHeader map[string]string
+		wantBody   string
+	}{
+		{
+			name:       "GET with variables",
+			cmdText:    "#### Variables ####\nBASE_URL=\"https://${CURLY_TEST_HOST}\"\nID=\"42\"\n\ncurl -sS \"${BASE_URL}/users/${ID}\" \\\n  -H 'Accept: application/json'\n",
+			wantMethod: "GET",
+			wantURL:    "https://api.example.com/users/42",
+			wantHeader: map[string]string{"Accept": "application/json", "User-Agent": "curly"},
+		},
+		{
+			name:       "POST heredoc",
+			cmdText:    "NAME=\"a \\\"b\\\" \\$c\"\ncurl -X POST \"http://x/users\" -H \"Content-Type: application/json\" --data-binary @- <<EOF\n{\"name\": \"${NAME}\", \"path\": \"a\\\\b\"}\nEOF\n",
+			wantMethod: "POST",
+			wantURL:    "http://x/users",
+			wantHeader: map[string]string{"Content-Type": "application/json"},
+			wantBody:   "{\"name\": \"a \"b\" $c\", \"path\": \"a\\b\"}\n",
+		},
+		{
+			name:       "quoted heredoc stays literal",
+			cmdText:    "curl -XPUT x/items --data-binary @- <<'EOF'\n{\"v\": \"${NOT_EXPANDED}\"}\nEOF",
+			wantMethod: "PUT",
+			wantURL:    "http://x/items",
+			wantBody:   "{\"v\": \"${NOT_EXPANDED}\"}\n",
+		},
+		{
+			name:       "form data",
+			cmdText:    "curl -d a=1 --data-urlencode 'q=x y' x",
+			wantMethod: "POST",
+			wantURL:    "http://x",
+			wantHeader: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			wantBody:   "a=1&q=x+y",
+		},
+		{
+			name:       "data in the query with -G",
+			cmdText:    "curl -G -d a=1 'x/search?b=2'",
+			wantMethod: "GET",
+			wantURL:    "http://x/search?b=2&a=1",
+		},
+		{
+			name:       "basic auth, Host and dropped header",
+			cmdText:    "curl -sku ada:pw -H 'Host: internal' -H 'Accept:' -m 2.5 -L x",
+			wantMethod: "GET",
+			wantURL:    "http://x",
+			wantHeader: map[string]string{"Accept": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseNativeRequest(tt.cmdText)
+			if err != nil {
+				t.Fatalf("parseNativeRequest() error = %v", err)
+			}
+			if req.method != tt.wantMethod || req.url != tt.wantURL {
+				t.Errorf("parseNativeRequest() = %s %s, want %s %s", req.method, req.url, tt.wantMethod, tt.wantURL)
+			}
+			for name, want := range tt.wantHeader {
+				if got := req.header.Get(name); got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			if string(req.body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", req.body, tt.wantBody)
+			}
+		})
+	}
+
+	req, err := parseNativeRequest("curl -sku ada:pw -H 'Host: internal' -m 2.5 -L --cert c.pem --key k.pem --cacert ca.pem x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.tls != (nativeTLS{insecure: true, cert: "c.pem", key: "k.pem", cacert: "ca.pem"}) || !req.follow || req.user != "ada" || req.password != "pw" || req.host != "internal" || req.timeout != 2500*time.Millisecond {
+		t.Errorf("parseNativeRequest() = %+v", req)
+	}
+}
+
+func TestParseNativeRequestFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdText string
+		wantErr string
+	}{
+		{name: "two commands", cmdText: "curl x\ncurl y", wantErr: "it runs 2 curl commands"},
+		{name: "command substitution", cmdText: "ID=\"$(uuidgen)\"\ncurl \"x/${ID}\"", wantErr: "ID is set at run time or not at all"},
+		{name: "unset variable", cmdText: "curl \"x/${CURLY_TEST_UNSET}\"", wantErr: "CURLY_TEST_UNSET is set at run time"},
+		{name: "pipe", cmdText: "curl x | jq .", wantErr: "uses |"},
+		{name: "other command", cmdText: "echo hi\ncurl x", wantErr: `it runs "echo hi" ahead of curl`},
+		{name: "unsupported option", cmdText: "curl -o out.json x", wantErr: "curl option -o isn't supported"},
+		{name: "unsupported combined option", cmdText: "curl -sv x", wantErr: "curl option -v isn't supported"},
+		{name: "prompted password", cmdText: "curl -u ada x", wantErr: "prompt"},
+		{name: "stdin without heredoc", cmdText: "curl -d @- x", wantErr: "@-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseNativeRequest(tt.cmdText)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseNativeRequest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// echoServer answers every request with a description of it, the status of
+// its ?status= parameter and the Content-Type of its ?type= one
+func echoServer(t testing.TB) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		query := r.URL.Query()
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+			return
+		}
+		if ct := query.Get("type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		status := http.StatusOK
+		fmt.Sscanf(query.Get("status"), "%d", &status)
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s %s %s host=%s auth=%s:%s\n", r.Method, r.URL.Path, r.URL.RawQuery, r.Host, user, password)
+		for _, name := range []string{"Accept", "Content-Type", "X-Trace"} {
+			// Multipart boundaries are random
+			value, _, _ := strings.Cut(r.Header.Get(name), "; boundary=")
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+		if mediaType := r.Header.Get("Content-Type"); strings.HasPrefix(mediaType, "multipart/") {
+			if err := r.ParseMultipartForm(1 << 20); err == nil {
+				for _, name := range []string{"name", "file"} {
+					if headers := r.MultipartForm.File[name]; len(headers) > 0 {
+						f, _ := headers[0].Open()
+						content, _ := io.ReadAll(f)
+						f.Close()
+						fmt.Fprintf(w, "%s=@%s %s %q\n", name, headers[0].Filename, headers[0].Header.Get("Content-Type"), content)
+					} else {
+						fmt.Fprintf(w, "%s=%s\n", name, r.MultipartForm.Value[name])
+					}
+				}
+				return
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%q", body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNativeParity(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not installed")
+	}
+	server := echoServer(t)
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "avatar.png")
+	if err := os.WriteFile(upload, []byte("PNG\x00data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BASE_URL", server.URL)
+
+	tests := []struct {
+		name    string
+		cmdText string
+		wantErr bool
+	}{
+		{name: "GET", cmdText: `curl -s "${BASE_URL}/users/42?fields=id,name&type=application/json"`},
+		{name: "POST JSON heredoc", cmdText: "NAME=\"ada\"\ncurl -s -X POST \"${BASE_URL}/users\" \\\n  -H \"Content-Type: application/json\" \\\n  -H 'X-Trace: 1' \\\n  --data-binary @- <<EOF\n{\"name\": \"${NAME}\", \"tags\": [\"a\\\\b\"]}\nEOF"},
+		{name: "form fields", cmdText: `curl -s -d a=1 -d 'b=2 3' --data-urlencode 'q=x&y' "${BASE_URL}/form"`},
+		{name: "GET data", cmdText: `curl -sG -d a=1 --data-urlencode 'q=x y' "${BASE_URL}/search"`},
+		{name: "multipart", cmdText: `curl -s -F name=ada -F "file=@` + upload + `;type=image/png" "${BASE_URL}/upload"`},
+		{name: "basic auth and Host", cmdText: `curl -s -u ada:s3cr3t -H 'Host: api.internal' -H 'Accept: text/plain' "${BASE_URL}/me"`},
+		{name: "PATCH with -d", cmdText: `curl -s -X PATCH -H 'Content-Type: application/json' -d '{"a": 1}' "${BASE_URL}/users/1?status=204"`},
+		{name: "error status", cmdText: `curl -s "${BASE_URL}/missing?status=404&type=text/plain"`},
+		{name: "no redirect without -L", cmdText: `curl -s "${BASE_URL}/redirect"`},
+		{name: "redirect with -L", cmdText: `curl -sL "${BASE_URL}/redirect"`},
+		{name: "fail", cmdText: `curl -sf "${BASE_URL}/missing?status=500"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseNativeRequest(tt.cmdText)
+			if err != nil {
+				t.Fatalf("parseNativeRequest() error = %v", err)
+			}
+			eo := execOptions{quiet: true, keepOutput: true}
+			cmdText := injectStatusWriteOut(tt.cmdText)
+			shell, shellErr := execShellCommand(context.Background(), cmdText, 1, eo)
+			eo.request = req
+			native, nativeErr := execShellCommand(context.Background(), cmdText, 1, eo)
+
+			if (shellErr != nil) != tt.wantErr || (nativeErr != nil) != tt.wantErr {
+				t.Errorf("errors = %v with curl, %v native, want an error: %v", shellErr, nativeErr, tt.wantErr)
+			}
+			if native.output != shell.output {
+				t.Errorf("native output:\n%s\nwant curl's:\n%s", native.output, shell.output)
+			}
+			if fmt.Sprint(native.statuses) != fmt.Sprint(shell.statuses) {
+				t.Errorf("native statuses = %v, want curl's %v", native.statuses, shell.statuses)
+			}
+		})
+	}
+}
+
+func TestExecWithoutShell(t *testing.T) {
+	noShell := errors.New("curly needs sh to run .curl files")
+	old := shellPath
+	shellPath = func() (string, error) { return "", noShell }
+	t.Cleanup(func() { shellPath = old })
+	server := echoServer(t)
+
+	stats, err := execCmd(`ID="42"`+"\ncurl -s \""+server.URL+"/users/${ID}?status=201\"", execOptions{times: 2, quiet: true})
+	if err != nil {
+		t.Fatalf("execCmd() error = %v", err)
+	}
+	if stats.Success != 2 || stats.StatusCodes[201] != 2 {
+		t.Errorf("execCmd() stats = %d successes, statuses %v, want 2 201s sent natively", stats.Success, stats.StatusCodes)
+	}
+
+	_, err = execCmd(`curl -s "`+server.URL+`" | jq .`, execOptions{times: 1, quiet: true})
+	if !errors.Is(err, noShell) || !strings.Contains(err.Error(), "uses |") {
+		t.Errorf("execCmd() error = %v, want the missing shell and why the file needs it", err)
+	}
+}
+
+func BenchmarkExecShell(b *testing.B) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		b.Skip("curl not installed")
+	}
+	cmdText := injectStatusWriteOut(`curl -s "` + echoServer(b).URL + `/users/42"`)
+	eo := execOptions{quiet: true}
+	for range b.N {
+		if _, err := execShellCommand(context.Background(), cmdText, 1, eo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecNative(b *testing.B) {
+	cmdText := `curl -s "` + echoServer(b).URL + `/users/42"`
+	req, err := parseNativeRequest(cmdText)
+	if err != nil {
+		b.Fatal(err)
+	}
+	eo := execOptions{quiet: true, request: req}
+	for range b.N {
+		if _, err := execShellCommand(context.Background(), cmdText, 1, eo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// outputTimeFormat is how the time a request started appears in the names of
+// the files --output-dir saves responses to
+const outputTimeFormat = "20060102T150405"
+
+// defaultOutputExtension is the extension of saved responses that came back
+// without a Content-Type
+const defaultOutputExtension = ".json"
+
+// outputExtensions maps the media types of responses to the extensions they
+// are saved with
+var outputExtensions = map[string]string{
+	"application/json":         ".json",
+	"application/xml":          ".xml",
+	"text/xml":                 ".xml",
+	"text/html":                ".html",
+	"text/plain":               ".txt",
+	"text/csv":                 ".csv",
+	"application/yaml":         ".yaml",
+	"application/x-yaml":       ".yaml",
+	"application/pdf":          ".pdf",
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"application/zip":          ".zip",
+	"application/gzip":         ".gz",
+	"application/octet-stream": ".bin",
+}
+
+// outputExtension guesses the extension of a response from its Content-Type
+func outputExtension(contentType string) string {
+	if contentType == "" {
+		return defaultOutputExtension
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return defaultOutputExtension
+	}
+	if ext, ok := outputExtensions[mediaType]; ok {
+		return ext
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return ".json"
+	case strings.HasSuffix(mediaType, "+xml"):
+		return ".xml"
+	}
+	return ".out"
+}
+
+// outputPath returns the file the response of iteration, started at start,
+// is saved to: eo.outputFile, or a file in eo.outputDir named after the
+// .curl file, the iteration and the time
+func outputPath(eo execOptions, iteration int, start time.Time, contentType string) string {
+	if eo.outputFile != "" {
+		return eo.outputFile
+	}
+	name := fmt.Sprintf("%s_%d_%s%s", eo.outputStem, iteration, start.Format(outputTimeFormat), outputExtension(contentType))
+	return filepath.Join(eo.outputDir, name)
+}
+
+// saveOutput writes the stdout of iteration, with the status lines of
+// injectStatusWriteOut still in it, to its outputPath and returns the HTTP
+// statuses they held and the path
+func saveOutput(eo execOptions, iteration int, start time.Time, out string) ([]int, string, error) {
+	body, statuses := extractStatuses(out)
+	path := outputPath(eo, iteration, start, lastContentType(out))
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		return statuses, "", fmt.Errorf("failed to save response: %w", err)
+	}
+	return statuses, path, nil
+}
+
+// outputStem is the name of the .curl file source without its extension, for
+// naming saved responses
+func outputStem(source string) string {
+	return strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutputExtension(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"", ".json"},
+		{"application/json", ".json"},
+		{"application/json; charset=utf-8", ".json"},
+		{"application/problem+json", ".json"},
+		{"application/atom+xml", ".xml"},
+		{"text/html; charset=UTF-8", ".html"},
+		{"text/plain", ".txt"},
+		{"image/png", ".png"},
+		{"application/vnd.custom", ".out"},
+		{"not a media type;;", ".json"},
+	}
+
+	for _, tt := range tests {
+		if got := outputExtension(tt.contentType); got != tt.want {
+			t.Errorf("outputExtension(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	start := time.Date(2024, 3, 1, 14, 5, 9, 0, time.UTC)
+	eo := execOptions{outputDir: "responses", outputStem: outputStem("users/GET_user.curl")}
+	if got, want := outputPath(eo, 7, start, "text/csv"), filepath.Join("responses", "GET_user_7_20240301T140509.csv"); got != want {
+		t.Errorf("outputPath() = %q, want %q", got, want)
+	}
+	if got := outputPath(execOptions{outputFile: "single.json"}, 1, start, "text/html"); got != "single.json" {
+		t.Errorf("outputPath() with outputFile = %q, want single.json", got)
+	}
+}
+
+func TestExecShellCommandSavesOutput(t *testing.T) {
+	dir := t.TempDir()
+	eo := execOptions{outputDir: dir, outputStem: "GET_user", quiet: true}
+	cmdText := `printf '{"id": 1}'; printf '\n__curly_status__=200 application/json\n'; echo oops >&2`
+
+	result, err := execShellCommand(context.Background(), cmdText, 3, eo)
+	if err != nil {
+		t.Fatalf("execShellCommand() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.statuses, []int{200}) {
+		t.Errorf("execShellCommand() statuses = %v, want [200]", result.statuses)
+	}
+	if matched, _ := filepath.Match(filepath.Join(dir, "GET_user_3_*.json"), result.savedTo); !matched {
+		t.Errorf("execShellCommand() saved to %q, want GET_user_3_<time>.json in %s", result.savedTo, dir)
+	}
+	saved, err := os.ReadFile(result.savedTo)
+	if err != nil {
+		t.Fatalf("failed to read saved response: %v", err)
+	}
+	if string(saved) != `{"id": 1}` {
+		t.Errorf("saved response = %q, want the body without stderr or status line", saved)
+	}
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/internal/output"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// previewCommandName is the hidden command fzf runs to preview the file
+// under the cursor in the endpoint list
+const previewCommandName = "__preview"
+
+// maxLabelPathWidth caps the column the paths of the endpoint list are
+// aligned to, so one long path doesn't push every summary off screen
+const maxLabelPathWidth = 50
+
+// endpointLabel is how the endpoint list shows a .curl file
+type endpointLabel struct {
+	method  string
+	path    string
+	summary string
+}
+
+// headerRequestPattern matches the "# METHOD /path" line generate starts a
+// file with
+var headerRequestPattern = regexp.MustCompile(`^#\s*([A-Za-z]+)\s+(/\S*)$`)
+
+// labelFilePattern matches the file at the end of a line of the endpoint
+// list
+var labelFilePattern = regexp.MustCompile(`\(([^()]+)\)$`)
+
+// parseEndpointLabel reads the label of a .curl file from the comments it
+// starts with: the "# METHOD /path" line generate writes and the summary
+// after it. Files without that line are labelled with their first request
+func parseEndpointLabel(content string) endpointLabel {
+	var label endpointLabel
+	started := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" && !started {
+			continue
+		}
+		started = true
+		if !strings.HasPrefix(line, "#") || strings.HasPrefix(line, "####") {
+			break
+		}
+		if match := headerRequestPattern.FindStringSubmatch(line); match != nil && label.method == "" {
+			label.method, label.path = strings.ToUpper(match[1]), match[2]
+			continue
+		}
+		if text := strings.TrimSpace(strings.TrimLeft(line, "#")); label.summary == "" {
+			label.summary = text
+		}
+	}
+
+	if label.method == "" {
+		req := firstRequest(content)
+		label.method, label.path = req.method, req.url
+		if u, err := url.Parse(req.url); err == nil && u.Path != "" {
+			label.path = u.Path
+		}
+	}
+	return label
+}
+
+// endpointLines formats the .curl files at paths, relative to dir, as the
+// lines of the endpoint list: their method, path and summary in aligned
+// columns, then the file
+func endpointLines(dir string, paths []string) []string {
+	labels := make([]endpointLabel, len(paths))
+	width := 0
+	for i, path := range paths {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			labels[i] = parseEndpointLabel(string(content))
+		}
+		width = max(width, len(labels[i].path))
+	}
+	width = min(width, maxLabelPathWidth)
+
+	lines := make([]string, len(paths))
+	for i, label := range labels {
+		rel, err := filepath.Rel(dir, paths[i])
+		if err != nil {
+			rel = paths[i]
+		}
+		line := fmt.Sprintf("%-7s %-*s", label.method, width, label.path)
+		if label.summary != "" {
+			line += "  —  " + label.summary
+		}
+		lines[i] = strings.TrimRight(line, " ") + "   (" + filepath.ToSlash(rel) + ")"
+	}
+	return lines
+}
+
+// selectEndpointByName returns the path of the .curl file at paths in dir
+// whose label best matches query, as the finder ranks them. Files matching
+// equally well go by their order, unless strict, which makes it an error
+func selectEndpointByName(dir string, paths []string, query string, strict bool) (string, error) {
+	lines := endpointLines(dir, paths)
+	best, bestScore := []int(nil), 0
+	for i, line := range lines {
+		score, ok := fuzzyScore(query, line)
+		if !ok {
+			continue
+		}
+		if len(best) == 0 || score > bestScore {
+			best, bestScore = []int{i}, score
+		} else if score == bestScore {
+			best = append(best, i)
+		}
+	}
+	if len(best) == 0 {
+		return "", fmt.Errorf("no file matches %q", query)
+	}
+	if strict && len(best) > 1 {
+		matches := make([]string, len(best))
+		for i, index := range best {
+			matches[i] = "\n  " + lines[index]
+		}
+		return "", fmt.Errorf("%q matches several files equally well:%s", query, strings.Join(matches, ""))
+	}
+	return paths[best[0]], nil
+}
+
+// selectEndpoints lets the user pick one or more of the .curl files at paths
+// in dir by their labels, previewing the file under the cursor, and returns
+// their paths in the order they were picked. With noFzf curly's own finder
+// is used even when fzf is installed
+func selectEndpoints(dir string, paths []string, noFzf bool) ([]string, error) {
+	lines := endpointLines(dir, paths)
+	byLine := make(map[string]string, len(lines))
+	for i, line := range lines {
+		byLine[line] = paths[i]
+	}
+
+	selected, err := selectItems("Select endpoints (Tab to pick several): ", lines, true, noFzf, previewArgs(dir))
+	if err != nil {
+		return nil, err
+	}
+	picked := make([]string, 0, len(selected))
+	for _, line := range selected {
+		path, ok := byLine[line]
+		if !ok {
+			return nil, fmt.Errorf("unknown endpoint %q", line)
+		}
+		picked = append(picked, path)
+	}
+	return picked, nil
+}
+
+// previewArgs returns the fzf arguments previewing the file under the cursor
+// with curly's preview command, none when FZF_DEFAULT_OPTS sets up its own
+// preview or curly can't find its executable
+func previewArgs(dir string) []string {
+	opts := os.Getenv("FZF_DEFAULT_OPTS")
+	if strings.Contains(opts, "--preview") || strings.Contains(opts, "--no-preview") {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	return []string{"--preview", previewQuote(exe) + " " + previewCommandName + " " + previewQuote(dir) + " {}"}
+}
+
+// previewQuote quotes s for the shell fzf runs the preview command with, cmd
+// on Windows and sh elsewhere
+func previewQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func NewPreviewCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          previewCommandName + " <collection-dir> <line>",
+		Short:        "Print the .curl file of a line of the endpoint list, for the fzf preview",
+		Hidden:       true,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return previewEndpoint(cmd.OutOrStdout(), args[0], args[1], output.Supported())
+		},
+	}
+}
+
+// previewEndpoint prints the .curl file in dir named at the end of line, a
+// line of the endpoint list, with comments, assignments and variable
+// references highlighted when color
+func previewEndpoint(out io.Writer, dir, line string, color bool) error {
+	match := labelFilePattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return fmt.Errorf("no file in %q", line)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(match[1])))
+	if err != nil {
+		return err
+	}
+	if !color {
+		_, err = out.Write(content)
+		return err
+	}
+	_, err = io.WriteString(out, highlightCurlFile(string(content)))
+	return err
+}
+
+// previewRefPattern matches a shell variable reference
+var previewRefPattern = regexp.MustCompile(`\$\{[^}]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// highlightCurlFile colors the comments, the names of the assignments and
+// the variable references of a .curl file
+func highlightCurlFile(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines[i] = output.Null + line + output.Reset
+			continue
+		}
+		prefix := ""
+		if match := run.AssignmentPattern.FindStringSubmatch(line); match != nil {
+			prefix = output.Key + match[1] + output.Reset + "="
+			line = line[len(match[0]):]
+		}
+		lines[i] = prefix + previewRefPattern.ReplaceAllString(line, output.Number+"$0"+output.Reset)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printEndpointsSummary prints how the files picked together went: how many
+// of total ran and the ones that failed, with why
+func printEndpointsSummary(out io.Writer, total, ran int, failures []string) {
+	fmt.Fprintf(out, "Ran %d of %d files: %d succeeded, %d failed\n", ran, total, ran-len(failures), len(failures))
+	for _, failure := range failures {
+		fmt.Fprintf(out, "  FAILED %s\n", failure)
+	}
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+func TestParseEndpointLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    endpointLabel
+	}{
+		{
+			name:    "generated header",
+			content: "# POST /api/v2/tenants/{tenantId}/users\n# Create a user in a tenant\n# Users get an invitation email.\n\n#### Variables ####\nBASE_URL=\"x\"\ncurl -s -X POST \"${BASE_URL}/api/v2/tenants/${TENANT_ID}/users\"",
+			want:    endpointLabel{method: "POST", path: "/api/v2/tenants/{tenantId}/users", summary: "Create a user in a tenant"},
+		},
+		{
+			name:    "no summary",
+			content: "# GET /health\n\n#### Variables ####\ncurl -s x",
+			want:    endpointLabel{method: "GET", path: "/health"},
+		},
+		{
+			name:    "comment ahead of the request line",
+			content: "\n# List the orders of a customer\n# get /customers/{id}/orders\ncurl -s x",
+			want:    endpointLabel{method: "GET", path: "/customers/{id}/orders", summary: "List the orders of a customer"},
+		},
+		{
+			name:    "hand-written file",
+			content: "# Login as the admin\nBASE_URL=\"https://api.example.com\"\ncurl -s -X POST \"${BASE_URL}/auth/login\" -d '{}'",
+			want:    endpointLabel{method: "POST", path: "/auth/login", summary: "Login as the admin"},
+		},
+		{
+			name:    "section headers aren't summaries",
+			content: "#### Variables ####\nID=\"1\"\ncurl -s \"http://localhost/users/${ID}\"",
+			want:    endpointLabel{method: "GET", path: "/users/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseEndpointLabel(tt.content); got != tt.want {
+				t.Errorf("parseEndpointLabel() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointLines(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"users/GET_users.curl":         "# GET /users\n# List users\ncurl -s x",
+		"users/DELETE_users__id_.curl": "# DELETE /users/{id}\ncurl -s -X DELETE x",
+	})
+	paths := []string{filepath.Join(dir, "users", "GET_users.curl"), filepath.Join(dir, "users", "DELETE_users__id_.curl")}
+
+	got := endpointLines(dir, paths)
+	want := []string{
+		"GET     /users       —  List users   (users/GET_users.curl)",
+		"DELETE  /users/{id}   (users/DELETE_users__id_.curl)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("endpointLines() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var out bytes.Buffer
+	if err := previewEndpoint(&out, dir, got[1], false); err != nil || out.String() != "# DELETE /users/{id}\ncurl -s -X DELETE x" {
+		t.Errorf("previewEndpoint() = %q, %v, want the file", out.String(), err)
+	}
+}
+
+func TestHighlightCurlFile(t *testing.T) {
+	got := highlightCurlFile("# GET /users\nID=\"${DEFAULT_ID}\"\ncurl -s \"$BASE_URL/users/${ID}\"")
+	want := output.Null + "# GET /users" + output.Reset + "\n" +
+		output.Key + "ID" + output.Reset + "=\"" + output.Number + "${DEFAULT_ID}" + output.Reset + "\"\n" +
+		"curl -s \"" + output.Number + "$BASE_URL" + output.Reset + "/users/" + output.Number + "${ID}" + output.Reset + "\""
+	if got != want {
+		t.Errorf("highlightCurlFile() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		multi   bool
+		want    []int
+		wantErr bool
+	}{
+		{name: "single", answer: "2\n", want: []int{2}},
+		{name: "several", answer: "3,1, 2\n", multi: true, want: []int{3, 1, 2}},
+		{name: "several without multi", answer: "1,2\n", wantErr: true},
+		{name: "out of range", answer: "1,5\n", multi: true, wantErr: true},
+		{name: "not a number", answer: "a\n", multi: true, wantErr: true},
+		{name: "empty", answer: "\n", multi: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSelection(tt.answer, 4, tt.multi)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSelection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) && !tt.wantErr {
+				t.Errorf("parseSelection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSeveralEndpoints(t *testing.T) {
+	if _, err := exec.LookPath("fzf"); err == nil {
+		t.Skip("fzf would ask which files to run")
+	}
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	server := echoServer(t)
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	writeFiles(t, dir, map[string]string{
+		"a_GET_health.curl":  "# GET /health\ncurl -s \"" + server.URL + "/health\"",
+		"b_GET_missing.curl": "# GET /missing\ncurl -s \"" + server.URL + "/missing?status=404\"",
+		"c_POST_orders.curl": "# POST /orders\ncurl -s -X POST \"" + server.URL + "/orders\"",
+	})
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantRuns    []string
+		wantSummary string
+	}{
+		{name: "continue past failures", wantRuns: []string{"POST /orders", "GET /missing", "GET /health"}, wantSummary: "Ran 3 of 3 files: 2 succeeded, 1 failed"},
+		{name: "--fail-fast", args: []string{"--fail-fast"}, wantRuns: []string{"POST /orders", "GET /missing"}, wantSummary: "Ran 2 of 3 files: 1 succeeded, 1 failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The menu asks which files to run, they run in the order picked
+			stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdin.WriteString("3,2,1\n")
+			stdin.Seek(0, 0)
+			stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+			if err != nil {
+				t.Fatal(err)
+			}
+			realStdin, realStdout := os.Stdin, os.Stdout
+			os.Stdin, os.Stdout = stdin, stdout
+			defer func() { os.Stdin, os.Stdout = realStdin, realStdout }()
+
+			cmd := NewRootCmd()
+			cmd.SetArgs(append([]string{dir, "--no-edit", "--fail-on-status", "4xx", "--no-history"}, tt.args...))
+			cmd.SetOut(stdout)
+			cmd.SilenceErrors = true
+			err = cmd.Execute()
+			os.Stdin, os.Stdout = realStdin, realStdout
+			if err == nil || !strings.Contains(err.Error(), "1 of 3 files failed") {
+				t.Errorf("Execute() error = %v, want 1 of 3 files failed", err)
+			}
+
+			out, _ := os.ReadFile(stdout.Name())
+			var runs []string
+			for _, line := range strings.Split(string(out), "\n") {
+				// The first header follows the menu's prompt
+				if _, header, ok := strings.Cut(line, "==> "); ok {
+					runs = append(runs, strings.Join(strings.Fields(header)[1:3], " "))
+				}
+			}
+			if strings.Join(runs, ",") != strings.Join(tt.wantRuns, ",") {
+				t.Errorf("ran %v, want %v in the order picked", runs, tt.wantRuns)
+			}
+			if !strings.Contains(string(out), tt.wantSummary) || !strings.Contains(string(out), "FAILED "+filepath.Join(dir, "b_GET_missing.curl")) {
+				t.Errorf("output:\n%s\nwant the summary %q", out, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestSelectEndpointByName(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"users/POST_users.curl":        "# POST /users\n# Create a user\ncurl -s -X POST x",
+		"users/GET_users.curl":         "# GET /users\n# List users\ncurl -s x",
+		"users/DELETE_users__id_.curl": "# DELETE /users/{id}\n# Delete a user\ncurl -s -X DELETE x",
+		"orders/GET_orders.curl":       "# GET /orders\n# List orders\ncurl -s x",
+		"admin/GET_orders.curl":        "# GET /orders\n# List orders\ncurl -s x",
+	})
+	paths, err := findEndpoints(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		strict  bool
+		want    string
+		wantErr string
+	}{
+		{name: "summary", query: "create user", want: "users/POST_users.curl"},
+		{name: "method and path", query: "delete /users", strict: true, want: "users/DELETE_users__id_.curl"},
+		{name: "file name", query: "GET_users", strict: true, want: "users/GET_users.curl"},
+		{name: "ambiguous takes the first", query: "list orders", want: "admin/GET_orders.curl"},
+		{name: "ambiguous with --strict-select", query: "list orders", strict: true, wantErr: "matches several files equally well"},
+		{name: "no match", query: "refund payment", wantErr: `no file matches "refund payment"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectEndpointByName(dir, paths, tt.query, tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("selectEndpointByName() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectEndpointByName() error = %v", err)
+			}
+			if want := filepath.Join(dir, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("selectEndpointByName() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRunSelectedByName(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	server := echoServer(t)
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	// An editor that fails shows the file runs without opening it
+	t.Setenv("EDITOR", "false")
+	writeFiles(t, dir, map[string]string{
+		"GET_health.curl":  "# GET /health\ncurl -s \"" + server.URL + "/health\"",
+		"POST_orders.curl": "# POST /orders\n# Create an order\ncurl -s -X POST \"" + server.URL + "/orders?status=201\"",
+	})
+
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{dir, "--select", "create order", "--strict-select", "--no-edit", "--fail-on-status", "4xx", "--stats-out", filepath.Join(dir, "stats.json")})
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	stats, _ := os.ReadFile(filepath.Join(dir, "stats.json"))
+	if !strings.Contains(string(stats), "201") {
+		t.Errorf("stats = %s, want the POST /orders run", stats)
+	}
+}
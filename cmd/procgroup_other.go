@@ -0,0 +1,14 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os/exec"
+	"time"
+)
+
+// terminateProcessGroup makes cancelling cmd's context kill it. Without
+// process groups the processes it started are left to exit on their own
+func terminateProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = time.Second
+}
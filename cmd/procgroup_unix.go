@@ -0,0 +1,21 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// terminateProcessGroup starts cmd in its own process group and makes
+// cancelling its context send SIGTERM to the whole group, so the processes a
+// shell started die with it instead of holding its output open
+func terminateProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	// Give up on output a process that ignored SIGTERM still holds open
+	cmd.WaitDelay = time.Second
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// progressRefresh is how often the progress bar is redrawn
+const progressRefresh = 200 * time.Millisecond
+
+// progressWindow is how far back the throughput behind the ETA looks
+const progressWindow = 5 * time.Second
+
+// progressBarWidth is the number of cells in the bar itself
+const progressBarWidth = 30
+
+// progressShown is whether a progress bar line is on the terminal, guarded by
+// outputMutex like everything else written while requests run
+var progressShown bool
+
+// clearProgressLine erases the progress bar so other output can take its
+// line, to be called with outputMutex held. The bar comes back on its next
+// refresh
+func clearProgressLine() {
+	if progressShown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		progressShown = false
+	}
+}
+
+// logf prints a line on stderr while requests run, without tearing the
+// progress bar
+func logf(format string, args ...any) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	clearProgressLine()
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// progressSample is how many executions had completed at a point in time
+type progressSample struct {
+	at        time.Time
+	completed int
+}
+
+// progressBar redraws a single status line for a run from its stats until
+// stopped
+type progressBar struct {
+	out     io.Writer
+	stats   *run.ExecutionStats
+	eo      execOptions
+	samples []progressSample
+	done    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// startProgressBar draws the progress of the run behind stats on out every
+// progressRefresh until stop is called
+func startProgressBar(out io.Writer, stats *run.ExecutionStats, eo execOptions) *progressBar {
+	b := &progressBar{out: out, stats: stats, eo: eo, done: make(chan struct{})}
+	b.stopped.Add(1)
+	go func() {
+		defer b.stopped.Done()
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.done:
+				return
+			case now := <-ticker.C:
+				b.draw(now)
+			}
+		}
+	}()
+	return b
+}
+
+// stop ends the redraws and erases the bar, leaving the line to the summary
+func (b *progressBar) stop() {
+	b.once.Do(func() {
+		close(b.done)
+		b.stopped.Wait()
+		outputMutex.Lock()
+		clearProgressLine()
+		outputMutex.Unlock()
+	})
+}
+
+// draw renders the bar as of now
+func (b *progressBar) draw(now time.Time) {
+	success := int(atomic.LoadInt32(&b.stats.Success))
+	failed := int(atomic.LoadInt32(&b.stats.Failed))
+	throttled := int(atomic.LoadInt32(&b.stats.Throttled))
+	completed := success + failed + throttled
+
+	b.samples = append(b.samples, progressSample{at: now, completed: completed})
+	for len(b.samples) > 2 && now.Sub(b.samples[1].at) >= progressWindow {
+		b.samples = b.samples[1:]
+	}
+	oldest := b.samples[0]
+	var rate float64
+	if elapsed := now.Sub(oldest.at).Seconds(); elapsed > 0 {
+		rate = float64(completed-oldest.completed) / elapsed
+	}
+
+	line := renderProgress(b.eo, now.Sub(b.stats.StartTime), success, failed, throttled, rate)
+	outputMutex.Lock()
+	fmt.Fprintf(b.out, "\r\033[K%s", line)
+	progressShown = true
+	outputMutex.Unlock()
+}
+
+// renderProgress formats the progress line of a run elapsed into, with rate
+// the recent completions per second the ETA is based on
+func renderProgress(eo execOptions, elapsed time.Duration, success, failed, throttled int, rate float64) string {
+	completed := success + failed + throttled
+	var fraction float64
+	var position, eta string
+	if eo.duration > 0 {
+		fraction = float64(elapsed) / float64(eo.duration)
+		position = fmt.Sprintf("%s/%s", elapsed.Round(time.Second), eo.duration)
+		eta = max(eo.duration-elapsed, 0).Round(time.Second).String()
+	} else {
+		fraction = float64(completed) / float64(eo.times)
+		position = fmt.Sprintf("%d/%d", completed, eo.times)
+		eta = "--"
+		if rate > 0 {
+			eta = time.Duration(float64(eo.times-completed) / rate * float64(time.Second)).Round(time.Second).String()
+		}
+	}
+
+	filled := int(min(max(fraction, 0), 1) * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+	counts := fmt.Sprintf("ok %d  failed %d", success, failed)
+	if throttled > 0 {
+		counts += fmt.Sprintf("  throttled %d", throttled)
+	}
+	return fmt.Sprintf("[%s] %s  %s  %.1f req/s  ETA %s", bar, position, counts, rate, eta)
+}
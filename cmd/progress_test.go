@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestRenderProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		eo        execOptions
+		elapsed   time.Duration
+		success   int
+		failed    int
+		throttled int
+		rate      float64
+		want      string
+	}{
+		{
+			name:    "count with an ETA from the rate",
+			eo:      execOptions{times: 1000},
+			elapsed: 25 * time.Second,
+			success: 240,
+			failed:  10,
+			rate:    10,
+			want:    "[#######.......................] 250/1000  ok 240  failed 10  10.0 req/s  ETA 1m15s",
+		},
+		{
+			name:      "throttled executions count as completed",
+			eo:        execOptions{times: 100},
+			elapsed:   10 * time.Second,
+			success:   40,
+			failed:    2,
+			throttled: 8,
+			rate:      5,
+			want:      "[###############...............] 50/100  ok 40  failed 2  throttled 8  5.0 req/s  ETA 10s",
+		},
+		{
+			name: "count before any throughput",
+			eo:   execOptions{times: 10},
+			want: "[..............................] 0/10  ok 0  failed 0  0.0 req/s  ETA --",
+		},
+		{
+			name:    "duration shows elapsed and remaining time",
+			eo:      execOptions{duration: 10 * time.Minute},
+			elapsed: 2*time.Minute + 400*time.Millisecond,
+			success: 1200,
+			rate:    9.5,
+			want:    "[######........................] 2m0s/10m0s  ok 1200  failed 0  9.5 req/s  ETA 8m0s",
+		},
+		{
+			name:    "duration overrun stays full",
+			eo:      execOptions{duration: time.Second},
+			elapsed: 1500 * time.Millisecond,
+			success: 3,
+			rate:    2,
+			want:    "[##############################] 2s/1s  ok 3  failed 0  2.0 req/s  ETA 0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderProgress(tt.eo, tt.elapsed, tt.success, tt.failed, tt.throttled, tt.rate); got != tt.want {
+				t.Errorf("renderProgress() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressBarRollingRate(t *testing.T) {
+	start := time.Now()
+	stats := &run.ExecutionStats{Total: 100, StartTime: start}
+	var out bytes.Buffer
+	b := &progressBar{out: &out, stats: stats, eo: execOptions{times: 100}}
+
+	// 10 req/s for 10s, then 2 req/s: the rate only looks back progressWindow
+	for i := 0; i <= 20; i++ {
+		if i <= 10 {
+			stats.Success = int32(i * 10)
+		} else {
+			stats.Success = int32(100 + (i-10)*2)
+		}
+		b.draw(start.Add(time.Duration(i) * time.Second))
+	}
+	lines := strings.Split(out.String(), "\r\033[K")
+	if last := lines[len(lines)-1]; !strings.Contains(last, "2.0 req/s") {
+		t.Errorf("last progress line = %q, want the rate of the last %s", last, progressWindow)
+	}
+	if !progressShown {
+		t.Errorf("progressShown = false after drawing")
+	}
+	progressShown = false
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// proxySchemes are the proxy URL schemes both curl and --native handle
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// parseProxyURL parses a --proxy or envs.yml proxy, http:// when it names
+// no scheme like curl assumes
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || !proxySchemes[u.Scheme] || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, expected a URL like http://proxy:3128 or socks5://localhost:1080", proxy)
+	}
+	return u, nil
+}
+
+// resolveProxy returns the proxy the curl commands go through and where it
+// is set: --proxy, or else the proxy of the environment opts.envName, the
+// last with one of layered environments. With neither, it is empty and curl
+// falls back to HTTPS_PROXY and the like
+func resolveProxy(opts runOptions) (proxy, source string, err error) {
+	if opts.proxy != "" {
+		if _, err := parseProxyURL(opts.proxy); err != nil {
+			return "", "", fmt.Errorf("--proxy: %w", err)
+		}
+		return opts.proxy, "--proxy", nil
+	}
+	if opts.envName == "" {
+		return "", "", nil
+	}
+	config, err := run.LoadEnvConfig(opts.envsFile)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load envs.yml: %w", err)
+	}
+	for _, name := range run.EnvLayers(opts.envName) {
+		if p := config.Proxy[name]; p != "" {
+			proxy, source = p, "environment "+name
+		}
+	}
+	if proxy != "" {
+		if _, err := parseProxyURL(proxy); err != nil {
+			return "", "", fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	return proxy, source, nil
+}
+
+// injectCurlProxy sends every curl command in content through proxy with -x
+// and passes noProxy, the hosts to reach directly, as --noproxy, leaving
+// commands that pass their own alone
+func injectCurlProxy(content, proxy, noProxy string) string {
+	if proxy == "" && noProxy == "" {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for _, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		var hasProxy, hasNoProxy bool
+		for _, word := range splitShellWords(text.String()) {
+			switch {
+			case word == "-x" || word == "--proxy" || strings.HasPrefix(word, "--proxy="):
+				hasProxy = true
+			case word == "--noproxy" || strings.HasPrefix(word, "--noproxy="):
+				hasNoProxy = true
+			}
+		}
+		var args []string
+		if proxy != "" && !hasProxy {
+			args = append(args, "-x "+shellquote.DoubleQuote(proxy))
+		}
+		if noProxy != "" && !hasNoProxy {
+			args = append(args, "--noproxy "+shellquote.DoubleQuote(noProxy))
+		}
+		if len(args) > 0 {
+			insertCurlArgs(lines, cmd, strings.Join(args, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// curlProxyVariables are the variables curl reads a proxy from for a URL
+// scheme, in the order it checks them. curl ignores HTTP_PROXY in capitals
+var curlProxyVariables = map[string][]string{
+	"https": {"https_proxy", "HTTPS_PROXY", "all_proxy", "ALL_PROXY"},
+	"http":  {"http_proxy", "all_proxy", "ALL_PROXY"},
+}
+
+// writeProxy says which proxy the first request of cmdText goes through:
+// proxy, set by source, or else the one of the OS environment curl uses,
+// unless noProxy names its host. Passwords in proxy URLs are masked
+func writeProxy(out io.Writer, cmdText, proxy, source, noProxy string) {
+	target, err := url.Parse(firstRequest(cmdText).url)
+	if err != nil {
+		return
+	}
+	if noProxyMatches(noProxy, target.Hostname()) {
+		fmt.Fprintf(out, "Not using a proxy for %s, --noproxy names it\n", target.Hostname())
+		return
+	}
+	if proxy == "" {
+		for _, name := range curlProxyVariables[target.Scheme] {
+			if value := os.Getenv(name); value != "" {
+				proxy, source = value, name
+				break
+			}
+		}
+	}
+	if proxy == "" {
+		return
+	}
+	if u, err := parseProxyURL(proxy); err == nil {
+		proxy = u.Redacted()
+	}
+	fmt.Fprintf(out, "Using proxy %s from %s\n", proxy, source)
+}
+
+// noProxyMatches reports whether the comma-separated hosts of noProxy, as
+// curl's --noproxy takes them, name host: * names every host, and a domain
+// names its subdomains too
+func noProxyMatches(noProxy, host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry), "."))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*", entry == host, strings.HasSuffix(host, "."+entry):
+			return true
+		}
+	}
+	return false
+}
+
+// nativeProxyFunc returns the Proxy of the transport of --native requests
+// passing proxy with -x and noProxy with --noproxy, falling back to the OS
+// environment like curl when proxy is empty
+func nativeProxyFunc(proxy, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	var proxyURL *url.URL
+	if proxy != "" {
+		u, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL = u
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		if noProxyMatches(noProxy, r.URL.Hostname()) {
+			return nil, nil
+		}
+		if proxyURL == nil {
+			return http.ProxyFromEnvironment(r)
+		}
+		return proxyURL, nil
+	}, nil
+}
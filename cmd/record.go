@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// recording is a request curly record proxied and the response it got, as
+// saved to a JSON file of its own
+type recording struct {
+	RecordedAt time.Time        `json:"recorded_at"`
+	Request    recordedRequest  `json:"request"`
+	Response   recordedResponse `json:"response"`
+}
+
+// recordedRequest is the request of a recording, matched by curly replay on
+// its method, path and query
+type recordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	recordedBody
+}
+
+// recordedResponse is the response of a recording
+type recordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	recordedBody
+}
+
+// recordedBody is the body of a request or response: text as is, anything
+// else in base64
+type recordedBody struct {
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+func newRecordedBody(body []byte) recordedBody {
+	if utf8.Valid(body) {
+		return recordedBody{Body: string(body)}
+	}
+	return recordedBody{Body: base64.StdEncoding.EncodeToString(body), BodyEncoding: "base64"}
+}
+
+// bytes returns the body as it was sent
+func (b recordedBody) bytes() ([]byte, error) {
+	if b.BodyEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Body)
+	}
+	return []byte(b.Body), nil
+}
+
+// redactHeader returns a copy of header with the values of the headers
+// named like secrets, and of cookies, replaced with ****
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name, values := range redacted {
+		if !secretNamePattern.MatchString(name) && !strings.EqualFold(name, "Cookie") && !strings.EqualFold(name, "Set-Cookie") {
+			continue
+		}
+		for i := range values {
+			values[i] = redactedValue
+		}
+	}
+	return redacted
+}
+
+// recordingKey is what curly replay matches requests on: the method, path
+// and query, its parameters sorted
+func recordingKey(method, path, rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return method + " " + path + "?" + rawQuery
+	}
+	return method + " " + path + "?" + query.Encode()
+}
+
+// capturingWriter passes a response on while keeping its status and body
+type capturingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// newTargetProxy returns a proxy sending requests on to target, their
+// query as sent rather than re-encoded
+func newTargetProxy(target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.RawQuery = r.In.URL.RawQuery
+			r.SetURL(target)
+			r.Out.Host = target.Host
+		},
+	}
+}
+
+// parseTarget parses the URL of --target
+func parseTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --target %q, expected a URL like https://api.example.com", target)
+	}
+	return u, nil
+}
+
+// recorder proxies requests to a target, saving each with its response to
+// a file of dir
+type recorder struct {
+	proxy *httputil.ReverseProxy
+	dir   string
+	log   *requestLog
+	mu    sync.Mutex
+	// next numbers the files, so they list in the order requests came in
+	next int
+}
+
+func NewRecordCmd() *cobra.Command {
+	var host string
+	var port int
+	var target string
+	var out string
+
+	cmd := &cobra.Command{
+		Use:          "record --target <url> --out <dir>",
+		Short:        "Proxy requests to an API, saving each with its response for curly replay",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetURL, err := parseTarget(target)
+			if err != nil {
+				return err
+			}
+			rec, err := newRecorder(targetURL, out, &requestLog{w: cmd.ErrOrStderr()})
+			if err != nil {
+				return err
+			}
+			listener, baseURL, err := listenLocal(host, port)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Recording requests to %s at %s into %s, Ctrl+C to stop\n", target, baseURL, out)
+			return serveUntilInterrupted(listener, rec)
+		},
+	}
+
+	cmd.Flags().StringVar(&host, "host", "localhost", "Listen on this host")
+	cmd.Flags().IntVar(&port, "port", 8081, "Listen on this port, 0 for any free one")
+	cmd.Flags().StringVar(&target, "target", "", "Send the requests on to this URL, like https://api.example.com")
+	cmd.Flags().StringVar(&out, "out", "recordings", "Save the recordings to this directory")
+	cmd.MarkFlagRequired("target")
+
+	return cmd
+}
+
+// newRecorder returns a recorder saving to dir, numbering its files after
+// those already there
+func newRecorder(target *url.URL, dir string, log *requestLog) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{proxy: newTargetProxy(target), dir: dir, log: log, next: len(existing) + 1}, nil
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	captured := &capturingWriter{ResponseWriter: w}
+	rec.proxy.ServeHTTP(captured, r)
+
+	saved := recording{
+		RecordedAt: time.Now().UTC(),
+		Request: recordedRequest{
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Query:        r.URL.RawQuery,
+			Header:       redactHeader(r.Header),
+			recordedBody: newRecordedBody(body),
+		},
+		Response: recordedResponse{
+			Status:       captured.status,
+			Header:       redactHeader(w.Header()),
+			recordedBody: newRecordedBody(captured.body.Bytes()),
+		},
+	}
+	name, err := rec.save(saved)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	rec.log.print(r, captured.status, name)
+}
+
+// save writes saved to the next file of the directory, returning its name
+func (rec *recorder) save(saved recording) (string, error) {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	name := fmt.Sprintf("%04d_%s_%s.json", rec.next, saved.Request.Method, generate.SanitizePath(saved.Request.Path))
+	if err := os.WriteFile(filepath.Join(rec.dir, name), append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to save recording: %w", err)
+	}
+	rec.next++
+	return name, nil
+}
+
+// replayer answers requests with the responses recorded for them, in turn
+// when several were, the last one repeating
+type replayer struct {
+	recordings map[string][]recording
+	// fallback gets the requests nothing was recorded for, unless nil
+	fallback http.Handler
+	log      *requestLog
+	mu       sync.Mutex
+	served   map[string]int
+}
+
+func NewReplayCmd() *cobra.Command {
+	var host string
+	var port int
+	var target string
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:               "replay <recordings-dir>",
+		Short:             "Answer requests with the responses curly record saved, matched by method, path and query",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rep, err := loadReplayer(args[0], &requestLog{w: cmd.ErrOrStderr()})
+			if err != nil {
+				return err
+			}
+			if target != "" && !strict {
+				targetURL, err := parseTarget(target)
+				if err != nil {
+					return err
+				}
+				rep.fallback = newTargetProxy(targetURL)
+			}
+			listener, baseURL, err := listenLocal(host, port)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Replaying %d recordings of %s at %s, Ctrl+C to stop\n", rep.count(), args[0], baseURL)
+			return serveUntilInterrupted(listener, rep)
+		},
+	}
+
+	cmd.Flags().StringVar(&host, "host", "localhost", "Listen on this host")
+	cmd.Flags().IntVar(&port, "port", 8081, "Listen on this port, 0 for any free one")
+	cmd.Flags().StringVar(&target, "target", "", "Send requests nothing was recorded for on to this URL instead of answering 404")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Answer 404 to requests nothing was recorded for, even with --target")
+
+	return cmd
+}
+
+// loadReplayer reads the recordings of dir, in the order of their files
+func loadReplayer(dir string, log *requestLog) (*replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	rep := &replayer{recordings: map[string][]recording{}, log: log, served: map[string]int{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+		var rec recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("%s isn't a recording: %w", path, err)
+		}
+		key := recordingKey(rec.Request.Method, rec.Request.Path, rec.Request.Query)
+		rep.recordings[key] = append(rep.recordings[key], rec)
+	}
+	if len(rep.recordings) == 0 {
+		return nil, fmt.Errorf("no recordings in %s", dir)
+	}
+	return rep, nil
+}
+
+// count returns how many recordings rep answers with
+func (rep *replayer) count() int {
+	n := 0
+	for _, recs := range rep.recordings {
+		n += len(recs)
+	}
+	return n
+}
+
+func (rep *replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := recordingKey(r.Method, r.URL.Path, r.URL.RawQuery)
+	recs := rep.recordings[key]
+	if len(recs) == 0 {
+		if rep.fallback != nil {
+			captured := &capturingWriter{ResponseWriter: w}
+			rep.fallback.ServeHTTP(captured, r)
+			rep.log.print(r, captured.status, "not recorded, proxied")
+			return
+		}
+		http.Error(w, "curly replay: nothing recorded for "+r.Method+" "+r.URL.RequestURI(), http.StatusNotFound)
+		rep.log.print(r, http.StatusNotFound, "not recorded")
+		return
+	}
+
+	rep.mu.Lock()
+	n := rep.served[key]
+	rep.served[key]++
+	rep.mu.Unlock()
+	rec := recs[min(n, len(recs)-1)]
+
+	body, err := rec.Response.bytes()
+	if err != nil {
+		http.Error(w, "curly replay: invalid recorded body", http.StatusInternalServerError)
+		rep.log.print(r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for name, values := range rec.Response.Header {
+		// The body is written whole, in one piece
+		if strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Transfer-Encoding") {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.WriteHeader(rec.Response.Status)
+	w.Write(body)
+	rep.log.print(r, rec.Response.Status, "replayed")
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/users":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=abc")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"call": %d, "sent": %s}`, calls, body)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00})
+		default:
+			fmt.Fprintf(w, "call %d of %s", calls, r.URL.RequestURI())
+		}
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+	dir := t.TempDir()
+
+	rec, err := newRecorder(targetURL, dir, &requestLog{w: io.Discard})
+	if err != nil {
+		t.Fatalf("newRecorder() error = %v", err)
+	}
+	recordingServer := httptest.NewServer(rec)
+	requests := []struct{ method, path, body string }{
+		{"POST", "/users", `{"name": "Ada"}`},
+		{"GET", "/search?b=2&a=1", ""},
+		{"GET", "/search?b=2&a=1", ""},
+		{"GET", "/logo.png", ""},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, recordingServer.URL+r.path, strings.NewReader(r.body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s through the recorder error = %v", r.method, r.path, err)
+		}
+		resp.Body.Close()
+	}
+	recordingServer.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	wantFiles := []string{"0001_POST_users.json", "0002_GET_search.json", "0003_GET_search.json", "0004_GET_logo.png.json"}
+	if len(files) != len(wantFiles) {
+		t.Fatalf("recorded %v, want %v", files, wantFiles)
+	}
+	for i, want := range wantFiles {
+		if filepath.Base(files[i]) != want {
+			t.Errorf("recording %d = %s, want %s", i+1, filepath.Base(files[i]), want)
+		}
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{`"Bearer s3cret"`, `"session=abc"`} {
+		if strings.Contains(string(data), want) {
+			t.Errorf("recording holds the secret %s:\n%s", want, data)
+		}
+	}
+	var saved recording
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Request.Header.Get("Authorization") != redactedValue || saved.Response.Header.Get("Set-Cookie") != redactedValue {
+		t.Errorf("headers = %v and %v, want Authorization and Set-Cookie redacted", saved.Request.Header, saved.Response.Header)
+	}
+	if saved.Request.Body != `{"name": "Ada"}` || saved.Response.Status != http.StatusCreated {
+		t.Errorf("recording = %+v", saved)
+	}
+
+	rep, err := loadReplayer(dir, &requestLog{w: io.Discard})
+	if err != nil {
+		t.Fatalf("loadReplayer() error = %v", err)
+	}
+	replaying := httptest.NewServer(rep)
+	defer replaying.Close()
+	calls = 0
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantBody     string
+	}{
+		{method: "POST", path: "/users", wantStatus: http.StatusCreated, wantBody: `{"call": 1, "sent": {"name": "Ada"}}`},
+		// The query matches in any order, and the recordings of a request
+		// answer in turn, the last repeating
+		{method: "GET", path: "/search?a=1&b=2", wantStatus: http.StatusOK, wantBody: "call 2 of /search?b=2&a=1"},
+		{method: "GET", path: "/search?b=2&a=1", wantStatus: http.StatusOK, wantBody: "call 3 of /search?b=2&a=1"},
+		{method: "GET", path: "/search?b=2&a=1", wantStatus: http.StatusOK, wantBody: "call 3 of /search?b=2&a=1"},
+		{method: "GET", path: "/logo.png", wantStatus: http.StatusOK, wantBody: "\x89PNG\xff\x00"},
+		{method: "GET", path: "/search?a=1", wantStatus: http.StatusNotFound, wantBody: "curly replay: nothing recorded for GET /search?a=1\n"},
+		{method: "DELETE", path: "/users", wantStatus: http.StatusNotFound, wantBody: "curly replay: nothing recorded for DELETE /users\n"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, replaying.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", tt.method, tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || !bytes.Equal(body, []byte(tt.wantBody)) {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("replaying called the target %d times, want none", calls)
+	}
+
+	// Without --strict, what wasn't recorded goes on to the target
+	rep.fallback = newTargetProxy(targetURL)
+	resp, err := http.Get(replaying.URL + "/search?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "call 1 of /search?a=1" {
+		t.Errorf("fall-through body = %q, want the target's", body)
+	}
+}
+
+func TestLoadReplayerErrors(t *testing.T) {
+	empty := t.TempDir()
+	if _, err := loadReplayer(empty, &requestLog{w: io.Discard}); err == nil || !strings.Contains(err.Error(), "no recordings in") {
+		t.Errorf("loadReplayer() of an empty directory error = %v", err)
+	}
+	invalid := t.TempDir()
+	if err := os.WriteFile(filepath.Join(invalid, "0001_GET_x.json"), []byte("method: GET"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadReplayer(invalid, &requestLog{w: io.Discard}); err == nil || !strings.Contains(err.Error(), "isn't a recording") {
+		t.Errorf("loadReplayer() of an invalid recording error = %v", err)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{
+		"Authorization":   {"Bearer x"},
+		"X-Api-Key":       {"k"},
+		"Cookie":          {"a=1"},
+		"X-Session-Token": {"t"},
+		"Accept":          {"application/json"},
+	}
+	redacted := redactHeader(header)
+	for _, name := range []string{"Authorization", "X-Api-Key", "Cookie", "X-Session-Token"} {
+		if got := redacted.Get(name); got != redactedValue {
+			t.Errorf("%s = %q, want it redacted", name, got)
+		}
+	}
+	if redacted.Get("Accept") != "application/json" || header.Get("Authorization") != "Bearer x" {
+		t.Errorf("redactHeader() = %v, changed %v", redacted, header)
+	}
+}
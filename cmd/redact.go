@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces the secrets in what curly shows of a command
+const redactedValue = "****"
+
+// secretWords are the names, of variables, headers, query parameters and JSON
+// fields, whose values are secrets
+const secretWords = `token|secret|password|authorization|api[_-]?key`
+
+// secretNamePattern matches the name of a variable holding a secret
+var secretNamePattern = regexp.MustCompile(`(?i)` + secretWords)
+
+// secretHeaderPattern matches a header with a secret value, capturing
+// everything ahead of the value, keeping an auth scheme like Bearer, and the
+// value
+var secretHeaderPattern = regexp.MustCompile(`(?i)([A-Za-z0-9-]*(?:` + secretWords + `)[A-Za-z0-9-]*\s*:\s*(?:(?:bearer|basic|digest|token)\s+)?)([^\s"']+)`)
+
+// secretParamPattern matches a query or form parameter with a secret value,
+// capturing everything ahead of the value and the value
+var secretParamPattern = regexp.MustCompile(`(?i)([?&][^=&#\s"']*(?:` + secretWords + `)[^=&#\s"']*=)([^&#\s"']+)`)
+
+// secretJSONPattern matches a JSON string field with a secret value,
+// capturing everything ahead of the value and the value
+var secretJSONPattern = regexp.MustCompile(`(?i)("[^"]*(?:` + secretWords + `)[^"]*"\s*:\s*")([^"]*)`)
+
+// secretUserPattern matches the password of -u user:password, capturing
+// everything ahead of it and the password
+var secretUserPattern = regexp.MustCompile(`((?:^|\s)(?:-u|--user)\s+['"]?[^:\s'"]*:)([^\s'"]+)`)
+
+// variableReferencePattern matches a value that is just a $VAR or ${VAR}
+// reference, which holds no secret itself and is left for a replay to fill
+var variableReferencePattern = regexp.MustCompile(`^\$(?:\{[A-Za-z_][A-Za-z0-9_]*\}|[A-Za-z_][A-Za-z0-9_]*)$`)
+
+// redactor hides the secrets a command sends in the text curly shows of it.
+// A nil redactor, with --show-secrets, leaves text as is
+type redactor struct {
+	// values are the values of the command's secret variables, longest
+	// first so one containing another is replaced whole
+	values []string
+	// commandValues are those of values resolved by running a command of
+	// envs.yml, never shown even by --dry-run
+	commandValues []string
+}
+
+// newRedactor returns the redactor for cmdText, whose secrets are the values
+// of the variables it assigns or references with a name like TOKEN, SECRET,
+// PASSWORD, AUTHORIZATION or API_KEY, or resolved by a command of envs.yml,
+// along with the values of headers, query parameters, JSON fields and -u
+// passwords named like that
+func newRedactor(cmdText string) *redactor {
+	seen := map[string]bool{}
+	r := &redactor{}
+	add := func(name, value string) {
+		if secretNamePattern.MatchString(name) && value != "" && value != placeholderValue && !seen[value] {
+			seen[value] = true
+			r.values = append(r.values, value)
+		}
+	}
+	for _, v := range resolveFileVariables(cmdText) {
+		switch {
+		case v.dynamic || v.value == "":
+		case isEnvCommandValue(v.name, v.value):
+			r.commandValues = append(r.commandValues, v.value)
+			if !seen[v.value] {
+				seen[v.value] = true
+				r.values = append(r.values, v.value)
+			}
+		default:
+			add(v.name, v.value)
+		}
+	}
+	// Secrets like AUTH_TOKEN come from the OS environment
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if strings.Contains(cmdText, "$"+name) || strings.Contains(cmdText, "${"+name) {
+			add(name, value)
+		}
+	}
+	sort.SliceStable(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	sort.SliceStable(r.commandValues, func(i, j int) bool { return len(r.commandValues[i]) > len(r.commandValues[j]) })
+	return r
+}
+
+// redact replaces the secrets in s with ****. Secret headers, parameters,
+// fields and passwords set to a $VAR reference are kept, as the history
+// replays them with the variable filled in again
+func (r *redactor) redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+	for _, pattern := range []*regexp.Regexp{secretHeaderPattern, secretParamPattern, secretJSONPattern, secretUserPattern} {
+		s = pattern.ReplaceAllStringFunc(s, func(match string) string {
+			m := pattern.FindStringSubmatch(match)
+			if variableReferencePattern.MatchString(m[2]) {
+				return match
+			}
+			return m[1] + redactedValue
+		})
+	}
+	return s
+}
+
+// redactCommandValues replaces only the values resolved by a command of
+// envs.yml in s with ****, for output that otherwise shows secrets as they are
+func (r *redactor) redactCommandValues(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, value := range r.commandValues {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+	return s
+}
+
+// redactError returns err with the secrets in its message redacted, still
+// wrapping it for errors.Is and errors.As
+func (r *redactor) redactError(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	msg := r.redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return redactedError{msg: msg, err: err}
+}
+
+// redactedError is an error whose message had secrets redacted
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// writeCommand prints the commands of cmdText as they will run, with the
+// variables expanded like --dry-run and the secrets redacted by r
+func writeCommand(out io.Writer, cmdText string, r *redactor) {
+	expanded, _ := expandCommandText(cmdText, resolveFileVariables(cmdText))
+	fmt.Fprintf(out, "Running:\n%s\n", r.redact(expanded))
+}
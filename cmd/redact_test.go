@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Setenv("AUTH_TOKEN", "eyJhbGciOi.from-env")
+	tests := []struct {
+		name    string
+		cmdText string
+		text    string
+		want    string
+	}{
+		{
+			name:    "header from a variable",
+			cmdText: "TOKEN=\"s3cr3t-value\"\ncurl -H \"X-Session: ${TOKEN}\" x",
+			text:    `curl -H "X-Session: s3cr3t-value" x`,
+			want:    `curl -H "X-Session: ****" x`,
+		},
+		{
+			name: "authorization header",
+			text: `curl -H 'Authorization: Bearer abc.def.ghi' -H 'Accept: application/json' x`,
+			want: `curl -H 'Authorization: Bearer ****' -H 'Accept: application/json' x`,
+		},
+		{
+			name: "api key header",
+			text: `curl -H "X-API-Key: 123456" x`,
+			want: `curl -H "X-API-Key: ****" x`,
+		},
+		{
+			name: "api_key query parameter",
+			text: `curl "https://api.example.com/users?page=2&api_key=abcd1234&sort=name"`,
+			want: `curl "https://api.example.com/users?page=2&api_key=****&sort=name"`,
+		},
+		{
+			name:    "variable expanded in the URL",
+			cmdText: "API_KEY=\"k-9876\"\ncurl \"https://api.example.com/v1/${API_KEY}/users\"",
+			text:    `curl "https://api.example.com/v1/k-9876/users"`,
+			want:    `curl "https://api.example.com/v1/****/users"`,
+		},
+		{
+			name:    "OS environment variable",
+			cmdText: "curl -H \"X-Auth: ${AUTH_TOKEN}\" x",
+			text:    `curl -H "X-Auth: eyJhbGciOi.from-env" x`,
+			want:    `curl -H "X-Auth: ****" x`,
+		},
+		{
+			name: "JSON body and -u password",
+			text: `curl -u ada:hunter2 -d '{"user": "ada", "password": "hunter2"}' x`,
+			want: `curl -u ada:**** -d '{"user": "ada", "password": "****"}' x`,
+		},
+		{
+			name: "variable references are kept",
+			text: `curl -H "Authorization: Bearer ${TOKEN}" "x?api_key=$API_KEY" -u ada:${PASSWORD} -d '{"password": "${PASSWORD}"}'`,
+			want: `curl -H "Authorization: Bearer ${TOKEN}" "x?api_key=$API_KEY" -u ada:${PASSWORD} -d '{"password": "${PASSWORD}"}'`,
+		},
+		{
+			name: "values around a reference are not",
+			text: `curl -H "Authorization: Bearer ${TOKEN}-x" "x?api_key=${KEY:-k-9876}"`,
+			want: `curl -H "Authorization: Bearer ****" "x?api_key=****"`,
+		},
+		{
+			name:    "other variables are kept",
+			cmdText: "USER_ID=\"42\"\nPASSWORD=\"VALUE\"\ncurl \"x/users/${USER_ID}\"",
+			text:    `curl "x/users/42" VALUE`,
+			want:    `curl "x/users/42" VALUE`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRedactor(tt.cmdText).redact(tt.text); got != tt.want {
+				t.Errorf("redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var none *redactor
+	if got := none.redact("curl -H 'Authorization: Bearer abc' x"); got != "curl -H 'Authorization: Bearer abc' x" {
+		t.Errorf("nil redactor redact() = %q, want it unchanged", got)
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	cmdText := "#### Variables ####\nBASE_URL=\"https://api.example.com\"\nAPI_KEY=\"k-9876\"\n\ncurl -k -s \"${BASE_URL}/users?api_key=${API_KEY}\" \\\n  -H \"Authorization: Bearer ${TOKEN:-abc.def}\""
+
+	var out bytes.Buffer
+	writeCommand(&out, cmdText, newRedactor(cmdText))
+	want := "Running:\ncurl -k -s \"https://api.example.com/users?api_key=****\" \\\n  -H \"Authorization: Bearer ****\"\n"
+	if out.String() != want {
+		t.Errorf("writeCommand() printed:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	writeCommand(&out, cmdText, nil)
+	if !strings.Contains(out.String(), "api_key=k-9876") {
+		t.Errorf("writeCommand() with --show-secrets printed:\n%s", out.String())
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	r := newRedactor("TOKEN=\"s3cr3t\"\ncurl x")
+	cause := errors.New("connection refused")
+	err := r.redactError(fmt.Errorf("request with s3cr3t to x?token=abc failed: %w", cause))
+	if err.Error() != "request with **** to x?token=**** failed: connection refused" {
+		t.Errorf("redactError() = %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("redactError() doesn't wrap the error anymore")
+	}
+}
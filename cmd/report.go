@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reportFormats are the formats --report-format accepts
+var reportFormats = []string{"junit", "json"}
+
+// resolveReportFormat returns the format to write path in: format when given,
+// otherwise json for a .json file and junit for anything else
+func resolveReportFormat(path, format string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			return "json", nil
+		}
+		return "junit", nil
+	}
+	for _, f := range reportFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --report-format %q, expected one of %s", format, strings.Join(reportFormats, ", "))
+}
+
+// writeSuiteReport writes run to path in format
+func writeSuiteReport(path, format string, run *suiteRun) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if format == "json" {
+		err = writeJSONReport(f, run)
+	} else {
+		err = writeJUnitReport(f, run)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report to %s: %w", path, err)
+	}
+	return nil
+}
+
+// junitTestSuites is the root of a JUnit XML report, in the dialect GitLab
+// and Jenkins read
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport writes run as JUnit XML, a testcase per .curl file
+func writeJUnitReport(w io.Writer, run *suiteRun) error {
+	suite := junitTestSuite{
+		Name:      run.name,
+		Tests:     len(run.results),
+		Failures:  run.failed,
+		Skipped:   run.skipped,
+		Time:      junitSeconds(run.took),
+		Timestamp: run.start.Format("2006-01-02T15:04:05"),
+	}
+	for _, r := range run.results {
+		c := junitTestCase{Name: r.name, Classname: run.name, Time: junitSeconds(r.took)}
+		switch {
+		case r.skip != "":
+			c.Skipped = &junitSkipped{Message: r.skip}
+		case r.failure != "":
+			text := r.failure
+			if r.status != 0 {
+				text += fmt.Sprintf("\nstatus: %d", r.status)
+			}
+			text += "\nbody: " + r.body
+			c.Failure = &junitFailure{Message: r.failure, Text: text}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	report := junitTestSuites{
+		Name:     run.name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitSeconds formats d as the fractional seconds JUnit uses for times
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// suiteReport is the schema --report-format json writes a suite run as
+type suiteReport struct {
+	Name       string            `json:"name"`
+	StartTime  time.Time         `json:"start_time"`
+	DurationMs float64           `json:"duration_ms"`
+	Passed     int               `json:"passed"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
+	Tests      []suiteReportTest `json:"tests"`
+}
+
+// suiteReportTest is how one .curl file of the suite went
+type suiteReportTest struct {
+	Name string `json:"name"`
+	// Result is pass, fail or skip
+	Result     string  `json:"result"`
+	Status     int     `json:"status,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Failure    string  `json:"failure,omitempty"`
+	Body       string  `json:"body,omitempty"`
+	SkipReason string  `json:"skip_reason,omitempty"`
+}
+
+// writeJSONReport writes run as a suiteReport
+func writeJSONReport(w io.Writer, run *suiteRun) error {
+	report := suiteReport{
+		Name:       run.name,
+		StartTime:  run.start,
+		DurationMs: milliseconds(run.took),
+		Passed:     run.passed,
+		Failed:     run.failed,
+		Skipped:    run.skipped,
+		Tests:      []suiteReportTest{},
+	}
+	for _, r := range run.results {
+		t := suiteReportTest{Name: r.name, Result: "pass", Status: r.status, DurationMs: milliseconds(r.took)}
+		switch {
+		case r.skip != "":
+			t.Result, t.SkipReason = "skip", r.skip
+		case r.failure != "":
+			t.Result, t.Failure, t.Body = "fail", r.failure, r.body
+		}
+		report.Tests = append(report.Tests, t)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(report)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testSuiteRun is a run with a passed, a failed and a skipped test
+func testSuiteRun() *suiteRun {
+	return &suiteRun{
+		name:    "collection",
+		start:   time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		took:    1234 * time.Millisecond,
+		passed:  1,
+		failed:  1,
+		skipped: 1,
+		results: []suiteResult{
+			{name: "GET_health.curl", status: 200, took: 45 * time.Millisecond},
+			{
+				name:    "users/GET_users.curl",
+				status:  503,
+				took:    1180 * time.Millisecond,
+				failure: "expectation failed: expected status 2xx, got 503",
+				body:    `{"error":"<unavailable> & retry"}`,
+			},
+			{name: "users/DELETE_id.curl", skip: "destroys data"},
+		},
+	}
+}
+
+// checkGolden compares got with the golden file testdata/name, rewriting it
+// with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run go test ./cmd -run %s -update if that's intended:\n%s", name, t.Name(), got)
+	}
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeJUnitReport(&out, testSuiteRun()); err != nil {
+		t.Fatalf("writeJUnitReport() error = %v", err)
+	}
+	checkGolden(t, "suite_report.xml", out.Bytes())
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeJSONReport(&out, testSuiteRun()); err != nil {
+		t.Fatalf("writeJSONReport() error = %v", err)
+	}
+	checkGolden(t, "suite_report.json", out.Bytes())
+}
+
+func TestResolveReportFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{path: "junit.xml", want: "junit"},
+		{path: "report.JSON", want: "json"},
+		{path: "report", want: "junit"},
+		{path: "report.xml", format: "json", want: "json"},
+		{path: "report.xml", format: "tap", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveReportFormat(tt.path, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveReportFormat(%q, %q) error = %v, wantErr %v", tt.path, tt.format, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveReportFormat(%q, %q) = %q, want %q", tt.path, tt.format, got, tt.want)
+		}
+	}
+}
@@ -1,112 +1,187 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
-)
-
-type Environment map[string]string
-
-type EnvConfig struct {
-	Environments map[string]Environment `yaml:"environments"`
-}
-
-type ExecutionStats struct {
-	Total     int
-	Success   int32
-	Failed    int32
-	StartTime time.Time
-	EndTime   time.Time
-	Errors    []string
-	errorsMux sync.Mutex
-}
-
-func (s *ExecutionStats) RecordSuccess() {
-	atomic.AddInt32(&s.Success, 1)
-}
-
-func (s *ExecutionStats) RecordFailure(err error) {
-	atomic.AddInt32(&s.Failed, 1)
-	s.errorsMux.Lock()
-	s.Errors = append(s.Errors, err.Error())
-	s.errorsMux.Unlock()
-}
-
-func (s *ExecutionStats) Print() {
-	duration := s.EndTime.Sub(s.StartTime)
 
-	fmt.Fprintf(os.Stderr, "\n")
-	fmt.Fprintf(os.Stderr, "Summary:\n")
-	fmt.Fprintf(os.Stderr, "  Total:      %d\n", s.Total)
-	fmt.Fprintf(os.Stderr, "  Success:    %d\n", s.Success)
-	fmt.Fprintf(os.Stderr, "  Failed:     %d\n", s.Failed)
-	fmt.Fprintf(os.Stderr, "  Duration:   %s\n", duration.Round(time.Millisecond))
-
-	if s.Total > 0 {
-		avgTime := duration / time.Duration(s.Total)
-		fmt.Fprintf(os.Stderr, "  Avg time:   %s\n", avgTime.Round(time.Millisecond))
-
-		if duration.Seconds() > 0 {
-			throughput := float64(s.Total) / duration.Seconds()
-			fmt.Fprintf(os.Stderr, "  Throughput: %.2f req/s\n", throughput)
-		}
-	}
-
-	if len(s.Errors) > 0 {
-		fmt.Fprintf(os.Stderr, "\nErrors:\n")
-		errorCounts := make(map[string]int)
-		for _, err := range s.Errors {
-			errorCounts[err]++
-		}
-		for errMsg, count := range errorCounts {
-			if count > 1 {
-				fmt.Fprintf(os.Stderr, "  [%dx] %s\n", count, errMsg)
-			} else {
-				fmt.Fprintf(os.Stderr, "  %s\n", errMsg)
-			}
-		}
-	}
-}
+	"github.com/ErikVib/curly/internal/output"
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
 
 var outputMutex sync.Mutex
 
 func Execute() error {
 	rootCmd := NewRootCmd()
 	rootCmd.AddCommand(NewGenerateCmd())
+	rootCmd.AddCommand(NewValidateCmd())
+	rootCmd.AddCommand(NewMockCmd())
+	rootCmd.AddCommand(NewRecordCmd())
+	rootCmd.AddCommand(NewReplayCmd())
+	rootCmd.AddCommand(NewInitCmd())
+	rootCmd.AddCommand(NewTestCmd())
+	rootCmd.AddCommand(NewRunCmd())
+	rootCmd.AddCommand(NewRunAllCmd())
+	rootCmd.AddCommand(NewSessionCmd())
+	rootCmd.AddCommand(NewEnvsCmd())
+	rootCmd.AddCommand(NewListCmd())
+	rootCmd.AddCommand(NewGrepCmd())
+	rootCmd.AddCommand(NewHistoryCmd())
+	rootCmd.AddCommand(NewCleanCmd())
+	rootCmd.AddCommand(NewDoctorCmd())
+	rootCmd.AddCommand(NewExportCmd())
+	rootCmd.AddCommand(NewPreviewCmd())
 	rootCmd.AddCommand(NewCompletionCmd(rootCmd))
 	return rootCmd.Execute()
 }
 
+// runOptions controls how a .curl file is prepared before it is executed
+type runOptions struct {
+	envName string
+	envFile string
+	// envsFile is the envs.yml the environments are read from, --envs-file
+	// or the one run.FindEnvsFile finds for the file prepared
+	envsFile string
+	// envSource is what named envName, said with --verbose, see
+	// withFileEnvironment
+	envSource   string
+	insecure    bool
+	overrides   run.Environment
+	showSecrets bool
+	noExecEnv   bool
+	verbose     bool
+	// headers are added to every curl command as -H arguments, replacing
+	// the command's own headers of the same name with headerReplace
+	headers       []string
+	headerReplace bool
+	// captured holds the values captured from responses earlier in a chain,
+	// layered over the environment
+	captured run.Environment
+	// session names the cookie jar every curl command reads and writes, see
+	// injectCookieJar
+	session string
+	// audit logs the executions of the prepared files, unless nil
+	audit *auditLog
+	// noAuthCache fetches a new token for the environment's auth block
+	// instead of using the cached one
+	noAuthCache bool
+	// spec checks the responses against an OpenAPI spec, unless nil
+	spec *specValidator
+	// tls are the --cert, --key and --cacert files, passed to every curl
+	// command over those of the environment's tls block
+	tls run.TLSConfig
+	// proxy is the --proxy every curl command goes through, over the
+	// environment's proxy, and noProxy the --noproxy hosts reached directly
+	proxy   string
+	noProxy string
+	// follow adds -L to every curl command, and includeHeaders -i
+	follow         bool
+	includeHeaders bool
+	// sources records where the values of the variables of the file
+	// prepared came from, for --show-vars, unless nil
+	sources run.Sources
+}
+
 func NewRootCmd() *cobra.Command {
-	var envName string
+	var opts runOptions
 	var filePath string
 	var times int
+	var duration time.Duration
+	var rate float64
 	var parallel int
-	var delay int
-	var verbose bool
-	var insecure bool
+	var delay time.Duration
+	var jitter time.Duration
+	var vars []string
+	var dryRun bool
+	var showVars bool
+	var strictVars bool
+	var strictAuth bool
+	var yes bool
+	var confirmWrites bool
+	var maxFailures int
+	var failFast bool
+	var noProgress bool
+	var quiet bool
+	var stream bool
+	var native bool
+	var seed uint64
+	var requestIDHeader string
+	var timing bool
+	var keepGoing bool
+	var respectRetryAfter bool
+	var outputDir string
+	var outputFile string
+	var raw bool
+	var jq string
+	var expectStatus string
+	var expectBodyContains []string
+	var expectJSON []string
+	var maxFailureRate float64
+	var failOnStatus string
+	var statsOut string
+	var statsFormat string
+	var baselinePath string
+	var failIfSlower string
+	var logFile string
+	var logDetail string
+	var noHistory bool
+	var saveEdits bool
+	var editing editOptions
+	var noFzf bool
+	var selectName string
+	var strictSelect bool
+	var dataFile string
+	var strictData bool
+	// configuredDir is the collection directory the global config names, run
+	// from when none is passed
+	var configuredDir string
+	// envPassed is set when -e was passed, rather than set by a config, so
+	// it wins over the environment a file or its directory names
+	var envPassed bool
 
 	cmd := &cobra.Command{
 		Use:   "curly [collection-dir]",
 		Short: "Fuzzy-find an endpoint (.curl) and open in $EDITOR, then run on save/exit",
 		Args:  cobra.MaximumNArgs(1),
+		// A failed run prints its error alone, main printing it once
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			global, err := loadConfig(globalConfigPath())
+			if err != nil {
+				return err
+			}
+			dir := configDir(args)
+			if !cmd.HasParent() && len(args) == 0 && global.collection() != "" {
+				configuredDir = global.collection()
+				dir = configuredDir
+			}
+			envPassed = cmd.Flags().Changed("env")
+			return applyConfigs(cmd, dir, global)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			dir := "."
+			if configuredDir != "" {
+				dir = configuredDir
+			}
 			if len(args) == 1 {
 				dir = args[0]
 			}
@@ -114,148 +189,781 @@ func NewRootCmd() *cobra.Command {
 			if times < 1 {
 				return fmt.Errorf("times must be at least 1, got %d", times)
 			}
+			if selectName != "" && filePath != "" {
+				return fmt.Errorf("--select and --file cannot be used together")
+			}
+			if strictSelect && selectName == "" {
+				return fmt.Errorf("--strict-select needs --select")
+			}
+			if duration > 0 && cmd.Flags().Changed("times") {
+				return fmt.Errorf("--duration and --times cannot be used together")
+			}
 			if parallel < 1 {
 				return fmt.Errorf("parallel must be at least 1, got %d", parallel)
 			}
-			if delay < 0 {
-				return fmt.Errorf("delay cannot be negative, got %d", delay)
+			if jitter > 0 && delay == 0 {
+				return fmt.Errorf("--jitter needs --delay")
+			}
+			if rate < 0 {
+				return fmt.Errorf("rate cannot be negative, got %g", rate)
+			}
+			if rate > 0 && delay > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: --delay is ignored when --rate is set\n")
+				delay, jitter = 0, 0
+			}
+			if maxFailures < 0 {
+				return fmt.Errorf("max-failures cannot be negative, got %d", maxFailures)
+			}
+			if maxFailureRate < 0 || maxFailureRate > 1 {
+				return fmt.Errorf("max-failure-rate must be between 0 and 1, got %g", maxFailureRate)
+			}
+
+			if requestIDHeader != "" {
+				if err := parseHeaderFlags([]string{requestIDHeader + ":"}); err != nil || strings.Contains(requestIDHeader, ":") {
+					return fmt.Errorf("invalid --request-id-header %q, expected a header name like X-Request-Id", requestIDHeader)
+				}
+			}
+
+			if outputDir != "" && outputFile != "" {
+				return fmt.Errorf("--output-dir and --output-file cannot be used together")
+			}
+			if outputFile != "" && (times > 1 || duration > 0) {
+				return fmt.Errorf("--output-file saves a single response, use --output-dir for repeated runs")
+			}
+
+			if raw && jq != "" {
+				return fmt.Errorf("--raw and --jq cannot be used together")
+			}
+			if jq != "" {
+				if err := checkJQ(jq); err != nil {
+					return fmt.Errorf("--jq: %w", err)
+				}
+			}
+			expectStatuses, err := parseStatusPatterns(expectStatus)
+			if err != nil {
+				return fmt.Errorf("--expect-status: %w", err)
+			}
+			expectFlags := expectations{statuses: expectStatuses, bodyContains: expectBodyContains, json: expectJSON}
+
+			var rows []dataRow
+			if dataFile != "" {
+				if duration > 0 {
+					return fmt.Errorf("--data-file and --duration cannot be used together")
+				}
+				if rows, err = loadDataFile(dataFile, strictData); err != nil {
+					return err
+				}
+			} else if strictData {
+				return fmt.Errorf("--strict-data needs --data-file")
+			}
+			// runs is how many times the command runs, times for each row
+			runs := times * max(len(rows), 1)
+			if outputFile != "" && runs > 1 {
+				return fmt.Errorf("--output-file saves a single response, use --output-dir for repeated runs")
+			}
+			if parallel > runs && duration == 0 {
+				parallel = runs
+			}
+			if opts.session != "" && parallel > 1 {
+				fmt.Fprintf(os.Stderr, "Warning: --session with --parallel %d: concurrent requests share one cookie jar, the last to finish overwriting what the others wrote\n", parallel)
 			}
 
-			if parallel > times {
-				parallel = times
+			failOn, err := parseStatusPatterns(failOnStatus)
+			if err != nil {
+				return err
+			}
+			if statsOut != "" {
+				if statsFormat, err = resolveStatsFormat(statsOut, statsFormat); err != nil {
+					return err
+				}
+			}
+			if err := checkAuditDetail(logDetail); err != nil {
+				return err
+			}
+			var baseline *statsReport
+			if baselinePath != "" {
+				report, err := loadBaseline(baselinePath)
+				if err != nil {
+					return err
+				}
+				baseline = &report
+			}
+			slowerThreshold := -1.0
+			if failIfSlower != "" {
+				if baseline == nil {
+					return fmt.Errorf("--fail-if-slower needs --baseline")
+				}
+				if slowerThreshold, err = parseSlowerThreshold(failIfSlower); err != nil {
+					return err
+				}
+			}
+
+			overrides, err := run.ParseVarOverrides(vars)
+			if err != nil {
+				return err
+			}
+			opts.overrides = overrides
+			if showVars {
+				opts.sources = run.Sources{}
+			}
+			if err := parseHeaderFlags(opts.headers); err != nil {
+				return err
+			}
+			if err := checkTLS(opts.tls, ""); err != nil {
+				return err
+			}
+			if opts.proxy != "" {
+				if _, err := parseProxyURL(opts.proxy); err != nil {
+					return fmt.Errorf("--proxy: %w", err)
+				}
+			}
+
+			// runEndpoint runs the command of the .curl file source, edited
+			// as edit describes, with opts of its environment
+			runEndpoint := func(cmdText, source string, edit *fileEdit, opts runOptions) error {
+				if err := checkVariables(cmdText); err != nil {
+					if strictVars {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+				if err := checkBearerTokens(cmdText, time.Now()); err != nil {
+					if strictAuth {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "Warning: %v, the request will likely be rejected\n", err)
+				}
+				expect, err := fileExpectations(source)
+				if err != nil {
+					return err
+				}
+				expect = expect.merge(expectFlags)
+				if err := expect.checkJQ(); err != nil {
+					return err
+				}
+				captures, err := fileCaptures(source)
+				if err != nil {
+					return err
+				}
+				if len(captures) > 0 && (runs > 1 || duration > 0) {
+					fmt.Fprintf(os.Stderr, "Warning: captures are only evaluated for single runs\n")
+					captures = nil
+				}
+				if err := checkCaptures(captures); err != nil {
+					return err
+				}
+				var commands []rowCommand
+				if len(rows) > 0 {
+					commands = rowCommands(cmdText, rows, opts.overrides)
+				}
+				if dryRun || showVars {
+					if len(commands) > 0 {
+						// The first row stands for the others
+						cmdText = commands[0].cmdText
+						for name := range rows[0].values {
+							if _, pinned := opts.overrides[name]; !pinned {
+								opts.sources.Set(name, fmt.Sprintf("--data-file row %d", rows[0].number))
+							}
+						}
+					}
+					var secrets *redactor
+					if !opts.showSecrets {
+						secrets = newRedactor(cmdText)
+					}
+					if showVars && len(run.EnvLayers(opts.envName)) > 1 {
+						if err := writeEnvironmentLayers(cmd.OutOrStdout(), run.FindEnvsFile(dir, source, opts.envsFile), opts.envName); err != nil {
+							return err
+						}
+					}
+					writeDryRun(cmd.OutOrStdout(), cmdText, dryRun, showVars, opts.sources, secrets)
+					return nil
+				}
+				var secrets *redactor
+				if !opts.showSecrets {
+					secrets = newRedactor(cmdText)
+				}
+				if opts.verbose {
+					writeCommand(os.Stderr, cmdText, secrets)
+				}
+				if outputDir != "" {
+					if err := os.MkdirAll(outputDir, 0755); err != nil {
+						return fmt.Errorf("failed to create output directory: %w", err)
+					}
+				}
+				if !yes && isTerminal(os.Stdin) {
+					if err := confirmRun(os.Stdin, os.Stderr, cmdText, opts.envName, runs, confirmWrites); err != nil {
+						return err
+					}
+				}
+				opts.audit = openAuditLog(logFile, logDetail)
+				defer opts.audit.Close()
+				auditRequest := opts.audit.request(cmdText, source, opts.envName)
+				if !noHistory {
+					recordHistory(cmdText, source, dir, opts.envName, !opts.showSecrets)
+				}
+				// Responses are formatted for people reading them in a terminal
+				pretty := !raw && isTerminal(os.Stdout)
+				stats, err := execCmd(cmdText, execOptions{
+					times:             runs,
+					rows:              commands,
+					rowTimes:          times,
+					duration:          duration,
+					rate:              rate,
+					parallel:          parallel,
+					delay:             delay,
+					jitter:            jitter,
+					verbose:           opts.verbose,
+					maxFailures:       maxFailures,
+					failFast:          failFast,
+					maxFailureRate:    maxFailureRate,
+					progressBar:       !noProgress && isTerminal(os.Stderr),
+					quiet:             quiet,
+					stream:            stream,
+					outputDir:         outputDir,
+					outputFile:        outputFile,
+					outputStem:        outputStem(source),
+					pretty:            pretty,
+					color:             pretty && output.Supported(),
+					jq:                jq,
+					expect:            expect,
+					captures:          captures,
+					failOn:            failOn,
+					native:            native,
+					seed:              templateSeed{seed: seed, set: cmd.Flags().Changed("seed")},
+					requestID:         requestIDHeader,
+					timing:            timing,
+					keepGoing:         keepGoing,
+					respectRetryAfter: respectRetryAfter,
+					redactor:          secrets,
+					audit:             auditRequest,
+				})
+				auditRequest.logRun(stats, err)
+				if err == nil {
+					err = offerSaveEdits(os.Stdin, os.Stderr, edit, saveEdits, isTerminal(os.Stdin))
+				}
+				if err == nil && len(stats.Captured) > 0 {
+					err = offerSession(os.Stdin, os.Stderr, dir, stats.Captured, isTerminal(os.Stdin))
+				}
+				if statsOut != "" {
+					err = errors.Join(err, writeStatsFile(statsOut, statsFormat, stats))
+				}
+				if baseline != nil {
+					base, current := metricsOf(*baseline), metricsOf(newStatsReport(stats))
+					printComparison(os.Stderr, filepath.Base(baselinePath), base, current)
+					if slowerThreshold >= 0 {
+						err = errors.Join(err, checkSlower(base, current, slowerThreshold))
+					}
+				}
+				return err
 			}
 
-			cmdText, err := func() (string, error) {
-				if filePath != "" {
-					return runFile(filePath, dir, envName, insecure)
+			if filePath != "" {
+				opts, err := withFileEnvironment(opts, envPassed, dir, filePath)
+				if err != nil {
+					return err
 				}
-				return launchCollection(dir, envName, insecure)
-			}()
+				cmdText, err := runFile(filePath, dir, opts)
+				if err != nil {
+					return err
+				}
+				return runEndpoint(cmdText, filePath, nil, opts)
+			}
+
+			endpoints, err := findEndpoints(dir)
 			if err != nil {
 				return err
 			}
-			return execCmd(cmdText, times, parallel, delay, verbose)
+			var selected []string
+			if selectName != "" {
+				var path string
+				path, err = selectEndpointByName(dir, endpoints, selectName, strictSelect)
+				selected = []string{path}
+			} else {
+				selected, err = selectEndpoints(dir, endpoints, noFzf)
+			}
+			if err != nil {
+				return err
+			}
+			if len(selected) > 1 && outputFile != "" {
+				return fmt.Errorf("--output-file saves a single response, use --output-dir to run several files")
+			}
+			if len(selected) > 1 && statsOut != "" {
+				return fmt.Errorf("--stats-out writes the statistics of a single file, pick one file to use it")
+			}
+			if len(selected) > 1 && baseline != nil {
+				return fmt.Errorf("--baseline compares the statistics of a single file, pick one file to use it")
+			}
+			if len(selected) == 1 {
+				opts, err := withFileEnvironment(opts, envPassed, dir, selected[0])
+				if err != nil {
+					return err
+				}
+				cmdText, edit, err := editEndpoint(selected[0], dir, opts, editing)
+				if err != nil {
+					return err
+				}
+				return runEndpoint(cmdText, selected[0], edit, opts)
+			}
+
+			// Several files run one after the other, each -n times
+			var failures []string
+			ran := 0
+			for i, path := range selected {
+				fmt.Fprintf(cmd.OutOrStdout(), "==> [%d/%d] %s\n", i+1, len(selected), endpointLines(dir, []string{path})[0])
+				ran++
+				opts, err := withFileEnvironment(opts, envPassed, dir, path)
+				var cmdText string
+				var edit *fileEdit
+				if err == nil {
+					cmdText, edit, err = editEndpoint(path, dir, opts, editing)
+				}
+				if err == nil {
+					err = runEndpoint(cmdText, path, edit, opts)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+					if failFast {
+						break
+					}
+				}
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			printEndpointsSummary(cmd.OutOrStdout(), len(selected), ran, failures)
+			if len(failures) > 0 {
+				return fmt.Errorf("%d of %d files failed", len(failures), len(selected))
+			}
+			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&envName, "env", "e", "", "Environment name to use from envs.yml")
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Environment name to use from envs.yml, repeatable to layer environments, later ones overriding earlier ones")
+	cmd.Flags().BoolVar(&opts.noAuthCache, "no-auth-cache", false, "Fetch a new token for the environment's auth block instead of using the cached one")
+	cmd.Flags().StringVar(&opts.envFile, "env-file", "", "Read variables from this .env file instead of the collection's .env")
+	cmd.Flags().StringVar(&opts.envsFile, "envs-file", "", "Read the environments from this file instead of the envs.yml nearest to the file run")
 	cmd.Flags().StringVarP(&filePath, "file", "f", "", "Run a specific .curl file without opening editor")
+	cmd.Flags().StringVar(&selectName, "select", "", "Run the file whose method, path, summary or file name best matches this text, like \"create user\", instead of picking one")
+	cmd.Flags().BoolVar(&strictSelect, "strict-select", false, "Fail when several files match --select equally well instead of running the first of them")
+	cmd.Flags().StringVar(&dataFile, "data-file", "", "Run the file once per row of this CSV, whose header names the variables, or JSON Lines file, the row's values overriding the file's assignments; -n runs each row that many times")
+	cmd.Flags().BoolVar(&strictData, "strict-data", false, "Fail on a malformed row of --data-file instead of skipping it")
+	cmd.Flags().BoolVar(&noFzf, "no-fzf", false, "Pick files with curly's own finder even when fzf is installed")
+	cmd.Flags().BoolVar(&editing.noEdit, "no-edit", false, "Run the picked files as they are saved instead of opening them in the editor")
+	cmd.Flags().StringVar(&editing.editor, "editor", "", "Edit the picked files with this command, like \"code --wait\" (default: $VISUAL, then $EDITOR, then vim, vi or nano)")
+	cmd.Flags().BoolVar(&saveEdits, "save-edits", false, "Save the changes made in the editor back to the .curl file after a successful run instead of asking")
 	cmd.Flags().IntVarP(&times, "times", "n", 1, "Number of times to execute the request")
-	cmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "Number of concurrent executions per batch")
-	cmd.Flags().IntVar(&delay, "delay", 0, "Delay between batches in seconds")
-	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show progress and detailed output")
-	cmd.Flags().BoolVarP(&insecure, "insecure", "k", false, "Skip SSL certificate verification (adds -k to ALL curls in the file)")
+	cmd.Flags().Var(newDurationFlag(&duration), "duration", "Keep running the request until this much time has passed, like 10m, instead of --times times")
+	cmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "Number of concurrent executions")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "Start this many requests per second, fractions like 0.5 allowed, with --parallel capping how many are in flight")
+	cmd.Flags().Var(newDurationFlag(&delay), "delay", "Delay between each worker's requests, like 250ms or 2s; a bare number is seconds")
+	cmd.Flags().Var(newDurationFlag(&jitter), "jitter", "Move each --delay by a random amount within plus or minus this long, like 100ms, so workers don't hit the API in step")
+	cmd.Flags().IntVar(&maxFailures, "max-failures", 0, "Number of failed executions to tolerate before exiting non-zero")
+	cmd.Flags().BoolVar(&failFast, "fail-fast", false, "Abort the run at the first failed execution, and skip the rest of the picked files")
+	cmd.Flags().Float64Var(&maxFailureRate, "max-failure-rate", 0, "Abort the run once more than this fraction of executions failed, like 0.05, checked from the 20th on")
+	cmd.Flags().StringVar(&failOnStatus, "fail-on-status", "", "Count runs getting these HTTP statuses as failures, as a list of classes or codes like 4xx,5xx or 503")
+	cmd.Flags().StringVar(&statsOut, "stats-out", "", "Write the run's statistics to this file, as CSV for a .csv file and JSON otherwise")
+	cmd.Flags().StringVar(&statsFormat, "stats-format", "", "Format of --stats-out: json or csv (default: from the file extension)")
+	cmd.Flags().StringVar(&baselinePath, "baseline", "", "Compare the run's latency percentiles, throughput and error rate with those of this JSON --stats-out file")
+	cmd.Flags().StringVar(&failIfSlower, "fail-if-slower", "", "Fail when the p95 latency is more than this percentage, like 10%, slower than that of --baseline")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Discard the output of the requests, leaving the progress and summary")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "", "Save the output of each request to a file in this directory, named after the .curl file, the iteration and the time")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Save the output of the request to this file, for a single run")
+	cmd.Flags().StringVar(&expectStatus, "expect-status", "", "Fail runs whose last response doesn't have one of these HTTP statuses, like 200 or 2xx,304")
+	cmd.Flags().StringArrayVar(&expectBodyContains, "expect-body-contains", nil, "Fail runs whose last response body doesn't contain this text (repeatable)")
+	cmd.Flags().StringArrayVar(&expectJSON, "expect-json", nil, "Fail runs whose last response body doesn't satisfy this jq expression, like '.status == \"ok\"' (repeatable, needs jq on PATH)")
+	cmd.Flags().StringVar(&jq, "jq", "", "Filter JSON responses through this jq expression, printing only the result (needs jq on PATH)")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print responses as they came back instead of pretty-printing JSON and saving binary responses to files in a terminal")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Append a JSON line per execution, with the file, environment, redacted URL, status and result, to this audit log (default: $CURLY_LOG_FILE)")
+	cmd.Flags().StringVar(&logDetail, "log-detail", auditDetailIteration, "What --log-file logs for repeated runs: iteration, a line per execution, or run, a line summing up the run")
+	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Don't add the command to the history of curly history")
+	cmd.Flags().BoolVar(&native, "native", false, "Send the request with curly's own HTTP client, reusing connections across executions, instead of running curl; commands it can't send fall back to curl")
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Run the rest of the curl commands of a file after one fails, instead of ending the execution there")
+	cmd.Flags().BoolVar(&respectRetryAfter, "respect-retry-after", true, "Pause a worker of a repeated run getting a 429, or a 503 with a Retry-After, for the Retry-After or an exponential backoff, counting the execution as throttled; =false counts them like any status, for testing rate limits")
+	cmd.Flags().BoolVar(&timing, "timing", false, "Break the time of each request down into DNS, connect, TLS, server and transfer, summing up their percentiles and adding them to --stats-out")
+	cmd.Flags().StringVar(&requestIDHeader, "request-id-header", "", "Send a new UUID in this header, like X-Request-Id, with each execution, recorded with its latency in --stats-out")
+	cmd.Flags().Uint64Var(&seed, "seed", 0, "Seed the random values of {{uuid}}, {{randint}} and {{randstr}} so runs send the same ones")
+	cmd.Flags().BoolVar(&stream, "stream", false, "Print the output of requests as it arrives even when running in parallel, where it may interleave")
+	cmd.Flags().BoolVar(&noProgress, "no-progress", false, "Print periodic progress lines with --verbose instead of a progress bar")
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "Show progress and detailed output")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the resolved command with its variables expanded instead of running it")
+	cmd.Flags().BoolVar(&strictVars, "strict-vars", false, "Refuse to run when a variable is never assigned or still set to the placeholder VALUE")
+	cmd.Flags().BoolVar(&strictAuth, "strict-auth", false, "Refuse to run when an Authorization: Bearer header sends an expired JWT")
+	cmd.Flags().BoolVar(&showVars, "show-vars", false, "Print the resolved variables instead of running the command")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run DELETE requests (and PUT/PATCH with --confirm-writes) without asking for confirmation")
+	cmd.Flags().BoolVar(&confirmWrites, "confirm-writes", false, "Also ask for confirmation before PUT and PATCH requests")
+	cmd.Flags().BoolVarP(&opts.insecure, "insecure", "k", false, "Skip SSL certificate verification (adds -k to ALL curls in the file)")
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "L", false, "Follow redirects (adds -L to every curl command in the file)")
+	cmd.Flags().BoolVarP(&opts.includeHeaders, "include-headers", "i", false, "Print the status line and headers of responses above their body (adds -i to every curl command in the file)")
+	cmd.Flags().StringVar(&opts.tls.Cert, "cert", "", "Authenticate with this client certificate file, adding --cert to every curl command in the file (default: the environment's tls.cert)")
+	cmd.Flags().StringVar(&opts.tls.Key, "key", "", "Read the private key of --cert from this file, when it isn't in the certificate file (default: the environment's tls.key)")
+	cmd.Flags().StringVar(&opts.tls.CA, "cacert", "", "Verify the server's certificate against the CA certificates of this file (default: the environment's tls.ca)")
+	cmd.Flags().StringVar(&opts.proxy, "proxy", "", "Send every curl command in the file through this proxy, like http://proxy:3128 or socks5://localhost:1080 (default: the environment's proxy, then HTTPS_PROXY and the like)")
+	cmd.Flags().StringVar(&opts.noProxy, "noproxy", "", "Reach these comma-separated hosts directly instead of through the proxy, like localhost,.internal")
+	cmd.Flags().BoolVar(&opts.showSecrets, "show-secrets", false, "Show secrets in the command and errors -v prints and in the history instead of masking them")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Override a variable assigned in the file, as KEY=VALUE; takes precedence over envs.yml (repeatable)")
+	cmd.Flags().StringArrayVarP(&opts.headers, "header", "H", nil, "Add a \"Name: value\" header to every curl command in the file (repeatable)")
+	cmd.Flags().BoolVar(&opts.headerReplace, "header-replace", false, "Drop the file's own headers with the same names as --header ones instead of sending both")
+	cmd.Flags().BoolVar(&opts.noExecEnv, "no-exec-env", false, "Refuse to run $(...) commands in envs.yml values instead of executing them")
+	cmd.Flags().StringVar(&opts.session, "session", "", "Keep cookies across runs in the cookie jar of this named session, under .curly/sessions in the collection")
+	cmd.PersistentFlags().BoolVar(&output.NoColor, "no-color", false, "Print summaries, warnings, test results and JSON responses without colors, like setting NO_COLOR")
+
+	cmd.ValidArgsFunction = completeDirAt(0)
+	cmd.RegisterFlagCompletionFunc("file", completeCurlFiles(0))
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(0))
 
 	return cmd
 }
 
-func launchCollection(dir string, envName string, insecure bool) (string, error) {
-	var envVars Environment
-	if envName != "" {
-		var err error
-		envVars, err = loadEnvironmentVariables(envName, dir)
-		if err != nil {
-			return "", err
-		}
-	}
-
+// findEndpoints lists the .curl files in dir
+func findEndpoints(dir string) ([]string, error) {
 	matches := []string{}
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if strings.HasSuffix(d.Name(), ".curl") {
-			matches = append(matches, path)
-		}
+	err := run.WalkCurlFiles(dir, func(path string) error {
+		matches = append(matches, path)
 		return nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(matches) == 0 {
-		return "", errors.New("no .curl files found in directory")
+		return nil, errors.New("no .curl files found in directory")
 	}
+	return matches, nil
+}
 
-	selected, err := fzfSelect(matches)
+// editEndpoint opens the .curl file at path in the collection dir in the
+// editor, unless editing.noEdit, and returns the command to run and the edit
+// made to the file, nil when it was left as is
+func editEndpoint(path, dir string, opts runOptions, editing editOptions) (string, *fileEdit, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return "", nil, fmt.Errorf("failed to read file: %w", err)
 	}
-	if selected == "" {
-		return "", nil
+	// The environments are loaded first so a missing one fails before the
+	// editor opens
+	opts.envsFile = run.FindEnvsFile(dir, path, opts.envsFile)
+	envVars, err := loadRunVariables(dir, opts)
+	if err != nil {
+		return "", nil, err
 	}
 
-	content, err := os.ReadFile(selected)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+	// The editor shows the file as saved, the environment's values and the
+	// injected flags are only applied to the command once it is closed, over
+	// the assignments the user left as they were
+	edited := content
+	if !editing.noEdit {
+		editor, err := findEditor(editing.editor)
+		if errors.Is(err, errNoEditor) {
+			err = offerRunUnedited(os.Stdin, os.Stderr, path, err, isTerminal(os.Stdin))
+		} else if err == nil {
+			edited, err = editInEditor(path, content, editor)
+		}
+		if err != nil {
+			return "", nil, err
+		}
 	}
+	contentStr := string(edited)
 
-	contentStr := string(content)
-	if insecure {
-		contentStr = strings.ReplaceAll(contentStr, "curl ", "curl -k ")
+	envVars, err = resolveRunVariables(envVars, contentStr, dir, opts)
+	if err != nil {
+		return "", nil, err
 	}
-	if envName != "" {
-		contentStr = applyEnvironmentVars(contentStr, envVars)
+	// The values the user just edited win over those of the environments
+	runVars := envVars
+	if edited := editedVariables(string(content), contentStr); len(edited) > 0 {
+		runVars = run.Environment{}
+		for name, value := range envVars {
+			if !edited[name] {
+				runVars[name] = value
+			}
+		}
+		for name := range edited {
+			delete(opts.sources, name)
+		}
 	}
-	tmpFile := selected + ".tmp"
-	if err := os.WriteFile(tmpFile, []byte(contentStr), 0644); err != nil {
-		return "", fmt.Errorf("failed to write temp file: %w", err)
+	cmdText, err := buildCommand(contentStr, path, dir, runVars, opts)
+	if err != nil {
+		return "", nil, err
 	}
-	selected = tmpFile
-	defer os.Remove(tmpFile)
 
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "vim"
+	if contentStr == string(content) {
+		return cmdText, nil, nil
 	}
-
-	editCmd := exec.Command(editor, selected)
-	editCmd.Stdin = os.Stdin
-	editCmd.Stdout = os.Stdout
-	editCmd.Stderr = os.Stderr
-	if err := editCmd.Run(); err != nil {
-		return "", fmt.Errorf("editor failed: %w", err)
+	// The edits are kept even if the run fails or they aren't saved back
+	if err := keepLastEdit(dir, contentStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
+	return cmdText, &fileEdit{path: path, dir: dir, original: string(content), edited: contentStr, secrets: editSecrets(contentStr, envVars)}, nil
+}
 
-	content, err = os.ReadFile(selected)
+// loadRunVariables merges the variable sources layered over a file's own
+// values: the .env file, then the -e environment from opts.envsFile, which
+// wins when both set a variable. --var overrides are applied on top
+// separately. It starts the file's opts.sources over
+func loadRunVariables(dir string, opts runOptions) (run.Environment, error) {
+	clear(opts.sources)
+	vars, err := run.LoadDotEnv(dir, opts.envFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file after editing: %w", err)
+		return nil, err
+	}
+	// .env values are literal, escaped to stay so in the double-quoted
+	// assignments they replace
+	for k, v := range vars {
+		vars[k] = shellquote.EscapeDoubleQuoted(v)
+	}
+	dotEnv := run.DotEnvFile
+	if opts.envFile != "" {
+		dotEnv = filepath.Base(opts.envFile)
+	}
+	opts.sources.SetAll(vars, dotEnv)
+	if opts.envName == "" {
+		return vars, nil
 	}
 
-	cmdText := extractShellCommand(string(content))
-	if cmdText == "" {
-		return "", errors.New("no curl command found in file")
+	if opts.verbose {
+		if opts.envSource != "" {
+			fmt.Fprintf(os.Stderr, "Using environment %s from %s, set by %s\n", opts.envName, opts.envsFile, opts.envSource)
+		} else {
+			fmt.Fprintf(os.Stderr, "Using environment %s from %s\n", opts.envName, opts.envsFile)
+		}
+	}
+	env, err := run.LoadEnvironmentSources(opts.envName, opts.envsFile, opts.sources)
+	if err != nil {
+		return nil, err
+	}
+	merged := run.Environment{}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range env {
+		merged[k] = v
 	}
+	return merged, nil
+}
 
-	return cmdText, nil
+// envFlag is the -e flag. Repeated, like -e staging -e as-admin, it layers
+// the environments, later ones overriding the variables of earlier ones, and
+// keeps their names joined by commas in the string it points to
+type envFlag struct {
+	names *string
 }
 
-func loadEnvironmentVariables(envName string, dir string) (Environment, error) {
-	envsFile := filepath.Join(dir, "envs.yml")
-	config, err := loadEnvConfig(envsFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load envs.yml: %w", err)
+func newEnvFlag(names *string) *envFlag {
+	return &envFlag{names: names}
+}
+
+func (f *envFlag) String() string {
+	if f.names == nil {
+		return ""
 	}
+	return *f.names
+}
 
-	env, ok := config.Environments[envName]
-	if !ok {
-		return nil, fmt.Errorf("environment '%s' not found in envs.yml", envName)
+func (f *envFlag) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("empty environment name in %q", value)
+		}
+		if *f.names != "" {
+			*f.names += ","
+		}
+		*f.names += name
 	}
-	return env, nil
+	return nil
+}
+
+func (f *envFlag) Type() string {
+	return "name"
+}
+
+// failedError summarizes the requests of the run stats has that failed
+func failedError(s *run.ExecutionStats) error {
+	return fmt.Errorf("%d of %d requests failed", s.Failed, s.Total)
 }
 
-func execCmd(cmdText string, times int, parallel int, delay int, verbose bool) error {
-	if parallel < 1 {
-		parallel = 1
+// execOptions controls how many times and how fast execCmd runs a command
+type execOptions struct {
+	times int
+	// duration, when set, keeps starting executions until it has passed
+	// instead of running times times
+	duration time.Duration
+	// rate, when set, paces the starts of executions to this many per
+	// second, parallel capping how many are in flight
+	rate     float64
+	parallel int
+	// delay is how long each worker waits between its requests, moved by up
+	// to jitter either way, see jitterDelay
+	delay       time.Duration
+	jitter      time.Duration
+	verbose     bool
+	maxFailures int
+	failOn      []statusPattern
+	// failFast and maxFailureRate abort the run early, see abortReason
+	failFast       bool
+	maxFailureRate float64
+	// progressBar draws a progress bar on stderr for repeated runs instead
+	// of the --verbose progress lines
+	progressBar bool
+	// quiet discards the output of the commands
+	quiet bool
+	// stream prints the output of the commands as it comes instead of once
+	// each is done, which execCmd does for sequential runs
+	stream bool
+	// outputDir saves the stdout of each command to a file in it named after
+	// outputStem, outputFile to that one file, see outputPath
+	outputDir  string
+	outputFile string
+	outputStem string
+	// pretty indents JSON responses and saves binary ones to files, color
+	// colors them, jq filters them instead, see formatResponse
+	pretty bool
+	color  bool
+	jq     string
+	// expect fails executions whose last response doesn't look as expected
+	expect expectations
+	// captures are evaluated against the last response once it passed
+	// expect, see ExecutionStats.Captured
+	captures []capture
+	// spec checks the last response against the OpenAPI spec, unless nil
+	spec *specValidator
+	// keepOutput keeps the output in the commandResult even when expect
+	// and captures don't need it
+	keepOutput bool
+	// native sends the request with net/http instead of running curl, when
+	// parseNativeRequest can make sense of cmdText, and request is what it
+	// parsed
+	native  bool
+	request *nativeRequest
+	// redactor hides secrets in the errors of failed executions, unless nil
+	redactor *redactor
+	// audit logs the executions, unless nil
+	audit *auditRequest
+	// seed makes the random values of the template tokens reproducible
+	seed templateSeed
+	// requestID is the name of the header sending a new UUID with each
+	// execution, when set
+	requestID string
+	// timing breaks the time of each request down into its phases, for the
+	// summary and the stats
+	timing bool
+	// keepGoing runs the rest of the curl commands of a file after one
+	// failed, rather than ending the execution there
+	keepGoing bool
+	// respectRetryAfter counts the executions of a repeated run getting a
+	// 429, or a 503 with a Retry-After, as throttled rather than succeeded or
+	// failed, and pauses the worker running them, see throttledError
+	respectRetryAfter bool
+	// rows are the commands of the rows of --data-file, run instead of the
+	// command rowTimes times each, one row after the other
+	rows     []rowCommand
+	rowTimes int
+	// tagOutput heads the output of each execution with a line saying which
+	// it was, for parallel runs, where outputs come in any order. worker is
+	// the number of the worker of runPool running it, 0 outside of one
+	tagOutput bool
+	worker    int
+}
+
+// formatting reports whether responses are formatted before they are printed,
+// which needs each of them in full
+func (eo execOptions) formatting() bool {
+	return eo.pretty || eo.jq != ""
+}
+
+// minRequestsForRate is how many executions have to complete before
+// --max-failure-rate can abort a run, so a first unlucky one doesn't
+const minRequestsForRate = 20
+
+// abortReason returns which threshold of eo the executions recorded in stats
+// crossed, or "" when the run can go on
+func (eo execOptions) abortReason(stats *run.ExecutionStats) string {
+	failed := int(atomic.LoadInt32(&stats.Failed))
+	done := failed + int(atomic.LoadInt32(&stats.Success))
+	if eo.failFast && failed > 0 {
+		return "--fail-fast stops at the first failure"
 	}
+	if eo.maxFailureRate > 0 && done >= minRequestsForRate && float64(failed)/float64(done) > eo.maxFailureRate {
+		return fmt.Sprintf("failure rate %.1f%% exceeded --max-failure-rate %g", float64(failed)/float64(done)*100, eo.maxFailureRate)
+	}
+	return ""
+}
 
-	stats := &ExecutionStats{
-		Total:     times,
+// abortError stops a run that crossed a threshold of its execOptions
+type abortError struct {
+	reason string
+}
+
+func (e abortError) Error() string {
+	return "aborted: " + e.reason
+}
+
+// execCmd runs cmdText as eo says, parallel at a time. A run fails when it
+// exits non-zero or one of its curl commands gets an HTTP status matching
+// failOn, and execCmd fails when more than maxFailures runs do, printing the
+// summary for repeated runs. The stats of the run are returned either way
+func execCmd(cmdText string, eo execOptions) (*run.ExecutionStats, error) {
+	parallel := max(eo.parallel, 1)
+	// Output of one command at a time can't interleave, but formatting it
+	// needs it whole
+	eo.stream = eo.stream || (parallel == 1 && !eo.formatting())
+	repeated := eo.times > 1 || eo.duration > 0
+	// A single run has no next execution to pause for
+	eo.respectRetryAfter = eo.respectRetryAfter && repeated
+	stats := &run.ExecutionStats{
+		Total:     eo.times,
 		StartTime: time.Now(),
 	}
 
+	steps := fileSteps(cmdText)
+	stats.Steps = run.NewStepStats(steps)
+	writeOut := statusWriteOut
+	if eo.timing {
+		writeOut = timingWriteOut
+	}
+	if eo.respectRetryAfter {
+		writeOut = withRetryAfter(writeOut)
+	}
+	// inject readies the command of an execution, its steps stopping at the
+	// first to fail unless eo.keepGoing
+	inject := func(cmdText string) string {
+		if !eo.keepGoing {
+			cmdText = injectStepGuards(cmdText, eo.failOn)
+		}
+		return injectWriteOut(cmdText, writeOut)
+	}
+	if len(eo.rows) > 0 {
+		rows := make([]rowCommand, len(eo.rows))
+		for i, row := range eo.rows {
+			req, err := nativeRequestFor(row.cmdText, eo.native, i == 0)
+			if err != nil {
+				return stats, fmt.Errorf("row %d: %w", row.row, err)
+			}
+			rows[i] = rowCommand{row: row.row, cmdText: inject(row.cmdText), request: req}
+		}
+		eo.rows = rows
+	} else if eo.request == nil {
+		req, err := nativeRequestFor(cmdText, eo.native, true)
+		if err != nil {
+			return stats, err
+		}
+		eo.request = req
+	}
+	cmdText = inject(cmdText)
+	eo.tagOutput = parallel > 1 && repeated && !eo.stream
+
+	deadline := stats.StartTime.Add(eo.duration)
+	var bar *progressBar
+	// finish stops the clock and the progress bar, counting the requests that
+	// actually ran when running for a duration or interrupted
+	finish := func(interrupted bool) {
+		if bar != nil {
+			bar.stop()
+		}
+		stats.EndTime = time.Now()
+		if eo.duration > 0 || interrupted {
+			stats.Total = int(atomic.LoadInt32(&stats.Success) + atomic.LoadInt32(&stats.Failed) + atomic.LoadInt32(&stats.Throttled))
+		}
+	}
+
 	// (Ctrl+C)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -266,246 +974,888 @@ func execCmd(cmdText string, times int, parallel int, delay int, verbose bool) e
 
 	go func() {
 		<-sigCh
-		fmt.Fprintf(os.Stderr, "\nReceived interrupt signal, cancelling...\n")
+		logf("\nReceived interrupt signal, cancelling...\n")
 		cancel()
 	}()
 
-	if verbose && times > 1 {
-		if parallel > 1 {
-			fmt.Fprintf(os.Stderr, "Running %d requests (%d concurrent per batch)...\n", times, parallel)
+	// cancelled reports the run as cancelled by Ctrl+C
+	cancelled := func() (*run.ExecutionStats, error) {
+		finish(true)
+		if repeated {
+			stats.Print()
+		}
+		if stats.Failed > 0 {
+			return stats, fmt.Errorf("execution cancelled: %w", failedError(stats))
+		}
+		return stats, fmt.Errorf("execution cancelled")
+	}
+
+	if eo.verbose && repeated {
+		requests := fmt.Sprintf("%d requests", eo.times)
+		if eo.duration > 0 {
+			requests = "requests for " + eo.duration.String()
+		}
+		if eo.rate > 0 {
+			fmt.Fprintf(os.Stderr, "Running %s at %g req/s (at most %d in flight)...\n", requests, eo.rate, parallel)
+		} else if parallel > 1 {
+			fmt.Fprintf(os.Stderr, "Running %s (%d concurrent)...\n", requests, parallel)
 		} else {
-			fmt.Fprintf(os.Stderr, "Running %d requests sequentially...\n", times)
+			fmt.Fprintf(os.Stderr, "Running %s sequentially...\n", requests)
 		}
 	}
 
-	batches := (times + parallel - 1) / parallel
-	remaining := times
-	completed := 0
+	if eo.progressBar && repeated {
+		bar = startProgressBar(os.Stderr, stats, eo)
+		defer bar.stop()
+	}
 
-	for batchNum := range batches {
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			stats.EndTime = time.Now()
-			if times > 1 {
-				stats.Print()
-			}
-			return fmt.Errorf("execution cancelled")
-		default:
-		}
+	var stopErr error
+	var wasCancelled bool
+	if eo.rate > 0 {
+		stats.TargetRate = eo.rate
+		stopErr, wasCancelled = runPaced(ctx, cmdText, eo, parallel, deadline, stats)
+	} else {
+		stopErr, wasCancelled = runPool(ctx, cmdText, eo, parallel, deadline, stats)
+	}
+	if wasCancelled {
+		return cancelled()
+	}
+	var abort abortError
+	switch {
+	case errors.As(stopErr, &abort):
+		finish(false)
+		stats.Aborted = abort.reason
+		stats.Print()
+		return stats, fmt.Errorf("%w, %w", failedError(stats), stopErr)
+	case stopErr != nil && !repeated:
+		return stats, fmt.Errorf("command execution failed: %w", stopErr)
+	case stopErr != nil:
+		finish(false)
+		stats.Print()
+		return stats, fmt.Errorf("%w, stopping: %w", failedError(stats), stopErr)
+	}
 
-		if batchNum > 0 && delay > 0 {
-			time.Sleep(time.Duration(delay) * time.Second)
-		}
+	finish(false)
 
-		// Calculate batch size (last batch may be smaller)
-		batchSize := min(remaining, parallel)
-		remaining -= batchSize
+	// Print summary for multiple requests, always when some failed or were
+	// throttled
+	if repeated && (eo.verbose || eo.timing || stats.Failed > 0 || stats.Throttled > 0) {
+		stats.Print()
+	} else if eo.timing {
+		run.WriteTimingSummary(os.Stderr, stats.Latencies)
+	}
 
-		if parallel > 1 {
-			var wg sync.WaitGroup
-			for range batchSize {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
+	if int(stats.Failed) > eo.maxFailures {
+		return stats, failedError(stats)
+	}
+	return stats, nil
+}
 
-					// Check cancellation before executing
+// nativeRequestFor returns the request curly sends itself for cmdText, with
+// native or when there is no shell to run it, nil when it runs with curl. A
+// command --native can't send is warned about with warn
+func nativeRequestFor(cmdText string, native, warn bool) (*nativeRequest, error) {
+	if _, shellErr := shellPath(); shellErr != nil {
+		// Without a shell the request can only be sent natively
+		req, err := parseNativeRequest(cmdText)
+		if err != nil {
+			return nil, fmt.Errorf("%w, but this file needs the shell: %v", shellErr, err)
+		}
+		return req, nil
+	}
+	if !native {
+		return nil, nil
+	}
+	req, err := parseNativeRequest(cmdText)
+	if err != nil && warn {
+		fmt.Fprintf(os.Stderr, "Warning: --native can't send this command (%v), running it with curl instead\n", err)
+	}
+	return req, nil
+}
+
+// runPool runs executions on parallel workers, each taking the next iteration
+// as soon as it's done with its previous one and waiting eo.delay, moved by
+// eo.jitter, between its own, until eo.times have run or, with eo.duration,
+// the deadline has passed. A worker whose execution was throttled pauses
+// before taking the next, unless none is left. It stops starting executions
+// once the run crosses a threshold of eo, returning an abortError, and a
+// single worker stops at the first failure past eo.maxFailures and returns
+// it. cancelled reports Ctrl+C
+func runPool(ctx context.Context, cmdText string, eo execOptions, parallel int, deadline time.Time, stats *run.ExecutionStats) (stopErr error, cancelled bool) {
+	feedCtx, stopFeed := context.WithCancel(ctx)
+	if eo.duration > 0 {
+		feedCtx, stopFeed = context.WithDeadline(ctx, deadline)
+	}
+	defer stopFeed()
+	// Throttled executions stop pausing once every job is taken
+	pauseCtx, stopPauses := context.WithCancel(feedCtx)
+	defer stopPauses()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var completed int32
+	var stopOnce sync.Once
+
+	for worker := range parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			eo := eo
+			eo.worker = worker + 1
+			ran := false
+			// throttled counts the worker's throttled executions in a row
+			throttled := 0
+			for iteration := range jobs {
+				if ran && eo.delay > 0 {
 					select {
-					case <-ctx.Done():
-						return
-					default:
+					case <-feedCtx.Done():
+					case <-time.After(jitterDelay(eo.delay, eo.jitter)):
 					}
+				}
+				ran = true
 
-					if err := execShellCommand(cmdText); err != nil {
-						stats.RecordFailure(err)
-						if verbose {
-							fmt.Fprintf(os.Stderr, "command execution failed: %v\n", err)
-						}
-					} else {
-						stats.RecordSuccess()
+				// Check cancellation, the deadline or a stop before executing
+				if feedCtx.Err() != nil {
+					continue
+				}
+
+				err := runOnce(ctx, cmdText, iteration, stats, eo)
+				if errors.Is(err, context.Canceled) {
+					continue
+				}
+				var throttle throttledError
+				switch {
+				case errors.As(err, &throttle):
+					throttled++
+					recordThrottled(pauseCtx, iteration, throttle.pause(throttled), stats, eo)
+					err = nil
+				case err != nil:
+					throttled = 0
+					stats.RecordIterationFailure(iteration, err)
+					if eo.verbose {
+						logf("request %d failed: %v\n", iteration, err)
 					}
-				}()
-			}
-			wg.Wait()
-		} else {
-			if err := execShellCommand(cmdText); err != nil {
-				stats.RecordFailure(err)
-				stats.EndTime = time.Now()
-				if times > 1 {
-					stats.Print()
+				default:
+					throttled = 0
+					stats.RecordSuccess()
 				}
-				return fmt.Errorf("command execution failed: %w", err)
+				if reason := eo.abortReason(stats); reason != "" {
+					stopOnce.Do(func() {
+						stopErr = abortError{reason: reason}
+						stopFeed()
+					})
+				} else if err != nil && parallel == 1 && int(stats.Failed) > eo.maxFailures {
+					stopOnce.Do(func() {
+						stopErr = err
+						stopFeed()
+					})
+				}
+
+				n := int(atomic.AddInt32(&completed, 1))
+				if eo.verbose && !eo.progressBar && (eo.times > 1 || eo.duration > 0) && (n%parallel == 0 || eo.duration == 0 && n == eo.times) {
+					printProgress(eo, stats.StartTime, n)
+				}
+			}
+		}()
+	}
+
+feed:
+	for iteration := 1; eo.duration > 0 || iteration <= eo.times; iteration++ {
+		select {
+		case <-feedCtx.Done():
+			break feed
+		case jobs <- iteration:
+		}
+	}
+	close(jobs)
+	stopPauses()
+	wg.Wait()
+
+	return stopErr, ctx.Err() != nil
+}
+
+// runPaced starts executions at eo.rate per second, with at most parallel in
+// flight, until eo.times have started or, with eo.duration, the deadline has
+// passed, and waits for them. A throttled execution holds on to its place in
+// flight while it pauses, until none is left to start. It stops starting
+// executions once the run crosses a threshold of eo, returning an
+// abortError. cancelled reports Ctrl+C
+func runPaced(ctx context.Context, cmdText string, eo execOptions, parallel int, deadline time.Time, stats *run.ExecutionStats) (stopErr error, cancelled bool) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / eo.rate))
+	defer ticker.Stop()
+	inFlight := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	startCtx, stopStarts := context.WithCancel(ctx)
+	defer stopStarts()
+	var stopOnce sync.Once
+	// throttled counts the throttled executions in a row
+	var throttled int32
+
+	// Progress is printed about once a second
+	progressEvery := max(int(eo.rate), 1)
+
+starts:
+	for started := 0; eo.duration > 0 || started < eo.times; started++ {
+		if started > 0 {
+			select {
+			case <-startCtx.Done():
+				break starts
+			case <-ticker.C:
 			}
-			stats.RecordSuccess()
 		}
+		if eo.duration > 0 && !time.Now().Before(deadline) {
+			break
+		}
+		select {
+		case <-startCtx.Done():
+			break starts
+		case inFlight <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(iteration int) {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+
+			err := runOnce(ctx, cmdText, iteration, stats, eo)
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			var throttle throttledError
+			switch {
+			case errors.As(err, &throttle):
+				n := atomic.AddInt32(&throttled, 1)
+				recordThrottled(startCtx, iteration, throttle.pause(int(n)), stats, eo)
+			case err != nil:
+				atomic.StoreInt32(&throttled, 0)
+				stats.RecordIterationFailure(iteration, err)
+				if eo.verbose {
+					logf("request %d failed: %v\n", iteration, err)
+				}
+			default:
+				atomic.StoreInt32(&throttled, 0)
+				stats.RecordSuccess()
+			}
+			if reason := eo.abortReason(stats); reason != "" {
+				stopOnce.Do(func() {
+					stopErr = abortError{reason: reason}
+					stopStarts()
+				})
+			}
+		}(started + 1)
 
-		completed += batchSize
-		if verbose && times > 1 {
-			fmt.Fprintf(os.Stderr, "Progress: %d/%d (%.1f%%)\n", completed, times, float64(completed)/float64(times)*100)
+		if eo.verbose && !eo.progressBar && (started+1)%progressEvery == 0 {
+			printProgress(eo, stats.StartTime, started+1)
 		}
 	}
+	// Throttled executions stop pausing, with nothing left to start
+	stopStarts()
+	wg.Wait()
 
-	stats.EndTime = time.Now()
+	return stopErr, ctx.Err() != nil
+}
 
-	// Print summary for multiple requests
-	if times > 1 && verbose {
-		stats.Print()
+// recordThrottled records the throttled execution iteration in stats and
+// pauses for pause, or until ctx is done
+func recordThrottled(ctx context.Context, iteration int, pause time.Duration, stats *run.ExecutionStats, eo execOptions) {
+	stats.RecordThrottled()
+	if eo.verbose {
+		logf("request %d throttled, pausing %s\n", iteration, pause)
+	}
+	sleepContext(ctx, pause)
+}
+
+// printProgress prints how far a run started at start has come after count
+// requests
+func printProgress(eo execOptions, start time.Time, count int) {
+	if eo.duration > 0 {
+		elapsed := time.Since(start)
+		fmt.Fprintf(os.Stderr, "Progress: %s elapsed, %s remaining (%d requests)\n",
+			elapsed.Round(time.Second), max(eo.duration-elapsed, 0).Round(time.Second), count)
+		return
 	}
+	fmt.Fprintf(os.Stderr, "Progress: %d/%d (%.1f%%)\n", count, eo.times, float64(count)/float64(eo.times)*100)
+}
 
+// runOnce runs cmdText as the given iteration, recording how long it took
+// and the HTTP statuses its curl commands got in stats. A status matching
+// eo.failOn, a response failing eo.expect or missing a value of eo.captures
+// fails it like a non-zero exit, and the captured values are recorded too.
+// With eo.respectRetryAfter a throttled response ends it with a
+// throttledError instead. Other errors are a run.ClassifiedError, see
+// run.ClassifyFailure. A run cut short by cancelling ctx isn't recorded and
+// returns ctx's error. Secrets in the error are redacted by eo.redactor, and
+// the run is logged to eo.audit
+func runOnce(ctx context.Context, cmdText string, iteration int, stats *run.ExecutionStats, eo execOptions) (err error) {
+	if len(eo.rows) > 0 {
+		row := eo.rows[(iteration-1)/max(eo.rowTimes, 1)]
+		cmdText, eo.request = row.cmdText, row.request
+		defer func() {
+			if err != nil && ctx.Err() == nil {
+				stats.RecordFailedRow(row.row)
+			}
+		}()
+	}
+	start := time.Now()
+	result, err := execShellCommand(ctx, cmdText, iteration, eo)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	took := time.Since(start)
+	defer func() {
+		var throttle throttledError
+		if err != nil && !errors.As(err, &throttle) {
+			err = run.ClassifiedError{Class: run.ClassifyFailure(err, result.lastStatus()), Err: err}
+		}
+		err = eo.redactor.redactError(err)
+		eo.audit.logIteration(iteration, took, result.statuses, err)
+		if err != nil && eo.tagOutput && (eo.quiet || eo.outputDir != "") {
+			// Without their output, failed requests still say which they were
+			outputMutex.Lock()
+			clearProgressLine()
+			fmt.Println(requestHeader(iteration, eo, took, result))
+			outputMutex.Unlock()
+		}
+	}()
+	stats.RecordLatency(run.LatencySample{Iteration: iteration, Duration: took, Output: result.savedTo, Status: result.lastStatus(), RequestID: result.requestID, Timings: result.timings})
+	for _, code := range result.statuses {
+		stats.RecordStatus(code)
+	}
+	stats.RecordSteps(result.codes, result.timings)
+	if throttle, ok := eo.throttled(result); ok {
+		return throttle
+	}
+	// A step stopped by its status exits 22 like curl's --fail, and fails
+	// for its status
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() != 22) {
+		return err
+	}
+	if code, ok := failingStatus(result.statuses, eo.failOn); ok {
+		return run.ClassifiedError{Class: run.StatusFailure(code), Err: fmt.Errorf("HTTP status %d", code)}
+	}
+	if err != nil {
+		return err
+	}
+	body := lastResponseBody(result.output)
+	if err := eo.expect.check(result.statuses, body); err != nil {
+		return run.ClassifiedError{Class: run.FailureAssertion, Err: err}
+	}
+	if err := eo.spec.check(ctx, cmdText, result); err != nil {
+		return run.ClassifiedError{Class: run.FailureAssertion, Err: err}
+	}
+	if len(eo.captures) > 0 {
+		values, err := evalCaptures(body, eo.captures)
+		if err != nil {
+			return run.ClassifiedError{Class: run.FailureAssertion, Err: err}
+		}
+		stats.RecordCaptures(values)
+	}
 	return nil
 }
 
-func execShellCommand(cmdText string) error {
-	execCmd := exec.Command("sh", "-c", cmdText)
-	execCmd.Stdin = os.Stdin
-	out, err := execCmd.CombinedOutput()
+// terminalWriter writes to file under outputMutex, clearing the progress bar
+// first
+type terminalWriter struct {
+	file *os.File
+}
+
+func (w terminalWriter) Write(p []byte) (int, error) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	clearProgressLine()
+	return w.file.Write(p)
+}
+
+// commandResult is what execShellCommand picked up from the output of a
+// command
+type commandResult struct {
+	// statuses are the HTTP statuses its curl commands got
+	statuses []int
+	// savedTo is the file its stdout was saved to, if it was
+	savedTo string
+	// output is its output with the status lines still in it, kept when
+	// eo.expect or eo.captures need to look at the response body or with
+	// eo.keepOutput
+	output string
+	// requestID is the UUID sent in the eo.requestID header, if it was
+	requestID string
+	// codes are the status codes of its curl commands, 0 for those without
+	// a response, unlike statuses
+	codes []int
+	// timings are the timings of its curl commands, with eo.timing
+	timings []run.RequestTiming
+	// retryAfter is the Retry-After of the last response, with
+	// eo.respectRetryAfter
+	retryAfter string
+}
+
+// lastStatus returns the status of the last response, 0 without one
+func (r commandResult) lastStatus() int {
+	if len(r.statuses) == 0 {
+		return 0
+	}
+	return r.statuses[len(r.statuses)-1]
+}
+
+// requestHeader is the line heading the output of execution iteration of a
+// parallel run, which took took and got result, like
+// "--- request 37/100 (worker 4, 215ms, status 200) ---"
+func requestHeader(iteration int, eo execOptions, took time.Duration, result commandResult) string {
+	request := strconv.Itoa(iteration)
+	if eo.duration == 0 {
+		request += "/" + strconv.Itoa(eo.times)
+	}
+	var details []string
+	if eo.worker > 0 {
+		details = append(details, "worker "+strconv.Itoa(eo.worker))
+	}
+	details = append(details, took.Round(time.Millisecond).String())
+	if status := result.lastStatus(); status > 0 {
+		details = append(details, "status "+strconv.Itoa(status))
+	} else {
+		details = append(details, "no response")
+	}
+	if result.requestID != "" {
+		details = append(details, eo.requestID+" "+result.requestID)
+	}
+	return fmt.Sprintf("--- request %s (%s) ---", request, strings.Join(details, ", "))
+}
+
+// execShellCommand runs cmdText as the given iteration, printing its output
+// without the status lines of injectStatusWriteOut, and returns the HTTP
+// statuses they held. With eo.outputDir or eo.outputFile its stdout is saved
+// to a file instead, whose path is returned. With eo.quiet the output is
+// discarded as it streams in, and with eo.stream it is printed as it streams
+// in rather than once the command is done. Cancelling ctx terminates the
+// shell along with the curls it started. With eo.request the request is sent
+// by curly itself instead. The template tokens of the command get new values
+// for each execution
+func execShellCommand(ctx context.Context, cmdText string, iteration int, eo execOptions) (commandResult, error) {
+	// Each execution gets its own values for the template tokens
+	tmpl := newTemplates(iteration, eo.seed)
+	var requestID string
+	if eo.requestID != "" {
+		// Not from the seed, so IDs are unique across runs seeded alike
+		requestID = newTemplates(iteration, templateSeed{}).uuid()
+		cmdText = injectCurlHeaders(cmdText, []string{eo.requestID + ": " + requestID}, true)
+	}
+	if strings.Contains(cmdText, "$"+stepHeadersVar) {
+		headers, err := os.CreateTemp("", "curly-headers-*")
+		if err != nil {
+			return commandResult{}, fmt.Errorf("failed to create the file the steps dump their headers to: %w", err)
+		}
+		headers.Close()
+		defer os.Remove(headers.Name())
+		cmdText = stepHeadersVar + "=" + shellquote.DoubleQuote(headers.Name()) + "\n" + cmdText
+	}
+	runCmd := shellRunner(ctx, tmpl.expand(cmdText))
+	if eo.request != nil {
+		req := tmpl.expandRequest(eo.request)
+		req.timing = eo.timing
+		if requestID != "" {
+			req.header.Set(eo.requestID, requestID)
+		}
+		runCmd = func(stdout, stderr io.Writer) error {
+			return req.run(ctx, stdout, stderr)
+		}
+	}
+
+	// keep collects the output for commandResult where it isn't kept anyway
+	var kept bytes.Buffer
+	keep := func(w io.Writer) io.Writer {
+		if !eo.keepOutput && !eo.expect.needsBody() && len(eo.captures) == 0 && eo.spec == nil {
+			return w
+		}
+		return io.MultiWriter(w, &kept)
+	}
+
+	if eo.outputDir != "" || eo.outputFile != "" {
+		start := time.Now()
+		var stdout bytes.Buffer
+		var stderr io.Writer = terminalWriter{os.Stderr}
+		if eo.quiet {
+			stderr = io.Discard
+		}
+		runErr := runCmd(&stdout, stderr)
+		if ctx.Err() != nil {
+			return commandResult{}, ctx.Err()
+		}
+		statuses, savedTo, err := saveOutput(eo, iteration, start, stdout.String())
+		result := commandResult{statuses: statuses, savedTo: savedTo, output: stdout.String(), requestID: requestID, codes: statusCodes(stdout.String()), timings: extractTimings(stdout.String()), retryAfter: lastRetryAfter(stdout.String())}
+		if runErr != nil {
+			return result, fmt.Errorf("command exited with error: %w", runErr)
+		}
+		return result, err
+	}
+
+	if eo.quiet {
+		scanner := &statusScanner{}
+		err := runCmd(keep(scanner), io.Discard)
+		result := commandResult{statuses: scanner.statuses, output: kept.String(), requestID: requestID, codes: scanner.codes, timings: scanner.timings, retryAfter: scanner.retryAfter}
+		if err != nil {
+			return result, fmt.Errorf("command exited with error: %w", err)
+		}
+		return result, nil
+	}
+
+	if eo.stream {
+		// The same writer for both keeps stdout and stderr in order, like
+		// CombinedOutput
+		stdout := terminalWriter{os.Stdout}
+		filter := newStatusFilter(stdout)
+		out := keep(filter)
+		err := runCmd(out, out)
+		filter.Close()
+		stdout.Write([]byte("\n"))
+		result := commandResult{statuses: filter.statuses, output: kept.String(), requestID: requestID, codes: filter.codes, timings: filter.timings, retryAfter: filter.retryAfter}
+		if err != nil {
+			return result, fmt.Errorf("command exited with error: %w", err)
+		}
+		return result, nil
+	}
+
+	var combined bytes.Buffer
+	start := time.Now()
+	err := runCmd(&combined, &combined)
+	took := time.Since(start)
+	out := combined.Bytes()
+	printed, statuses := extractStatuses(string(out))
+	if eo.formatting() {
+		printed = formatResponses(string(out), eo)
+	}
+
+	result := commandResult{statuses: statuses, output: string(out), requestID: requestID, codes: statusCodes(string(out)), timings: extractTimings(string(out)), retryAfter: lastRetryAfter(string(out))}
 
 	// Lock to prevent output interleaving in parallel mode
 	outputMutex.Lock()
-	fmt.Printf("%s\n", string(out))
+	clearProgressLine()
+	if eo.tagOutput {
+		fmt.Println(requestHeader(iteration, eo, took, result))
+	}
+	fmt.Printf("%s\n", printed)
 	outputMutex.Unlock()
 
 	if err != nil {
-		return fmt.Errorf("command exited with error: %w", err)
+		return result, fmt.Errorf("command exited with error: %w", err)
 	}
-	return nil
+	return result, nil
 }
 
-func runFile(filePath, dir, envName string, insecure bool) (string, error) {
-	var envVars Environment
-	if envName != "" {
-		var err error
-		envVars, err = loadEnvironmentVariables(envName, dir)
+// shellRunner returns a function running cmdText with sh, writing its output
+// to stdout and stderr. Cancelling ctx terminates the shell along with the
+// curls it started
+func shellRunner(ctx context.Context, cmdText string) func(stdout, stderr io.Writer) error {
+	return func(stdout, stderr io.Writer) error {
+		cmd, err := shellCommand(ctx, cmdText)
 		if err != nil {
-			return "", err
+			fmt.Fprintf(stderr, "curly: %v\n", err)
+			return err
 		}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		terminateProcessGroup(cmd)
+		return cmd.Run()
 	}
+}
 
+func runFile(filePath, dir string, opts runOptions) (string, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
+	return prepareCommand(string(content), filePath, dir, opts)
+}
 
-	contentStr := string(content)
-	if envName != "" {
-		contentStr = applyEnvironmentVars(contentStr, envVars)
+// prepareCommand layers the variables of the collection in dir over the
+// assignments of content, read from filePath, injects what opts adds to the
+// curl commands and returns the command to run
+func prepareCommand(contentStr, filePath, dir string, opts runOptions) (string, error) {
+	opts.envsFile = run.FindEnvsFile(dir, filePath, opts.envsFile)
+	envVars, err := loadRunVariables(dir, opts)
+	if err != nil {
+		return "", err
+	}
+	envVars, err = resolveRunVariables(envVars, contentStr, dir, opts)
+	if err != nil {
+		return "", err
 	}
+	return buildCommand(contentStr, filePath, dir, envVars, opts)
+}
 
-	if insecure {
-		contentStr = strings.ReplaceAll(contentStr, "curl ", "curl -k ")
+// resolveRunVariables adds to the variables loadRunVariables loaded what
+// content needs of the environment's commands, the auth token and the saved
+// captures
+func resolveRunVariables(envVars run.Environment, content, dir string, opts runOptions) (run.Environment, error) {
+	envVars, err := resolveEnvCommands(envVars, content, opts)
+	if err != nil {
+		return nil, err
+	}
+	envVars, err = withAuthToken(envVars, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return withCaptured(envVars, dir, opts)
+}
+
+// buildCommand applies envVars and the --var overrides to the assignments of
+// content, read from filePath, resolves its ${env:NAME} references, injects
+// what opts adds to the curl commands and returns the command to run
+func buildCommand(contentStr, filePath, dir string, envVars run.Environment, opts runOptions) (string, error) {
+	if len(envVars) > 0 {
+		contentStr = run.ApplyEnvironmentVars(contentStr, envVars)
+	}
+	contentStr = overrideFileVariables(filePath, contentStr, opts.overrides)
+	for name := range opts.overrides {
+		opts.sources.Set(name, "--var")
+	}
+	recordOSEnvSources(contentStr, opts.sources)
+	contentStr, err := run.ResolveOSEnvRefs(contentStr)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	contentStr = injectCurlHeaders(contentStr, opts.headers, opts.headerReplace)
+	if opts.insecure {
+		contentStr = injectCurlFlag(contentStr, "-k", "--insecure")
+	}
+	if opts.follow {
+		contentStr = injectCurlFlag(contentStr, "-L", "--location")
+	}
+	if opts.includeHeaders {
+		contentStr = injectCurlFlag(contentStr, "-i", "--include")
+	}
+	tls, err := resolveTLS(opts)
+	if err != nil {
+		return "", err
+	}
+	contentStr = injectCurlTLS(contentStr, tls)
+	proxy, proxySource, err := resolveProxy(opts)
+	if err != nil {
+		return "", err
+	}
+	contentStr = injectCurlProxy(contentStr, proxy, opts.noProxy)
+	if opts.session != "" {
+		jar, err := prepareCookieJar(dir, opts.session)
+		if err != nil {
+			return "", err
+		}
+		contentStr = injectCookieJar(contentStr, jar)
 	}
 
-	cmdText := extractShellCommand(contentStr)
+	cmdText := run.ExtractShellCommand(contentStr)
 	if cmdText == "" {
 		return "", errors.New("no curl command found in file")
 	}
+	if opts.verbose {
+		writeProxy(os.Stderr, cmdText, proxy, proxySource, opts.noProxy)
+	}
 
 	return cmdText, nil
 }
 
-func loadEnvConfig(filename string) (*EnvConfig, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
+// insertCurlArgs inserts args right after the command token of a curl command
+func insertCurlArgs(lines []string, cmd run.CurlCommand, args string) {
+	line := lines[cmd.Start]
+	at := strings.Index(line, "curl") + len("curl")
+	lines[cmd.Start] = line[:at] + " " + args + line[at:]
+}
+
+// injectCurlFlag inserts flag right after the command token of every curl
+// command in content, leaving curl commands that already pass flag or one
+// of its equivalents alone
+func injectCurlFlag(content, flag string, equivalents ...string) string {
+	lines := strings.Split(content, "\n")
+	has := map[string]bool{flag: true}
+	for _, eq := range equivalents {
+		has[eq] = true
 	}
 
-	var config EnvConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
+	for _, cmd := range run.FindCurlCommands(lines) {
+		present := false
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			for _, token := range strings.Fields(line) {
+				if has[token] {
+					present = true
+				}
+			}
+		}
+		if !present {
+			insertCurlArgs(lines, cmd, flag)
+		}
 	}
 
-	return &config, nil
+	return strings.Join(lines, "\n")
 }
 
-func applyEnvironmentVars(content string, envVars Environment) string {
-	lines := strings.Split(content, "\n")
-	result := []string{}
-
-	inVarSection := false
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		if trimmed == "# Variables" {
-			inVarSection = true
-			result = append(result, line)
-			continue
+// parseHeaderFlags checks --header values are "Name: value" headers
+func parseHeaderFlags(headers []string) error {
+	for _, header := range headers {
+		name, _, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("invalid --header %q, expected \"Name: value\"", header)
 		}
+	}
+	return nil
+}
 
-		if inVarSection && (trimmed == "" || strings.HasPrefix(trimmed, "curl")) {
-			inVarSection = false
-		}
+// injectCurlHeaders adds a -H argument for each header to every curl command
+// in content. With replace, -H/--header arguments the commands already pass
+// for the same header names are removed first, so only the new value is sent
+func injectCurlHeaders(content string, headers []string, replace bool) string {
+	if len(headers) == 0 {
+		return content
+	}
+	lines := strings.Split(content, "\n")
 
-		if inVarSection && strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				varName := strings.TrimSpace(parts[0])
-				if val, ok := envVars[varName]; ok {
-					result = append(result, fmt.Sprintf("%s=\"%s\"", varName, val))
+	args := make([]string, 0, len(headers))
+	names := make([]string, 0, len(headers))
+	for _, header := range headers {
+		args = append(args, "-H "+shellquote.DoubleQuote(header))
+		name, _, _ := strings.Cut(header, ":")
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	// -H "Name: ..." or -H 'Name: ...', header names being case-insensitive
+	existing := regexp.MustCompile(`\s*(?:-H|--header)\s+(?:"(?i:` + strings.Join(names, "|") + `)\s*:(?:[^"\\]|\\.)*"|'(?i:` + strings.Join(names, "|") + `)\s*:[^']*')`)
+
+	// Commands are edited from the last one up as removing headers can
+	// remove lines
+	commands := run.FindCurlCommands(lines)
+	for c := len(commands) - 1; c >= 0; c-- {
+		cmd := commands[c]
+		if replace {
+			for i := cmd.End; i >= cmd.Start; i-- {
+				line := existing.ReplaceAllString(lines[i], "")
+				if line == lines[i] || i == cmd.Start || strings.TrimSpace(strings.TrimSuffix(line, "\\")) != "" {
+					lines[i] = line
 					continue
 				}
+				// The line only held the removed header, drop it and, if it
+				// ended the command, the continuation leading to it
+				if !strings.HasSuffix(line, "\\") {
+					lines[i-1] = strings.TrimRight(strings.TrimSuffix(lines[i-1], "\\"), " \t")
+				}
+				lines = append(lines[:i], lines[i+1:]...)
 			}
 		}
+		insertCurlArgs(lines, cmd, strings.Join(args, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
 
-		result = append(result, line)
+// overrideFileVariables applies --var overrides to a file's content, warning
+// about keys the file doesn't assign
+func overrideFileVariables(name, content string, overrides run.Environment) string {
+	if len(overrides) == 0 {
+		return content
+	}
+	content, unknown := run.ApplyVarOverrides(content, overrides)
+	for _, key := range unknown {
+		fmt.Fprintf(os.Stderr, "Warning: --var %s is not assigned in %s, it defines: %s\n",
+			key, name, strings.Join(run.FileVariables(content), ", "))
 	}
+	return content
+}
 
-	return strings.Join(result, "\n")
+// fzfSelect lets the user pick one of items with fzf, passing it fzfArgs, or
+// with curly's own finder without fzf
+func fzfSelect(prompt string, items []string, fzfArgs ...string) (string, error) {
+	selected, err := selectItems(prompt, items, false, false, fzfArgs)
+	if err != nil || len(selected) == 0 {
+		return "", err
+	}
+	return selected[0], nil
 }
 
-func fzfSelect(items []string) (string, error) {
+// selectItems lets the user pick one of items, or several with multi, with
+// fzf or, without it or with noFzf, with curly's own finder. When stdin isn't
+// a terminal the items are listed by number instead. An fzf too old for
+// fzfArgs is run again without them
+func selectItems(prompt string, items []string, multi, noFzf bool, fzfArgs []string) ([]string, error) {
 	fzfPath, err := exec.LookPath("fzf")
-	if err != nil {
+	if err != nil || noFzf {
 		if len(items) == 1 {
-			return items[0], nil
+			return items, nil
 		}
-		fmt.Println("fzf not found. Please choose an item by number:")
-		for i, it := range items {
-			fmt.Printf("[%d] %s\n", i+1, it)
+		if !isTerminal(os.Stdin) {
+			return menuSelect(items, multi)
 		}
-		fmt.Print("Select number: ")
-		var idx int
-		_, err := fmt.Scanf("%d", &idx)
-		if err != nil || idx < 1 || idx > len(items) {
-			return "", errors.New("invalid selection")
-		}
-		return items[idx-1], nil
+		return finderSelect(prompt, items, multi)
 	}
 
-	input := strings.Join(items, "\n")
-	fzfCmd := exec.Command(fzfPath, "--prompt", "Select endpoint: ")
-	fzfCmd.Stdin = strings.NewReader(input)
-	var out bytes.Buffer
+	args := []string{"--prompt", prompt}
+	if multi {
+		args = append(args, "--multi")
+	}
+	fzfCmd := exec.Command(fzfPath, append(args, fzfArgs...)...)
+	fzfCmd.Stdin = strings.NewReader(strings.Join(items, "\n"))
+	var out, stderr bytes.Buffer
 	fzfCmd.Stdout = &out
-	fzfCmd.Stderr = os.Stderr
-	if err := fzfCmd.Run(); err != nil {
-		return "", fmt.Errorf("fzf failed: %w", err)
+	// fzf draws on the terminal itself, stderr only gets its errors
+	fzfCmd.Stderr = &stderr
+	err = fzfCmd.Run()
+	// fzf exits with 2 on options it doesn't know
+	var exitErr *exec.ExitError
+	if err != nil && len(fzfArgs) > 0 && errors.As(err, &exitErr) && exitErr.ExitCode() == 2 && strings.Contains(stderr.String(), "unknown option") {
+		return selectItems(prompt, items, multi, noFzf, nil)
 	}
-	res := strings.TrimSpace(out.String())
-	return res, nil
+	os.Stderr.Write(stderr.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("fzf failed: %w", err)
+	}
+	var selected []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			selected = append(selected, line)
+		}
+	}
+	return selected, nil
 }
 
-func extractShellCommand(content string) string {
-	lines := strings.Split(content, "\n")
-	result := []string{}
-	foundStart := false
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// Skip comments and empty lines at the beginning
-		if !foundStart {
-			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
-				continue
-			}
-			foundStart = true
-		}
+// menuSelect lets the user pick one of items, or several with multi, by their
+// numbers in a list
+func menuSelect(items []string, multi bool) ([]string, error) {
+	fmt.Println("Choose an item by number:")
+	for i, it := range items {
+		fmt.Printf("[%d] %s\n", i+1, it)
+	}
+	if multi {
+		fmt.Print("Select numbers, separated by commas: ")
+	} else {
+		fmt.Print("Select number: ")
+	}
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read selection: %w", err)
+	}
+	indices, err := parseSelection(answer, len(items), multi)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]string, len(indices))
+	for i, idx := range indices {
+		selected[i] = items[idx-1]
+	}
+	return selected, nil
+}
 
-		if foundStart {
-			result = append(result, line)
+// parseSelection parses the numbers picked from a menu of n items, several
+// separated by commas with multi
+func parseSelection(answer string, n int, multi bool) ([]int, error) {
+	fields := strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(fields) == 0 || (!multi && len(fields) > 1) {
+		return nil, errors.New("invalid selection")
+	}
+	indices := make([]int, len(fields))
+	for i, field := range fields {
+		idx, err := strconv.Atoi(field)
+		if err != nil || idx < 1 || idx > n {
+			return nil, errors.New("invalid selection")
 		}
+		indices[i] = idx
 	}
-
-	return strings.Join(result, "\n")
+	return indices, nil
 }
 
 func NewCompletionCmd(rootCmd *cobra.Command) *cobra.Command {
@@ -1,10 +1,23 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/generate"
+	"github.com/ErikVib/curly/pkg/run"
 )
 
 func TestInputValidation(t *testing.T) {
@@ -189,7 +202,7 @@ func TestExtractPathParams(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := extractPathParams(tt.path)
+			result := generate.PathParams(tt.path)
 
 			if len(result) != len(tt.expected) {
 				t.Errorf("got %d params, want %d", len(result), len(tt.expected))
@@ -205,228 +218,725 @@ func TestExtractPathParams(t *testing.T) {
 	}
 }
 
-func TestExtractShellCommand(t *testing.T) {
+func TestInsecureFlagAddsKToCurl(t *testing.T) {
 	tests := []struct {
 		name     string
 		content  string
+		insecure bool
 		expected string
 	}{
 		{
-			name: "basic curl with variables",
-			content: `# GET /test
-
-# Variables
-BASE_URL="http://localhost:8081"
+			name: "insecure flag adds -k to basic curl",
+			content: `# Variables
+BASE_URL="http://localhost"
 
 curl -s -X GET "${BASE_URL}/test"`,
-			expected: `BASE_URL="http://localhost:8081"
+			insecure: true,
+			expected: `# Variables
+BASE_URL="http://localhost"
 
-curl -s -X GET "${BASE_URL}/test"`,
+curl -k -s -X GET "${BASE_URL}/test"`,
 		},
 		{
-			name: "skip leading comments",
-			content: `# Some comment
-# Another comment
-
-VAR="value"
-curl test`,
-			expected: `VAR="value"
-curl test`,
+			name: "insecure flag adds -k to curl with headers",
+			content: `curl -X POST "${BASE_URL}/api" \
+  -H "Content-Type: application/json"`,
+			insecure: true,
+			expected: `curl -k -X POST "${BASE_URL}/api" \
+  -H "Content-Type: application/json"`,
 		},
 		{
-			name: "empty lines before command",
-			content: `
-
-curl test`,
-			expected: "curl test",
+			name:     "insecure false does not modify curl",
+			content:  `curl -s -X GET "${BASE_URL}/test"`,
+			insecure: false,
+			expected: `curl -s -X GET "${BASE_URL}/test"`,
+		},
+		{
+			name: "multiple curl commands all get -k",
+			content: `curl -X GET test1
+curl -X POST test2`,
+			insecure: true,
+			expected: `curl -k -X GET test1
+curl -k -X POST test2`,
+		},
+		{
+			name: "heredoc body mentioning curl is left alone",
+			content: `curl -s -X POST "${BASE_URL}/notes" \
+  --data-binary @- << 'EOF'
+curl is great
+{"text": "use curl to fetch"}
+EOF
+curl -s "${BASE_URL}/notes"`,
+			insecure: true,
+			expected: `curl -k -s -X POST "${BASE_URL}/notes" \
+  --data-binary @- << 'EOF'
+curl is great
+{"text": "use curl to fetch"}
+EOF
+curl -k -s "${BASE_URL}/notes"`,
+		},
+		{
+			name: "indented continuation line starting with curl is not a command",
+			content: `echo start \
+  curl is an argument here
+  curl -s "${BASE_URL}/indented"`,
+			insecure: true,
+			expected: `echo start \
+  curl is an argument here
+  curl -k -s "${BASE_URL}/indented"`,
+		},
+		{
+			name: "comments and variable values are left alone",
+			content: `# run curl against the API \
+NOTE="use curl to fetch"
+curl	-s "${BASE_URL}"`,
+			insecure: true,
+			expected: `# run curl against the API \
+NOTE="use curl to fetch"
+curl -k	-s "${BASE_URL}"`,
+		},
+		{
+			name: "curl at the end of a line",
+			content: `curl \
+  -s "${BASE_URL}"`,
+			insecure: true,
+			expected: `curl -k \
+  -s "${BASE_URL}"`,
+		},
+		{
+			name: "command already passing -k or --insecure is left alone",
+			content: `curl -k -s "${BASE_URL}/a"
+curl -s \
+  --insecure "${BASE_URL}/b"
+curl -s "${BASE_URL}/c"`,
+			insecure: true,
+			expected: `curl -k -s "${BASE_URL}/a"
+curl -s \
+  --insecure "${BASE_URL}/b"
+curl -k -s "${BASE_URL}/c"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := extractShellCommand(tt.content)
+			result := tt.content
+			if tt.insecure {
+				result = injectCurlFlag(result, "-k", "--insecure")
+			}
 
 			if result != tt.expected {
-				t.Errorf("extractShellCommand() =\n%q\n\nwant:\n%q", result, tt.expected)
+				t.Errorf("insecure flag application =\n%q\n\nwant:\n%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFollowAndIncludeHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Trace", r.Header.Get("X-Trace"))
+		io.WriteString(w, `{"path":"`+r.URL.Path+`"}`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	curlFile := filepath.Join(dir, "GET_old.curl")
+	if err := os.WriteFile(curlFile, []byte("curl -s \""+server.URL+"/old\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         runOptions
+		wantCmd      string
+		wantStatuses []int
+		wantOutput   []string
+		wantBody     string
+	}{
+		{
+			name:         "neither",
+			wantCmd:      `curl -s "` + server.URL + `/old"`,
+			wantStatuses: []int{301},
+			wantBody:     "<a href=\"/new\">Moved Permanently</a>.\n\n",
+		},
+		{
+			name:         "follow",
+			opts:         runOptions{follow: true},
+			wantCmd:      `curl -L -s "` + server.URL + `/old"`,
+			wantStatuses: []int{200},
+			wantBody:     `{"path":"/new"}`,
+		},
+		{
+			name:         "headers of every response",
+			opts:         runOptions{follow: true, includeHeaders: true, insecure: true, headers: []string{"X-Trace: abc"}},
+			wantCmd:      `curl -i -L -k -H "X-Trace: abc" -s "` + server.URL + `/old"`,
+			wantStatuses: []int{200},
+			wantOutput:   []string{"HTTP/1.1 301 Moved Permanently\r\n", "Location: /new\r\n", "HTTP/1.1 200 OK\r\n", "X-Trace: abc\r\n"},
+			wantBody:     `{"path":"/new"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdText, err := runFile(curlFile, dir, tt.opts)
+			if err != nil {
+				t.Fatalf("runFile() error = %v", err)
+			}
+			if strings.TrimSpace(cmdText) != tt.wantCmd {
+				t.Errorf("runFile() = %s, want %s", cmdText, tt.wantCmd)
+			}
+			req, err := parseNativeRequest(cmdText)
+			if err != nil {
+				t.Fatalf("parseNativeRequest() error = %v", err)
+			}
+			cmdText = injectStatusWriteOut(cmdText)
+			runs := map[string]execOptions{"native": {quiet: true, keepOutput: true, request: req}}
+			if _, err := exec.LookPath("curl"); err == nil {
+				runs["curl"] = execOptions{quiet: true, keepOutput: true}
+			}
+			for name, eo := range runs {
+				result, err := execShellCommand(context.Background(), cmdText, 1, eo)
+				if err != nil {
+					t.Fatalf("%s: execShellCommand() error = %v", name, err)
+				}
+				if !reflect.DeepEqual(result.statuses, tt.wantStatuses) {
+					t.Errorf("%s: statuses = %v, want %v", name, result.statuses, tt.wantStatuses)
+				}
+				for _, want := range tt.wantOutput {
+					if !strings.Contains(result.output, want) {
+						t.Errorf("%s: output = %q, want it to contain %q", name, result.output, want)
+					}
+				}
+				if body := lastResponseBody(result.output); body != tt.wantBody {
+					t.Errorf("%s: body = %q, want %q", name, body, tt.wantBody)
+				}
 			}
 		})
 	}
 }
 
-func TestApplyEnvironmentVars(t *testing.T) {
+func TestInjectCurlHeaders(t *testing.T) {
+	generated := `# Variables
+AUTHORIZATION="VALUE"
+
+curl -s -X POST "${BASE_URL}/users" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: ${AUTHORIZATION}" \
+  --data-binary @- << 'EOF'
+{"note": "curl -H \"Authorization: x\""}
+EOF`
+
 	tests := []struct {
 		name     string
 		content  string
-		envVars  Environment
+		headers  []string
+		replace  bool
 		expected string
 	}{
 		{
-			name: "replace single variable",
-			content: `# Variables
-BASE_URL="http://localhost"
-
-curl "${BASE_URL}/test"`,
-			envVars: Environment{
-				"BASE_URL": "http://production.com",
-			},
+			name:     "adds headers after the command token",
+			content:  `curl -s "${BASE_URL}/users"`,
+			headers:  []string{"X-Trace-Id: abc", "X-Feature: on"},
+			expected: `curl -H "X-Trace-Id: abc" -H "X-Feature: on" -s "${BASE_URL}/users"`,
+		},
+		{
+			name:     "values are quoted for the shell",
+			content:  `curl -s "${BASE_URL}"`,
+			headers:  []string{`X-Note: "$HOME"`},
+			expected: `curl -H "X-Note: \"\$HOME\"" -s "${BASE_URL}"`,
+		},
+		{
+			name:    "without replace both headers are sent",
+			content: generated,
+			headers: []string{"Authorization: Bearer override"},
 			expected: `# Variables
-BASE_URL="http://production.com"
-
-curl "${BASE_URL}/test"`,
+AUTHORIZATION="VALUE"
+
+curl -H "Authorization: Bearer override" -s -X POST "${BASE_URL}/users" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: ${AUTHORIZATION}" \
+  --data-binary @- << 'EOF'
+{"note": "curl -H \"Authorization: x\""}
+EOF`,
 		},
 		{
-			name: "replace multiple variables",
-			content: `# Variables
-BASE_URL="VALUE"
-TOKEN="VALUE"
-
-curl test`,
-			envVars: Environment{
-				"BASE_URL": "http://dev.local",
-				"TOKEN":    "dev-token-123",
-			},
+			name:    "replace drops the existing header case-insensitively",
+			content: generated,
+			headers: []string{"authorization: Bearer override"},
+			replace: true,
 			expected: `# Variables
-BASE_URL="http://dev.local"
-TOKEN="dev-token-123"
+AUTHORIZATION="VALUE"
 
-curl test`,
+curl -H "authorization: Bearer override" -s -X POST "${BASE_URL}/users" \
+  -H "Content-Type: application/json" \
+  --data-binary @- << 'EOF'
+{"note": "curl -H \"Authorization: x\""}
+EOF`,
 		},
 		{
-			name: "variable not in env keeps original",
-			content: `# Variables
-BASE_URL="VALUE"
-OTHER="VALUE"
+			name: "replace on the last line keeps the command terminated",
+			content: `curl -s "${BASE_URL}" \
+  -H "Accept: application/json" \
+  -H 'X-Tenant: a'
+echo done`,
+			headers: []string{"X-Tenant: b"},
+			replace: true,
+			expected: `curl -H "X-Tenant: b" -s "${BASE_URL}" \
+  -H "Accept: application/json"
+echo done`,
+		},
+		{
+			name:     "replace on the command line itself",
+			content:  `curl -H "X-Tenant: a" -s "${BASE_URL}"`,
+			headers:  []string{"X-Tenant: b"},
+			replace:  true,
+			expected: `curl -H "X-Tenant: b" -s "${BASE_URL}"`,
+		},
+		{
+			name: "every curl in a multi-curl file",
+			content: `# curl the token first
+TOKEN=$(curl -s "${BASE_URL}/token")
+curl -s "${BASE_URL}/a"
+curl -s "${BASE_URL}/b" \
+  -H "X-Tenant: a"`,
+			headers: []string{"X-Tenant: b"},
+			replace: true,
+			expected: `# curl the token first
+TOKEN=$(curl -s "${BASE_URL}/token")
+curl -H "X-Tenant: b" -s "${BASE_URL}/a"
+curl -H "X-Tenant: b" -s "${BASE_URL}/b"`,
+		},
+	}
 
-curl test`,
-			envVars: Environment{
-				"BASE_URL": "http://test.com",
-			},
-			expected: `# Variables
-BASE_URL="http://test.com"
-OTHER="VALUE"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := injectCurlHeaders(tt.content, tt.headers, tt.replace)
+			if result != tt.expected {
+				t.Errorf("injectCurlHeaders() =\n%s\n\nwant:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseHeaderFlags(t *testing.T) {
+	for _, header := range []string{"X-Trace-Id: abc", "X-Empty:", "Authorization: Bearer a:b"} {
+		if err := parseHeaderFlags([]string{header}); err != nil {
+			t.Errorf("parseHeaderFlags(%q) error = %v", header, err)
+		}
+	}
+	for _, header := range []string{"no colon", ": value", "Bad Name: value"} {
+		if err := parseHeaderFlags([]string{header}); err == nil {
+			t.Errorf("parseHeaderFlags(%q) should fail", header)
+		}
+	}
+}
+
+func TestRunFileVarOverridesEnvironment(t *testing.T) {
+	tmpDir := t.TempDir()
+	envs := `environments:
+  dev:
+    BASE_URL: "http://dev.local"
+    ID: "7"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatalf("failed to write envs.yml: %v", err)
+	}
+	curlFile := filepath.Join(tmpDir, "GET_users.curl")
+	content := `# Variables
+BASE_URL="http://localhost"
+ID="1"
+
+curl -s "${BASE_URL}/users/${ID}"
+`
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{envName: "dev", overrides: run.Environment{"ID": "42"}})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
+	}
+	for _, want := range []string{`BASE_URL="http://dev.local"`, `ID="42"`} {
+		if !strings.Contains(cmdText, want) {
+			t.Errorf("runFile() missing %q, got:\n%s", want, cmdText)
+		}
+	}
+}
 
-curl test`,
+func TestLayeredEnvironments(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	writeFiles(t, dir, map[string]string{
+		"envs.yml": `environments:
+  staging:
+    BASE_URL: "https://staging.example.com"
+    ROLE: "user"
+    REGION: "us"
+  as-admin:
+    ROLE: "admin"
+  eu-region:
+    REGION: "eu"
+    ROLE: "auditor"
+`,
+		"GET_users.curl": "BASE_URL=\"http://localhost\"\nROLE=\"VALUE\"\nREGION=\"VALUE\"\ncurl -s \"${BASE_URL}/users?role=${ROLE}&region=${REGION}\"",
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "later environments override earlier ones",
+			args: []string{"-e", "staging", "-e", "as-admin", "--show-vars", "-f", filepath.Join(dir, "GET_users.curl")},
+			want: []string{"Environment staging + as-admin:", "ROLE      admin                        (as-admin)", "REGION    us                           (staging)", "ROLE      admin                        envs.yml (as-admin) > envs.yml (staging) > file\n"},
+		},
+		{
+			name: "order decides",
+			args: []string{"-e", "staging,as-admin", "-e", "eu-region", "--dry-run", "-f", filepath.Join(dir, "GET_users.curl")},
+			want: []string{"https://staging.example.com/users?role=auditor&region=eu"},
+		},
+		{
+			name: "picked by name",
+			args: []string{"-e", "staging", "-e", "eu-region", "--select", "users", "--no-edit", "--dry-run"},
+			want: []string{"https://staging.example.com/users?role=auditor&region=eu"},
+		},
+		{
+			name:    "missing overlay",
+			args:    []string{"-e", "staging", "-e", "as-root", "--dry-run", "-f", filepath.Join(dir, "GET_users.curl")},
+			wantErr: "environment 'as-root' not found in envs.yml",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := applyEnvironmentVars(tt.content, tt.envVars)
-
-			if result != tt.expected {
-				t.Errorf("applyEnvironmentVars() =\n%q\n\nwant:\n%q", result, tt.expected)
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.SetArgs(append([]string{dir}, tt.args...))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			err := cmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output:\n%s\nwant it to contain %q", out.String(), want)
+				}
 			}
 		})
 	}
 }
 
-func TestLoadEnvConfig(t *testing.T) {
-	// Create a temporary test file
+func TestRunFileResolvesOSEnvRefs(t *testing.T) {
+	t.Setenv("CURLY_TEST_TOKEN", "ci-token")
+
 	tmpDir := t.TempDir()
-	envsFile := filepath.Join(tmpDir, "envs.yml")
+	envs := `environments:
+  ci:
+    TOKEN: "${env:CURLY_TEST_TOKEN}"
+    USER: "${env:CURLY_TEST_UNSET:-ci-user}"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatalf("failed to write envs.yml: %v", err)
+	}
+	curlFile := filepath.Join(tmpDir, "GET_me.curl")
+	content := `# Variables
+TOKEN="VALUE"
+USER="VALUE"
 
-	content := `environments:
-  dev:
-    BASE_URL: "http://localhost:8081"
-    TOKEN: "dev-token"
-  prod:
-    BASE_URL: "https://api.production.com"
-    TOKEN: "prod-token"
+curl -s -u "${USER}:${TOKEN}" "http://localhost/me"
 `
+	if err := os.WriteFile(curlFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
 
-	if err := os.WriteFile(envsFile, []byte(content), 0644); err != nil {
-		t.Fatalf("failed to write test file: %v", err)
+	cmdText, err := runFile(curlFile, tmpDir, runOptions{envName: "ci"})
+	if err != nil {
+		t.Fatalf("runFile() error = %v", err)
 	}
+	for _, want := range []string{`TOKEN="ci-token"`, `USER="ci-user"`} {
+		if !strings.Contains(cmdText, want) {
+			t.Errorf("runFile() missing %q, got:\n%s", want, cmdText)
+		}
+	}
+
+	unsetFile := filepath.Join(tmpDir, "GET_other.curl")
+	if err := os.WriteFile(unsetFile, []byte("TOKEN=\"${env:CURLY_TEST_UNSET}\"\ncurl -s http://localhost\n"), 0644); err != nil {
+		t.Fatalf("failed to write curl file: %v", err)
+	}
+	if _, err := runFile(unsetFile, tmpDir, runOptions{}); err == nil || !strings.Contains(err.Error(), "CURLY_TEST_UNSET") {
+		t.Errorf("runFile() error = %v, want one naming CURLY_TEST_UNSET", err)
+	}
+}
 
-	config, err := loadEnvConfig(envsFile)
+func TestEnvironmentAppliesToGeneratedFiles(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var gotURI, gotKey, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.URL.RequestURI()
+		gotKey = r.Header.Get("X-Api-Key")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	spec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+servers:
+  - url: http://localhost:8080
+paths:
+  /users/{id}:
+    put:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+        - name: X-Api-Key
+          in: header
+          required: true
+          schema:
+            type: string
+        - name: dryRun
+          in: query
+          required: true
+          schema:
+            type: boolean
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+                  example: alice
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(spec), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := generate.Generate(generate.Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	envs := `environments:
+  dev:
+    BASE_URL: "` + server.URL + `"
+    ID: "42"
+    X_API_KEY: "dev-key"
+    DRYRUN: "true"
+    NAME: "bob"
+`
+	if err := os.WriteFile(filepath.Join(outDir, "envs.yml"), []byte(envs), 0644); err != nil {
+		t.Fatalf("failed to write envs.yml: %v", err)
+	}
+
+	cmdText, err := runFile(filepath.Join(outDir, "PUT_users__id.curl"), outDir, runOptions{envName: "dev"})
 	if err != nil {
-		t.Fatalf("loadEnvConfig() error = %v", err)
+		t.Fatalf("runFile() error = %v", err)
+	}
+	if out, err := exec.Command("sh", "-c", cmdText).CombinedOutput(); err != nil {
+		t.Fatalf("generated command failed: %v\n%s\n%s", err, out, cmdText)
 	}
 
-	// Check environments exist
-	if _, ok := config.Environments["dev"]; !ok {
-		t.Error("dev environment not found")
+	if gotURI != "/users/42?dryRun=true" {
+		t.Errorf("server got %q, want /users/42?dryRun=true", gotURI)
+	}
+	if gotKey != "dev-key" {
+		t.Errorf("server got X-Api-Key %q, want dev-key", gotKey)
 	}
-	if _, ok := config.Environments["prod"]; !ok {
-		t.Error("prod environment not found")
+	if !strings.Contains(gotBody, `"name": "bob"`) {
+		t.Errorf("server got body %q, want the environment's name", gotBody)
 	}
+}
 
-	// Check dev values
-	devEnv := config.Environments["dev"]
-	if devEnv["BASE_URL"] != "http://localhost:8081" {
-		t.Errorf("dev BASE_URL = %s, want http://localhost:8081", devEnv["BASE_URL"])
+func TestRootCmdValidatesDuration(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"--duration", "1s", "-n", "5"}, wantErr: "--duration and --times cannot be used together"},
+		{args: []string{"--duration", "-1s"}, wantErr: "duration cannot be negative"},
 	}
-	if devEnv["TOKEN"] != "dev-token" {
-		t.Errorf("dev TOKEN = %s, want dev-token", devEnv["TOKEN"])
+
+	for _, tt := range tests {
+		cmd := NewRootCmd()
+		cmd.SetArgs(append([]string{"-f", "missing.curl"}, tt.args...))
+		cmd.SilenceErrors, cmd.SilenceUsage = true, true
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Execute(%v) error = %v, want it to contain %q", tt.args, err, tt.wantErr)
+		}
 	}
+}
+
+func TestRootCmdFailurePrintsNoUsage(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"-f", filepath.Join(t.TempDir(), "missing.curl")})
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
 
-	// Check prod values
-	prodEnv := config.Environments["prod"]
-	if prodEnv["BASE_URL"] != "https://api.production.com" {
-		t.Errorf("prod BASE_URL = %s, want https://api.production.com", prodEnv["BASE_URL"])
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "failed to read file") {
+		t.Fatalf("Execute() error = %v, want the missing file", err)
+	}
+	// main prints the error, so cobra prints neither it nor the usage
+	if out.Len() != 0 {
+		t.Errorf("Execute() printed %q, want nothing", out.String())
 	}
 }
 
-func TestLoadEnvConfigFileNotFound(t *testing.T) {
-	_, err := loadEnvConfig("nonexistent.yml")
-	if err == nil {
-		t.Error("expected error for nonexistent file, got nil")
+func TestAbortReason(t *testing.T) {
+	tests := []struct {
+		name            string
+		eo              execOptions
+		success, failed int32
+		want            string
+	}{
+		{name: "no thresholds", success: 1, failed: 99},
+		{name: "fail-fast without failures", eo: execOptions{failFast: true}, success: 50},
+		{name: "fail-fast on the first failure", eo: execOptions{failFast: true}, success: 50, failed: 1, want: "--fail-fast stops at the first failure"},
+		{name: "rate before the minimum", eo: execOptions{maxFailureRate: 0.05}, success: 10, failed: 9},
+		{name: "rate at the threshold", eo: execOptions{maxFailureRate: 0.05}, success: 19, failed: 1},
+		{name: "rate over the threshold", eo: execOptions{maxFailureRate: 0.05}, success: 18, failed: 2, want: "failure rate 10.0% exceeded --max-failure-rate 0.05"},
+		{name: "rate over the threshold later on", eo: execOptions{maxFailureRate: 0.05}, success: 949, failed: 51, want: "failure rate 5.1% exceeded --max-failure-rate 0.05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &run.ExecutionStats{Success: tt.success, Failed: tt.failed}
+			if got := tt.eo.abortReason(stats); got != tt.want {
+				t.Errorf("abortReason() = %q, want %q", got, tt.want)
+			}
+		})
 	}
 }
 
-func TestInsecureFlagAddsKToCurl(t *testing.T) {
+func TestNestedCollectionEnvironments(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFiles(t, home, map[string]string{
+		".config/curly/envs.yml": "environments:\n  dev:\n    BASE_URL: \"http://global.local\"\n    TOKEN: \"global-token\"\n",
+	})
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"users/envs.yml":         "environments:\n  dev:\n    BASE_URL: \"http://users.local\"\n",
+		"users/GET_users.curl":   "BASE_URL=\"http://localhost\"\ncurl -s \"${BASE_URL}/users\"",
+		"orders/GET_orders.curl": "BASE_URL=\"http://localhost\"\nTOKEN=\"VALUE\"\ncurl -s -H \"Authorization: Bearer ${TOKEN}\" \"${BASE_URL}/orders\"",
+	})
+
 	tests := []struct {
-		name     string
-		content  string
-		insecure bool
-		expected string
+		name string
+		args []string
+		want string
 	}{
-		{
-			name: "insecure flag adds -k to basic curl",
-			content: `# Variables
-BASE_URL="http://localhost"
+		{name: "the service's envs.yml", args: []string{"-f", filepath.Join(root, "users", "GET_users.curl")}, want: "http://users.local/users"},
+		{name: "the global envs.yml", args: []string{"-f", filepath.Join(root, "orders", "GET_orders.curl")}, want: "Bearer global-token"},
+		{name: "picked from the root", args: []string{"--select", "users", "--no-edit"}, want: "http://users.local/users"},
+		{name: "--envs-file", args: []string{"-f", filepath.Join(root, "users", "GET_users.curl"), "--envs-file", filepath.Join(home, ".config", "curly", "envs.yml")}, want: "http://global.local/users"},
+	}
 
-curl -s -X GET "${BASE_URL}/test"`,
-			insecure: true,
-			expected: `# Variables
-BASE_URL="http://localhost"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := NewRootCmd()
+			cmd.SetArgs(append([]string{root, "-e", "dev", "--dry-run"}, tt.args...))
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output:\n%s\nwant it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
 
-curl -k -s -X GET "${BASE_URL}/test"`,
-		},
-		{
-			name: "insecure flag adds -k to curl with headers",
-			content: `curl -X POST "${BASE_URL}/api" \
-  -H "Content-Type: application/json"`,
-			insecure: true,
-			expected: `curl -k -X POST "${BASE_URL}/api" \
-  -H "Content-Type: application/json"`,
-		},
-		{
-			name:     "insecure false does not modify curl",
-			content:  `curl -s -X GET "${BASE_URL}/test"`,
-			insecure: false,
-			expected: `curl -s -X GET "${BASE_URL}/test"`,
-		},
-		{
-			name: "multiple curl commands all get -k",
-			content: `curl -X GET test1
-curl -X POST test2`,
-			insecure: true,
-			expected: `curl -k -X GET test1
-curl -k -X POST test2`,
-		},
+func TestRequestHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		eo     execOptions
+		took   time.Duration
+		result commandResult
+		want   string
+	}{
+		{name: "pool worker", eo: execOptions{times: 100, worker: 4}, took: 215400 * time.Microsecond, result: commandResult{statuses: []int{200}}, want: "--- request 37/100 (worker 4, 215ms, status 200) ---"},
+		{name: "last status of several", eo: execOptions{times: 100, worker: 1}, took: time.Second, result: commandResult{statuses: []int{302, 404}}, want: "--- request 37/100 (worker 1, 1s, status 404) ---"},
+		{name: "paced without worker", eo: execOptions{times: 100}, took: 3 * time.Millisecond, result: commandResult{statuses: []int{500}}, want: "--- request 37/100 (3ms, status 500) ---"},
+		{name: "duration run has no total", eo: execOptions{times: 1, duration: time.Minute, worker: 2}, took: 10 * time.Millisecond, want: "--- request 37 (worker 2, 10ms, no response) ---"},
+		{name: "request id", eo: execOptions{times: 100, worker: 4, requestID: "X-Request-Id"}, took: 5 * time.Millisecond, result: commandResult{statuses: []int{503}, requestID: "1b4e28ba-2fa1-41d2-883f-0016d3cca427"}, want: "--- request 37/100 (worker 4, 5ms, status 503, X-Request-Id 1b4e28ba-2fa1-41d2-883f-0016d3cca427) ---"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := tt.content
-			if tt.insecure {
-				// This is the same logic used in runFile and launchCollection
-				result = strings.ReplaceAll(result, "curl ", "curl -k ")
+			if got := requestHeader(37, tt.eo, tt.took, tt.result); got != tt.want {
+				t.Errorf("requestHeader() = %q, want %q", got, tt.want)
 			}
+		})
+	}
+}
 
-			if result != tt.expected {
-				t.Errorf("insecure flag application =\n%q\n\nwant:\n%q", result, tt.expected)
+func TestRequestIDHeader(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Values("X-Request-Id")...)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// The file's own X-Request-Id header is replaced
+	cmdText := `curl -s -H "X-Request-Id: fixed" "` + server.URL + `/users"`
+	for _, native := range []bool{false, true} {
+		t.Run("native="+strconv.FormatBool(native), func(t *testing.T) {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+			stats, err := execCmd(cmdText, execOptions{times: 20, parallel: 4, quiet: true, native: native, requestID: "X-Request-Id"})
+			if err != nil {
+				t.Fatalf("execCmd() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sent := map[string]bool{}
+			for _, id := range received {
+				sent[id] = true
+			}
+			if len(received) != 20 || len(sent) != 20 {
+				t.Fatalf("server got %d request ids, %d of them unique, want 20: %v", len(received), len(sent), received)
+			}
+			for _, sample := range stats.Latencies {
+				if !sent[sample.RequestID] || sample.Status != 200 {
+					t.Errorf("execution %d recorded id %q and status %d, want one the server got and 200", sample.Iteration, sample.RequestID, sample.Status)
+				}
 			}
 		})
 	}
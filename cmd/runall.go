@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// safeMethods are the methods curly run-all sends without --unsafe, those
+// that don't change anything on the server
+var safeMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true}
+
+// runAllOptions picks the files curly run-all runs and how
+type runAllOptions struct {
+	suite suiteOptions
+	// methods keeps the files sending a request with one of them
+	methods []string
+	// unsafe runs the files sending other methods than safeMethods too
+	unsafe bool
+	// parallel is how many files run at once
+	parallel int
+}
+
+// sweepFile is a file of curly run-all with the command it runs, or why it
+// is skipped
+type sweepFile struct {
+	suiteTest
+	cmdText string
+}
+
+// sweepResult is how a file of curly run-all went
+type sweepResult struct {
+	name string
+	// status is the HTTP status of the last response, 0 without one, and
+	// exitCode the exit code of the command, -1 when it didn't exit
+	status   int
+	exitCode int
+	took     time.Duration
+	err      error
+}
+
+func NewRunAllCmd() *cobra.Command {
+	var opts runOptions
+	var all runAllOptions
+	var vars []string
+	var yes bool
+	var logFile string
+
+	cmd := &cobra.Command{
+		Use:               "run-all [collection-dir]",
+		Short:             "Run every .curl file of a collection once, printing the status of each",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirAt(0),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			if all.parallel < 1 {
+				return fmt.Errorf("parallel-files must be at least 1, got %d", all.parallel)
+			}
+			overrides, err := run.ParseVarOverrides(vars)
+			if err != nil {
+				return err
+			}
+			opts.overrides = overrides
+
+			files, err := collectSweep(dir, opts, all)
+			if err != nil {
+				return err
+			}
+			if !yes && isTerminal(os.Stdin) {
+				var texts []string
+				for _, f := range files {
+					if f.skip == "" {
+						texts = append(texts, f.cmdText)
+					}
+				}
+				if err := confirmRun(os.Stdin, os.Stderr, strings.Join(texts, "\n"), opts.envName, 1, false); err != nil {
+					return err
+				}
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			opts.audit = openAuditLog(logFile, auditDetailIteration)
+			defer opts.audit.Close()
+			return runSweep(ctx, cmd.OutOrStdout(), files, opts, all.parallel)
+		},
+	}
+
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Environment name to use from envs.yml, repeatable to layer environments, later ones overriding earlier ones")
+	cmd.Flags().BoolVar(&opts.noAuthCache, "no-auth-cache", false, "Fetch a new token for the environment's auth block instead of using the cached one")
+	cmd.Flags().StringVar(&opts.envFile, "env-file", "", "Read variables from this .env file instead of the collection's .env")
+	cmd.Flags().StringVar(&opts.envsFile, "envs-file", "", "Read the environments from this file instead of the envs.yml nearest to each file run")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Override a variable assigned in the files, as KEY=VALUE; takes precedence over envs.yml (repeatable)")
+	cmd.Flags().BoolVarP(&opts.insecure, "insecure", "k", false, "Skip SSL certificate verification (adds -k to ALL curls in the files)")
+	cmd.Flags().StringArrayVar(&all.methods, "method", nil, "Only run files sending a request with this method (repeatable)")
+	cmd.Flags().StringArrayVar(&all.suite.tags, "tag", nil, "Only run files with this tag in a \"# tags:\" comment (repeatable)")
+	cmd.Flags().StringVar(&all.suite.match, "match", "", "Only run files whose path in the collection matches this glob, like 'users/GET_*'")
+	cmd.Flags().BoolVar(&all.unsafe, "unsafe", false, "Also run files sending other methods than GET, HEAD and OPTIONS, which are skipped otherwise")
+	cmd.Flags().IntVar(&all.parallel, "parallel-files", 1, "Run this many files at once")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run DELETE requests of --unsafe without asking for confirmation")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Append a JSON line per request, with the file, environment, redacted URL, status and result, to this audit log (default: $CURLY_LOG_FILE)")
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(0))
+	cmd.RegisterFlagCompletionFunc("tag", completeTags(0))
+
+	return cmd
+}
+
+// collectSweep finds the .curl files of the collection in dir that opts
+// picks and prepares their commands. Files sending unsafe methods are
+// skipped unless opts.unsafe, like those with a "# skip" comment
+func collectSweep(dir string, opts runOptions, all runAllOptions) ([]sweepFile, error) {
+	tests, err := collectSuite(dir, all.suite)
+	if err != nil {
+		return nil, err
+	}
+	var files []sweepFile
+	for _, test := range tests {
+		content, err := os.ReadFile(test.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", test.name, err)
+		}
+		methods := requestMethods(string(content))
+		if len(all.methods) > 0 && !hasAnyTag(methods, all.methods) {
+			continue
+		}
+		file := sweepFile{suiteTest: test}
+		if file.skip == "" && !all.unsafe {
+			for _, method := range methods {
+				if !safeMethods[method] {
+					file.skip = method + ", run with --unsafe"
+					break
+				}
+			}
+		}
+		if file.skip == "" {
+			if file.cmdText, err = runFile(test.path, dir, opts); err != nil {
+				return nil, fmt.Errorf("%s: %w", test.name, err)
+			}
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no .curl files to run")
+	}
+	return files, nil
+}
+
+// requestMethods returns the methods of the requests of content, once each
+func requestMethods(content string) []string {
+	requests := curlRequests(content)
+	if len(requests) == 0 {
+		return []string{firstRequest(content).method}
+	}
+	var methods []string
+	seen := map[string]bool{}
+	for _, req := range requests {
+		if method := req.effectiveMethod(); !seen[method] {
+			seen[method] = true
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// runSweep runs files once each, parallel of them at once, printing a line
+// on how each went as it finishes, whole so lines of files running at the
+// same time don't mix, in file order when parallel is 1, and a summary. A
+// file fails when its command does or its last response has a 4xx or 5xx
+// status
+func runSweep(ctx context.Context, out io.Writer, files []sweepFile, opts runOptions, parallel int) error {
+	width := 0
+	for _, f := range files {
+		width = max(width, len(f.name))
+	}
+
+	var mu sync.Mutex
+	var ok, failed, skipped int
+	// report counts a file and prints its line
+	report := func(count *int, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*count++
+		io.WriteString(out, line)
+	}
+
+	start := time.Now()
+	next := make(chan sweepFile)
+	var wg sync.WaitGroup
+	for range parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range next {
+				if f.skip != "" {
+					report(&skipped, fmt.Sprintf("SKIP  %-*s  %s\n", width, f.name, f.skip))
+					continue
+				}
+				r := runSweepFile(ctx, f, opts)
+				if ctx.Err() != nil {
+					continue
+				}
+				count := &ok
+				if r.err != nil {
+					count = &failed
+				}
+				report(count, r.line(width))
+			}
+		}()
+	}
+	// Skipped files go through the workers too, so a single one prints
+	// every line in file order
+	for _, f := range files {
+		select {
+		case next <- f:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	fmt.Fprintf(out, "\n%d ok, %d failed, %d skipped in %s\n", ok, failed, skipped, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, ok+failed)
+	}
+	return nil
+}
+
+// runSweepFile runs the command of f once
+func runSweepFile(ctx context.Context, f sweepFile, opts runOptions) sweepResult {
+	begin := time.Now()
+	result, err := execShellCommand(ctx, injectStatusWriteOut(injectStepGuards(f.cmdText, nil)), 1, execOptions{quiet: true})
+	r := sweepResult{name: f.name, took: time.Since(begin).Round(time.Millisecond)}
+	if len(result.statuses) > 0 {
+		r.status = result.statuses[len(result.statuses)-1]
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		r.exitCode = exitErr.ExitCode()
+	case err != nil:
+		r.exitCode = -1
+	}
+	if err == nil && r.status >= 400 {
+		err = fmt.Errorf("status %d", r.status)
+	}
+	r.err = err
+	opts.audit.request(f.cmdText, f.path, opts.envName).logExecution(1, r.took, result.statuses, err)
+	return r
+}
+
+// line formats r as a line of curly run-all, its file padded to width
+func (r sweepResult) line(width int) string {
+	status := "---"
+	switch {
+	case r.status > 0:
+		status = strconv.Itoa(r.status)
+	case r.exitCode > 0:
+		status = fmt.Sprintf("exit %d", r.exitCode)
+	}
+	if r.err != nil {
+		return fmt.Sprintf("FAIL  %-*s  %-6s  %8s  %v\n", width, r.name, status, r.took, r.err)
+	}
+	return fmt.Sprintf("OK    %-*s  %-6s  %8s\n", width, r.name, status, r.took)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequestMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "no method", content: `curl -s "http://localhost/users"`, want: []string{"GET"}},
+		{name: "-X", content: `curl -s -X DELETE "http://localhost/users/1"`, want: []string{"DELETE"}},
+		{name: "data without -X", content: `curl -s "http://localhost/users" -d '{"name":"a"}'`, want: []string{"POST"}},
+		{name: "form without -X", content: `curl -s "http://localhost/users" -F name=a`, want: []string{"POST"}},
+		{name: "upload", content: `curl -s "http://localhost/files/a" -T a.txt`, want: []string{"PUT"}},
+		{name: "several commands", content: "curl -s http://localhost/a\ncurl -s -X PATCH http://localhost/b\ncurl -s http://localhost/c", want: []string{"GET", "PATCH"}},
+		{name: "method in a variable", content: "METHOD=\"post\"\ncurl -s -X \"${METHOD}\" http://localhost/a", want: []string{"POST"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestMethods(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestMethods() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSweep(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"envs.yml":             "environments:\n  dev:\n    BASE_URL: \"" + server.URL + "\"\n",
+		"GET_users.curl":       "BASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/users\"\n",
+		"GET_missing.curl":     "BASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/missing\"\n",
+		"GET_skipped.curl":     "# skip: flaky\nBASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/users\"\n",
+		"GET_unreachable.curl": "curl -s \"http://localhost:1/users\"\n",
+		"POST_users.curl":      "BASE_URL=\"http://localhost:1\"\ncurl -s -X POST \"${BASE_URL}/users\" -d '{}'\n",
+	})
+	opts := runOptions{envName: "dev"}
+
+	tests := []struct {
+		name    string
+		all     runAllOptions
+		want    []string
+		inOrder bool
+		wantErr string
+	}{
+		{
+			name:    "safe methods",
+			all:     runAllOptions{parallel: 1},
+			inOrder: true,
+			want: []string{
+				"FAIL  GET_missing.curl      404", "SKIP  GET_skipped.curl      flaky",
+				"FAIL  GET_unreachable.curl  exit 7", "OK    GET_users.curl        200",
+				"SKIP  POST_users.curl       POST, run with --unsafe", "1 ok, 2 failed, 2 skipped",
+			},
+			wantErr: "2 of 3 files failed",
+		},
+		{
+			name:    "unsafe and in parallel",
+			all:     runAllOptions{unsafe: true, parallel: 3},
+			want:    []string{"OK    POST_users.curl       200", "2 ok, 2 failed, 1 skipped"},
+			wantErr: "2 of 4 files failed",
+		},
+		{
+			name: "by method",
+			all:  runAllOptions{methods: []string{"post"}, unsafe: true, parallel: 1},
+			want: []string{"OK    POST_users.curl  200", "1 ok, 0 failed, 0 skipped"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := collectSweep(dir, opts, tt.all)
+			if err != nil {
+				t.Fatalf("collectSweep() error = %v", err)
+			}
+			var out bytes.Buffer
+			err = runSweep(context.Background(), &out, files, opts, tt.all.parallel)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("runSweep() error = %v, want %q", err, tt.wantErr)
+			}
+			last := -1
+			for _, want := range tt.want {
+				i := strings.Index(out.String(), want)
+				if i < 0 {
+					t.Errorf("output:\n%s\nwant it to contain %q", out.String(), want)
+				}
+				if tt.inOrder && i >= 0 && i < last {
+					t.Errorf("output:\n%s\nwant %q after the lines ahead of it", out.String(), want)
+				}
+				last = max(last, i)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// shellPath returns the sh curly runs .curl files and envs.yml commands with,
+// looked up once. Without one, only --native requests can be sent
+var shellPath = sync.OnceValues(findShell)
+
+// shellCommand returns the command running command with sh -c
+func shellCommand(ctx context.Context, command string) (*exec.Cmd, error) {
+	sh, err := shellPath()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, sh, "-c", command), nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// findShell returns the sh on PATH
+func findShell() (string, error) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return "", fmt.Errorf("curly needs sh to run .curl files: %w", err)
+	}
+	return sh, nil
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// errNoShell explains what to install when there is no sh on Windows
+var errNoShell = errors.New("curly needs a POSIX sh to run .curl files, which Windows doesn't have: install Git for Windows, whose Git Bash comes with one, or run curly inside WSL. Single requests can be sent without a shell with --native")
+
+// findShell returns the sh on PATH or, failing that, the one of Git for
+// Windows, next to git.exe or in its default install locations
+func findShell() (string, error) {
+	if sh, err := exec.LookPath("sh"); err == nil {
+		return sh, nil
+	}
+
+	var candidates []string
+	if git, err := exec.LookPath("git"); err == nil {
+		// git.exe is in Git\cmd, sh.exe in Git\bin
+		root := filepath.Dir(filepath.Dir(git))
+		candidates = append(candidates, filepath.Join(root, "bin", "sh.exe"), filepath.Join(root, "usr", "bin", "sh.exe"))
+	}
+	for _, env := range []string{"ProgramW6432", "ProgramFiles", "ProgramFiles(x86)"} {
+		if dir := os.Getenv(env); dir != "" {
+			candidates = append(candidates, filepath.Join(dir, "Git", "bin", "sh.exe"))
+		}
+	}
+	if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "Programs", "Git", "bin", "sh.exe"))
+	}
+
+	for _, sh := range candidates {
+		if info, err := os.Stat(sh); err == nil && !info.IsDir() {
+			return sh, nil
+		}
+	}
+	return "", errNoShell
+}
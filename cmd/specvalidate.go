@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// specTemplateParamPattern matches a {name} parameter of a path template
+var specTemplateParamPattern = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// specValidator matches requests to the operations of an OpenAPI spec, to
+// check their responses for --validate-spec and to answer them in curly mock
+type specValidator struct {
+	doc    *openapi3.T
+	routes []specRoute
+	// basePaths are the paths of the spec's servers, which the paths of
+	// its operations are relative to
+	basePaths []string
+}
+
+// specRoute is a path of the spec, split into segments to match request
+// paths against
+type specRoute struct {
+	template string
+	item     *openapi3.PathItem
+	segments []specSegment
+}
+
+// specSegment is a segment of a path template: literal text, or a pattern
+// capturing the parameters it holds
+type specSegment struct {
+	literal string
+	pattern *regexp.Regexp
+	params  []string
+}
+
+// rank orders segments matching the same text: literal ones first, then
+// those mixing text with parameters, then bare parameters
+func (s specSegment) rank() int {
+	switch {
+	case s.pattern == nil:
+		return 2
+	case s.pattern.String() != `^([^/]+)$`:
+		return 1
+	}
+	return 0
+}
+
+// newSpecValidator loads the spec at specFile, a path or URL, with the same
+// loader generate uses
+func newSpecValidator(specFile string) (*specValidator, error) {
+	doc, err := generate.LoadSpec(specFile, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI file: %w", err)
+	}
+	v := &specValidator{doc: doc}
+	for _, server := range doc.Servers {
+		if base, err := server.BasePath(); err == nil && base != "/" {
+			v.basePaths = append(v.basePaths, strings.TrimSuffix(base, "/"))
+		}
+	}
+	for template, item := range doc.Paths.Map() {
+		route := specRoute{template: template, item: item}
+		for _, part := range strings.Split(strings.Trim(template, "/"), "/") {
+			route.segments = append(route.segments, parseSpecSegment(part))
+		}
+		v.routes = append(v.routes, route)
+	}
+	sort.Slice(v.routes, func(i, j int) bool { return v.routes[i].template < v.routes[j].template })
+	return v, nil
+}
+
+// parseSpecSegment parses a segment of a path template
+func parseSpecSegment(part string) specSegment {
+	matches := specTemplateParamPattern.FindAllStringSubmatchIndex(part, -1)
+	if len(matches) == 0 {
+		return specSegment{literal: part}
+	}
+	var segment specSegment
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, m := range matches {
+		pattern.WriteString(regexp.QuoteMeta(part[last:m[0]]))
+		pattern.WriteString("([^/]+)")
+		segment.params = append(segment.params, part[m[2]:m[3]])
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(part[last:]) + "$")
+	segment.pattern = regexp.MustCompile(pattern.String())
+	return segment
+}
+
+// match returns the values of the parameters of route for the segments of a
+// request path, and whether it matches
+func (r specRoute) match(parts []string) (map[string]string, bool) {
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if segment.pattern == nil {
+			if parts[i] != segment.literal {
+				return nil, false
+			}
+			continue
+		}
+		m := segment.pattern.FindStringSubmatch(parts[i])
+		if m == nil {
+			return nil, false
+		}
+		for j, name := range segment.params {
+			params[name] = m[j+1]
+		}
+	}
+	return params, true
+}
+
+// moreSpecific reports whether r is to be picked over other when both match,
+// like /users/me over /users/{id}: the first segment they rank differently
+// decides
+func (r specRoute) moreSpecific(other specRoute) bool {
+	for i := range r.segments {
+		if a, b := r.segments[i].rank(), other.segments[i].rank(); a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// route finds the operation of the spec for method and the path of rawURL,
+// the most specific of the templates matching it, with the server base
+// paths taken off
+func (v *specValidator) route(method, rawURL string) (*routers.Route, map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	paths := []string{u.Path}
+	for _, base := range v.basePaths {
+		if rest, ok := strings.CutPrefix(u.Path, base); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			paths = append(paths, rest)
+		}
+	}
+
+	var best *specRoute
+	var bestParams map[string]string
+	for _, path := range paths {
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		for i, r := range v.routes {
+			if r.item.GetOperation(method) == nil {
+				continue
+			}
+			params, ok := r.match(parts)
+			if ok && (best == nil || r.moreSpecific(*best)) {
+				best, bestParams = &v.routes[i], params
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	if best == nil {
+		return nil, nil, fmt.Errorf("the spec has no operation for %s %s", method, u.Path)
+	}
+	return &routers.Route{
+		Spec:      v.doc,
+		Path:      best.template,
+		PathItem:  best.item,
+		Method:    method,
+		Operation: best.item.GetOperation(method),
+	}, bestParams, nil
+}
+
+// check validates the last response of result, got for the last request of
+// cmdText, against the operation the spec declares for its method and path:
+// its status, and its body against the schema of that status. A nil
+// validator and runs without a response pass
+func (v *specValidator) check(ctx context.Context, cmdText string, result commandResult) error {
+	if v == nil {
+		return nil
+	}
+	status := result.lastStatus()
+	if status == 0 {
+		return nil
+	}
+	req := firstRequest(cmdText)
+	if requests := curlRequests(cmdText); len(requests) > 0 {
+		req = requests[len(requests)-1]
+		req.method = req.effectiveMethod()
+	}
+	route, params, err := v.route(req.method, req.url)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid request %s %s: %w", req.method, req.url, err)
+	}
+	options := &openapi3filter.Options{
+		IncludeResponseStatus: true,
+		MultiError:            true,
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+	}
+	header := http.Header{}
+	if contentType := lastContentType(result.output); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    httpReq,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		},
+		Status:  status,
+		Header:  header,
+		Options: options,
+	}
+	input.SetBodyBytes(bytes.TrimSuffix([]byte(lastResponseBody(result.output)), []byte("\n")))
+	if err := openapi3filter.ValidateResponse(ctx, input); err != nil {
+		return fmt.Errorf("response doesn't match %s %s in the spec: %s", req.method, route.Path, strings.Join(specViolations(err), "; "))
+	}
+	return nil
+}
+
+// specViolations describes each of the violations err of ValidateResponse
+// or ValidateRequest holds, locating those of the body by their JSON pointer
+func specViolations(err error) []string {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var violations []string
+		for _, e := range multi {
+			violations = append(violations, specViolations(e)...)
+		}
+		return violations
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if inner := schemaErr.Unwrap(); inner != nil {
+			var nested openapi3.MultiError
+			if errors.As(inner, &nested) {
+				return specViolations(nested)
+			}
+		}
+		pointer := strings.Join(schemaErr.JSONPointer(), "/")
+		return []string{fmt.Sprintf("body /%s: %s", pointer, schemaErr.Reason)}
+	}
+	var responseErr *openapi3filter.ResponseError
+	if errors.As(err, &responseErr) && responseErr.Err != nil {
+		var nested openapi3.MultiError
+		if errors.As(responseErr.Err, &nested) {
+			return specViolations(nested)
+		}
+		if errors.As(responseErr.Err, &schemaErr) {
+			return specViolations(schemaErr)
+		}
+		return []string{fmt.Sprintf("%s: %v", responseErr.Reason, responseErr.Err)}
+	}
+	if errors.As(err, &responseErr) {
+		return []string{responseErr.Reason}
+	}
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) && requestErr.Err != nil {
+		var nested openapi3.MultiError
+		if errors.As(requestErr.Err, &nested) {
+			return specViolations(nested)
+		}
+		if errors.As(requestErr.Err, &schemaErr) {
+			return specViolations(schemaErr)
+		}
+		return []string{requestErr.Error()}
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validateSpecYAML = `openapi: 3.0.3
+info:
+  title: Users
+  version: "1"
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: A user
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name]
+                properties:
+                  id:
+                    type: integer
+                  name:
+                    type: string
+        "404":
+          description: No such user
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "204":
+          description: Deleted
+  /users/me:
+    get:
+      responses:
+        "200":
+          description: The caller
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [email]
+                properties:
+                  email:
+                    type: string
+  /files/{name}.json:
+    get:
+      parameters:
+        - name: name
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: A file
+`
+
+func writeValidateSpec(t *testing.T) *specValidator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openapi.yml")
+	if err := os.WriteFile(path, []byte(validateSpecYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := newSpecValidator(path)
+	if err != nil {
+		t.Fatalf("newSpecValidator() error = %v", err)
+	}
+	return v
+}
+
+func TestSpecValidatorRoute(t *testing.T) {
+	v := writeValidateSpec(t)
+	tests := []struct {
+		method, url string
+		wantPath    string
+		wantParams  map[string]string
+		wantErr     string
+	}{
+		{method: "GET", url: "https://api.example.com/v1/users/42", wantPath: "/users/{id}", wantParams: map[string]string{"id": "42"}},
+		{method: "GET", url: "https://api.example.com/v1/users/me", wantPath: "/users/me", wantParams: map[string]string{}},
+		// /users/me has no DELETE, /users/{id} does
+		{method: "DELETE", url: "http://localhost:8080/v1/users/me", wantPath: "/users/{id}", wantParams: map[string]string{"id": "me"}},
+		{method: "GET", url: "http://localhost:8080/users/42?verbose=1", wantPath: "/users/{id}", wantParams: map[string]string{"id": "42"}},
+		{method: "GET", url: "http://localhost/v1/files/report.json", wantPath: "/files/{name}.json", wantParams: map[string]string{"name": "report"}},
+		{method: "GET", url: "http://localhost/v1/users/42/posts", wantErr: "the spec has no operation for GET /v1/users/42/posts"},
+		{method: "POST", url: "http://localhost/v1/users/42", wantErr: "the spec has no operation for POST /v1/users/42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			route, params, err := v.route(tt.method, tt.url)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("route() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("route() error = %v", err)
+			}
+			if route.Path != tt.wantPath || fmt.Sprint(params) != fmt.Sprint(tt.wantParams) {
+				t.Errorf("route() = %s %v, want %s %v", route.Path, params, tt.wantPath, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestSpecValidatorCheck(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/users/42":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": 42, "name": "Ada"}`)
+		case "/v1/users/7":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": "seven"}`)
+		case "/v1/users/me":
+			w.WriteHeader(http.StatusTeapot)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	v := writeValidateSpec(t)
+
+	tests := []struct {
+		path    string
+		wantErr []string
+	}{
+		{path: "/v1/users/42"},
+		{path: "/v1/users/99"},
+		{path: "/v1/users/7", wantErr: []string{
+			"response doesn't match GET /users/{id} in the spec",
+			`body /name: property "name" is missing`,
+			"body /id: value must be an integer",
+		}},
+		{path: "/v1/users/me", wantErr: []string{"response doesn't match GET /users/me in the spec", "status is not supported"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			cmdText := `curl -s "` + server.URL + tt.path + `"`
+			result, err := execShellCommand(context.Background(), injectStatusWriteOut(cmdText), 1, execOptions{quiet: true, keepOutput: true})
+			if err != nil {
+				t.Fatalf("execShellCommand() error = %v", err)
+			}
+			err = v.check(context.Background(), cmdText, result)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("check() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("check() passed, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("check() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+
+	var none *specValidator
+	if err := none.check(context.Background(), "curl -s x", commandResult{statuses: []int{500}}); err != nil {
+		t.Errorf("check() without a spec error = %v", err)
+	}
+}
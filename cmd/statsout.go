@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// statsSchema is the version of statsReport, raised when a change to it
+// would break the readers of the files it's written to
+const statsSchema = 1
+
+// statsReport is the schema --stats-out writes a run's ExecutionStats as.
+// Fields are only ever added to it, so dashboards reading it keep working
+type statsReport struct {
+	Schema  int `json:"schema"`
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	// Throttled counts the executions whose response was throttled, see
+	// run.ExecutionStats
+	Throttled  int       `json:"throttled,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	DurationMs float64   `json:"duration_ms"`
+	// TargetRate is the --rate the run was paced at, when it was
+	TargetRate float64 `json:"target_rate,omitempty"`
+	// Aborted is the threshold that aborted the run, when one did
+	Aborted string `json:"aborted,omitempty"`
+	// StatusCodes counts the HTTP statuses by code
+	StatusCodes map[int]int    `json:"status_codes"`
+	Errors      []statsError   `json:"errors"`
+	Latencies   []statsLatency `json:"latencies"`
+	// Steps break the statuses down by curl command, for a file running
+	// several
+	Steps []statsStep `json:"steps,omitempty"`
+}
+
+// statsStep is what the executions got from one of the curl commands of the
+// file, numbered from 1 in the order they run
+type statsStep struct {
+	Step        int         `json:"step"`
+	Request     string      `json:"request"`
+	Runs        int         `json:"runs"`
+	StatusCodes map[int]int `json:"status_codes"`
+}
+
+// statsError is an error message and how many executions failed with it
+type statsError struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	// Class is the kind of failure, like "Timeout" or "HTTP 5xx", see
+	// run.ClassifyFailure
+	Class string `json:"class"`
+}
+
+// statsLatency is how long one execution took
+type statsLatency struct {
+	Iteration  int     `json:"iteration"`
+	DurationMs float64 `json:"duration_ms"`
+	// Output is the file the response was saved to with --output-dir or
+	// --output-file
+	Output string `json:"output,omitempty"`
+	// Status is the HTTP status of the last response, left out without one
+	Status int `json:"status,omitempty"`
+	// RequestID is the UUID sent in the --request-id-header
+	RequestID string `json:"request_id,omitempty"`
+	// Timings break each request of the execution down with --timing
+	Timings []statsTiming `json:"timings,omitempty"`
+}
+
+// statsTiming is the timing of a request, the values of curl's write-out
+// variables of the same names in milliseconds
+type statsTiming struct {
+	NamelookupMs    float64 `json:"time_namelookup_ms"`
+	ConnectMs       float64 `json:"time_connect_ms"`
+	AppconnectMs    float64 `json:"time_appconnect_ms"`
+	StarttransferMs float64 `json:"time_starttransfer_ms"`
+	TotalMs         float64 `json:"time_total_ms"`
+	SizeDownload    int64   `json:"size_download"`
+}
+
+// statsFormats are the formats --stats-format accepts
+var statsFormats = []string{"json", "csv"}
+
+// resolveStatsFormat returns the format to write path in: format when given,
+// otherwise csv for a .csv file and json for anything else
+func resolveStatsFormat(path, format string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return "csv", nil
+		}
+		return "json", nil
+	}
+	for _, f := range statsFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --stats-format %q, expected one of %s", format, strings.Join(statsFormats, ", "))
+}
+
+// newStatsReport builds the report of s, with errors sorted from the most
+// frequent and latencies in iteration order
+func newStatsReport(s *run.ExecutionStats) statsReport {
+	report := statsReport{
+		Schema:      statsSchema,
+		Total:       s.Total,
+		Success:     int(s.Success),
+		Failed:      int(s.Failed),
+		Throttled:   int(s.Throttled),
+		StartTime:   s.StartTime,
+		EndTime:     s.EndTime,
+		DurationMs:  milliseconds(s.EndTime.Sub(s.StartTime)),
+		TargetRate:  s.TargetRate,
+		Aborted:     s.Aborted,
+		StatusCodes: map[int]int{},
+		Errors:      []statsError{},
+		Latencies:   []statsLatency{},
+	}
+	for code, count := range s.StatusCodes {
+		report.StatusCodes[code] = count
+	}
+
+	counts := map[statsError]int{}
+	for i, msg := range s.Errors {
+		e := statsError{Message: msg, Class: string(run.FailureOther)}
+		if i < len(s.ErrorClasses) {
+			e.Class = string(s.ErrorClasses[i])
+		}
+		if counts[e] == 0 {
+			report.Errors = append(report.Errors, e)
+		}
+		counts[e]++
+	}
+	for i := range report.Errors {
+		report.Errors[i].Count = counts[report.Errors[i]]
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Count > report.Errors[j].Count })
+
+	for _, sample := range s.Latencies {
+		latency := statsLatency{
+			Iteration:  sample.Iteration,
+			DurationMs: milliseconds(sample.Duration),
+			Output:     sample.Output,
+			Status:     sample.Status,
+			RequestID:  sample.RequestID,
+		}
+		for _, t := range sample.Timings {
+			latency.Timings = append(latency.Timings, statsTiming{
+				NamelookupMs:    milliseconds(t.NameLookup),
+				ConnectMs:       milliseconds(t.Connect),
+				AppconnectMs:    milliseconds(t.AppConnect),
+				StarttransferMs: milliseconds(t.StartTransfer),
+				TotalMs:         milliseconds(t.Total),
+				SizeDownload:    t.Size,
+			})
+		}
+		report.Latencies = append(report.Latencies, latency)
+	}
+	sort.Slice(report.Latencies, func(i, j int) bool { return report.Latencies[i].Iteration < report.Latencies[j].Iteration })
+
+	for i, step := range s.Steps {
+		codes := map[int]int{}
+		for code, count := range step.StatusCodes {
+			codes[code] = count
+		}
+		report.Steps = append(report.Steps, statsStep{Step: i + 1, Request: step.Name, Runs: step.Runs, StatusCodes: codes})
+	}
+	return report
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// writeStatsFile writes the report of s to path in format
+func writeStatsFile(path, format string, s *run.ExecutionStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	report := newStatsReport(s)
+	if format == "csv" {
+		err = writeStatsCSV(f, report)
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write stats to %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeStatsCSV writes report as section,key,value rows: the summary fields,
+// then a status row per code, an error row per message and a latency row per
+// execution, keyed by iteration, followed by the output files and request IDs
+// of the executions that have them and a row per timing value of each of
+// their requests, in order, and last the request, runs and status counts of
+// each step of a file running several curl commands
+func writeStatsCSV(w io.Writer, report statsReport) error {
+	rows := [][]string{
+		{"section", "key", "value"},
+		{"summary", "schema", strconv.Itoa(report.Schema)},
+		{"summary", "total", strconv.Itoa(report.Total)},
+		{"summary", "success", strconv.Itoa(report.Success)},
+		{"summary", "failed", strconv.Itoa(report.Failed)},
+		{"summary", "start_time", report.StartTime.Format(time.RFC3339Nano)},
+		{"summary", "end_time", report.EndTime.Format(time.RFC3339Nano)},
+		{"summary", "duration_ms", formatMs(report.DurationMs)},
+	}
+	if report.TargetRate > 0 {
+		rows = append(rows, []string{"summary", "target_rate", strconv.FormatFloat(report.TargetRate, 'f', -1, 64)})
+	}
+	if report.Throttled > 0 {
+		rows = append(rows, []string{"summary", "throttled", strconv.Itoa(report.Throttled)})
+	}
+	if report.Aborted != "" {
+		rows = append(rows, []string{"summary", "aborted", report.Aborted})
+	}
+
+	codes := make([]int, 0, len(report.StatusCodes))
+	for code := range report.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		rows = append(rows, []string{"status", strconv.Itoa(code), strconv.Itoa(report.StatusCodes[code])})
+	}
+	for _, e := range report.Errors {
+		rows = append(rows, []string{"error", e.Message, strconv.Itoa(e.Count)})
+	}
+	var classes []string
+	classCounts := map[string]int{}
+	for _, e := range report.Errors {
+		if classCounts[e.Class] == 0 {
+			classes = append(classes, e.Class)
+		}
+		classCounts[e.Class] += e.Count
+	}
+	for _, class := range classes {
+		rows = append(rows, []string{"error_class", class, strconv.Itoa(classCounts[class])})
+	}
+	for _, l := range report.Latencies {
+		rows = append(rows, []string{"latency", strconv.Itoa(l.Iteration), formatMs(l.DurationMs)})
+	}
+	for _, l := range report.Latencies {
+		if l.Output != "" {
+			rows = append(rows, []string{"output", strconv.Itoa(l.Iteration), l.Output})
+		}
+	}
+	for _, l := range report.Latencies {
+		if l.RequestID != "" {
+			rows = append(rows, []string{"request_id", strconv.Itoa(l.Iteration), l.RequestID})
+		}
+	}
+	for _, l := range report.Latencies {
+		iteration := strconv.Itoa(l.Iteration)
+		for _, t := range l.Timings {
+			rows = append(rows,
+				[]string{"time_namelookup_ms", iteration, formatMs(t.NamelookupMs)},
+				[]string{"time_connect_ms", iteration, formatMs(t.ConnectMs)},
+				[]string{"time_appconnect_ms", iteration, formatMs(t.AppconnectMs)},
+				[]string{"time_starttransfer_ms", iteration, formatMs(t.StarttransferMs)},
+				[]string{"time_total_ms", iteration, formatMs(t.TotalMs)},
+				[]string{"size_download", iteration, strconv.FormatInt(t.SizeDownload, 10)},
+			)
+		}
+	}
+	for _, step := range report.Steps {
+		number := strconv.Itoa(step.Step)
+		rows = append(rows, []string{"step", number, step.Request}, []string{"step_runs", number, strconv.Itoa(step.Runs)})
+		codes := make([]int, 0, len(step.StatusCodes))
+		for code := range step.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			rows = append(rows, []string{"step_status", number + ":" + strconv.Itoa(code), strconv.Itoa(step.StatusCodes[code])})
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// formatMs formats fractional milliseconds without trailing zeros
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', -1, 64)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func testExecutionStats() *run.ExecutionStats {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	stats := &run.ExecutionStats{Total: 4, StartTime: start, EndTime: start.Add(1500 * time.Millisecond)}
+	stats.RecordSuccess()
+	stats.RecordSuccess()
+	stats.RecordFailure(run.ClassifiedError{Class: run.StatusFailure(500), Err: errors.New("HTTP status 500")})
+	stats.RecordFailure(run.ClassifiedError{Class: run.StatusFailure(500), Err: errors.New("HTTP status 500")})
+	stats.RecordStatus(200)
+	stats.RecordStatus(200)
+	stats.RecordStatus(500)
+	stats.RecordStatus(500)
+	for i, ms := range []int{120, 80, 250, 95} {
+		// Parallel executions finish out of order
+		iteration := 4 - i
+		stats.RecordLatency(run.LatencySample{
+			Iteration: iteration,
+			Duration:  time.Duration(ms) * time.Millisecond,
+			Output:    fmt.Sprintf("responses/get_%d.json", iteration),
+			Status:    200 + 300*(iteration%2),
+			RequestID: fmt.Sprintf("id-%d", iteration),
+		})
+	}
+	return stats
+}
+
+func TestWriteStatsFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	if err := writeStatsFile(path, "json", testExecutionStats()); err != nil {
+		t.Fatalf("writeStatsFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	var got statsReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("stats file doesn't parse: %v\n%s", err, data)
+	}
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := statsReport{
+		Schema:      1,
+		Total:       4,
+		Success:     2,
+		Failed:      2,
+		StartTime:   start,
+		EndTime:     start.Add(1500 * time.Millisecond),
+		DurationMs:  1500,
+		StatusCodes: map[int]int{200: 2, 500: 2},
+		Errors:      []statsError{{Message: "HTTP status 500", Count: 2, Class: "HTTP 5xx"}},
+		Latencies: []statsLatency{
+			{Iteration: 1, DurationMs: 95, Output: "responses/get_1.json", Status: 500, RequestID: "id-1"},
+			{Iteration: 2, DurationMs: 250, Output: "responses/get_2.json", Status: 200, RequestID: "id-2"},
+			{Iteration: 3, DurationMs: 80, Output: "responses/get_3.json", Status: 500, RequestID: "id-3"},
+			{Iteration: 4, DurationMs: 120, Output: "responses/get_4.json", Status: 200, RequestID: "id-4"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats file parsed to %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteStatsFileCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	if err := writeStatsFile(path, "csv", testExecutionStats()); err != nil {
+		t.Fatalf("writeStatsFile() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open stats: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("stats file doesn't parse: %v", err)
+	}
+
+	want := [][]string{
+		{"section", "key", "value"},
+		{"summary", "schema", "1"},
+		{"summary", "total", "4"},
+		{"summary", "success", "2"},
+		{"summary", "failed", "2"},
+		{"summary", "start_time", "2026-03-01T12:00:00Z"},
+		{"summary", "end_time", "2026-03-01T12:00:01.5Z"},
+		{"summary", "duration_ms", "1500"},
+		{"status", "200", "2"},
+		{"status", "500", "2"},
+		{"error", "HTTP status 500", "2"},
+		{"error_class", "HTTP 5xx", "2"},
+		{"latency", "1", "95"},
+		{"latency", "2", "250"},
+		{"latency", "3", "80"},
+		{"latency", "4", "120"},
+		{"output", "1", "responses/get_1.json"},
+		{"output", "2", "responses/get_2.json"},
+		{"output", "3", "responses/get_3.json"},
+		{"output", "4", "responses/get_4.json"},
+		{"request_id", "1", "id-1"},
+		{"request_id", "2", "id-2"},
+		{"request_id", "3", "id-3"},
+		{"request_id", "4", "id-4"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("stats file rows = %v, want %v", rows, want)
+	}
+}
+
+func TestResolveStatsFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{path: "results.json", want: "json"},
+		{path: "results.CSV", want: "csv"},
+		{path: "results", want: "json"},
+		{path: "results.txt", format: "csv", want: "csv"},
+		{path: "results.csv", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveStatsFormat(tt.path, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveStatsFormat(%q, %q) error = %v, wantErr %v", tt.path, tt.format, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveStatsFormat(%q, %q) = %q, want %q", tt.path, tt.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// statusWriteOut makes curl print the HTTP status and Content-Type it got on a
+// line of its own after the response, for execShellCommand to pick up and
+// strip again
+const statusWriteOut = `-w '\n__curly_status__=%{http_code} %{content_type}\n'`
+
+// maxContentType is the length of the longest Content-Type a status line can
+// carry
+const maxContentType = 256
+
+// statusLinePattern matches a status line printed by statusWriteOut, or
+// timingWriteOut, with the newline it adds ahead of it. The timing, the
+// Retry-After of withRetryAfter and the Content-Type are optional
+var statusLinePattern = regexp.MustCompile(fmt.Sprintf(`\n?__curly_status__=(\d{3})(?: timing=([0-9.,]{0,%d}))?(?: retry-after="([^"\n]{0,%d})")?(?: ([^\n]{0,%d}))?\n`, maxTiming, maxRetryAfter, maxContentType))
+
+// injectStatusWriteOut adds statusWriteOut to the curl commands in content
+// whose output reaches curly. Commands with their own --write-out, or piping
+// or redirecting their output, are left alone
+func injectStatusWriteOut(content string) string {
+	return injectWriteOut(content, statusWriteOut)
+}
+
+// injectWriteOut adds writeOut to the curl commands in content whose output
+// reaches curly
+func injectWriteOut(content, writeOut string) string {
+	lines := strings.Split(content, "\n")
+	for _, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		if !capturesOutput(splitShellWords(text.String())) {
+			continue
+		}
+		insertCurlArgs(lines, cmd, writeOut)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// capturesOutput reports whether curl's stdout ends up in curly's output for
+// the words of a curl command, and isn't already shaped with --write-out
+func capturesOutput(words []string) bool {
+	for _, word := range words {
+		switch {
+		case word == "-w" || word == "--write-out" || strings.HasPrefix(word, "--write-out="):
+			return false
+		case strings.HasPrefix(word, "-w") && !strings.HasPrefix(word, "--"):
+			return false
+		case strings.HasPrefix(word, "|") || strings.HasPrefix(word, ">") || strings.HasPrefix(word, "1>"):
+			return false
+		}
+	}
+	return true
+}
+
+// extractStatuses removes the status lines from out and returns the HTTP
+// statuses they held. 000, curl's status when no response came back, is
+// skipped as the exit code already tells. Without status lines, like for a
+// command with its own --write-out, the status of the header blocks -i
+// prints is used
+func extractStatuses(out string) (string, []int) {
+	matches := statusLinePattern.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		if code := headerStatus(out); code != 0 {
+			return out, []int{code}
+		}
+		return out, nil
+	}
+	var statuses []int
+	for _, match := range matches {
+		if code, _ := strconv.Atoi(match[1]); code != 0 {
+			statuses = append(statuses, code)
+		}
+	}
+	return statusLinePattern.ReplaceAllString(out, ""), statuses
+}
+
+// statusCodes returns the codes of the status lines in out, in order, 0
+// where curl got no response
+func statusCodes(out string) []int {
+	var codes []int
+	for _, match := range statusLinePattern.FindAllStringSubmatch(out, -1) {
+		code, _ := strconv.Atoi(match[1])
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// headerBlockPattern matches a header block curl -i prints ahead of a body:
+// the status line, the headers and the blank line ending them
+var headerBlockPattern = regexp.MustCompile(`^HTTP/[0-9.]+ (\d{3})[^\n]*\n(?:[^\r\n]+\r?\n)*\r?\n`)
+
+// splitResponseHeaders splits the header blocks curl -i prints off the start
+// of body, one for each response of a redirect followed with -L or a 100
+// Continue, returning them and the rest of body
+func splitResponseHeaders(body string) (headers, rest string) {
+	rest = body
+	for {
+		m := headerBlockPattern.FindStringIndex(rest)
+		if m == nil {
+			return body[:len(body)-len(rest)], rest
+		}
+		rest = rest[m[1]:]
+	}
+}
+
+// headerStatus returns the status of the last of the header blocks at the
+// start of body, the response the body is of, or 0 without any
+func headerStatus(body string) int {
+	status := 0
+	for rest := body; ; {
+		m := headerBlockPattern.FindStringSubmatchIndex(rest)
+		if m == nil {
+			return status
+		}
+		status, _ = strconv.Atoi(rest[m[2]:m[3]])
+		rest = rest[m[1]:]
+	}
+}
+
+// lastContentType returns the Content-Type on the last status line in out,
+// the response that ends up there when several curls run
+func lastContentType(out string) string {
+	matches := statusLinePattern.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(matches[len(matches)-1][4])
+}
+
+// lastRetryAfter returns the Retry-After on the last status line in out, ""
+// when the response had none or it wasn't asked for with withRetryAfter
+func lastRetryAfter(out string) string {
+	matches := statusLinePattern.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][3]
+}
+
+// statusPatternSyntax matches a valid statusPattern
+var statusPatternSyntax = regexp.MustCompile(`^[1-5](xx|\d\d)$`)
+
+// statusPattern matches an HTTP status exactly, like 404, or by class, like 5xx
+type statusPattern string
+
+// parseStatusPatterns parses a --fail-on-status list like "4xx,503"
+func parseStatusPatterns(list string) ([]statusPattern, error) {
+	var patterns []statusPattern
+	for _, p := range strings.Split(list, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if !statusPatternSyntax.MatchString(p) {
+			return nil, fmt.Errorf("invalid --fail-on-status %q, expected a status like 404 or a class like 5xx", p)
+		}
+		patterns = append(patterns, statusPattern(p))
+	}
+	return patterns, nil
+}
+
+// matches reports whether code is the status or in the class of p
+func (p statusPattern) matches(code int) bool {
+	s := strconv.Itoa(code)
+	if strings.HasSuffix(string(p), "xx") {
+		return s[:1] == string(p[:1])
+	}
+	return s == string(p)
+}
+
+// failingStatus returns the first of statuses matching one of patterns
+func failingStatus(statuses []int, patterns []statusPattern) (int, bool) {
+	for _, code := range statuses {
+		for _, p := range patterns {
+			if p.matches(code) {
+				return code, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// statusLine is the status line statusWriteOut has curl print for a
+// response, or timingWriteOut with timing. A retryAfter is added like
+// withRetryAfter has curl add it
+func statusLine(code int, contentType, retryAfter string, timing *run.RequestTiming) string {
+	if len(contentType) > maxContentType {
+		contentType = contentType[:maxContentType]
+	}
+	line := statusMarker + strconv.Itoa(code)
+	if timing != nil {
+		line += " timing=" + timing.String()
+	}
+	if retryAfter = strings.ReplaceAll(retryAfter, `"`, ""); retryAfter != "" && len(retryAfter) <= maxRetryAfter {
+		line += ` retry-after="` + retryAfter + `"`
+	}
+	return "\n" + line + " " + contentType + "\n"
+}
+
+// statusScanner is an io.Writer that keeps only the HTTP statuses and
+// timings of the status lines written to it, discarding everything else as
+// it streams by
+type statusScanner struct {
+	line     []byte
+	overflow bool
+	statuses []int
+	// codes are those of every status line, like statusCodes returns
+	codes   []int
+	timings []run.RequestTiming
+	// retryAfter is the Retry-After of the last status line
+	retryAfter string
+}
+
+// maxStatusLine is the length of the longest line statusScanner looks at,
+// longer lines can't be status lines
+const maxStatusLine = len(`__curly_status__=000 timing= retry-after="" `) + maxTiming + maxRetryAfter + maxContentType
+
+func (s *statusScanner) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c != '\n' {
+			if len(s.line) < maxStatusLine {
+				s.line = append(s.line, c)
+			} else {
+				s.overflow = true
+			}
+			continue
+		}
+		if !s.overflow {
+			if match := statusLinePattern.FindSubmatch(append(s.line, '\n')); match != nil && len(match[0]) == len(s.line)+1 {
+				code, _ := strconv.Atoi(string(match[1]))
+				if code != 0 {
+					s.statuses = append(s.statuses, code)
+				}
+				s.codes = append(s.codes, code)
+				s.timings = appendTiming(s.timings, string(match[2]))
+				s.retryAfter = string(match[3])
+			}
+		}
+		s.line, s.overflow = s.line[:0], false
+	}
+	return len(p), nil
+}
+
+// statusMarker starts the status lines printed by statusWriteOut
+const statusMarker = "__curly_status__="
+
+// statusFilter is an io.Writer passing output on to out as it streams in,
+// minus the status lines printed by statusWriteOut, whose HTTP statuses and
+// timings it keeps. It holds back no more than a newline and a partial status line, and
+// once closed has passed on what extractStatuses would have left of it
+type statusFilter struct {
+	out      io.Writer
+	statuses []int
+	// codes are those of every status line, like statusCodes returns
+	codes   []int
+	timings []run.RequestTiming
+	// retryAfter is the Retry-After of the last status line
+	retryAfter string
+	// pendingNewline is a newline held back as a status line following it
+	// takes it along
+	pendingNewline bool
+	// candidate is the start of a line that may turn out to be a status line
+	candidate []byte
+	lineStart bool
+}
+
+func newStatusFilter(out io.Writer) *statusFilter {
+	return &statusFilter{out: out, lineStart: true}
+}
+
+func (f *statusFilter) Write(p []byte) (int, error) {
+	var passed []byte
+	for _, c := range p {
+		if f.lineStart || len(f.candidate) > 0 {
+			if f.extendsCandidate(c) {
+				f.candidate = append(f.candidate, c)
+				f.lineStart = false
+				continue
+			}
+			if c == '\n' && len(f.candidate) >= len(statusMarker)+3 {
+				if match := statusLinePattern.FindSubmatch(append(f.candidate, '\n')); match != nil && len(match[0]) == len(f.candidate)+1 {
+					code, _ := strconv.Atoi(string(match[1]))
+					if code != 0 {
+						f.statuses = append(f.statuses, code)
+					}
+					f.codes = append(f.codes, code)
+					f.timings = appendTiming(f.timings, string(match[2]))
+					f.retryAfter = string(match[3])
+					f.candidate, f.pendingNewline, f.lineStart = f.candidate[:0], false, true
+					continue
+				}
+			}
+		}
+
+		if f.pendingNewline {
+			passed = append(passed, '\n')
+			f.pendingNewline = false
+		}
+		passed = append(passed, f.candidate...)
+		f.candidate = f.candidate[:0]
+		if c == '\n' {
+			f.pendingNewline, f.lineStart = true, true
+			continue
+		}
+		passed = append(passed, c)
+		f.lineStart = false
+	}
+
+	if len(passed) > 0 {
+		if _, err := f.out.Write(passed); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// extendsCandidate reports whether c can follow the candidate status line
+func (f *statusFilter) extendsCandidate(c byte) bool {
+	n := len(f.candidate)
+	switch {
+	case n < len(statusMarker):
+		return c == statusMarker[n]
+	case n < len(statusMarker)+3:
+		return c >= '0' && c <= '9'
+	case n == len(statusMarker)+3:
+		return c == ' '
+	}
+	return n < maxStatusLine && c != '\n'
+}
+
+// Close passes on what the filter held back, as the output has ended
+func (f *statusFilter) Close() error {
+	var rest []byte
+	if f.pendingNewline {
+		rest = append(rest, '\n')
+	}
+	rest = append(rest, f.candidate...)
+	f.pendingNewline, f.candidate = false, nil
+	if len(rest) == 0 {
+		return nil
+	}
+	_, err := f.out.Write(rest)
+	return err
+}
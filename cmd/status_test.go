@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestInjectStatusWriteOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name: "added to each curl command",
+			content: `BASE_URL="http://localhost"
+curl -s "${BASE_URL}/a"
+curl -s -X POST "${BASE_URL}/b" \
+  --data-binary @- << 'EOF'
+{"a": 1}
+EOF`,
+			expected: `BASE_URL="http://localhost"
+curl ` + statusWriteOut + ` -s "${BASE_URL}/a"
+curl ` + statusWriteOut + ` -s -X POST "${BASE_URL}/b" \
+  --data-binary @- << 'EOF'
+{"a": 1}
+EOF`,
+		},
+		{
+			name: "own write-out, pipes and redirects are left alone",
+			content: `curl -s -w '%{time_total}' "${BASE_URL}/a"
+curl -s --write-out="%{http_code}" "${BASE_URL}/b"
+curl -s "${BASE_URL}/c" | jq .
+curl -s "${BASE_URL}/d" \
+  > out.json`,
+			expected: `curl -s -w '%{time_total}' "${BASE_URL}/a"
+curl -s --write-out="%{http_code}" "${BASE_URL}/b"
+curl -s "${BASE_URL}/c" | jq .
+curl -s "${BASE_URL}/d" \
+  > out.json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := injectStatusWriteOut(tt.content); result != tt.expected {
+				t.Errorf("injectStatusWriteOut() =\n%s\n\nwant:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractStatuses(t *testing.T) {
+	tests := []struct {
+		name         string
+		out          string
+		wantOut      string
+		wantStatuses []int
+	}{
+		{
+			name:         "body without trailing newline",
+			out:          "{\"id\": 1}\n__curly_status__=201\n",
+			wantOut:      `{"id": 1}`,
+			wantStatuses: []int{201},
+		},
+		{
+			name:         "body with trailing newline and several commands",
+			out:          "one\n\n__curly_status__=200\ntwo\n__curly_status__=500\n",
+			wantOut:      "one\ntwo",
+			wantStatuses: []int{200, 500},
+		},
+		{
+			name:         "status lines carrying the Content-Type",
+			out:          "{}\n__curly_status__=200 application/json\n<p>\n__curly_status__=404 \n",
+			wantOut:      "{}<p>",
+			wantStatuses: []int{200, 404},
+		},
+		{
+			name:         "status lines carrying the timing",
+			out:          "{}\n__curly_status__=200 timing=0.001200,0.002500,0.000000,0.041000,0.042300,2 application/json\n",
+			wantOut:      "{}",
+			wantStatuses: []int{200},
+		},
+		{
+			name:    "no response",
+			out:     "\n__curly_status__=000\n",
+			wantOut: "",
+		},
+		{
+			name:         "header blocks of -i without status lines",
+			out:          "HTTP/1.1 302 Found\r\nLocation: /target\r\n\r\nHTTP/2 200 \r\ncontent-type: text/plain\r\n\r\nok\n",
+			wantOut:      "HTTP/1.1 302 Found\r\nLocation: /target\r\n\r\nHTTP/2 200 \r\ncontent-type: text/plain\r\n\r\nok\n",
+			wantStatuses: []int{200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, statuses := extractStatuses(tt.out)
+			if out != tt.wantOut {
+				t.Errorf("extractStatuses() output = %q, want %q", out, tt.wantOut)
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) {
+				t.Errorf("extractStatuses() statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+		})
+	}
+}
+
+func TestSplitResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantHeaders string
+		wantStatus  int
+	}{
+		{name: "no headers", body: "{\"a\": 1}"},
+		{name: "one block", body: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\"a\": 1}", wantHeaders: "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n", wantStatus: 200},
+		{
+			name:        "redirect and 100 Continue",
+			body:        "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 301 Moved Permanently\r\nLocation: /b\r\n\r\nHTTP/2 201 \r\nx: 1\r\n\r\ncreated",
+			wantHeaders: "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 301 Moved Permanently\r\nLocation: /b\r\n\r\nHTTP/2 201 \r\nx: 1\r\n\r\n",
+			wantStatus:  201,
+		},
+		{name: "empty body", body: "HTTP/1.1 204 No Content\n\n", wantHeaders: "HTTP/1.1 204 No Content\n\n", wantStatus: 204},
+		{name: "unfinished block", body: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n"},
+		{name: "text mentioning HTTP", body: "the HTTP/1.1 200 line\n\nbody"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, rest := splitResponseHeaders(tt.body)
+			if headers != tt.wantHeaders || headers+rest != tt.body {
+				t.Errorf("splitResponseHeaders() = %q, %q, want headers %q", headers, rest, tt.wantHeaders)
+			}
+			if got := headerStatus(tt.body); got != tt.wantStatus {
+				t.Errorf("headerStatus() = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseStatusPatterns(t *testing.T) {
+	patterns, err := parseStatusPatterns("4xx, 503,5XX")
+	if err != nil {
+		t.Fatalf("parseStatusPatterns() error = %v", err)
+	}
+	for code, want := range map[int]bool{404: true, 429: true, 503: true, 500: true, 200: false, 302: false} {
+		if _, got := failingStatus([]int{code}, patterns); got != want {
+			t.Errorf("status %d failing = %v, want %v", code, got, want)
+		}
+	}
+
+	for _, list := range []string{"4x", "600", "xx", "abc"} {
+		if _, err := parseStatusPatterns(list); err == nil {
+			t.Errorf("parseStatusPatterns(%q) should fail", list)
+		}
+	}
+}
+
+func TestExecCmdCountsStatuses(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	// Every third request is throttled, every fifth errors
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch {
+		case n%5 == 0:
+			w.WriteHeader(http.StatusInternalServerError)
+		case n%3 == 0:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	cmdText := `curl -s "` + server.URL + `"`
+
+	tests := []struct {
+		name    string
+		failOn  string
+		wantErr string
+	}{
+		{name: "statuses alone don't fail"},
+		{name: "5xx fails", failOn: "5xx", wantErr: "3 of 15 requests failed"},
+		{name: "4xx and 5xx fail", failOn: "4xx,5xx", wantErr: "7 of 15 requests failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			failOn, err := parseStatusPatterns(tt.failOn)
+			if err != nil {
+				t.Fatalf("parseStatusPatterns() error = %v", err)
+			}
+			_, err = execCmd(cmdText, execOptions{times: 15, parallel: 5, failOn: failOn})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("execCmd() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("execCmd() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cmdText := injectStatusWriteOut(`curl -s "` + server.URL + `/ok"
+curl -s "` + server.URL + `/missing"`)
+	stats := &run.ExecutionStats{Total: 1}
+	failOn, _ := parseStatusPatterns("4xx")
+	err := runOnce(context.Background(), cmdText, 1, stats, execOptions{failOn: failOn})
+	if err == nil || err.Error() != "HTTP status 404" {
+		t.Errorf("runOnce() error = %v, want HTTP status 404", err)
+	}
+	if want := map[int]int{200: 1, 404: 1}; !reflect.DeepEqual(stats.StatusCodes, want) {
+		t.Errorf("StatusCodes = %v, want %v", stats.StatusCodes, want)
+	}
+	if len(stats.Latencies) != 1 || stats.Latencies[0].Iteration != 1 {
+		t.Errorf("Latencies = %v, want one sample for iteration 1", stats.Latencies)
+	}
+}
+
+func TestStatusScanner(t *testing.T) {
+	out := "{\"big\": \"" + strings.Repeat("x", 100000) + "\"}\n__curly_status__=201\n" +
+		"not __curly_status__=500\n__curly_status__=000\nbody\n__curly_status__=404\n"
+
+	// Written in small chunks, as a pipe would deliver it
+	s := &statusScanner{}
+	for i := 0; i < len(out); i += 7 {
+		if _, err := s.Write([]byte(out[i:min(i+7, len(out))])); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if want := []int{201, 404}; !reflect.DeepEqual(s.statuses, want) {
+		t.Errorf("statuses = %v, want %v", s.statuses, want)
+	}
+	if cap(s.line) > 2*maxStatusLine {
+		t.Errorf("statusScanner held on to %d bytes, want at most a status line", cap(s.line))
+	}
+}
+
+func TestExecShellCommandQuiet(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	result, err := execShellCommand(context.Background(), `echo response body; printf '\n__curly_status__=503\n'; echo oops >&2`, 1, execOptions{quiet: true})
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("execShellCommand() error = %v", err)
+	}
+	if len(printed) != 0 {
+		t.Errorf("execShellCommand() with quiet printed %q", printed)
+	}
+	if !reflect.DeepEqual(result.statuses, []int{503}) {
+		t.Errorf("execShellCommand() statuses = %v, want [503]", result.statuses)
+	}
+}
+
+func TestStatusFilter(t *testing.T) {
+	outputs := []string{
+		"",
+		"body",
+		"body\n",
+		"{\"ok\":true}\n__curly_status__=200\n",
+		"{\"ok\":true}\n__curly_status__=200\n{\"ok\":false}\n__curly_status__=503\n",
+		"__curly_status__=201\nafter\n",
+		"no newline\n__curly_status__=204\n\n",
+		"__curly_status__=20x\n__curly_status__\n",
+		"line\n\n__curly_status__=404\ntrailing",
+		"__curly_status__=000\n",
+		"{}\n__curly_status__=200 application/json; charset=utf-8\n",
+		"__curly_status__=204 \n__curly_status__=200x\n",
+		"__curly_status__=200 " + strings.Repeat("a", maxContentType+1) + "\n",
+		"{}\n__curly_status__=200 timing=0.001,0.002,0.003,0.004,0.005,2 application/json\n",
+		"__curly_status__=200 timing=0.001,0.002 \n__curly_status__=200 timing= \n",
+	}
+
+	for _, out := range outputs {
+		// Byte by byte, so every split of a status line is seen
+		var got bytes.Buffer
+		f := newStatusFilter(&got)
+		for i := 0; i < len(out); i++ {
+			if _, err := f.Write([]byte{out[i]}); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		f.Close()
+
+		want, wantStatuses := extractStatuses(out)
+		if got.String() != want {
+			t.Errorf("statusFilter on %q wrote %q, want %q", out, got.String(), want)
+		}
+		if !reflect.DeepEqual(f.statuses, wantStatuses) {
+			t.Errorf("statusFilter on %q statuses = %v, want %v", out, f.statuses, wantStatuses)
+		}
+		if wantTimings := extractTimings(out); !reflect.DeepEqual(f.timings, wantTimings) {
+			t.Errorf("statusFilter on %q timings = %v, want %v", out, f.timings, wantTimings)
+		}
+	}
+}
+
+func TestExecShellCommandStream(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	start := time.Now()
+	firstLine := make(chan time.Duration, 1)
+	printed := make(chan string, 1)
+	go func() {
+		var all bytes.Buffer
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 && all.Len() == 0 {
+				firstLine <- time.Since(start)
+			}
+			all.Write(buf[:n])
+			if err != nil {
+				printed <- all.String()
+				return
+			}
+		}
+	}()
+
+	result, err := execShellCommand(context.Background(), `echo one; printf '\n__curly_status__=200\n'; sleep 0.5; echo two`, 1, execOptions{stream: true})
+	w.Close()
+	if err != nil {
+		t.Fatalf("execShellCommand() error = %v", err)
+	}
+	if elapsed := <-firstLine; elapsed > 300*time.Millisecond {
+		t.Errorf("first output arrived after %s, want it before the command finished", elapsed)
+	}
+	if got, want := <-printed, "one\ntwo\n\n"; got != want {
+		t.Errorf("execShellCommand() printed %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(result.statuses, []int{200}) {
+		t.Errorf("execShellCommand() statuses = %v, want [200]", result.statuses)
+	}
+}
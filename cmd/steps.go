@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// fileSteps returns the steps of cmdText, one for each of its curl commands
+func fileSteps(cmdText string) []run.Step {
+	lines := strings.Split(cmdText, "\n")
+	requests := curlRequests(cmdText)
+	var steps []run.Step
+	for i, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		step := run.Step{Name: fmt.Sprintf("step %d", i+1), Reports: capturesOutput(splitShellWords(text.String()))}
+		if i < len(requests) {
+			step.Name = requests[i].effectiveMethod() + " " + urlPath(requests[i].url)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// urlPath returns the path of rawURL, leaving out the host and a query that
+// may carry secrets
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return rawURL
+	}
+	return u.Path
+}
+
+// stepGuard follows each curl command but the last of a file, ending the
+// execution with curl's exit code when it failed
+const stepGuard = "(exit $?) || exit"
+
+// stepHeadersVar holds the path of the file the guarded curl commands dump
+// their response headers to, for stepStatusGuard to read their status from.
+// execShellCommand assigns it a file of the execution's own
+const stepHeadersVar = "__curly_step_headers"
+
+// stepStatusGuard follows stepGuard when failOn has patterns, ending the
+// execution like curl's --fail does when the status of the command is one
+// of them
+func stepStatusGuard(failOn []statusPattern) string {
+	cases := make([]string, len(failOn))
+	for i, p := range failOn {
+		cases[i] = strings.ReplaceAll(string(p), "x", "?")
+	}
+	status := `"$(sed -n 's/^HTTP\/[^ ]* \([0-9][0-9][0-9]\).*/\1/p' "$` + stepHeadersVar + `" | tail -n 1)"`
+	return "case " + status + " in " + strings.Join(cases, "|") + ") exit 22 ;; esac"
+}
+
+// injectStepGuards makes the curl commands of content stop the execution when
+// one of them fails, or gets a status matching failOn, rather than running
+// the rest. A command continued by a pipe or && onto the next line is left
+// alone, like the last one, and so is the status of one dumping its headers
+// itself
+func injectStepGuards(content string, failOn []statusPattern) string {
+	lines := strings.Split(content, "\n")
+	commands := run.FindCurlCommands(lines)
+	if len(commands) < 2 {
+		return content
+	}
+	var out []string
+	next := 0
+	for _, cmd := range commands[:len(commands)-1] {
+		last := commandLastLine(lines, cmd)
+		trimmed := strings.TrimSpace(lines[cmd.End])
+		if strings.HasSuffix(trimmed, "|") || strings.HasSuffix(trimmed, "&&") || strings.HasSuffix(trimmed, "||") {
+			continue
+		}
+		guards := []string{stepGuard}
+		if len(failOn) > 0 && !dumpsHeaders(lines[cmd.Start:cmd.End+1]) {
+			insertCurlArgs(lines, cmd, `-D "$`+stepHeadersVar+`"`)
+			guards = append(guards, stepStatusGuard(failOn))
+		}
+		out = append(out, lines[next:last+1]...)
+		out = append(out, guards...)
+		next = last + 1
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, "\n")
+}
+
+// dumpsHeaders reports whether the lines of a curl command pass -D or
+// --dump-header
+func dumpsHeaders(lines []string) bool {
+	for _, line := range lines {
+		for _, word := range strings.Fields(line) {
+			if word == "-D" || word == "--dump-header" || strings.HasPrefix(word, "--dump-header=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandLastLine returns the last line of cmd in lines, that of the end of
+// its heredoc when it has one
+func commandLastLine(lines []string, cmd run.CurlCommand) int {
+	var text strings.Builder
+	for _, line := range lines[cmd.Start : cmd.End+1] {
+		text.WriteString(line + "\n")
+	}
+	match := run.HeredocPattern.FindStringSubmatch(text.String())
+	if match == nil {
+		return cmd.End
+	}
+	for i := cmd.End + 1; i < len(lines); i++ {
+		line := lines[i]
+		if match[1] == "-" {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == match[2] {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestFileSteps(t *testing.T) {
+	cmdText := `BASE_URL="https://api.example.com"
+ID="42"
+curl -s -X POST "${BASE_URL}/users?api_key=s3cret" \
+  --data-binary @- <<'EOF'
+curl -s "${BASE_URL}/not-a-step"
+EOF
+curl -s "${BASE_URL}/users/${ID}" | jq .
+curl -s -X DELETE "${BASE_URL}/users/${ID}"`
+
+	want := []run.Step{
+		{Name: "POST /users", Reports: true},
+		{Name: "GET /users/42", Reports: false},
+		{Name: "DELETE /users/42", Reports: true},
+	}
+	if got := fileSteps(cmdText); !reflect.DeepEqual(got, want) {
+		t.Errorf("fileSteps() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInjectStepGuards(t *testing.T) {
+	failOn := []statusPattern{"4xx", "503"}
+	dump := `-D "$` + stepHeadersVar + `"`
+	tests := []struct {
+		name    string
+		content string
+		failOn  []statusPattern
+		want    string
+	}{
+		{
+			name:    "single command",
+			content: "ID=1\ncurl -s x",
+			want:    "ID=1\ncurl -s x",
+		},
+		{
+			name:    "every command but the last",
+			content: "ID=1\ncurl -s -X POST \\\n  x\necho created\ncurl -s y\ncurl -s z",
+			want:    "ID=1\ncurl -s -X POST \\\n  x\n" + stepGuard + "\necho created\ncurl -s y\n" + stepGuard + "\ncurl -s z",
+		},
+		{
+			name:    "after the heredoc",
+			content: "curl -s -d @- x <<-EOF\n\t{\"curl\": true}\n\tEOF\ncurl -s y",
+			want:    "curl -s -d @- x <<-EOF\n\t{\"curl\": true}\n\tEOF\n" + stepGuard + "\ncurl -s y",
+		},
+		{
+			name:    "not into a pipe",
+			content: "curl -s x |\n  jq .id\ncurl -s y",
+			want:    "curl -s x |\n  jq .id\ncurl -s y",
+		},
+		{
+			name:    "failing statuses",
+			content: "curl -s -X POST \\\n  x\ncurl -s y",
+			failOn:  failOn,
+			want:    "curl " + dump + " -s -X POST \\\n  x\n" + stepGuard + "\n" + stepStatusGuard(failOn) + "\ncurl -s y",
+		},
+		{
+			name:    "failing statuses of a command dumping its headers",
+			content: "curl -s -D headers.txt x\ncurl -s y",
+			failOn:  failOn,
+			want:    "curl -s -D headers.txt x\n" + stepGuard + "\ncurl -s y",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectStepGuards(tt.content, tt.failOn); got != tt.want {
+				t.Errorf("injectStepGuards() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiStepExecution(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.URL.Path != "/users/42" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	// Nothing listens on the port of a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	failOn := []statusPattern{"4xx"}
+	tests := []struct {
+		name      string
+		cmdText   string
+		keepGoing bool
+		failOn    []statusPattern
+		wantErr   bool
+		want      []run.StepStats
+	}{
+		{
+			name:    "steps share variables",
+			cmdText: "ID=\"42\"\ncurl -s -X POST \"" + server.URL + "/users\"\ncurl -s \"" + server.URL + "/users/${ID}\"",
+			want: []run.StepStats{
+				{Step: run.Step{Name: "POST /users", Reports: true}, Runs: 3, StatusCodes: map[int]int{201: 3}},
+				{Step: run.Step{Name: "GET /users/42", Reports: true}, Runs: 3, StatusCodes: map[int]int{200: 3}},
+			},
+		},
+		{
+			name:    "a failing step stops the rest",
+			cmdText: "curl -s \"" + closed.URL + "/users\"\ncurl -s \"" + server.URL + "/users/42\"",
+			wantErr: true,
+			want: []run.StepStats{
+				{Step: run.Step{Name: "GET /users", Reports: true}, Runs: 3, StatusCodes: map[int]int{}},
+				{Step: run.Step{Name: "GET /users/42", Reports: true}, StatusCodes: map[int]int{}},
+			},
+		},
+		{
+			name:    "a step getting a failing status stops the rest",
+			cmdText: "curl -s \"" + server.URL + "/users/7\"\ncurl -s -X POST \"" + server.URL + "/users\"",
+			failOn:  failOn,
+			wantErr: true,
+			want: []run.StepStats{
+				{Step: run.Step{Name: "GET /users/7", Reports: true}, Runs: 3, StatusCodes: map[int]int{404: 3}},
+				{Step: run.Step{Name: "POST /users", Reports: true}, StatusCodes: map[int]int{}},
+			},
+		},
+		{
+			name:    "statuses not failing the run don't stop it",
+			cmdText: "curl -s \"" + server.URL + "/users/7\"\ncurl -s -X POST \"" + server.URL + "/users\"",
+			failOn:  []statusPattern{"5xx"},
+			want: []run.StepStats{
+				{Step: run.Step{Name: "GET /users/7", Reports: true}, Runs: 3, StatusCodes: map[int]int{404: 3}},
+				{Step: run.Step{Name: "POST /users", Reports: true}, Runs: 3, StatusCodes: map[int]int{201: 3}},
+			},
+		},
+		{
+			name:      "keep going",
+			cmdText:   "curl -s \"" + closed.URL + "/users\"\ncurl -s \"" + server.URL + "/users/42\"",
+			keepGoing: true,
+			want: []run.StepStats{
+				{Step: run.Step{Name: "GET /users", Reports: true}, Runs: 3, StatusCodes: map[int]int{}},
+				{Step: run.Step{Name: "GET /users/42", Reports: true}, Runs: 3, StatusCodes: map[int]int{200: 3}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := execCmd(tt.cmdText, execOptions{times: 3, quiet: true, keepGoing: tt.keepGoing, failOn: tt.failOn, maxFailures: 3})
+			if gotErr := err != nil || stats.Failed > 0; gotErr != tt.wantErr {
+				t.Errorf("execCmd() error = %v, %d failed, want failures %v", err, stats.Failed, tt.wantErr)
+			}
+			if !reflect.DeepEqual(stats.Steps, tt.want) {
+				t.Errorf("execCmd() steps = %+v, want %+v", stats.Steps, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsReportSteps(t *testing.T) {
+	steps := []run.StepStats{
+		{Step: run.Step{Name: "POST /users", Reports: true}, Runs: 10, StatusCodes: map[int]int{201: 9, 500: 1},
+			Totals: []time.Duration{20 * time.Millisecond, 40 * time.Millisecond}},
+		{Step: run.Step{Name: "GET /users/42", Reports: true}, Runs: 9, StatusCodes: map[int]int{200: 9}},
+		{Step: run.Step{Name: "DELETE /users/42"}},
+	}
+
+	report := newStatsReport(&run.ExecutionStats{Steps: steps})
+	var csv bytes.Buffer
+	if err := writeStatsCSV(&csv, report); err != nil {
+		t.Fatalf("writeStatsCSV() error = %v", err)
+	}
+	for _, row := range []string{"step,1,POST /users\n", "step_runs,2,9\n", "step_status,1:500,1\n"} {
+		if !strings.Contains(csv.String(), row) {
+			t.Errorf("writeStatsCSV() =\n%s\nwant a row %q", csv.String(), row)
+		}
+	}
+}
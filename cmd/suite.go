@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ErikVib/curly/internal/output"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// defaultSuiteExpectations are checked for files that declare none
+var defaultSuiteExpectations = expectations{statuses: []statusPattern{"2xx"}}
+
+// suiteOptions selects and orders the files curly test runs
+type suiteOptions struct {
+	// tags keeps the files tagged with one of them
+	tags []string
+	// match keeps the files whose path in the collection matches this glob
+	match string
+	// order is a suite.yml listing the files to run first, in its order
+	order string
+}
+
+// suiteFile is a suite.yml, listing files of the collection in the order
+// they should run
+type suiteFile struct {
+	Files []string `yaml:"files"`
+}
+
+// suiteTest is a .curl file of the suite
+type suiteTest struct {
+	// name is the path of the file in the collection
+	name string
+	path string
+	// skip is why the file is skipped, if it is
+	skip string
+}
+
+func NewTestCmd() *cobra.Command {
+	var opts runOptions
+	var suite suiteOptions
+	var vars []string
+	var yes bool
+	var report string
+	var reportFormat string
+	var logFile string
+	var specFile string
+
+	cmd := &cobra.Command{
+		Use:          "test [collection-dir]",
+		Short:        "Run every .curl file of a collection and check its expectations",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+
+			if report != "" {
+				var err error
+				if reportFormat, err = resolveReportFormat(report, reportFormat); err != nil {
+					return err
+				}
+			}
+
+			overrides, err := run.ParseVarOverrides(vars)
+			if err != nil {
+				return err
+			}
+			opts.overrides = overrides
+
+			tests, err := collectSuite(dir, suite)
+			if err != nil {
+				return err
+			}
+			if specFile != "" {
+				if opts.spec, err = newSpecValidator(specFile); err != nil {
+					return err
+				}
+			}
+			// Ctrl+C stops the running test's curls too, which run in their
+			// own process group
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			opts.audit = openAuditLog(logFile, auditDetailIteration)
+			defer opts.audit.Close()
+			run, err := runSuite(ctx, output.New(cmd.OutOrStdout(), output.Enabled(os.Stdout)), dir, tests, opts, !yes && isTerminal(os.Stdin))
+			if report != "" && run != nil {
+				err = errors.Join(err, writeSuiteReport(report, reportFormat, run))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().VarP(newEnvFlag(&opts.envName), "env", "e", "Environment name to use from envs.yml, repeatable to layer environments, later ones overriding earlier ones")
+	cmd.Flags().BoolVar(&opts.noAuthCache, "no-auth-cache", false, "Fetch a new token for the environment's auth block instead of using the cached one")
+	cmd.Flags().StringVar(&opts.envFile, "env-file", "", "Read variables from this .env file instead of the collection's .env")
+	cmd.Flags().StringVar(&opts.envsFile, "envs-file", "", "Read the environments from this file instead of the envs.yml nearest to each file run")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Override a variable assigned in the files, as KEY=VALUE; takes precedence over envs.yml (repeatable)")
+	cmd.Flags().BoolVarP(&opts.insecure, "insecure", "k", false, "Skip SSL certificate verification (adds -k to ALL curls in the files)")
+	cmd.Flags().StringArrayVar(&suite.tags, "tag", nil, "Only run files with this tag in a \"# tags:\" comment (repeatable)")
+	cmd.Flags().StringVar(&suite.match, "match", "", "Only run files whose path in the collection matches this glob, like 'users/GET_*'")
+	cmd.Flags().StringVar(&suite.order, "suite", "", "Run the files listed in this suite.yml first, in its order, then the rest alphabetically")
+	cmd.Flags().StringVar(&opts.session, "session", "", "Keep cookies across the files and runs in the cookie jar of this named session")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run DELETE requests without asking for confirmation")
+	cmd.Flags().StringVar(&report, "report", "", "Write a report of the run to this file, as JUnit XML or JSON for a .json file")
+	cmd.Flags().StringVar(&reportFormat, "report-format", "", "Format of --report: junit or json (default: from the file extension)")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Append a JSON line per request, with the file, environment, redacted URL, status and result, to this audit log (default: $CURLY_LOG_FILE)")
+	cmd.Flags().StringVar(&specFile, "validate-spec", "", "Fail tests whose response has a status or JSON body the operation of this OpenAPI YAML/JSON doesn't declare")
+
+	cmd.ValidArgsFunction = completeDirAt(0)
+	cmd.RegisterFlagCompletionFunc("env", completeEnvironments(0))
+	cmd.RegisterFlagCompletionFunc("tag", completeTags(0))
+
+	return cmd
+}
+
+// collectSuite finds the .curl files of the collection in dir that opts
+// selects, in the order they run
+func collectSuite(dir string, opts suiteOptions) ([]suiteTest, error) {
+	var names []string
+	err := run.WalkCurlFiles(dir, func(path string) error {
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if opts.order != "" {
+		if names, err = orderSuite(names, opts.order); err != nil {
+			return nil, err
+		}
+	}
+
+	var tests []suiteTest
+	for _, name := range names {
+		if opts.match != "" {
+			matched, err := filepath.Match(opts.match, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --match pattern: %w", err)
+			}
+			if !matched {
+				continue
+			}
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		skip, tags := suiteDirectives(string(content))
+		if len(opts.tags) > 0 && !hasAnyTag(tags, opts.tags) {
+			continue
+		}
+		tests = append(tests, suiteTest{name: name, path: path, skip: skip})
+	}
+	if len(tests) == 0 {
+		return nil, errors.New("no .curl files to test")
+	}
+	return tests, nil
+}
+
+// orderSuite moves the files listed in the suite.yml at path to the front of
+// names, in the order listed
+func orderSuite(names []string, path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+	var suite suiteFile
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	remaining := map[string]bool{}
+	for _, name := range names {
+		remaining[name] = true
+	}
+	var ordered []string
+	for _, name := range suite.Files {
+		name = filepath.ToSlash(filepath.Clean(name))
+		if !remaining[name] {
+			return nil, fmt.Errorf("%s lists %s, which isn't a .curl file of the collection or is listed twice", path, name)
+		}
+		ordered = append(ordered, name)
+		delete(remaining, name)
+	}
+	for _, name := range names {
+		if remaining[name] {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered, nil
+}
+
+// suiteDirectives reads the "# skip" and "# tags:" comments of a .curl file.
+// skip is the reason given after "skip:", or "skipped" without one
+func suiteDirectives(content string) (skip string, tags []string) {
+	for _, line := range strings.Split(content, "\n") {
+		comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+		if !ok {
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimSpace(comment), ":")
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "skip":
+			skip = "skipped"
+			if value != "" {
+				skip = value
+			}
+		case "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return skip, tags
+}
+
+// hasAnyTag reports whether tags holds one of wanted
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if strings.EqualFold(tag, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// suiteResult is how a test of the suite went
+type suiteResult struct {
+	name string
+	// skip is why the test was skipped, if it was
+	skip string
+	// status is the HTTP status of the last response, 0 without one
+	status int
+	took   time.Duration
+	// failure is why the test failed, if it did, and body the start of the
+	// last response body then
+	failure string
+	body    string
+}
+
+// suiteRun is how a whole run of the suite went
+type suiteRun struct {
+	// name is the name of the collection
+	name                    string
+	start                   time.Time
+	took                    time.Duration
+	passed, failed, skipped int
+	results                 []suiteResult
+}
+
+// runSuite runs tests one after the other, printing a line on how each went
+// as it finishes and a summary to out, in color when out is an output.Writer
+// that colors, and fails when any test did. With
+// confirm, DELETE requests are confirmed once for the whole suite. The run is
+// returned once the tests ran, failed or not
+func runSuite(ctx context.Context, out io.Writer, dir string, tests []suiteTest, opts runOptions, confirm bool) (*suiteRun, error) {
+	type prepared struct {
+		cmdText string
+		expect  expectations
+	}
+	runs := make([]prepared, len(tests))
+	var all []string
+	for i, test := range tests {
+		if test.skip != "" {
+			continue
+		}
+		cmdText, err := runFile(test.path, dir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", test.name, err)
+		}
+		expect, err := fileExpectations(test.path)
+		if err != nil {
+			return nil, err
+		}
+		if expect.empty() {
+			expect = defaultSuiteExpectations
+		}
+		if err := expect.checkJQ(); err != nil {
+			return nil, fmt.Errorf("%s: %w", test.name, err)
+		}
+		runs[i] = prepared{cmdText: cmdText, expect: expect}
+		all = append(all, cmdText)
+	}
+	if confirm {
+		if err := confirmRun(os.Stdin, os.Stderr, strings.Join(all, "\n"), opts.envName, 1, false); err != nil {
+			return nil, err
+		}
+	}
+
+	width := 0
+	for _, test := range tests {
+		width = max(width, len(test.name))
+	}
+
+	name := dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = filepath.Base(abs)
+	}
+	o := output.From(out)
+	run := &suiteRun{name: name, start: time.Now()}
+	for i, test := range tests {
+		if test.skip != "" {
+			run.skipped++
+			run.results = append(run.results, suiteResult{name: test.name, skip: test.skip})
+			fmt.Fprintf(out, "%s  %-*s  %s\n", o.Warning("SKIP"), width, test.name, test.skip)
+			continue
+		}
+
+		begin := time.Now()
+		result, err := execShellCommand(ctx, injectStatusWriteOut(injectStepGuards(runs[i].cmdText, nil)), 1, execOptions{quiet: true, expect: runs[i].expect, keepOutput: true})
+		took := time.Since(begin).Round(time.Millisecond)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		body := lastResponseBody(result.output)
+		if err == nil {
+			err = runs[i].expect.check(result.statuses, body)
+		}
+		if err == nil {
+			err = opts.spec.check(ctx, runs[i].cmdText, result)
+		}
+		opts.audit.request(runs[i].cmdText, test.path, opts.envName).logExecution(1, took, result.statuses, err)
+		r := suiteResult{name: test.name, took: took}
+		status := "---"
+		if len(result.statuses) > 0 {
+			r.status = result.statuses[len(result.statuses)-1]
+			status = strconv.Itoa(r.status)
+		}
+		if err != nil {
+			run.failed++
+			r.failure, r.body = err.Error(), truncateBody(body)
+			fmt.Fprintf(out, "%s  %-*s  %s  %8s  %v\n", o.Failure("FAIL"), width, test.name, status, took, err)
+		} else {
+			run.passed++
+			fmt.Fprintf(out, "%s  %-*s  %s  %8s\n", o.Success("PASS"), width, test.name, status, took)
+		}
+		run.results = append(run.results, r)
+	}
+	run.took = time.Since(run.start)
+
+	passed, failed := fmt.Sprintf("%d passed", run.passed), fmt.Sprintf("%d failed", run.failed)
+	if run.passed > 0 {
+		passed = o.Success(passed)
+	}
+	if run.failed > 0 {
+		failed = o.Failure(failed)
+	}
+	fmt.Fprintf(out, "\n%s, %s, %d skipped in %s\n", passed, failed, run.skipped, run.took.Round(time.Millisecond))
+	if run.failed > 0 {
+		return run, fmt.Errorf("%d of %d tests failed", run.failed, run.passed+run.failed)
+	}
+	return run, nil
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+// writeFiles writes files, content by slash-separated path, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectSuite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"GET_health.curl":         "# tags: smoke\ncurl -s x\n",
+		"users/GET_users.curl":    "# tags: smoke, users\ncurl -s x\n",
+		"users/DELETE_users.curl": "# skip: destroys data\ncurl -s -X DELETE x\n",
+		"POST_login.curl":         "curl -s x\n",
+		"notes.txt":               "not a request",
+	})
+	suitePath := filepath.Join(dir, "suite.yml")
+	if err := os.WriteFile(suitePath, []byte("files:\n  - POST_login.curl\n  - ./users/GET_users.curl\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts suiteOptions
+		want []string
+	}{
+		{name: "alphabetical", want: []string{"GET_health.curl", "POST_login.curl", "users/DELETE_users.curl", "users/GET_users.curl"}},
+		{name: "by tag", opts: suiteOptions{tags: []string{"SMOKE"}}, want: []string{"GET_health.curl", "users/GET_users.curl"}},
+		{name: "by glob", opts: suiteOptions{match: "users/GET_*"}, want: []string{"users/GET_users.curl"}},
+		{name: "suite order first", opts: suiteOptions{order: suitePath}, want: []string{"POST_login.curl", "users/GET_users.curl", "GET_health.curl", "users/DELETE_users.curl"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suite, err := collectSuite(dir, tt.opts)
+			if err != nil {
+				t.Fatalf("collectSuite() error = %v", err)
+			}
+			var names []string
+			for _, test := range suite {
+				names = append(names, test.name)
+				if test.name == "users/DELETE_users.curl" && test.skip != "destroys data" {
+					t.Errorf("skip = %q, want the reason from the comment", test.skip)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("collectSuite() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	if err := os.WriteFile(suitePath, []byte("files:\n  - missing.curl\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collectSuite(dir, suiteOptions{order: suitePath}); err == nil || !strings.Contains(err.Error(), "missing.curl") {
+		t.Errorf("collectSuite() with an unknown file in the suite error = %v, want one naming it", err)
+	}
+	if _, err := collectSuite(dir, suiteOptions{tags: []string{"none"}}); err == nil {
+		t.Errorf("collectSuite() selecting nothing should fail")
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/degraded":
+			w.Write([]byte(`{"status":"degraded"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"envs.yml":          "environments:\n  staging:\n    BASE_URL: \"" + server.URL + "\"\n",
+		"GET_health.curl":   "# expect-body-contains: \"status\":\"ok\"\nBASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/health\"\n",
+		"GET_degraded.curl": "# expect-body-contains: \"status\":\"ok\"\nBASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/degraded\"\n",
+		"GET_missing.curl":  "BASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/missing\"\n",
+		"GET_skipped.curl":  "# skip\nBASE_URL=\"http://localhost:1\"\ncurl -s \"${BASE_URL}/missing\"\n",
+	})
+
+	suite, err := collectSuite(dir, suiteOptions{})
+	if err != nil {
+		t.Fatalf("collectSuite() error = %v", err)
+	}
+	var out bytes.Buffer
+	run, err := runSuite(context.Background(), &out, dir, suite, runOptions{envName: "staging"}, false)
+	if err == nil || err.Error() != "2 of 3 tests failed" {
+		t.Errorf("runSuite() error = %v, want 2 of 3 tests failed", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`FAIL  GET_degraded.curl  200`,
+		`PASS  GET_health.curl    200`,
+		`FAIL  GET_missing.curl   404`,
+		`SKIP  GET_skipped.curl   skipped`,
+		``,
+		`1 passed, 2 failed, 1 skipped in`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("runSuite() printed:\n%s", out.String())
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want it to start with %q", i, lines[i], prefix)
+		}
+	}
+	if !strings.Contains(lines[0], `expected body containing "\"status\":\"ok\""`) || !strings.Contains(lines[2], "expected status 2xx, got 404") {
+		t.Errorf("failures don't say what was expected:\n%s", out.String())
+	}
+
+	if run == nil || len(run.results) != 4 {
+		t.Fatalf("runSuite() run = %+v, want 4 results", run)
+	}
+	if got := run.results[0]; got.status != 200 || got.body != `{"status":"degraded"}` {
+		t.Errorf("failed result = %+v, want the status and body", got)
+	}
+
+	var colored bytes.Buffer
+	runSuite(context.Background(), output.New(&colored, true), dir, suite, runOptions{envName: "staging"}, false)
+	for _, want := range []string{
+		output.Red + "FAIL" + output.Reset + "  GET_degraded.curl",
+		output.Green + "PASS" + output.Reset + "  GET_health.curl",
+		output.Yellow + "SKIP" + output.Reset + "  GET_skipped.curl",
+		output.Green + "1 passed" + output.Reset + ", " + output.Red + "2 failed" + output.Reset + ", 1 skipped",
+	} {
+		if !strings.Contains(colored.String(), want) {
+			t.Errorf("runSuite() in color printed:\n%q\nwant %q", colored.String(), want)
+		}
+	}
+}
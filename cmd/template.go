@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templatePattern matches the template tokens expanded in each request:
+// {{uuid}}, {{seq}}, {{timestamp}}, {{randint MIN MAX}} and {{randstr N}}.
+// Other text between braces, like that of JSON bodies, is left alone
+var templatePattern = regexp.MustCompile(`\{\{\s*(?:(uuid|seq|timestamp)|randint\s+(-?\d+)\s+(-?\d+)|randstr\s+(\d+))\s*\}\}`)
+
+// randstrLetters are the letters of {{randstr N}}
+const randstrLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// maxRandstr caps N of {{randstr N}}
+const maxRandstr = 4096
+
+// templateSeed makes the random values of the template tokens reproducible
+// when set, by --seed
+type templateSeed struct {
+	seed uint64
+	set  bool
+}
+
+// random returns the source of the random values of iteration: derived from
+// the seed and the iteration when seeded, so runs repeat whatever order the
+// iterations run in, or else random
+func (s templateSeed) random(iteration int) *rand.Rand {
+	if s.set {
+		return rand.New(rand.NewPCG(s.seed, uint64(iteration)))
+	}
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// templates expands the template tokens of the texts of one request, each
+// token its own value, drawn from r
+type templates struct {
+	iteration int
+	r         *rand.Rand
+	now       time.Time
+}
+
+func newTemplates(iteration int, seed templateSeed) *templates {
+	return &templates{iteration: iteration, r: seed.random(iteration), now: time.Now()}
+}
+
+// expand replaces the template tokens of s
+func (t *templates) expand(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return templatePattern.ReplaceAllStringFunc(s, func(token string) string {
+		m := templatePattern.FindStringSubmatch(token)
+		switch {
+		case m[1] == "uuid":
+			return t.uuid()
+		case m[1] == "seq":
+			return strconv.Itoa(t.iteration)
+		case m[1] == "timestamp":
+			return strconv.FormatInt(t.now.Unix(), 10)
+		case m[2] != "":
+			lo, errLo := strconv.ParseInt(m[2], 10, 64)
+			hi, errHi := strconv.ParseInt(m[3], 10, 64)
+			if errLo != nil || errHi != nil || hi < lo || hi-lo+1 <= 0 {
+				return token
+			}
+			return strconv.FormatInt(lo+t.r.Int64N(hi-lo+1), 10)
+		default:
+			n, err := strconv.Atoi(m[4])
+			if err != nil || n > maxRandstr {
+				return token
+			}
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = randstrLetters[t.r.IntN(len(randstrLetters))]
+			}
+			return string(b)
+		}
+	})
+}
+
+// uuid returns a random version 4 UUID
+func (t *templates) uuid() string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(t.r.Uint32())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// expandRequest returns a copy of req with the template tokens of its URL,
+// headers, credentials and body expanded
+func (t *templates) expandRequest(req *nativeRequest) *nativeRequest {
+	expanded := *req
+	expanded.url = t.expand(req.url)
+	expanded.host = t.expand(req.host)
+	expanded.user = t.expand(req.user)
+	expanded.password = t.expand(req.password)
+	if req.body != nil {
+		expanded.body = []byte(t.expand(string(req.body)))
+	}
+	expanded.header = req.header.Clone()
+	for name, values := range expanded.header {
+		for i, v := range values {
+			values[i] = t.expand(v)
+		}
+		expanded.header[name] = values
+	}
+	return &expanded
+}
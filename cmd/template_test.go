@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTemplatesExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "uuid", text: `{"id": "{{uuid}}"}`, want: `^\{"id": "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"\}$`},
+		{name: "seq", text: "user-{{seq}}", want: `^user-7$`},
+		{name: "timestamp", text: "{{ timestamp }}", want: `^\d{10}$`},
+		{name: "randint", text: "{{randint 5 6}}", want: `^[56]$`},
+		{name: "negative randint", text: "{{randint -3 -3}}", want: `^-3$`},
+		{name: "randstr", text: "{{randstr 8}}", want: `^[a-zA-Z0-9]{8}$`},
+		{name: "empty range", text: "{{randint 6 5}}", want: `^\{\{randint 6 5\}\}$`},
+		{name: "unknown token", text: "{{name}}", want: `^\{\{name\}\}$`},
+		{name: "JSON braces", text: `[{{"a": 1}}]`, want: `^\[\{\{"a": 1\}\}\]$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newTemplates(7, templateSeed{}).expand(tt.text)
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("expand(%q) = %q, want it to match %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatesSeed(t *testing.T) {
+	text := "{{uuid}} {{randint 1 1000000}} {{randstr 16}}"
+	expand := func(seed templateSeed, iteration int) string {
+		return newTemplates(iteration, seed).expand(text)
+	}
+
+	seeded := templateSeed{seed: 42, set: true}
+	// Iterations repeat whatever order they run in
+	second := expand(seeded, 2)
+	first := expand(seeded, 1)
+	if got := expand(seeded, 1); got != first {
+		t.Errorf("seed 42 gave %q, then %q", first, got)
+	}
+	if got := expand(seeded, 2); got != second {
+		t.Errorf("seed 42 gave %q for iteration 2, then %q", second, got)
+	}
+	if first == second {
+		t.Errorf("iterations 1 and 2 both got %q", first)
+	}
+	if got := expand(templateSeed{seed: 43, set: true}, 1); got == first {
+		t.Errorf("seeds 42 and 43 both gave %q", got)
+	}
+	if expand(templateSeed{}, 1) == expand(templateSeed{}, 1) {
+		t.Error("two unseeded expansions gave the same values")
+	}
+}
+
+func TestTemplatesPerIteration(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cmdText := "ID=\"{{uuid}}\"\ncurl -s -X POST \"" + server.URL + "/users\" --data-binary @- <<EOF\n{\"id\": \"${ID}\", \"seq\": {{seq}}}\nEOF"
+	for _, native := range []bool{false, true} {
+		t.Run("native="+strconv.FormatBool(native), func(t *testing.T) {
+			mu.Lock()
+			bodies = nil
+			mu.Unlock()
+			if _, err := execCmd(cmdText, execOptions{times: 50, parallel: 8, quiet: true, native: native}); err != nil {
+				t.Fatalf("execCmd() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			seen := map[string]bool{}
+			seqs := map[string]bool{}
+			pattern := regexp.MustCompile(`^\{"id": "([0-9a-f-]{36})", "seq": (\d+)\}\n?$`)
+			for _, body := range bodies {
+				m := pattern.FindStringSubmatch(body)
+				if m == nil {
+					t.Fatalf("body %q isn't expanded", body)
+				}
+				seen[m[1]], seqs[m[2]] = true, true
+			}
+			if len(bodies) != 50 || len(seen) != 50 || len(seqs) != 50 {
+				t.Errorf("%d requests with %d ids and %d seqs, want 50 of each", len(bodies), len(seen), len(seqs))
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+# Exported by curly from testdata/export, environment staging
+#
+# Usage: make -f api.mk <endpoint> [NAME=value ...]
+# The NAME=value parameters override the variables of the endpoint
+
+SHELL := /bin/sh
+.ONESHELL:
+.SILENT:
+comma := ,
+
+.PHONY: help get_health billing_get_users users_get_users post_users
+
+help:
+	echo "Endpoints:"
+	echo "  get_health         GET /health - Check the service is up"
+	echo "  billing_get_users  GET /billing/users"
+	echo "  users_get_users    GET /users - List the users"
+	echo "  post_users         POST /users - Create a user"
+
+# GET /health - Check the service is up (GET_health.curl)
+get_health:
+	$(if $(filter command line,$(origin BASE_URL)),,BASE_URL="https://staging.example.com")
+	curl -s "$${BASE_URL}/health"
+
+# GET /billing/users (billing/GET_users.curl)
+billing_get_users:
+	$(if $(filter command line,$(origin BASE_URL)),,BASE_URL="https://staging.example.com")
+	curl -s "$${BASE_URL}/billing/users"
+
+# GET /users - List the users (users/GET_users.curl)
+users_get_users:
+	$(if $(filter command line,$(origin BASE_URL)),,BASE_URL="https://staging.example.com")
+	: "$${API_KEY:?pass API_KEY=value or set it in the environment}"
+	$(if $(filter command line,$(origin LIMIT)),,LIMIT="20")
+	curl -s "$${BASE_URL}/users?limit=$${LIMIT}" \
+	  -H "X-Api-Key: $${API_KEY}" \
+	  -H "X-Trace: $${TRACE_ID:-none}"
+
+# POST /users - Create a user (users/POST_users.curl)
+post_users:
+	$(if $(filter command line,$(origin BASE_URL)),,BASE_URL="https://staging.example.com")
+	: "$${API_KEY:?pass API_KEY=value or set it in the environment}"
+	$(if $(filter command line,$(origin NAME)),,NAME="Ada$(comma) Lovelace")
+	curl -s -X POST "$${BASE_URL}/users" \
+	  -H "X-Api-Key: $${API_KEY}" \
+	  -H "Content-Type: application/json" \
+	  --data-binary @- <<'JSON'
+	{
+	  "name": "$${NAME}",
+	  "price": "$$5"
+	}
+	JSON
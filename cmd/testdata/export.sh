@@ -0,0 +1,86 @@
+#!/bin/sh
+# Exported by curly from testdata/export, environment staging
+#
+# Usage: ./api.sh <endpoint> [NAME=value ...]
+# The NAME=value parameters override the variables of the endpoint
+
+# curly_param reports whether the variable $1 was passed as a parameter
+curly_param() {
+  case " $curly_params " in
+    *" $1 "*) return 0 ;;
+  esac
+  return 1
+}
+
+# GET /health - Check the service is up (GET_health.curl)
+get_health() (
+  curly_param BASE_URL || BASE_URL="https://staging.example.com"
+  curl -s "${BASE_URL}/health"
+)
+
+# GET /billing/users (billing/GET_users.curl)
+billing_get_users() (
+  curly_param BASE_URL || BASE_URL="https://staging.example.com"
+  curl -s "${BASE_URL}/billing/users"
+)
+
+# GET /users - List the users (users/GET_users.curl)
+users_get_users() (
+  curly_param BASE_URL || BASE_URL="https://staging.example.com"
+  curly_param API_KEY || API_KEY="staging-key"
+  curly_param LIMIT || LIMIT="20"
+  curl -s "${BASE_URL}/users?limit=${LIMIT}" \
+    -H "X-Api-Key: ${API_KEY}" \
+    -H "X-Trace: ${TRACE_ID:-none}"
+)
+
+# POST /users - Create a user (users/POST_users.curl)
+post_users() (
+  curly_param BASE_URL || BASE_URL="https://staging.example.com"
+  curly_param API_KEY || API_KEY="staging-key"
+  curly_param NAME || NAME="Ada, Lovelace"
+  curl -s -X POST "${BASE_URL}/users" \
+    -H "X-Api-Key: ${API_KEY}" \
+    -H "Content-Type: application/json" \
+    --data-binary @- <<'JSON'
+{
+  "name": "${NAME}",
+  "price": "$5"
+}
+JSON
+)
+
+curly_usage() {
+  echo "Usage: $0 <endpoint> [NAME=value ...]"
+  echo
+  echo "Endpoints:"
+  echo "  get_health         GET /health - Check the service is up"
+  echo "  billing_get_users  GET /billing/users"
+  echo "  users_get_users    GET /users - List the users"
+  echo "  post_users         POST /users - Create a user"
+}
+
+if [ $# -eq 0 ]; then
+  curly_usage >&2
+  exit 2
+fi
+curly_endpoint=$1
+shift
+curly_params=
+for curly_arg in "$@"; do
+  case $curly_arg in
+    *=*) ;;
+    *) echo "$0: invalid parameter $curly_arg, expected NAME=value" >&2; exit 2 ;;
+  esac
+  curly_name=${curly_arg%%=*}
+  case $curly_name in
+    ''|[0-9]*|*[!A-Za-z0-9_]*) echo "$0: invalid parameter name $curly_name" >&2; exit 2 ;;
+  esac
+  eval "$curly_name=\${curly_arg#*=}"
+  curly_params="$curly_params $curly_name"
+done
+case $curly_endpoint in
+  get_health|billing_get_users|users_get_users|post_users) "$curly_endpoint" ;;
+  -h|--help|help) curly_usage ;;
+  *) echo "$0: unknown endpoint $curly_endpoint" >&2; curly_usage >&2; exit 2 ;;
+esac
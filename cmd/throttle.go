@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryAfterField is the field withRetryAfter adds to the status line, the
+// Retry-After header of the response, quoted as an HTTP date has spaces.
+// %header needs curl 7.84 or later
+const retryAfterField = ` retry-after="%header{retry-after}"`
+
+// maxRetryAfter is the length of the longest Retry-After a status line can
+// carry
+const maxRetryAfter = 64
+
+// withRetryAfter adds retryAfterField to writeOut, statusWriteOut or
+// timingWriteOut, ahead of the Content-Type
+func withRetryAfter(writeOut string) string {
+	return strings.Replace(writeOut, " %{content_type}", retryAfterField+" %{content_type}", 1)
+}
+
+// throttleBackoff is how long a worker pauses after a throttled response
+// without a Retry-After, doubled for each one in a row up to maxThrottleBackoff
+var throttleBackoff = time.Second
+
+// maxThrottleBackoff caps the pauses of throttleBackoff
+const maxThrottleBackoff = 30 * time.Second
+
+// throttledError ends an execution whose response was throttled, for the
+// worker running it to pause before its next one
+type throttledError struct {
+	status int
+	// retryAfter is how long the response's Retry-After asked to wait, when
+	// hasRetryAfter
+	retryAfter    time.Duration
+	hasRetryAfter bool
+}
+
+func (e throttledError) Error() string {
+	return fmt.Sprintf("throttled with HTTP status %d", e.status)
+}
+
+// pause returns how long to wait after e, the throttled-th throttled response
+// in a row: the Retry-After when there was one, an exponential backoff
+// otherwise
+func (e throttledError) pause(throttled int) time.Duration {
+	if e.hasRetryAfter {
+		return e.retryAfter
+	}
+	backoff := throttleBackoff
+	for i := 1; i < throttled && backoff < maxThrottleBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxThrottleBackoff)
+}
+
+// throttled returns the throttledError of result when eo respects
+// Retry-After and its last response was a 429, or a 503 with a Retry-After
+func (eo execOptions) throttled(result commandResult) (throttledError, bool) {
+	if !eo.respectRetryAfter {
+		return throttledError{}, false
+	}
+	status := result.lastStatus()
+	wait, ok := parseRetryAfter(result.retryAfter, time.Now())
+	if status != http.StatusTooManyRequests && (status != http.StatusServiceUnavailable || !ok) {
+		return throttledError{}, false
+	}
+	return throttledError{status: status, retryAfter: wait, hasRetryAfter: ok}, true
+}
+
+// parseRetryAfter parses a Retry-After header, a number of seconds or an
+// HTTP date, into how long to wait from now
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
+
+// sleepContext waits d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "120", want: 2 * time.Minute, ok: true},
+		{value: " 0 ", want: 0, ok: true},
+		{value: "Wed, 21 Oct 2015 07:28:30 GMT", want: 30 * time.Second, ok: true},
+		{value: "Wed, 21 Oct 2015 07:27:00 GMT", want: 0, ok: true},
+		{value: ""},
+		{value: "-5"},
+		{value: "soon"},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestThrottledPause(t *testing.T) {
+	withRetryAfter := throttledError{status: 429, retryAfter: 3 * time.Second, hasRetryAfter: true}
+	if got := withRetryAfter.pause(5); got != 3*time.Second {
+		t.Errorf("pause() with a Retry-After = %v, want 3s", got)
+	}
+
+	backoff := throttledError{status: 429}
+	for throttled, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 10: maxThrottleBackoff} {
+		if got := backoff.pause(throttled); got != want {
+			t.Errorf("pause(%d) without a Retry-After = %v, want %v", throttled, got, want)
+		}
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	eo := execOptions{respectRetryAfter: true}
+	tests := []struct {
+		name   string
+		eo     execOptions
+		result commandResult
+		want   bool
+	}{
+		{name: "429", eo: eo, result: commandResult{statuses: []int{429}}, want: true},
+		{name: "429 of an earlier step", eo: eo, result: commandResult{statuses: []int{429, 200}}},
+		{name: "503 with a Retry-After", eo: eo, result: commandResult{statuses: []int{503}, retryAfter: "5"}, want: true},
+		{name: "503 without a Retry-After", eo: eo, result: commandResult{statuses: []int{503}}},
+		{name: "200 with a Retry-After", eo: eo, result: commandResult{statuses: []int{200}, retryAfter: "5"}},
+		{name: "disabled", result: commandResult{statuses: []int{429}, retryAfter: "5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := tt.eo.throttled(tt.result); got != tt.want {
+				t.Errorf("throttled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecCmdRespectsRetryAfter(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	// The first 2 requests are throttled
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	cmdText := `curl -s "` + server.URL + `"`
+	failOn, _ := parseStatusPatterns("4xx")
+
+	tests := []struct {
+		name          string
+		native        bool
+		respect       bool
+		wantThrottled int32
+		wantFailed    int32
+		wantPause     time.Duration
+	}{
+		{name: "pauses for the Retry-After", respect: true, wantThrottled: 2, wantPause: 2 * time.Second},
+		{name: "pauses for the Retry-After natively", native: true, respect: true, wantThrottled: 2, wantPause: 2 * time.Second},
+		{name: "disabled counts them as failures", wantFailed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			start := time.Now()
+			stats, err := execCmd(cmdText, execOptions{times: 4, quiet: true, failOn: failOn, maxFailures: 2, native: tt.native, respectRetryAfter: tt.respect})
+			if err != nil {
+				t.Fatalf("execCmd() error = %v", err)
+			}
+			if stats.Throttled != tt.wantThrottled || stats.Failed != tt.wantFailed || stats.Success != 2 {
+				t.Errorf("throttled %d, failed %d, succeeded %d, want %d, %d and 2", stats.Throttled, stats.Failed, stats.Success, tt.wantThrottled, tt.wantFailed)
+			}
+			if took := time.Since(start); took < tt.wantPause || (tt.wantPause == 0 && took > time.Second) {
+				t.Errorf("run took %v, want it to pause %v", took, tt.wantPause)
+			}
+			if tt.wantThrottled > 0 && len(stats.Errors) > 0 {
+				t.Errorf("Errors = %q, want throttled executions left out", stats.Errors)
+			}
+		})
+	}
+}
+
+func TestExecCmdAllThrottled(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	cmdText := `curl -s "` + server.URL + `"`
+
+	tests := []struct {
+		name string
+		rate float64
+	}{
+		{name: "pool"},
+		{name: "paced", rate: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := os.CreateTemp(t.TempDir(), "stderr")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stderr := os.Stderr
+			os.Stderr = out
+			start := time.Now()
+			stats, err := execCmd(cmdText, execOptions{times: 2, quiet: true, rate: tt.rate, respectRetryAfter: true})
+			took := time.Since(start)
+			os.Stderr = stderr
+			if err != nil {
+				t.Fatalf("execCmd() error = %v", err)
+			}
+			if stats.Throttled != 2 {
+				t.Errorf("throttled %d, want 2", stats.Throttled)
+			}
+			// Only the first execution has one after it to pause for
+			if took < time.Second || took >= 2*time.Second {
+				t.Errorf("run took %v, want a single pause of 1s", took)
+			}
+			summary, _ := os.ReadFile(out.Name())
+			if !strings.Contains(string(summary), "Throttled:") {
+				t.Errorf("stderr:\n%s\nwant the summary with the throttled executions", summary)
+			}
+		})
+	}
+}
+
+func TestStatusLineRetryAfter(t *testing.T) {
+	out := "busy" + statusLine(429, "text/plain", "Wed, 21 Oct 2015 07:28:00 GMT", nil)
+	if got := lastRetryAfter(out); got != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Errorf("lastRetryAfter() = %q", got)
+	}
+	if got := lastContentType(out); got != "text/plain" {
+		t.Errorf("lastContentType() = %q, want text/plain", got)
+	}
+	if printed, statuses := extractStatuses(out); printed != "busy" || len(statuses) != 1 || statuses[0] != 429 {
+		t.Errorf("extractStatuses() = %q, %v, want the status line stripped", printed, statuses)
+	}
+
+	filter := newStatusFilter(&strings.Builder{})
+	filter.Write([]byte(out))
+	filter.Close()
+	if filter.retryAfter != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Errorf("statusFilter retryAfter = %q", filter.retryAfter)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// timingWriteOut is statusWriteOut with the timing of the request on the
+// status line too, from curl's write-out variables, for --timing
+const timingWriteOut = `-w '\n__curly_status__=%{http_code} timing=%{time_namelookup},%{time_connect},%{time_appconnect},%{time_starttransfer},%{time_total},%{size_download} %{content_type}\n'`
+
+// maxTiming is the length of the longest timing a status line can carry
+const maxTiming = 128
+
+// injectTimingWriteOut adds timingWriteOut to the curl commands in content
+// injectStatusWriteOut would add statusWriteOut to
+func injectTimingWriteOut(content string) string {
+	return injectWriteOut(content, timingWriteOut)
+}
+
+// extractTimings returns the timings of the status lines in out, in order
+func extractTimings(out string) []run.RequestTiming {
+	var timings []run.RequestTiming
+	for _, match := range statusLinePattern.FindAllStringSubmatch(out, -1) {
+		timings = appendTiming(timings, match[2])
+	}
+	return timings
+}
+
+// appendTiming appends the timing of a status line to timings, if it has
+// a valid one
+func appendTiming(timings []run.RequestTiming, s string) []run.RequestTiming {
+	if s == "" {
+		return timings
+	}
+	t, err := run.ParseTiming(s)
+	if err != nil {
+		return timings
+	}
+	return append(timings, t)
+}
+
+// timingTrace measures the phases of a --native request with httptrace,
+// from when it was created on
+type timingTrace struct {
+	start time.Time
+	// The callbacks of a dial may run on a goroutine of their own
+	mu     sync.Mutex
+	timing run.RequestTiming
+}
+
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+// done sets phase to how long since the start it was done
+func (tt *timingTrace) done(phase *time.Duration) {
+	tt.mu.Lock()
+	*phase = time.Since(tt.start)
+	tt.mu.Unlock()
+}
+
+// finish returns the timing of the request, whose body of size bytes was
+// downloaded just now
+func (tt *timingTrace) finish(size int64) run.RequestTiming {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.timing.Total, tt.timing.Size = time.Since(tt.start), size
+	return tt.timing
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestParseTiming(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    run.RequestTiming
+		wantErr bool
+	}{
+		{
+			name: "HTTPS",
+			line: "\n__curly_status__=200 timing=0.004512,0.016230,0.052900,0.140377,0.152001,5120 application/json\n",
+			want: run.RequestTiming{
+				NameLookup:    4512 * time.Microsecond,
+				Connect:       16230 * time.Microsecond,
+				AppConnect:    52900 * time.Microsecond,
+				StartTransfer: 140377 * time.Microsecond,
+				Total:         152001 * time.Microsecond,
+				Size:          5120,
+			},
+		},
+		{
+			name: "plain HTTP without a Content-Type",
+			line: "__curly_status__=204 timing=0.000021,0.000190,0.000000,0.001030,0.001044,0 \n",
+			want: run.RequestTiming{
+				NameLookup:    21 * time.Microsecond,
+				Connect:       190 * time.Microsecond,
+				StartTransfer: 1030 * time.Microsecond,
+				Total:         1044 * time.Microsecond,
+			},
+		},
+		{name: "too few values", line: "__curly_status__=200 timing=0.1,0.2,0.3 text/plain\n", wantErr: true},
+		{name: "fractional size", line: "__curly_status__=200 timing=0.1,0.2,0.3,0.4,0.5,1.5 text/plain\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := statusLinePattern.FindStringSubmatch(tt.line)
+			if match == nil {
+				t.Fatalf("statusLinePattern doesn't match %q", tt.line)
+			}
+			got, err := run.ParseTiming(match[2])
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseTiming(%q) = %+v, want an error", match[2], got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTiming(%q) error = %v", match[2], err)
+			}
+			if got != tt.want {
+				t.Errorf("parseTiming(%q) = %+v, want %+v", match[2], got, tt.want)
+			}
+			if again, err := run.ParseTiming(got.String()); err != nil || again != got {
+				t.Errorf("parseTiming(%q) = %+v, %v, want it to round-trip", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestTimingStats(t *testing.T) {
+	stats := &run.ExecutionStats{Total: 1}
+	stats.RecordLatency(run.LatencySample{Iteration: 1, Duration: 30 * time.Millisecond, Timings: []run.RequestTiming{
+		{NameLookup: 1500 * time.Microsecond, Connect: 3 * time.Millisecond, StartTransfer: 20 * time.Millisecond, Total: 25 * time.Millisecond, Size: 42},
+	}})
+	report := newStatsReport(stats)
+	want := []statsTiming{{NamelookupMs: 1.5, ConnectMs: 3, StarttransferMs: 20, TotalMs: 25, SizeDownload: 42}}
+	if !reflect.DeepEqual(report.Latencies[0].Timings, want) {
+		t.Errorf("newStatsReport() timings = %+v, want %+v", report.Latencies[0].Timings, want)
+	}
+
+	var csv bytes.Buffer
+	if err := writeStatsCSV(&csv, report); err != nil {
+		t.Fatalf("writeStatsCSV() error = %v", err)
+	}
+	for _, row := range []string{"time_namelookup_ms,1,1.5\n", "time_appconnect_ms,1,0\n", "time_total_ms,1,25\n", "size_download,1,42\n"} {
+		if !strings.Contains(csv.String(), row) {
+			t.Errorf("writeStatsCSV() =\n%s\nwant a row %q", csv.String(), row)
+		}
+	}
+}
+
+func TestTimingRequests(t *testing.T) {
+	cmdText := `curl -s "` + echoServer(t).URL + `/users/42"`
+	req, err := parseNativeRequest(cmdText)
+	if err != nil {
+		t.Fatalf("parseNativeRequest() error = %v", err)
+	}
+	req.timing = true
+	cmdText = injectTimingWriteOut(cmdText)
+	runs := map[string]execOptions{"native": {quiet: true, keepOutput: true, request: req}}
+	if _, err := exec.LookPath("curl"); err == nil {
+		runs["curl"] = execOptions{quiet: true, keepOutput: true}
+	}
+
+	for name, eo := range runs {
+		for _, mode := range []string{"quiet", "combined"} {
+			eo.quiet = mode == "quiet"
+			eo.timing = true
+			result, err := execShellCommand(context.Background(), cmdText, 1, eo)
+			if err != nil {
+				t.Fatalf("%s, %s: execShellCommand() error = %v", name, mode, err)
+			}
+			if len(result.timings) != 1 {
+				t.Fatalf("%s, %s: timings = %+v, want one", name, mode, result.timings)
+			}
+			timing := result.timings[0]
+			if timing.Total <= 0 || timing.StartTransfer > timing.Total || timing.Size == 0 {
+				t.Errorf("%s, %s: timing = %+v, want it to add up", name, mode, timing)
+			}
+			if body := lastResponseBody(result.output); strings.Contains(body, "timing=") || !strings.Contains(body, "/users/42") {
+				t.Errorf("%s, %s: body = %q, want the response without the timing", name, mode, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// checkTLS checks the files of c exist, naming them in errors by the flags
+// they come from, or the tls block of the environment env
+func checkTLS(c run.TLSConfig, env string) error {
+	names := [3]string{"--cert", "--key", "--cacert"}
+	if env != "" {
+		names = [3]string{"tls.cert", "tls.key", "tls.ca"}
+	}
+	if c.Key != "" && c.Cert == "" {
+		return tlsError(env, fmt.Errorf("%s needs %s", names[1], names[0]))
+	}
+	for i, path := range []string{c.Cert, c.Key, c.CA} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return tlsError(env, fmt.Errorf("%s: %s doesn't exist", names[i], path))
+		case err != nil:
+			return tlsError(env, fmt.Errorf("%s: %w", names[i], err))
+		case info.IsDir():
+			return tlsError(env, fmt.Errorf("%s: %s is a directory", names[i], path))
+		}
+	}
+	return nil
+}
+
+// tlsError names the environment env err is about, if any
+func tlsError(env string, err error) error {
+	if env == "" {
+		return err
+	}
+	return fmt.Errorf("environment %s: %w", env, err)
+}
+
+// resolveTLS returns the files the curl commands authenticate with: those of
+// the tls block of the environment opts.envName, the last with one of
+// layered environments, with the flags of opts.tls over them. Every file is
+// checked to exist
+func resolveTLS(opts runOptions) (run.TLSConfig, error) {
+	var resolved run.TLSConfig
+	if opts.envName != "" {
+		config, err := run.LoadEnvConfig(opts.envsFile)
+		if err != nil {
+			return run.TLSConfig{}, fmt.Errorf("failed to load envs.yml: %w", err)
+		}
+		var tlsEnv string
+		for _, name := range run.EnvLayers(opts.envName) {
+			if config.TLS[name] != nil {
+				resolved, tlsEnv = *config.TLS[name], name
+			}
+		}
+		if tlsEnv != "" {
+			base := filepath.Dir(opts.envsFile)
+			for _, path := range []*string{&resolved.Cert, &resolved.Key, &resolved.CA} {
+				if *path != "" && !filepath.IsAbs(*path) {
+					*path = filepath.Join(base, *path)
+				}
+			}
+			if err := checkTLS(resolved, tlsEnv); err != nil {
+				return run.TLSConfig{}, err
+			}
+		}
+	}
+	if err := checkTLS(opts.tls, ""); err != nil {
+		return run.TLSConfig{}, err
+	}
+	return resolved.Merge(opts.tls), nil
+}
+
+// injectCurlTLS passes the files of c to every curl command in content as
+// --cert, --key and --cacert, leaving those a command passes itself alone
+func injectCurlTLS(content string, c run.TLSConfig) string {
+	if c.IsZero() {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for _, cmd := range run.FindCurlCommands(lines) {
+		var text strings.Builder
+		for _, line := range lines[cmd.Start : cmd.End+1] {
+			text.WriteString(strings.TrimSuffix(line, "\\") + " ")
+		}
+		var hasCert, hasKey, hasCA bool
+		for _, word := range splitShellWords(text.String()) {
+			switch {
+			case word == "-E" || word == "--cert" || strings.HasPrefix(word, "--cert="):
+				hasCert = true
+			case word == "--key" || strings.HasPrefix(word, "--key="):
+				hasKey = true
+			case word == "--cacert" || strings.HasPrefix(word, "--cacert="):
+				hasCA = true
+			}
+		}
+		var args []string
+		if c.Cert != "" && !hasCert {
+			args = append(args, "--cert "+shellquote.DoubleQuote(c.Cert))
+		}
+		// A command's own certificate goes with its own key
+		if c.Key != "" && !hasKey && !hasCert {
+			args = append(args, "--key "+shellquote.DoubleQuote(c.Key))
+		}
+		if c.CA != "" && !hasCA {
+			args = append(args, "--cacert "+shellquote.DoubleQuote(c.CA))
+		}
+		if len(args) > 0 {
+			insertCurlArgs(lines, cmd, strings.Join(args, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+// writeTestPEM writes blocks of type kind to a file of dir
+func writeTestPEM(t *testing.T, dir, name, kind string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newMTLSServer starts a TLS server requiring a client certificate signed by
+// a test CA, returning it with the files of a client certificate the CA
+// signed, its key and the CA certificate of the server
+func newMTLSServer(t *testing.T) (*httptest.Server, run.TLSConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "curly test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ada"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, run.TLSConfig{
+		Cert: writeTestPEM(t, dir, "client.pem", "CERTIFICATE", clientDER),
+		Key:  writeTestPEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER),
+		CA:   writeTestPEM(t, dir, "server-ca.pem", "CERTIFICATE", server.Certificate().Raw),
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	server, files := newMTLSServer(t)
+	dir := t.TempDir()
+	curlFile := filepath.Join(dir, "GET_me.curl")
+	if err := os.WriteFile(curlFile, []byte("curl -s \""+server.URL+"/me\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     run.TLSConfig
+		wantErr bool
+	}{
+		{name: "certificate and CA", tls: files},
+		{name: "no certificate", tls: run.TLSConfig{CA: files.CA}, wantErr: true},
+		{name: "unknown CA", tls: run.TLSConfig{Cert: files.Cert, Key: files.Key}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdText, err := runFile(curlFile, dir, runOptions{tls: tt.tls})
+			if err != nil {
+				t.Fatalf("runFile() error = %v", err)
+			}
+			req, err := parseNativeRequest(cmdText)
+			if err != nil {
+				t.Fatalf("parseNativeRequest() error = %v", err)
+			}
+			cmdText = injectStatusWriteOut(cmdText)
+			runs := map[string]execOptions{"native": {quiet: true, keepOutput: true, request: req}}
+			if _, err := exec.LookPath("curl"); err == nil {
+				runs["curl"] = execOptions{quiet: true, keepOutput: true}
+			}
+			for name, eo := range runs {
+				result, err := execShellCommand(context.Background(), cmdText, 1, eo)
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("%s: request succeeded, want a TLS error", name)
+					}
+					continue
+				}
+				if err != nil || !strings.Contains(result.output, "hello ada") || result.lastStatus() != 200 {
+					t.Errorf("%s: output = %q, %v, want the server to greet the client certificate", name, result.output, err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveTLS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"client.pem", "client.key", "ca.pem", "other.pem"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("PEM"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	envsFile := filepath.Join(dir, "envs.yml")
+	envs := `environments:
+  prod:
+    BASE_URL: https://api.internal
+    tls:
+      cert: client.pem
+      key: client.key
+      ca: ` + filepath.Join(dir, "ca.pem") + `
+  as-admin:
+    TOKEN: admin
+  broken:
+    tls:
+      cert: missing.pem
+  keyless:
+    tls:
+      key: client.key
+  staging:
+    extends: prod
+`
+	if err := os.WriteFile(envsFile, []byte(envs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prod := run.TLSConfig{Cert: filepath.Join(dir, "client.pem"), Key: filepath.Join(dir, "client.key"), CA: filepath.Join(dir, "ca.pem")}
+
+	tests := []struct {
+		name    string
+		env     string
+		flags   run.TLSConfig
+		want    run.TLSConfig
+		wantErr string
+	}{
+		{name: "no environment"},
+		{name: "relative to envs.yml", env: "prod", want: prod},
+		{name: "extended", env: "staging", want: prod},
+		{name: "layered", env: "prod,as-admin", want: prod},
+		{name: "flags over the environment", env: "prod", flags: run.TLSConfig{Cert: filepath.Join(dir, "other.pem")},
+			want: run.TLSConfig{Cert: filepath.Join(dir, "other.pem"), Key: prod.Key, CA: prod.CA}},
+		{name: "flags alone", flags: run.TLSConfig{CA: filepath.Join(dir, "ca.pem")}, want: run.TLSConfig{CA: filepath.Join(dir, "ca.pem")}},
+		{name: "missing file", env: "broken", wantErr: "environment broken: tls.cert: " + filepath.Join(dir, "missing.pem") + " doesn't exist"},
+		{name: "key without certificate", env: "keyless", wantErr: "environment keyless: tls.key needs tls.cert"},
+		{name: "missing flag file", flags: run.TLSConfig{Key: "k.pem", Cert: "nope.pem"}, wantErr: "--cert: nope.pem doesn't exist"},
+		{name: "directory", flags: run.TLSConfig{CA: dir}, wantErr: "--cacert: " + dir + " is a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTLS(runOptions{envName: tt.env, envsFile: envsFile, tls: tt.flags})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("resolveTLS() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTLS() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTLS() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectCurlTLS(t *testing.T) {
+	files := run.TLSConfig{Cert: "/certs/client.pem", Key: "/certs/client.key", CA: "/certs/ca.pem"}
+	tests := []struct {
+		name    string
+		content string
+		tls     run.TLSConfig
+		want    string
+	}{
+		{
+			name:    "all files",
+			content: "curl -s \"${BASE_URL}/me\"",
+			tls:     files,
+			want:    `curl --cert "/certs/client.pem" --key "/certs/client.key" --cacert "/certs/ca.pem" -s "${BASE_URL}/me"`,
+		},
+		{
+			name:    "none",
+			content: "curl -s x",
+			want:    "curl -s x",
+		},
+		{
+			name:    "the command's own certificate keeps its key",
+			content: "curl -s -E own.pem \\\n  x",
+			tls:     files,
+			want:    "curl --cacert \"/certs/ca.pem\" -s -E own.pem \\\n  x",
+		},
+		{
+			name:    "the command's own CA",
+			content: "curl --cacert=own.pem x",
+			tls:     run.TLSConfig{CA: "/certs/ca.pem"},
+			want:    "curl --cacert=own.pem x",
+		},
+		{
+			name:    "every command, not heredoc bodies",
+			content: "curl a\ncat <<EOF\ncurl b\nEOF\ncurl c",
+			tls:     run.TLSConfig{CA: "/certs/$ca.pem"},
+			want:    "curl --cacert \"/certs/\\$ca.pem\" a\ncat <<EOF\ncurl b\nEOF\ncurl --cacert \"/certs/\\$ca.pem\" c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectCurlTLS(tt.content, tt.tls); got != tt.want {
+				t.Errorf("injectCurlTLS() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// openTTY opens the controlling terminal, for reading keys and drawing even
+// when stdin or stdout are redirected
+func openTTY() (in, out *os.File, err error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tty, tty, nil
+}
+
+// closeTTY closes the terminal openTTY opened, which also ends a read
+// waiting on it
+func closeTTY(in, out *os.File) {
+	in.Close()
+}
+
+// notifyResize sends to ch when the terminal is resized, until the returned
+// function is called
+func notifyResize(ch chan os.Signal) func() {
+	signal.Notify(ch, syscall.SIGWINCH)
+	return func() { signal.Stop(ch) }
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os"
+)
+
+// openTTY opens the console, for reading keys and drawing even when stdin or
+// stdout are redirected
+func openTTY() (in, out *os.File, err error) {
+	in, err = os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err = os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+// closeTTY closes the console openTTY opened
+func closeTTY(in, out *os.File) {
+	in.Close()
+	out.Close()
+}
+
+// notifyResize does nothing on Windows, which has no signal for it: the
+// finder picks up the new size when it next redraws, on the next key
+func notifyResize(ch chan os.Signal) func() {
+	return func() {}
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+// validationIssue is a single problem found in a spec, located by the JSON
+// pointer of the offending node
+type validationIssue struct {
+	pointer string
+	message string
+}
+
+// validator is implemented by every kin-openapi node that can validate itself
+type validator interface {
+	Validate(ctx context.Context, opts ...openapi3.ValidationOption) error
+}
+
+func NewValidateCmd() *cobra.Command {
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:          "validate <openapi-file>",
+		Short:        "Validate an OpenAPI YAML/JSON with the same loader generate uses",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateSpecFile(cmd.Context(), cmd.OutOrStdout(), args[0], strict)
+		},
+	}
+
+	cmd.Flags().BoolVar(&strict, "strict", false, "Also warn about spec gaps that degrade the generated collection")
+
+	return cmd
+}
+
+// validateSpecFile loads and validates a spec, printing every issue found and
+// returning an error if any of them are validation errors
+func validateSpecFile(ctx context.Context, out io.Writer, openapiFile string, strict bool) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	loader, location, err := generate.SpecLoader(openapiFile)
+	if err != nil {
+		return err
+	}
+	doc, err := loader.LoadFromURI(location)
+	if err != nil {
+		return fmt.Errorf("failed to load OpenAPI file: %w", err)
+	}
+
+	errs := validateSpec(ctx, doc)
+	var warnings []validationIssue
+	if strict {
+		warnings = strictSpecWarnings(doc)
+	}
+
+	for _, issue := range errs {
+		fmt.Fprintf(out, "error: %s: %s\n", issue.pointer, issue.message)
+	}
+	for _, issue := range warnings {
+		fmt.Fprintf(out, "warning: %s: %s\n", issue.pointer, issue.message)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %d validation error(s)", openapiFile, len(errs))
+	}
+	fmt.Fprintf(out, "%s is valid (%d warning(s))\n", openapiFile, len(warnings))
+	return nil
+}
+
+// validateSpec runs kin-openapi validation node by node rather than on the
+// whole document, which stops at the first error, so every problem is reported
+func validateSpec(ctx context.Context, doc *openapi3.T) []validationIssue {
+	var issues []validationIssue
+	check := func(pointer string, v validator) {
+		if err := v.Validate(ctx); err != nil {
+			issues = append(issues, validationIssue{pointer: pointer, message: err.Error()})
+		}
+	}
+
+	if doc.OpenAPI == "" {
+		issues = append(issues, validationIssue{pointer: "/openapi", message: "must be a non-empty string"})
+	}
+	if doc.Info == nil {
+		issues = append(issues, validationIssue{pointer: "/info", message: "must be an object"})
+	} else {
+		check("/info", doc.Info)
+	}
+
+	if components := doc.Components; components != nil {
+		checkComponents(check, "schemas", components.Schemas)
+		checkComponents(check, "parameters", components.Parameters)
+		checkComponents(check, "headers", components.Headers)
+		checkComponents(check, "requestBodies", components.RequestBodies)
+		checkComponents(check, "responses", components.Responses)
+		checkComponents(check, "securitySchemes", components.SecuritySchemes)
+		checkComponents(check, "examples", components.Examples)
+		checkComponents(check, "links", components.Links)
+		checkComponents(check, "callbacks", components.Callbacks)
+	}
+
+	if doc.Paths == nil {
+		issues = append(issues, validationIssue{pointer: "/paths", message: "must be an object"})
+	} else {
+		generate.ForEachOperation(doc.Paths, func(path, method string, item *openapi3.PathItem, op *openapi3.Operation) {
+			// A single-operation Paths also checks the path parameters against the template
+			single := &openapi3.PathItem{Parameters: item.Parameters}
+			single.SetOperation(method, op)
+			check(operationPointer(path, method), openapi3.NewPaths(openapi3.WithPath(path, single)))
+		})
+	}
+
+	for i, server := range doc.Servers {
+		check(fmt.Sprintf("/servers/%d", i), server)
+	}
+	for i, tag := range doc.Tags {
+		check(fmt.Sprintf("/tags/%d", i), tag)
+	}
+	if doc.Security != nil {
+		check("/security", &doc.Security)
+	}
+	if doc.ExternalDocs != nil {
+		check("/externalDocs", doc.ExternalDocs)
+	}
+
+	// Anything the per-node checks don't cover still fails the spec
+	if len(issues) == 0 {
+		if err := doc.Validate(ctx); err != nil {
+			issues = append(issues, validationIssue{pointer: "/", message: err.Error()})
+		}
+	}
+
+	return issues
+}
+
+// checkComponents validates each entry of a components map in name order
+func checkComponents[M ~map[string]V, V validator](check func(string, validator), kind string, components M) {
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check("/components/"+kind+"/"+jsonPointerEscape(name), components[name])
+	}
+}
+
+// strictSpecWarnings flags spec gaps that are valid OpenAPI but make for a
+// worse collection
+func strictSpecWarnings(doc *openapi3.T) []validationIssue {
+	var warnings []validationIssue
+	warn := func(pointer, format string, args ...any) {
+		warnings = append(warnings, validationIssue{pointer: pointer, message: fmt.Sprintf(format, args...)})
+	}
+
+	generate.ForEachOperation(doc.Paths, func(path, method string, item *openapi3.PathItem, op *openapi3.Operation) {
+		pointer := operationPointer(path, method)
+
+		if op.OperationID == "" {
+			warn(pointer, "operation has no operationId")
+		}
+
+		if generate.SendsPlaceholderBody(op, doc) {
+			warn(pointer+"/requestBody", "request body has no schema or example, generated file will send a placeholder body")
+		}
+
+		declared := map[string]bool{}
+		for _, params := range []openapi3.Parameters{item.Parameters, op.Parameters} {
+			for _, paramRef := range params {
+				if paramRef.Value != nil && paramRef.Value.In == "path" {
+					declared[paramRef.Value.Name] = true
+				}
+			}
+		}
+		for _, name := range generate.PathParams(path) {
+			if !declared[name] {
+				warn(pointer, "path parameter %q is used in the URL but not declared", name)
+			}
+		}
+	})
+
+	return warnings
+}
+
+// operationPointer returns the JSON pointer of an operation
+func operationPointer(path, method string) string {
+	return "/paths/" + jsonPointerEscape(path) + "/" + strings.ToLower(method)
+}
+
+// jsonPointerEscape escapes a reference token per RFC 6901
+func jsonPointerEscape(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ErikVib/curly/pkg/generate"
+)
+
+func TestValidateSpecFile(t *testing.T) {
+	validSpec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users/{id}:
+    get:
+      operationId: getUser
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+`
+
+	invalidSpec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users/{id}:
+    get:
+      operationId: getUser
+      responses:
+        '200':
+          description: OK
+  /things:
+    get:
+      operationId: getThings
+      parameters:
+        - name: q
+          in: nowhere
+      responses:
+        '200':
+          description: OK
+components:
+  schemas:
+    Bad:
+      type: wat
+`
+
+	strictSpec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    post:
+      requestBody:
+        content:
+          application/json: {}
+      responses:
+        '200':
+          description: OK
+`
+
+	tests := []struct {
+		name    string
+		spec    string
+		strict  bool
+		wantErr bool
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "valid spec",
+			spec: validSpec,
+			want: []string{"is valid"},
+		},
+		{
+			name:    "every error is reported with its pointer",
+			spec:    invalidSpec,
+			wantErr: true,
+			want: []string{
+				"error: /components/schemas/Bad:",
+				"error: /paths/~1things/get:",
+				"error: /paths/~1users~1{id}/get:",
+			},
+		},
+		{
+			name:    "strict warnings are off by default",
+			spec:    strictSpec,
+			wantNot: []string{"warning:"},
+		},
+		{
+			name:   "strict flags curly-specific gaps without failing",
+			spec:   strictSpec,
+			strict: true,
+			want: []string{
+				"warning: /paths/~1users/post: operation has no operationId",
+				"warning: /paths/~1users/post/requestBody: request body has no schema or example",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openapiFile := filepath.Join(t.TempDir(), "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(tt.spec), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			var out bytes.Buffer
+			err := validateSpecFile(context.Background(), &out, openapiFile, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSpecFile() error = %v, wantErr %v\n%s", err, tt.wantErr, out.String())
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q, got:\n%s", want, out.String())
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(out.String(), unwanted) {
+					t.Errorf("unexpected %q in output:\n%s", unwanted, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestStrictSpecWarningsUndeclaredPathParam(t *testing.T) {
+	openapiFile := filepath.Join(t.TempDir(), "openapi.yml")
+	spec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users/{id}:
+    get:
+      operationId: getUser
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(spec), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	loader, location, err := generate.SpecLoader(openapiFile)
+	if err != nil {
+		t.Fatalf("SpecLoader() error = %v", err)
+	}
+	doc, err := loader.LoadFromURI(location)
+	if err != nil {
+		t.Fatalf("failed to load spec: %v", err)
+	}
+
+	warnings := strictSpecWarnings(doc)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].message, `path parameter "id"`) {
+		t.Errorf("strictSpecWarnings() = %+v, want a single undeclared id warning", warnings)
+	}
+}
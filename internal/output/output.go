@@ -0,0 +1,189 @@
+// Package output writes what curly prints to a terminal, coloring failures
+// red, successes green and warnings yellow when color is on
+package output
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ANSI colors of failures, successes and warnings
+const (
+	Red    = "\033[31m"
+	Green  = "\033[32m"
+	Yellow = "\033[33m"
+	Reset  = "\033[0m"
+)
+
+// ANSI colors of the parts of a JSON document
+const (
+	Key    = "\033[34;1m"
+	String = "\033[32m"
+	Number = "\033[36m"
+	Bool   = "\033[33m"
+	Null   = "\033[90m"
+)
+
+// NoColor turns color off whatever the terminal supports, for --no-color
+var NoColor bool
+
+// Supported reports whether output to a terminal may be colored, which
+// NoColor, NO_COLOR and a dumb terminal rule out
+func Supported() bool {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return !NoColor && !noColor && os.Getenv("TERM") != "dumb"
+}
+
+// Enabled reports whether output to f is colored: f is a terminal and color
+// is supported
+func Enabled(f *os.File) bool {
+	return Supported() && term.IsTerminal(int(f.Fd()))
+}
+
+// Writer writes to an io.Writer, coloring what it paints when color is on
+type Writer struct {
+	w     io.Writer
+	color bool
+}
+
+// New returns a Writer writing to w, coloring with color
+func New(w io.Writer, color bool) *Writer {
+	return &Writer{w: w, color: color}
+}
+
+// From returns w when it's a Writer already, or else a Writer writing to w
+// without color
+func From(w io.Writer) *Writer {
+	if o, ok := w.(*Writer); ok {
+		return o
+	}
+	return New(w, false)
+}
+
+// Stderr returns a Writer writing to stderr, colored when it's a terminal
+func Stderr() *Writer {
+	return New(os.Stderr, Enabled(os.Stderr))
+}
+
+// Stdout returns a Writer writing to stdout, colored when it's a terminal
+func Stdout() *Writer {
+	return New(os.Stdout, Enabled(os.Stdout))
+}
+
+func (o *Writer) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+// Color reports whether o colors what it paints
+func (o *Writer) Color() bool {
+	return o.color
+}
+
+// Paint returns s in color when o colors, s as is otherwise
+func (o *Writer) Paint(color, s string) string {
+	if !o.color || s == "" {
+		return s
+	}
+	return color + s + Reset
+}
+
+// Failure paints s red
+func (o *Writer) Failure(s string) string {
+	return o.Paint(Red, s)
+}
+
+// Success paints s green
+func (o *Writer) Success(s string) string {
+	return o.Paint(Green, s)
+}
+
+// Warning paints s yellow
+func (o *Writer) Warning(s string) string {
+	return o.Paint(Yellow, s)
+}
+
+// Warnings returns a writer for warnings, painting every line written to it
+// yellow
+func (o *Writer) Warnings() io.Writer {
+	if !o.color {
+		return o.w
+	}
+	return painter{o: o, color: Yellow}
+}
+
+// painter paints the lines written to it, which are written whole
+type painter struct {
+	o     *Writer
+	color string
+}
+
+func (p painter) Write(b []byte) (int, error) {
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		out.WriteString(p.o.Paint(p.color, text))
+		out.WriteString(line[len(text):])
+	}
+	if _, err := p.o.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// JSON colors the keys and values of the valid JSON document doc when o
+// colors, and returns it as is otherwise
+func (o *Writer) JSON(doc string) string {
+	if !o.color {
+		return doc
+	}
+	return JSON(doc)
+}
+
+// JSON colors the keys and values of the valid JSON document doc
+func JSON(doc string) string {
+	var b strings.Builder
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(doc) && doc[end] != '"' {
+				if doc[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			color := String
+			if rest := strings.TrimLeft(doc[end:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				color = Key
+			}
+			b.WriteString(color + doc[i:end] + Reset)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(doc) && strings.IndexByte("0123456789.eE+-", doc[end]) >= 0 {
+				end++
+			}
+			b.WriteString(Number + doc[i:end] + Reset)
+			i = end
+		case strings.HasPrefix(doc[i:], "true"):
+			b.WriteString(Bool + "true" + Reset)
+			i += len("true")
+		case strings.HasPrefix(doc[i:], "false"):
+			b.WriteString(Bool + "false" + Reset)
+			i += len("false")
+		case strings.HasPrefix(doc[i:], "null"):
+			b.WriteString(Null + "null" + Reset)
+			i += len("null")
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
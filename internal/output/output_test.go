@@ -0,0 +1,83 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	doc := `{"name": "a \"b\"", "n": -1.5e3, "ok": true, "none": null}`
+	want := Key + `"name"` + Reset + ": " + String + `"a \"b\""` + Reset + ", " +
+		Key + `"n"` + Reset + ": " + Number + "-1.5e3" + Reset + ", " +
+		Key + `"ok"` + Reset + ": " + Bool + "true" + Reset + ", " +
+		Key + `"none"` + Reset + ": " + Null + "null" + Reset
+	if got := New(nil, true).JSON(doc); got != "{"+want+"}" {
+		t.Errorf("JSON() =\n%q\nwant:\n%q", got, "{"+want+"}")
+	}
+	if got := New(nil, false).JSON(doc); got != doc {
+		t.Errorf("JSON() without color = %q, want %q", got, doc)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{
+			name:  "colored",
+			color: true,
+			want: Green + "PASS" + Reset + " users\n" + Red + "FAIL" + Reset + " orders\n" +
+				Yellow + "Warning: a" + Reset + "\n" + Yellow + "Warning: b" + Reset + "\n",
+		},
+		{
+			name: "plain",
+			want: "PASS users\nFAIL orders\nWarning: a\nWarning: b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			o := New(&out, tt.color)
+			fmt.Fprintf(o, "%s users\n", o.Success("PASS"))
+			fmt.Fprintf(o, "%s orders\n", o.Failure("FAIL"))
+			fmt.Fprint(o.Warnings(), "Warning: a\nWarning: b\n")
+			if out.String() != tt.want {
+				t.Errorf("output =\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		noColor bool
+		env     map[string]string
+		want    bool
+	}{
+		{name: "terminal", env: map[string]string{"TERM": "xterm"}, want: true},
+		{name: "NO_COLOR", env: map[string]string{"TERM": "xterm", "NO_COLOR": ""}},
+		{name: "dumb terminal", env: map[string]string{"TERM": "dumb"}},
+		{name: "--no-color", noColor: true, env: map[string]string{"TERM": "xterm"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", "")
+			os.Unsetenv("NO_COLOR")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			NoColor = tt.noColor
+			defer func() { NoColor = false }()
+			if got := Supported(); got != tt.want {
+				t.Errorf("Supported() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package shellquote quotes values for the shell scripts curly writes and
+// rewrites, the .curl files
+package shellquote
+
+import "strings"
+
+// DoubleQuote wraps s in double quotes for a shell assignment, escaping
+// everything the shell would otherwise interpret
+func DoubleQuote(s string) string {
+	return "\"" + EscapeDoubleQuoted(s) + "\""
+}
+
+// EscapeDoubleQuoted escapes the characters that stay special inside
+// double quotes: backslash, double quote, dollar and backtick
+func EscapeDoubleQuoted(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s)
+}
+
+// HeredocEscape escapes literal content for an unquoted heredoc, where
+// backslash, dollar and backtick are still interpreted
+func HeredocEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "$", `\$`, "`", "\\`").Replace(s)
+}
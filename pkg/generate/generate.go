@@ -0,0 +1,2222 @@
+// Package generate turns an OpenAPI spec into a collection of .curl files,
+// one for each operation, and the envs.yml listing the variables they use
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/oasdiff/yaml"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+type parameterInfo struct {
+	name         string
+	varName      string
+	description  string
+	paramType    string
+	required     bool
+	defaultValue any
+	enumValues   []any
+	example      any
+	style        string
+	explode      bool
+	schema       *openapi3.Schema
+	// commented marks an optional query parameter whose variables are assigned
+	// empty, with their values commented out, so it is only sent once the
+	// user uncomments them
+	commented bool
+}
+
+// queryVariable is a single key=value pair of the query string, bound to the
+// shell variable that holds its value
+type queryVariable struct {
+	key     string
+	varName string
+	value   string
+}
+
+type parameterSet struct {
+	pathParams     []*parameterInfo
+	queryParams    []*parameterInfo
+	headerParams   []*parameterInfo
+	formDataParams []*parameterInfo
+	bodyVars       map[string]any
+}
+
+type requestBodyInfo struct {
+	exampleBody string
+	contentType string
+	bodyVars    map[string]any
+	example     any
+	// varNames overrides the variable a body field is bound to, for fields
+	// renamed to avoid colliding with another variable in the file
+	varNames map[string]string
+	// uploadVar holds the path of the file sent as a binary body, and
+	// uploadHints describe what kind of file is expected
+	uploadVar   string
+	uploadHints []string
+}
+
+// varName returns the shell variable a top-level body field is bound to
+func (b requestBodyInfo) varName(key string) string {
+	if name, ok := b.varNames[key]; ok {
+		return name
+	}
+	return shellVarName(key)
+}
+
+// nonNameChars matches the characters a shell variable name can't have
+var nonNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// shellVarName returns the shell variable the parameter or body field name is
+// bound to: name uppercased, with - . and any other character a shell name
+// can't have replaced by _, so ${USER_ID} doesn't turn into ${USER-ID}, the
+// value of USER defaulting to ID
+func shellVarName(name string) string {
+	varName := strings.ToUpper(nonNameChars.ReplaceAllString(name, "_"))
+	if varName == "" || (varName[0] >= '0' && varName[0] <= '9') {
+		varName = "_" + varName
+	}
+	return varName
+}
+
+// reservedVarNames are assigned by every generated file, so no parameter or
+// body field may take them over
+var reservedVarNames = []string{"BASE_URL", "CURL_OPTS"}
+
+// Options configures Generate
+type Options struct {
+	// Spec is the path or http(s) URL of the OpenAPI document, or StdinSpec
+	// to read it from Stdin
+	Spec string
+	// SpecHeaders are "Name: value" headers sent fetching an http(s) Spec,
+	// like an Authorization its registry needs, but not its refs on other
+	// hosts
+	SpecHeaders []string
+	// Stdin is what StdinSpec reads, os.Stdin when nil
+	Stdin io.Reader
+	// OutDir is the directory the collection is written to
+	OutDir string
+	// BaseURL overrides the server URL declared in the spec for BASE_URL,
+	// and the dev environment's BASE_URL in envs.yml
+	BaseURL string
+	// NoServer leaves BASE_URL empty, to be set in envs.yml
+	NoServer bool
+	// EnvsIncludeBody lists the request body variables in envs.yml too
+	EnvsIncludeBody bool
+	// CurlOpts are extra curl options added to every command via CURL_OPTS
+	CurlOpts []string
+	// ChangedOnly only rewrites the files whose contents changed, leaving
+	// the others untouched, and sorts them into the Added, Updated and
+	// Unchanged of the Result
+	ChangedOnly bool
+	// Prune deletes the .curl files of operations no longer in the spec
+	Prune bool
+	// OperationIDs and Paths narrow the operations generated down to those
+	// with one of the operationIds or on one of the exact paths, like
+	// /users/{id}. With neither every operation is generated
+	OperationIDs []string
+	Paths        []string
+	// NameTemplate is the Go template the files are named with, without
+	// .curl, DefaultNameTemplate when empty. Its fields are .Method, .Path,
+	// .SanitizedPath, .OperationID and .Tag, and slashes create
+	// subdirectories
+	NameTemplate string
+	// IncludeOptional sends the optional query parameters, rather than
+	// leaving them commented out
+	IncludeOptional bool
+	// Accept are the response content types preferred for the Accept
+	// header, the first one an operation's responses declare winning over
+	// JSON
+	Accept []string
+	// Warnings receives a line for each operation or file Generate skips or
+	// fails to write without failing, nil discards them
+	Warnings io.Writer
+}
+
+// Result is what Generate did, the files named relative to Options.OutDir
+type Result struct {
+	// Files are the .curl files generated, sorted
+	Files []string
+	// Added, Updated and Unchanged sort Files by whether they are new,
+	// changed or as they were, with Options.ChangedOnly
+	Added     []string
+	Updated   []string
+	Unchanged []string
+	// Orphaned are the .curl files of operations no longer in the spec,
+	// found with Options.ChangedOnly or Options.Prune
+	Orphaned []string
+	// Removed are the Orphaned files Options.Prune deleted
+	Removed []string
+	// EnvsFileKept is set when OutDir already had an envs.yml, which is
+	// left as it was
+	EnvsFileKept bool
+}
+
+// DefaultNameTemplate names files METHOD_sanitized_path.curl
+const DefaultNameTemplate = "{{.Method}}_{{.SanitizedPath}}"
+
+// fileNameData is what --name-template renders a file name from.
+// OperationID is a method so rendering can tell whether the template needs it
+type fileNameData struct {
+	Method          string
+	Path            string
+	SanitizedPath   string
+	Tag             string
+	operationID     string
+	usedOperationID bool
+}
+
+func (d *fileNameData) OperationID() string {
+	d.usedOperationID = true
+	return d.operationID
+}
+
+// operationFilter narrows generation down to the named operations. An
+// operation is selected if it matches any of the operationIds or exact paths;
+// with neither set every operation is selected
+type operationFilter struct {
+	operationIDs []string
+	paths        []string
+}
+
+// DefaultDevBaseURL is the BASE_URL seeded for the dev environment when no
+// Options.BaseURL is given
+const DefaultDevBaseURL = "http://localhost:8081"
+
+// stagingBaseURL is the placeholder BASE_URL seeded for the staging
+// environment, to be replaced with the staging server
+const stagingBaseURL = "https://staging.example.com"
+
+// envVarUsage tracks a variable seen while generating the collection, for
+// seeding envs.yml with the keys the files actually use
+type envVarUsage struct {
+	name  string
+	value string
+	files []string
+}
+
+// Generate writes the collection of the spec opts.Spec to opts.OutDir, a
+// .curl file for each operation and webhook, and an envs.yml unless it
+// already has one
+func Generate(opts Options) (Result, error) {
+	warnings := opts.Warnings
+	if warnings == nil {
+		warnings = io.Discard
+	}
+	filter := operationFilter{operationIDs: opts.OperationIDs, paths: opts.Paths}
+	outDir := opts.OutDir
+
+	input, err := readSpecInput(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	doc, resolver, err := loadSpec(opts.Spec, input, warnings)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to load OpenAPI file: %w", err)
+	}
+
+	// Webhooks are requests the API sends out; generating them lets the
+	// payloads be replayed against our own receiving endpoints
+	webhooks, err := loadWebhooks(doc, resolver)
+	if err != nil {
+		fmt.Fprintf(warnings, "Warning: failed to load webhooks: %v\n", err)
+	}
+
+	// Check the filters before writing anything so a typo doesn't leave a
+	// partially generated collection behind
+	if unmatched := filter.unmatched(doc.Paths, webhooks); len(unmatched) > 0 {
+		return Result{}, fmt.Errorf("no operations match %s", strings.Join(unmatched, ", "))
+	}
+
+	nameTemplate := opts.NameTemplate
+	if nameTemplate == "" {
+		nameTemplate = DefaultNameTemplate
+	}
+	tmpl, err := parseNameTemplate(nameTemplate)
+	if err != nil {
+		return Result{}, err
+	}
+	fileNames, err := planFileNames(tmpl, filter, map[string]*openapi3.Paths{"": doc.Paths, "webhooks": webhooks})
+	if err != nil {
+		return Result{}, err
+	}
+
+	baseURL := resolveBaseURL(doc, opts)
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return Result{}, fmt.Errorf("failed to create output dir: %w", err)
+	}
+
+	write := func(name, contents string) error {
+		path := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(contents), 0644)
+	}
+
+	var result Result
+	generated := map[string]bool{}
+	writeCurl := func(name, contents string) error {
+		generated[name] = true
+		if !opts.ChangedOnly {
+			return write(name, contents)
+		}
+
+		existing, err := os.ReadFile(filepath.Join(outDir, name))
+		switch {
+		case err == nil && bytes.Equal(existing, []byte(contents)):
+			// Leave the file alone so its mtime and open editors are undisturbed
+			result.Unchanged = append(result.Unchanged, name)
+			return nil
+		case err == nil:
+			result.Updated = append(result.Updated, name)
+		default:
+			result.Added = append(result.Added, name)
+		}
+		return write(name, contents)
+	}
+
+	// The first operation using a variable seeds its value in envs.yml, the
+	// paths being generated in sorted order so it is the same every run
+	envVars := map[string]*envVarUsage{}
+	recordEnvVar := func(name, value, fileName string) {
+		usage, ok := envVars[name]
+		if !ok {
+			usage = &envVarUsage{name: name, value: value}
+			envVars[name] = usage
+		}
+		usage.files = append(usage.files, fileName)
+	}
+
+	// invalidNames collects the operations whose files would assign a
+	// variable the shell can't, failing the generation
+	var invalidNames error
+	generatePathItem := func(path string, item *openapi3.PathItem) {
+		maybeMake := func(method string, op *openapi3.Operation) error {
+			if op == nil || !filter.matches(path, op) {
+				return nil
+			}
+			fileName := fileNames[op]
+
+			curl := new(bytes.Buffer)
+			fmt.Fprintf(curl, "# %s %s\n", strings.ToUpper(method), path)
+			if op.Summary != "" {
+				fmt.Fprintf(curl, "# %s\n", op.Summary)
+			}
+			writeOperationDocs(curl, op)
+			fmt.Fprintf(curl, "\n#### Variables ####\n")
+
+			params := extractRequestParameters(path, op, doc)
+			bodyInfo := extractRequestBody(op, doc)
+			if !opts.IncludeOptional {
+				for _, param := range params.queryParams {
+					param.commented = !param.required
+				}
+			}
+			if renames := resolveVariableCollisions(&params, &bodyInfo); len(renames) > 0 {
+				fmt.Fprintf(curl, "\n")
+				for _, rename := range renames {
+					fmt.Fprintf(curl, "# Warning: %s\n", rename)
+				}
+			}
+			if err := checkVariableNames(&params, &bodyInfo); err != nil {
+				invalidNames = errors.Join(invalidNames, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err))
+				return nil
+			}
+
+			if opts.NoServer {
+				fmt.Fprintf(curl, "\n# set via envs.yml\nBASE_URL=\"\"\n")
+			} else {
+				fmt.Fprintf(curl, "\nBASE_URL=%s\n", shellquote.DoubleQuote(baseURL))
+			}
+			if len(opts.CurlOpts) > 0 {
+				fmt.Fprintf(curl, "# Extra curl options, expanded unquoted so they split into words\n")
+				fmt.Fprintf(curl, "CURL_OPTS=%s\n", shellquote.DoubleQuote(strings.Join(opts.CurlOpts, " ")))
+			}
+			writeVariableSections(curl, params, bodyInfo)
+			buildCurlCommand(curl, method, path, params, op, bodyInfo, opts.CurlOpts, opts.Accept)
+
+			recordEnvVar("BASE_URL", baseURL, fileName)
+			if len(opts.CurlOpts) > 0 {
+				recordEnvVar("CURL_OPTS", shellquote.EscapeDoubleQuoted(strings.Join(opts.CurlOpts, " ")), fileName)
+			}
+			for _, param := range params.headerParams {
+				recordEnvVar(param.varName, shellquote.EscapeDoubleQuoted(determineParameterValue(param)), fileName)
+			}
+			if opts.EnvsIncludeBody {
+				for k, v := range bodyInfo.bodyVars {
+					recordEnvVar(bodyInfo.varName(k), shellquote.EscapeDoubleQuoted(bodyVariableValue(v)), fileName)
+				}
+			}
+
+			return writeCurl(fileName, curl.String())
+		}
+
+		operations := item.Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			if err := maybeMake(method, operations[method]); err != nil {
+				fmt.Fprintf(warnings, "Warning: failed to generate %s %s: %v\n", method, path, err)
+			}
+		}
+	}
+
+	for _, paths := range []*openapi3.Paths{doc.Paths, webhooks} {
+		items := paths.Map()
+		keys := make([]string, 0, len(items))
+		for path := range items {
+			keys = append(keys, path)
+		}
+		sort.Strings(keys)
+		for _, path := range keys {
+			if items[path] != nil {
+				generatePathItem(path, items[path])
+			}
+		}
+	}
+	if invalidNames != nil {
+		return result, invalidNames
+	}
+
+	// A filtered run only generates a few files, so everything else would
+	// look orphaned
+	if (opts.ChangedOnly || opts.Prune) && !filter.active() {
+		orphaned, err := findOrphanedFiles(outDir, generated)
+		if err != nil {
+			fmt.Fprintf(warnings, "Warning: failed to look for orphaned files: %v\n", err)
+		}
+		result.Orphaned = orphaned
+	}
+
+	devBaseURL := DefaultDevBaseURL
+	if opts.BaseURL != "" {
+		devBaseURL = opts.BaseURL
+	}
+	envsFile := filepath.Join(outDir, "envs.yml")
+	if _, err := os.Stat(envsFile); err == nil {
+		result.EnvsFileKept = true
+	} else if err := write("envs.yml", renderEnvsFile(envVars, devBaseURL)); err != nil {
+		fmt.Fprintf(warnings, "Warning: failed to create envs.yml: %v\n", err)
+	}
+
+	if opts.Prune {
+		for _, name := range result.Orphaned {
+			if err := os.Remove(filepath.Join(outDir, name)); err != nil {
+				fmt.Fprintf(warnings, "Warning: failed to remove %s: %v\n", name, err)
+				continue
+			}
+			result.Removed = append(result.Removed, name)
+		}
+	}
+
+	for name := range generated {
+		result.Files = append(result.Files, name)
+	}
+	sort.Strings(result.Files)
+	return result, nil
+}
+
+// active reports whether any filter values were given
+func (f operationFilter) active() bool {
+	return len(f.operationIDs) > 0 || len(f.paths) > 0
+}
+
+// matches reports whether the operation at path is selected by the filter
+func (f operationFilter) matches(path string, op *openapi3.Operation) bool {
+	if !f.active() {
+		return true
+	}
+	for _, id := range f.operationIDs {
+		if op.OperationID == id {
+			return true
+		}
+	}
+	for _, p := range f.paths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// unmatched returns the filter values, formatted as flags, that select no
+// operation in any of the given path sets
+func (f operationFilter) unmatched(pathSets ...*openapi3.Paths) []string {
+	ids := map[string]bool{}
+	paths := map[string]bool{}
+	for _, set := range pathSets {
+		if set == nil {
+			continue
+		}
+		for path, item := range set.Map() {
+			if item == nil {
+				continue
+			}
+			for _, op := range item.Operations() {
+				ids[op.OperationID] = true
+				paths[path] = true
+			}
+		}
+	}
+
+	var unmatched []string
+	for _, id := range f.operationIDs {
+		if !ids[id] {
+			unmatched = append(unmatched, "--operation-id "+id)
+		}
+	}
+	for _, p := range f.paths {
+		if !paths[p] {
+			unmatched = append(unmatched, "--path "+p)
+		}
+	}
+	return unmatched
+}
+
+// ForEachOperation calls fn for every operation in paths, ordered by path
+// and then method
+func ForEachOperation(paths *openapi3.Paths, fn func(path, method string, item *openapi3.PathItem, op *openapi3.Operation)) {
+	if paths == nil {
+		return
+	}
+	items := paths.Map()
+	sorted := make([]string, 0, len(items))
+	for path := range items {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		item := items[path]
+		if item == nil {
+			continue
+		}
+		operations := item.Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			fn(path, method, item, operations[method])
+		}
+	}
+}
+
+// SanitizePath turns an API path into a string safe to use in a file name
+func SanitizePath(s string) string {
+	s = strings.Trim(s, "/")
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "{", "_")
+	s = strings.ReplaceAll(s, "}", "")
+	re := regexp.MustCompile(`[^a-zA-Z0-9_\-\.]`)
+	s = re.ReplaceAllString(s, "")
+	if s == "" {
+		return "root"
+	}
+	return s
+}
+
+// parseNameTemplate parses a --name-template and renders it once against
+// sample data, so unknown fields are reported before anything is generated
+func parseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --name-template: %w", err)
+	}
+	sample := &fileNameData{Method: "GET", Path: "/example", SanitizedPath: "example", Tag: "example", operationID: "example"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("invalid --name-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// planFileNames renders the file name of every selected operation up front,
+// keyed by operation, so an unusable template fails before any file is
+// written. Path sets are keyed by the subdirectory their files go in
+func planFileNames(tmpl *template.Template, filter operationFilter, pathSets map[string]*openapi3.Paths) (map[*openapi3.Operation]string, error) {
+	dirs := make([]string, 0, len(pathSets))
+	for dir := range pathSets {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	fileNames := map[*openapi3.Operation]string{}
+	owners := map[string]string{}
+	var planErr error
+	for _, dir := range dirs {
+		ForEachOperation(pathSets[dir], func(path, method string, item *openapi3.PathItem, op *openapi3.Operation) {
+			if planErr != nil || !filter.matches(path, op) {
+				return
+			}
+			name, err := renderFileName(tmpl, dir, path, method, op)
+			if err != nil {
+				planErr = err
+				return
+			}
+			owner := fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+			if other, ok := owners[name]; ok {
+				planErr = fmt.Errorf("--name-template gives %s to both %s and %s", name, other, owner)
+				return
+			}
+			owners[name] = owner
+			fileNames[op] = name
+		})
+	}
+	return fileNames, planErr
+}
+
+// renderFileName renders the file name of one operation relative to the
+// output directory. Slashes in the result create subdirectories
+func renderFileName(tmpl *template.Template, dir, path, method string, op *openapi3.Operation) (string, error) {
+	data := &fileNameData{
+		Method:        strings.ToUpper(method),
+		Path:          path,
+		SanitizedPath: SanitizePath(path),
+		Tag:           "untagged",
+		operationID:   op.OperationID,
+	}
+	if len(op.Tags) > 0 {
+		data.Tag = op.Tags[0]
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("--name-template failed for %s %s: %w", data.Method, path, err)
+	}
+	if data.usedOperationID && op.OperationID == "" {
+		return "", fmt.Errorf("--name-template uses .OperationID but %s %s has no operationId", data.Method, path)
+	}
+
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("--name-template renders an empty file name for %s %s", data.Method, path)
+	}
+	name = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("--name-template renders %s for %s %s, outside the collection", name, data.Method, path)
+	}
+	return filepath.Join(dir, name+".curl"), nil
+}
+
+// findOrphanedFiles lists the .curl files under outDir that this run did not
+// generate, i.e. ones whose operations have been removed from the spec
+func findOrphanedFiles(outDir string, generated map[string]bool) ([]string, error) {
+	var orphaned []string
+	err := run.WalkCurlFiles(outDir, func(path string) error {
+		name, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return err
+		}
+		if !generated[name] {
+			orphaned = append(orphaned, name)
+		}
+		return nil
+	})
+	sort.Strings(orphaned)
+	return orphaned, err
+}
+
+// LoadSpec loads the spec from a file path or http(s) URL the way Generate
+// does: if some of its refs cannot be resolved, its operations are resolved
+// one at a time instead and the broken ones are left out, with a line on
+// warnings for each
+func LoadSpec(spec string, warnings io.Writer) (*openapi3.T, error) {
+	doc, _, err := loadSpec(spec, specInput{}, warnings)
+	return doc, err
+}
+
+// SpecLoader returns a loader resolving the refs of the spec at a file path
+// or http(s) URL, along with the location to load it from, for loading it
+// strictly, failing on a ref it can't resolve
+func SpecLoader(spec string) (*openapi3.Loader, *url.URL, error) {
+	location, err := specLocation(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newSpecResolver(location, specInput{}, io.Discard).loader(), location, nil
+}
+
+// loadSpec loads the spec from a file path or URL and returns it with the
+// resolver its relative $refs are resolved through. If some refs cannot be
+// resolved, operations are resolved one at a time instead and the broken ones
+// are left out with a warning so the rest of the collection still generates
+func loadSpec(openapiFile string, input specInput, warnings io.Writer) (*openapi3.T, *specResolver, error) {
+	location, err := specLocation(openapiFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver := newSpecResolver(location, input, warnings)
+
+	doc, err := resolver.loader().LoadFromURI(location)
+	if err == nil {
+		resolver.numbers.restorePaths(doc.Paths)
+		return doc, resolver, nil
+	}
+
+	data, readErr := resolver.read(resolver.loader(), location)
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+	raw := &openapi3.T{}
+	if yaml.Unmarshal(data, raw) != nil {
+		name := openapiFile
+		if input.stdin != nil {
+			name = "stdin"
+		}
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	raw.Paths = resolver.resolveOperations(raw, raw.Paths.Map())
+	resolver.numbers.restorePaths(raw.Paths)
+	return raw, resolver, nil
+}
+
+// specLocation turns the spec argument into the URL its refs resolve against;
+// local paths are made absolute so the working directory doesn't matter, and
+// the refs of a spec on stdin resolve against it
+func specLocation(openapiFile string) (*url.URL, error) {
+	if isSpecURL(openapiFile) {
+		location, err := url.Parse(openapiFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL '%s': %w", openapiFile, err)
+		}
+		return location, nil
+	}
+	abs, err := filepath.Abs(openapiFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path '%s': %w", openapiFile, err)
+	}
+	return &url.URL{Path: filepath.ToSlash(abs)}, nil
+}
+
+// specResolver resolves refs against the spec's location. Reads are cached
+// per resolver rather than in kin-openapi's process-wide cache, so loading a
+// spec again picks up edits made in the meantime
+type specResolver struct {
+	location *url.URL
+	read     openapi3.ReadFromURIFunc
+	// numbers are the integer literals read that kin-openapi's float64s
+	// lose digits of, restored in the examples loaded
+	numbers numberLiterals
+	// warnings receives the operations left out for refs that fail
+	warnings io.Writer
+}
+
+func newSpecResolver(location *url.URL, input specInput, warnings io.Writer) *specResolver {
+	read := openapi3.ReadFromURIs(readFromStdin(location, input.stdin), readFromHTTP(location, input.headers), openapi3.ReadFromFile)
+	numbers := numberLiterals{}
+	return &specResolver{
+		location: location,
+		read:     openapi3.URIMapCache(numbers.recording(gunzipped(read))),
+		numbers:  numbers,
+		warnings: warnings,
+	}
+}
+
+// loader returns a fresh loader sharing the resolver's read cache
+func (r *specResolver) loader() *openapi3.Loader {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = r.read
+	return loader
+}
+
+// resolveOperations resolves the refs of each operation on its own, warning
+// about and dropping the ones that fail. Each gets a fresh loader since a
+// failed resolution leaves the loader's bookkeeping in a half-visited state
+func (r *specResolver) resolveOperations(doc *openapi3.T, items map[string]*openapi3.PathItem) *openapi3.Paths {
+	resolved := openapi3.NewPaths()
+
+	paths := make([]string, 0, len(items))
+	for path := range items {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := items[path]
+		if item == nil {
+			continue
+		}
+
+		// A path item that is itself a $ref has no operations until resolved
+		if item.Ref != "" {
+			scratch := &openapi3.T{OpenAPI: doc.OpenAPI, Paths: openapi3.NewPaths(openapi3.WithPath(path, item))}
+			if err := r.loader().ResolveRefsIn(scratch, r.location); err != nil {
+				fmt.Fprintf(r.warnings, "Warning: skipping %s: %v\n", path, err)
+				continue
+			}
+			resolved.Set(path, item)
+			continue
+		}
+
+		operations := item.Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			scratch := &openapi3.T{OpenAPI: doc.OpenAPI}
+			scratch.AddOperation(path, method, operations[method])
+			scratch.Paths.Value(path).Parameters = item.Parameters
+			if err := r.loader().ResolveRefsIn(scratch, r.location); err != nil {
+				fmt.Fprintf(r.warnings, "Warning: skipping %s %s: %v\n", method, path, err)
+				continue
+			}
+			if resolved.Value(path) == nil {
+				resolved.Set(path, &openapi3.PathItem{Summary: item.Summary, Description: item.Description, Parameters: item.Parameters})
+			}
+			resolved.Value(path).SetOperation(method, operations[method])
+		}
+	}
+
+	return resolved
+}
+
+// loadWebhooks decodes the OpenAPI 3.1 webhooks section, which kin-openapi
+// keeps as a raw value in the document's Extensions, into paths named after
+// each webhook with their refs resolved
+func loadWebhooks(doc *openapi3.T, resolver *specResolver) (*openapi3.Paths, error) {
+	raw, ok := doc.Extensions["webhooks"]
+	if !ok || raw == nil {
+		return openapi3.NewPaths(), nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return openapi3.NewPaths(), err
+	}
+	var webhooks map[string]*openapi3.PathItem
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return openapi3.NewPaths(), err
+	}
+
+	items := make(map[string]*openapi3.PathItem, len(webhooks))
+	for name, item := range webhooks {
+		items["/"+strings.TrimPrefix(name, "/")] = item
+	}
+	paths := resolver.resolveOperations(doc, items)
+	resolver.numbers.restorePaths(paths)
+	return paths, nil
+}
+
+// renderEnvsFile builds an envs.yml with dev and staging environments listing
+// every variable used across the collection, BASE_URL first
+func renderEnvsFile(envVars map[string]*envVarUsage, devBaseURL string) string {
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		if name != "BASE_URL" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := envVars["BASE_URL"]; ok {
+		names = append([]string{"BASE_URL"}, names...)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Environment configurations generated from the collection\n")
+	buf.WriteString("# Usage: curly -e dev\n")
+	buf.WriteString("environments:\n")
+	for _, env := range []struct{ name, baseURL string }{{"dev", devBaseURL}, {"staging", stagingBaseURL}} {
+		fmt.Fprintf(&buf, "  %s:\n", env.name)
+		if len(names) == 0 {
+			fmt.Fprintf(&buf, "    BASE_URL: %q\n", env.baseURL)
+			continue
+		}
+		for _, name := range names {
+			usage := envVars[name]
+			value := usage.value
+			if name == "BASE_URL" {
+				value = env.baseURL
+			}
+			fmt.Fprintf(&buf, "    # used by: %s\n", summarizeFiles(usage.files, 5))
+			fmt.Fprintf(&buf, "    %s: %q\n", name, value)
+		}
+	}
+	return buf.String()
+}
+
+// summarizeFiles joins file names for a comment, collapsing long lists
+func summarizeFiles(files []string, limit int) string {
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+	if len(sorted) <= limit {
+		return strings.Join(sorted, ", ")
+	}
+	return fmt.Sprintf("%s (+%d more)", strings.Join(sorted[:limit], ", "), len(sorted)-limit)
+}
+
+// RenderEndpoint renders the .curl file of an endpoint without a spec,
+// laid out like the generated ones, with variables for its path parameters
+// and an empty JSON body for methods that take one
+func RenderEndpoint(method, path string) string {
+	op := openapi3.NewOperation()
+	params := parameterSet{pathParams: extractPathParamsInfo(path, op)}
+
+	var bodyInfo requestBodyInfo
+	switch method {
+	case "POST", "PUT", "PATCH":
+		bodyInfo = requestBodyInfo{contentType: "application/json", exampleBody: "{}"}
+	}
+
+	curl := new(bytes.Buffer)
+	fmt.Fprintf(curl, "# %s %s\n", method, path)
+	fmt.Fprintf(curl, "\n#### Variables ####\n")
+	fmt.Fprintf(curl, "\nBASE_URL=%s\n", shellquote.DoubleQuote(DefaultDevBaseURL))
+	writeVariableSections(curl, params, bodyInfo)
+	buildCurlCommand(curl, method, path, params, op, bodyInfo, nil, nil)
+	return curl.String()
+}
+
+// resolveBaseURL picks the BASE_URL written into generated files, letting the
+// --base-url flag win over the first server declared in the spec
+func resolveBaseURL(doc *openapi3.T, opts Options) string {
+	if opts.NoServer {
+		return ""
+	}
+	if opts.BaseURL != "" {
+		return opts.BaseURL
+	}
+	if len(doc.Servers) > 0 && doc.Servers[0].URL != "" {
+		return doc.Servers[0].URL
+	}
+	return "http://localhost"
+}
+
+// extractRequestParameters extracts all parameters from an OpenAPI operation
+func extractRequestParameters(path string, op *openapi3.Operation, doc *openapi3.T) parameterSet {
+	params := parameterSet{
+		pathParams:     extractPathParamsInfo(path, op),
+		queryParams:    []*parameterInfo{},
+		headerParams:   []*parameterInfo{},
+		formDataParams: []*parameterInfo{},
+		bodyVars:       map[string]any{},
+	}
+
+	if op.Parameters == nil {
+		return params
+	}
+
+	for _, paramRef := range op.Parameters {
+		if paramRef.Value == nil {
+			continue
+		}
+
+		param := paramRef.Value
+		info := createParameterInfo(param)
+
+		switch param.In {
+		case "query":
+			params.queryParams = append(params.queryParams, info)
+		case "header":
+			params.headerParams = append(params.headerParams, info)
+		case "formData":
+			params.formDataParams = append(params.formDataParams, info)
+		}
+	}
+
+	return params
+}
+
+// variableBinding is one source of shell variables in a generated file: a
+// parameter or a top-level body field
+type variableBinding struct {
+	label  string
+	prefix string
+	name   string
+	names  []string
+	rename func(string)
+}
+
+// variableBindings returns the bindings of the variables params and bodyInfo
+// assign, renaming them renames the parameters and body fields
+func variableBindings(params *parameterSet, bodyInfo *requestBodyInfo) []*variableBinding {
+	var bindings []*variableBinding
+	addParams := func(source, prefix string, list []*parameterInfo) {
+		for _, param := range list {
+			names := []string{param.varName}
+			if source == "query" {
+				names = nil
+				for _, v := range expandQueryParameter(param) {
+					names = append(names, v.varName)
+				}
+			}
+			bindings = append(bindings, &variableBinding{
+				label:  fmt.Sprintf("%s parameter %q", source, param.name),
+				prefix: prefix,
+				name:   param.varName,
+				names:  names,
+				rename: func(name string) { param.varName = name },
+			})
+		}
+	}
+	addParams("path", "PATH", params.pathParams)
+	addParams("query", "QUERY", params.queryParams)
+	addParams("header", "HEADER", params.headerParams)
+	addParams("form", "FORM", params.formDataParams)
+
+	keys := make([]string, 0, len(bodyInfo.bodyVars))
+	for k := range bodyInfo.bodyVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bindings = append(bindings, &variableBinding{
+			label:  fmt.Sprintf("body field %q", key),
+			prefix: "BODY",
+			name:   bodyInfo.varName(key),
+			names:  []string{bodyInfo.varName(key)},
+			rename: func(name string) {
+				if bodyInfo.varNames == nil {
+					bodyInfo.varNames = map[string]string{}
+				}
+				bodyInfo.varNames[key] = name
+			},
+		})
+	}
+
+	if bodyInfo.uploadVar != "" {
+		bindings = append(bindings, &variableBinding{
+			label:  "upload file",
+			prefix: "BODY",
+			name:   bodyInfo.uploadVar,
+			names:  []string{bodyInfo.uploadVar},
+			rename: func(name string) { bodyInfo.uploadVar = name },
+		})
+	}
+	return bindings
+}
+
+// checkVariableNames fails when a variable params or bodyInfo assign isn't a
+// valid shell name, which the shell would expand to something else entirely
+func checkVariableNames(params *parameterSet, bodyInfo *requestBodyInfo) error {
+	for _, b := range variableBindings(params, bodyInfo) {
+		for _, name := range b.names {
+			if !run.VarNamePattern.MatchString(name) {
+				return fmt.Errorf("%s is bound to %s, which isn't a valid shell variable name", b.label, name)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveVariableCollisions renames variables that more than one parameter or
+// body field would assign, or that would shadow a reserved name, by prefixing
+// them with their source (PATH_ID, BODY_ID). The body is re-rendered so the
+// heredoc references follow. It returns a note per rename for the file
+func resolveVariableCollisions(params *parameterSet, bodyInfo *requestBodyInfo) []string {
+	bindings := variableBindings(params, bodyInfo)
+
+	owners := map[string][]string{}
+	for _, name := range reservedVarNames {
+		owners[name] = append(owners[name], "the generated "+name)
+	}
+	for _, b := range bindings {
+		for _, name := range b.names {
+			owners[name] = append(owners[name], b.label)
+		}
+	}
+
+	var renames []string
+	for _, b := range bindings {
+		var others []string
+		for _, name := range b.names {
+			for _, owner := range owners[name] {
+				if owner != b.label {
+					others = append(others, owner)
+				}
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+
+		renamed := b.prefix + "_" + b.name
+		for i := 2; len(owners[renamed]) > 0; i++ {
+			renamed = fmt.Sprintf("%s_%s_%d", b.prefix, b.name, i)
+		}
+		owners[renamed] = append(owners[renamed], b.label)
+		b.rename(renamed)
+		renames = append(renames, fmt.Sprintf("%s renamed to %s, %s is also used by %s", b.label, renamed, b.name, strings.Join(others, ", ")))
+	}
+
+	if len(bodyInfo.varNames) > 0 {
+		bodyInfo.exampleBody = formatExampleWithVarNames(bodyInfo.example, bodyInfo.contentType, bodyInfo.varNames)
+	}
+	return renames
+}
+
+// createParameterInfo creates a parameterInfo struct from an OpenAPI parameter
+func createParameterInfo(param *openapi3.Parameter) *parameterInfo {
+	info := &parameterInfo{
+		name:     param.Name,
+		varName:  shellVarName(param.Name),
+		required: param.Required,
+	}
+
+	if param.Description != "" {
+		info.description = param.Description
+	}
+
+	if sm, err := param.SerializationMethod(); err == nil {
+		info.style = sm.Style
+		info.explode = sm.Explode
+	}
+
+	if param.Schema != nil && param.Schema.Value != nil {
+		schema := param.Schema.Value
+		info.schema = schema
+
+		// Get type
+		info.paramType = schemaType(schema)
+
+		// Get default value
+		if schema.Default != nil {
+			info.defaultValue = schema.Default
+		}
+
+		// Get enum values
+		if len(schema.Enum) > 0 {
+			info.enumValues = schema.Enum
+		}
+
+		// Get example
+		if example := SchemaExample(schema); example != nil {
+			info.example = example
+		}
+	}
+
+	// Parameter-level example takes precedence
+	if param.Example != nil {
+		info.example = param.Example
+	}
+
+	return info
+}
+
+// extractPathParamsInfo extracts path parameters with their metadata
+func extractPathParamsInfo(path string, op *openapi3.Operation) []*parameterInfo {
+	paramNames := PathParams(path)
+	result := make([]*parameterInfo, 0, len(paramNames))
+
+	for _, name := range paramNames {
+		info := &parameterInfo{
+			name:     name,
+			varName:  shellVarName(name),
+			required: true,
+		}
+
+		// Try to find matching parameter definition
+		if op.Parameters != nil {
+			for _, paramRef := range op.Parameters {
+				if paramRef.Value != nil && paramRef.Value.In == "path" && paramRef.Value.Name == name {
+					param := paramRef.Value
+					if param.Description != "" {
+						info.description = param.Description
+					}
+					if param.Schema != nil && param.Schema.Value != nil {
+						schema := param.Schema.Value
+						info.paramType = schemaType(schema)
+						if example := SchemaExample(schema); example != nil {
+							info.example = example
+						}
+						if len(schema.Enum) > 0 {
+							info.enumValues = schema.Enum
+						}
+					}
+					if param.Example != nil {
+						info.example = param.Example
+					}
+					break
+				}
+			}
+		}
+
+		result = append(result, info)
+	}
+
+	return result
+}
+
+// SendsPlaceholderBody reports whether the file generated for op sends a
+// placeholder body, its request body having neither a schema nor an example
+// to build one from, nor a file to upload
+func SendsPlaceholderBody(op *openapi3.Operation, doc *openapi3.T) bool {
+	body := extractRequestBody(op, doc)
+	return op.RequestBody != nil && body.exampleBody == "" && body.uploadVar == ""
+}
+
+// extractRequestBody extracts request body information from an OpenAPI operation
+func extractRequestBody(op *openapi3.Operation, doc *openapi3.T) requestBodyInfo {
+	bodyInfo := requestBodyInfo{
+		bodyVars: make(map[string]any),
+	}
+
+	// OpenAPI 3.0 style (requestBody)
+	if op.RequestBody != nil && op.RequestBody.Value != nil {
+		for ct, mediaType := range op.RequestBody.Value.Content {
+			bodyInfo.contentType = ct
+			var schema *openapi3.Schema
+			if mediaType.Schema != nil {
+				schema = mediaType.Schema.Value
+			}
+			if isBinaryBody(ct, schema) {
+				// A wildcard like image/* isn't a valid Content-Type to send
+				if strings.Contains(ct, "*") {
+					bodyInfo.contentType = "application/octet-stream"
+				}
+				bodyInfo.uploadVar = "UPLOAD_FILE"
+				bodyInfo.uploadHints = uploadHints(ct, schema)
+				return bodyInfo
+			}
+			if mediaType.Example != nil {
+				bodyInfo.bodyVars = extractBodyVariablesFromAny(mediaType.Example)
+				bodyInfo.exampleBody = formatExampleWithVars(mediaType.Example, bodyInfo.contentType)
+				bodyInfo.example = mediaType.Example
+				return bodyInfo
+			} else if len(mediaType.Examples) > 0 {
+				for _, exampleRef := range mediaType.Examples {
+					if exampleRef.Value != nil && exampleRef.Value.Value != nil {
+						bodyInfo.bodyVars = extractBodyVariablesFromAny(exampleRef.Value.Value)
+						bodyInfo.exampleBody = formatExampleWithVars(exampleRef.Value.Value, bodyInfo.contentType)
+						bodyInfo.example = exampleRef.Value.Value
+						return bodyInfo
+					}
+				}
+				return bodyInfo
+			} else if mediaType.Schema != nil {
+				schemaExample := ExampleFromSchema(mediaType.Schema.Value, doc)
+				if schemaExample != nil {
+					bodyInfo.bodyVars = extractBodyVariablesFromAny(schemaExample)
+					bodyInfo.exampleBody = formatExampleWithVars(schemaExample, bodyInfo.contentType)
+					bodyInfo.example = schemaExample
+					return bodyInfo
+				}
+			}
+		}
+	}
+
+	// Swagger 2.0 style (parameters with in: "body")
+	if op.Parameters != nil {
+		for _, paramRef := range op.Parameters {
+			if paramRef.Value != nil && paramRef.Value.In == "body" && paramRef.Value.Schema != nil {
+				bodyInfo.contentType = "application/json"
+				schema := paramRef.Value.Schema.Value
+				schemaExample := ExampleFromSchema(schema, doc)
+				if schemaExample != nil {
+					bodyInfo.bodyVars = extractBodyVariablesFromAny(schemaExample)
+					bodyInfo.exampleBody = formatExampleWithVars(schemaExample, bodyInfo.contentType)
+					bodyInfo.example = schemaExample
+					return bodyInfo
+				}
+			}
+		}
+	}
+
+	return bodyInfo
+}
+
+// writeVariableSections writes all variable sections to the curl buffer
+func writeVariableSections(curl *bytes.Buffer, params parameterSet, bodyInfo requestBodyInfo) {
+	if len(params.pathParams) > 0 {
+		fmt.Fprintf(curl, "\n#### Path Parameters ####\n")
+		for _, param := range params.pathParams {
+			writeParameterVariable(curl, param)
+		}
+	}
+	if len(params.queryParams) > 0 {
+		fmt.Fprintf(curl, "\n#### Query Parameters ####\n")
+		for _, param := range params.queryParams {
+			writeQueryParameterVariables(curl, param)
+		}
+	}
+	if len(params.headerParams) > 0 {
+		fmt.Fprintf(curl, "\n#### Headers ####\n")
+		for _, param := range params.headerParams {
+			writeParameterVariable(curl, param)
+		}
+	}
+	if len(params.formDataParams) > 0 {
+		fmt.Fprintf(curl, "\n#### Form Data ####\n")
+		for _, param := range params.formDataParams {
+			writeParameterVariable(curl, param)
+		}
+	}
+	if bodyInfo.uploadVar != "" {
+		fmt.Fprintf(curl, "\n#### Body ####\n")
+		for _, hint := range bodyInfo.uploadHints {
+			fmt.Fprintf(curl, "# %s\n", hint)
+		}
+		fmt.Fprintf(curl, "%s=\"./path/to/file\"\n", bodyInfo.uploadVar)
+	}
+	if len(bodyInfo.bodyVars) > 0 {
+		fmt.Fprintf(curl, "\n#### Body ####\n")
+		keys := make([]string, 0, len(bodyInfo.bodyVars))
+		for k := range bodyInfo.bodyVars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(curl, "%s=%s\n", bodyInfo.varName(k), formatVariableValue(bodyInfo.bodyVars[k]))
+		}
+	}
+}
+
+// writeParameterVariable writes a parameter variable with helpful comments
+func writeParameterVariable(curl *bytes.Buffer, param *parameterInfo) {
+	writeParameterComments(curl, param)
+
+	// Determine the value to use
+	value := determineParameterValue(param)
+
+	writeVariableLine(curl, param, param.varName, value)
+}
+
+// writeVariableLine writes the assignment of a parameter's variable. That of
+// a parameter left out of the request by default is assigned empty, so the
+// shell doesn't pick the variable up from the environment, with its value
+// commented out below for the user to uncomment
+func writeVariableLine(curl *bytes.Buffer, param *parameterInfo, name, value string) {
+	if param.commented {
+		fmt.Fprintf(curl, "%s=\"\"\n# %s=%s\n", name, name, shellquote.DoubleQuote(value))
+		return
+	}
+	fmt.Fprintf(curl, "%s=%s\n", name, shellquote.DoubleQuote(value))
+}
+
+// writeQueryParameterVariables writes the variables a query parameter is
+// serialized into, explaining the serialization when it isn't a plain key=value
+func writeQueryParameterVariables(curl *bytes.Buffer, param *parameterInfo) {
+	vars := expandQueryParameter(param)
+	if len(vars) == 1 && vars[0].varName == param.varName && !isArrayParameter(param) {
+		writeParameterVariable(curl, param)
+		return
+	}
+
+	writeParameterComments(curl, param)
+
+	fragments := make([]string, 0, len(vars))
+	for _, v := range vars {
+		fragments = append(fragments, fmt.Sprintf("%s=${%s}", v.key, v.varName))
+	}
+	serialized := strings.Join(fragments, "&")
+
+	switch {
+	case param.style == "deepObject":
+		fmt.Fprintf(curl, "# style: deepObject - one variable per property, sent as %s\n", serialized)
+	case param.explode:
+		fmt.Fprintf(curl, "# style: %s, explode: true - repeat the key once per value, sent as %s\n", param.style, serialized)
+	default:
+		fmt.Fprintf(curl, "# style: %s, explode: false - %s-separated values, sent as %s\n", param.style, arrayDelimiterName(param.style), serialized)
+	}
+
+	for _, v := range vars {
+		writeVariableLine(curl, param, v.varName, v.value)
+	}
+}
+
+// writeParameterComments writes the description, type and enum hints for a parameter
+func writeParameterComments(curl *bytes.Buffer, param *parameterInfo) {
+	// Build description line
+	var descParts []string
+
+	if param.description != "" {
+		descParts = append(descParts, param.description)
+	}
+
+	// Add type information
+	if param.paramType != "" {
+		typeInfo := fmt.Sprintf("type: %s", param.paramType)
+		if param.required {
+			typeInfo += ", required"
+		} else {
+			typeInfo += ", optional"
+		}
+		descParts = append(descParts, typeInfo)
+	}
+
+	// Write description comment if we have one
+	if len(descParts) > 0 {
+		fmt.Fprintf(curl, "# %s\n", strings.Join(descParts, " - "))
+	}
+
+	if param.commented {
+		fmt.Fprintf(curl, "# Optional, uncomment to send\n")
+	}
+
+	// Add enum values as a hint
+	if len(param.enumValues) > 0 {
+		fmt.Fprintf(curl, "# Valid values: %s\n", formatEnumValues(param.enumValues))
+	} else if isArrayParameter(param) && param.schema.Items != nil && param.schema.Items.Value != nil && len(param.schema.Items.Value.Enum) > 0 {
+		fmt.Fprintf(curl, "# Valid values: %s\n", formatEnumValues(param.schema.Items.Value.Enum))
+	}
+}
+
+// isArrayParameter reports whether a parameter's schema is an array
+func isArrayParameter(param *parameterInfo) bool {
+	return schemaType(param.schema) == "array"
+}
+
+// expandQueryParameter maps a query parameter onto the key=value pairs its
+// style and explode settings serialize it into
+func expandQueryParameter(param *parameterInfo) []queryVariable {
+	schema := param.schema
+
+	if param.style == "deepObject" && schema != nil && len(schema.Properties) > 0 {
+		names := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		vars := make([]queryVariable, 0, len(names))
+		for _, name := range names {
+			prop := schemaParameterInfo(name, schema.Properties[name])
+			vars = append(vars, queryVariable{
+				key:     fmt.Sprintf("%s[%s]", param.name, name),
+				varName: param.varName + "_" + prop.varName,
+				value:   determineParameterValue(prop),
+			})
+		}
+		return vars
+	}
+
+	if !isArrayParameter(param) {
+		return []queryVariable{{key: param.name, varName: param.varName, value: determineParameterValue(param)}}
+	}
+
+	values := arrayParameterValues(param)
+	if !param.explode {
+		return []queryVariable{{
+			key:     param.name,
+			varName: param.varName,
+			value:   strings.Join(values, arrayDelimiter(param.style)),
+		}}
+	}
+
+	second := values[0]
+	if len(values) > 1 {
+		second = values[1]
+	}
+	return []queryVariable{
+		{key: param.name, varName: param.varName + "_1", value: values[0]},
+		{key: param.name, varName: param.varName + "_2", value: second},
+	}
+}
+
+// arrayParameterValues picks example values for an array parameter: its
+// example or default array, else the first item enum values, else a placeholder
+func arrayParameterValues(param *parameterInfo) []string {
+	for _, candidate := range []any{param.example, param.defaultValue} {
+		if arr, ok := candidate.([]any); ok && len(arr) > 0 {
+			values := make([]string, 0, len(arr))
+			for _, v := range arr {
+				values = append(values, formatScalar(v))
+			}
+			return values
+		}
+	}
+
+	var items *parameterInfo
+	if param.schema.Items != nil {
+		items = schemaParameterInfo(param.name, param.schema.Items)
+	} else {
+		items = &parameterInfo{}
+	}
+	if len(items.enumValues) > 1 {
+		return []string{formatScalar(items.enumValues[0]), formatScalar(items.enumValues[1])}
+	}
+	return []string{determineParameterValue(items)}
+}
+
+// schemaParameterInfo builds parameter metadata from a bare schema, used for
+// array items and deepObject properties
+func schemaParameterInfo(name string, ref *openapi3.SchemaRef) *parameterInfo {
+	info := &parameterInfo{
+		name:    name,
+		varName: shellVarName(name),
+	}
+	if ref == nil || ref.Value == nil {
+		return info
+	}
+
+	schema := ref.Value
+	info.schema = schema
+	info.paramType = schemaType(schema)
+	info.defaultValue = schema.Default
+	info.enumValues = schema.Enum
+	info.example = SchemaExample(schema)
+	return info
+}
+
+// arrayDelimiter returns the separator used by non-exploded array styles
+func arrayDelimiter(style string) string {
+	switch style {
+	case "spaceDelimited":
+		return " "
+	case "pipeDelimited":
+		return "|"
+	default:
+		return ","
+	}
+}
+
+// arrayDelimiterName describes arrayDelimiter for generated comments
+func arrayDelimiterName(style string) string {
+	switch style {
+	case "spaceDelimited":
+		return "space"
+	case "pipeDelimited":
+		return "pipe"
+	default:
+		return "comma"
+	}
+}
+
+// determineParameterValue determines the best value to use for a parameter
+func determineParameterValue(param *parameterInfo) string {
+	// Priority: example > default > enum[0] > type-based default
+	if param.example != nil {
+		return formatScalar(param.example)
+	}
+
+	if param.defaultValue != nil {
+		return formatScalar(param.defaultValue)
+	}
+
+	if len(param.enumValues) > 0 {
+		return formatScalar(param.enumValues[0])
+	}
+
+	// Type-based defaults
+	switch param.paramType {
+	case "integer":
+		return "0"
+	case "number":
+		return "0.0"
+	case "boolean":
+		return "false"
+	case "string":
+		return "VALUE"
+	default:
+		return "VALUE"
+	}
+}
+
+// buildCurlCommand builds the curl command string, with accept the preferred
+// response content types
+func buildCurlCommand(curl *bytes.Buffer, method, path string, params parameterSet, op *openapi3.Operation, bodyInfo requestBodyInfo, curlOpts, accept []string) {
+	urlPath := path
+	for _, param := range params.pathParams {
+		urlPath = strings.ReplaceAll(urlPath, "{"+param.name+"}", "${"+param.varName+"}")
+	}
+
+	// GETs hand the query to curl -G so values are URL-encoded when sent;
+	// other methods keep it on the URL with the literal keys encoded
+	useDataURLEncode := strings.EqualFold(method, "GET")
+	// Commented-out parameters are wrapped in ${VAR:+...} so they are only
+	// sent once their variable is uncommented, as it is assigned empty until
+	// then; a commented-out line in the middle of the command would cut off
+	// its line continuations
+	dataArgs := []string{}
+	queryStrs := []string{}
+	optionalQuery := ""
+	for _, param := range params.queryParams {
+		for _, v := range expandQueryParameter(param) {
+			if useDataURLEncode {
+				arg := fmt.Sprintf("--data-urlencode \"%s=${%s}\"", v.key, v.varName)
+				if param.commented {
+					arg = fmt.Sprintf("${%s:+%s}", v.varName, arg)
+				}
+				dataArgs = append(dataArgs, arg)
+				continue
+			}
+			pair := fmt.Sprintf("%s=${%s}", url.QueryEscape(v.key), v.varName)
+			if param.commented {
+				optionalQuery += fmt.Sprintf("${%s:+&%s}", v.varName, pair)
+			} else {
+				queryStrs = append(queryStrs, pair)
+			}
+		}
+	}
+	query := ""
+	if len(queryStrs) > 0 || optionalQuery != "" {
+		query = "?" + strings.Join(queryStrs, "&") + optionalQuery
+	}
+
+	// Brackets would otherwise be read as curl URL globs
+	globOff := ""
+	if strings.ContainsAny(urlPath+query, "[]") {
+		globOff = " -g"
+	}
+
+	getOpt := ""
+	if len(dataArgs) > 0 {
+		getOpt = " -G"
+	}
+
+	extraOpts := ""
+	if len(curlOpts) > 0 {
+		extraOpts = " ${CURL_OPTS}"
+	}
+
+	// The alternatives to the Accept header go above the command, as a
+	// comment between its lines would cut it off
+	if types := responseContentTypes(op); len(types) > 1 && !strings.EqualFold(method, "HEAD") {
+		fmt.Fprintf(curl, "\n# Accepts: %s", strings.Join(types, " | "))
+	}
+	fmt.Fprintf(curl, "\ncurl -s%s%s%s -X %s \"${BASE_URL}%s%s\"", extraOpts, globOff, getOpt, strings.ToUpper(method), urlPath, query)
+	for _, arg := range dataArgs {
+		fmt.Fprintf(curl, " \\\n  %s", arg)
+	}
+
+	// Add headers
+	if bodyInfo.contentType != "" {
+		fmt.Fprintf(curl, " \\\n  -H \"Content-Type: %s\"", bodyInfo.contentType)
+	}
+	if accept := acceptContentType(method, op, accept); accept != "" {
+		fmt.Fprintf(curl, " \\\n  -H \"Accept: %s\"", accept)
+	}
+
+	for _, param := range params.headerParams {
+		fmt.Fprintf(curl, " \\\n  -H \"%s: ${%s}\"", param.name, param.varName)
+	}
+
+	// Add form data or body
+	if len(params.formDataParams) > 0 {
+		addFormDataFields(curl, params.formDataParams)
+	} else if bodyInfo.uploadVar != "" {
+		fmt.Fprintf(curl, " \\\n  --data-binary \"@${%s}\"", bodyInfo.uploadVar)
+	} else if bodyInfo.exampleBody != "" {
+		// Only an unquoted delimiter expands ${VARS}; without any the body is kept literal
+		delimiter := heredocDelimiter(bodyInfo.exampleBody)
+		quoted := "'" + delimiter + "'"
+		if len(bodyInfo.bodyVars) > 0 {
+			quoted = delimiter
+		}
+		fmt.Fprintf(curl, " \\\n  --data-binary @- << %s\n%s\n%s", quoted, bodyInfo.exampleBody, delimiter)
+	} else if op.RequestBody != nil {
+		fmt.Fprintf(curl, " \\\n  -d '{\"foo\": \"bar\"}'")
+	}
+
+	fmt.Fprintf(curl, "\n")
+}
+
+// responseContentTypes returns the content types declared by the operation's
+// 2xx responses, in status code order
+func responseContentTypes(op *openapi3.Operation) []string {
+	if op.Responses == nil {
+		return nil
+	}
+
+	statuses := []string{}
+	for status := range op.Responses.Map() {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+
+	seen := map[string]bool{}
+	types := []string{}
+	for _, status := range statuses {
+		resp := op.Responses.Value(status)
+		if resp == nil || resp.Value == nil {
+			continue
+		}
+		cts := make([]string, 0, len(resp.Value.Content))
+		for ct := range resp.Value.Content {
+			cts = append(cts, ct)
+		}
+		sort.Strings(cts)
+		for _, ct := range cts {
+			if !seen[ct] {
+				seen[ct] = true
+				types = append(types, ct)
+			}
+		}
+	}
+	return types
+}
+
+// acceptContentType picks the Accept header for an operation: the first of
+// preferred the responses offer, then JSON when they offer it, otherwise the
+// first declared type. Operations without response content, such as HEAD or
+// 204-only ones, get no Accept header
+func acceptContentType(method string, op *openapi3.Operation, preferred []string) string {
+	if strings.EqualFold(method, "HEAD") {
+		return ""
+	}
+
+	types := responseContentTypes(op)
+	if len(types) == 0 {
+		return ""
+	}
+	for _, want := range preferred {
+		for _, ct := range types {
+			if strings.EqualFold(ct, want) {
+				return ct
+			}
+		}
+	}
+	for _, ct := range types {
+		if ct == "application/json" {
+			return ct
+		}
+	}
+	for _, ct := range types {
+		if strings.HasSuffix(ct, "+json") || strings.HasSuffix(ct, "/json") {
+			return ct
+		}
+	}
+	return types[0]
+}
+
+// addFormDataFields adds form data fields to the curl command
+func addFormDataFields(curl *bytes.Buffer, formDataParams []*parameterInfo) {
+	for _, param := range formDataParams {
+		lowerName := strings.ToLower(param.name)
+		if strings.Contains(lowerName, "file") || strings.Contains(lowerName, "image") || strings.Contains(lowerName, "attachment") {
+			fmt.Fprintf(curl, " \\\n  -F \"%s=@${%s}\"", param.name, param.varName)
+		} else {
+			fmt.Fprintf(curl, " \\\n  -F \"%s=${%s}\"", param.name, param.varName)
+		}
+	}
+}
+
+// PathParams returns the names of the parameters of an API path, like id
+// for /users/{id}, in order
+func PathParams(path string) []string {
+	re := regexp.MustCompile(`\{([^}]+)\}`)
+	matches := re.FindAllStringSubmatch(path, -1)
+	params := []string{}
+	for _, match := range matches {
+		if len(match) > 1 {
+			params = append(params, match[1])
+		}
+	}
+	return params
+}
+
+// extractBodyVariables extracts top-level fields from example body as variables
+func extractBodyVariables(example any, prefix string) map[string]any {
+	vars := make(map[string]any)
+
+	switch v := example.(type) {
+	case map[string]any:
+		for key, value := range v {
+			varName := key
+			if prefix != "" {
+				varName = prefix + "_" + key
+			}
+			// Only extract primitives and simple values
+			switch value.(type) {
+			case string, int, int64, float64, json.Number, bool, nil:
+				vars[varName] = value
+			case map[string]any, []any:
+				// Don't extract nested objects/arrays - keep them inline
+				continue
+			default:
+				// Try to extract as string
+				vars[varName] = formatScalar(value)
+			}
+		}
+	}
+
+	return vars
+}
+
+// extractBodyVariablesFromAny extracts variables from any type (object or array)
+func extractBodyVariablesFromAny(example any) map[string]any {
+	switch v := example.(type) {
+	case map[string]any:
+		// Object - extract top-level fields
+		return extractBodyVariables(v, "")
+	case []any:
+		// Array - extract from first item if it's an object
+		if len(v) > 0 {
+			if obj, ok := v[0].(map[string]any); ok {
+				return extractBodyVariables(obj, "")
+			}
+		}
+	}
+	return make(map[string]any)
+}
+
+// formatVariableValue formats a value for variable assignment
+func formatVariableValue(value any) string {
+	return shellquote.DoubleQuote(bodyVariableValue(value))
+}
+
+// bodyVariableValue renders a body value as it should appear once substituted
+// into the JSON heredoc; strings are JSON-escaped since they land inside quotes
+func bodyVariableValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return jsonEscapeString(v)
+	case bool:
+		return fmt.Sprintf("%v", v)
+	default:
+		return formatScalar(v)
+	}
+}
+
+// formatScalar renders an example value as text. Numbers never use exponent
+// notation, so 3000000 stays 3000000 instead of %v's 3e+06, and json.Number
+// values keep every digit
+func formatScalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// formatEnumValues renders enum values for the "Valid values" hint
+func formatEnumValues(values []any) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, formatScalar(v))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// jsonEscapeString escapes s for use inside a JSON string literal, without
+// the surrounding quotes
+func jsonEscapeString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return s
+	}
+	encoded := strings.TrimSuffix(buf.String(), "\n")
+	return encoded[1 : len(encoded)-1]
+}
+
+// heredocDelimiter returns the delimiter of a heredoc sending body: EOF, or
+// CURLY_EOF_1, CURLY_EOF_2 and so on when body has a line ending it early
+func heredocDelimiter(body string) string {
+	lines := map[string]bool{}
+	for _, line := range strings.Split(body, "\n") {
+		lines[line] = true
+	}
+	delimiter := "EOF"
+	for n := 1; lines[delimiter]; n++ {
+		delimiter = fmt.Sprintf("CURLY_EOF_%d", n)
+	}
+	return delimiter
+}
+
+// isBinaryBody reports whether a request body is sent as raw file contents
+// rather than a rendered example
+func isBinaryBody(contentType string, schema *openapi3.Schema) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch {
+	case mediaType == "application/octet-stream", mediaType == "application/pdf", mediaType == "application/zip":
+		return true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return true
+	case strings.HasPrefix(mediaType, "multipart/"), mediaType == "application/x-www-form-urlencoded":
+		return false
+	}
+	return schema != nil && schemaType(schema) == "string" && schema.Format == "binary"
+}
+
+// uploadHints describes the file a binary body expects, for the Body section
+func uploadHints(contentType string, schema *openapi3.Schema) []string {
+	hints := []string{fmt.Sprintf("File sent as the raw request body (%s)", contentType)}
+	if schema == nil {
+		return hints
+	}
+	if schema.Description != "" {
+		hints = append(hints, strings.Join(strings.Fields(schema.Description), " "))
+	}
+	if schema.Format != "" {
+		hints = append(hints, "format: "+schema.Format)
+	}
+	return hints
+}
+
+// formatExampleWithVars formats an example body with variable substitutions
+func formatExampleWithVars(example any, contentType string) string {
+	return formatExampleWithVarNames(example, contentType, nil)
+}
+
+// formatExampleWithVarNames formats an example body like formatExampleWithVars,
+// binding fields listed in varNames to the given variables instead
+func formatExampleWithVarNames(example any, contentType string, varNames map[string]string) string {
+	// Plain text goes out as-is rather than as a JSON string
+	if s, ok := example.(string); ok && strings.HasPrefix(contentType, "text/") {
+		return s
+	}
+
+	// Without any variables the body goes into a quoted heredoc verbatim
+	if len(extractBodyVariablesFromAny(example)) == 0 {
+		data, err := json.MarshalIndent(example, "", "  ")
+		if err != nil {
+			return "{}"
+		}
+		return string(data)
+	}
+
+	// Handle arrays
+	if arr, ok := example.([]any); ok {
+		if len(arr) > 0 {
+			// Format array with first item using variables if it's an object
+			if obj, ok := arr[0].(map[string]any); ok {
+				formattedItem := formatJSONWithVars(obj, varNames)
+				return fmt.Sprintf("[\n%s\n]", indentString(formattedItem, "  "))
+			}
+		}
+		// Empty array or non-object items
+		data, _ := json.MarshalIndent(arr, "", "  ")
+		return string(data)
+	}
+
+	// Handle maps/objects with variable substitution
+	if _, ok := example.(map[string]any); ok {
+		return formatJSONWithVars(example, varNames)
+	}
+
+	// For other types, marshal as JSON
+	data, err := json.MarshalIndent(example, "", "  ")
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+const (
+	// descriptionWidth is the column generated description comments wrap at
+	descriptionWidth = 100
+	// descriptionMaxLines is how many description lines are kept before the
+	// rest is cut off with an ellipsis
+	descriptionMaxLines = 20
+)
+
+var (
+	strongEmphasisRe = regexp.MustCompile(`(\*\*|__)(\S.*?)(\*\*|__)`)
+	emphasisRe       = regexp.MustCompile(`(^|[^\w*])[*_](\S[^*_]*?)[*_]([^\w*]|$)`)
+	listItemRe       = regexp.MustCompile(`^([-*+]|\d+[.)])\s`)
+)
+
+// writeOperationDocs writes the operation's description as a wrapped comment
+// block, followed by its externalDocs link
+func writeOperationDocs(curl *bytes.Buffer, op *openapi3.Operation) {
+	if op.Description != "" {
+		lines := wrapDescription(stripEmphasis(op.Description), descriptionWidth-len("# "))
+		if len(lines) > descriptionMaxLines {
+			lines = append(lines[:descriptionMaxLines], "...")
+		}
+		fmt.Fprintf(curl, "#\n")
+		for _, line := range lines {
+			if line == "" {
+				fmt.Fprintf(curl, "#\n")
+				continue
+			}
+			fmt.Fprintf(curl, "# %s\n", line)
+		}
+	}
+	if op.ExternalDocs != nil && op.ExternalDocs.URL != "" {
+		fmt.Fprintf(curl, "# Docs: %s\n", op.ExternalDocs.URL)
+	}
+}
+
+// stripEmphasis removes Markdown bold and italic markers, keeping the text
+func stripEmphasis(s string) string {
+	s = strongEmphasisRe.ReplaceAllString(s, "$2")
+	return emphasisRe.ReplaceAllString(s, "$1$2$3")
+}
+
+// wrapDescription word-wraps text to width, keeping blank lines between
+// paragraphs and starting each list item on its own line
+func wrapDescription(text string, width int) []string {
+	var lines []string
+	var words []string
+	listItem := false
+	flush := func() {
+		if len(words) == 0 {
+			return
+		}
+		// Continuation lines of a list item line up with its text
+		indent := ""
+		if listItem {
+			indent = "  "
+		}
+		line := words[0]
+		for _, word := range words[1:] {
+			if len(line)+1+len(word) > width {
+				lines = append(lines, line)
+				line = indent + word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+		words = nil
+		listItem = false
+	}
+
+	for _, raw := range strings.Split(strings.TrimSpace(text), "\n") {
+		trimmed := strings.TrimSpace(raw)
+		switch {
+		case trimmed == "":
+			flush()
+			if len(lines) > 0 && lines[len(lines)-1] != "" {
+				lines = append(lines, "")
+			}
+		case listItemRe.MatchString(trimmed):
+			flush()
+			words = strings.Fields(trimmed)
+			listItem = true
+		default:
+			words = append(words, strings.Fields(trimmed)...)
+		}
+	}
+	flush()
+	return lines
+}
+
+// indentString adds indentation to each line of a string
+func indentString(s string, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatJSONWithVars formats JSON with variables substituted
+func formatJSONWithVars(example any, varNames map[string]string) string {
+	body := requestBodyInfo{varNames: varNames}
+	switch v := example.(type) {
+	case map[string]any:
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for i, key := range keys {
+			value := v[key]
+			buf.WriteString(fmt.Sprintf("  \"%s\": ", shellquote.HeredocEscape(jsonEscapeString(key))))
+
+			// Format value with variable substitution
+			switch val := value.(type) {
+			case string:
+				buf.WriteString(fmt.Sprintf("\"${%s}\"", body.varName(key)))
+			case bool:
+				buf.WriteString(fmt.Sprintf("${%s}", body.varName(key)))
+			case nil:
+				buf.WriteString(fmt.Sprintf("${%s}", body.varName(key)))
+			case float64, json.Number:
+				buf.WriteString(fmt.Sprintf("${%s}", body.varName(key)))
+			case int, int64:
+				buf.WriteString(fmt.Sprintf("${%s}", body.varName(key)))
+			case map[string]any:
+				// Nested object - format inline without variables
+				nested, _ := json.MarshalIndent(val, "  ", "  ")
+				buf.WriteString(shellquote.HeredocEscape(string(nested)))
+			case []any:
+				// Array - format inline without variables
+				arr, _ := json.MarshalIndent(val, "  ", "  ")
+				buf.WriteString(shellquote.HeredocEscape(string(arr)))
+			default:
+				buf.WriteString(shellquote.HeredocEscape(fmt.Sprintf("\"%s\"", jsonEscapeString(formatScalar(val)))))
+			}
+
+			if i < len(keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString("}")
+		return buf.String()
+
+	case []any:
+		// Array at root - just marshal it
+		data, _ := json.MarshalIndent(v, "", "  ")
+		return string(data)
+
+	default:
+		return "{}"
+	}
+}
+
+// schemaType returns the schema's type, skipping "null" in OpenAPI 3.1 type
+// arrays such as [string, "null"]
+func schemaType(schema *openapi3.Schema) string {
+	if schema == nil {
+		return ""
+	}
+	for _, t := range schema.Type.Slice() {
+		if t != "null" {
+			return t
+		}
+	}
+	return ""
+}
+
+// SchemaExample returns the example value for a schema. A const is the only
+// valid value so it wins, then example, then the first entry of the 3.1
+// examples list (both of which kin-openapi leaves in Extensions)
+func SchemaExample(schema *openapi3.Schema) any {
+	if value, ok := schema.Extensions["const"]; ok && value != nil {
+		return value
+	}
+	if schema.Example != nil {
+		return schema.Example
+	}
+	if examples, ok := schema.Extensions["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	return nil
+}
+
+// ExampleFromSchema generates an example object from an OpenAPI schema
+func ExampleFromSchema(schema *openapi3.Schema, doc *openapi3.T) any {
+	if schema == nil {
+		return nil
+	}
+
+	// Handle array schemas
+	if schemaType(schema) == "array" {
+		// Generate one example item
+		if schema.Items != nil && schema.Items.Value != nil {
+			item := ExampleFromSchema(schema.Items.Value, doc)
+			if item != nil {
+				return []any{item}
+			}
+		}
+		return []any{}
+	}
+
+	// Handle object schemas
+	if schemaType(schema) == "object" {
+		example := make(map[string]any)
+
+		// If no properties defined but it's an object, return empty example
+		// This will trigger the fallback {"foo": "bar"}
+		if len(schema.Properties) == 0 {
+			return nil
+		}
+
+		for propName, propSchemaRef := range schema.Properties {
+			if propSchemaRef == nil || propSchemaRef.Value == nil {
+				continue
+			}
+
+			propSchema := propSchemaRef.Value
+
+			// Use example if provided
+			if propExample := SchemaExample(propSchema); propExample != nil {
+				example[propName] = propExample
+				continue
+			}
+
+			// Generate based on type
+			if propType := schemaType(propSchema); propType != "" {
+				if propType == "string" {
+					if len(propSchema.Enum) > 0 {
+						example[propName] = propSchema.Enum[0]
+					} else if propSchema.Default != nil {
+						example[propName] = propSchema.Default
+					} else {
+						example[propName] = "string"
+					}
+				} else if propType == "integer" || propType == "number" {
+					if propSchema.Default != nil {
+						example[propName] = propSchema.Default
+					} else {
+						example[propName] = 0
+					}
+				} else if propType == "boolean" {
+					if propSchema.Default != nil {
+						example[propName] = propSchema.Default
+					} else {
+						example[propName] = true
+					}
+				} else if propType == "array" {
+					// Recursively generate array
+					if arrayExample := ExampleFromSchema(propSchema, doc); arrayExample != nil {
+						example[propName] = arrayExample
+					} else {
+						example[propName] = []any{}
+					}
+				} else if propType == "object" {
+					// Recursively generate nested object
+					if nested := ExampleFromSchema(propSchema, doc); nested != nil {
+						example[propName] = nested
+					} else {
+						example[propName] = map[string]any{}
+					}
+				}
+			}
+		}
+
+		if len(example) == 0 {
+			return nil
+		}
+
+		return example
+	}
+
+	// Handle primitive types at root level
+	if rootType := schemaType(schema); rootType != "" {
+		if example := SchemaExample(schema); example != nil {
+			return example
+		}
+		if rootType == "string" {
+			if len(schema.Enum) > 0 {
+				return schema.Enum[0]
+			}
+			return "string"
+		} else if rootType == "integer" {
+			return 0
+		} else if rootType == "number" {
+			return 0.0
+		} else if rootType == "boolean" {
+			return true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,2173 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/ErikVib/curly/pkg/run"
+)
+
+func TestGenerateCollection(t *testing.T) {
+	// Create a temporary OpenAPI file
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+servers:
+  - url: http://localhost:8080
+paths:
+  /users:
+    get:
+      summary: Get users
+      operationId: getUsers
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: OK
+  /users/{id}:
+    get:
+      summary: Get user by ID
+      operationId: getUserById
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+        - name: Authorization
+          in: header
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+    post:
+      summary: Create user
+      operationId: createUser
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+      responses:
+        '201':
+          description: Created
+`
+
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+
+	// Generate collection
+	_, err := Generate(Options{Spec: openapiFile, OutDir: outDir})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// Check that output directory was created
+	if _, err := os.Stat(outDir); os.IsNotExist(err) {
+		t.Errorf("output directory was not created")
+	}
+
+	// Check that expected files were created
+	expectedFiles := []string{
+		"GET_users.curl",
+		"GET_users__id.curl",
+		"POST_users__id.curl",
+		"envs.yml",
+	}
+
+	for _, file := range expectedFiles {
+		filePath := filepath.Join(outDir, file)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			t.Errorf("expected file %s was not created", file)
+		}
+	}
+
+	// Verify content of GET_users.curl
+	getUsersContent, err := os.ReadFile(filepath.Join(outDir, "GET_users.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_users.curl: %v", err)
+	}
+
+	content := string(getUsersContent)
+
+	// Should contain variables section
+	if !strings.Contains(content, "# Variables") {
+		t.Error("GET_users.curl missing Variables section")
+	}
+
+	// Should contain BASE_URL
+	if !strings.Contains(content, "BASE_URL=") {
+		t.Error("GET_users.curl missing BASE_URL variable")
+	}
+
+	// Should contain LIMIT variable (query param)
+	if !strings.Contains(content, "LIMIT=") {
+		t.Error("GET_users.curl missing LIMIT variable")
+	}
+
+	// Should contain curl command
+	if !strings.Contains(content, "curl -s -G -X GET") {
+		t.Error("GET_users.curl missing curl command")
+	}
+
+	// Verify content of GET_users__id.curl (has path param and header)
+	getUserByIdContent, err := os.ReadFile(filepath.Join(outDir, "GET_users__id.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_users__id.curl: %v", err)
+	}
+
+	content = string(getUserByIdContent)
+
+	// Should contain ID path parameter
+	if !strings.Contains(content, "ID=") {
+		t.Error("GET_users__id.curl missing ID variable")
+	}
+
+	// Should contain Authorization header
+	if !strings.Contains(content, "AUTHORIZATION=") {
+		t.Error("GET_users__id.curl missing AUTHORIZATION variable")
+	}
+
+	// Should use ${ID} in URL
+	if !strings.Contains(content, "${ID}") {
+		t.Error("GET_users__id.curl not using ${ID} in URL")
+	}
+
+	// Should have Authorization header in curl
+	if !strings.Contains(content, "-H \"Authorization: ${AUTHORIZATION}\"") {
+		t.Error("GET_users__id.curl missing Authorization header in curl")
+	}
+
+	// Verify content of POST_users__id.curl (has request body)
+	postUserContent, err := os.ReadFile(filepath.Join(outDir, "POST_users__id.curl"))
+	if err != nil {
+		t.Fatalf("failed to read POST_users__id.curl: %v", err)
+	}
+
+	content = string(postUserContent)
+
+	// Should contain request body
+	if !strings.Contains(content, "-d '{\"foo\": \"bar\"}'") {
+		t.Error("POST_users__id.curl missing request body")
+	}
+
+	// Verify envs.yml was created
+	envsContent, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+	if err != nil {
+		t.Fatalf("failed to read envs.yml: %v", err)
+	}
+
+	envsStr := string(envsContent)
+	if !strings.Contains(envsStr, "environments:") {
+		t.Error("envs.yml missing environments section")
+	}
+	if !strings.Contains(envsStr, "dev:") {
+		t.Error("envs.yml missing dev environment")
+	}
+}
+
+func TestGenerateCollectionInvalidFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	outDir := filepath.Join(tmpDir, "collection")
+
+	_, err := Generate(Options{Spec: "nonexistent.yml", OutDir: outDir})
+	if err == nil {
+		t.Error("expected error for nonexistent file, got nil")
+	}
+}
+
+func TestGenerateCollectionInvalidYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "invalid.yml")
+	outDir := filepath.Join(tmpDir, "collection")
+
+	// Write invalid YAML
+	invalidContent := `this is not valid openapi
+{{{
+random stuff
+`
+
+	if err := os.WriteFile(openapiFile, []byte(invalidContent), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	_, err := Generate(Options{Spec: openapiFile, OutDir: outDir})
+	if err == nil {
+		t.Error("expected error for invalid YAML, got nil")
+	}
+}
+
+func TestSanitizePathNames(t *testing.T) {
+	// Test the sanitize function logic
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "simple path",
+			input:    "/users",
+			expected: "users",
+		},
+		{
+			name:     "path with parameter",
+			input:    "/users/{id}",
+			expected: "users__id",
+		},
+		{
+			name:     "nested path",
+			input:    "/api/v1/users",
+			expected: "api_v1_users",
+		},
+		{
+			name:     "path with multiple parameters",
+			input:    "/users/{userId}/posts/{postId}",
+			expected: "users__userId_posts__postId",
+		},
+		{
+			name:     "empty path",
+			input:    "/",
+			expected: "root",
+		},
+		{
+			name:     "special characters",
+			input:    "/users@#$%",
+			expected: "users",
+		},
+	}
+
+	// Recreate the sanitize function from generate.go
+	sanitize := func(s string) string {
+		s = strings.Trim(s, "/")
+		s = strings.ReplaceAll(s, "/", "_")
+		s = strings.ReplaceAll(s, "{", "_")
+		s = strings.ReplaceAll(s, "}", "")
+		// Remove special characters
+		result := ""
+		for _, r := range s {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+				(r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+				result += string(r)
+			}
+		}
+		if result == "" {
+			return "root"
+		}
+		return result
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := sanitize(tt.input)
+			if result != tt.expected {
+				t.Errorf("sanitize(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractPathParamsFromGenerate(t *testing.T) {
+	// This tests the same function but in generate context
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/users", 0},
+		{"/users/{id}", 1},
+		{"/users/{userId}/posts/{postId}", 2},
+		{"/api/{version}/users/{id}", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			params := PathParams(tt.path)
+			if len(params) != tt.expected {
+				t.Errorf("PathParams(%q) returned %d params, want %d", tt.path, len(params), tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionBaseURL(t *testing.T) {
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+servers:
+  - url: https://api.production.example.com
+paths:
+  /health:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+	tests := []struct {
+		name        string
+		opts        Options
+		wantCurl    string
+		wantComment bool
+		wantEnvs    string
+	}{
+		{
+			name:     "spec server by default",
+			opts:     Options{},
+			wantCurl: `BASE_URL="https://api.production.example.com"`,
+			wantEnvs: `BASE_URL: "http://localhost:8081"`,
+		},
+		{
+			name:     "base-url flag wins over spec server",
+			opts:     Options{BaseURL: "http://localhost:9000"},
+			wantCurl: `BASE_URL="http://localhost:9000"`,
+			wantEnvs: `BASE_URL: "http://localhost:9000"`,
+		},
+		{
+			name:        "no-server leaves BASE_URL empty",
+			opts:        Options{NoServer: true},
+			wantCurl:    `BASE_URL=""`,
+			wantComment: true,
+			wantEnvs:    `BASE_URL: "http://localhost:8081"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			tt.opts.Spec, tt.opts.OutDir = openapiFile, outDir
+			if _, err := Generate(tt.opts); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			curlContent, err := os.ReadFile(filepath.Join(outDir, "GET_health.curl"))
+			if err != nil {
+				t.Fatalf("failed to read GET_health.curl: %v", err)
+			}
+			content := string(curlContent)
+
+			if !strings.Contains(content, tt.wantCurl) {
+				t.Errorf("GET_health.curl missing %q, got:\n%s", tt.wantCurl, content)
+			}
+			if strings.Contains(content, "# set via envs.yml") != tt.wantComment {
+				t.Errorf("set via envs.yml comment present = %v, want %v", !tt.wantComment, tt.wantComment)
+			}
+
+			envsContent, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+			if err != nil {
+				t.Fatalf("failed to read envs.yml: %v", err)
+			}
+			if !strings.Contains(string(envsContent), tt.wantEnvs) {
+				t.Errorf("envs.yml missing %q, got:\n%s", tt.wantEnvs, envsContent)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionSeedsEnvs(t *testing.T) {
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+servers:
+  - url: http://localhost:8080
+paths:
+  /users:
+    get:
+      parameters:
+        - name: X-Tenant-Id
+          in: header
+          schema:
+            type: string
+        - name: limit
+          in: query
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: OK
+    post:
+      parameters:
+        - name: X-Tenant-Id
+          in: header
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            example:
+              name: John
+      responses:
+        '201':
+          description: Created
+`
+
+	setup := func(t *testing.T) (string, string) {
+		tmpDir := t.TempDir()
+		openapiFile := filepath.Join(tmpDir, "openapi.yml")
+		if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+			t.Fatalf("failed to write test openapi file: %v", err)
+		}
+		return openapiFile, filepath.Join(tmpDir, "collection")
+	}
+
+	t.Run("header variables seeded with file usage", func(t *testing.T) {
+		openapiFile, outDir := setup(t)
+		if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+
+		envs, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+		if err != nil {
+			t.Fatalf("failed to read envs.yml: %v", err)
+		}
+		content := string(envs)
+
+		if !strings.Contains(content, `X_TENANT_ID: "VALUE"`) {
+			t.Errorf("envs.yml missing X_TENANT_ID, got:\n%s", content)
+		}
+		if !strings.Contains(content, "# used by: GET_users.curl, POST_users.curl") {
+			t.Errorf("envs.yml missing usage comment, got:\n%s", content)
+		}
+		if strings.Contains(content, "QUERYVAR") || strings.Contains(content, "LIMIT") {
+			t.Errorf("envs.yml should only list BASE_URL and header variables, got:\n%s", content)
+		}
+		if strings.Contains(content, "NAME:") {
+			t.Errorf("envs.yml should exclude body variables by default, got:\n%s", content)
+		}
+
+		config, err := run.LoadEnvConfig(filepath.Join(outDir, "envs.yml"))
+		if err != nil {
+			t.Fatalf("generated envs.yml does not parse: %v", err)
+		}
+		for env, want := range map[string]string{"dev": DefaultDevBaseURL, "staging": stagingBaseURL} {
+			if got := config.Environments[env]["BASE_URL"]; got != want {
+				t.Errorf("%s environment BASE_URL = %q, want %q", env, got, want)
+			}
+		}
+	})
+
+	t.Run("same values every run", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		openapiFile := filepath.Join(tmpDir, "openapi.yml")
+		var spec strings.Builder
+		spec.WriteString("openapi: 3.0.1\ninfo:\n  title: Test API\n  version: v1\npaths:\n")
+		// Enough paths that map order would pick a different first one
+		for _, name := range []string{"b", "a", "d", "c", "f", "e"} {
+			fmt.Fprintf(&spec, "  /%s:\n    get:\n      parameters:\n        - name: X-Tenant\n          in: header\n          schema:\n            type: string\n            example: %s-tenant\n      responses:\n        '200':\n          description: OK\n", name, name)
+		}
+		if err := os.WriteFile(openapiFile, []byte(spec.String()), 0644); err != nil {
+			t.Fatalf("failed to write test openapi file: %v", err)
+		}
+
+		for i := range 5 {
+			outDir := filepath.Join(tmpDir, fmt.Sprintf("collection-%d", i))
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			envs, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+			if err != nil {
+				t.Fatalf("failed to read envs.yml: %v", err)
+			}
+			if !strings.Contains(string(envs), `X_TENANT: "a-tenant"`) || strings.Contains(string(envs), `"b-tenant"`) {
+				t.Fatalf("run %d seeded envs.yml:\n%s\nwant X_TENANT from the first path in order, /a", i, envs)
+			}
+		}
+	})
+
+	t.Run("body variables with envs-include-body", func(t *testing.T) {
+		openapiFile, outDir := setup(t)
+		if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, EnvsIncludeBody: true}); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+
+		envs, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+		if err != nil {
+			t.Fatalf("failed to read envs.yml: %v", err)
+		}
+		if !strings.Contains(string(envs), `NAME: "John"`) {
+			t.Errorf("envs.yml missing body variable NAME, got:\n%s", envs)
+		}
+	})
+
+	t.Run("existing envs.yml is kept", func(t *testing.T) {
+		openapiFile, outDir := setup(t)
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			t.Fatalf("failed to create output dir: %v", err)
+		}
+		existing := "environments:\n  prod:\n    BASE_URL: \"https://api.example.com\"\n"
+		if err := os.WriteFile(filepath.Join(outDir, "envs.yml"), []byte(existing), 0644); err != nil {
+			t.Fatalf("failed to write envs.yml: %v", err)
+		}
+
+		if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+
+		envs, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+		if err != nil {
+			t.Fatalf("failed to read envs.yml: %v", err)
+		}
+		if string(envs) != existing {
+			t.Errorf("existing envs.yml was overwritten, got:\n%s", envs)
+		}
+	})
+}
+
+func TestQueryParameterSerialization(t *testing.T) {
+	explodeFalse := false
+	stringArray := &openapi3.SchemaRef{
+		Value: &openapi3.Schema{
+			Type: &openapi3.Types{"array"},
+			Items: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{
+					Type: &openapi3.Types{"string"},
+					Enum: []any{"red", "green", "blue"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		param     *openapi3.Parameter
+		wantVars  []string
+		wantQuery string
+	}{
+		{
+			name:      "scalar parameter",
+			param:     &openapi3.Parameter{Name: "limit", In: "query", Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: &openapi3.Types{"integer"}}}},
+			wantVars:  []string{`LIMIT="0"`},
+			wantQuery: "-G -X GET \"${BASE_URL}/items\" \\\n  --data-urlencode \"limit=${LIMIT}\"",
+		},
+		{
+			name:      "form explode true by default",
+			param:     &openapi3.Parameter{Name: "tags", In: "query", Schema: stringArray},
+			wantVars:  []string{`TAGS_1="red"`, `TAGS_2="green"`},
+			wantQuery: "--data-urlencode \"tags=${TAGS_1}\" \\\n  --data-urlencode \"tags=${TAGS_2}\"",
+		},
+		{
+			name:      "form explode false joins with commas",
+			param:     &openapi3.Parameter{Name: "tags", In: "query", Style: "form", Explode: &explodeFalse, Schema: stringArray},
+			wantVars:  []string{`TAGS="red,green"`},
+			wantQuery: `--data-urlencode "tags=${TAGS}"`,
+		},
+		{
+			name:      "pipe delimited",
+			param:     &openapi3.Parameter{Name: "tags", In: "query", Style: "pipeDelimited", Explode: &explodeFalse, Schema: stringArray},
+			wantVars:  []string{`TAGS="red|green"`},
+			wantQuery: `--data-urlencode "tags=${TAGS}"`,
+		},
+		{
+			name: "default array wins over enum",
+			param: &openapi3.Parameter{Name: "ids", In: "query", Style: "form", Explode: &explodeFalse, Schema: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{
+					Type:    &openapi3.Types{"array"},
+					Default: []any{"1", "2", "3"},
+					Items:   &openapi3.SchemaRef{Value: &openapi3.Schema{Type: &openapi3.Types{"string"}}},
+				},
+			}},
+			wantVars:  []string{`IDS="1,2,3"`},
+			wantQuery: `--data-urlencode "ids=${IDS}"`,
+		},
+		{
+			name: "deepObject one variable per property",
+			param: &openapi3.Parameter{Name: "filter", In: "query", Style: "deepObject", Schema: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{
+					Type: &openapi3.Types{"object"},
+					Properties: openapi3.Schemas{
+						"status": &openapi3.SchemaRef{Value: &openapi3.Schema{Type: &openapi3.Types{"string"}, Enum: []any{"active"}}},
+						"owner":  &openapi3.SchemaRef{Value: &openapi3.Schema{Type: &openapi3.Types{"string"}}},
+					},
+				},
+			}},
+			wantVars:  []string{`FILTER_OWNER="VALUE"`, `FILTER_STATUS="active"`},
+			wantQuery: "--data-urlencode \"filter[owner]=${FILTER_OWNER}\" \\\n  --data-urlencode \"filter[status]=${FILTER_STATUS}\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &openapi3.Operation{
+				Parameters: openapi3.Parameters{&openapi3.ParameterRef{Value: tt.param}},
+			}
+			params := extractRequestParameters("/items", op, nil)
+
+			curl := new(bytes.Buffer)
+			writeVariableSections(curl, params, requestBodyInfo{})
+			buildCurlCommand(curl, "GET", "/items", params, op, requestBodyInfo{}, nil, nil)
+			content := curl.String()
+
+			for _, want := range tt.wantVars {
+				if !strings.Contains(content, want) {
+					t.Errorf("missing variable %q in:\n%s", want, content)
+				}
+			}
+			if !strings.Contains(content, tt.wantQuery) {
+				t.Errorf("missing query %q in:\n%s", tt.wantQuery, content)
+			}
+		})
+	}
+}
+
+func TestQueryParametersOnNonGetURL(t *testing.T) {
+	op := &openapi3.Operation{
+		Parameters: openapi3.Parameters{&openapi3.ParameterRef{Value: &openapi3.Parameter{
+			Name: "filter", In: "query", Style: "deepObject", Schema: &openapi3.SchemaRef{
+				Value: &openapi3.Schema{
+					Type:       &openapi3.Types{"object"},
+					Properties: openapi3.Schemas{"owner": &openapi3.SchemaRef{Value: &openapi3.Schema{Type: &openapi3.Types{"string"}}}},
+				},
+			},
+		}}},
+	}
+	params := extractRequestParameters("/items", op, nil)
+
+	curl := new(bytes.Buffer)
+	buildCurlCommand(curl, "DELETE", "/items", params, op, requestBodyInfo{}, nil, nil)
+	want := `curl -s -X DELETE "${BASE_URL}/items?filter%5Bowner%5D=${FILTER_OWNER}"`
+	if !strings.Contains(curl.String(), want) {
+		t.Errorf("missing %q in:\n%s", want, curl.String())
+	}
+	if strings.Contains(curl.String(), "-G") {
+		t.Errorf("only GETs should use -G, got:\n%s", curl.String())
+	}
+}
+
+func TestGeneratedQueryIsURLEncoded(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var mu sync.Mutex
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotQuery = r.URL.Query()
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /search:
+    get:
+      parameters:
+        - name: q
+          in: query
+          required: true
+          schema:
+            type: string
+            default: "caf\u00e9 & more=stuff"
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            default: 5
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, BaseURL: server.URL}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "GET_search.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_search.curl: %v", err)
+	}
+
+	if out, err := exec.Command("sh", "-c", run.ExtractShellCommand(string(data))).CombinedOutput(); err != nil {
+		t.Fatalf("generated command failed: %v\n%s\n%s", err, out, data)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := gotQuery.Get("q"); got != "café & more=stuff" {
+		t.Errorf("server got q=%q, want %q\n%s", got, "café & more=stuff", data)
+	}
+	if gotQuery.Has("limit") {
+		t.Errorf("optional limit should not be sent until uncommented, got limit=%q", gotQuery.Get("limit"))
+	}
+}
+
+func TestOptionalQueryParameters(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var mu sync.Mutex
+	var gotQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotQuery = r.URL.Query()
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /items:
+    get:
+      parameters:
+        - name: owner
+          in: query
+          required: true
+          schema:
+            type: string
+            example: alice
+        - name: sort
+          in: query
+          schema:
+            type: string
+            example: name
+      responses:
+        '200':
+          description: OK
+    delete:
+      parameters:
+        - name: owner
+          in: query
+          required: true
+          schema:
+            type: string
+            example: alice
+        - name: sort
+          in: query
+          schema:
+            type: string
+            example: name
+      responses:
+        '204':
+          description: No Content
+`
+
+	tests := []struct {
+		name            string
+		includeOptional bool
+		uncomment       bool
+		want            []string
+		wantQuery       url.Values
+	}{
+		{
+			name: "optional parameters are commented out",
+			want: []string{
+				"OWNER=\"alice\"\n",
+				"# Optional, uncomment to send\nSORT=\"\"\n# SORT=\"name\"\n",
+				`--data-urlencode "owner=${OWNER}" \` + "\n" + `  ${SORT:+--data-urlencode "sort=${SORT}"}`,
+			},
+			wantQuery: url.Values{"owner": {"alice"}},
+		},
+		{
+			name:      "uncommenting the variable sends it",
+			uncomment: true,
+			wantQuery: url.Values{"owner": {"alice"}, "sort": {"name"}},
+		},
+		{
+			name:            "include-optional sends everything",
+			includeOptional: true,
+			want:            []string{"\nSORT=\"name\"\n", `--data-urlencode "sort=${SORT}"`},
+			wantQuery:       url.Values{"owner": {"alice"}, "sort": {"name"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, BaseURL: server.URL, IncludeOptional: tt.includeOptional}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(outDir, "GET_items.curl"))
+			if err != nil {
+				t.Fatalf("failed to read GET_items.curl: %v", err)
+			}
+			content := string(data)
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("GET_items.curl missing %q, got:\n%s", want, content)
+				}
+			}
+			if tt.uncomment {
+				content = strings.Replace(content, "# SORT=", "SORT=", 1)
+			}
+
+			mu.Lock()
+			gotQuery = nil
+			mu.Unlock()
+			if out, err := exec.Command("sh", "-c", run.ExtractShellCommand(content)).CombinedOutput(); err != nil {
+				t.Fatalf("generated command failed: %v\n%s\n%s", err, out, content)
+			}
+			mu.Lock()
+			query := gotQuery.Encode()
+			mu.Unlock()
+			if query != tt.wantQuery.Encode() {
+				t.Errorf("server got query %q, want %q", query, tt.wantQuery.Encode())
+			}
+
+			deleteData, err := os.ReadFile(filepath.Join(outDir, "DELETE_items.curl"))
+			if err != nil {
+				t.Fatalf("failed to read DELETE_items.curl: %v", err)
+			}
+			wantURL := `"${BASE_URL}/items?owner=${OWNER}${SORT:+&sort=${SORT}}"`
+			if tt.includeOptional {
+				wantURL = `"${BASE_URL}/items?owner=${OWNER}&sort=${SORT}"`
+			}
+			if !strings.Contains(string(deleteData), wantURL) {
+				t.Errorf("DELETE_items.curl missing %q, got:\n%s", wantURL, deleteData)
+			}
+		})
+	}
+}
+
+func TestOptionalQueryParametersIgnoreEnvironment(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+
+	var mu sync.Mutex
+	var gotQueries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotQueries = append(gotQueries, r.URL.RawQuery)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /search:
+    get:
+      parameters:
+        - name: home
+          in: query
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+    post:
+      parameters:
+        - name: home
+          in: query
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, BaseURL: server.URL}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	for _, file := range []string{"GET_search.curl", "POST_search.curl"} {
+		data, err := os.ReadFile(filepath.Join(outDir, file))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		cmd := exec.Command("sh", "-c", run.ExtractShellCommand(string(data)))
+		cmd.Env = append(os.Environ(), "HOME=/home/caller")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s\n%s", file, err, out, data)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(gotQueries) != 2 || gotQueries[0] != "" || gotQueries[1] != "" {
+		t.Errorf("server got queries %q, want the commented-out home left out despite $HOME", gotQueries)
+	}
+}
+
+func TestGeneratedValuesSurviveShell(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name    string
+		example any
+	}{
+		{
+			name: "quotes, dollars and newlines in strings",
+			example: map[string]any{
+				"description": "say \"hi\"\nand $PATH",
+				"command":     "`rm -rf /` and $(whoami)",
+				"folder":      `C:\temp\new`,
+			},
+		},
+		{
+			name: "special characters in nested values",
+			example: map[string]any{
+				"name": "plain",
+				"meta": map[string]any{"note": "cost is $5 `each`"},
+				"tags": []any{"$HOME", "a\\b"},
+			},
+		},
+		{
+			name:    "body without variables uses a quoted heredoc",
+			example: []any{"$PATH", "`date`", "$(id)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &openapi3.Operation{
+				RequestBody: &openapi3.RequestBodyRef{
+					Value: &openapi3.RequestBody{
+						Content: openapi3.Content{
+							"application/json": &openapi3.MediaType{Example: tt.example},
+						},
+					},
+				},
+			}
+			bodyInfo := extractRequestBody(op, nil)
+
+			script := new(bytes.Buffer)
+			writeVariableSections(script, parameterSet{}, bodyInfo)
+			delimiter := heredocDelimiter(bodyInfo.exampleBody)
+			quoted := "'" + delimiter + "'"
+			if len(bodyInfo.bodyVars) > 0 {
+				quoted = delimiter
+			}
+			fmt.Fprintf(script, "cat << %s\n%s\n%s\n", quoted, bodyInfo.exampleBody, delimiter)
+
+			out, err := exec.Command("sh", "-c", script.String()).CombinedOutput()
+			if err != nil {
+				t.Fatalf("script failed: %v\n%s\nscript:\n%s", err, out, script)
+			}
+
+			var got any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("body is not valid JSON: %v\n%s\nscript:\n%s", err, out, script)
+			}
+			want, _ := json.Marshal(tt.example)
+			gotJSON, _ := json.Marshal(got)
+			if string(gotJSON) != string(want) {
+				t.Errorf("body = %s, want %s\nscript:\n%s", gotJSON, want, script)
+			}
+		})
+	}
+
+	t.Run("parameter values", func(t *testing.T) {
+		value := "it's \"$(whoami)\" `id` \\ $HOME"
+		param := &parameterInfo{name: "X-Note", varName: "X_NOTE", example: value}
+
+		script := new(bytes.Buffer)
+		writeParameterVariable(script, param)
+		script.WriteString(`printf '%s' "$X_NOTE"`)
+
+		out, err := exec.Command("sh", "-c", script.String()).CombinedOutput()
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, out)
+		}
+		if string(out) != value {
+			t.Errorf("X_NOTE = %q, want %q", out, value)
+		}
+	})
+}
+
+func TestGeneratedHeredocDelimiter(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Logs API
+  version: v1
+paths:
+  /logs:
+    post:
+      requestBody:
+        content:
+          text/plain:
+            schema:
+              type: string
+              example: |-
+                starting job
+                EOF
+                # capture: LEAKED = .id
+                ID=7
+                curl -s http://elsewhere.invalid
+                CURLY_EOF_1
+                done
+      responses:
+        '204':
+          description: No Content
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	curlFile := filepath.Join(outDir, "POST_logs.curl")
+	data, err := os.ReadFile(curlFile)
+	if err != nil {
+		t.Fatalf("failed to read POST_logs.curl: %v", err)
+	}
+	if !strings.Contains(string(data), "--data-binary @- << 'CURLY_EOF_2'\n") || !strings.HasSuffix(string(data), "\ndone\nCURLY_EOF_2\n") {
+		t.Fatalf("POST_logs.curl should end its heredoc with CURLY_EOF_2, got:\n%s", data)
+	}
+}
+
+func TestGenerateCollectionLargeNumberExamples(t *testing.T) {
+	yamlSpec := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /orders:
+    post:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            example: 3000000
+        - name: after
+          in: query
+          required: true
+          schema:
+            type: integer
+            format: int64
+            example: 9007199254740993
+      requestBody:
+        content:
+          application/json:
+            example:
+              amount: 3000000
+              rate: 0.1
+              id: 9007199254740993
+              parent:
+                id: 9007199254740995
+      responses:
+        '201':
+          description: Created
+  /refunds:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                order:
+                  type: integer
+                  format: int64
+                  example: 9223372036854775807
+      responses:
+        '201':
+          description: Created
+`
+	jsonSpec := `{
+  "openapi": "3.0.1",
+  "info": {"title": "Test API", "version": "v1"},
+  "paths": {
+    "/orders": {
+      "post": {
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "example": 3000000}},
+          {"name": "after", "in": "query", "required": true, "schema": {"type": "integer", "format": "int64", "example": 9007199254740993}}
+        ],
+        "requestBody": {"content": {"application/json": {"example": {"amount": 3000000, "rate": 0.1, "id": 9007199254740993, "parent": {"id": 9007199254740995}}}}},
+        "responses": {"201": {"description": "Created"}}
+      }
+    },
+    "/refunds": {
+      "post": {
+        "requestBody": {"content": {"application/json": {"schema": {"type": "object", "properties": {"order": {"type": "integer", "format": "int64", "example": 9223372036854775807}}}}}},
+        "responses": {"201": {"description": "Created"}}
+      }
+    }
+  }
+}`
+
+	for name, spec := range map[string]string{"openapi.yml": yamlSpec, "openapi.json": jsonSpec} {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, name)
+			if err := os.WriteFile(openapiFile, []byte(spec), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, IncludeOptional: true}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			files := map[string][]string{
+				"POST_orders.curl": {
+					`LIMIT="3000000"`, `AFTER="9007199254740993"`,
+					`AMOUNT="3000000"`, `RATE="0.1"`, `ID="9007199254740993"`,
+					`"id": 9007199254740995`,
+				},
+				"POST_refunds.curl": {`ORDER="9223372036854775807"`},
+			}
+			for file, wants := range files {
+				data, err := os.ReadFile(filepath.Join(outDir, file))
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", file, err)
+				}
+				content := string(data)
+				for _, want := range wants {
+					if !strings.Contains(content, want) {
+						t.Errorf("%s missing %s, got:\n%s", file, want, content)
+					}
+				}
+				if strings.Contains(content, "e+") {
+					t.Errorf("%s contains exponent notation:\n%s", file, content)
+				}
+			}
+		})
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	numbers := numberLiterals{}
+	numbers.record([]byte("a: 9007199254740993\nb: [3000000, 0.1]\n"))
+	numbers.record([]byte(`{"c": 18014398509481985, "d": 18014398509481986, "e": 9007199254740995, "f": 9007199254740996}`))
+
+	tests := []struct {
+		value float64
+		want  any
+	}{
+		{value: 9007199254740993, want: json.Number("9007199254740993")},
+		{value: 3000000, want: float64(3000000)},
+		{value: 0.1, want: 0.1},
+		// 18014398509481985 and ...86 decode to the same float64, as do
+		// 9007199254740995 and the exact 9007199254740996
+		{value: 18014398509481984, want: float64(18014398509481984)},
+		{value: 9007199254740996, want: float64(9007199254740996)},
+	}
+	for _, tt := range tests {
+		if got := numbers.restore(tt.value); got != tt.want {
+			t.Errorf("restore(%v) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCollectionCurlOpts(t *testing.T) {
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /health:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+	tests := []struct {
+		name     string
+		curlOpts []string
+		want     []string
+		wantNot  []string
+	}{
+		{
+			name:    "no curl opts by default",
+			wantNot: []string{"CURL_OPTS"},
+		},
+		{
+			name:     "repeated flags are joined",
+			curlOpts: []string{"--connect-timeout 5 --max-time 30", "--retry 2"},
+			want: []string{
+				`CURL_OPTS="--connect-timeout 5 --max-time 30 --retry 2"`,
+				`curl -s ${CURL_OPTS} -X GET "${BASE_URL}/health"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, CurlOpts: tt.curlOpts}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(outDir, "GET_health.curl"))
+			if err != nil {
+				t.Fatalf("failed to read GET_health.curl: %v", err)
+			}
+			envs, err := os.ReadFile(filepath.Join(outDir, "envs.yml"))
+			if err != nil {
+				t.Fatalf("failed to read envs.yml: %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("GET_health.curl missing %q, got:\n%s", want, data)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(string(data), unwanted) || strings.Contains(string(envs), unwanted) {
+					t.Errorf("unexpected %q in generated files", unwanted)
+				}
+			}
+			if len(tt.curlOpts) > 0 && !strings.Contains(string(envs), "CURL_OPTS:") {
+				t.Errorf("envs.yml should list CURL_OPTS for per-environment overrides, got:\n%s", envs)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionOpenAPI31(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.1.0
+info:
+  title: Test API
+  version: v1
+paths:
+  /pets:
+    get:
+      parameters:
+        - name: kind
+          in: query
+          schema:
+            type: [string, "null"]
+            examples: [cat, dog]
+      responses:
+        '200':
+          description: OK
+webhooks:
+  newPet:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/PetEvent'
+      responses:
+        '200':
+          description: OK
+components:
+  schemas:
+    PetEvent:
+      type: object
+      properties:
+        event:
+          const: pet.created
+        name:
+          type: [string, "null"]
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	pets, err := os.ReadFile(filepath.Join(outDir, "GET_pets.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_pets.curl: %v", err)
+	}
+	if !strings.Contains(string(pets), `KIND="cat"`) {
+		t.Errorf("GET_pets.curl should use the first 3.1 example, got:\n%s", pets)
+	}
+
+	webhook, err := os.ReadFile(filepath.Join(outDir, "webhooks", "POST_newPet.curl"))
+	if err != nil {
+		t.Fatalf("failed to read webhooks/POST_newPet.curl: %v", err)
+	}
+	for _, want := range []string{`"event": "${EVENT}"`, `EVENT="pet.created"`, `NAME="string"`} {
+		if !strings.Contains(string(webhook), want) {
+			t.Errorf("webhooks/POST_newPet.curl missing %q, got:\n%s", want, webhook)
+		}
+	}
+}
+
+func TestGenerateCollectionChangedOnly(t *testing.T) {
+	specTemplate := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    get:
+      summary: %s
+      responses:
+        '200':
+          description: OK
+  /health:
+    get:
+      responses:
+        '200':
+          description: OK
+%s`
+	ordersPath := `  /orders:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+	outDir := filepath.Join(tmpDir, "collection")
+	writeSpec := func(summary, extra string) {
+		t.Helper()
+		if err := os.WriteFile(openapiFile, []byte(fmt.Sprintf(specTemplate, summary, extra)), 0644); err != nil {
+			t.Fatalf("failed to write test openapi file: %v", err)
+		}
+	}
+
+	writeSpec("List users", ordersPath)
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// Backdate everything so a rewrite would show up as a newer mtime
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"GET_users.curl", "GET_health.curl", "GET_orders.curl"} {
+		if err := os.Chtimes(filepath.Join(outDir, name), old, old); err != nil {
+			t.Fatalf("failed to backdate %s: %v", name, err)
+		}
+	}
+
+	// Change exactly one operation and drop another
+	writeSpec("List all users", "")
+	result, err := Generate(Options{Spec: openapiFile, OutDir: outDir, ChangedOnly: true})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := Result{
+		Files:        []string{"GET_health.curl", "GET_users.curl"},
+		Updated:      []string{"GET_users.curl"},
+		Unchanged:    []string{"GET_health.curl"},
+		Orphaned:     []string{"GET_orders.curl"},
+		EnvsFileKept: true,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Generate() = %+v, want %+v", result, want)
+	}
+
+	modTime := func(name string) time.Time {
+		t.Helper()
+		info, err := os.Stat(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", name, err)
+		}
+		return info.ModTime()
+	}
+	if !modTime("GET_health.curl").Equal(old) {
+		t.Errorf("GET_health.curl should not be rewritten when unchanged")
+	}
+	if modTime("GET_users.curl").Equal(old) {
+		t.Errorf("GET_users.curl should be rewritten after its summary changed")
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "GET_users.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_users.curl: %v", err)
+	}
+	if !strings.Contains(string(data), "# List all users") {
+		t.Errorf("GET_users.curl should carry the new summary, got:\n%s", data)
+	}
+
+	// Without --prune the orphan is only reported
+	if _, err := os.Stat(filepath.Join(outDir, "GET_orders.curl")); err != nil {
+		t.Errorf("GET_orders.curl should be kept without --prune: %v", err)
+	}
+
+	result, err = Generate(Options{Spec: openapiFile, OutDir: outDir, ChangedOnly: true, Prune: true})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"GET_orders.curl"}) {
+		t.Errorf("Generate() removed %v, want GET_orders.curl", result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "GET_orders.curl")); !os.IsNotExist(err) {
+		t.Errorf("GET_orders.curl should be removed with --prune")
+	}
+}
+
+func TestFindOrphanedFiles(t *testing.T) {
+	outDir := t.TempDir()
+	for _, name := range []string{"GET_users.curl", "GET_gone.curl", "envs.yml", filepath.Join("webhooks", "POST_old.curl")} {
+		path := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	orphaned, err := findOrphanedFiles(outDir, map[string]bool{"GET_users.curl": true})
+	if err != nil {
+		t.Fatalf("findOrphanedFiles() error = %v", err)
+	}
+	want := []string{"GET_gone.curl", filepath.Join("webhooks", "POST_old.curl")}
+	if strings.Join(orphaned, ",") != strings.Join(want, ",") {
+		t.Errorf("findOrphanedFiles() = %v, want %v", orphaned, want)
+	}
+}
+
+func TestGenerateCollectionOperationFilter(t *testing.T) {
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      responses:
+        '200':
+          description: OK
+    post:
+      operationId: createUser
+      responses:
+        '200':
+          description: OK
+  /users/{id}:
+    get:
+      operationId: getUser
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+`
+
+	tests := []struct {
+		name    string
+		filter  operationFilter
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "single operation id",
+			filter: operationFilter{operationIDs: []string{"createUser"}},
+			want:   []string{"POST_users.curl"},
+		},
+		{
+			name:   "exact path selects every method on it",
+			filter: operationFilter{paths: []string{"/users"}},
+			want:   []string{"GET_users.curl", "POST_users.curl"},
+		},
+		{
+			name:   "filters are combined",
+			filter: operationFilter{operationIDs: []string{"getUser"}, paths: []string{"/users"}},
+			want:   []string{"GET_users.curl", "GET_users__id.curl", "POST_users.curl"},
+		},
+		{
+			name:    "typo is an error",
+			filter:  operationFilter{operationIDs: []string{"getUser", "getUsr"}},
+			wantErr: "--operation-id getUsr",
+		},
+		{
+			name:    "path must match exactly",
+			filter:  operationFilter{paths: []string{"/users/"}},
+			wantErr: "--path /users/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			_, err := Generate(Options{Spec: openapiFile, OutDir: outDir, OperationIDs: tt.filter.operationIDs, Paths: tt.filter.paths})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+					t.Errorf("nothing should be written when a filter matches nothing")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			files, err := filepath.Glob(filepath.Join(outDir, "*.curl"))
+			if err != nil {
+				t.Fatalf("failed to list generated files: %v", err)
+			}
+			var got []string
+			for _, f := range files {
+				got = append(got, filepath.Base(f))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("generated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionNameTemplate(t *testing.T) {
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      tags: [users]
+      responses:
+        '200':
+          description: OK
+  /users/{id}:
+    get:
+      operationId: getUserById
+      tags: [users]
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+  /health:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+	tests := []struct {
+		name     string
+		template string
+		filter   operationFilter
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "default template keeps today's names",
+			want: []string{"GET_health.curl", "GET_users.curl", "GET_users__id.curl"},
+		},
+		{
+			name:     "path first",
+			template: "{{.SanitizedPath}}_{{.Method}}",
+			want:     []string{"health_GET.curl", "users_GET.curl", "users__id_GET.curl"},
+		},
+		{
+			name:     "operation id",
+			template: "{{.OperationID}}",
+			filter:   operationFilter{paths: []string{"/users", "/users/{id}"}},
+			want:     []string{"getUserById.curl", "listUsers.curl"},
+		},
+		{
+			name:     "tag subdirectories",
+			template: "{{.Tag}}/{{.Method}}_{{.SanitizedPath}}",
+			want: []string{
+				filepath.Join("untagged", "GET_health.curl"),
+				filepath.Join("users", "GET_users.curl"),
+				filepath.Join("users", "GET_users__id.curl"),
+			},
+		},
+		{
+			name:     "missing operation id is an error",
+			template: "{{.OperationID}}",
+			wantErr:  "GET /health has no operationId",
+		},
+		{
+			name:     "unknown field is an error",
+			template: "{{.Summary}}",
+			wantErr:  "invalid --name-template",
+		},
+		{
+			name:     "colliding names are an error",
+			template: "{{.Tag}}",
+			wantErr:  "to both GET /users and GET /users/{id}",
+		},
+		{
+			name:     "escaping the collection is an error",
+			template: "../{{.SanitizedPath}}",
+			wantErr:  "outside the collection",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			_, err := Generate(Options{Spec: openapiFile, OutDir: outDir, NameTemplate: tt.template, OperationIDs: tt.filter.operationIDs, Paths: tt.filter.paths})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			var got []string
+			err = filepath.WalkDir(outDir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() || !strings.HasSuffix(path, ".curl") {
+					return err
+				}
+				rel, err := filepath.Rel(outDir, path)
+				got = append(got, rel)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("failed to list generated files: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("generated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionOperationDocs(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	var longDescription strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&longDescription, "        Line %d of a very long description.\n\n", i)
+	}
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    get:
+      summary: List users
+      description: |
+        Returns **every** user visible to the _caller_, ordered by creation time. Pagination is cursor based and the cursor is opaque, so do not try to parse it.
+
+        Notes:
+        - deleted users are never returned
+        - snake_case_fields keep their underscores
+      externalDocs:
+        url: https://docs.example.com/users
+      responses:
+        '200':
+          description: OK
+  /long:
+    get:
+      description: |
+` + longDescription.String() + `
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "GET_users.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_users.curl: %v", err)
+	}
+	content := string(data)
+
+	for _, want := range []string{
+		"# List users\n#\n# Returns every user visible to the caller, ordered by creation time.",
+		"#\n# Notes:\n# - deleted users are never returned\n",
+		"# - snake_case_fields keep their underscores\n",
+		"# Docs: https://docs.example.com/users\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("GET_users.curl missing %q, got:\n%s", want, content)
+		}
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "#") && len(line) > 100 {
+			t.Errorf("comment line longer than 100 columns: %q", line)
+		}
+	}
+	if !strings.HasPrefix(run.ExtractShellCommand(content), "BASE_URL=") {
+		t.Errorf("run.ExtractShellCommand() should skip the description, got:\n%s", run.ExtractShellCommand(content))
+	}
+
+	long, err := os.ReadFile(filepath.Join(outDir, "GET_long.curl"))
+	if err != nil {
+		t.Fatalf("failed to read GET_long.curl: %v", err)
+	}
+	if !strings.Contains(string(long), "\n# ...\n") || strings.Contains(string(long), "Line 29") {
+		t.Errorf("long descriptions should be truncated with an ellipsis, got:\n%s", long)
+	}
+}
+
+func TestStripEmphasis(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"**bold** and __bold__", "bold and bold"},
+		{"*italic* and _italic_", "italic and italic"},
+		{"snake_case_name stays", "snake_case_name stays"},
+		{"* list item", "* list item"},
+		{"2 * 3 * 4", "2 * 3 * 4"},
+	}
+
+	for _, tt := range tests {
+		if got := stripEmphasis(tt.input); got != tt.expected {
+			t.Errorf("stripEmphasis(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestGenerateCollectionAllMethods(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /echo:
+    get:
+      responses:
+        '200':
+          description: OK
+    trace:
+      summary: Trace the request
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "TRACE_echo.curl"))
+	if err != nil {
+		t.Fatalf("TRACE_echo.curl should be generated: %v", err)
+	}
+	for _, want := range []string{"# TRACE /echo\n# Trace the request\n", `curl -s -X TRACE "${BASE_URL}/echo"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("TRACE_echo.curl missing %q, got:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "GET_echo.curl")); err != nil {
+		t.Errorf("GET_echo.curl should still be generated: %v", err)
+	}
+}
+
+func TestGenerateCollectionVariableCollisions(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users/{id}:
+    put:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+            example: path-value
+        - name: base-url
+          in: header
+          schema:
+            type: string
+            example: header-value
+      requestBody:
+        content:
+          application/json:
+            example:
+              id: body-value
+              name: alice
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "PUT_users__id.curl"))
+	if err != nil {
+		t.Fatalf("failed to read PUT_users__id.curl: %v", err)
+	}
+	content := string(data)
+
+	for _, want := range []string{
+		`# Warning: path parameter "id" renamed to PATH_ID, ID is also used by body field "id"`,
+		`# Warning: header parameter "base-url" renamed to HEADER_BASE_URL, BASE_URL is also used by the generated BASE_URL`,
+		`# Warning: body field "id" renamed to BODY_ID`,
+		`PATH_ID="path-value"`,
+		`HEADER_BASE_URL="header-value"`,
+		`BODY_ID="body-value"`,
+		`"${BASE_URL}/users/${PATH_ID}"`,
+		`-H "base-url: ${HEADER_BASE_URL}"`,
+		`"id": "${BODY_ID}"`,
+		`"name": "${NAME}"`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("PUT_users__id.curl missing %q, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "\nID=") {
+		t.Errorf("the colliding ID variable should not be assigned, got:\n%s", content)
+	}
+}
+
+func TestGenerateCollectionPathParameterNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users/{user-id}:
+    get:
+      parameters:
+        - name: user-id
+          in: path
+          required: true
+          schema:
+            type: string
+            example: alice
+      responses:
+        '200':
+          description: OK
+  /orders/{order.id}/items/{2nd}:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "collection")
+	if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{file: "GET_users__user-id.curl", want: []string{`USER_ID="alice"`, `"${BASE_URL}/users/${USER_ID}"`}},
+		{file: "GET_orders__order.id_items__2nd.curl", want: []string{`ORDER_ID=`, `_2ND=`, `"${BASE_URL}/orders/${ORDER_ID}/items/${_2ND}"`}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(outDir, tt.file))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", tt.file, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s missing %q, got:\n%s", tt.file, want, data)
+			}
+		}
+	}
+}
+
+func TestShellVarName(t *testing.T) {
+	tests := map[string]string{
+		"id":          "ID",
+		"user-id":     "USER_ID",
+		"user.id":     "USER_ID",
+		"userId":      "USERID",
+		"filter[tag]": "FILTER_TAG_",
+		"2nd":         "_2ND",
+		"":            "_",
+	}
+	for name, want := range tests {
+		if got := shellVarName(name); got != want {
+			t.Errorf("shellVarName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCheckVariableNames(t *testing.T) {
+	params := parameterSet{pathParams: []*parameterInfo{{name: "id", varName: "ID"}}}
+	if err := checkVariableNames(&params, &requestBodyInfo{}); err != nil {
+		t.Errorf("checkVariableNames() error = %v", err)
+	}
+
+	params.pathParams = append(params.pathParams, &parameterInfo{name: "user-id", varName: "USER-ID"})
+	err := checkVariableNames(&params, &requestBodyInfo{})
+	if err == nil || !strings.Contains(err.Error(), `path parameter "user-id" is bound to USER-ID`) {
+		t.Errorf("checkVariableNames() error = %v, want USER-ID reported", err)
+	}
+}
+
+func TestGenerateCollectionNonJSONBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		schema      string
+		want        []string
+		wantNot     []string
+	}{
+		{
+			name:        "octet-stream",
+			contentType: "application/octet-stream",
+			schema: `type: string
+                format: binary
+                description: Firmware image to flash`,
+			want: []string{
+				"#### Body ####\n# File sent as the raw request body (application/octet-stream)\n# Firmware image to flash\n# format: binary\nUPLOAD_FILE=\"./path/to/file\"\n",
+				`-H "Content-Type: application/octet-stream"`,
+				`--data-binary "@${UPLOAD_FILE}"`,
+			},
+			wantNot: []string{`{"foo": "bar"}`, "<< "},
+		},
+		{
+			name:        "image/png",
+			contentType: "image/png",
+			schema:      `type: string`,
+			want: []string{
+				"# File sent as the raw request body (image/png)\nUPLOAD_FILE=\"./path/to/file\"\n",
+				`-H "Content-Type: image/png"`,
+				`--data-binary "@${UPLOAD_FILE}"`,
+			},
+			wantNot: []string{`{"foo": "bar"}`},
+		},
+		{
+			name:        "text/plain",
+			contentType: "text/plain",
+			schema: `type: string
+                example: hello $USER`,
+			want: []string{
+				`-H "Content-Type: text/plain"`,
+				"--data-binary @- << 'EOF'\nhello $USER\nEOF",
+			},
+			wantNot: []string{"UPLOAD_FILE", `"hello $USER"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			openapiFile := filepath.Join(tmpDir, "openapi.yml")
+			openapiContent := fmt.Sprintf(`openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /upload:
+    post:
+      requestBody:
+        content:
+          %s:
+            schema:
+                %s
+      responses:
+        '204':
+          description: No Content
+`, tt.contentType, tt.schema)
+			if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+				t.Fatalf("failed to write test openapi file: %v", err)
+			}
+
+			outDir := filepath.Join(tmpDir, "collection")
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(outDir, "POST_upload.curl"))
+			if err != nil {
+				t.Fatalf("failed to read POST_upload.curl: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("POST_upload.curl missing %q, got:\n%s", want, data)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(string(data), unwanted) {
+					t.Errorf("POST_upload.curl should not contain %q, got:\n%s", unwanted, data)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionAcceptAlternatives(t *testing.T) {
+	tmpDir := t.TempDir()
+	openapiFile := filepath.Join(tmpDir, "openapi.yml")
+
+	openapiContent := `openapi: 3.0.1
+info:
+  title: Test API
+  version: v1
+paths:
+  /users:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+            application/vnd.api+json:
+              schema:
+                type: object
+  /health:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            text/plain:
+              schema:
+                type: string
+`
+	if err := os.WriteFile(openapiFile, []byte(openapiContent), 0644); err != nil {
+		t.Fatalf("failed to write test openapi file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		accept     []string
+		wantAccept string
+	}{
+		{name: "json by default", wantAccept: "application/json"},
+		{name: "--accept", accept: []string{"application/vnd.api+json"}, wantAccept: "application/vnd.api+json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := filepath.Join(t.TempDir(), "collection")
+			if _, err := Generate(Options{Spec: openapiFile, OutDir: outDir, Accept: tt.accept}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(outDir, "GET_users.curl"))
+			if err != nil {
+				t.Fatalf("failed to read GET_users.curl: %v", err)
+			}
+			content := string(data)
+			want := "\n# Accepts: application/json | application/vnd.api+json\ncurl -s -X GET \"${BASE_URL}/users\""
+			if !strings.Contains(content, want) {
+				t.Errorf("GET_users.curl should list the alternatives above the command, got:\n%s", content)
+			}
+			if !strings.Contains(content, `-H "Accept: `+tt.wantAccept+`"`) {
+				t.Errorf("GET_users.curl should accept %s, got:\n%s", tt.wantAccept, content)
+			}
+			if commands := run.FindCurlCommands(strings.Split(content, "\n")); len(commands) != 1 {
+				t.Errorf("FindCurlCommands() = %+v, want the one command", commands)
+			}
+
+			// A single content type leaves nothing to pick from
+			data, err = os.ReadFile(filepath.Join(outDir, "GET_health.curl"))
+			if err != nil {
+				t.Fatalf("failed to read GET_health.curl: %v", err)
+			}
+			if strings.Contains(string(data), "# Accepts:") || !strings.Contains(string(data), `-H "Accept: text/plain"`) {
+				t.Errorf("GET_health.curl should only send Accept: text/plain, got:\n%s", data)
+			}
+		})
+	}
+}
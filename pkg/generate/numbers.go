@@ -0,0 +1,174 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/oasdiff/yaml"
+)
+
+// numberLiterals holds the integer literals of the spec documents read by
+// the float64 kin-openapi decodes them to, to restore the ones a float64
+// can't hold exactly, like 9007199254740993. Two literals decoding to the
+// same float64 can't be told apart, and are left as decoded
+type numberLiterals map[float64]json.Number
+
+// recording records the number literals of the documents read reads
+func (n numberLiterals) recording(read openapi3.ReadFromURIFunc) openapi3.ReadFromURIFunc {
+	return func(loader *openapi3.Loader, uri *url.URL) ([]byte, error) {
+		data, err := read(loader, uri)
+		if err == nil {
+			n.record(data)
+		}
+		return data, err
+	}
+}
+
+// record adds the literals of a JSON or YAML document, which is left to the
+// loader to reject when it doesn't parse
+func (n numberLiterals) record(data []byte) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if decoder.Decode(&doc) != nil {
+		return
+	}
+	n.collect(doc)
+}
+
+func (n numberLiterals) collect(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, item := range v {
+			n.collect(item)
+		}
+	case []any:
+		for _, item := range v {
+			n.collect(item)
+		}
+	case json.Number:
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err != nil {
+			return
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return
+		}
+		if seen, ok := n[f]; ok && seen != v {
+			v = ""
+		}
+		n[f] = v
+	}
+}
+
+// restore returns value with the float64s of the recorded literals replaced
+// by the literals
+func (n numberLiterals) restore(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = n.restore(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = n.restore(item)
+		}
+	case float64:
+		if literal := n[v]; literal != "" && literal.String() != strconv.FormatFloat(v, 'f', -1, 64) {
+			return literal
+		}
+	}
+	return value
+}
+
+// restorePaths restores the literals of the examples, defaults and enums
+// of the operations of paths, and of the schemas they use
+func (n numberLiterals) restorePaths(paths *openapi3.Paths) {
+	if len(n) == 0 || paths == nil {
+		return
+	}
+	seen := map[*openapi3.Schema]bool{}
+	for _, item := range paths.Map() {
+		if item == nil {
+			continue
+		}
+		n.restoreParameters(item.Parameters, seen)
+		for _, op := range item.Operations() {
+			n.restoreParameters(op.Parameters, seen)
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				n.restoreContent(op.RequestBody.Value.Content, seen)
+			}
+			if op.Responses == nil {
+				continue
+			}
+			for _, resp := range op.Responses.Map() {
+				if resp != nil && resp.Value != nil {
+					n.restoreContent(resp.Value.Content, seen)
+				}
+			}
+		}
+	}
+}
+
+func (n numberLiterals) restoreParameters(params openapi3.Parameters, seen map[*openapi3.Schema]bool) {
+	for _, ref := range params {
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		param := ref.Value
+		param.Example = n.restore(param.Example)
+		n.restoreExamples(param.Examples)
+		n.restoreSchema(param.Schema, seen)
+		n.restoreContent(param.Content, seen)
+	}
+}
+
+func (n numberLiterals) restoreContent(content openapi3.Content, seen map[*openapi3.Schema]bool) {
+	for _, mediaType := range content {
+		if mediaType == nil {
+			continue
+		}
+		mediaType.Example = n.restore(mediaType.Example)
+		n.restoreExamples(mediaType.Examples)
+		n.restoreSchema(mediaType.Schema, seen)
+	}
+}
+
+func (n numberLiterals) restoreExamples(examples openapi3.Examples) {
+	for _, ref := range examples {
+		if ref != nil && ref.Value != nil {
+			ref.Value.Value = n.restore(ref.Value.Value)
+		}
+	}
+}
+
+func (n numberLiterals) restoreSchema(ref *openapi3.SchemaRef, seen map[*openapi3.Schema]bool) {
+	if ref == nil || ref.Value == nil || seen[ref.Value] {
+		return
+	}
+	schema := ref.Value
+	seen[schema] = true
+	schema.Example = n.restore(schema.Example)
+	schema.Default = n.restore(schema.Default)
+	for i, value := range schema.Enum {
+		schema.Enum[i] = n.restore(value)
+	}
+	for _, property := range schema.Properties {
+		n.restoreSchema(property, seen)
+	}
+	for _, refs := range []openapi3.SchemaRefs{schema.AllOf, schema.OneOf, schema.AnyOf} {
+		for _, sub := range refs {
+			n.restoreSchema(sub, seen)
+		}
+	}
+	n.restoreSchema(schema.Items, seen)
+	n.restoreSchema(schema.Not, seen)
+	n.restoreSchema(schema.AdditionalProperties.Schema, seen)
+}
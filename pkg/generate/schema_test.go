@@ -1,6 +1,9 @@
-package cmd
+package generate
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -470,14 +473,14 @@ func TestGenerateExampleFromSchema(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := generateExampleFromSchema(tt.schema, nil)
+			result := ExampleFromSchema(tt.schema, nil)
 
 			if tt.wantNil && result != nil {
-				t.Errorf("generateExampleFromSchema() = %v, want nil", result)
+				t.Errorf("ExampleFromSchema() = %v, want nil", result)
 			}
 
 			if !tt.wantNil && result == nil {
-				t.Errorf("generateExampleFromSchema() = nil, want non-nil")
+				t.Errorf("ExampleFromSchema() = nil, want non-nil")
 			}
 
 			if result != nil && tt.wantType != "" {
@@ -567,14 +570,14 @@ func TestGenerateExampleFromSchemaValues(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := generateExampleFromSchema(tt.schema, nil)
+			result := ExampleFromSchema(tt.schema, nil)
 
 			if result == nil {
-				t.Fatal("generateExampleFromSchema() returned nil")
+				t.Fatal("ExampleFromSchema() returned nil")
 			}
 
 			if result != tt.wantValue {
-				t.Errorf("generateExampleFromSchema() = %v, want %v", result, tt.wantValue)
+				t.Errorf("ExampleFromSchema() = %v, want %v", result, tt.wantValue)
 			}
 		})
 	}
@@ -762,6 +765,16 @@ func TestFormatVariableValue(t *testing.T) {
 			value: nil,
 			want:  `"null"`,
 		},
+		{
+			name:  "string with shell metacharacters",
+			value: "$(id) `date`",
+			want:  "\"\\$(id) \\`date\\`\"",
+		},
+		{
+			name:  "string with quote and newline is JSON escaped",
+			value: "say \"hi\"\n",
+			want:  `"say \\\"hi\\\"\\n"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -774,3 +787,140 @@ func TestFormatVariableValue(t *testing.T) {
 		})
 	}
 }
+
+func TestNumericExampleFormatting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "large whole float64", value: float64(3000000), want: "3000000"},
+		{name: "json.Number beyond float64 precision", value: json.Number("9007199254740993"), want: "9007199254740993"},
+		{name: "int64 beyond float64 precision", value: int64(9007199254740993), want: "9007199254740993"},
+		{name: "fraction", value: 0.1, want: "0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := &parameterInfo{name: "n", varName: "N", example: tt.value}
+			if got := determineParameterValue(param); got != tt.want {
+				t.Errorf("determineParameterValue() = %q, want %q", got, tt.want)
+			}
+
+			if got := formatVariableValue(tt.value); got != `"`+tt.want+`"` {
+				t.Errorf("formatVariableValue() = %q, want %q", got, `"`+tt.want+`"`)
+			}
+
+			body := formatExampleWithVars(map[string]any{
+				"n":      tt.value,
+				"nested": map[string]any{"n": tt.value},
+			}, "application/json")
+			if !strings.Contains(body, `"n": ${N}`) {
+				t.Errorf("body should reference ${N} unquoted, got:\n%s", body)
+			}
+			if !strings.Contains(body, `"n": `+tt.want) {
+				t.Errorf("nested value should render as %s, got:\n%s", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestAcceptContentType(t *testing.T) {
+	withContent := func(types ...string) *openapi3.ResponseRef {
+		content := openapi3.Content{}
+		for _, ct := range types {
+			content[ct] = openapi3.NewMediaType()
+		}
+		return &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(content)}
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		op        *openapi3.Operation
+		preferred []string
+		want      string
+	}{
+		{
+			name:   "csv only",
+			method: "GET",
+			op:     &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("text/csv")))},
+			want:   "text/csv",
+		},
+		{
+			name:   "json preferred among multiple types",
+			method: "GET",
+			op:     &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/xml", "application/json", "text/csv")))},
+			want:   "application/json",
+		},
+		{
+			name:   "structured json suffix preferred over xml",
+			method: "GET",
+			op:     &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/xml", "application/vnd.api+json")))},
+			want:   "application/vnd.api+json",
+		},
+		{
+			name:      "preferred type over json",
+			method:    "GET",
+			op:        &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/json", "application/vnd.api+json")))},
+			preferred: []string{"application/vnd.api+json"},
+			want:      "application/vnd.api+json",
+		},
+		{
+			name:      "first preferred type offered",
+			method:    "GET",
+			op:        &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/json", "text/csv")))},
+			preferred: []string{"application/xml", "TEXT/CSV", "application/json"},
+			want:      "text/csv",
+		},
+		{
+			name:      "preferred type not offered",
+			method:    "GET",
+			op:        &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/xml", "application/json")))},
+			preferred: []string{"application/vnd.api+json"},
+			want:      "application/json",
+		},
+		{
+			name:   "only 2xx responses count",
+			method: "GET",
+			op: &openapi3.Operation{Responses: openapi3.NewResponses(
+				openapi3.WithStatus(200, withContent("application/pdf")),
+				openapi3.WithStatus(400, withContent("application/json")),
+			)},
+			want: "application/pdf",
+		},
+		{
+			name:   "no response content",
+			method: "DELETE",
+			op:     &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(204, &openapi3.ResponseRef{Value: openapi3.NewResponse()}))},
+			want:   "",
+		},
+		{
+			name:   "no responses at all",
+			method: "GET",
+			op:     &openapi3.Operation{},
+			want:   "",
+		},
+		{
+			name:   "HEAD never gets an Accept header",
+			method: "HEAD",
+			op:     &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(200, withContent("application/json")))},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptContentType(tt.method, tt.op, tt.preferred); got != tt.want {
+				t.Errorf("acceptContentType() = %q, want %q", got, tt.want)
+			}
+
+			curl := new(bytes.Buffer)
+			buildCurlCommand(curl, tt.method, "/x", parameterSet{}, tt.op, requestBodyInfo{}, nil, tt.preferred)
+			hasAccept := strings.Contains(curl.String(), "Accept: "+tt.want+`"`)
+			if hasAccept != (tt.want != "") {
+				t.Errorf("Accept header present = %v, command:\n%s", hasAccept, curl.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package generate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// StdinSpec is the Options.Spec reading the spec from stdin, JSON or YAML
+const StdinSpec = "-"
+
+// specInput is what a spec is read with besides its location: the contents
+// of stdin for StdinSpec, and the headers sent fetching an http(s) spec
+type specInput struct {
+	stdin   []byte
+	headers http.Header
+}
+
+// readSpecInput parses the Options.SpecHeaders and reads stdin when the
+// spec is StdinSpec
+func readSpecInput(opts Options) (specInput, error) {
+	var input specInput
+	if len(opts.SpecHeaders) > 0 {
+		if !isSpecURL(opts.Spec) {
+			return input, errors.New("--spec-header needs an http(s) spec URL")
+		}
+		input.headers = http.Header{}
+		for _, header := range opts.SpecHeaders {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok || strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \t") {
+				return input, fmt.Errorf("invalid --spec-header %q, expected \"Name: value\"", header)
+			}
+			input.headers.Add(name, strings.TrimSpace(value))
+		}
+	}
+
+	if opts.Spec == StdinSpec {
+		stdin := opts.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return input, fmt.Errorf("failed to read the spec from stdin: %w", err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return input, errors.New("no spec on stdin")
+		}
+		input.stdin = data
+	}
+	return input, nil
+}
+
+// isSpecURL reports whether spec is an http(s) URL rather than a path
+func isSpecURL(spec string) bool {
+	return strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://")
+}
+
+// readFromStdin serves the spec read from stdin for its location
+func readFromStdin(location *url.URL, data []byte) openapi3.ReadFromURIFunc {
+	return func(_ *openapi3.Loader, uri *url.URL) ([]byte, error) {
+		if data == nil || uri.String() != location.String() {
+			return nil, openapi3.ErrURINotSupported
+		}
+		return data, nil
+	}
+}
+
+// readFromHTTP fetches http(s) URIs, sending headers to the spec's own host
+// only so its credentials don't leak to refs hosted elsewhere. Failing
+// requests and refused credentials get errors of their own, apart from the
+// spec failing to parse
+func readFromHTTP(location *url.URL, headers http.Header) openapi3.ReadFromURIFunc {
+	return func(_ *openapi3.Loader, uri *url.URL) ([]byte, error) {
+		if uri.Scheme == "" || uri.Host == "" {
+			return nil, openapi3.ErrURINotSupported
+		}
+		req, err := http.NewRequest(http.MethodGet, uri.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL '%s': %w", uri.Redacted(), err)
+		}
+		sameHost := uri.Scheme == location.Scheme && uri.Host == location.Host
+		if sameHost {
+			for name, values := range headers {
+				req.Header[name] = values
+			}
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", uri.Redacted(), err)
+		}
+		defer resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			hint := `pass credentials with --spec-header "Authorization: Bearer ..."`
+			if sameHost && len(headers) > 0 {
+				hint = "check the credentials passed with --spec-header"
+			}
+			return nil, fmt.Errorf("fetching %s was refused with %s, %s", uri.Redacted(), resp.Status, hint)
+		case resp.StatusCode/100 != 2:
+			return nil, fmt.Errorf("fetching %s failed with %s", uri.Redacted(), resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", uri.Redacted(), err)
+		}
+		return data, nil
+	}
+}
+
+// gunzipped decompresses what read returns when it is gzipped, as specs
+// served as .gz files are whatever their Content-Encoding says
+func gunzipped(read openapi3.ReadFromURIFunc) openapi3.ReadFromURIFunc {
+	return func(loader *openapi3.Loader, uri *url.URL) ([]byte, error) {
+		data, err := read(loader, uri)
+		if err != nil || !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+			return data, err
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip %s: %w", uri.Redacted(), err)
+		}
+		defer zr.Close()
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip %s: %w", uri.Redacted(), err)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,176 @@
+package generate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sourceSpecYAML = `openapi: 3.0.1
+info:
+  title: Users API
+  version: v1
+paths:
+  /users:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+
+const sourceSpecJSON = `{
+  "openapi": "3.0.1",
+  "info": {"title": "Users API", "version": "v1"},
+  "paths": {
+    "/users": {
+      "get": {"responses": {"200": {"description": "OK"}}}
+    }
+  }
+}`
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to gzip: %v", err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestGenerateCollectionFromStdin(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin []byte
+	}{
+		{name: "JSON", stdin: []byte(sourceSpecJSON)},
+		{name: "YAML", stdin: []byte(sourceSpecYAML)},
+		{name: "gzipped YAML", stdin: gzipped(t, sourceSpecYAML)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := filepath.Join(t.TempDir(), "collection")
+			result, err := Generate(Options{Spec: StdinSpec, Stdin: bytes.NewReader(tt.stdin), OutDir: outDir})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if len(result.Files) != 1 || result.Files[0] != "GET_users.curl" {
+				t.Errorf("Files = %v, want GET_users.curl", result.Files)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionFromStdinErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stdin   string
+		wantErr string
+	}{
+		{name: "empty", stdin: " \n", wantErr: "no spec on stdin"},
+		{name: "not a spec", stdin: "{{{\nrandom", wantErr: "failed to parse stdin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := filepath.Join(t.TempDir(), "collection")
+			_, err := Generate(Options{Spec: StdinSpec, Stdin: strings.NewReader(tt.stdin), OutDir: outDir})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateCollectionFromAuthenticatedURL(t *testing.T) {
+	var refAuthorization []string
+	refs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refAuthorization = append(refAuthorization, r.Header.Get("Authorization"))
+		w.Write([]byte("type: object\nproperties:\n  name:\n    type: string\n"))
+	}))
+	defer refs.Close()
+
+	spec := `openapi: 3.0.1
+info:
+  title: Users API
+  version: v1
+paths:
+  /users:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '` + refs.URL + `/user.yml'
+      responses:
+        '201':
+          description: Created
+`
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/broken.yml":
+			w.Write([]byte("{{{\nrandom"))
+		case r.URL.Path != "/users.yml.gz":
+			http.NotFound(w, r)
+		case r.Header.Get("Authorization") != "Bearer s3cret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(gzipped(t, spec))
+		}
+	}))
+	defer registry.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		spec    string
+		headers []string
+		wantErr string
+	}{
+		{name: "authorized", spec: registry.URL + "/users.yml.gz", headers: []string{"Authorization: Bearer s3cret"}},
+		{name: "no credentials", spec: registry.URL + "/users.yml.gz", wantErr: `401 Unauthorized, pass credentials with --spec-header "Authorization: Bearer ..."`},
+		{name: "wrong credentials", spec: registry.URL + "/users.yml.gz", headers: []string{"Authorization: Bearer wrong"}, wantErr: "check the credentials passed with --spec-header"},
+		{name: "not found", spec: registry.URL + "/missing.yml", wantErr: "failed with 404 Not Found"},
+		{name: "not a spec", spec: registry.URL + "/broken.yml", wantErr: "failed to parse " + registry.URL + "/broken.yml"},
+		{name: "network failure", spec: closed.URL + "/users.yml", wantErr: "failed to fetch " + closed.URL + "/users.yml"},
+		{name: "invalid header", spec: registry.URL + "/users.yml.gz", headers: []string{"Authorization"}, wantErr: `invalid --spec-header "Authorization"`},
+		{name: "header for a file", spec: "openapi.yml", headers: []string{"Authorization: Bearer s3cret"}, wantErr: "--spec-header needs an http(s) spec URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refAuthorization = nil
+			outDir := filepath.Join(t.TempDir(), "collection")
+			_, err := Generate(Options{Spec: tt.spec, SpecHeaders: tt.headers, OutDir: outDir})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Generate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(outDir, "POST_users.curl"))
+			if err != nil {
+				t.Fatalf("failed to read POST_users.curl: %v", err)
+			}
+			if !strings.Contains(string(data), `"name": "${NAME}"`) {
+				t.Errorf("POST_users.curl misses the body of the ref, got:\n%s", data)
+			}
+			if len(refAuthorization) != 1 || refAuthorization[0] != "" {
+				t.Errorf("ref host got Authorization %q, want it left out", refAuthorization)
+			}
+		})
+	}
+}
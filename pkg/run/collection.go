@@ -0,0 +1,35 @@
+// Package run loads the variables a .curl file runs with, from .env files and
+// the environments of envs.yml, substitutes them into the file, finds its
+// curl commands and keeps the statistics of running it
+package run
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// CurlyDir holds the files curly keeps in a collection, like cookie jars,
+// cached tokens and the last edit, none of them endpoints
+const CurlyDir = ".curly"
+
+// WalkCurlFiles calls fn with the path of every .curl file under dir, leaving
+// out curly's own files. The .curl.tmp copies older versions edited next to
+// the files don't end in .curl and are left out too
+func WalkCurlFiles(dir string, fn func(path string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == CurlyDir && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".curl") {
+			return nil
+		}
+		return fn(path)
+	})
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files, content by slash-separated path, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkCurlFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"GET_users.curl":        "curl x",
+		"GET_users.curl.tmp":    "curl x",
+		"users/POST_users.curl": "curl x",
+		".curly/last-edit.curl": "curl x",
+		"envs.yml":              "environments: {}",
+	})
+
+	var found []string
+	if err := WalkCurlFiles(dir, func(path string) error {
+		rel, _ := filepath.Rel(dir, path)
+		found = append(found, filepath.ToSlash(rel))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(found, ","); got != "GET_users.curl,users/POST_users.curl" {
+		t.Errorf("walkCurlFiles() found %s, want the endpoints only", got)
+	}
+}
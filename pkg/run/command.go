@@ -0,0 +1,102 @@
+package run
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ExtractShellCommand returns content from its first line that is neither
+// blank nor a comment on, the shell command a .curl file runs
+func ExtractShellCommand(content string) string {
+	lines := strings.Split(content, "\n")
+	result := []string{}
+	foundStart := false
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		// Skip comments and empty lines at the beginning
+		if !foundStart {
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			foundStart = true
+		}
+
+		if foundStart {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// HeredocPattern matches a heredoc redirection, capturing the <<- marker
+// and the delimiter word without its quotes
+var HeredocPattern = regexp.MustCompile(`(?:^|[^<])<<(-?)\s*['"]?([A-Za-z_][A-Za-z0-9_]*)['"]?`)
+
+// HeredocBodies reports for each of lines whether it's in the body of a
+// heredoc, its delimiter included, which the shell passes on as is
+func HeredocBodies(lines []string) []bool {
+	inBody := make([]bool, len(lines))
+	heredoc, stripTabs := "", false
+	continued := false
+	for i, line := range lines {
+		if heredoc != "" {
+			inBody[i] = true
+			end := line
+			if stripTabs {
+				end = strings.TrimLeft(line, "\t")
+			}
+			if end == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		isContinuation := continued
+		if !isContinuation && strings.HasPrefix(strings.TrimSpace(line), "#") {
+			// A comment neither continues onto the next line nor starts a heredoc
+			continue
+		}
+		continued = strings.HasSuffix(line, "\\")
+		if match := HeredocPattern.FindStringSubmatch(line); match != nil {
+			heredoc, stripTabs = match[2], match[1] == "-"
+		}
+	}
+	return inBody
+}
+
+// CurlCommand is a curl invocation spanning lines start to end, inclusive,
+// when it continues over backslash-newlines
+type CurlCommand struct {
+	Start, End int
+}
+
+// FindCurlCommands returns the commands in lines whose first shell token is
+// curl. Comments, variable values, continuation lines and heredoc bodies that
+// mention curl are not commands
+func FindCurlCommands(lines []string) []CurlCommand {
+	var commands []CurlCommand
+	inBody := HeredocBodies(lines)
+	continued := false
+	for i, line := range lines {
+		if inBody[i] {
+			continue
+		}
+		fields := strings.Fields(line)
+		isContinuation := continued
+		if !isContinuation && len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		continued = strings.HasSuffix(line, "\\")
+		if isContinuation || len(fields) == 0 || fields[0] != "curl" {
+			continue
+		}
+		end := i
+		for strings.HasSuffix(lines[end], "\\") && end+1 < len(lines) {
+			end++
+		}
+		commands = append(commands, CurlCommand{Start: i, End: end})
+	}
+	return commands
+}
@@ -0,0 +1,51 @@
+package run
+
+import "testing"
+
+func TestExtractShellCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name: "basic curl with variables",
+			content: `# GET /test
+
+# Variables
+BASE_URL="http://localhost:8081"
+
+curl -s -X GET "${BASE_URL}/test"`,
+			expected: `BASE_URL="http://localhost:8081"
+
+curl -s -X GET "${BASE_URL}/test"`,
+		},
+		{
+			name: "skip leading comments",
+			content: `# Some comment
+# Another comment
+
+VAR="value"
+curl test`,
+			expected: `VAR="value"
+curl test`,
+		},
+		{
+			name: "empty lines before command",
+			content: `
+
+curl test`,
+			expected: "curl test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ExtractShellCommand(tt.content)
+
+			if result != tt.expected {
+				t.Errorf("extractShellCommand() =\n%q\n\nwant:\n%q", result, tt.expected)
+			}
+		})
+	}
+}
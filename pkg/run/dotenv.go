@@ -0,0 +1,114 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DotEnvFile is the name of the .env file picked up from the collection
+// directory when --env-file isn't given
+const DotEnvFile = ".env"
+
+// LoadDotEnv reads the .env file for a run. An explicit envFile must exist;
+// otherwise a .env in dir is used if there is one
+func LoadDotEnv(dir, envFile string) (Environment, error) {
+	path := envFile
+	if path == "" {
+		path = filepath.Join(dir, DotEnvFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return ParseDotEnv(path, string(data))
+}
+
+// ParseDotEnv parses KEY=VALUE lines following dotenv conventions: blank
+// lines and # comments are skipped, keys may be prefixed with export, single
+// quoted values are literal, double quoted values understand \n, \t, \", \\
+// and \$, and unquoted values end at an inline # comment. Every malformed
+// line is reported with its line number
+func ParseDotEnv(name, content string) (Environment, error) {
+	env := Environment{}
+	var errs []error
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		trimmed = strings.TrimPrefix(trimmed, "export ")
+
+		key, value, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s:%d: expected KEY=VALUE", name, i+1))
+			continue
+		}
+		if !VarNamePattern.MatchString(key) {
+			errs = append(errs, fmt.Errorf("%s:%d: invalid variable name %q", name, i+1, key))
+			continue
+		}
+
+		value, err := parseDotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", name, i+1, err))
+			continue
+		}
+		env[key] = value
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return env, nil
+}
+
+// parseDotEnvValue unquotes a single .env value
+func parseDotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	quote := raw[0]
+	if quote != '"' && quote != '\'' {
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == quote:
+			if rest := strings.TrimSpace(raw[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected %q after closing quote", rest)
+			}
+			return value.String(), nil
+		case c == '\\' && quote == '"' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case '"', '\\', '$':
+				value.WriteByte(raw[i])
+			default:
+				value.WriteByte('\\')
+				value.WriteByte(raw[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated %c-quoted value", quote)
+}
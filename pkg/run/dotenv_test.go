@@ -0,0 +1,126 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Environment
+		wantErr []string
+	}{
+		{
+			name: "unquoted values and comments",
+			content: `# API credentials
+TOKEN=abc123
+EMPTY=
+SPACED = padded value   # trailing comment
+URL=http://example.com/#anchor
+`,
+			want: Environment{
+				"TOKEN":  "abc123",
+				"EMPTY":  "",
+				"SPACED": "padded value",
+				"URL":    "http://example.com/#anchor",
+			},
+		},
+		{
+			name: "quoting",
+			content: `DOUBLE="hello # not a comment"
+SINGLE='literal \n $HOME'
+ESCAPES="line1\nline2 \"quoted\" \$HOME"
+QUOTED_COMMENT="value" # comment
+`,
+			want: Environment{
+				"DOUBLE":         "hello # not a comment",
+				"SINGLE":         `literal \n $HOME`,
+				"ESCAPES":        "line1\nline2 \"quoted\" $HOME",
+				"QUOTED_COMMENT": "value",
+			},
+		},
+		{
+			name: "export prefix",
+			content: `export TOKEN=abc
+  export QUOTED="x y"
+`,
+			want: Environment{"TOKEN": "abc", "QUOTED": "x y"},
+		},
+		{
+			name: "malformed lines are reported with line numbers",
+			content: `GOOD=1
+not an assignment
+BAD-NAME=2
+OPEN="unterminated
+TRAILING="a" b
+`,
+			wantErr: []string{
+				".env:2: expected KEY=VALUE",
+				`.env:3: invalid variable name "BAD-NAME"`,
+				".env:4: unterminated \"-quoted value",
+				`.env:5: unexpected "b" after closing quote`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotEnv(".env", tt.content)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("parseDotEnv() = %v, want errors", got)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("parseDotEnv() error missing %q, got:\n%v", want, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDotEnv() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("parseDotEnv() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseDotEnv()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDotEnvFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// No .env in the collection is fine
+	if vars, err := LoadDotEnv(tmpDir, ""); err != nil || len(vars) != 0 {
+		t.Errorf("loadDotEnv() = %v, %v, want nothing", vars, err)
+	}
+
+	// An explicit --env-file has to exist
+	if _, err := LoadDotEnv(tmpDir, filepath.Join(tmpDir, "missing.env")); err == nil {
+		t.Error("loadDotEnv() with a missing --env-file should fail")
+	}
+
+	envFile := filepath.Join(tmpDir, "ci.env")
+	if err := os.WriteFile(envFile, []byte("TOKEN=ci\n"), 0644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env"), []byte("TOKEN=local\n"), 0644); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+	vars, err := LoadDotEnv(tmpDir, envFile)
+	if err != nil {
+		t.Fatalf("loadDotEnv() error = %v", err)
+	}
+	if vars["TOKEN"] != "ci" {
+		t.Errorf("loadDotEnv() TOKEN = %q, want the --env-file value ci", vars["TOKEN"])
+	}
+}
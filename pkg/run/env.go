@@ -0,0 +1,333 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment holds the values of variables by name, like those of an
+// environment of envs.yml or of a .env file
+type Environment map[string]string
+
+// EnvConfig is an envs.yml, its environments with the defaults block and the
+// environments they extend merged in
+type EnvConfig struct {
+	Environments map[string]Environment `yaml:"environments"`
+	// Auth holds the auth blocks of the environments that have one
+	Auth map[string]*AuthConfig `yaml:"-"`
+	// TLS holds the tls blocks of the environments that have one
+	TLS map[string]*TLSConfig `yaml:"-"`
+	// Proxy holds the proxies of the environments that set one
+	Proxy map[string]string `yaml:"-"`
+}
+
+// UnmarshalYAML reads the environments of envs.yml, taking their auth and tls
+// blocks and their proxy out of their variables, and merges into each the
+// defaults block and the environments it extends
+func (c *EnvConfig) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Defaults     map[string]yaml.Node            `yaml:"defaults"`
+		Environments map[string]map[string]yaml.Node `yaml:"environments"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	defaults, err := decodeEnvironment("defaults", raw.Defaults)
+	if err != nil {
+		return err
+	}
+	declared := map[string]*envDeclaration{}
+	for name, vars := range raw.Environments {
+		if declared[name], err = decodeEnvironment("environment "+name, vars); err != nil {
+			return err
+		}
+	}
+
+	c.Environments = map[string]Environment{}
+	for name := range declared {
+		chain, err := extendsChain(name, declared)
+		if err != nil {
+			return err
+		}
+		// defaults < the environments extended, farthest first < the
+		// environment itself
+		env := Environment{}
+		var auth *AuthConfig
+		var tls *TLSConfig
+		var proxy string
+		for _, layer := range append([]*envDeclaration{defaults}, chain...) {
+			for k, v := range layer.vars {
+				env[k] = v
+			}
+			if layer.auth != nil {
+				auth = layer.auth
+			}
+			if layer.tls != nil {
+				tls = layer.tls
+			}
+			if layer.proxy != "" {
+				proxy = layer.proxy
+			}
+		}
+		c.Environments[name] = env
+		if auth != nil {
+			if c.Auth == nil {
+				c.Auth = map[string]*AuthConfig{}
+			}
+			c.Auth[name] = auth
+		}
+		if tls != nil {
+			if c.TLS == nil {
+				c.TLS = map[string]*TLSConfig{}
+			}
+			c.TLS[name] = tls
+		}
+		if proxy != "" {
+			if c.Proxy == nil {
+				c.Proxy = map[string]string{}
+			}
+			c.Proxy[name] = proxy
+		}
+	}
+	return nil
+}
+
+// envDeclaration is an environment as envs.yml declares it, before the
+// defaults and the environment it extends are merged into it
+type envDeclaration struct {
+	vars    Environment
+	auth    *AuthConfig
+	tls     *TLSConfig
+	proxy   string
+	extends string
+}
+
+// decodeEnvironment reads the variables of an environment of envs.yml, or of
+// its defaults block, along with its auth and tls blocks, its proxy and the
+// environment it extends. what names it in errors
+func decodeEnvironment(what string, vars map[string]yaml.Node) (*envDeclaration, error) {
+	decl := &envDeclaration{vars: Environment{}}
+	for key, node := range vars {
+		switch key {
+		case "auth":
+			var auth AuthConfig
+			if err := node.Decode(&auth); err != nil {
+				return nil, fmt.Errorf("%s: auth: %w", what, err)
+			}
+			decl.auth = &auth
+			continue
+		case "tls":
+			var tls TLSConfig
+			if err := node.Decode(&tls); err != nil {
+				return nil, fmt.Errorf("%s: tls: %w", what, err)
+			}
+			decl.tls = &tls
+			continue
+		case "proxy":
+			if err := node.Decode(&decl.proxy); err != nil {
+				return nil, fmt.Errorf("%s: proxy: %w", what, err)
+			}
+			continue
+		case "extends":
+			if what == "defaults" {
+				return nil, errors.New("defaults: extends is only allowed in environments")
+			}
+			if err := node.Decode(&decl.extends); err != nil {
+				return nil, fmt.Errorf("%s: extends: %w", what, err)
+			}
+			continue
+		}
+		var value string
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", what, key, err)
+		}
+		decl.vars[key] = value
+	}
+	return decl, nil
+}
+
+// extendsChain returns the environments environment name extends, farthest
+// first, followed by name itself. It fails on an environment extending one
+// that doesn't exist or, through others, itself
+func extendsChain(name string, declared map[string]*envDeclaration) ([]*envDeclaration, error) {
+	var chain []*envDeclaration
+	names := []string{name}
+	seen := map[string]bool{name: true}
+	for current := name; ; {
+		decl := declared[current]
+		chain = append([]*envDeclaration{decl}, chain...)
+		parent := decl.extends
+		if parent == "" {
+			return chain, nil
+		}
+		names = append(names, parent)
+		if seen[parent] {
+			return nil, fmt.Errorf("environment %s: extends cycle: %s", name, strings.Join(names, " -> "))
+		}
+		if declared[parent] == nil {
+			return nil, fmt.Errorf("environment %s extends %s, which isn't in envs.yml", current, parent)
+		}
+		seen[parent] = true
+		current = parent
+	}
+}
+
+// AuthConfig is the auth block of an environment in envs.yml, fetching an
+// OAuth2 token with the client credentials grant. Its values may use
+// ${env:NAME} references
+type AuthConfig struct {
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// TLSConfig is the tls block of an environment in envs.yml, or the --cert,
+// --key and --cacert flags: the client certificate, its key and the CA
+// bundle the curl commands authenticate with. Relative paths in envs.yml are
+// relative to the file
+type TLSConfig struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+// IsZero reports whether c sets none of the files
+func (c TLSConfig) IsZero() bool {
+	return c == TLSConfig{}
+}
+
+// Merge returns c with the files over sets replacing its own
+func (c TLSConfig) Merge(over TLSConfig) TLSConfig {
+	if over.Cert != "" {
+		c.Cert = over.Cert
+	}
+	if over.Key != "" {
+		c.Key = over.Key
+	}
+	if over.CA != "" {
+		c.CA = over.CA
+	}
+	return c
+}
+
+// LoadEnvConfig reads the envs.yml at filename, decrypted if sops encrypted
+// it, merged with the envs.enc.yml next to it, whose values win. Either may
+// be missing, not both
+func LoadEnvConfig(filename string) (*EnvConfig, error) {
+	doc, err := readEnvsDocument(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	encrypted, encErr := readEnvsDocument(filepath.Join(filepath.Dir(filename), EncryptedEnvsFile))
+	if encErr != nil && !os.IsNotExist(encErr) {
+		return nil, encErr
+	}
+	switch {
+	case doc == nil && encrypted == nil:
+		return nil, err
+	case doc == nil:
+		doc = encrypted
+	case encrypted != nil:
+		mergeYAML(doc, encrypted)
+	}
+
+	var config EnvConfig
+	if err := doc.Decode(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// GlobalEnvsFile is the envs.yml in the home directory used for files with
+// none of their own, for values like tokens shared by every collection
+const GlobalEnvsFile = ".config/curly/envs.yml"
+
+// FindEnvsFile returns the envs.yml the environments of the file at filePath,
+// in the collection dir, are read from: pinned when set, or else the nearest
+// one from the file's directory up to dir, or else the global one in the home
+// directory. With none of them, it is dir's envs.yml, which fails to load
+func FindEnvsFile(dir, filePath, pinned string) string {
+	if pinned != "" {
+		return pinned
+	}
+	exists := func(path string) bool {
+		for _, name := range []string{path, filepath.Join(filepath.Dir(path), EncryptedEnvsFile)} {
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+		return false
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		root = dir
+	}
+	if filePath != "" {
+		current, err := filepath.Abs(filepath.Dir(filePath))
+		for err == nil {
+			if path := filepath.Join(current, "envs.yml"); exists(path) {
+				return path
+			}
+			rel, relErr := filepath.Rel(root, current)
+			if relErr != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			current = filepath.Dir(current)
+		}
+	}
+	if path := filepath.Join(dir, "envs.yml"); exists(path) {
+		return path
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if path := filepath.Join(home, filepath.FromSlash(GlobalEnvsFile)); exists(path) {
+			return path
+		}
+	}
+	return filepath.Join(dir, "envs.yml")
+}
+
+// LoadEnvironment returns the variables of the environments envName names,
+// separated by commas, in the envs.yml at envsFile, merged left to right so
+// later ones win
+func LoadEnvironment(envName string, envsFile string) (Environment, error) {
+	return LoadEnvironmentSources(envName, envsFile, nil)
+}
+
+// LoadEnvironmentSources is LoadEnvironment, recording in sources the
+// environment each variable was set by, see EnvironmentSource
+func LoadEnvironmentSources(envName, envsFile string, sources Sources) (Environment, error) {
+	config, err := LoadEnvConfig(envsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load envs.yml: %w", err)
+	}
+
+	merged := Environment{}
+	for _, name := range EnvLayers(envName) {
+		env, ok := config.Environments[name]
+		if !ok {
+			return nil, fmt.Errorf("environment '%s' not found in envs.yml", name)
+		}
+		for k, v := range env {
+			merged[k] = v
+		}
+		sources.SetAll(env, EnvironmentSource(envsFile, name))
+	}
+	return merged, nil
+}
+
+// EnvLayers returns the names of the environments envName layers, in order
+func EnvLayers(envName string) []string {
+	if envName == "" {
+		return nil
+	}
+	return strings.Split(envName, ",")
+}
@@ -0,0 +1,189 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadEnvConfig(t *testing.T) {
+	// Create a temporary test file
+	tmpDir := t.TempDir()
+	envsFile := filepath.Join(tmpDir, "envs.yml")
+
+	content := `environments:
+  dev:
+    BASE_URL: "http://localhost:8081"
+    TOKEN: "dev-token"
+  prod:
+    BASE_URL: "https://api.production.com"
+    TOKEN: "prod-token"
+`
+
+	if err := os.WriteFile(envsFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	config, err := LoadEnvConfig(envsFile)
+	if err != nil {
+		t.Fatalf("loadEnvConfig() error = %v", err)
+	}
+
+	// Check environments exist
+	if _, ok := config.Environments["dev"]; !ok {
+		t.Error("dev environment not found")
+	}
+	if _, ok := config.Environments["prod"]; !ok {
+		t.Error("prod environment not found")
+	}
+
+	// Check dev values
+	devEnv := config.Environments["dev"]
+	if devEnv["BASE_URL"] != "http://localhost:8081" {
+		t.Errorf("dev BASE_URL = %s, want http://localhost:8081", devEnv["BASE_URL"])
+	}
+	if devEnv["TOKEN"] != "dev-token" {
+		t.Errorf("dev TOKEN = %s, want dev-token", devEnv["TOKEN"])
+	}
+
+	// Check prod values
+	prodEnv := config.Environments["prod"]
+	if prodEnv["BASE_URL"] != "https://api.production.com" {
+		t.Errorf("prod BASE_URL = %s, want https://api.production.com", prodEnv["BASE_URL"])
+	}
+}
+
+func TestLoadEnvironmentInheritance(t *testing.T) {
+	tests := []struct {
+		name    string
+		envs    string
+		env     string
+		want    Environment
+		wantErr string
+	}{
+		{
+			name: "defaults under every environment",
+			envs: "defaults:\n  TIMEOUT: \"30\"\n  BASE_URL: \"http://localhost\"\nenvironments:\n  dev:\n    BASE_URL: \"http://localhost:8080\"\n",
+			env:  "dev",
+			want: Environment{"TIMEOUT": "30", "BASE_URL": "http://localhost:8080"},
+		},
+		{
+			name: "multi-level extends",
+			envs: `defaults:
+  TIMEOUT: "30"
+  REGION: "eu"
+  TENANT: "default"
+environments:
+  base:
+    BASE_URL: "https://api.example.com"
+    TENANT: "acme"
+    REGION: "us"
+  staging:
+    extends: base
+    BASE_URL: "https://staging.example.com"
+    DEBUG: "true"
+  staging-eu:
+    extends: staging
+    REGION: "eu-west"
+`,
+			env:  "staging-eu",
+			want: Environment{"TIMEOUT": "30", "REGION": "eu-west", "TENANT": "acme", "BASE_URL": "https://staging.example.com", "DEBUG": "true"},
+		},
+		{
+			name: "parent keeps its own values",
+			envs: "environments:\n  base:\n    BASE_URL: \"https://api.example.com\"\n  staging:\n    extends: base\n    BASE_URL: \"https://staging.example.com\"\n",
+			env:  "base",
+			want: Environment{"BASE_URL": "https://api.example.com"},
+		},
+		{
+			name:    "cycle",
+			envs:    "environments:\n  a:\n    extends: b\n  b:\n    extends: c\n  c:\n    extends: a\n",
+			env:     "a",
+			wantErr: "extends cycle: ",
+		},
+		{
+			name:    "extends itself",
+			envs:    "environments:\n  dev:\n    extends: dev\n",
+			env:     "dev",
+			wantErr: "environment dev: extends cycle: dev -> dev",
+		},
+		{
+			name:    "unknown parent",
+			envs:    "environments:\n  dev:\n    extends: base\n",
+			env:     "dev",
+			wantErr: "environment dev extends base, which isn't in envs.yml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"envs.yml": tt.envs})
+			got, err := LoadEnvironment(tt.env, filepath.Join(dir, "envs.yml"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadEnvironmentVariables() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadEnvironmentVariables() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadEnvironmentVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvConfigFileNotFound(t *testing.T) {
+	_, err := LoadEnvConfig("nonexistent.yml")
+	if err == nil {
+		t.Error("expected error for nonexistent file, got nil")
+	}
+}
+
+func TestFindEnvsFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"services/users/envs.yml":             "environments: {}\n",
+		"services/users/GET_users.curl":       "curl -s x",
+		"services/users/admin/GET_admin.curl": "curl -s x",
+		"services/orders/GET_orders.curl":     "curl -s x",
+		"elsewhere/GET_health.curl":           "curl -s x",
+	})
+	join := func(parts ...string) string { return filepath.Join(append([]string{root}, parts...)...) }
+
+	tests := []struct {
+		name   string
+		dir    string
+		file   string
+		pinned string
+		global bool
+		want   string
+	}{
+		{name: "next to the file", dir: root, file: join("services", "users", "GET_users.curl"), want: join("services", "users", "envs.yml")},
+		{name: "up from the file", dir: root, file: join("services", "users", "admin", "GET_admin.curl"), want: join("services", "users", "envs.yml")},
+		{name: "not above the collection", dir: join("services", "users", "admin"), file: join("services", "users", "admin", "GET_admin.curl"), want: join("services", "users", "admin", "envs.yml")},
+		{name: "global fallback", dir: root, file: join("services", "orders", "GET_orders.curl"), global: true, want: filepath.Join(home, ".config", "curly", "envs.yml")},
+		{name: "pinned", dir: root, file: join("services", "users", "GET_users.curl"), pinned: "other.yml", global: true, want: "other.yml"},
+		{name: "file outside the collection", dir: join("services"), file: join("elsewhere", "GET_health.curl"), global: true, want: filepath.Join(home, ".config", "curly", "envs.yml")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global := filepath.Join(home, ".config", "curly", "envs.yml")
+			os.Remove(global)
+			if tt.global {
+				writeFiles(t, home, map[string]string{".config/curly/envs.yml": "environments: {}\n"})
+			}
+			if got := FindEnvsFile(tt.dir, tt.file, tt.pinned); got != tt.want {
+				t.Errorf("findEnvsFile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
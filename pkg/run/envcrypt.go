@@ -0,0 +1,171 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// EncryptedEnvsFile is the age-encrypted envs.yml kept next to the plaintext
+// one, whose values win over it
+const EncryptedEnvsFile = "envs.enc.yml"
+
+// ErrNoAgeKey tells no key to decrypt the environments was provided
+var ErrNoAgeKey = errors.New("no age key: set CURLY_AGE_KEY to the key, or SOPS_AGE_KEY_FILE to a file holding it")
+
+// AgeIdentities returns the age keys of CURLY_AGE_KEY and of the file
+// SOPS_AGE_KEY_FILE names, or ErrNoAgeKey when neither is set
+func AgeIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+	if key := os.Getenv("CURLY_AGE_KEY"); key != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("CURLY_AGE_KEY: %w", err)
+		}
+		identities = append(identities, ids...)
+	}
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("SOPS_AGE_KEY_FILE: %w", err)
+		}
+		ids, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("SOPS_AGE_KEY_FILE %s: %w", path, err)
+		}
+		identities = append(identities, ids...)
+	}
+	if len(identities) == 0 {
+		return nil, ErrNoAgeKey
+	}
+	return identities, nil
+}
+
+// DecryptAge decrypts data, the age-encrypted file at path, armored or not,
+// in memory
+func DecryptAge(path string, data []byte) ([]byte, error) {
+	identities, err := AgeIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("%s is encrypted: %w", filepath.Base(path), err)
+	}
+	var in io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		in = armor.NewReader(in)
+	}
+	r, err := age.Decrypt(in, identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, fmt.Errorf("%s is encrypted for other keys than those of CURLY_AGE_KEY and SOPS_AGE_KEY_FILE: %w", filepath.Base(path), ErrNoAgeKey)
+	}
+	if err == nil {
+		data, err = io.ReadAll(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %w", filepath.Base(path), err)
+	}
+	return data, nil
+}
+
+// isSopsFile reports whether data is a YAML file encrypted with sops, which
+// keeps its metadata under a top-level sops key
+func isSopsFile(data []byte) bool {
+	var doc struct {
+		Sops map[string]any `yaml:"sops"`
+	}
+	return yaml.Unmarshal(data, &doc) == nil && doc.Sops != nil
+}
+
+// decryptSops decrypts the sops-encrypted file at path with the sops command,
+// which prints it on stdout, so it never lands on disk. CURLY_AGE_KEY is
+// handed to it as SOPS_AGE_KEY
+func decryptSops(path string) ([]byte, error) {
+	sops, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, fmt.Errorf("%s is encrypted with sops, which isn't installed", filepath.Base(path))
+	}
+	cmd := exec.Command(sops, "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	cmd.Env = os.Environ()
+	if key := os.Getenv("CURLY_AGE_KEY"); key != "" && os.Getenv("SOPS_AGE_KEY") == "" {
+		cmd.Env = append(cmd.Env, "SOPS_AGE_KEY="+key)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "Failed to get the data key") || strings.Contains(msg, "no identity matched") {
+			return nil, fmt.Errorf("%s is encrypted with sops: %w", filepath.Base(path), ErrNoAgeKey)
+		}
+		return nil, fmt.Errorf("%s is corrupt: sops: %s", filepath.Base(path), msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// readEnvsDocument reads the envs.yml at path, decrypting it when sops
+// encrypted it, or when it is an envs.enc.yml, which age encrypted
+func readEnvsDocument(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case filepath.Base(path) == EncryptedEnvsFile:
+		data, err = DecryptAge(path, data)
+	case isSopsFile(data):
+		data, err = decryptSops(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if doc.Kind == 0 {
+		// An empty file
+		doc.Kind = yaml.DocumentNode
+	}
+	return &doc, nil
+}
+
+// mergeYAML merges the mapping over into base, key by key and into nested
+// mappings, the values of over winning
+func mergeYAML(base, over *yaml.Node) {
+	if base.Kind == yaml.DocumentNode && over.Kind == yaml.DocumentNode {
+		if len(base.Content) == 0 {
+			base.Content = over.Content
+			return
+		}
+		if len(over.Content) > 0 {
+			mergeYAML(base.Content[0], over.Content[0])
+		}
+		return
+	}
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		*base = *over
+		return
+	}
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, value := over.Content[i], over.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value == key.Value {
+				mergeYAML(base.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+}
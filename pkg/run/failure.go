@@ -0,0 +1,188 @@
+package run
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sort"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+// FailureClass is the kind of failure an execution had, which the summary
+// groups its errors by
+type FailureClass string
+
+// The classes of failures that aren't down to the HTTP status, see
+// StatusFailure
+const (
+	FailureConnection FailureClass = "Connection error"
+	FailureTimeout    FailureClass = "Timeout"
+	FailureTLS        FailureClass = "TLS error"
+	FailureAssertion  FailureClass = "Assertion failure"
+	FailureOther      FailureClass = "Other"
+)
+
+// StatusFailure is the class of a failure getting the HTTP status code, like
+// "HTTP 5xx"
+func StatusFailure(code int) FailureClass {
+	return FailureClass(fmt.Sprintf("HTTP %dxx", code/100))
+}
+
+// curlExitClasses are the classes of the exit codes of curl that are down to
+// the connection, rather than to how curl was called
+var curlExitClasses = map[int]FailureClass{
+	5:  FailureConnection, // couldn't resolve the proxy
+	6:  FailureConnection, // couldn't resolve the host
+	7:  FailureConnection, // couldn't connect
+	52: FailureConnection, // empty reply
+	55: FailureConnection, // failed sending
+	56: FailureConnection, // failed receiving
+	28: FailureTimeout,
+	35: FailureTLS, // handshake failed
+	51: FailureTLS,
+	53: FailureTLS,
+	54: FailureTLS,
+	58: FailureTLS,
+	59: FailureTLS,
+	60: FailureTLS, // certificate not verified
+	64: FailureTLS,
+	66: FailureTLS,
+	77: FailureTLS,
+	80: FailureTLS,
+	82: FailureTLS,
+	83: FailureTLS,
+	90: FailureTLS,
+	91: FailureTLS,
+}
+
+// ClassifyFailure returns the class of err, the failure of an execution whose
+// last response had the HTTP status status, 0 without one. The exit code of
+// a command is taken for curl's, and curl's --fail exit code of 22 for its
+// status
+func ClassifyFailure(err error, status int) FailureClass {
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if class, ok := curlExitClasses[exitErr.ExitCode()]; ok {
+			return class
+		}
+		if exitErr.ExitCode() == 22 && status >= 400 {
+			return StatusFailure(status)
+		}
+		return FailureOther
+	}
+
+	// The errors of --native requests
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return FailureTimeout
+	}
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &verifyErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) {
+		return FailureTLS
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return FailureConnection
+	}
+	if status >= 400 {
+		return StatusFailure(status)
+	}
+	return FailureOther
+}
+
+// ClassifiedError is an error whose class is known, with its message
+type ClassifiedError struct {
+	Class FailureClass
+	Err   error
+}
+
+func (e ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// examplesShown is how many of the messages of a class of errors the
+// summary shows
+const examplesShown = 3
+
+// writeErrorSummary writes the errors of s to w, grouped by class and then
+// by message, each with the requests it happened in. The classes are red
+// when w colors
+func writeErrorSummary(w io.Writer, s *ExecutionStats) {
+	if len(s.Errors) == 0 {
+		return
+	}
+	type message struct {
+		text       string
+		count      int
+		iterations []int
+	}
+	classCounts := map[FailureClass]int{}
+	messages := map[FailureClass][]*message{}
+	seen := map[[2]string]*message{}
+	for i, err := range s.Errors {
+		class := FailureOther
+		if i < len(s.ErrorClasses) {
+			class = s.ErrorClasses[i]
+		}
+		classCounts[class]++
+		m := seen[[2]string{string(class), err}]
+		if m == nil {
+			m = &message{text: err}
+			seen[[2]string{string(class), err}] = m
+			messages[class] = append(messages[class], m)
+		}
+		m.count++
+		if i < len(s.ErrorIterations) && s.ErrorIterations[i] > 0 {
+			m.iterations = append(m.iterations, s.ErrorIterations[i])
+		}
+	}
+
+	classes := make([]FailureClass, 0, len(classCounts))
+	for class := range classCounts {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classCounts[classes[i]] != classCounts[classes[j]] {
+			return classCounts[classes[i]] > classCounts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+
+	fmt.Fprintf(w, "\nErrors:\n")
+	for _, class := range classes {
+		fmt.Fprintf(w, "  %s: %d\n", output.From(w).Failure(string(class)), classCounts[class])
+		examples := messages[class]
+		sort.SliceStable(examples, func(i, j int) bool { return examples[i].count > examples[j].count })
+		for i, m := range examples {
+			if i == examplesShown {
+				fmt.Fprintf(w, "    and %d more\n", len(examples)-examplesShown)
+				break
+			}
+			if m.count > 1 {
+				fmt.Fprintf(w, "    [%dx] %s%s\n", m.count, m.text, formatIterations(m.iterations))
+			} else {
+				fmt.Fprintf(w, "    %s%s\n", m.text, formatIterations(m.iterations))
+			}
+		}
+	}
+}
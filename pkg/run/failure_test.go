@@ -0,0 +1,83 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	// exitError returns the error of a shell exiting with code, the way a
+	// curl command failing with it ends
+	exitError := func(code int) error {
+		err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+		return fmt.Errorf("command exited with error: %w", err)
+	}
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   FailureClass
+	}{
+		{name: "curl couldn't resolve the host", err: exitError(6), want: FailureConnection},
+		{name: "curl couldn't connect", err: exitError(7), want: FailureConnection},
+		{name: "curl timed out", err: exitError(28), want: FailureTimeout},
+		{name: "curl's TLS handshake failed", err: exitError(35), want: FailureTLS},
+		{name: "curl --fail got 404", err: exitError(22), status: 404, want: "HTTP 4xx"},
+		{name: "curl --fail got 503", err: exitError(22), status: 503, want: "HTTP 5xx"},
+		{name: "another exit code", err: exitError(3), status: 503, want: FailureOther},
+		{name: "native --fail got 404", err: errors.New("HTTP status 404 with --fail"), status: 404, want: "HTTP 4xx"},
+		{name: "failing status", err: ClassifiedError{Class: StatusFailure(503), Err: errors.New("HTTP status 503")}, status: 503, want: "HTTP 5xx"},
+		{name: "assertion", err: ClassifiedError{Class: FailureAssertion, Err: errors.New("expected status 200, got 404")}, status: 404, want: FailureAssertion},
+		{name: "native connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: FailureConnection},
+		{name: "native unknown host", err: &net.DNSError{Err: "no such host", Name: "api.curly.invalid"}, want: FailureConnection},
+		{name: "native timeout", err: context.DeadlineExceeded, want: FailureTimeout},
+		{name: "native certificate", err: x509.UnknownAuthorityError{}, want: FailureTLS},
+		{name: "unknown", err: errors.New("failed to save output"), want: FailureOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailure(tt.err, tt.status); got != tt.want {
+				t.Errorf("classifyFailure(%v, %d) = %q, want %q", tt.err, tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteErrorSummary(t *testing.T) {
+	stats := &ExecutionStats{StartTime: time.Now(), EndTime: time.Now()}
+	for _, iteration := range []int{17, 4, 37} {
+		stats.RecordIterationFailure(iteration, ClassifiedError{Class: StatusFailure(500), Err: errors.New("HTTP status 500")})
+	}
+	stats.RecordIterationFailure(5, ClassifiedError{Class: StatusFailure(503), Err: errors.New("HTTP status 503")})
+	for i, msg := range []string{"a", "b", "c", "d", "a"} {
+		stats.RecordIterationFailure(20+i, ClassifiedError{Class: FailureAssertion, Err: fmt.Errorf("expected .name == %q", msg)})
+	}
+	stats.RecordFailure(context.DeadlineExceeded)
+
+	var out bytes.Buffer
+	writeErrorSummary(&out, stats)
+	want := `
+Errors:
+  Assertion failure: 5
+    [2x] expected .name == "a" (requests #20, #24)
+    expected .name == "b" (requests #21)
+    expected .name == "c" (requests #22)
+    and 1 more
+  HTTP 5xx: 4
+    [3x] HTTP status 500 (requests #4, #17, #37)
+    HTTP status 503 (requests #5)
+  Timeout: 1
+    context deadline exceeded
+`
+	if out.String() != want {
+		t.Errorf("writeErrorSummary() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,62 @@
+package run
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LatencySample is how long one execution of the file took
+type LatencySample struct {
+	// Iteration numbers executions from 1 in the order they started
+	Iteration int
+	Duration  time.Duration
+	// Output is the file the response was saved to, if it was
+	Output string
+	// Status is the HTTP status of the last response, 0 without one
+	Status int
+	// RequestID is the UUID sent in the --request-id-header, if it was
+	RequestID string
+	// Timings are the timings of its requests, with --timing
+	Timings []RequestTiming
+}
+
+// LatencySummary describes the spread of the latency samples of a run
+type LatencySummary struct {
+	Min, Max, Mean     time.Duration
+	P50, P90, P95, P99 time.Duration
+}
+
+// SummarizeLatencies computes the summary of samples, which must not be empty
+func SummarizeLatencies(samples []LatencySample) LatencySummary {
+	sorted := make([]time.Duration, len(samples))
+	var total time.Duration
+	for i, sample := range samples {
+		sorted[i] = sample.Duration
+		total += sample.Duration
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return LatencySummary{
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		Mean: total / time.Duration(len(sorted)),
+		P50:  Percentile(sorted, 50),
+		P90:  Percentile(sorted, 90),
+		P95:  Percentile(sorted, 95),
+		P99:  Percentile(sorted, 99),
+	}
+}
+
+// Percentile returns the nearest-rank pth percentile of sorted durations
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// SlowestSamples returns the n slowest samples, slowest first
+func SlowestSamples(samples []LatencySample, n int) []LatencySample {
+	sorted := append([]LatencySample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+	return sorted[:min(n, len(sorted))]
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeLatencies(t *testing.T) {
+	// Iteration i took i milliseconds, shuffled as parallel runs finish
+	var samples []LatencySample
+	for _, i := range []int{7, 100, 1, 55, 3} {
+		samples = append(samples, LatencySample{Iteration: i, Duration: time.Duration(i) * time.Millisecond})
+	}
+	for i := 1; i <= 100; i++ {
+		if i != 7 && i != 100 && i != 1 && i != 55 && i != 3 {
+			samples = append(samples, LatencySample{Iteration: i, Duration: time.Duration(i) * time.Millisecond})
+		}
+	}
+
+	got := SummarizeLatencies(samples)
+	want := LatencySummary{
+		Min:  1 * time.Millisecond,
+		Max:  100 * time.Millisecond,
+		Mean: 50500 * time.Microsecond,
+		P50:  50 * time.Millisecond,
+		P90:  90 * time.Millisecond,
+		P95:  95 * time.Millisecond,
+		P99:  99 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("summarizeLatencies() = %+v, want %+v", got, want)
+	}
+
+	slowest := SlowestSamples(samples, 3)
+	if iterations := []int{slowest[0].Iteration, slowest[1].Iteration, slowest[2].Iteration}; !reflect.DeepEqual(iterations, []int{100, 99, 98}) {
+		t.Errorf("slowestSamples() iterations = %v, want [100 99 98]", iterations)
+	}
+}
+
+func TestSummarizeLatenciesSingleSample(t *testing.T) {
+	got := SummarizeLatencies([]LatencySample{{Iteration: 1, Duration: time.Second}})
+	if got.Min != time.Second || got.P50 != time.Second || got.P99 != time.Second || got.Max != time.Second {
+		t.Errorf("summarizeLatencies() = %+v, want every value to be 1s", got)
+	}
+	if n := len(SlowestSamples([]LatencySample{{Iteration: 1}}, 5)); n != 1 {
+		t.Errorf("slowestSamples() returned %d samples, want 1", n)
+	}
+}
+
+func TestExecutionStatsPrintsLatencies(t *testing.T) {
+	stats := &ExecutionStats{Total: 4, StartTime: time.Now()}
+	stats.EndTime = stats.StartTime.Add(time.Second)
+	for i, ms := range []int{40, 10, 30, 20} {
+		stats.RecordSuccess()
+		stats.RecordLatency(LatencySample{Iteration: i + 1, Duration: time.Duration(ms) * time.Millisecond})
+	}
+
+	var out bytes.Buffer
+	stats.Fprint(&out)
+	for _, want := range []string{
+		"  Avg time:   25ms\n",
+		"  Latency:    min 10ms, p50 20ms, p90 40ms, p95 40ms, p99 40ms, max 40ms\n",
+		"Slowest:\n  #1     40ms\n  #3     30ms\n  #4     20ms\n  #2     10ms\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary is missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package run
+
+import (
+	"path/filepath"
+	"slices"
+)
+
+// SourceFile is the source of a value assigned in the .curl file itself
+const SourceFile = "file"
+
+// Sources records where the values of variables came from: the sources that
+// set each, in the order they were applied, so the last of them won. A nil
+// Sources records nothing
+type Sources map[string][]string
+
+// Set records that source set the variable name
+func (s Sources) Set(name, source string) {
+	if s != nil {
+		s[name] = append(s[name], source)
+	}
+}
+
+// SetAll records that source set every variable of env
+func (s Sources) SetAll(env Environment, source string) {
+	for name := range env {
+		s.Set(name, source)
+	}
+}
+
+// Precedence returns the sources that set name in precedence order, the one
+// whose value won first, ending with SourceFile, which every value of a
+// variable assigned in the file overrides
+func (s Sources) Precedence(name string) []string {
+	sources := slices.Clone(s[name])
+	slices.Reverse(sources)
+	return append(sources, SourceFile)
+}
+
+// EnvironmentSource is the source of the values of the environment name in
+// the envs.yml at envsFile
+func EnvironmentSource(envsFile, name string) string {
+	return filepath.Base(envsFile) + " (" + name + ")"
+}
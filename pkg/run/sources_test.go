@@ -0,0 +1,52 @@
+package run
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	sources := Sources{}
+	sources.SetAll(Environment{"REGION": "dotenv", "TENANT": "dotenv"}, ".env")
+	sources.Set("REGION", "envs.yml (staging)")
+	sources.Set("REGION", "--var")
+
+	if got, want := sources.Precedence("REGION"), []string{"--var", "envs.yml (staging)", ".env", SourceFile}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Precedence(REGION) = %v, want %v", got, want)
+	}
+	if got, want := sources.Precedence("ID"), []string{SourceFile}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Precedence(ID) = %v, want %v", got, want)
+	}
+
+	// A nil Sources records nothing
+	var none Sources
+	none.Set("REGION", "--var")
+	if got := none.Precedence("REGION"); !reflect.DeepEqual(got, []string{SourceFile}) {
+		t.Errorf("nil Precedence(REGION) = %v, want just the file", got)
+	}
+}
+
+func TestLoadEnvironmentSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"envs.yml": `environments:
+  staging:
+    REGION: "us"
+    ROLE: "user"
+  as-admin:
+    ROLE: "admin"
+`})
+
+	sources := Sources{}
+	env, err := LoadEnvironmentSources("staging,as-admin", filepath.Join(dir, "envs.yml"), sources)
+	if err != nil {
+		t.Fatalf("LoadEnvironmentSources() error = %v", err)
+	}
+	if env["ROLE"] != "admin" {
+		t.Errorf("ROLE = %q, want admin", env["ROLE"])
+	}
+	want := Sources{"REGION": {"envs.yml (staging)"}, "ROLE": {"envs.yml (staging)", "envs.yml (as-admin)"}}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+}
@@ -0,0 +1,212 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+// ExecutionStats is what the executions of a run got, for its summary. The
+// Record methods are safe to call from the goroutines running them
+type ExecutionStats struct {
+	// Total is how many executions the run made
+	Total   int
+	Success int32
+	Failed  int32
+	// Throttled counts the executions whose response was a 429, or a 503
+	// with a Retry-After, when the run respected them rather than counting
+	// them as successes or failures
+	Throttled int32
+	StartTime time.Time
+	EndTime   time.Time
+	Errors    []string
+	// ErrorIterations holds the iteration each of Errors happened in, 0
+	// when it isn't known
+	ErrorIterations []int
+	// ErrorClasses holds the class of each of Errors, see ClassifyFailure
+	ErrorClasses []FailureClass
+	// StatusCodes counts the HTTP statuses the curl commands got back
+	StatusCodes map[int]int
+	// Latencies holds how long each execution took
+	Latencies []LatencySample
+	// TargetRate is the --rate the run was paced at, in requests per second
+	TargetRate float64
+	// Aborted is why the run was aborted early, if it was
+	Aborted string
+	// FailedRows are the numbers of the --data-file rows with failures,
+	// once per failed execution
+	FailedRows []int
+	// Captured holds the values captured from the last response by the
+	// file's # capture: comments
+	Captured Environment
+	// Steps holds what each curl command got, for a file running several
+	Steps     []StepStats
+	errorsMux sync.Mutex
+}
+
+// RecordSuccess records an execution that succeeded
+func (s *ExecutionStats) RecordSuccess() {
+	atomic.AddInt32(&s.Success, 1)
+}
+
+// RecordThrottled records an execution whose response was throttled
+func (s *ExecutionStats) RecordThrottled() {
+	atomic.AddInt32(&s.Throttled, 1)
+}
+
+// RecordFailure records a failure that isn't down to one execution
+func (s *ExecutionStats) RecordFailure(err error) {
+	s.RecordIterationFailure(0, err)
+}
+
+// RecordIterationFailure records the failure of the execution numbered
+// iteration
+func (s *ExecutionStats) RecordIterationFailure(iteration int, err error) {
+	atomic.AddInt32(&s.Failed, 1)
+	s.errorsMux.Lock()
+	s.Errors = append(s.Errors, err.Error())
+	s.ErrorIterations = append(s.ErrorIterations, iteration)
+	s.ErrorClasses = append(s.ErrorClasses, ClassifyFailure(err, 0))
+	s.errorsMux.Unlock()
+}
+
+// RecordFailedRow records a failure of the --data-file row number
+func (s *ExecutionStats) RecordFailedRow(number int) {
+	s.errorsMux.Lock()
+	s.FailedRows = append(s.FailedRows, number)
+	s.errorsMux.Unlock()
+}
+
+// RecordStatus records an HTTP status a curl command got back
+func (s *ExecutionStats) RecordStatus(code int) {
+	s.errorsMux.Lock()
+	if s.StatusCodes == nil {
+		s.StatusCodes = make(map[int]int)
+	}
+	s.StatusCodes[code]++
+	s.errorsMux.Unlock()
+}
+
+// RecordLatency records how long an execution took
+func (s *ExecutionStats) RecordLatency(sample LatencySample) {
+	s.errorsMux.Lock()
+	s.Latencies = append(s.Latencies, sample)
+	s.errorsMux.Unlock()
+}
+
+// RecordCaptures records the values captured from the last response
+func (s *ExecutionStats) RecordCaptures(values Environment) {
+	s.errorsMux.Lock()
+	s.Captured = values
+	s.errorsMux.Unlock()
+}
+
+// Print writes the summary of the run to stderr, colored when it's a
+// terminal
+func (s *ExecutionStats) Print() {
+	s.Fprint(output.Stderr())
+}
+
+// slowestShown is how many of the slowest executions the summary lists
+const slowestShown = 5
+
+// Fprint writes the summary of the run to w, coloring the failures red, the
+// successes green and the throttled executions yellow when w is an
+// output.Writer that colors
+func (s *ExecutionStats) Fprint(w io.Writer) {
+	duration := s.EndTime.Sub(s.StartTime)
+	o := output.From(w)
+	success, failed := fmt.Sprint(s.Success), fmt.Sprint(s.Failed)
+	if s.Success > 0 {
+		success = o.Success(success)
+	}
+	if s.Failed > 0 {
+		failed = o.Failure(failed)
+	}
+
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "Summary:\n")
+	fmt.Fprintf(w, "  Total:      %d\n", s.Total)
+	fmt.Fprintf(w, "  Success:    %s\n", success)
+	fmt.Fprintf(w, "  Failed:     %s\n", failed)
+	if s.Throttled > 0 {
+		fmt.Fprintf(w, "  Throttled:  %s\n", o.Warning(fmt.Sprint(s.Throttled)))
+	}
+	if s.Aborted != "" {
+		fmt.Fprintf(w, "  Aborted:    %s\n", o.Failure(s.Aborted))
+	}
+	if len(s.FailedRows) > 0 {
+		rows := append([]int(nil), s.FailedRows...)
+		sort.Ints(rows)
+		rows = slices.Compact(rows)
+		numbers := make([]string, len(rows))
+		for i, row := range rows {
+			numbers[i] = strconv.Itoa(row)
+		}
+		fmt.Fprintf(w, "  Failed rows: %s\n", o.Failure(strings.Join(numbers, ", ")))
+	}
+	if len(s.StatusCodes) > 0 {
+		fmt.Fprintf(w, "  Statuses:   %s\n", FormatStatusCounts(s.StatusCodes))
+	}
+	fmt.Fprintf(w, "  Duration:   %s\n", duration.Round(time.Millisecond))
+
+	if len(s.Latencies) > 0 {
+		l := SummarizeLatencies(s.Latencies)
+		fmt.Fprintf(w, "  Avg time:   %s\n", l.Mean.Round(time.Millisecond))
+		fmt.Fprintf(w, "  Latency:    min %s, p50 %s, p90 %s, p95 %s, p99 %s, max %s\n",
+			l.Min.Round(time.Millisecond), l.P50.Round(time.Millisecond), l.P90.Round(time.Millisecond),
+			l.P95.Round(time.Millisecond), l.P99.Round(time.Millisecond), l.Max.Round(time.Millisecond))
+	}
+
+	if s.Total > 0 {
+		if duration.Seconds() > 0 {
+			throughput := float64(s.Total) / duration.Seconds()
+			if s.TargetRate > 0 {
+				fmt.Fprintf(w, "  Throughput: %.2f req/s (target %g req/s)\n", throughput, s.TargetRate)
+			} else {
+				fmt.Fprintf(w, "  Throughput: %.2f req/s\n", throughput)
+			}
+		}
+	}
+
+	if len(s.Latencies) > 1 {
+		fmt.Fprintf(w, "\nSlowest:\n")
+		for _, sample := range SlowestSamples(s.Latencies, slowestShown) {
+			fmt.Fprintf(w, "  #%-5d %s\n", sample.Iteration, sample.Duration.Round(time.Millisecond))
+		}
+	}
+	writeStepSummary(w, s.Steps)
+	WriteTimingSummary(w, s.Latencies)
+	writeErrorSummary(w, s)
+}
+
+// iterationsShown is how many of the requests an error happened in the
+// summary lists
+const iterationsShown = 10
+
+// formatIterations lists the numbers of the requests an error happened in,
+// the first iterationsShown of them, for the summary
+func formatIterations(iterations []int) string {
+	if len(iterations) == 0 {
+		return ""
+	}
+	sorted := append([]int(nil), iterations...)
+	sort.Ints(sorted)
+	numbers := make([]string, 0, iterationsShown+1)
+	for i, n := range sorted {
+		if i == iterationsShown {
+			numbers = append(numbers, fmt.Sprintf("and %d more", len(sorted)-iterationsShown))
+			break
+		}
+		numbers = append(numbers, "#"+strconv.Itoa(n))
+	}
+	return " (requests " + strings.Join(numbers, ", ") + ")"
+}
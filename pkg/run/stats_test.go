@@ -0,0 +1,75 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ErikVib/curly/internal/output"
+)
+
+func TestStatsErrorsListIterations(t *testing.T) {
+	stats := &ExecutionStats{StartTime: time.Now(), EndTime: time.Now()}
+	for _, iteration := range []int{17, 4, 37} {
+		stats.RecordIterationFailure(iteration, errors.New("HTTP status 500"))
+	}
+	for i := 1; i <= 12; i++ {
+		stats.RecordIterationFailure(100+i, errors.New("timeout"))
+	}
+	stats.RecordFailure(errors.New("no iteration"))
+
+	var out bytes.Buffer
+	stats.Fprint(&out)
+	for _, want := range []string{
+		"[3x] HTTP status 500 (requests #4, #17, #37)\n",
+		"[12x] timeout (requests #101, #102, #103, #104, #105, #106, #107, #108, #109, #110, and 2 more)\n",
+		"  no iteration\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestStatsColors(t *testing.T) {
+	stats := &ExecutionStats{Total: 4, Success: 2, Throttled: 1, StartTime: time.Now(), EndTime: time.Now()}
+	stats.RecordIterationFailure(3, ClassifiedError{Class: FailureTimeout, Err: errors.New("timed out")})
+
+	tests := []struct {
+		name  string
+		color bool
+		want  []string
+	}{
+		{
+			name:  "colored",
+			color: true,
+			want: []string{
+				"  Success:    " + output.Green + "2" + output.Reset + "\n",
+				"  Failed:     " + output.Red + "1" + output.Reset + "\n",
+				"  Throttled:  " + output.Yellow + "1" + output.Reset + "\n",
+				"  " + output.Red + "Timeout" + output.Reset + ": 1\n",
+			},
+		},
+		{
+			name: "plain",
+			want: []string{"  Success:    2\n", "  Failed:     1\n", "  Throttled:  1\n", "  Timeout: 1\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			stats.Fprint(output.New(&out, tt.color))
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("summary is missing %q:\n%q", want, out.String())
+				}
+			}
+			if !tt.color && strings.Contains(out.String(), "\033[") {
+				t.Errorf("summary without color has escape codes:\n%q", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Step is one of the curl commands of a file, which runs them in order
+// as the steps of each execution
+type Step struct {
+	// Name is the method and URL path of the command
+	Name string
+	// Reports is set when the command's output reaches curly, so it prints
+	// a status line
+	Reports bool
+}
+
+// StepStats is what the executions of a run got from one of the steps of
+// its file
+type StepStats struct {
+	Step
+	// Runs counts the executions that got a status line from the step
+	Runs int
+	// StatusCodes counts the HTTP statuses of the step
+	StatusCodes map[int]int
+	// Totals are the time_total of the step's requests, with --timing
+	Totals []time.Duration
+}
+
+// NewStepStats returns the stats of steps, nil for a file of a single one
+func NewStepStats(steps []Step) []StepStats {
+	if len(steps) < 2 {
+		return nil
+	}
+	stats := make([]StepStats, len(steps))
+	for i, step := range steps {
+		stats[i] = StepStats{Step: step, StatusCodes: map[int]int{}}
+	}
+	return stats
+}
+
+// RecordSteps records the status codes of an execution, one for each step
+// that reports one in order, 0 for a step without a response, and their
+// timings with --timing
+func (s *ExecutionStats) RecordSteps(codes []int, timings []RequestTiming) {
+	if len(s.Steps) == 0 {
+		return
+	}
+	s.errorsMux.Lock()
+	defer s.errorsMux.Unlock()
+	i := 0
+	for n := range s.Steps {
+		step := &s.Steps[n]
+		if !step.Reports {
+			continue
+		}
+		if i == len(codes) {
+			return
+		}
+		step.Runs++
+		if codes[i] != 0 {
+			step.StatusCodes[codes[i]]++
+		}
+		if len(timings) == len(codes) {
+			step.Totals = append(step.Totals, timings[i].Total)
+		}
+		i++
+	}
+}
+
+// writeStepSummary writes what each step of steps got to w, nothing for a
+// file of a single step
+func writeStepSummary(w io.Writer, steps []StepStats) {
+	if len(steps) == 0 {
+		return
+	}
+	width := 0
+	for _, step := range steps {
+		width = max(width, len(step.Name))
+	}
+	fmt.Fprintf(w, "\nSteps:\n")
+	for i, step := range steps {
+		if !step.Reports {
+			fmt.Fprintf(w, "  %d. %-*s  no status, its output doesn't reach curly\n", i+1, width, step.Name)
+			continue
+		}
+		details := []string{fmt.Sprintf("%d runs", step.Runs)}
+		if counts := FormatStatusCounts(step.StatusCodes); counts != "" {
+			details = append(details, counts)
+		}
+		if len(step.Totals) > 0 {
+			sorted := append([]time.Duration(nil), step.Totals...)
+			sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+			details = append(details, fmt.Sprintf("p50 %s, p95 %s", RoundTiming(Percentile(sorted, 50)), RoundTiming(Percentile(sorted, 95))))
+		}
+		fmt.Fprintf(w, "  %d. %-*s  %s\n", i+1, width, step.Name, strings.Join(details, ", "))
+	}
+}
+
+// FormatStatusCounts lists the counts of codes by status, like
+// "200: 8, 404: 2"
+func FormatStatusCounts(codes map[int]int) string {
+	sorted := make([]int, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Ints(sorted)
+	counts := make([]string, 0, len(sorted))
+	for _, code := range sorted {
+		counts = append(counts, fmt.Sprintf("%d: %d", code, codes[code]))
+	}
+	return strings.Join(counts, ", ")
+}
@@ -0,0 +1,27 @@
+package run
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteStepSummary(t *testing.T) {
+	steps := []StepStats{
+		{Step: Step{Name: "POST /users", Reports: true}, Runs: 10, StatusCodes: map[int]int{201: 9, 500: 1},
+			Totals: []time.Duration{20 * time.Millisecond, 40 * time.Millisecond}},
+		{Step: Step{Name: "GET /users/42", Reports: true}, Runs: 9, StatusCodes: map[int]int{200: 9}},
+		{Step: Step{Name: "DELETE /users/42"}},
+	}
+	var out bytes.Buffer
+	writeStepSummary(&out, steps)
+	want := `
+Steps:
+  1. POST /users       10 runs, 201: 9, 500: 1, p50 20ms, p95 40ms
+  2. GET /users/42     9 runs, 200: 9
+  3. DELETE /users/42  no status, its output doesn't reach curly
+`
+	if out.String() != want {
+		t.Errorf("writeStepSummary() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,110 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestTiming is how far into a request each of its phases was done, as
+// curl's time_namelookup, time_connect, time_appconnect, time_starttransfer
+// and time_total measure it, and the size of the body it downloaded. Phases
+// that didn't happen, like the TLS handshake of plain HTTP, are 0
+type RequestTiming struct {
+	NameLookup, Connect, AppConnect, StartTransfer, Total time.Duration
+	Size                                                  int64
+}
+
+// TimingPhases names the phases RequestTiming.Phases breaks a request into
+var TimingPhases = []string{"DNS", "Connect", "TLS", "Server", "Transfer"}
+
+// Phases returns how long each of TimingPhases took: resolving the host,
+// connecting, the TLS handshake, waiting for the first byte of the response
+// and downloading the rest of it
+func (t RequestTiming) Phases() []time.Duration {
+	ends := []time.Duration{t.NameLookup, t.Connect, t.AppConnect, t.StartTransfer, t.Total}
+	phases := make([]time.Duration, len(ends))
+	var done time.Duration
+	for i, end := range ends {
+		if end > done {
+			phases[i], done = end-done, end
+		}
+	}
+	return phases
+}
+
+// ParseTiming parses the timing of a status line, the values of time_namelookup,
+// time_connect, time_appconnect, time_starttransfer, time_total and
+// size_download curl prints for --timing, separated by commas
+func ParseTiming(s string) (RequestTiming, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 6 {
+		return RequestTiming{}, fmt.Errorf("invalid timing %q, expected 6 values", s)
+	}
+	var t RequestTiming
+	for i, d := range []*time.Duration{&t.NameLookup, &t.Connect, &t.AppConnect, &t.StartTransfer, &t.Total} {
+		seconds, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return RequestTiming{}, fmt.Errorf("invalid timing %q: %w", s, err)
+		}
+		*d = time.Duration(seconds * float64(time.Second))
+	}
+	size, err := strconv.ParseInt(fields[5], 10, 64)
+	if err != nil {
+		return RequestTiming{}, fmt.Errorf("invalid timing %q: %w", s, err)
+	}
+	t.Size = size
+	return t, nil
+}
+
+// String formats t the way ParseTiming parses it
+func (t RequestTiming) String() string {
+	var b strings.Builder
+	for _, d := range []time.Duration{t.NameLookup, t.Connect, t.AppConnect, t.StartTransfer, t.Total} {
+		fmt.Fprintf(&b, "%.6f,", d.Seconds())
+	}
+	b.WriteString(strconv.FormatInt(t.Size, 10))
+	return b.String()
+}
+
+// timingPercentiles are the percentiles the summary gives of each phase
+var timingPercentiles = []float64{50, 90, 99}
+
+// WriteTimingSummary writes the percentiles of each phase of the requests
+// timed in samples to w, nothing when none were
+func WriteTimingSummary(w io.Writer, samples []LatencySample) {
+	phases := make([][]time.Duration, len(TimingPhases)+1)
+	for _, sample := range samples {
+		for _, t := range sample.Timings {
+			for i, d := range t.Phases() {
+				phases[i] = append(phases[i], d)
+			}
+			phases[len(TimingPhases)] = append(phases[len(TimingPhases)], t.Total)
+		}
+	}
+	if len(phases[0]) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nTiming (p50, p90, p99):\n")
+	for i, name := range append(TimingPhases, "Total") {
+		sort.Slice(phases[i], func(a, b int) bool { return phases[i][a] < phases[i][b] })
+		values := make([]string, len(timingPercentiles))
+		for j, p := range timingPercentiles {
+			values[j] = fmt.Sprintf("%-9s", RoundTiming(Percentile(phases[i], p)))
+		}
+		fmt.Fprintf(w, "  %-10s %s\n", name, strings.TrimSpace(strings.Join(values, " ")))
+	}
+}
+
+// RoundTiming rounds d for the timing summary, to the millisecond unless
+// it's shorter than that
+func RoundTiming(d time.Duration) time.Duration {
+	if d < 10*time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
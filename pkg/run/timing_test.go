@@ -0,0 +1,74 @@
+package run
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRequestTimingPhases(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		timing RequestTiming
+		want   []time.Duration
+	}{
+		{
+			name:   "HTTPS",
+			timing: RequestTiming{NameLookup: 5 * ms, Connect: 15 * ms, AppConnect: 50 * ms, StartTransfer: 140 * ms, Total: 150 * ms},
+			want:   []time.Duration{5 * ms, 10 * ms, 35 * ms, 90 * ms, 10 * ms},
+		},
+		{
+			name:   "plain HTTP",
+			timing: RequestTiming{NameLookup: 5 * ms, Connect: 15 * ms, StartTransfer: 40 * ms, Total: 41 * ms},
+			want:   []time.Duration{5 * ms, 10 * ms, 0, 25 * ms, 1 * ms},
+		},
+		{
+			name:   "reused connection",
+			timing: RequestTiming{StartTransfer: 20 * ms, Total: 22 * ms},
+			want:   []time.Duration{0, 0, 0, 20 * ms, 2 * ms},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.timing.Phases(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("phases() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTimingSummary(t *testing.T) {
+	ms := time.Millisecond
+	var samples []LatencySample
+	for i := 1; i <= 10; i++ {
+		d := time.Duration(i) * ms
+		samples = append(samples, LatencySample{Iteration: i, Timings: []RequestTiming{
+			{NameLookup: d, Connect: 2 * d, AppConnect: 3 * d, StartTransfer: 10 * d, Total: 12 * d},
+		}})
+	}
+	samples = append(samples, LatencySample{Iteration: 11})
+
+	var out bytes.Buffer
+	WriteTimingSummary(&out, samples)
+	want := `
+Timing (p50, p90, p99):
+  DNS        5ms       9ms       10ms
+  Connect    5ms       9ms       10ms
+  TLS        5ms       9ms       10ms
+  Server     35ms      63ms      70ms
+  Transfer   10ms      18ms      20ms
+  Total      60ms      108ms     120ms
+`
+	if out.String() != want {
+		t.Errorf("WriteTimingSummary() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	WriteTimingSummary(&out, []LatencySample{{Iteration: 1}})
+	if out.Len() != 0 {
+		t.Errorf("WriteTimingSummary() without timings = %q, want nothing", out.String())
+	}
+}
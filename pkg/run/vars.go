@@ -0,0 +1,153 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ErikVib/curly/internal/shellquote"
+)
+
+// ApplyEnvironmentVars replaces the value of every top-level NAME=...
+// assignment ahead of the first curl command whose NAME is set in the
+// environment, regardless of the section header it sits under
+func ApplyEnvironmentVars(content string, envVars Environment) string {
+	lines := strings.Split(content, "\n")
+	inBody := HeredocBodies(lines)
+	for i, line := range lines {
+		if inBody[i] {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "curl") {
+			break
+		}
+		match := AssignmentPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if val, ok := envVars[match[1]]; ok {
+			lines[i] = fmt.Sprintf("%s=\"%s\"", match[1], val)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// AssignmentPattern matches an unindented, uncommented NAME= assignment
+var AssignmentPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// ParseVarOverrides parses --var KEY=VALUE flags
+func ParseVarOverrides(vars []string) (Environment, error) {
+	overrides := Environment{}
+	for _, v := range vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || !VarNamePattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid --var %q, expected KEY=VALUE", v)
+		}
+		overrides[key] = value
+	}
+	return overrides, nil
+}
+
+// VarNamePattern matches a shell variable name
+var VarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// varAssignmentPattern matches a KEY=... assignment, including one that is
+// commented out like an optional query parameter
+var varAssignmentPattern = regexp.MustCompile(`^(\s*)(?:#\s*)?([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// ApplyVarOverrides rewrites every assignment of an overridden variable ahead
+// of the curl command, wherever it appears, and returns the overridden keys
+// that the content never assigns. Commented-out assignments are uncommented
+// so overriding an optional parameter sends it
+func ApplyVarOverrides(content string, overrides Environment) (string, []string) {
+	lines := strings.Split(content, "\n")
+	inBody := HeredocBodies(lines)
+	found := map[string]bool{}
+	for i, line := range lines {
+		if inBody[i] {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "curl") {
+			break
+		}
+		match := varAssignmentPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if value, ok := overrides[match[2]]; ok {
+			lines[i] = fmt.Sprintf("%s%s=%s", match[1], match[2], shellquote.DoubleQuote(value))
+			found[match[2]] = true
+		}
+	}
+
+	var unknown []string
+	for key := range overrides {
+		if !found[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return strings.Join(lines, "\n"), unknown
+}
+
+// FileVariables lists the variables assigned ahead of the curl command, in
+// the order they first appear
+func FileVariables(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	lines := strings.Split(content, "\n")
+	inBody := HeredocBodies(lines)
+	for i, line := range lines {
+		if inBody[i] {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "curl") {
+			break
+		}
+		if match := varAssignmentPattern.FindStringSubmatch(line); match != nil && !seen[match[2]] {
+			seen[match[2]] = true
+			names = append(names, match[2])
+		}
+	}
+	return names
+}
+
+// OSEnvRefPattern matches ${env:NAME} and ${env:NAME:-default}, along with
+// a preceding backslash that escapes the reference
+var OSEnvRefPattern = regexp.MustCompile(`\\?\$\{env:([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ResolveOSEnvRefs replaces every ${env:NAME} reference with the value of the
+// OS environment variable, escaped for a double-quoted shell string. A
+// :-default is used when the variable is unset or empty; without one an unset
+// variable is an error, and an escaped \${env:NAME} is left as is
+func ResolveOSEnvRefs(content string) (string, error) {
+	missing := ""
+	resolved := OSEnvRefPattern.ReplaceAllStringFunc(content, func(ref string) string {
+		if strings.HasPrefix(ref, `\`) {
+			return ref
+		}
+		match := OSEnvRefPattern.FindStringSubmatch(ref)
+		name, hasDefault := match[1], strings.Contains(ref, ":-")
+
+		value, ok := os.LookupEnv(name)
+		if hasDefault && value == "" {
+			return match[2]
+		}
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return ref
+		}
+
+		return shellquote.EscapeDoubleQuoted(value)
+	})
+
+	if missing != "" {
+		return "", fmt.Errorf("OS environment variable %s is not set, use ${env:%s:-default} for a fallback", missing, missing)
+	}
+	return resolved, nil
+}
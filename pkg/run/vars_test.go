@@ -0,0 +1,337 @@
+package run
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvironmentVars(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		envVars  Environment
+		expected string
+	}{
+		{
+			name: "replace single variable",
+			content: `# Variables
+BASE_URL="http://localhost"
+
+curl "${BASE_URL}/test"`,
+			envVars: Environment{
+				"BASE_URL": "http://production.com",
+			},
+			expected: `# Variables
+BASE_URL="http://production.com"
+
+curl "${BASE_URL}/test"`,
+		},
+		{
+			name: "not in a heredoc ahead of curl",
+			content: `BODY=$(cat <<'EOF'
+TOKEN=body
+curl is mentioned
+TOKEN=still-body
+EOF
+)
+TOKEN="VALUE"
+curl -d "$BODY" test`,
+			envVars: Environment{"TOKEN": "dev-token-123"},
+			expected: `BODY=$(cat <<'EOF'
+TOKEN=body
+curl is mentioned
+TOKEN=still-body
+EOF
+)
+TOKEN="dev-token-123"
+curl -d "$BODY" test`,
+		},
+		{
+			name: "replace multiple variables",
+			content: `# Variables
+BASE_URL="VALUE"
+TOKEN="VALUE"
+
+curl test`,
+			envVars: Environment{
+				"BASE_URL": "http://dev.local",
+				"TOKEN":    "dev-token-123",
+			},
+			expected: `# Variables
+BASE_URL="http://dev.local"
+TOKEN="dev-token-123"
+
+curl test`,
+		},
+		{
+			name: "variable not in env keeps original",
+			content: `# Variables
+BASE_URL="VALUE"
+OTHER="VALUE"
+
+curl test`,
+			envVars: Environment{
+				"BASE_URL": "http://test.com",
+			},
+			expected: `# Variables
+BASE_URL="http://test.com"
+OTHER="VALUE"
+
+curl test`,
+		},
+		{
+			name: "generated section headers",
+			content: `# GET /users/{id}
+
+#### Variables ####
+
+BASE_URL="http://localhost"
+
+#### Path Parameters ####
+# type: string, required
+ID="VALUE"
+
+#### Headers ####
+AUTHORIZATION="VALUE"
+
+curl -s "${BASE_URL}/users/${ID}" -H "Authorization: ${AUTHORIZATION}"`,
+			envVars: Environment{
+				"BASE_URL":      "http://dev.local",
+				"ID":            "42",
+				"AUTHORIZATION": "Bearer dev",
+			},
+			expected: `# GET /users/{id}
+
+#### Variables ####
+
+BASE_URL="http://dev.local"
+
+#### Path Parameters ####
+# type: string, required
+ID="42"
+
+#### Headers ####
+AUTHORIZATION="Bearer dev"
+
+curl -s "${BASE_URL}/users/${ID}" -H "Authorization: ${AUTHORIZATION}"`,
+		},
+		{
+			name: "commented, indented and body lines are left alone",
+			content: `NAME="file"
+# NAME="commented"
+  NAME="indented"
+
+curl -s --data-binary @- << 'EOF'
+NAME=body
+EOF`,
+			envVars: Environment{"NAME": "env"},
+			expected: `NAME="env"
+# NAME="commented"
+  NAME="indented"
+
+curl -s --data-binary @- << 'EOF'
+NAME=body
+EOF`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ApplyEnvironmentVars(tt.content, tt.envVars)
+
+			if result != tt.expected {
+				t.Errorf("applyEnvironmentVars() =\n%q\n\nwant:\n%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseVarOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    []string
+		want    Environment
+		wantErr bool
+	}{
+		{
+			name: "key value pairs",
+			vars: []string{"ID=42", "QUERY=a=b c"},
+			want: Environment{"ID": "42", "QUERY": "a=b c"},
+		},
+		{
+			name: "empty value",
+			vars: []string{"TOKEN="},
+			want: Environment{"TOKEN": ""},
+		},
+		{
+			name:    "missing equals sign",
+			vars:    []string{"ID"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid variable name",
+			vars:    []string{"MY-ID=1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVarOverrides(tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVarOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseVarOverrides() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseVarOverrides()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyVarOverrides(t *testing.T) {
+	content := `# GET /users/{id}
+
+#### Variables ####
+
+BASE_URL="http://localhost"
+
+#### Path Parameters ####
+ID="1"
+
+#### Query Parameters ####
+# Optional, uncomment to send
+# SORT="name"
+
+curl -s -X GET "${BASE_URL}/users/${ID}" --data-binary @- << EOF
+ID=body-line
+EOF`
+
+	tests := []struct {
+		name        string
+		overrides   Environment
+		want        []string
+		wantNot     []string
+		wantUnknown []string
+	}{
+		{
+			name:      "overrides assignment outside a variables header",
+			overrides: Environment{"ID": "42"},
+			want:      []string{"\nID=\"42\"\n", "\nID=body-line\n"},
+			wantNot:   []string{`ID="1"`},
+		},
+		{
+			name:      "uncomments a commented-out assignment",
+			overrides: Environment{"SORT": "created"},
+			want:      []string{"\nSORT=\"created\"\n"},
+			wantNot:   []string{`# SORT=`},
+		},
+		{
+			name:      "values are quoted for the shell",
+			overrides: Environment{"ID": `a"b$c`},
+			want:      []string{`ID="a\"b\$c"`},
+		},
+		{
+			name:        "unknown keys are reported",
+			overrides:   Environment{"ID": "42", "NOPE": "1", "ALSO_NOPE": "2"},
+			want:        []string{`ID="42"`},
+			wantUnknown: []string{"ALSO_NOPE", "NOPE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unknown := ApplyVarOverrides(content, tt.overrides)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("applyVarOverrides() missing %q, got:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("applyVarOverrides() unexpectedly contains %q, got:\n%s", unwanted, got)
+				}
+			}
+			if strings.Join(unknown, ",") != strings.Join(tt.wantUnknown, ",") {
+				t.Errorf("applyVarOverrides() unknown = %v, want %v", unknown, tt.wantUnknown)
+			}
+		})
+	}
+
+	if got := FileVariables(content); strings.Join(got, ",") != "BASE_URL,ID,SORT" {
+		t.Errorf("fileVariables() = %v, want [BASE_URL ID SORT]", got)
+	}
+}
+
+func TestResolveOSEnvRefs(t *testing.T) {
+	t.Setenv("CURLY_TEST_TOKEN", `s3cr"et`)
+	t.Setenv("CURLY_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "set variable",
+			content: `TOKEN="${env:CURLY_TEST_TOKEN}"`,
+			want:    `TOKEN="s3cr\"et"`,
+		},
+		{
+			name:    "unset variable",
+			content: `TOKEN="${env:CURLY_TEST_UNSET}"`,
+			wantErr: "CURLY_TEST_UNSET is not set",
+		},
+		{
+			name:    "unset variable with default",
+			content: `TOKEN="${env:CURLY_TEST_UNSET:-dev-token}"`,
+			want:    `TOKEN="dev-token"`,
+		},
+		{
+			name:    "empty variable with default",
+			content: `TOKEN="${env:CURLY_TEST_EMPTY:-dev-token}"`,
+			want:    `TOKEN="dev-token"`,
+		},
+		{
+			name:    "set variable ignores default",
+			content: `TOKEN="${env:CURLY_TEST_TOKEN:-dev-token}"`,
+			want:    `TOKEN="s3cr\"et"`,
+		},
+		{
+			name:    "escaped reference is untouched",
+			content: `TOKEN="\${env:CURLY_TEST_UNSET}"`,
+			want:    `TOKEN="\${env:CURLY_TEST_UNSET}"`,
+		},
+		{
+			name:    "plain shell variables are untouched",
+			content: `curl "${BASE_URL}/users"`,
+			want:    `curl "${BASE_URL}/users"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveOSEnvRefs(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveOSEnvRefs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveOSEnvRefs() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveOSEnvRefs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}